@@ -0,0 +1,10 @@
+package v1alpha1
+
+// v1alpha1 is the storage version and the conversion hub; the controllers work on these types
+// and other versions convert to and from them through the conversion webhook.
+
+// Hub marks this type as a conversion hub.
+func (*TorchrunJob) Hub() {}
+
+// Hub marks this type as a conversion hub.
+func (*TorchrunQueue) Hub() {}
@@ -0,0 +1,124 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TorchrunJobRecordSpec summarizes a finished TorchrunJob
+type TorchrunJobRecordSpec struct {
+	// Name of the TorchrunJob
+	Job string `json:"job"`
+
+	// Application-level job name of the TorchrunJob
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+
+	// ID of the TorchrunJob
+	// +optional
+	JobID string `json:"jobID,omitempty"`
+
+	// TorchrunQueue the job ran in
+	Queue string `json:"queue"`
+
+	// Namespace of the TorchrunQueue, set when it is not the namespace of the record
+	// +optional
+	QueueNamespace string `json:"queueNamespace,omitempty"`
+
+	// User of the torchrun.ai/user label of the job
+	// +optional
+	User string `json:"user,omitempty"`
+
+	// Final phase of the job
+	// +kubebuilder:validation:Enum=Succeeded;Failed;TimedOut;Deleted
+	Phase string `json:"phase"`
+
+	// Reason the job ended, e.g. Completed, BackoffLimitExceeded or DeadlineExceeded
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message of the reason
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Time the job started running
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// Time the job finished
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Seconds from the start to the completion of the job
+	// +optional
+	DurationSeconds int64 `json:"durationSeconds,omitempty"`
+
+	// Number of nodes the job ran on
+	// +optional
+	NumNodes int `json:"numNodes,omitempty"`
+
+	// GPUs of all workers
+	// +optional
+	GPUs int `json:"gpus,omitempty"`
+
+	// GPU time of the worker pods of all attempts in seconds
+	// +optional
+	GPUSeconds int64 `json:"gpuSeconds,omitempty"`
+
+	// GPU hours of the job with two decimals, from its GPU time, or the GPUs times the duration
+	// in hours when no worker pod time was accounted
+	// +optional
+	GPUHours string `json:"gpuHours,omitempty"`
+
+	// Number of Job attempts
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+
+	// Number of worker restarts
+	// +optional
+	Restarts int32 `json:"restarts,omitempty"`
+
+	// Checkpoint directory of the job, <volume>/<jobName>
+	// +optional
+	CheckpointLocation string `json:"checkpointLocation,omitempty"`
+
+	// URL the worker logs were archived to
+	// +optional
+	LogArchiveURL string `json:"logArchiveURL,omitempty"`
+
+	// Link to the experiment tracking run
+	// +optional
+	TrackingURL string `json:"trackingURL,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=trjr
+// +kubebuilder:printcolumn:name="Job",type="string",JSONPath=".spec.job"
+// +kubebuilder:printcolumn:name="Queue",type="string",JSONPath=".spec.queue"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".spec.phase"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".spec.reason"
+// +kubebuilder:printcolumn:name="Nodes",type="integer",JSONPath=".spec.numNodes"
+// +kubebuilder:printcolumn:name="GPU-Hours",type="string",JSONPath=".spec.gpuHours"
+// +kubebuilder:printcolumn:name="Completed",type="date",JSONPath=".spec.completionTime"
+
+// TorchrunJobRecord is the compact history entry the controller writes when a TorchrunJob
+// finishes. It is not owned by the job, so it outlives the job, its Kubernetes Job and its pods
+// for billing and reporting.
+type TorchrunJobRecord struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TorchrunJobRecordSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TorchrunJobRecordList contains a list of TorchrunJobRecord
+type TorchrunJobRecordList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TorchrunJobRecord `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TorchrunJobRecord{}, &TorchrunJobRecordList{})
+}
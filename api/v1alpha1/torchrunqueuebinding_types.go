@@ -0,0 +1,45 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TorchrunQueueBindingSpec defines which namespaces may submit jobs to a TorchrunQueue in the
+// namespace of the binding
+type TorchrunQueueBindingSpec struct {
+	// Name of the TorchrunQueue in the namespace of the binding
+	// +kubebuilder:validation:MinLength=1
+	Queue string `json:"queue"`
+
+	// Namespaces whose TorchrunJobs may reference the queue with queueNamespace
+	// +kubebuilder:validation:MinItems=1
+	Namespaces []string `json:"namespaces"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=trqb
+// +kubebuilder:printcolumn:name="Queue",type="string",JSONPath=".spec.queue"
+// +kubebuilder:printcolumn:name="Namespaces",type="string",JSONPath=".spec.namespaces"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// TorchrunQueueBinding grants TorchrunJobs in other namespaces access to a TorchrunQueue. It is
+// created by the queue admin in the namespace of the queue.
+type TorchrunQueueBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TorchrunQueueBindingSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TorchrunQueueBindingList contains a list of TorchrunQueueBinding
+type TorchrunQueueBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TorchrunQueueBinding `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TorchrunQueueBinding{}, &TorchrunQueueBindingList{})
+}
@@ -0,0 +1,65 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TorchrunTemplateSpec defines the job settings a TorchrunTemplate provides.
+// Fields set on a TorchrunJob take precedence; env is merged by variable name, labels and
+// annotations by key, and reliability field by field.
+type TorchrunTemplateSpec struct {
+	// Training command to execute
+	Command string `json:"command,omitempty"`
+
+	// Optional command to run before training (e.g., download data, install packages)
+	SetupCommand string `json:"setupCommand,omitempty"`
+
+	// Number of nodes for training
+	// +kubebuilder:validation:Minimum=1
+	NumNodes int `json:"numNodes,omitempty"`
+
+	// Scheduling priority of the job within its queue
+	// +kubebuilder:validation:Enum=preemptible;normal;high
+	Priority string `json:"priority,omitempty"`
+
+	// Environment variables for the trainer
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Reliability and lifecycle settings
+	Reliability *ReliabilityConfig `json:"reliability,omitempty"`
+
+	// Annotations to add to worker pods
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Labels to add to worker pods
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=trt
+// +kubebuilder:printcolumn:name="Command",type="string",JSONPath=".spec.command"
+// +kubebuilder:printcolumn:name="Nodes",type="integer",JSONPath=".spec.numNodes"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// TorchrunTemplate is a reusable preset that TorchrunJobs in the same namespace reference
+// with templateRef
+type TorchrunTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TorchrunTemplateSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TorchrunTemplateList contains a list of TorchrunTemplate
+type TorchrunTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TorchrunTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TorchrunTemplate{}, &TorchrunTemplateList{})
+}
@@ -0,0 +1,185 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// TrainerIndexAnnotation records the position of the trainer container in a v1beta1 pod template,
+// since v1alpha1 requires the trainer to be the first container
+const TrainerIndexAnnotation = "torchrun.ai/trainer-index"
+
+// ConvertTo converts this TorchrunJob to the hub version (v1alpha1)
+func (src *TorchrunJob) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.TorchrunJob)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	if err := convertJSON(&src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	if err := convertJSON(&src.Status, &dst.Status); err != nil {
+		return err
+	}
+
+	// Renamed fields
+	dst.Spec.Reliability.MaxRestarts = src.Spec.Reliability.BackoffLimit
+	if src.Spec.Volumes != nil {
+		dst.Spec.Volumes = &v1alpha1.VolumeOverride{}
+		if err := convertJSON(src.Spec.Volumes.Mounts, &dst.Spec.Volumes.AdditionalMounts); err != nil {
+			return err
+		}
+		dst.Spec.Volumes.AdditionalVolumes = src.Spec.Volumes.Volumes
+	}
+	dst.Status.WorkersStatus = src.Status.WorkersSummary
+
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v1alpha1) to this version
+func (dst *TorchrunJob) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.TorchrunJob)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	if err := convertJSON(&src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	if err := convertJSON(&src.Status, &dst.Status); err != nil {
+		return err
+	}
+
+	// Renamed fields
+	dst.Spec.Reliability.BackoffLimit = src.Spec.Reliability.MaxRestarts
+	if src.Spec.Volumes != nil {
+		dst.Spec.Volumes = &VolumeOverride{}
+		if err := convertJSON(src.Spec.Volumes.AdditionalMounts, &dst.Spec.Volumes.Mounts); err != nil {
+			return err
+		}
+		dst.Spec.Volumes.Volumes = src.Spec.Volumes.AdditionalVolumes
+	}
+	dst.Status.WorkersSummary = src.Status.WorkersStatus
+
+	return nil
+}
+
+// ConvertTo converts this TorchrunQueue to the hub version (v1alpha1)
+func (src *TorchrunQueue) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.TorchrunQueue)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	if err := convertJSON(&src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	if err := convertJSON(&src.Spec.SchedulerQueue, &dst.Spec.Queue); err != nil {
+		return err
+	}
+	if err := convertJSON(&src.Status, &dst.Status); err != nil {
+		return err
+	}
+
+	// Move the trainer to the front and remember where it was
+	index, err := moveContainer(&dst.Spec.PodTemplateConfig.Spec, "trainer", 0)
+	if err != nil {
+		return fmt.Errorf("invalid podTemplate: %w", err)
+	}
+	if index > 0 {
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[TrainerIndexAnnotation] = strconv.Itoa(index)
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v1alpha1) to this version
+func (dst *TorchrunQueue) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.TorchrunQueue)
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	if err := convertJSON(&src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	if err := convertJSON(&src.Spec.Queue, &dst.Spec.SchedulerQueue); err != nil {
+		return err
+	}
+	if err := convertJSON(&src.Status, &dst.Status); err != nil {
+		return err
+	}
+
+	// Restore the original position of the trainer
+	if value, ok := dst.Annotations[TrainerIndexAnnotation]; ok {
+		delete(dst.Annotations, TrainerIndexAnnotation)
+		index, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation %q: %w", TrainerIndexAnnotation, value, err)
+		}
+		if _, err := moveContainer(&dst.Spec.PodTemplateConfig.Spec, "trainer", index); err != nil {
+			return fmt.Errorf("failed to restore trainer position: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// convertJSON copies src into dst through their JSON representation.
+// Both versions share the JSON layout apart from explicitly renamed fields.
+func convertJSON(src, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("failed to convert %T: %w", src, err)
+	}
+	return nil
+}
+
+// moveContainer moves the named container of a raw pod spec to the given index and
+// returns its previous index. An empty pod spec is left as is.
+// The pod spec is edited as unstructured JSON so unknown fields are preserved.
+func moveContainer(raw *runtime.RawExtension, name string, index int) (int, error) {
+	if len(raw.Raw) == 0 {
+		return 0, nil
+	}
+
+	var podSpec map[string]interface{}
+	if err := json.Unmarshal(raw.Raw, &podSpec); err != nil {
+		return -1, fmt.Errorf("failed to parse pod template: %w", err)
+	}
+	containers, _ := podSpec["containers"].([]interface{})
+
+	current := -1
+	for i, c := range containers {
+		if container, ok := c.(map[string]interface{}); ok && container["name"] == name {
+			current = i
+			break
+		}
+	}
+	if current < 0 {
+		return -1, fmt.Errorf("pod template must have a container named %q", name)
+	}
+	if index < 0 || index >= len(containers) {
+		return -1, fmt.Errorf("container index %d out of range for %d containers", index, len(containers))
+	}
+	if current == index {
+		return current, nil
+	}
+
+	container := containers[current]
+	containers = append(containers[:current], containers[current+1:]...)
+	containers = append(containers[:index], append([]interface{}{container}, containers[index:]...)...)
+	podSpec["containers"] = containers
+
+	data, err := json.Marshal(podSpec)
+	if err != nil {
+		return -1, err
+	}
+	raw.Raw = data
+	return current, nil
+}
@@ -0,0 +1,168 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func containerNames(t *testing.T, raw runtime.RawExtension) []string {
+	t.Helper()
+	var podSpec struct {
+		Containers []struct {
+			Name string `json:"name"`
+		} `json:"containers"`
+	}
+	if err := json.Unmarshal(raw.Raw, &podSpec); err != nil {
+		t.Fatalf("failed to parse pod spec: %v", err)
+	}
+	var names []string
+	for _, c := range podSpec.Containers {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestTorchrunQueueConversion(t *testing.T) {
+	src := &TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+		Spec: TorchrunQueueSpec{
+			SchedulerQueue: SchedulerQueueConfig{
+				Name:        "research",
+				ParentQueue: "default",
+				Children:    []ChildQueueConfig{{Name: "research-vision", Resources: QueueResources{GPU: ResourceConfig{Quota: 8}}}},
+			},
+			PodTemplateConfig: PodTemplateConfig{
+				Spec: runtime.RawExtension{Raw: []byte(`{"containers":[{"name":"metrics"},{"name":"trainer","image":"pytorch"}],"hostIPC":true}`)},
+			},
+			Limits: QueueLimits{MaxNodesPerJob: 4},
+		},
+	}
+
+	hub := &v1alpha1.TorchrunQueue{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatalf("ConvertTo failed: %v", err)
+	}
+	if hub.Spec.Queue.Name != "research" || hub.Spec.Queue.ParentQueue != "default" || len(hub.Spec.Queue.Children) != 1 {
+		t.Errorf("expected scheduler queue to be converted, got %+v", hub.Spec.Queue)
+	}
+	if hub.Spec.Limits.MaxNodesPerJob != 4 {
+		t.Errorf("expected limits to be converted, got %+v", hub.Spec.Limits)
+	}
+	if names := containerNames(t, hub.Spec.PodTemplateConfig.Spec); names[0] != "trainer" {
+		t.Errorf("expected trainer to be the first container in v1alpha1, got %v", names)
+	}
+	if hub.Annotations[TrainerIndexAnnotation] != "1" {
+		t.Errorf("expected trainer index annotation, got %v", hub.Annotations)
+	}
+	if src.Annotations != nil {
+		t.Errorf("expected source annotations to be left untouched, got %v", src.Annotations)
+	}
+
+	dst := &TorchrunQueue{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom failed: %v", err)
+	}
+	if !reflect.DeepEqual(dst.Spec.SchedulerQueue, src.Spec.SchedulerQueue) {
+		t.Errorf("expected scheduler queue %+v, got %+v", src.Spec.SchedulerQueue, dst.Spec.SchedulerQueue)
+	}
+	if names := containerNames(t, dst.Spec.PodTemplateConfig.Spec); names[0] != "metrics" || names[1] != "trainer" {
+		t.Errorf("expected original container order to be restored, got %v", names)
+	}
+	if _, ok := dst.Annotations[TrainerIndexAnnotation]; ok {
+		t.Errorf("expected trainer index annotation to be removed, got %v", dst.Annotations)
+	}
+
+	var podSpec map[string]interface{}
+	if err := json.Unmarshal(dst.Spec.PodTemplateConfig.Spec.Raw, &podSpec); err != nil {
+		t.Fatalf("failed to parse pod spec: %v", err)
+	}
+	if podSpec["hostIPC"] != true {
+		t.Errorf("expected unknown pod spec fields to be preserved, got %v", podSpec)
+	}
+}
+
+func TestTorchrunJobConversion(t *testing.T) {
+	src := &v1alpha1.TorchrunJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+		Spec: v1alpha1.TorchrunJobSpec{
+			Queue:       "dev",
+			Command:     "python train.py",
+			NumNodes:    2,
+			Reliability: v1alpha1.ReliabilityConfig{MaxRestarts: 5},
+			Volumes: &v1alpha1.VolumeOverride{
+				AdditionalMounts:  []v1alpha1.AdditionalMount{{Name: "data", MountPath: "/data"}},
+				AdditionalVolumes: []corev1.Volume{{Name: "data"}},
+			},
+		},
+		Status: v1alpha1.TorchrunJobStatus{Phase: v1alpha1.PhaseRunning, WorkersStatus: "2/2 ready"},
+	}
+
+	job := &TorchrunJob{}
+	if err := job.ConvertFrom(src); err != nil {
+		t.Fatalf("ConvertFrom failed: %v", err)
+	}
+	if job.Spec.Reliability.BackoffLimit != 5 {
+		t.Errorf("expected backoffLimit 5, got %d", job.Spec.Reliability.BackoffLimit)
+	}
+	if job.Spec.Volumes == nil || len(job.Spec.Volumes.Mounts) != 1 || len(job.Spec.Volumes.Volumes) != 1 {
+		t.Errorf("expected volumes to be converted, got %+v", job.Spec.Volumes)
+	}
+	if job.Status.WorkersSummary != "2/2 ready" {
+		t.Errorf("expected workersSummary to be converted, got %q", job.Status.WorkersSummary)
+	}
+	hub := &v1alpha1.TorchrunJob{}
+	if err := job.ConvertTo(hub); err != nil {
+		t.Fatalf("ConvertTo failed: %v", err)
+	}
+
+	if hub.Spec.Queue != "dev" || hub.Spec.Command != "python train.py" || hub.Spec.NumNodes != 2 {
+		t.Errorf("expected spec to round-trip, got %+v", hub.Spec)
+	}
+	if hub.Spec.Reliability.MaxRestarts != 5 {
+		t.Errorf("expected maxRestarts to round-trip, got %d", hub.Spec.Reliability.MaxRestarts)
+	}
+	if hub.Spec.Volumes == nil || hub.Spec.Volumes.AdditionalMounts[0].MountPath != "/data" || hub.Spec.Volumes.AdditionalVolumes[0].Name != "data" {
+		t.Errorf("expected volumes to round-trip, got %+v", hub.Spec.Volumes)
+	}
+	if hub.Status.Phase != v1alpha1.PhaseRunning || hub.Status.WorkersStatus != "2/2 ready" {
+		t.Errorf("expected status to round-trip, got %+v", hub.Status)
+	}
+}
+
+func TestTorchrunQueueConversionRequiresTrainer(t *testing.T) {
+	src := &TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+		Spec: TorchrunQueueSpec{
+			PodTemplateConfig: PodTemplateConfig{
+				Spec: runtime.RawExtension{Raw: []byte(`{"containers":[{"name":"worker"}]}`)},
+			},
+		},
+	}
+
+	if err := src.ConvertTo(&v1alpha1.TorchrunQueue{}); err == nil {
+		t.Errorf("expected conversion without a trainer container to fail")
+	}
+
+	hub := &v1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "dev",
+			Namespace:   "default",
+			Annotations: map[string]string{TrainerIndexAnnotation: "3"},
+		},
+		Spec: v1alpha1.JobQueueSpec{
+			PodTemplateConfig: v1alpha1.PodTemplateConfig{
+				Spec: runtime.RawExtension{Raw: []byte(`{"containers":[{"name":"trainer"},{"name":"metrics"}]}`)},
+			},
+		},
+	}
+	if err := (&TorchrunQueue{}).ConvertFrom(hub); err == nil {
+		t.Errorf("expected conversion with an out of range trainer index to fail")
+	}
+}
@@ -0,0 +1,1308 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// TorchrunJob phase constants
+const (
+	PhasePending   = "Pending"
+	PhaseSyncing   = "Syncing"
+	PhaseQueued    = "Queued"
+	PhaseRunning   = "Running"
+	PhaseSucceeded = "Succeeded"
+	PhaseSuspended = "Suspended"
+	PhaseDeleted   = "Deleted"
+	PhaseFailed    = "Failed"
+	PhaseTimedOut  = "TimedOut"
+	PhasePreempted = "Preempted"
+	PhaseUnknown   = "Unknown"
+)
+
+// TorchrunJob priority constants
+const (
+	// PriorityPreemptible jobs may be preempted by normal and high priority jobs
+	PriorityPreemptible = "preemptible"
+	PriorityNormal      = "normal"
+	PriorityHigh        = "high"
+)
+
+// TorchrunJob update policy constants
+const (
+	// UpdatePolicyIfNotRunning recreates the Job for spec changes only while none of its pods run
+	UpdatePolicyIfNotRunning = "IfNotRunning"
+	UpdatePolicyRecreate     = "Recreate"
+	UpdatePolicyNever        = "Never"
+)
+
+// TorchrunJob mode constants
+const (
+	ModeTrain = "train"
+	// ModeDebug runs an idle worker to exec into instead of training
+	ModeDebug = "debug"
+	// ModeNotebook runs a Jupyter server in the trainer container instead of training
+	ModeNotebook = "notebook"
+)
+
+// TorchrunJob restart mode constants
+const (
+	// RestartModePerPod restarts a failed worker in place and torchrun restarts the others
+	RestartModePerPod = "PerPod"
+	// RestartModeWholeJob replaces the Job when a worker fails, restarting all workers together
+	RestartModeWholeJob = "WholeJob"
+)
+
+// Worker rendezvous state constants
+const (
+	// RendezvousWaiting workers did not complete the torchrun rendezvous yet
+	RendezvousWaiting = "Waiting"
+	RendezvousJoined  = "Joined"
+	// RendezvousFailed workers logged a rendezvous error, e.g. a timeout waiting for the others
+	RendezvousFailed = "Failed"
+)
+
+// TorchrunJob notification event constants
+const (
+	NotificationStarted   = "Started"
+	NotificationSucceeded = "Succeeded"
+	NotificationFailed    = "Failed"
+	NotificationPreempted = "Preempted"
+)
+
+// TorchrunJob experiment tracking provider constants
+const (
+	TrackingProviderWandb  = "wandb"
+	TrackingProviderMLflow = "mlflow"
+)
+
+// TorchrunJob capacity type constants
+const (
+	CapacityTypeSpot     = "spot"
+	CapacityTypeOnDemand = "on-demand"
+	// CapacityTypeAny runs on spot or on-demand nodes, whichever the scheduler finds first
+	CapacityTypeAny = "any"
+)
+
+// TorchrunJobSpec defines the desired state of TorchrunJob
+// +kubebuilder:validation:XValidation:rule="has(self.templateRef) || has(self.cloneFrom) || (has(self.mode) && self.mode == 'notebook') || (has(self.command) && size(self.command) > 0)",message="command is required unless templateRef or cloneFrom provides it or the job is a notebook"
+// +kubebuilder:validation:XValidation:rule="!has(self.gpuFraction) || !has(self.gpuMemory)",message="gpuFraction and gpuMemory are mutually exclusive"
+// +kubebuilder:validation:XValidation:rule="!has(self.snapshotRef) || !has(self.cloneFrom) || !self.cloneFrom.reuseWorkspace",message="snapshotRef and cloneFrom.reuseWorkspace both provide the workspace"
+// +kubebuilder:validation:XValidation:rule="!has(self.mode) || self.mode != 'debug' || !has(self.numNodes) || self.numNodes == 1",message="debug jobs run a single node"
+// +kubebuilder:validation:XValidation:rule="!has(self.mode) || self.mode != 'notebook' || !has(self.numNodes) || self.numNodes == 1",message="notebook jobs run a single node"
+type TorchrunJobSpec struct {
+	// Name of the TorchrunQueue to use for this job. When omitted, the webhook sets the
+	// TorchrunQueue of the queue namespace annotated torchrun.ai/default-queue=true.
+	// +optional
+	Queue string `json:"queue,omitempty"`
+
+	// Namespace of the TorchrunQueue. Defaults to the namespace of the job. A queue in another
+	// namespace must grant the job's namespace access with a TorchrunQueueBinding.
+	// +optional
+	QueueNamespace string `json:"queueNamespace,omitempty"`
+
+	// Application-level job name for this TorchrunJob.
+	// Used in the rendezvous id (rdz-id) for torchrun and for features like job resumption.
+	// If not provided, a random friendly name will be generated.
+	JobName string `json:"jobName"`
+
+	// Universally unique identifier (UUID) for this TorchrunJob.
+	// Used to uniquely identify the job instance and as the torchrun.ai/job-id label value,
+	// so it must be a valid label value.
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`
+	JobID string `json:"jobID"`
+
+	// Training command to execute. Required unless the template provides it.
+	Command string `json:"command,omitempty"`
+
+	// Optional command to run before training (e.g., download data, install packages)
+	SetupCommand string `json:"setupCommand,omitempty"`
+
+	// Number of nodes for training. If set, overrides minNodes and maxNodes to be equal.
+	// +kubebuilder:validation:Minimum=1
+	NumNodes int `json:"numNodes,omitempty"`
+
+	// Scheduling priority of the job within its queue. Maps to a kai-scheduler priority class:
+	// preemptible (train), normal (build) or high (inference). Defaults to the queue's default priority.
+	// +kubebuilder:validation:Enum=preemptible;normal;high
+	Priority string `json:"priority,omitempty"`
+
+	// Expected run time of the job, e.g. 2h. Queues with dispatch backfill start jobs with an
+	// estimate ahead of a larger job waiting for GPUs if they finish before it could start. The
+	// job is not stopped when it runs longer.
+	// +optional
+	EstimatedDuration *metav1.Duration `json:"estimatedDuration,omitempty"`
+
+	// Scheduler of the worker pods. Defaults to the scheduler of the queue.
+	// +optional
+	SchedulerName string `json:"schedulerName,omitempty"`
+
+	// Image of the trainer container, replacing the image of the queue pod template
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Secrets for pulling the images of the job, added to the imagePullSecrets of the queue pod
+	// template
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// TorchrunTemplate in the job's namespace whose settings are merged into this job when it
+	// is admitted. Fields set on the job take precedence.
+	// +optional
+	TemplateRef *corev1.LocalObjectReference `json:"templateRef,omitempty"`
+
+	// TorchrunJob in the job's namespace whose command, setup command, image, node count, env
+	// and workspace storage are copied into this job when it is admitted. Fields set on the job
+	// take precedence, env is merged by variable name.
+	// +optional
+	CloneFrom *CloneSource `json:"cloneFrom,omitempty"`
+
+	// Overrides for storage configuration
+	WorkspaceStorage WorkspaceStorageConfig `json:"workspaceStorage,omitempty"`
+
+	// VolumeSnapshot in the job's namespace that the workspace PVC is restored from instead of
+	// syncing the workspace, e.g. the workspace snapshot of an earlier job
+	// +optional
+	SnapshotRef *corev1.LocalObjectReference `json:"snapshotRef,omitempty"`
+
+	// Reliability and lifecycle settings
+	Reliability ReliabilityConfig `json:"reliability,omitempty"`
+
+	// Additional environment variables (merged with TorchrunQueue env)
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Volume overrides and additions
+	Volumes *VolumeOverride `json:"volumes,omitempty"`
+
+	// Secrets of the job's namespace mounted read-only into the trainer, a shorthand for a
+	// secret volume and its mount
+	// +optional
+	SecretMounts []SecretMount `json:"secretMounts,omitempty"`
+
+	// ConfigMaps of the job's namespace mounted read-only into the trainer, a shorthand for a
+	// configMap volume and its mount
+	// +optional
+	ConfigMapMounts []ConfigMapMount `json:"configMapMounts,omitempty"`
+
+	// Checkpoint directory of the job on a volume of the queue pod template or the job volumes.
+	// Jobs that reuse the jobName of an earlier run mount its checkpoints.
+	// +optional
+	Checkpoints *CheckpointConfig `json:"checkpoints,omitempty"`
+
+	// Record the artifacts the trainer lists in a manifest in status.artifacts once the job
+	// finished: the .artifacts.json of the checkpoint directory for jobs with checkpoints, else the
+	// .artifacts.json of the workspace of rank 0 once it exited successfully
+	// +optional
+	CollectArtifacts bool `json:"collectArtifacts,omitempty"`
+
+	// Patch of the queue pod template for this job, e.g. another image tag, resource requests
+	// or node selector. Settings the controller owns, such as the trainer command, still apply.
+	// +optional
+	PodTemplatePatch *PodTemplatePatch `json:"podTemplatePatch,omitempty"`
+
+	// Create job in suspended state
+	// +kubebuilder:default=false
+	Suspend bool `json:"suspend,omitempty"`
+
+	// How changes to the spec are applied to an existing Kubernetes Job. Deadline, TTL and
+	// suspend are patched in place; other changes recreate the Job. IfNotRunning keeps a Job
+	// with running pods, Recreate always recreates it and Never only reports the change.
+	// +kubebuilder:validation:Enum=IfNotRunning;Recreate;Never
+	// +kubebuilder:default="IfNotRunning"
+	UpdatePolicy string `json:"updatePolicy,omitempty"`
+
+	// Mode of the job. debug runs a single worker pod that idles instead of training, with the
+	// workspace, volumes, env and GPUs of a worker, to kubectl exec into before a real run.
+	// notebook runs a single worker pod serving Jupyter instead of training, until it is idle for
+	// notebook.idleTimeoutSeconds.
+	// +kubebuilder:validation:Enum=train;debug;notebook
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// Profile of the queue the workers use, setting the resources, node placement and processes
+	// per worker of the trainer
+	// +optional
+	Profile string `json:"profile,omitempty"`
+
+	// Child kai-scheduler queue of the TorchrunQueue hierarchy the job is scheduled in.
+	// Required when the queue has children.
+	// +optional
+	ChildQueue string `json:"childQueue,omitempty"`
+
+	// Capacity the workers run on, using the node placement of the queue. Spot jobs fall back
+	// to on-demand capacity when the queue configures a fallback.
+	// +kubebuilder:validation:Enum=spot;on-demand;any
+	// +optional
+	CapacityType string `json:"capacityType,omitempty"`
+
+	// Nodes the workers are not placed on, e.g. nodes that showed GPU or ECC errors in an
+	// earlier run of the job
+	// +optional
+	ExcludedNodes []string `json:"excludedNodes,omitempty"`
+
+	// Node labels whose nodes the workers are not placed on. A node is excluded if it has any of
+	// the labels; an empty value excludes the nodes with the label key.
+	// +optional
+	ExcludedNodeLabels map[string]string `json:"excludedNodeLabels,omitempty"`
+
+	// Datasets whose cache nodes the workers are placed on, for the input throughput of data
+	// cached on local disks, e.g. by JuiceFS or Alluxio workers
+	// +optional
+	DataLocality *DataLocalityConfig `json:"dataLocality,omitempty"`
+
+	// Fraction of one GPU each worker gets on a GPU shared through kai-scheduler, e.g. "0.5".
+	// The GPU request of the trainer container is replaced and torchrun runs one process per
+	// worker. Mutually exclusive with gpuMemory.
+	// +kubebuilder:validation:Pattern=`^0?\.[0-9]+$`
+	// +optional
+	GPUFraction string `json:"gpuFraction,omitempty"`
+
+	// GPU memory in MiB each worker gets on a GPU shared through kai-scheduler. Mutually
+	// exclusive with gpuFraction.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	GPUMemory int32 `json:"gpuMemory,omitempty"`
+
+	// Delay the start of the job until a time or into recurring windows
+	// +optional
+	Schedule *ScheduleConfig `json:"schedule,omitempty"`
+
+	// Link the job to a Weights & Biases or MLflow run
+	// +optional
+	ExperimentTracking *ExperimentTrackingConfig `json:"experimentTracking,omitempty"`
+
+	// Deploy TensorBoard reading the logs of the job
+	// +optional
+	Tensorboard *TensorboardConfig `json:"tensorboard,omitempty"`
+
+	// Jupyter server of a notebook job
+	// +optional
+	Notebook *NotebookConfig `json:"notebook,omitempty"`
+
+	// Run an all-reduce test on the same number of nodes before the training Job is created
+	// +optional
+	Preflight *PreflightConfig `json:"preflight,omitempty"`
+
+	// Annotations to add to worker pods
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Labels to add to worker pods
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// CloneSource names the TorchrunJob a job is cloned from
+type CloneSource struct {
+	// Name of the TorchrunJob to clone
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Create the workspace PVC as a CSI volume clone of the synced workspace PVC of the source
+	// job instead of syncing the workspace again. The storage class must support volume cloning
+	// and the workspace must be at least as large as the one of the source.
+	// +optional
+	ReuseWorkspace bool `json:"reuseWorkspace,omitempty"`
+}
+
+// ExperimentTrackingConfig defines the experiment tracking run of a job. The trainer gets the
+// environment variables of the provider client, so the training code logs to the run without
+// configuration.
+// +kubebuilder:validation:XValidation:rule="self.provider != 'mlflow' || has(self.url)",message="url is required for the mlflow provider"
+type ExperimentTrackingConfig struct {
+	// Tracking service
+	// +kubebuilder:validation:Enum=wandb;mlflow
+	Provider string `json:"provider"`
+
+	// W&B project or MLflow experiment the run is logged to
+	// +kubebuilder:validation:MinLength=1
+	Project string `json:"project"`
+
+	// W&B entity, the user or team owning the project
+	// +optional
+	Entity string `json:"entity,omitempty"`
+
+	// URL of the tracking server: the MLflow tracking URI, or a self-hosted W&B server.
+	// Required for mlflow, defaults to https://api.wandb.ai for wandb.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// SecretRef names a Secret whose keys are added to the trainer environment, e.g.
+	// WANDB_API_KEY, MLFLOW_TRACKING_TOKEN or MLFLOW_TRACKING_USERNAME and
+	// MLFLOW_TRACKING_PASSWORD
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+}
+
+// TensorboardConfig defines the TensorBoard deployment of a job. TensorBoard mounts the
+// volume of logDir read-only, so logDir must be on a volume shared between pods, e.g. a
+// checkpoint PVC of the queue pod template, not on the workspace.
+type TensorboardConfig struct {
+	// Deploy TensorBoard
+	// +kubebuilder:default=true
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Directory of the event files, as mounted in the trainer container
+	// +kubebuilder:validation:MinLength=1
+	LogDir string `json:"logDir"`
+
+	// Ingress class of an Ingress exposing TensorBoard. Without it TensorBoard is only
+	// reachable through its Service.
+	// +optional
+	IngressClass string `json:"ingressClass,omitempty"`
+
+	// Host of the Ingress. Without it the Ingress matches any host.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// TensorBoard image
+	// +kubebuilder:default="tensorflow/tensorflow:latest"
+	Image string `json:"image,omitempty"`
+}
+
+// NotebookConfig defines the Jupyter server of a notebook job. The trainer image must provide
+// jupyter lab.
+type NotebookConfig struct {
+	// Ingress class of an Ingress exposing the notebook. Without it the notebook is only
+	// reachable through its Service.
+	// +optional
+	IngressClass string `json:"ingressClass,omitempty"`
+
+	// Host of the Ingress. Without it the Ingress matches any host.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Seconds without kernel, terminal or browser activity after which the Jupyter server shuts
+	// down and the job completes
+	// +kubebuilder:validation:Minimum=60
+	// +kubebuilder:default=3600
+	IdleTimeoutSeconds int64 `json:"idleTimeoutSeconds,omitempty"`
+}
+
+// PreflightConfig defines the interconnect test of a job. The preflight Job runs the trainer
+// pod template of the queue on numNodes workers, so it is placed like the training Job, and the
+// training Job is only created once it succeeded.
+type PreflightConfig struct {
+	// Run the preflight test
+	// +kubebuilder:default=true
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Image of the preflight workers. Defaults to the trainer image, which needs PyTorch with CUDA
+	// for the default all-reduce benchmark.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Shell command each worker process runs instead of the all-reduce benchmark, e.g. an
+	// nccl-tests binary. A non-zero exit fails the preflight.
+	// +optional
+	Script string `json:"script,omitempty"`
+
+	// Minimum all-reduce bus bandwidth in GB/s the benchmark must reach. Zero only checks that
+	// the all-reduce completes.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinBusBandwidthGBps int32 `json:"minBusBandwidthGBps,omitempty"`
+
+	// Seconds the preflight may take before it fails
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=600
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// ScheduleConfig defines when a job may start. The workspace is synced right away, the
+// Kubernetes Job is only created once both conditions are met.
+type ScheduleConfig struct {
+	// Earliest time the job starts
+	// +optional
+	StartAfter *metav1.Time `json:"startAfter,omitempty"`
+
+	// Windows the job starts in, e.g. off-peak hours. A job keeps running when its window closes.
+	// +optional
+	Windows []TimeWindow `json:"windows,omitempty"`
+}
+
+// TimeWindow is a window of time that recurs on the given days of the week
+type TimeWindow struct {
+	// Days of the week the window opens on. Empty means every day.
+	// +kubebuilder:validation:items:Enum=Mon;Tue;Wed;Thu;Fri;Sat;Sun
+	// +optional
+	Days []string `json:"days,omitempty"`
+
+	// Time of day the window opens, as HH:MM
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+
+	// Time of day the window closes, as HH:MM. Windows ending before they start close on the
+	// next day; windows ending when they start last a whole day.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	End string `json:"end"`
+
+	// IANA time zone of start and end, e.g. Europe/Berlin
+	// +kubebuilder:default="UTC"
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// ReliabilityConfig defines reliability and lifecycle settings
+// +kubebuilder:validation:XValidation:rule="!has(self.restartMode) || self.restartMode != 'PerPod' || !has(self.restartPolicy) || self.restartPolicy != 'Never'",message="restartMode PerPod restarts workers in place and cannot be combined with restartPolicy Never"
+type ReliabilityConfig struct {
+	// Number of retries before the job is marked failed (maxRestarts in v1alpha1)
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=3
+	BackoffLimit int32 `json:"backoffLimit,omitempty"`
+
+	// Restart policy for workers
+	// +kubebuilder:validation:Enum=OnFailure;Never
+	// +kubebuilder:default="OnFailure"
+	RestartPolicy string `json:"restartPolicy,omitempty"`
+
+	// How workers restart after a failure. PerPod restarts the failed worker pod in place and
+	// torchrun restarts the workers of the other nodes, up to backoffLimit times. WholeJob fails the
+	// Kubernetes Job on the first failed worker and recreates it, up to backoffLimit times unless
+	// retryJobOnFailure is set. Without a mode, restartPolicy and backoffLimit apply as they are.
+	// +kubebuilder:validation:Enum=PerPod;WholeJob
+	// +optional
+	RestartMode string `json:"restartMode,omitempty"`
+
+	// Clean up job after this many seconds
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=3600
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+
+	// Maximum time the job can run
+	// +kubebuilder:validation:Minimum=0
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// Percentage of activeDeadlineSeconds after which the DeadlineApproaching condition warns
+	// that the job is about to time out
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=99
+	// +kubebuilder:default=90
+	DeadlineWarningPercent int32 `json:"deadlineWarningPercent,omitempty"`
+
+	// Watchdog that restarts training when it stalls
+	Watchdog WatchdogConfig `json:"watchdog,omitempty"`
+
+	// Probes of the trainer container that restart it when training hangs before it starts or
+	// stops being healthy
+	// +optional
+	Probes *TrainerProbesConfig `json:"probes,omitempty"`
+
+	// Do not protect the worker pods of the running job with a PodDisruptionBudget. Without it,
+	// node drains and cluster autoscaler scale-downs may evict workers of the job.
+	// +optional
+	DisablePodDisruptionBudget bool `json:"disablePodDisruptionBudget,omitempty"`
+
+	// Recreate the Kubernetes Job after it exhausted its backoff limit
+	// +optional
+	RetryJobOnFailure *RetryJobOnFailureConfig `json:"retryJobOnFailure,omitempty"`
+}
+
+// RetryJobOnFailureConfig defines how often a failed Kubernetes Job is replaced by a new attempt.
+// Attempts are named <job>-attempt-<n> and start after an exponential backoff.
+// +kubebuilder:validation:XValidation:rule="!has(self.maxBackoffSeconds) || self.maxBackoffSeconds == 0 || !has(self.backoffSeconds) || self.maxBackoffSeconds >= self.backoffSeconds",message="maxBackoffSeconds must not be less than backoffSeconds"
+type RetryJobOnFailureConfig struct {
+	// Number of new Jobs created after the first one failed
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1
+	MaxJobRetries int32 `json:"maxJobRetries,omitempty"`
+
+	// Seconds to wait before the first retry, doubled for every further retry
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=60
+	BackoffSeconds int32 `json:"backoffSeconds,omitempty"`
+
+	// Upper bound of the wait between retries
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=3600
+	MaxBackoffSeconds int32 `json:"maxBackoffSeconds,omitempty"`
+}
+
+// WatchdogConfig defines the stall detection of the watchdog sidecar.
+// The watchdog stops the torchrun agent when training makes no progress for stallTimeoutSeconds,
+// so the trainer is restarted according to the restart policy.
+type WatchdogConfig struct {
+	// Inject the watchdog sidecar
+	// +kubebuilder:default=false
+	Enabled bool `json:"enabled,omitempty"`
+
+	// How progress is detected: heartbeat checks the modification time of the file in
+	// TORCHRUN_HEARTBEAT_FILE, which training must touch regularly; tcpStore probes the
+	// rendezvous endpoint of multi-node jobs
+	// +kubebuilder:validation:Enum=heartbeat;tcpStore
+	// +kubebuilder:default="heartbeat"
+	Mode string `json:"mode,omitempty"`
+
+	// Seconds without progress before training is restarted
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=600
+	StallTimeoutSeconds int32 `json:"stallTimeoutSeconds,omitempty"`
+
+	// Additional seconds allowed before the first progress after (re)starting, e.g. for data loading
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=300
+	StartupGraceSeconds int32 `json:"startupGraceSeconds,omitempty"`
+
+	// Seconds between progress checks
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=30
+	CheckIntervalSeconds int32 `json:"checkIntervalSeconds,omitempty"`
+
+	// Image of the watchdog sidecar, which needs a shell with nc. Defaults to the watchdog image
+	// of the operator config.
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// TrainerProbesConfig defines the probes of the trainer container. A failing probe kills the
+// trainer, which is restarted as the restart mode of the job defines.
+type TrainerProbesConfig struct {
+	// Probe that must pass before the startup of the trainer finished. Its periodSeconds times
+	// failureThreshold bounds the time training may take to start.
+	// +optional
+	Startup *TrainerProbe `json:"startup,omitempty"`
+
+	// Probe that must keep passing while the trainer runs, after the startup probe passed
+	// +optional
+	Liveness *TrainerProbe `json:"liveness,omitempty"`
+}
+
+// TrainerProbe checks the trainer container
+// +kubebuilder:validation:XValidation:rule="!has(self.mode) || self.mode != 'command' || has(self.command)",message="command is required for mode command"
+type TrainerProbe struct {
+	// What is checked: processes passes while torchrun runs a worker process for every local
+	// rank; command passes when command exits with 0
+	// +kubebuilder:validation:Enum=processes;command
+	// +kubebuilder:default="processes"
+	Mode string `json:"mode,omitempty"`
+
+	// Command of mode command, run by bash in the trainer container
+	// +optional
+	Command string `json:"command,omitempty"`
+
+	// Seconds after the trainer started before the first check
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+
+	// Seconds between checks
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=10
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+
+	// Seconds after which a check fails
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=5
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+
+	// Consecutive failed checks before the trainer is restarted
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=3
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// VolumeOverride defines volume overrides and additions
+type VolumeOverride struct {
+	// Additional volume mounts for the trainer (additionalMounts in v1alpha1)
+	Mounts []AdditionalMount `json:"mounts,omitempty"`
+
+	// Additional volumes merged with the pod template volumes (additionalVolumes in v1alpha1)
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+}
+
+// SecretMount mounts a Secret into the trainer
+type SecretMount struct {
+	// Name of the Secret
+	// +kubebuilder:validation:MinLength=1
+	SecretName string `json:"secretName"`
+
+	// Mount path in the trainer
+	// +kubebuilder:validation:MinLength=1
+	MountPath string `json:"mountPath"`
+
+	// Keys projected into files at their paths. All keys are projected when empty.
+	// +optional
+	Items []corev1.KeyToPath `json:"items,omitempty"`
+}
+
+// ConfigMapMount mounts a ConfigMap into the trainer
+type ConfigMapMount struct {
+	// Name of the ConfigMap
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Mount path in the trainer
+	// +kubebuilder:validation:MinLength=1
+	MountPath string `json:"mountPath"`
+
+	// Keys projected into files at their paths. All keys are projected when empty.
+	// +optional
+	Items []corev1.KeyToPath `json:"items,omitempty"`
+}
+
+// DataLocalityConfig places the workers of a job on the nodes holding its datasets
+type DataLocalityConfig struct {
+	// Datasets of the job. Nodes holding all of them are preferred, or required.
+	// +kubebuilder:validation:MinItems=1
+	Datasets []DatasetLocality `json:"datasets"`
+
+	// Keep the workers off nodes that do not hold the datasets, instead of preferring the nodes
+	// that do
+	// +optional
+	Required bool `json:"required,omitempty"`
+
+	// Weight of the preferred node affinity of each dataset
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:default=50
+	// +optional
+	Weight int32 `json:"weight,omitempty"`
+}
+
+// DatasetLocality names the nodes holding a dataset, by the node affinity of its volume or by the
+// labels the cache puts on its nodes. Exactly one of pvcName and nodeLabels is set.
+type DatasetLocality struct {
+	// PVC of the dataset in the job's namespace. The nodes are those of the node affinity of its
+	// bound PersistentVolume, e.g. of local volumes or cache runtimes pinned to their workers.
+	// +optional
+	PVCName string `json:"pvcName,omitempty"`
+
+	// Labels of the nodes caching the dataset, e.g. the label a Fluid dataset puts on the nodes of its cache
+	// +optional
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+}
+
+// CheckpointConfig defines where a job keeps its checkpoints. The trainer mounts the
+// directory named after the jobName on the volume, so every run of a jobName finds the
+// checkpoints of the runs before it.
+type CheckpointConfig struct {
+	// Name of the volume holding the checkpoints, e.g. a ReadWriteMany PVC
+	// +kubebuilder:validation:MinLength=1
+	Volume string `json:"volume"`
+
+	// Mount path of the checkpoint directory in the trainer
+	// +kubebuilder:default="/checkpoints"
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	// Record the artifacts the trainer lists in the .artifacts.json manifest of the checkpoint
+	// directory in status.artifacts once the job finished, like collectArtifacts of the job
+	// +optional
+	CollectArtifacts bool `json:"collectArtifacts,omitempty"`
+}
+
+// PodTemplatePatch defines how a job changes the pod spec of the queue pod template. The
+// strategic merge patch is applied first, then the JSON patch.
+type PodTemplatePatch struct {
+	// Strategic merge patch of the pod spec. Containers are merged by name, so it only needs
+	// the fields that change, e.g. {"containers": [{"name": "trainer", "image": "..."}]}.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	// +optional
+	StrategicMerge *runtime.RawExtension `json:"strategicMerge,omitempty"`
+
+	// RFC 6902 operations on the pod spec, for changes a merge cannot express such as
+	// removing a list item. Paths index containers with the trainer first.
+	// +optional
+	JSONPatch []JSONPatchOperation `json:"jsonPatch,omitempty"`
+}
+
+// JSONPatchOperation is a single RFC 6902 operation
+type JSONPatchOperation struct {
+	// Operation to perform
+	// +kubebuilder:validation:Enum=add;remove;replace;move;copy;test
+	Op string `json:"op"`
+
+	// JSON pointer to the target location, e.g. /containers/0/resources/requests/cpu
+	Path string `json:"path"`
+
+	// JSON pointer to the source location of move and copy
+	// +optional
+	From string `json:"from,omitempty"`
+
+	// Value of add, replace and test
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Value *runtime.RawExtension `json:"value,omitempty"`
+}
+
+// AdditionalMount defines additional volume mounts
+type AdditionalMount struct {
+	// Volume name from TorchrunQueue or additionalVolumes
+	Name string `json:"name"`
+
+	// Mount path in container
+	MountPath string `json:"mountPath"`
+
+	// Sub-path within the volume
+	SubPath string `json:"subPath,omitempty"`
+
+	// Read only
+	// +kubebuilder:default=false
+	ReadOnly bool `json:"readOnly,omitempty"`
+}
+
+// TorchrunJobStatus defines the observed state of TorchrunJob
+type TorchrunJobStatus struct {
+	// Current phase of the job
+	// +kubebuilder:validation:Enum=Running;Pending;Syncing;Queued;Succeeded;Suspended;Deleted;Failed;TimedOut;Preempted;Unknown
+	Phase string `json:"phase,omitempty"`
+
+	// Number of nodes of the Kubernetes Job, which differs from spec.numNodes until a resize is applied
+	NumNodes int `json:"numNodes,omitempty"`
+
+	// Summary of worker status (e.g., "3/4 ready")
+	WorkersSummary string `json:"workersSummary,omitempty"`
+
+	// Detailed conditions
+	Conditions []TorchrunJobCondition `json:"conditions,omitempty"`
+
+	// Worker pod status
+	Workers WorkerStatus `json:"workers,omitempty"`
+
+	// Number of restart attempts
+	Restarts int32 `json:"restarts,omitempty"`
+
+	// Start time of the job
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// Completion time of the job
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Times the job first entered each phase, and the queue wait and runtime they add up to
+	// +optional
+	Timeline *JobTimeline `json:"timeline,omitempty"`
+
+	// Time the active deadline of the running Job kills it
+	// +optional
+	DeadlineTime *metav1.Time `json:"deadlineTime,omitempty"`
+
+	// Time the job exceeds the maximum runtime of its queue and its workers are signaled to stop
+	// +optional
+	RuntimeLimitTime *metav1.Time `json:"runtimeLimitTime,omitempty"`
+
+	// GPU time of the job in seconds, summed over its worker pods, also those of earlier attempts
+	// and those already removed
+	// +optional
+	GPUSeconds int64 `json:"gpuSeconds,omitempty"`
+
+	// Utilization of the GPUs of the running workers, sampled by the GPU metrics sidecar of the queue
+	// +optional
+	GPUUtilization *GPUUtilizationStatus `json:"gpuUtilization,omitempty"`
+
+	// Latest progress the training script reported to the progress endpoint of the controller
+	// +optional
+	TrainingProgress *TrainingProgressStatus `json:"trainingProgress,omitempty"`
+
+	// Place of a Queued job among the Queued jobs of its queue, ordered by priority and creation
+	// time, starting at 1
+	// +optional
+	QueuePosition int32 `json:"queuePosition,omitempty"`
+
+	// Estimated start of a Queued job: when the GPUs of the running jobs released at their
+	// deadline leave room within the GPU quota of the queue for this job and the jobs ahead of
+	// it. Unset when it cannot be estimated.
+	// +optional
+	EstimatedStartTime *metav1.Time `json:"estimatedStartTime,omitempty"`
+
+	// Last time the job was reconciled
+	LastReconcileTime *metav1.Time `json:"lastReconcileTime,omitempty"`
+
+	// Presigned URL to PUT the workspace archive to, set when the queue runs an upload server
+	WorkspaceUploadURL string `json:"workspaceUploadURL,omitempty"`
+
+	// Current Job attempt, starting at 1. Only advances with retryJobOnFailure.
+	// +optional
+	Attempt int32 `json:"attempt,omitempty"`
+
+	// Failed Job attempts, oldest first
+	// +optional
+	Attempts []JobAttempt `json:"attempts,omitempty"`
+
+	// Nodes workers failed on with GPU or local network errors, one entry per node. The Jobs of
+	// later attempts keep their workers off these nodes.
+	// +optional
+	SuspectNodes []SuspectNode `json:"suspectNodes,omitempty"`
+
+	// Time the next Job attempt is created
+	// +optional
+	NextAttemptTime *metav1.Time `json:"nextAttemptTime,omitempty"`
+
+	// Capacity the workers are placed on and the preemptions it is based on
+	// +optional
+	Capacity *CapacityStatus `json:"capacity,omitempty"`
+
+	// Lifecycle events posted to the notification targets of the queue
+	// +optional
+	Notifications []JobNotification `json:"notifications,omitempty"`
+
+	// ID of the experiment tracking run
+	// +optional
+	TrackingRunID string `json:"trackingRunID,omitempty"`
+
+	// Link to the experiment tracking run
+	// +optional
+	TrackingURL string `json:"trackingURL,omitempty"`
+
+	// URL of the TensorBoard of the job
+	// +optional
+	TensorboardURL string `json:"tensorboardURL,omitempty"`
+
+	// Jupyter server of a notebook job
+	// +optional
+	Notebook *NotebookStatus `json:"notebook,omitempty"`
+
+	// Rendezvous id the workers pass to torchrun, <namespace>-<jobID>-<jobName>, so jobs sharing
+	// a rendezvous endpoint never join each other. Jobs whose Job was created by an earlier
+	// controller version keep the jobName.
+	// +optional
+	RdzvID string `json:"rdzvID,omitempty"`
+
+	// Number of times the jobName was resumed: the workspace of an earlier TorchrunJob with
+	// the same jobName was adopted instead of syncing a new one
+	// +optional
+	ResumeCount int32 `json:"resumeCount,omitempty"`
+
+	// TorchrunJob whose workspace this job adopted
+	// +optional
+	ResumedFrom string `json:"resumedFrom,omitempty"`
+
+	// URL the worker logs were archived to, set once the queue archived them
+	// +optional
+	LogArchiveURL string `json:"logArchiveURL,omitempty"`
+
+	// Name of the VolumeSnapshot taken of the workspace of the finished job
+	// +optional
+	WorkspaceSnapshot string `json:"workspaceSnapshot,omitempty"`
+
+	// Artifacts the trainer listed in its artifacts manifest, recorded once the job finished
+	// +optional
+	Artifacts []ArtifactStatus `json:"artifacts,omitempty"`
+
+	// How the trainer of rank 0 and of the failed ranks exited, recorded once the job finished
+	// +optional
+	ExitInfo *ExitInfo `json:"exitInfo,omitempty"`
+
+	// Name of the TorchrunJobRecord written once the job finished
+	// +optional
+	JobRecord string `json:"jobRecord,omitempty"`
+
+	// Generation of the spec the controller last observed
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Hashes of the top-level spec fields at the observed generation, to tell which fields the
+	// next spec change edits
+	// +optional
+	SpecFieldHashes map[string]string `json:"specFieldHashes,omitempty"`
+
+	// Spec changes made after the job was first observed, oldest first. Only the latest 10 are
+	// kept.
+	// +optional
+	SpecChanges []SpecChange `json:"specChanges,omitempty"`
+}
+
+// SpecChange records an edit of the spec of a job. Edits made between two reconciles are
+// recorded as one change.
+type SpecChange struct {
+	// Generation of the edited spec
+	Generation int64 `json:"generation"`
+
+	// Time of the edit, as recorded in the managed fields of the job
+	Time metav1.Time `json:"time"`
+
+	// Field manager that made the edit, e.g. kubectl-edit or kubectl-client-side-apply
+	// +optional
+	Manager string `json:"manager,omitempty"`
+
+	// Operation of the field manager, Update or Apply
+	// +optional
+	Operation string `json:"operation,omitempty"`
+
+	// Top-level spec fields the edit set, changed or removed
+	Fields []string `json:"fields"`
+
+	// Phase of the job when the edit was observed
+	// +optional
+	Phase string `json:"phase,omitempty"`
+}
+
+// JobNotification records a lifecycle event that was posted to the notification targets
+type JobNotification struct {
+	// Event, one of Started, Succeeded, Failed or Preempted
+	Event string `json:"event"`
+
+	// Job attempt the event belongs to
+	// +optional
+	Attempt int32 `json:"attempt,omitempty"`
+
+	// Worker pod of a Preempted event
+	// +optional
+	Pod string `json:"pod,omitempty"`
+
+	// Notification target the event was posted to. Events recorded without a target were posted
+	// to every target.
+	// +optional
+	Target string `json:"target,omitempty"`
+
+	// Time the event was posted
+	Time metav1.Time `json:"time"`
+}
+
+// CapacityStatus records the capacity decision of a job
+type CapacityStatus struct {
+	// Capacity type the workers are placed on
+	Type string `json:"type"`
+
+	// Reason of the decision, Requested or SpotFallback
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message of the decision
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Time of the decision
+	// +optional
+	DecisionTime *metav1.Time `json:"decisionTime,omitempty"`
+
+	// Worker preemptions within the fallback window, oldest first
+	// +optional
+	Preemptions []CapacityPreemption `json:"preemptions,omitempty"`
+}
+
+// CapacityPreemption records a worker pod that was disrupted by its node going away
+type CapacityPreemption struct {
+	// Name of the worker pod
+	Pod string `json:"pod"`
+
+	// Node the pod ran on
+	// +optional
+	Node string `json:"node,omitempty"`
+
+	// Reason of the disruption, e.g. TerminationByKubelet
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Time of the disruption
+	Time metav1.Time `json:"time"`
+}
+
+// JobTimeline records when a job first entered each phase. Phases entered again, e.g. by a
+// retry, keep their first time; completedAt is cleared when a retry leaves the finished phase.
+type JobTimeline struct {
+	// Time the job was first Pending
+	// +optional
+	PendingAt *metav1.Time `json:"pendingAt,omitempty"`
+
+	// Time the workspace of the job first started syncing
+	// +optional
+	SyncingAt *metav1.Time `json:"syncingAt,omitempty"`
+
+	// Time the job was first Queued for the scheduler
+	// +optional
+	QueuedAt *metav1.Time `json:"queuedAt,omitempty"`
+
+	// Time the workers of the job first ran
+	// +optional
+	RunningAt *metav1.Time `json:"runningAt,omitempty"`
+
+	// Time the job Succeeded, Failed or TimedOut
+	// +optional
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+
+	// Time from queuedAt, or from the creation of jobs that were never Queued, to runningAt,
+	// e.g. 4m10s
+	// +optional
+	QueueWait string `json:"queueWait,omitempty"`
+
+	// Time from runningAt to completedAt, e.g. 2h30m0s
+	// +optional
+	Runtime string `json:"runtime,omitempty"`
+}
+
+// GPUUtilizationStatus sums the last GPU samples of the running workers of a job
+type GPUUtilizationStatus struct {
+	// GPUs sampled on the running workers
+	GPUs int32 `json:"gpus"`
+
+	// Average utilization of the sampled GPUs in percent
+	UtilizationPercent int32 `json:"utilizationPercent"`
+
+	// Memory used on the sampled GPUs in MiB
+	MemoryUsedMiB int64 `json:"memoryUsedMiB"`
+
+	// Memory of the sampled GPUs in MiB
+	MemoryTotalMiB int64 `json:"memoryTotalMiB"`
+
+	// Low is true while every sample of every worker stayed below the lowUtilizationPercent of the
+	// queue for its lowUtilizationSeconds
+	// +optional
+	Low bool `json:"low,omitempty"`
+
+	// Time of the last samples
+	// +optional
+	SampleTime *metav1.Time `json:"sampleTime,omitempty"`
+}
+
+// TrainingProgressStatus is the latest progress a worker of a job reported
+type TrainingProgressStatus struct {
+	// Training step
+	// +optional
+	Step *int64 `json:"step,omitempty"`
+
+	// Training epoch
+	// +optional
+	Epoch *int64 `json:"epoch,omitempty"`
+
+	// Training loss
+	// +optional
+	Loss string `json:"loss,omitempty"`
+
+	// Other metrics the training script reported, e.g. learning rate or tokens per second
+	// +optional
+	Metrics map[string]string `json:"metrics,omitempty"`
+
+	// Worker pod that sent the report
+	// +optional
+	Pod string `json:"pod,omitempty"`
+
+	// Time of the report
+	// +optional
+	ReportTime *metav1.Time `json:"reportTime,omitempty"`
+}
+
+// NotebookStatus is the Jupyter server of a notebook job
+type NotebookStatus struct {
+	// URL of the Jupyter server
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Secret in the namespace of the job holding the token of the Jupyter server in its token key
+	// +optional
+	TokenSecretName string `json:"tokenSecretName,omitempty"`
+}
+
+// ArtifactStatus is an output of a finished job listed in its artifacts manifest
+type ArtifactStatus struct {
+	// Name the trainer gave the artifact
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Path of the artifact as listed in the manifest, relative to the checkpoint directory or a URL
+	Path string `json:"path"`
+
+	// Where the artifact is stored: pvc://<claim>/<jobName>/<path> for checkpoint volumes of a
+	// PVC, <volume>/<jobName>/<path> for other volumes, or the URL of the path
+	Location string `json:"location"`
+
+	// Size of the artifact in bytes
+	// +optional
+	SizeBytes *int64 `json:"sizeBytes,omitempty"`
+
+	// SHA-256 checksum of the artifact, hex encoded
+	// +optional
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// ExitInfo records how the trainer containers of a finished job exited
+type ExitInfo struct {
+	// Attempt of the job the ranks exited in
+	// +optional
+	Attempt int32 `json:"attempt,omitempty"`
+
+	// Reason of the rank that failed first, or of rank 0 if no rank failed
+	Reason string `json:"reason"`
+
+	// Message of the rank that failed first, or of rank 0 if no rank failed
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Exits of rank 0 and of every rank that failed, by rank
+	Ranks []RankExit `json:"ranks"`
+}
+
+// RankExit is the exit of the trainer container of a rank
+type RankExit struct {
+	// Rank of the worker pod
+	Rank int32 `json:"rank"`
+
+	// Name of the worker pod
+	Pod string `json:"pod"`
+
+	// Exit code of the trainer container
+	ExitCode int32 `json:"exitCode"`
+
+	// Why the trainer exited: Completed, OOMKilled, Segfault, PythonException, Signal or Error
+	Reason string `json:"reason"`
+
+	// Reason Kubernetes gave for the termination, e.g. OOMKilled or Error
+	// +optional
+	ContainerReason string `json:"containerReason,omitempty"`
+
+	// The Python exception or last line of the termination message of the trainer
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Time the trainer exited
+	// +optional
+	FinishedAt *metav1.Time `json:"finishedAt,omitempty"`
+}
+
+// JobAttempt records a failed Kubernetes Job of a TorchrunJob
+type JobAttempt struct {
+	// Attempt number, starting at 1
+	Attempt int32 `json:"attempt"`
+
+	// Name of the Kubernetes Job
+	JobName string `json:"jobName"`
+
+	// Time the Job started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// Time the Job failed
+	// +optional
+	FailureTime *metav1.Time `json:"failureTime,omitempty"`
+
+	// Reason of the Job failure, e.g. BackoffLimitExceeded or DeadlineExceeded
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message of the Job failure
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// SuspectNode is a node a worker failed on with an error that points at the node rather than
+// the training code
+type SuspectNode struct {
+	// Name of the node
+	Node string `json:"node"`
+
+	// Kind of error, GPUError or NetworkError
+	Reason string `json:"reason"`
+
+	// Log line of the error
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Worker pod that failed
+	Pod string `json:"pod"`
+
+	// Job attempt the worker failed in
+	Attempt int32 `json:"attempt"`
+
+	// Time the failure was detected
+	Time metav1.Time `json:"time"`
+}
+
+// WorkerStatus describes worker pod status
+type WorkerStatus struct {
+	// Pending workers
+	Pending int32 `json:"pending,omitempty"`
+
+	// Number of ready workers
+	Ready int32 `json:"ready,omitempty"`
+
+	// Number of running workers
+	Running int32 `json:"running,omitempty"`
+
+	// Number of failed workers
+	Failed int32 `json:"failed,omitempty"`
+
+	// Number of succeeded workers
+	Succeeded int32 `json:"succeeded,omitempty"`
+
+	// Pods lists the worker pods of the job, ordered by rank
+	// +optional
+	Pods []WorkerPodStatus `json:"pods,omitempty"`
+}
+
+// WorkerPodStatus describes a single worker pod
+type WorkerPodStatus struct {
+	// Name of the pod
+	Name string `json:"name"`
+
+	// Node the pod is scheduled on
+	// +optional
+	NodeName string `json:"nodeName,omitempty"`
+
+	// Rank index of the worker (JOB_COMPLETION_INDEX)
+	Index int32 `json:"index"`
+
+	// Pod phase
+	Phase string `json:"phase,omitempty"`
+
+	// Total restarts of the pod's containers
+	RestartCount int32 `json:"restartCount,omitempty"`
+
+	// Most recent error reported for the pod, e.g. a crash or a scheduling failure
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+
+	// GPU time of the pod in seconds: the GPUs of the trainer container times the time from the
+	// start of the pod until the trainer ended
+	// +optional
+	GPUSeconds int64 `json:"gpuSeconds,omitempty"`
+
+	// Rendezvous state of the torchrun agent of the pod, read from its trainer logs
+	// +kubebuilder:validation:Enum=Waiting;Joined;Failed
+	// +optional
+	Rendezvous string `json:"rendezvous,omitempty"`
+}
+
+// TorchrunJobCondition describes the state of a TorchrunJob at a certain point
+type TorchrunJobCondition struct {
+	// Type of condition
+	// +kubebuilder:validation:Enum=Provisioned;WorkspaceReady;WorkspaceSync;AllWorkersReady;Completed;JobCreated;QueueNotFound;Admitted;Failed;Retrying;Scheduled;WorkspaceCollected;JobSynced;CapacityFallback;ExperimentTracking;TensorboardReady;Preflight;LogsArchived;DeadlineApproaching;WorkersScheduled;RendezvousReady;Dispatched;OverQuota;WorkspaceSnapshotted;Rank0Failed;LowGPUUtilization;MaxRuntimeExceeded;NotebookReady;ArtifactsCollected
+	Type string `json:"type"`
+
+	// Status of the condition
+	// +kubebuilder:validation:Enum=True;False;Unknown
+	Status string `json:"status"`
+
+	// Last time the condition transitioned
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// The reason for the condition's last transition
+	Reason string `json:"reason,omitempty"`
+
+	// A human-readable message about the transition
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=tj;trj
+// +kubebuilder:printcolumn:name="Queue",type="string",JSONPath=".spec.queue"
+// +kubebuilder:printcolumn:name="Nodes",type="integer",JSONPath=".spec.numNodes"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Workers",type="string",JSONPath=".status.workersSummary"
+// +kubebuilder:printcolumn:name="Wait",type="string",JSONPath=".status.timeline.queueWait"
+// +kubebuilder:printcolumn:name="Runtime",type="string",JSONPath=".status.timeline.runtime"
+// +kubebuilder:printcolumn:name="Step",type="integer",JSONPath=".status.trainingProgress.step"
+// +kubebuilder:printcolumn:name="Loss",type="string",JSONPath=".status.trainingProgress.loss"
+// +kubebuilder:printcolumn:name="Run",type="string",JSONPath=".status.trackingURL",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// TorchrunJob is the Schema for the torchrunjobs API
+type TorchrunJob struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TorchrunJobSpec   `json:"spec,omitempty"`
+	Status TorchrunJobStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TorchrunJobList contains a list of TorchrunJob
+type TorchrunJobList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TorchrunJob `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TorchrunJob{}, &TorchrunJobList{})
+}
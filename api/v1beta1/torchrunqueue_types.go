@@ -0,0 +1,1026 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// TorchrunQueueSpec defines the desired state of TorchrunQueue
+type TorchrunQueueSpec struct {
+	// kai-scheduler queue this TorchrunQueue maps to
+	SchedulerQueue SchedulerQueueConfig `json:"schedulerQueue"`
+
+	// Distributed training configuration
+	Distributed DistributedConfig `json:"distributed,omitempty"`
+
+	// Host networking and RDMA devices of the worker pods for high-speed interconnects
+	// +optional
+	Networking *NetworkingConfig `json:"networking,omitempty"`
+
+	// Pod template configuration
+	PodTemplateConfig PodTemplateConfig `json:"podTemplate,omitempty"`
+
+	// Workspace storage configuration
+	WorkspaceStorage WorkspaceStorageConfig `json:"workspaceStorage,omitempty"`
+
+	// Service account name
+	// +kubebuilder:default="default"
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Resources to be created for this queue (PVCs, ConfigMaps, Secrets, etc.)
+	Resources []ResourceTemplate `json:"resources,omitempty"`
+
+	// Admission limits enforced on jobs submitted to this queue
+	Limits QueueLimits `json:"limits,omitempty"`
+
+	// Workspace upload server configuration
+	UploadServer UploadServerConfig `json:"uploadServer,omitempty"`
+
+	// Job priorities allowed in this queue
+	Priorities QueuePriorityConfig `json:"priorities,omitempty"`
+
+	// Scheduler of the worker pods, e.g. volcano or default-scheduler. kai-scheduler Queues are
+	// only created for queues scheduled by kai-scheduler.
+	// +kubebuilder:default="kai-scheduler"
+	// +optional
+	SchedulerName string `json:"schedulerName,omitempty"`
+
+	// Windows jobs of this queue start in, e.g. off-peak GPU hours. Jobs submitted outside of
+	// them wait suspended until the next window opens.
+	// +optional
+	MaintenanceWindows []TimeWindow `json:"maintenanceWindows,omitempty"`
+
+	// Node placement of spot and on-demand capacity, used by jobs that set capacityType
+	// +optional
+	Capacity *CapacityConfig `json:"capacity,omitempty"`
+
+	// Scheduling constraints enforced on the worker pods of every job, over the pod template
+	// and the pod template patches of jobs
+	// +optional
+	SchedulingConstraints *SchedulingConstraints `json:"schedulingConstraints,omitempty"`
+
+	// Targets job lifecycle events of this queue are posted to
+	// +optional
+	Notifications []NotificationConfig `json:"notifications,omitempty"`
+
+	// Object storage the worker logs of finished jobs are archived to
+	// +optional
+	LogArchive *LogArchiveConfig `json:"logArchive,omitempty"`
+
+	// Dispatch the jobs of this queue in order of priority and waiting time. Without it the Jobs
+	// are created as soon as the workspace is ready and the scheduler orders the pending pods.
+	// +optional
+	Dispatch *DispatchConfig `json:"dispatch,omitempty"`
+
+	// Scale node groups up for all workers of a job at once through the cluster autoscaler, and
+	// keep autoscalers from removing the nodes of running workers
+	// +optional
+	Provisioning *ProvisioningConfig `json:"provisioning,omitempty"`
+
+	// Security settings force-applied to the trainer and workspace sync pods of every job, over the
+	// pod template and the pod template patches of jobs
+	// +optional
+	SecurityPolicy *SecurityPolicy `json:"securityPolicy,omitempty"`
+
+	// GPU utilization sampling of the workers, whose jobs report it in status.gpuUtilization and are
+	// flagged with the LowGPUUtilization condition while their GPUs idle
+	// +optional
+	GPUMetrics *GPUMetricsConfig `json:"gpuMetrics,omitempty"`
+
+	// Named worker shapes jobs select with spec.profile, e.g. 1xa100, 8xa100 or cpu-debug, so the
+	// resources and node placement of each shape are defined once per queue
+	// +optional
+	Profiles []JobProfile `json:"profiles,omitempty"`
+}
+
+// ProvisioningConfig sets the provisioning hints of the worker pods. The workers are annotated
+// so the cluster autoscaler and Karpenter do not scale their nodes down or consolidate them while
+// they run.
+type ProvisioningConfig struct {
+	// Create a ProvisioningRequest of autoscaling.x-k8s.io/v1beta1 for the workers of a multi-node
+	// job and create its Job once the cluster autoscaler provisioned the nodes of all workers,
+	// instead of scaling up one node at a time as the pods become pending
+	// +optional
+	ProvisioningRequest bool `json:"provisioningRequest,omitempty"`
+
+	// Provisioning class of the ProvisioningRequest
+	// +kubebuilder:default="best-effort-atomic-scale-up.autoscaling.x-k8s.io"
+	// +optional
+	ClassName string `json:"className,omitempty"`
+
+	// Parameters of the provisioning class, e.g. ValidUntilSeconds
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// DispatchConfig holds jobs back until they are next in the line of their kai-scheduler queue.
+// Jobs are dispatched while the GPUs of the dispatched jobs fit the GPU quota of the queue.
+type DispatchConfig struct {
+	// Maximum number of dispatched, unfinished jobs per kai-scheduler queue. 0 limits the jobs by
+	// the GPU quota only.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxDispatchedJobs int32 `json:"maxDispatchedJobs,omitempty"`
+
+	// Waiting this long raises the priority of a job by one level, so preemptible jobs are not
+	// starved by a steady stream of higher priority jobs. 0 disables aging.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	AgingSeconds int32 `json:"agingSeconds,omitempty"`
+
+	// Dispatch jobs behind a job waiting for GPUs ahead of it if they fit the free GPUs of the
+	// quota and their estimatedDuration ends before the waiting job could start
+	// +optional
+	Backfill bool `json:"backfill,omitempty"`
+}
+
+// LogArchiveConfig defines the bucket the worker logs of finished jobs are uploaded to. A
+// collector pod reads the logs of the worker pods through the API and uploads them with rclone.
+type LogArchiveConfig struct {
+	// Bucket the logs are uploaded to, as s3://<bucket> or gs://<bucket>
+	// +kubebuilder:validation:Pattern=`^(s3|gs)://[a-z0-9][a-z0-9._-]*$`
+	Bucket string `json:"bucket"`
+
+	// Prefix of the archives in the bucket. The logs of a job are uploaded below
+	// <prefix>/<namespace>/<job>/.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// SecretRef names a Secret in the namespace of the job with the credentials of the bucket:
+	// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and optionally AWS_SESSION_TOKEN for s3, a
+	// service account key in key.json for gs. Without it the collector uses the credentials of
+	// its service account, e.g. IRSA or Workload Identity.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// AWS region of an s3 bucket
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// Endpoint of S3-compatible storage, e.g. MinIO
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Service account of the collector pod. It must be allowed to get pods/log in the namespace
+	// of the job. Defaults to the service account of the queue.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Image of the uploader, which must contain rclone. Defaults to rclone/rclone.
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// NotificationConfig defines a webhook or Slack channel that receives job lifecycle events.
+// Exactly one of webhookURL and slack is set.
+type NotificationConfig struct {
+	// Name of the target
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// URL the events are POSTed to as JSON
+	// +optional
+	WebhookURL string `json:"webhookURL,omitempty"`
+
+	// Slack incoming webhook the events are posted to as messages
+	// +optional
+	Slack *SlackNotificationConfig `json:"slack,omitempty"`
+
+	// Events posted to the target. Empty posts all events.
+	// +kubebuilder:validation:items:Enum=Started;Succeeded;Failed;Preempted
+	// +optional
+	Events []string `json:"events,omitempty"`
+}
+
+// SlackNotificationConfig defines a Slack incoming webhook
+type SlackNotificationConfig struct {
+	// SecretRef names a Secret with the incoming webhook URL in the url key
+	SecretRef corev1.LocalObjectReference `json:"secretRef"`
+}
+
+// CapacityConfig maps the capacity types of jobs to node selectors and tolerations
+type CapacityConfig struct {
+	// Placement of jobs on spot or preemptible nodes
+	// +optional
+	Spot CapacityPlacement `json:"spot,omitempty"`
+
+	// Placement of jobs on on-demand nodes
+	// +optional
+	OnDemand CapacityPlacement `json:"onDemand,omitempty"`
+
+	// Move spot jobs to on-demand capacity once they were preempted too often
+	// +optional
+	Fallback *CapacityFallbackConfig `json:"fallback,omitempty"`
+}
+
+// CapacityPlacement selects the nodes of a capacity type
+type CapacityPlacement struct {
+	// Node labels the worker pods are scheduled on
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations added to the worker pods, e.g. for the taint of spot nodes
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+}
+
+// SchedulingConstraints pin the jobs of a queue to nodes, e.g. a GPU node pool. Unlike settings of
+// the pod template, jobs cannot override them.
+type SchedulingConstraints struct {
+	// Node labels the worker pods are scheduled on, replacing the values of the same keys
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations added to the worker pods
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// RuntimeClass of the worker pods, e.g. nvidia
+	// +optional
+	RuntimeClassName string `json:"runtimeClassName,omitempty"`
+
+	// PriorityClass of the worker pods, replacing the priority class of the job priority
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
+// SecurityPolicy enforces pod security standards on the trainer and workspace sync pods of a queue.
+// Unlike settings of the pod template, jobs cannot override them.
+type SecurityPolicy struct {
+	// Require the containers to run as a non-root user
+	// +optional
+	RunAsNonRoot bool `json:"runAsNonRoot,omitempty"`
+
+	// UID the containers run as, for images whose default user is root
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+
+	// Group owning the mounted volumes, so non-root containers can write the workspace
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	FSGroup *int64 `json:"fsGroup,omitempty"`
+
+	// Seccomp profile of the pods, e.g. RuntimeDefault
+	// +optional
+	SeccompProfile *corev1.SeccompProfile `json:"seccompProfile,omitempty"`
+
+	// Allow the containers to gain more privileges than their parent process. Privileged
+	// containers are denied when false.
+	// +optional
+	AllowPrivilegeEscalation *bool `json:"allowPrivilegeEscalation,omitempty"`
+
+	// Capabilities dropped from every container, e.g. ALL. Added capabilities that are dropped
+	// are removed unless they are allowed.
+	// +optional
+	DropCapabilities []corev1.Capability `json:"dropCapabilities,omitempty"`
+
+	// Capabilities the containers may still add, e.g. IPC_LOCK for RDMA
+	// +optional
+	AllowedCapabilities []corev1.Capability `json:"allowedCapabilities,omitempty"`
+
+	// Mount the root filesystem of the containers read-only
+	// +optional
+	ReadOnlyRootFilesystem bool `json:"readOnlyRootFilesystem,omitempty"`
+
+	// Names of the containers that keep a writable root filesystem
+	// +optional
+	ReadOnlyRootFilesystemExceptions []string `json:"readOnlyRootFilesystemExceptions,omitempty"`
+}
+
+// GPUMetricsConfig samples the utilization and memory of the GPUs of the workers requesting GPUs
+// with nvidia-smi in the trainer container and injects a sidecar that logs the samples for the
+// controller to read
+type GPUMetricsConfig struct {
+	// Image of the sidecar, which needs sh and tail. Defaults to the gpuMetrics image of the
+	// operator config.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Seconds between two samples
+	// +kubebuilder:validation:Minimum=5
+	// +kubebuilder:default=30
+	// +optional
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+
+	// Utilization in percent below which the GPUs of a job count as idle
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:default=20
+	// +optional
+	LowUtilizationPercent int32 `json:"lowUtilizationPercent,omitempty"`
+
+	// Seconds every sample of every worker must stay below lowUtilizationPercent before the job is
+	// flagged
+	// +kubebuilder:validation:Minimum=60
+	// +kubebuilder:default=1800
+	// +optional
+	LowUtilizationSeconds int32 `json:"lowUtilizationSeconds,omitempty"`
+}
+
+// JobProfile is a named worker shape of a queue. It is applied to the pod template of the queue
+// before the pod template patch of the job, which can still override it.
+type JobProfile struct {
+	// Name jobs select the profile by
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Human-readable description of the profile, e.g. the GPU model and count
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// Resources of the trainer container, replacing those of the queue pod template
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Node labels the worker pods are scheduled on, replacing the values of the same keys in the
+	// queue pod template
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations added to the worker pods, e.g. for the taint of a GPU node pool
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Processes torchrun starts per worker. Defaults to the GPUs of the trainer container.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	NprocPerNode int32 `json:"nprocPerNode,omitempty"`
+}
+
+// CapacityFallbackConfig defines when a spot job falls back to on-demand capacity
+type CapacityFallbackConfig struct {
+	// Preemptions within the window after which the job falls back
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=3
+	MaxPreemptions int32 `json:"maxPreemptions,omitempty"`
+
+	// Length of the window preemptions are counted in
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=3600
+	WindowSeconds int32 `json:"windowSeconds,omitempty"`
+}
+
+// QueuePriorityConfig defines which job priorities a queue accepts
+type QueuePriorityConfig struct {
+	// Priorities jobs may request. Empty allows every priority.
+	// +kubebuilder:validation:items:Enum=preemptible;normal;high
+	Allowed []string `json:"allowed,omitempty"`
+
+	// Priority of jobs that do not set one. Empty leaves the kai-scheduler default.
+	// +kubebuilder:validation:Enum=preemptible;normal;high
+	Default string `json:"default,omitempty"`
+}
+
+// UploadServerConfig defines the optional workspace upload server of a queue.
+// When enabled, jobs with a zip workspace source and no URL receive a presigned
+// upload URL in their status and the sync pod downloads the archive from the server.
+type UploadServerConfig struct {
+	// Deploy an upload server for this queue
+	// +kubebuilder:default=false
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Image of the upload server
+	// +kubebuilder:default="dream3dml/torchrun-controller:latest"
+	Image string `json:"image,omitempty"`
+
+	// Size of the staging volume for uploaded archives
+	// +kubebuilder:default="10Gi"
+	StorageSize string `json:"storageSize,omitempty"`
+
+	// Storage class for the staging volume
+	StorageClass string `json:"storageClass,omitempty"`
+
+	// Externally reachable base URL of the upload server (e.g. through an Ingress).
+	// Defaults to the in-cluster Service address.
+	ExternalURL string `json:"externalURL,omitempty"`
+
+	// Lifetime of presigned URLs in seconds
+	// +kubebuilder:validation:Minimum=60
+	// +kubebuilder:default=3600
+	URLExpirySeconds int64 `json:"urlExpirySeconds,omitempty"`
+}
+
+// QueueLimits defines per-job admission policy for a queue
+type QueueLimits struct {
+	// Maximum number of nodes a single job may request. Zero means unlimited.
+	// +kubebuilder:validation:Minimum=0
+	MaxNodesPerJob int `json:"maxNodesPerJob,omitempty"`
+
+	// Maximum number of GPUs (nodes x GPUs per node) a single job may request. Zero means unlimited.
+	// +kubebuilder:validation:Minimum=0
+	MaxGPUsPerJob int `json:"maxGPUsPerJob,omitempty"`
+
+	// Maximum activeDeadlineSeconds a job may run for.
+	// Jobs without a deadline, or with a longer one, are clamped to this value.
+	// +kubebuilder:validation:Minimum=1
+	MaxActiveDeadlineSeconds *int64 `json:"maxActiveDeadlineSeconds,omitempty"`
+
+	// Maximum number of active jobs per user in this queue. Zero means unlimited.
+	// The user is taken from the torchrun.ai/user label on the TorchrunJob; when this limit
+	// is set, jobs without the label are rejected. The label is set by the submitter, so the
+	// limit guards against accidents rather than enforcing a quota against untrusted users.
+	// Active jobs are counted from the informer cache, so jobs submitted at the same moment
+	// may briefly exceed the limit.
+	// +kubebuilder:validation:Minimum=0
+	MaxJobsPerUser int `json:"maxJobsPerUser,omitempty"`
+
+	// Maximum wall-clock seconds a job runs before it is asked to stop. Once exceeded, the
+	// training processes of every worker receive runtimeSignal, so they can checkpoint, and the
+	// job is stopped by its active deadline runtimeGracePeriodSeconds later. The active deadline
+	// of jobs is clamped to the sum of both.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxRuntimeSeconds *int64 `json:"maxRuntimeSeconds,omitempty"`
+
+	// Seconds between the runtime signal and the end of the active deadline. Defaults to 600.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RuntimeGracePeriodSeconds int64 `json:"runtimeGracePeriodSeconds,omitempty"`
+
+	// Signal sent to the training processes once maxRuntimeSeconds is exceeded. Defaults to
+	// SIGTERM, which the processes also receive when their pod is evicted.
+	// +kubebuilder:validation:Enum=SIGTERM;SIGINT;SIGUSR1;SIGUSR2
+	// +optional
+	RuntimeSignal string `json:"runtimeSignal,omitempty"`
+}
+
+// SchedulerQueueConfig defines the kai-scheduler queue configuration
+type SchedulerQueueConfig struct {
+	// kai-scheduler queue name this TorchrunQueue maps to
+	Name string `json:"name"`
+
+	// kai-scheduler parent queue name this TorchrunQueue maps to
+	// +kubebuilder:default="default"
+	ParentQueue string `json:"parentQueue,omitempty"`
+
+	// Resource quotas and limits for the queue
+	Resources QueueResources `json:"resources,omitempty"`
+
+	// Child kai-scheduler Queues created under this queue, e.g. one per team. Jobs of a queue
+	// with children are scheduled in the child set in their childQueue.
+	// +optional
+	Children []ChildQueueConfig `json:"children,omitempty"`
+}
+
+// ChildQueueConfig defines a kai-scheduler Queue in the hierarchy of a TorchrunQueue
+type ChildQueueConfig struct {
+	// kai-scheduler queue name of the child
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Resource quotas and limits of the child. The overQuotaWeight of each resource sets the
+	// share of unused parent resources the child receives relative to its siblings.
+	Resources QueueResources `json:"resources,omitempty"`
+}
+
+// QueueResources defines resource quotas and limits
+type QueueResources struct {
+	// CPU resource configuration
+	CPU ResourceConfig `json:"cpu,omitempty"`
+
+	// GPU resource configuration
+	GPU ResourceConfig `json:"gpu,omitempty"`
+
+	// Memory resource configuration
+	Memory ResourceConfig `json:"memory,omitempty"`
+}
+
+// ResourceConfig defines quota and limit configuration for a resource
+type ResourceConfig struct {
+	// Resource quota for the queue
+	// +kubebuilder:default=-1
+	Quota int `json:"quota,omitempty"`
+
+	// Resource limit for the queue
+	// +kubebuilder:default=-1
+	Limit int `json:"limit,omitempty"`
+
+	// Over quota weight for the queue
+	// +kubebuilder:default=1
+	OverQuotaWeight int `json:"overQuotaWeight,omitempty"`
+}
+
+// DistributedConfig defines distributed training configuration
+type DistributedConfig struct {
+	// PyTorch distributed backend
+	// +kubebuilder:validation:Enum=nccl;gloo;mpi
+	// +kubebuilder:default="nccl"
+	Backend string `json:"backend,omitempty"`
+
+	// Rendezvous backend for torchrun
+	// +kubebuilder:validation:Enum=etcd-v2;c10d;static
+	// +kubebuilder:default="c10d"
+	RdzvBackend string `json:"rdzvBackend,omitempty"`
+
+	// Rendezvous endpoint (e.g., etcd service)
+	// +kubebuilder:default="etcd.etcd-system.svc.cluster.local:2379"
+	RdzvEndpoint string `json:"rdzvEndpoint,omitempty"`
+
+	// Provision an etcd for the queue if the rendezvous backend is etcd-v2 and rdzvEndpoint is
+	// not reachable. Jobs then rendezvous on the provisioned etcd.
+	// +optional
+	ProvisionEtcd bool `json:"provisionEtcd,omitempty"`
+
+	// Image of the provisioned etcd. It must serve the v2 API with --enable-v2.
+	// +kubebuilder:default="quay.io/coreos/etcd:v3.5.12"
+	EtcdImage string `json:"etcdImage,omitempty"`
+
+	// Port for distributed training
+	// +kubebuilder:validation:Minimum=1024
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:default=29500
+	Port int32 `json:"port,omitempty"`
+
+	// Network interface used for NCCL and Gloo bootstrap and socket traffic, exported as
+	// NCCL_SOCKET_IFNAME and GLOO_SOCKET_IFNAME (e.g., eth0, or ^lo,docker to exclude)
+	// +optional
+	SocketIfname string `json:"socketIfname,omitempty"`
+
+	// NCCL log level, exported as NCCL_DEBUG
+	// +kubebuilder:validation:Enum=VERSION;WARN;INFO;TRACE
+	// +optional
+	NCCLDebug string `json:"ncclDebug,omitempty"`
+
+	// Additional NCCL environment variables such as NCCL_IB_HCA or NCCL_NET_GDR_LEVEL, only
+	// set with the nccl backend. Job env takes precedence.
+	// +optional
+	NCCLTuning map[string]string `json:"ncclTuning,omitempty"`
+}
+
+// NetworkingConfig defines how the worker pods reach the interconnect of their nodes
+type NetworkingConfig struct {
+	// Run the workers in the network namespace of their node, so NCCL uses the host NICs
+	// directly. The workers resolve cluster DNS names with ClusterFirstWithHostNet, and two
+	// workers listening on the same port cannot share a node.
+	// +optional
+	HostNetwork bool `json:"hostNetwork,omitempty"`
+
+	// Run the workers in the IPC namespace of their node
+	// +optional
+	HostIPC bool `json:"hostIPC,omitempty"`
+
+	// Size of the memory-backed /dev/shm of the trainer, e.g. 64Gi, used by NCCL and DataLoader
+	// workers. Empty leaves the container runtime default.
+	// +optional
+	SharedMemorySize string `json:"sharedMemorySize,omitempty"`
+
+	// RDMA devices requested by the trainer of every worker
+	// +optional
+	RDMA []RDMADevice `json:"rdma,omitempty"`
+}
+
+// RDMADevice is an RDMA device resource of the nodes
+type RDMADevice struct {
+	// Extended resource name of the devices, e.g. rdma/hca, rdma/rdma_shared_device_a or
+	// vpc.amazonaws.com/efa. EFA devices configure libfabric, others InfiniBand or RoCE.
+	// +kubebuilder:validation:MinLength=1
+	ResourceName string `json:"resourceName"`
+
+	// Devices requested per worker
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1
+	Count int32 `json:"count,omitempty"`
+}
+
+// PodTemplateConfig defines the pod template for jobs
+type PodTemplateConfig struct {
+	// Metadata to be added to pod
+	Metadata PodMetadata `json:"metadata,omitempty"`
+
+	// Pod spec template - must contain a container named "trainer" for the main training workload.
+	// Unlike v1alpha1 the trainer may be at any position; the other containers run as sidecars.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	Spec runtime.RawExtension `json:"spec,omitempty"`
+}
+
+// WorkspaceStorage defines workspace storage configuration
+// +kubebuilder:validation:XValidation:rule="!has(self.source) || self.source != 'git' || (has(self.url) && size(self.url) > 0)",message="git sources require url"
+// +kubebuilder:validation:XValidation:rule="!has(self.source) || self.source != 's3' || has(self.s3) || (has(self.url) && self.url.startsWith('s3://'))",message="s3 sources require s3 or an s3://bucket/key url"
+// +kubebuilder:validation:XValidation:rule="!has(self.source) || self.source != 'rsync' || has(self.rsync)",message="rsync sources require rsync"
+// +kubebuilder:validation:XValidation:rule="!has(self.s3) || (has(self.source) && self.source == 's3')",message="s3 is only used by s3 sources"
+// +kubebuilder:validation:XValidation:rule="!has(self.rsync) || (has(self.source) && self.source == 'rsync')",message="rsync is only used by rsync sources"
+type WorkspaceStorageConfig struct {
+	// Default size of the workspace storage
+	// +kubebuilder:default="1Gi"
+	Size string `json:"size,omitempty"`
+
+	// Image to use for workspace sync
+	// +kubebuilder:default="alpine/git:latest"
+	Image string `json:"image,omitempty"`
+
+	// Image pull policy for sync image
+	// +kubebuilder:default="IfNotPresent"
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// Mount path of the workspace in the trainer. The mount path of the job replaces that of the
+	// queue. Defaults to /app.
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	// DeliveryMode is how the workers get the synced workspace. copy, the default, copies the PVC
+	// into an emptyDir of each worker in an init container. direct mounts the PVC read-only into
+	// the trainer, without the copy that doubles the storage of large workspaces and delays the
+	// start. Workers of several nodes need a PVC they can all read, e.g. ReadOnlyMany. Ephemeral
+	// workspaces have nothing to deliver. The delivery mode of the job replaces that of the queue.
+	// +kubebuilder:validation:Enum=copy;direct
+	// +optional
+	DeliveryMode string `json:"deliveryMode,omitempty"`
+
+	// Storage class for the workspace storage
+	StorageClass string `json:"storageClass,omitempty"`
+
+	// Access modes of the workspace PVC. Defaults to ReadWriteOnce and ReadOnlyMany: the sync pod
+	// writes the workspace, then the workers of every node read it. For storage without
+	// ReadOnlyMany set ReadWriteMany, or ReadWriteOnce alone for jobs whose workers share a node.
+	// The access modes of the job replace those of the queue.
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+
+	// Ephemeral skips the workspace PVC and the sync, for code baked into the image. Each worker
+	// gets an empty volume at mountPath instead: a generic ephemeral volume of storageClass if
+	// set, otherwise an emptyDir limited to size. Applies when set on the queue or the job.
+	// +optional
+	Ephemeral bool `json:"ephemeral,omitempty"`
+
+	// Workspace source type
+	// +kubebuilder:validation:Enum=zip;git;s3;rsync;existing
+	// +kubebuilder:default="zip"
+	Source string `json:"source,omitempty"`
+
+	// URL for git/s3 sources. For s3 sources without an s3 config, an s3://bucket/key URL.
+	// Zip and git URLs may reference keys of Secrets in the namespace of the job as
+	// {{secret:name/key}}, which the sync pod reads from its environment.
+	URL string `json:"url,omitempty"`
+
+	// S3 configures the s3 source, for AWS S3 or S3 compatible stores such as MinIO or GCS
+	// +optional
+	S3 *S3Config `json:"s3,omitempty"`
+
+	// Rsync configures the rsync source, which copies the workspace over SSH from a login node
+	// or shared filesystem
+	// +optional
+	Rsync *RsyncConfig `json:"rsync,omitempty"`
+
+	// InitContainer configures the init container that copies the synced workspace into each
+	// worker. Job fields override the queue field by field.
+	// +optional
+	InitContainer *WorkspaceInitContainerConfig `json:"initContainer,omitempty"`
+
+	// Resources of the sync pod. Defaults to requests of 100m CPU and 1Gi memory and limits of
+	// 200m CPU and 2Gi memory. The resources of the job replace those of the queue.
+	// +optional
+	SyncResources *corev1.ResourceRequirements `json:"syncResources,omitempty"`
+
+	// StreamArchive extracts zip sources with a URL and s3 sources while they download, instead of
+	// storing the archive in the PVC first, so the PVC only needs room for the extracted workspace.
+	// Zip archives are read from stdin by unzip, which the busybox unzip of the default images
+	// supports. Applies when set on the queue or the job.
+	// +optional
+	StreamArchive bool `json:"streamArchive,omitempty"`
+
+	// Snapshot takes a CSI VolumeSnapshot of the workspace PVC once the job finished, labeled
+	// with the job it was taken of, so later jobs can start from it with snapshotRef. Job fields
+	// override the queue field by field.
+	// +optional
+	Snapshot *WorkspaceSnapshotConfig `json:"snapshot,omitempty"`
+}
+
+// WorkspaceInitContainerConfig defines how worker pods wait for the workspace sync
+type WorkspaceInitContainerConfig struct {
+	// Image of the init container, which needs a POSIX shell and cp. Defaults to alpine:3.18.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Image pull policy of the init container. Defaults to IfNotPresent.
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	// +optional
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// Seconds between checks for the synced workspace. Defaults to 5.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PollIntervalSeconds int32 `json:"pollIntervalSeconds,omitempty"`
+
+	// Seconds to wait for the workspace sync before the init container fails. Defaults to 1800.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// WorkspaceSnapshotConfig defines when the workspace of a finished job is snapshotted
+type WorkspaceSnapshotConfig struct {
+	// When to take the snapshot: once the job Succeeded, once it Succeeded or Failed, or Never,
+	// for jobs that opt out of the snapshots of their queue. Defaults to Succeeded.
+	// +kubebuilder:validation:Enum=Succeeded;Finished;Never
+	// +optional
+	When string `json:"when,omitempty"`
+
+	// VolumeSnapshotClass of the snapshot. Defaults to the default class of the CSI driver of
+	// the workspace storage class.
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+}
+
+// RsyncConfig defines the SSH host and directory a workspace is copied from with rsync
+type RsyncConfig struct {
+	// Host to connect to, e.g. a bastion or login node. rsync must be installed on it.
+	// +kubebuilder:validation:MinLength=1
+	Host string `json:"host"`
+
+	// SSH port of the host
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:default=22
+	Port int32 `json:"port,omitempty"`
+
+	// User to log in as. Defaults to the user of the sync image.
+	// +optional
+	User string `json:"user,omitempty"`
+
+	// Path of the directory on the host whose contents become the workspace
+	// +kubebuilder:validation:MinLength=1
+	Path string `json:"path"`
+
+	// SecretRef names a Secret with the SSH private key in ssh-privatekey, as in
+	// kubernetes.io/ssh-auth Secrets, and the host keys in known_hosts. Without
+	// known_hosts the host key is accepted on first use.
+	SecretRef corev1.LocalObjectReference `json:"secretRef"`
+
+	// Image with rsync and an SSH client used to copy the workspace
+	// +kubebuilder:default="instrumentisto/rsync-ssh:alpine"
+	Image string `json:"image,omitempty"`
+}
+
+// S3Config defines where a workspace archive is downloaded from in an S3 compatible store
+// +kubebuilder:validation:XValidation:rule="!has(self.useIRSA) || !self.useIRSA || !has(self.secretRef)",message="useIRSA and secretRef are mutually exclusive"
+type S3Config struct {
+	// Bucket holding the workspace archive
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+
+	// Key of the workspace archive. .zip and .tar archives are extracted as such, anything
+	// else as a gzipped tarball.
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+
+	// Region of the bucket
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// Endpoint of an S3 compatible store, e.g. https://minio.example.com or
+	// https://storage.googleapis.com. Defaults to AWS S3.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// SecretRef names a Secret with AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY keys,
+	// and optionally AWS_SESSION_TOKEN
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// UseIRSA authenticates with the IAM role of the queue's service account
+	// (IAM Roles for Service Accounts) instead of static credentials
+	// +optional
+	UseIRSA bool `json:"useIRSA,omitempty"`
+
+	// Image with rclone used to download the archive
+	// +kubebuilder:default="rclone/rclone:1.68"
+	Image string `json:"image,omitempty"`
+}
+
+// PodMetadata defines metadata for pods
+type PodMetadata struct {
+	// Labels to add to pods
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations to add to pods
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ResourceTemplate defines a Kubernetes resource to be created for the queue
+type ResourceTemplate struct {
+	// Name of the resource (will be used as-is or as a prefix)
+	Name string `json:"name"`
+
+	// NameMode defines how the name should be used
+	// +kubebuilder:validation:Enum=exact;prefix
+	// +kubebuilder:default="exact"
+	NameMode string `json:"nameMode,omitempty"`
+
+	// The resource object - can be any valid Kubernetes resource
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	Template runtime.RawExtension `json:"template"`
+
+	// Immutable indicates if the resource should not be updated after creation
+	// +kubebuilder:default=false
+	Immutable bool `json:"immutable,omitempty"`
+
+	// Readiness check of the resource. Without it the resource is ready once it exists.
+	// +optional
+	Readiness *ResourceReadiness `json:"readiness,omitempty"`
+
+	// Templated renders the string values of the template as Go templates before the resource
+	// is applied, e.g. {{ .Queue.Name }}, {{ .Namespace }}, {{ .Name }} or {{ .Values.size }}
+	// +optional
+	Templated bool `json:"templated,omitempty"`
+
+	// Values available to a templated resource as .Values
+	// +optional
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// ResourceReadiness defines when a queue resource is ready, for kinds that report it in their status
+type ResourceReadiness struct {
+	// JSONPath evaluated on the resource, e.g. {.status.phase} or
+	// {.status.conditions[?(@.type=="Ready")].status}
+	// +kubebuilder:validation:MinLength=1
+	JSONPath string `json:"jsonPath"`
+
+	// Value the JSONPath must yield. Without a value any non-empty result is ready.
+	// +optional
+	Value string `json:"value,omitempty"`
+}
+
+// TorchrunQueueStatus defines the observed state of TorchrunQueue
+type TorchrunQueueStatus struct {
+	// Phase of the TorchrunQueue
+	// +kubebuilder:validation:Enum=Active;Updating;Terminating
+	// +kubebuilder:default="Active"
+	Phase string `json:"phase,omitempty"`
+
+	// Last time the status was updated
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+
+	// Last observed generation
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions
+	Conditions []TorchrunQueueCondition `json:"conditions,omitempty"`
+
+	// ResourcesReady indicates if all queue resources are ready
+	ResourcesReady bool `json:"resourcesReady,omitempty"`
+
+	// ResourceStatus tracks the status of each resource
+	ResourceStatuses []ResourceStatus `json:"resourceStatuses,omitempty"`
+
+	// KaiQueueName is the name of the kai-scheduler Queue the controller last created for the queue
+	// +optional
+	KaiQueueName string `json:"kaiQueueName,omitempty"`
+
+	// StaleKaiQueues are kai-scheduler Queues no longer in the spec, e.g. after queue.name or a
+	// child was renamed. They are deleted once no unfinished worker pods are scheduled in them.
+	// +optional
+	StaleKaiQueues []string `json:"staleKaiQueues,omitempty"`
+
+	// ChildQueues tracks the child kai-scheduler Queues
+	// +optional
+	ChildQueues []ChildQueueStatus `json:"childQueues,omitempty"`
+
+	// ChildQuota is the sum of the child queue quotas. Unlimited child quotas are left out.
+	// +optional
+	ChildQuota *ChildQuotaStatus `json:"childQuota,omitempty"`
+
+	// Usage sums the resource requests of the scheduled pods of the queue, in the units of the quota
+	// +optional
+	Usage *QueueUsageStatus `json:"usage,omitempty"`
+
+	// Jobs counts the TorchrunJobs of the queue by phase
+	// +optional
+	Jobs *QueueJobsStatus `json:"jobs,omitempty"`
+
+	// RdzvEndpoint is the rendezvous endpoint of the etcd provisioned for the queue, used by
+	// jobs instead of spec.distributed.rdzvEndpoint
+	// +optional
+	RdzvEndpoint string `json:"rdzvEndpoint,omitempty"`
+}
+
+// ChildQueueStatus describes a child kai-scheduler Queue
+type ChildQueueStatus struct {
+	// kai-scheduler queue name of the child
+	Name string `json:"name"`
+
+	// Ready indicates if the child Queue exists
+	Ready bool `json:"ready"`
+}
+
+// ChildQuotaStatus sums the quotas of the child queues per resource
+type ChildQuotaStatus struct {
+	// Sum of the CPU quotas
+	CPU int `json:"cpu"`
+
+	// Sum of the GPU quotas
+	GPU int `json:"gpu"`
+
+	// Sum of the memory quotas
+	Memory int `json:"memory"`
+}
+
+// QueueUsageStatus sums the resource requests of the pods running in the queue
+type QueueUsageStatus struct {
+	// Requested CPU in millicores
+	CPU int `json:"cpu"`
+
+	// Requested GPUs
+	GPU int `json:"gpu"`
+
+	// Requested memory in megabytes
+	Memory int `json:"memory"`
+
+	// GPU time in seconds of the jobs of the queue: the unfinished jobs plus the finished jobs
+	// with a TorchrunJobRecord, so usage is kept when finished jobs are deleted
+	// +optional
+	GPUSeconds int64 `json:"gpuSeconds,omitempty"`
+}
+
+// QueueJobsStatus counts the TorchrunJobs of the queue by phase
+type QueueJobsStatus struct {
+	// Jobs with running workers
+	Running int32 `json:"running"`
+
+	// Jobs waiting for the scheduler
+	Queued int32 `json:"queued"`
+
+	// Jobs waiting for admission, their schedule or their workspace
+	Pending int32 `json:"pending"`
+
+	// Running jobs flagged with the LowGPUUtilization condition, as namespace/name
+	// +optional
+	LowGPUUtilization []string `json:"lowGPUUtilization,omitempty"`
+}
+
+// TorchrunQueueCondition describes the state of a TorchrunQueue
+type TorchrunQueueCondition struct {
+	// Type of condition
+	Type string `json:"type"`
+
+	// Status of the condition
+	// +kubebuilder:validation:Enum=True;False;Unknown
+	Status string `json:"status"`
+
+	// Last time the condition transitioned
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// The reason for the condition's last transition
+	Reason string `json:"reason,omitempty"`
+
+	// A human-readable message about the transition
+	Message string `json:"message,omitempty"`
+}
+
+// ResourceStatus tracks the status of a queue resource
+type ResourceStatus struct {
+	// Name of the resource
+	Name string `json:"name"`
+
+	// API version of the resource
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Kind of the resource
+	Kind string `json:"kind"`
+
+	// Ready indicates if the resource is ready
+	Ready bool `json:"ready"`
+
+	// Message provides additional information
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=trq
+// +kubebuilder:printcolumn:name="Queue",type="string",JSONPath=".spec.schedulerQueue.name"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="GPUs",type="integer",JSONPath=".status.usage.gpu"
+// +kubebuilder:printcolumn:name="GPU Quota",type="integer",JSONPath=".spec.schedulerQueue.resources.gpu.quota"
+// +kubebuilder:printcolumn:name="CPU",type="integer",JSONPath=".status.usage.cpu",priority=1
+// +kubebuilder:printcolumn:name="Memory",type="integer",JSONPath=".status.usage.memory",priority=1
+// +kubebuilder:printcolumn:name="Running",type="integer",JSONPath=".status.jobs.running"
+// +kubebuilder:printcolumn:name="Queued",type="integer",JSONPath=".status.jobs.queued"
+// +kubebuilder:printcolumn:name="Pending",type="integer",JSONPath=".status.jobs.pending"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// TorchrunQueue is the Schema for the torchrunqueues API
+type TorchrunQueue struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TorchrunQueueSpec   `json:"spec,omitempty"`
+	Status TorchrunQueueStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TorchrunQueueList contains a list of TorchrunQueue
+type TorchrunQueueList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TorchrunQueue `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TorchrunQueue{}, &TorchrunQueueList{})
+}
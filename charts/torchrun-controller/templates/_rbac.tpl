@@ -0,0 +1,273 @@
+{{/*
+Rules of the cluster-scoped resources: the CRDs, the kai-scheduler Queues and the
+PersistentVolumes, which are granted by a ClusterRole in every mode
+*/}}
+{{- define "torchrun-controller.clusterRules" -}}
+- apiGroups:
+  - apiextensions.k8s.io
+  resources:
+  - customresourcedefinitions
+  verbs:
+  - create
+  - get
+  - patch
+- apiGroups:
+  - ""
+  resources:
+  - persistentvolumes
+  verbs:
+  - get
+- apiGroups:
+  - scheduling.run.ai
+  resources:
+  - queues
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+{{- end }}
+
+{{/*
+Rules of the namespaced resources, granted by the ClusterRole or, with rbac.namespaced, by a Role
+in each watched namespace. The kinds of controller.config.resourceTemplates.allowedKinds are
+granted for the queue resources.
+*/}}
+{{- define "torchrun-controller.namespacedRules" -}}
+- apiGroups:
+  - apps
+  resources:
+  - deployments
+  - statefulsets
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - autoscaling.x-k8s.io
+  resources:
+  - provisioningrequests
+  verbs:
+  - create
+  - delete
+  - get
+- apiGroups:
+  - batch
+  resources:
+  - jobs
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - coordination.k8s.io
+  resources:
+  - leases
+  verbs:
+  - create
+  - get
+  - list
+  - update
+  - watch
+- apiGroups:
+  - ""
+  resources:
+  - configmaps
+  - persistentvolumeclaims
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - ""
+  resources:
+  - pods
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - ""
+  resources:
+  - pods/log
+  verbs:
+  - get
+- apiGroups:
+  - ""
+  resources:
+  - podtemplates
+  verbs:
+  - create
+  - get
+- apiGroups:
+  - ""
+  resources:
+  - secrets
+  verbs:
+  - create
+  - get
+- apiGroups:
+  - ""
+  resources:
+  - services
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - networking.k8s.io
+  resources:
+  - ingresses
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - policy
+  resources:
+  - poddisruptionbudgets
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - snapshot.storage.k8s.io
+  resources:
+  - volumesnapshots
+  verbs:
+  - create
+  - get
+- apiGroups:
+  - torchrun.ai
+  resources:
+  - torchrunjobrecords
+  verbs:
+  - create
+  - get
+  - list
+  - watch
+- apiGroups:
+  - torchrun.ai
+  resources:
+  - torchrunjobs
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - torchrun.ai
+  resources:
+  - torchrunjobs/finalizers
+  verbs:
+  - update
+- apiGroups:
+  - torchrun.ai
+  resources:
+  - torchrunjobs/status
+  verbs:
+  - get
+  - patch
+  - update
+- apiGroups:
+  - torchrun.ai
+  resources:
+  - torchrunqueuebindings
+  verbs:
+  - get
+  - list
+  - watch
+- apiGroups:
+  - torchrun.ai
+  resources:
+  - torchrunqueues
+  verbs:
+  - create
+  - delete
+  - get
+  - list
+  - patch
+  - update
+  - watch
+- apiGroups:
+  - torchrun.ai
+  resources:
+  - torchrunqueues/finalizers
+  verbs:
+  - update
+- apiGroups:
+  - torchrun.ai
+  resources:
+  - torchrunqueues/status
+  verbs:
+  - get
+  - patch
+  - update
+- apiGroups:
+  - torchrun.ai
+  resources:
+  - torchruntemplates
+  verbs:
+  - get
+  - list
+  - watch
+{{- range (.Values.controller.config.resourceTemplates | default dict).allowedKinds }}
+- apiGroups:
+  - {{ .group | default "" | quote }}
+  resources:
+  - {{ .resource }}
+  verbs:
+  - create
+  - get
+  - update
+{{- end }}
+{{- with .Values.rbac.additionalRules }}
+{{ toYaml . }}
+{{- end }}
+{{- end }}
+
+{{/*
+Namespaces granted the namespaced rules with rbac.namespaced: the watched namespaces and the
+namespace of the controller, which holds its leader election lease
+*/}}
+{{- define "torchrun-controller.rbacNamespaces" -}}
+{{- $namespaces := list (include "torchrun-controller.namespace" .) }}
+{{- range .Values.controller.watchNamespaces }}
+{{- $namespaces = append $namespaces . }}
+{{- end }}
+{{- $namespaces | uniq | join "," }}
+{{- end }}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// archiveWorkspace packages a local directory into a temporary workspace.zip and returns its path
+func archiveWorkspace(dir string) (string, error) {
+	f, err := os.CreateTemp("", "workspace-*.zip")
+	if err != nil {
+		return "", fmt.Errorf("failed to create workspace archive: %w", err)
+	}
+	defer f.Close()
+
+	if err := writeZip(dir, f); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to archive %s: %w", dir, err)
+	}
+
+	return f.Name(), nil
+}
+
+// writeZip writes the contents of dir to w, skipping the .git directory
+func writeZip(dir string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+
+		dst, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		_, err = io.Copy(dst, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestWriteZip(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"train.py":           "print('hello')",
+		"configs/model.yaml": "layers: 12",
+		".git/HEAD":          "ref: refs/heads/main",
+		"configs/.gitignore": "*.pt",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	// Symlinks and other non-regular files are skipped
+	if err := os.Symlink(filepath.Join(dir, "train.py"), filepath.Join(dir, "link.py")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeZip(dir, &buf); err != nil {
+		t.Fatalf("writeZip failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	expected := []string{"configs/.gitignore", "configs/model.yaml", "train.py"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected entries %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("expected entries %v, got %v", expected, names)
+			break
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// torchrunctl submits TorchrunJobs with a local workspace and follows them until completion.
+//
+// Usage:
+//
+//	torchrunctl submit -f job.yaml [-d ./workspace] [-n namespace] [--image image] [--watch=true]
+//	torchrunctl watch [-n namespace] <name>
+//	torchrunctl validate -f job.yaml [-q queue.yaml] [-n namespace]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(torchrunv1alpha1.AddToScheme(scheme))
+}
+
+// clients bundles the Kubernetes clients used by the CLI
+type clients struct {
+	client    client.Client
+	clientset kubernetes.Interface
+	namespace string
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage:
+  torchrunctl submit -f job.yaml [-d dir] [-n namespace] [--image image] [--watch=true]
+  torchrunctl watch [-n namespace] <name>
+  torchrunctl validate -f job.yaml [-q queue.yaml] [-n namespace]
+`)
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	ctx := ctrl.SetupSignalHandler()
+
+	var err error
+	switch os.Args[1] {
+	case "submit":
+		err = runSubmit(ctx, os.Args[2:])
+	case "watch":
+		err = runWatch(ctx, os.Args[2:])
+	case "validate":
+		err = runValidate(ctx, os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newClients builds clients from the current kubeconfig, defaulting the namespace to the context namespace
+func newClients(namespace string) (*clients, error) {
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{},
+	)
+
+	config, err := loader.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	if namespace == "" {
+		namespace, _, err = loader.Namespace()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine namespace: %w", err)
+		}
+	}
+
+	return newClientsForConfig(config, namespace)
+}
+
+// newClientsForConfig builds clients for a rest config
+func newClientsForConfig(config *rest.Config, namespace string) (*clients, error) {
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %w", err)
+	}
+
+	return &clients{
+		client:    c,
+		clientset: clientset,
+		namespace: namespace,
+	}, nil
+}
+
+// runWatch implements the watch subcommand
+func runWatch(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	namespace := fs.String("n", "", "Namespace of the TorchrunJob (defaults to the kubeconfig namespace)")
+	logs := fs.Bool("logs", true, "Stream rank-0 trainer logs while the job runs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	c, err := newClients(*namespace)
+	if err != nil {
+		return err
+	}
+
+	return watchJob(ctx, c, fs.Arg(0), *logs)
+}
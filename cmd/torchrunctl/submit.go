@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"sigs.k8s.io/yaml"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/defaultqueue"
+)
+
+// runSubmit implements the submit subcommand
+func runSubmit(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("submit", flag.ExitOnError)
+	file := fs.String("f", "", "Path to the TorchrunJob manifest")
+	dir := fs.String("d", ".", "Local directory to upload as the job workspace")
+	namespace := fs.String("n", "", "Namespace to submit to (defaults to the manifest or kubeconfig namespace)")
+	watch := fs.Bool("watch", true, "Watch the job and stream rank-0 logs until completion")
+	image := fs.String("image", "", "Trainer image, replacing the image of the manifest and the queue pod template")
+	uploadImage := fs.String("upload-image", "python:3.12-alpine", "Image used by the ephemeral workspace upload pod")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		usage()
+	}
+
+	job, err := readJob(*file)
+	if err != nil {
+		return err
+	}
+	if *namespace == "" {
+		*namespace = job.Namespace
+	}
+
+	c, err := newClients(*namespace)
+	if err != nil {
+		return err
+	}
+	job.Namespace = c.namespace
+	if *image != "" {
+		job.Spec.Image = *image
+	}
+
+	// Default the application-level identifiers
+	if job.Spec.JobName == "" {
+		job.Spec.JobName = job.Name
+	}
+	if job.Spec.JobID == "" {
+		job.Spec.JobID = string(uuid.NewUUID())
+	}
+
+	// Decide whether the workspace has to be uploaded before creating the job,
+	// so a missing queue fails fast
+	queueNamespace := job.Namespace
+	if job.Spec.QueueNamespace != "" {
+		queueNamespace = job.Spec.QueueNamespace
+	}
+	// Without a queue the job is submitted to the default queue, as the webhook would set it
+	if job.Spec.Queue == "" {
+		if job.Spec.Queue, err = defaultqueue.Resolve(ctx, c.client, queueNamespace); err != nil {
+			return err
+		}
+	}
+	var jq torchrunv1alpha1.TorchrunQueue
+	if err := c.client.Get(ctx, types.NamespacedName{Name: job.Spec.Queue, Namespace: queueNamespace}, &jq); err != nil {
+		return fmt.Errorf("failed to get TorchrunQueue %s/%s: %w", queueNamespace, job.Spec.Queue, err)
+	}
+	needsUpload := needsWorkspaceUpload(job, &jq)
+
+	var archive string
+	if needsUpload {
+		archive, err = archiveWorkspace(*dir)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(archive)
+	}
+
+	if err := c.client.Create(ctx, job); err != nil {
+		return fmt.Errorf("failed to create TorchrunJob: %w", err)
+	}
+	fmt.Printf("torchrunjob/%s created in namespace %s\n", job.Name, job.Namespace)
+
+	if needsUpload {
+		if jq.Spec.UploadServer.Enabled {
+			err = uploadToServer(ctx, c, job, &jq, archive)
+		} else {
+			err = uploadWorkspace(ctx, c, job, archive, *uploadImage)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !*watch {
+		return nil
+	}
+	return watchJob(ctx, c, job.Name, true)
+}
+
+// readJob reads a TorchrunJob manifest from disk
+func readJob(path string) (*torchrunv1alpha1.TorchrunJob, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	job := &torchrunv1alpha1.TorchrunJob{}
+	if err := yaml.UnmarshalStrict(data, job); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if job.Kind != "" && job.Kind != "TorchrunJob" {
+		return nil, fmt.Errorf("%s contains a %s, expected a TorchrunJob", path, job.Kind)
+	}
+	if job.Name == "" {
+		return nil, fmt.Errorf("%s: metadata.name is required", path)
+	}
+
+	return job, nil
+}
+
+// needsWorkspaceUpload returns true if the job waits for a workspace.zip upload. Ephemeral
+// workspaces are never synced.
+func needsWorkspaceUpload(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) bool {
+	if job.Spec.WorkspaceStorage.Ephemeral || jq.Spec.WorkspaceStorage.Ephemeral {
+		return false
+	}
+
+	source, url := jq.Spec.WorkspaceStorage.Source, jq.Spec.WorkspaceStorage.URL
+	if job.Spec.WorkspaceStorage.Source != "" {
+		source, url = job.Spec.WorkspaceStorage.Source, job.Spec.WorkspaceStorage.URL
+	}
+
+	return (source == "" || source == "zip") && url == ""
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestReadJob(t *testing.T) {
+	tests := []struct {
+		description string
+		manifest    string
+		expectError bool
+	}{
+		{
+			description: "valid TorchrunJob",
+			manifest: `apiVersion: torchrun.ai/v1alpha1
+kind: TorchrunJob
+metadata:
+  name: train
+spec:
+  queue: dev
+  command: python train.py
+`,
+		},
+		{
+			description: "wrong kind",
+			manifest: `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: train
+`,
+			expectError: true,
+		},
+		{
+			description: "missing name",
+			manifest: `kind: TorchrunJob
+spec:
+  queue: dev
+`,
+			expectError: true,
+		},
+		{
+			description: "unknown field",
+			manifest: `kind: TorchrunJob
+metadata:
+  name: train
+spec:
+  queueName: dev
+`,
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "job.yaml")
+		if err := os.WriteFile(path, []byte(test.manifest), 0o644); err != nil {
+			t.Fatalf("failed to write manifest: %v", err)
+		}
+
+		job, err := readJob(path)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.description)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.description, err)
+			continue
+		}
+		if job.Name != "train" || job.Spec.Queue != "dev" {
+			t.Errorf("%s: unexpected job %s/%s", test.description, job.Name, job.Spec.Queue)
+		}
+	}
+}
+
+func TestNeedsWorkspaceUpload(t *testing.T) {
+	tests := []struct {
+		description string
+		queue       torchrunv1alpha1.WorkspaceStorageConfig
+		job         torchrunv1alpha1.WorkspaceStorageConfig
+		expected    bool
+	}{
+		{
+			description: "defaults to zip upload",
+			expected:    true,
+		},
+		{
+			description: "queue zip source with a URL is downloaded",
+			queue:       torchrunv1alpha1.WorkspaceStorageConfig{Source: "zip", URL: "https://example.com/ws.zip"},
+			expected:    false,
+		},
+		{
+			description: "queue git source",
+			queue:       torchrunv1alpha1.WorkspaceStorageConfig{Source: "git", URL: "https://example.com/repo.git"},
+			expected:    false,
+		},
+		{
+			description: "job overrides queue git source with zip",
+			queue:       torchrunv1alpha1.WorkspaceStorageConfig{Source: "git", URL: "https://example.com/repo.git"},
+			job:         torchrunv1alpha1.WorkspaceStorageConfig{Source: "zip"},
+			expected:    true,
+		},
+		{
+			description: "job overrides queue zip source with existing",
+			job:         torchrunv1alpha1.WorkspaceStorageConfig{Source: "existing"},
+			expected:    false,
+		},
+		{
+			description: "ephemeral workspace",
+			queue:       torchrunv1alpha1.WorkspaceStorageConfig{Ephemeral: true},
+			expected:    false,
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{WorkspaceStorage: test.queue}}
+		job := &torchrunv1alpha1.TorchrunJob{Spec: torchrunv1alpha1.TorchrunJobSpec{WorkspaceStorage: test.job}}
+
+		if got := needsWorkspaceUpload(job, jq); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.description, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	jobcontroller "github.com/dream3d/torchrun-controller/internal/controller/job"
+	"github.com/dream3d/torchrun-controller/internal/upload"
+)
+
+const uploadPort = 8080
+
+// uploadServerScript receives a single archive over HTTP and atomically moves it into place,
+// so the sync pod never sees a partially written workspace.zip.
+// Requests must carry the per-upload token, since the pod IP is reachable from the whole cluster.
+const uploadServerScript = `
+import hmac, http.server, os
+
+TOKEN = os.environ["UPLOAD_TOKEN"]
+
+class Handler(http.server.BaseHTTPRequestHandler):
+    def read_body(self, f):
+        if self.headers.get("Transfer-Encoding", "").lower() == "chunked":
+            while True:
+                size = int(self.rfile.readline().split(b";")[0], 16)
+                if size == 0:
+                    self.rfile.readline()
+                    return True
+                while size > 0:
+                    chunk = self.rfile.read(min(size, 1 << 20))
+                    if not chunk:
+                        return False
+                    f.write(chunk)
+                    size -= len(chunk)
+                self.rfile.readline()
+        remaining = int(self.headers.get("Content-Length", "0"))
+        while remaining > 0:
+            chunk = self.rfile.read(min(remaining, 1 << 20))
+            if not chunk:
+                return False
+            f.write(chunk)
+            remaining -= len(chunk)
+        return True
+
+    def do_POST(self):
+        if not hmac.compare_digest(self.headers.get("X-Upload-Token", ""), TOKEN):
+            self.send_response(403)
+            self.end_headers()
+            return
+        tmp = "/workspace/.workspace.zip.part"
+        with open(tmp, "wb") as f:
+            complete = self.read_body(f)
+        if complete:
+            os.rename(tmp, "/workspace/workspace.zip")
+            self.send_response(201)
+        else:
+            os.remove(tmp)
+            self.send_response(400)
+        self.end_headers()
+
+http.server.HTTPServer(("", 8080), Handler).serve_forever()
+`
+
+// uploadWorkspace copies the archive into the job's workspace PVC through an ephemeral upload pod.
+// The upload pod is pinned to the sync pod's node so a ReadWriteOnce PVC can be shared.
+func uploadWorkspace(ctx context.Context, c *clients, job *torchrunv1alpha1.TorchrunJob, archive, image string) error {
+	f, size, err := openArchive(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Waiting for workspace sync pod...\n")
+	nodeName, err := waitForSyncPodNode(ctx, c, job)
+	if err != nil {
+		return err
+	}
+
+	pod := buildUploadPod(job, nodeName, image, token)
+	if err := c.client.Create(ctx, pod); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create upload pod: %w", err)
+	}
+	defer func() {
+		if err := c.client.Delete(context.Background(), pod); err != nil && !errors.IsNotFound(err) {
+			fmt.Fprintf(os.Stderr, "warning: failed to delete upload pod %s: %v\n", pod.Name, err)
+		}
+	}()
+
+	if err := waitForPodReady(ctx, c, pod.Name); err != nil {
+		return err
+	}
+
+	fmt.Printf("Uploading workspace (%d bytes)...\n", size)
+	err = c.clientset.CoreV1().RESTClient().Post().
+		Namespace(job.Namespace).
+		Resource("pods").
+		Name(fmt.Sprintf("%s:%d", pod.Name, uploadPort)).
+		SubResource("proxy").
+		Suffix("upload").
+		SetHeader("X-Upload-Token", token).
+		Body(f).
+		Do(ctx).
+		Error()
+	if err != nil {
+		return fmt.Errorf("failed to upload workspace: %w", err)
+	}
+
+	fmt.Printf("Workspace uploaded\n")
+	return nil
+}
+
+// uploadToServer uploads the archive to the presigned URL published in the job status by the controller.
+// Without an external URL the in-cluster upload server is reached through the API server service proxy.
+func uploadToServer(ctx context.Context, c *clients, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, archive string) error {
+	f, size, err := openArchive(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Printf("Waiting for workspace upload URL...\n")
+	var uploadURL string
+	err = wait.PollUntilContextTimeout(ctx, 2*time.Second, 5*time.Minute, true, func(ctx context.Context) (bool, error) {
+		var current torchrunv1alpha1.TorchrunJob
+		if err := c.client.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, &current); err != nil {
+			return false, err
+		}
+		// Wait for the controller to re-sign an expired URL rather than uploading with it
+		uploadURL = current.Status.WorkspaceUploadURL
+		return uploadURL != "" && !upload.Expired(uploadURL, time.Now()), nil
+	})
+	if err != nil {
+		return fmt.Errorf("controller did not publish a workspace upload URL: %w", err)
+	}
+
+	fmt.Printf("Uploading workspace (%d bytes)...\n", size)
+	if jq.Spec.UploadServer.ExternalURL != "" {
+		err = putArchive(ctx, uploadURL, f, size)
+	} else {
+		err = putArchiveThroughProxy(ctx, c, jq, uploadURL, f)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload workspace: %w", err)
+	}
+
+	fmt.Printf("Workspace uploaded\n")
+	return nil
+}
+
+// putArchive streams the archive directly to a presigned URL
+func putArchive(ctx context.Context, uploadURL string, body io.Reader, size int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, uploadURL, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/zip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("upload server returned %s", resp.Status)
+	}
+	return nil
+}
+
+// putArchiveThroughProxy uploads the archive to the in-cluster upload server via the service proxy
+func putArchiveThroughProxy(ctx context.Context, c *clients, jq *torchrunv1alpha1.TorchrunQueue, uploadURL string, body io.Reader) error {
+	u, err := url.Parse(uploadURL)
+	if err != nil {
+		return fmt.Errorf("invalid upload URL: %w", err)
+	}
+
+	req := c.clientset.CoreV1().RESTClient().Put().
+		Namespace(jq.Namespace).
+		Resource("services").
+		Name(fmt.Sprintf("%s:http", upload.ServerName(jq.Name))).
+		SubResource("proxy").
+		Suffix(u.Path).
+		SetHeader("Content-Type", "application/zip").
+		Body(body)
+	for key, values := range u.Query() {
+		for _, value := range values {
+			req = req.Param(key, value)
+		}
+	}
+
+	return req.Do(ctx).Error()
+}
+
+// openArchive opens the archive for streaming and returns its size
+func openArchive(path string) (*os.File, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// randomToken returns a random hex token authorizing a single upload
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate upload token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// buildUploadPod builds the ephemeral pod that writes the archive into the workspace PVC
+func buildUploadPod(job *torchrunv1alpha1.TorchrunJob, nodeName, image, token string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-upload", job.Name),
+			Namespace: job.Namespace,
+			Labels: map[string]string{
+				"torchrun.ai/job-name": job.Spec.JobName,
+				"torchrun.ai/role":     "upload",
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, torchrunv1alpha1.GroupVersion.WithKind("TorchrunJob")),
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:      nodeName,
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{
+				{
+					Name:    "upload",
+					Image:   image,
+					Command: []string{"python3", "-u", "-c", uploadServerScript},
+					Env: []corev1.EnvVar{
+						{Name: "UPLOAD_TOKEN", Value: token},
+					},
+					Ports: []corev1.ContainerPort{
+						{ContainerPort: uploadPort},
+					},
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(uploadPort)},
+						},
+						PeriodSeconds: 1,
+					},
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "workspace",
+							MountPath: "/workspace",
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "workspace",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: jobcontroller.GetWorkspacePVCName(job),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// waitForSyncPodNode waits until the controller's sync pod is scheduled and returns its node
+func waitForSyncPodNode(ctx context.Context, c *clients, job *torchrunv1alpha1.TorchrunJob) (string, error) {
+	var nodeName string
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, 10*time.Minute, true, func(ctx context.Context) (bool, error) {
+		var pod corev1.Pod
+		if err := c.client.Get(ctx, types.NamespacedName{Name: jobcontroller.GetSyncPodName(job), Namespace: job.Namespace}, &pod); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		nodeName = pod.Spec.NodeName
+		return nodeName != "", nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("sync pod for %s was not scheduled: %w", job.Name, err)
+	}
+	return nodeName, nil
+}
+
+// waitForPodReady waits until the named pod reports the Ready condition
+func waitForPodReady(ctx context.Context, c *clients, name string) error {
+	err := wait.PollUntilContextTimeout(ctx, time.Second, 5*time.Minute, true, func(ctx context.Context) (bool, error) {
+		var pod corev1.Pod
+		if err := c.client.Get(ctx, types.NamespacedName{Name: name, Namespace: c.namespace}, &pod); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		if pod.Status.Phase == corev1.PodFailed {
+			return false, fmt.Errorf("pod %s failed: %s", name, pod.Status.Message)
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("pod %s did not become ready: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/defaultqueue"
+	"github.com/dream3d/torchrun-controller/pkg/validation"
+)
+
+// runValidate implements the validate subcommand. With a queue manifest it reads nothing from
+// the cluster; otherwise the job is dry run by the API server, which applies the CRD defaults,
+// validation rules and webhooks, and checked against its queue in the cluster.
+func runValidate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	file := fs.String("f", "", "Path to the TorchrunJob manifest")
+	queueFile := fs.String("q", "", "Path to the TorchrunQueue manifest, validating offline instead of against the cluster")
+	namespace := fs.String("n", "", "Namespace of the job (defaults to the manifest or kubeconfig namespace)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		usage()
+	}
+
+	job, err := readJob(*file)
+	if err != nil {
+		return err
+	}
+
+	var jq *torchrunv1alpha1.TorchrunQueue
+	if *queueFile != "" {
+		if jq, err = readQueue(*queueFile); err != nil {
+			return err
+		}
+		if *namespace != "" {
+			job.Namespace = *namespace
+		}
+	} else {
+		if *namespace == "" {
+			*namespace = job.Namespace
+		}
+		c, err := newClients(*namespace)
+		if err != nil {
+			return err
+		}
+		job.Namespace = c.namespace
+		queueNamespace := job.Namespace
+		if job.Spec.QueueNamespace != "" {
+			queueNamespace = job.Spec.QueueNamespace
+		}
+		if job.Spec.Queue == "" {
+			if job.Spec.Queue, err = defaultqueue.Resolve(ctx, c.client, queueNamespace); err != nil {
+				return err
+			}
+		}
+		// The dry run returns the job as it would be stored, with the CRD defaults
+		job.SetGroupVersionKind(torchrunv1alpha1.GroupVersion.WithKind("TorchrunJob"))
+		if err := c.client.Create(ctx, job, client.DryRunAll); err != nil {
+			return fmt.Errorf("TorchrunJob %s is invalid: %w", job.Name, err)
+		}
+		jq = &torchrunv1alpha1.TorchrunQueue{}
+		if err := c.client.Get(ctx, types.NamespacedName{Name: job.Spec.Queue, Namespace: queueNamespace}, jq); err != nil {
+			return fmt.Errorf("failed to get TorchrunQueue %s/%s: %w", queueNamespace, job.Spec.Queue, err)
+		}
+	}
+
+	if err := validation.Validate(job, jq); err != nil {
+		return fmt.Errorf("TorchrunJob %s is invalid for queue %s: %w", job.Name, jq.Name, err)
+	}
+	fmt.Printf("torchrunjob/%s is valid for queue %s\n", job.Name, jq.Name)
+	return nil
+}
+
+// readQueue reads a TorchrunQueue manifest from disk
+func readQueue(path string) (*torchrunv1alpha1.TorchrunQueue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	jq := &torchrunv1alpha1.TorchrunQueue{}
+	if err := yaml.UnmarshalStrict(data, jq); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if jq.Kind != "" && jq.Kind != "TorchrunQueue" {
+		return nil, fmt.Errorf("%s contains a %s, expected a TorchrunQueue", path, jq.Kind)
+	}
+	if jq.Name == "" {
+		return nil, fmt.Errorf("%s: metadata.name is required", path)
+	}
+
+	return jq, nil
+}
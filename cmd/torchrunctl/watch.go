@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// logDrainTimeout bounds how long watch waits for the rank-0 log stream to finish after the job completed
+const logDrainTimeout = 30 * time.Second
+
+// watchJob prints phase transitions of a TorchrunJob and optionally streams rank-0 logs,
+// returning an error if the job does not succeed
+func watchJob(ctx context.Context, c *clients, name string, logs bool) error {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	lastPhase := ""
+	lastTrackingURL := ""
+	lastTensorboardURL := ""
+	lastNotebookURL := ""
+	lastQueuePosition := ""
+	var logsDone chan struct{}
+
+	for {
+		var job torchrunv1alpha1.TorchrunJob
+		if err := c.client.Get(ctx, types.NamespacedName{Name: name, Namespace: c.namespace}, &job); err != nil {
+			return fmt.Errorf("failed to get TorchrunJob %s: %w", name, err)
+		}
+
+		phase := job.Status.Phase
+		if phase != lastPhase && phase != "" {
+			fmt.Printf("%s  %-10s %s\n", time.Now().Format(time.TimeOnly), phase, job.Status.WorkersStatus)
+			lastPhase = phase
+		}
+		if position := formatQueuePosition(&job); position != "" && position != lastQueuePosition {
+			fmt.Printf("%s  %-10s %s\n", time.Now().Format(time.TimeOnly), "Queue", position)
+			lastQueuePosition = position
+		}
+		if url := job.Status.TrackingURL; url != "" && url != lastTrackingURL {
+			fmt.Printf("%s  %-10s %s\n", time.Now().Format(time.TimeOnly), "Run", url)
+			lastTrackingURL = url
+		}
+		if url := job.Status.TensorboardURL; url != "" && url != lastTensorboardURL {
+			fmt.Printf("%s  %-10s %s\n", time.Now().Format(time.TimeOnly), "TensorBoard", url)
+			lastTensorboardURL = url
+		}
+		if notebook := job.Status.Notebook; notebook != nil && notebook.URL != lastNotebookURL {
+			fmt.Printf("%s  %-10s %s (token in Secret %s)\n", time.Now().Format(time.TimeOnly), "Notebook", notebook.URL, notebook.TokenSecretName)
+			lastNotebookURL = notebook.URL
+		}
+
+		finished := phase == torchrunv1alpha1.PhaseSucceeded || phase == torchrunv1alpha1.PhaseFailed || phase == torchrunv1alpha1.PhaseTimedOut
+		// Jobs that finish between two polls still get their logs printed
+		if logs && logsDone == nil && (phase == torchrunv1alpha1.PhaseRunning || finished) {
+			logsDone = make(chan struct{})
+			go func(job *torchrunv1alpha1.TorchrunJob) {
+				defer close(logsDone)
+				if err := streamRank0Logs(ctx, c, job); err != nil {
+					fmt.Fprintf(os.Stderr, "warning: log streaming stopped: %v\n", err)
+				}
+			}(&job)
+		}
+
+		switch phase {
+		case torchrunv1alpha1.PhaseSucceeded:
+			waitForLogs(logsDone)
+			return nil
+		case torchrunv1alpha1.PhaseFailed, torchrunv1alpha1.PhaseTimedOut, torchrunv1alpha1.PhaseDeleted:
+			waitForLogs(logsDone)
+			return fmt.Errorf("job %s finished with phase %s%s", name, phase, lastConditionMessage(&job))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitForLogs waits for the log stream to reach the end of the rank-0 output, up to logDrainTimeout
+func waitForLogs(done chan struct{}) {
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(logDrainTimeout):
+		fmt.Fprintf(os.Stderr, "warning: timed out waiting for the rank-0 log stream to finish\n")
+	}
+}
+
+// streamRank0Logs follows the trainer logs of the rank-0 worker pod
+func streamRank0Logs(ctx context.Context, c *clients, job *torchrunv1alpha1.TorchrunJob) error {
+	var podName string
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, 10*time.Minute, true, func(ctx context.Context) (bool, error) {
+		var pods corev1.PodList
+		if err := c.client.List(ctx, &pods,
+			client.InNamespace(job.Namespace),
+			client.MatchingLabels{
+				"torchrun.ai/job-id":                       job.Spec.JobID,
+				"batch.kubernetes.io/job-completion-index": "0",
+			},
+		); err != nil {
+			return false, err
+		}
+		for _, pod := range pods.Items {
+			if pod.Status.Phase == corev1.PodRunning || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+				podName = pod.Name
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("rank-0 pod did not start: %w", err)
+	}
+
+	stream, err := c.clientset.CoreV1().Pods(job.Namespace).GetLogs(podName, &corev1.PodLogOptions{
+		Container: "trainer",
+		Follow:    true,
+	}).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	_, err = io.Copy(os.Stdout, stream)
+	return err
+}
+
+// lastConditionMessage returns the message of the most recently transitioned failing condition
+func lastConditionMessage(job *torchrunv1alpha1.TorchrunJob) string {
+	var latest *torchrunv1alpha1.TorchrunJobCondition
+	for i := range job.Status.Conditions {
+		condition := &job.Status.Conditions[i]
+		if condition.Status != "False" || condition.LastTransitionTime == nil {
+			continue
+		}
+		if latest == nil || condition.LastTransitionTime.After(latest.LastTransitionTime.Time) {
+			latest = condition
+		}
+	}
+	if latest == nil || latest.Message == "" {
+		return ""
+	}
+	return fmt.Sprintf(": %s", latest.Message)
+}
+
+// formatQueuePosition describes the place of a Queued job in its queue, e.g. "#2, estimated
+// start 14:05:00", or returns "" for jobs that are not waiting
+func formatQueuePosition(job *torchrunv1alpha1.TorchrunJob) string {
+	if job.Status.QueuePosition == 0 {
+		return ""
+	}
+	position := fmt.Sprintf("#%d", job.Status.QueuePosition)
+	if start := job.Status.EstimatedStartTime; start != nil {
+		position += ", estimated start " + start.Local().Format(time.TimeOnly)
+	}
+	return position
+}
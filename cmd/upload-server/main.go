@@ -0,0 +1,61 @@
+// upload-server receives workspace archives on presigned URLs issued by the torchrun controller
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/dream3d/torchrun-controller/internal/upload"
+)
+
+func main() {
+	var bindAddr string
+	var dataDir string
+	var maxBytes int64
+	var retention time.Duration
+	flag.StringVar(&bindAddr, "bind-address", ":8080", "The address the upload server binds to.")
+	flag.StringVar(&dataDir, "data-dir", "/data", "Directory where uploaded archives are stored.")
+	flag.Int64Var(&maxBytes, "max-upload-bytes", 10<<30, "Maximum size of an uploaded archive in bytes.")
+	flag.DurationVar(&retention, "retention", 24*time.Hour, "How long uploaded archives are kept.")
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	log := ctrl.Log.WithName("upload-server")
+
+	key := os.Getenv("UPLOAD_SIGNING_KEY")
+	if key == "" {
+		log.Error(errors.New("UPLOAD_SIGNING_KEY is not set"), "unable to start upload server")
+		os.Exit(1)
+	}
+
+	server := upload.NewServer(upload.NewSigner([]byte(key)), dataDir, maxBytes, log)
+	httpServer := &http.Server{
+		Addr:              bindAddr,
+		Handler:           server,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	ctx := ctrl.SetupSignalHandler()
+	go server.CleanupLoop(ctx, retention, time.Hour)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Info("starting upload server", "address", bindAddr, "dataDir", dataDir)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error(err, "problem running upload server")
+		os.Exit(1)
+	}
+}
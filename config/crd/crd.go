@@ -0,0 +1,10 @@
+// Package crd embeds the generated CRD manifests, so the manager can install the CRDs of its
+// own version with --install-crds
+package crd
+
+import "embed"
+
+// Bases holds the CRD manifests of config/crd/bases
+//
+//go:embed bases/*.yaml
+var Bases embed.FS
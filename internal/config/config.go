@@ -0,0 +1,248 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// KaiSchedulerName is the name of the kai-scheduler, which schedules the pods of queues and jobs
+// that do not name a scheduler unless the operator configures another one
+const KaiSchedulerName = "kai-scheduler"
+
+// ConfigKey is the key of the ConfigMap holding the operator configuration
+const ConfigKey = "config.yaml"
+
+// OperatorConfig is the controller-wide configuration. Every field is optional; unset fields keep
+// the defaults of the controller flags.
+type OperatorConfig struct {
+	// Images of the pods and containers the controller adds to jobs
+	Images Images `json:"images,omitempty"`
+
+	// SchedulerName schedules the pods of queues and jobs that do not name a scheduler
+	SchedulerName string `json:"schedulerName,omitempty"`
+
+	// RdzvBackend is the torchrun rendezvous backend of queues that do not set one
+	RdzvBackend string `json:"rdzvBackend,omitempty"`
+
+	// WorkspaceGC configures the garbage collection of the workspaces of finished jobs
+	WorkspaceGC WorkspaceGC `json:"workspaceGC,omitempty"`
+
+	// Metrics configures the metrics the controller reports
+	Metrics Metrics `json:"metrics,omitempty"`
+
+	// Reconcile configures how often jobs are reconciled without a watch event
+	Reconcile Reconcile `json:"reconcile,omitempty"`
+
+	// ProgressURL is the progress endpoint of the controller, which the trainer finds in
+	// TORCHRUN_PROGRESS_URL. Empty leaves the variable unset.
+	ProgressURL string `json:"progressURL,omitempty"`
+
+	// ResourceTemplates restricts the kinds queues may create with spec.resources
+	ResourceTemplates ResourceTemplates `json:"resourceTemplates,omitempty"`
+}
+
+// Images are the default images of the helper containers. Queues and jobs that set an image
+// override them.
+type Images struct {
+	// WorkspaceSync downloads zip and git workspaces in the sync pod
+	WorkspaceSync string `json:"workspaceSync,omitempty"`
+
+	// WorkspaceInit copies the synced workspace into each worker and reads the artifacts
+	// manifest of finished jobs
+	WorkspaceInit string `json:"workspaceInit,omitempty"`
+
+	// S3Sync downloads s3 workspaces with rclone
+	S3Sync string `json:"s3Sync,omitempty"`
+
+	// RsyncSync copies rsync workspaces over SSH
+	RsyncSync string `json:"rsyncSync,omitempty"`
+
+	// LogCollector reads the worker logs of finished jobs with kubectl
+	LogCollector string `json:"logCollector,omitempty"`
+
+	// LogArchive uploads the collected logs with rclone
+	LogArchive string `json:"logArchive,omitempty"`
+
+	// GPUMetrics logs the GPU samples of the workers of queues with gpuMetrics but without an image
+	GPUMetrics string `json:"gpuMetrics,omitempty"`
+
+	// RuntimeLimit signals the training processes of jobs over the maximum runtime of their queue
+	RuntimeLimit string `json:"runtimeLimit,omitempty"`
+
+	// Watchdog stops the torchrun agent of stalled workers of jobs with a watchdog but without an
+	// image
+	Watchdog string `json:"watchdog,omitempty"`
+}
+
+// WorkspaceGC configures the garbage collection of workspace PVCs
+type WorkspaceGC struct {
+	// Retention is how long the workspaces of Succeeded and Failed jobs are kept, 0 keeps them
+	// until the TorchrunJob is deleted
+	Retention metav1.Duration `json:"retention,omitempty"`
+
+	// Interval is how often finished jobs are checked for expired workspaces
+	Interval metav1.Duration `json:"interval,omitempty"`
+}
+
+// Metrics configures the metrics of the controller
+type Metrics struct {
+	// QueueUtilizationInterval is how often the utilization in the queue status is refreshed
+	QueueUtilizationInterval metav1.Duration `json:"queueUtilizationInterval,omitempty"`
+
+	// GPUUsage exports the GPU time of the jobs per queue as the torchrun_queue_gpu_seconds_total
+	// counter
+	GPUUsage bool `json:"gpuUsage,omitempty"`
+}
+
+// Reconcile configures the requeues of the job controller. Changes of the Jobs, worker pods, sync
+// pods and workspace PVCs of jobs are watched; requeues only catch what no watch reports.
+type Reconcile struct {
+	// ResyncInterval is how often jobs are reconciled when none of their objects changed
+	ResyncInterval metav1.Duration `json:"resyncInterval,omitempty"`
+
+	// PollInterval is how often jobs waiting on what is not watched are reconciled: the queue
+	// position and dispatch of Queued jobs, node provisioning, the rendezvous in the worker logs,
+	// log archives and workspace snapshots
+	PollInterval metav1.Duration `json:"pollInterval,omitempty"`
+}
+
+// ResourceTemplates configures the resources queues create from spec.resources
+type ResourceTemplates struct {
+	// AllowedKinds are the kinds queue resources may have. The controller is granted RBAC on
+	// these kinds only, so queues with other kinds are rejected at admission and not reconciled.
+	// Empty allows any kind the controller has permissions on.
+	AllowedKinds []ResourceKind `json:"allowedKinds,omitempty"`
+}
+
+// ResourceKind is a kind queue resources may have
+type ResourceKind struct {
+	// Group of the kind, empty for the core group
+	Group string `json:"group,omitempty"`
+
+	// Version of the kind. Empty allows every version of the group.
+	Version string `json:"version,omitempty"`
+
+	// Kind, e.g. ConfigMap or ExternalSecret
+	Kind string `json:"kind"`
+
+	// Resource is the plural resource of the kind, e.g. configmaps, which the Helm chart
+	// grants the controller
+	Resource string `json:"resource"`
+}
+
+// Allows reports whether queue resources may have the kind. Every kind is allowed without
+// allowed kinds.
+func (t *ResourceTemplates) Allows(gvk schema.GroupVersionKind) bool {
+	if len(t.AllowedKinds) == 0 {
+		return true
+	}
+	for _, allowed := range t.AllowedKinds {
+		if allowed.Group == gvk.Group && allowed.Kind == gvk.Kind && (allowed.Version == "" || allowed.Version == gvk.Version) {
+			return true
+		}
+	}
+	return false
+}
+
+// Default returns the built-in configuration
+func Default() *OperatorConfig {
+	return &OperatorConfig{
+		Images: Images{
+			WorkspaceSync: "alpine/git:latest",
+			WorkspaceInit: "alpine:3.18",
+			S3Sync:        "rclone/rclone:1.68",
+			RsyncSync:     "instrumentisto/rsync-ssh:alpine",
+			LogCollector:  "bitnami/kubectl:1.29",
+			LogArchive:    "rclone/rclone:1.68",
+			GPUMetrics:    "alpine:3.18",
+			RuntimeLimit:  "busybox:1.36",
+			Watchdog:      "busybox:1.36",
+		},
+		SchedulerName: KaiSchedulerName,
+		RdzvBackend:   "c10d",
+		WorkspaceGC: WorkspaceGC{
+			Interval: metav1.Duration{Duration: 10 * time.Minute},
+		},
+		Metrics: Metrics{
+			QueueUtilizationInterval: metav1.Duration{Duration: 30 * time.Second},
+		},
+		Reconcile: Reconcile{
+			ResyncInterval: metav1.Duration{Duration: 5 * time.Minute},
+			PollInterval:   metav1.Duration{Duration: 15 * time.Second},
+		},
+	}
+}
+
+// Parse reads a YAML configuration over base. Unknown fields are rejected, so typos do not
+// silently keep a default.
+func Parse(data []byte, base *OperatorConfig) (*OperatorConfig, error) {
+	cfg := *base
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid operator config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid operator config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Validate checks that the configuration can be used by the controllers
+func (c *OperatorConfig) Validate() error {
+	images := []struct{ name, image string }{
+		{"workspaceSync", c.Images.WorkspaceSync},
+		{"workspaceInit", c.Images.WorkspaceInit},
+		{"s3Sync", c.Images.S3Sync},
+		{"rsyncSync", c.Images.RsyncSync},
+		{"logCollector", c.Images.LogCollector},
+		{"logArchive", c.Images.LogArchive},
+		{"gpuMetrics", c.Images.GPUMetrics},
+		{"runtimeLimit", c.Images.RuntimeLimit},
+		{"watchdog", c.Images.Watchdog},
+	}
+	for _, image := range images {
+		if image.image == "" {
+			return fmt.Errorf("images.%s must not be empty", image.name)
+		}
+	}
+	if c.SchedulerName == "" {
+		return fmt.Errorf("schedulerName must not be empty")
+	}
+	if c.RdzvBackend == "" {
+		return fmt.Errorf("rdzvBackend must not be empty")
+	}
+	if c.WorkspaceGC.Retention.Duration < 0 {
+		return fmt.Errorf("workspaceGC.retention must not be negative")
+	}
+	if c.WorkspaceGC.Interval.Duration <= 0 {
+		return fmt.Errorf("workspaceGC.interval must be positive")
+	}
+	if c.Metrics.QueueUtilizationInterval.Duration <= 0 {
+		return fmt.Errorf("metrics.queueUtilizationInterval must be positive")
+	}
+	if c.Reconcile.ResyncInterval.Duration <= 0 {
+		return fmt.Errorf("reconcile.resyncInterval must be positive")
+	}
+	if c.Reconcile.PollInterval.Duration <= 0 {
+		return fmt.Errorf("reconcile.pollInterval must be positive")
+	}
+	if c.ProgressURL != "" {
+		if u, err := url.Parse(c.ProgressURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("progressURL must be an http or https URL, got %q", c.ProgressURL)
+		}
+	}
+	for i, allowed := range c.ResourceTemplates.AllowedKinds {
+		if allowed.Kind == "" || allowed.Resource == "" {
+			return fmt.Errorf("resourceTemplates.allowedKinds[%d] needs a kind and a resource", i)
+		}
+		if strings.Contains(allowed.Group+allowed.Kind+allowed.Resource, "*") {
+			return fmt.Errorf("resourceTemplates.allowedKinds[%d] must not use wildcards", i)
+		}
+	}
+	return nil
+}
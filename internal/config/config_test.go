@@ -0,0 +1,185 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParse(t *testing.T) {
+	base := Default()
+	base.WorkspaceGC.Retention.Duration = time.Hour
+
+	tests := []struct {
+		description string
+		data        string
+		expectError string
+		check       func(*OperatorConfig) bool
+	}{
+		{
+			description: "empty config keeps the base",
+			data:        "{}",
+			check: func(cfg *OperatorConfig) bool {
+				return reflect.DeepEqual(cfg, base)
+			},
+		},
+		{
+			description: "set fields override the base",
+			data:        "images:\n  s3Sync: registry.local/rclone:1.68\nschedulerName: volcano\nworkspaceGC:\n  interval: 1m\n",
+			check: func(cfg *OperatorConfig) bool {
+				return cfg.Images.S3Sync == "registry.local/rclone:1.68" && cfg.Images.RsyncSync == base.Images.RsyncSync &&
+					cfg.SchedulerName == "volcano" && cfg.WorkspaceGC.Interval.Duration == time.Minute &&
+					cfg.WorkspaceGC.Retention.Duration == time.Hour
+			},
+		},
+		{
+			description: "unknown fields are rejected",
+			data:        "schedulerNmae: volcano\n",
+			expectError: "unknown field",
+		},
+		{
+			description: "empty images are rejected",
+			data:        "images:\n  logArchive: \"\"\n",
+			expectError: "images.logArchive must not be empty",
+		},
+		{
+			description: "a zero interval is rejected",
+			data:        "metrics:\n  queueUtilizationInterval: 0s\n",
+			expectError: "metrics.queueUtilizationInterval must be positive",
+		},
+		{
+			description: "a zero poll interval is rejected",
+			data:        "reconcile:\n  pollInterval: 0s\n",
+			expectError: "reconcile.pollInterval must be positive",
+		},
+		{
+			description: "a progress URL without scheme is rejected",
+			data:        "progressURL: torchrun-progress.torchrun-system.svc:8084/progress\n",
+			expectError: "progressURL must be an http or https URL",
+		},
+		{
+			description: "allowed resource kinds",
+			data:        "resourceTemplates:\n  allowedKinds:\n  - kind: ConfigMap\n    resource: configmaps\n",
+			check: func(cfg *OperatorConfig) bool {
+				return len(cfg.ResourceTemplates.AllowedKinds) == 1 && cfg.ResourceTemplates.AllowedKinds[0].Resource == "configmaps"
+			},
+		},
+		{
+			description: "an allowed kind without resource is rejected",
+			data:        "resourceTemplates:\n  allowedKinds:\n  - group: external-secrets.io\n    kind: ExternalSecret\n",
+			expectError: "resourceTemplates.allowedKinds[0] needs a kind and a resource",
+		},
+		{
+			description: "a wildcard allowed kind is rejected",
+			data:        "resourceTemplates:\n  allowedKinds:\n  - group: \"*\"\n    kind: \"*\"\n    resource: \"*\"\n",
+			expectError: "resourceTemplates.allowedKinds[0] must not use wildcards",
+		},
+	}
+
+	for _, test := range tests {
+		cfg, err := Parse([]byte(test.data), base)
+		if test.expectError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectError) {
+				t.Errorf("%s: expected error %q, got %v", test.description, test.expectError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: Parse() error = %v", test.description, err)
+		}
+		if !test.check(cfg) {
+			t.Errorf("%s: unexpected config %+v", test.description, cfg)
+		}
+	}
+	if base.SchedulerName != KaiSchedulerName {
+		t.Errorf("expected the base to be unchanged, got scheduler %s", base.SchedulerName)
+	}
+}
+
+func TestStore(t *testing.T) {
+	var nilStore *Store
+	if nilStore.Get().SchedulerName != KaiSchedulerName {
+		t.Errorf("expected a nil store to return the defaults")
+	}
+
+	store := NewStore(Default())
+	configMap := func(data string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "torchrun-controller-config", Namespace: "torchrun-system"},
+			Data:       map[string]string{ConfigKey: data},
+		}
+	}
+
+	if err := store.Load(configMap("rdzvBackend: etcd-v2\n")); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if store.Get().RdzvBackend != "etcd-v2" {
+		t.Errorf("expected the loaded rendezvous backend, got %s", store.Get().RdzvBackend)
+	}
+
+	// An invalid config keeps the loaded one
+	if err := store.Load(configMap("rdzvBackend: [\n")); err == nil {
+		t.Errorf("expected an error for invalid YAML")
+	}
+	if store.Get().RdzvBackend != "etcd-v2" {
+		t.Errorf("expected the previous config to be kept, got %s", store.Get().RdzvBackend)
+	}
+
+	store.Reset()
+	if store.Get().RdzvBackend != "c10d" {
+		t.Errorf("expected the base config after a reset, got %s", store.Get().RdzvBackend)
+	}
+}
+
+func TestResourceTemplatesAllows(t *testing.T) {
+	allowed := ResourceTemplates{AllowedKinds: []ResourceKind{
+		{Kind: "ConfigMap", Resource: "configmaps"},
+		{Group: "external-secrets.io", Version: "v1beta1", Kind: "ExternalSecret", Resource: "externalsecrets"},
+	}}
+
+	tests := []struct {
+		description string
+		templates   ResourceTemplates
+		gvk         schema.GroupVersionKind
+		expect      bool
+	}{
+		{
+			description: "any kind without allowed kinds",
+			gvk:         schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+			expect:      true,
+		},
+		{
+			description: "allowed kind of any version",
+			templates:   allowed,
+			gvk:         schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			expect:      true,
+		},
+		{
+			description: "allowed kind of the allowed version",
+			templates:   allowed,
+			gvk:         schema.GroupVersionKind{Group: "external-secrets.io", Version: "v1beta1", Kind: "ExternalSecret"},
+			expect:      true,
+		},
+		{
+			description: "allowed kind of another version",
+			templates:   allowed,
+			gvk:         schema.GroupVersionKind{Group: "external-secrets.io", Version: "v1", Kind: "ExternalSecret"},
+		},
+		{
+			description: "kind of another group",
+			templates:   allowed,
+			gvk:         schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "ConfigMap"},
+		},
+	}
+
+	for _, test := range tests {
+		if allows := test.templates.Allows(test.gvk); allows != test.expect {
+			t.Errorf("%s: expected %v, got %v", test.description, test.expect, allows)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Store holds the current operator configuration. Reconcilers read it once per reconcile, so a
+// reload never changes the configuration in the middle of one.
+type Store struct {
+	base    *OperatorConfig
+	current atomic.Pointer[OperatorConfig]
+}
+
+// NewStore creates a store serving base until a configuration is loaded
+func NewStore(base *OperatorConfig) *Store {
+	s := &Store{base: base}
+	s.current.Store(base)
+	return s
+}
+
+// Get returns the current configuration. A nil store returns the built-in configuration.
+func (s *Store) Get() *OperatorConfig {
+	if s == nil {
+		return Default()
+	}
+	return s.current.Load()
+}
+
+// Load parses the configuration of a ConfigMap over the base configuration and serves it. An
+// invalid configuration keeps the current one.
+func (s *Store) Load(configMap *corev1.ConfigMap) error {
+	cfg, err := Parse([]byte(configMap.Data[ConfigKey]), s.base)
+	if err != nil {
+		return fmt.Errorf("ConfigMap %s/%s: %w", configMap.Namespace, configMap.Name, err)
+	}
+	s.current.Store(cfg)
+	return nil
+}
+
+// Reset serves the base configuration again
+func (s *Store) Reset() {
+	s.current.Store(s.base)
+}
+
+// Watcher reloads the store whenever the operator ConfigMap changes. It watches the ConfigMap
+// directly instead of through the manager cache, which may not include the controller namespace.
+type Watcher struct {
+	Clientset kubernetes.Interface
+	Store     *Store
+
+	// Namespace and Name of the ConfigMap
+	Namespace string
+	Name      string
+}
+
+// LoadInitial reads the ConfigMap once, so the controllers start with its configuration. A
+// missing ConfigMap keeps the base configuration.
+func (w *Watcher) LoadInitial(ctx context.Context) error {
+	configMap, err := w.Clientset.CoreV1().ConfigMaps(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read ConfigMap %s/%s: %w", w.Namespace, w.Name, err)
+	}
+	return w.Store.Load(configMap)
+}
+
+// Start watches the ConfigMap until the context is cancelled. Deleting the ConfigMap restores
+// the base configuration.
+func (w *Watcher) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("operator-config")
+	log.Info("Watching operator config", "namespace", w.Namespace, "name", w.Name)
+
+	load := func(obj interface{}) {
+		configMap, ok := obj.(*corev1.ConfigMap)
+		if !ok {
+			return
+		}
+		if err := w.Store.Load(configMap); err != nil {
+			log.Error(err, "Keeping the previous operator config")
+			return
+		}
+		log.Info("Loaded operator config", "resourceVersion", configMap.ResourceVersion)
+	}
+	listWatch := cache.NewListWatchFromClient(w.Clientset.CoreV1().RESTClient(), "configmaps", w.Namespace,
+		fields.OneTermEqualSelector("metadata.name", w.Name))
+	_, informer := cache.NewInformer(listWatch, &corev1.ConfigMap{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc:    load,
+		UpdateFunc: func(_, obj interface{}) { load(obj) },
+		DeleteFunc: func(interface{}) {
+			log.Info("Operator config deleted, restoring the defaults")
+			w.Store.Reset()
+		},
+	})
+	informer.Run(ctx.Done())
+	return nil
+}
+
+// NeedLeaderElection loads the configuration on standby replicas too, so they take over with it
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/dream3d/torchrun-controller/internal/kai"
+)
+
+// leaderGauge is 1 while this replica holds the leader lease
+var leaderGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "torchrun_controller_leader",
+	Help: "Whether this replica holds the leader lease and runs the controllers (1) or stands by (0).",
+})
+
+func init() {
+	metrics.Registry.MustRegister(leaderGauge)
+}
+
+// HealthChecks verifies the APIs the controller depends on for the health probes
+type HealthChecks struct {
+	discovery discovery.DiscoveryInterface
+}
+
+// NewHealthChecks creates the health checks. The discovery client should time out well within
+// the probe timeout.
+func NewHealthChecks(discovery discovery.DiscoveryInterface) *HealthChecks {
+	return &HealthChecks{discovery: discovery}
+}
+
+// APIServer checks that the API server answers
+func (h *HealthChecks) APIServer(_ *http.Request) error {
+	if _, err := h.discovery.ServerVersion(); err != nil {
+		return fmt.Errorf("API server unreachable: %w", err)
+	}
+	return nil
+}
+
+// CRDs checks that the TorchrunJob and TorchrunQueue CRDs are installed and served
+func (h *HealthChecks) CRDs(_ *http.Request) error {
+	return h.checkResources("torchrun.ai/v1alpha1", "torchrunjobs", "torchrunqueues")
+}
+
+// KaiScheduler checks that the kai-scheduler Queue CRD is installed and served in any version
+func (h *HealthChecks) KaiScheduler(_ *http.Request) error {
+	groups, err := h.discovery.ServerGroups()
+	if err != nil {
+		return fmt.Errorf("failed to discover API groups: %w", err)
+	}
+	for _, group := range groups.Groups {
+		if group.Name != kai.Group {
+			continue
+		}
+		for _, version := range group.Versions {
+			if h.checkResources(version.GroupVersion, kai.QueueResource) == nil {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s is not served by %s", kai.QueueResource, kai.Group)
+}
+
+// checkResources checks that the group version serves all resources
+func (h *HealthChecks) checkResources(groupVersion string, resources ...string) error {
+	list, err := h.discovery.ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		return fmt.Errorf("failed to discover %s: %w", groupVersion, err)
+	}
+	for _, resource := range resources {
+		if !slices.ContainsFunc(list.APIResources, func(r metav1.APIResource) bool { return r.Name == resource }) {
+			return fmt.Errorf("%s is not served by %s", resource, groupVersion)
+		}
+	}
+	return nil
+}
+
+// LeaderStatus reports whether this replica holds the leader lease in the
+// torchrun_controller_leader metric. It runs on every replica, also the standby ones.
+type LeaderStatus struct {
+	elected <-chan struct{}
+}
+
+// NewLeaderStatus creates the leader status of the channel closed once this replica is elected
+func NewLeaderStatus(elected <-chan struct{}) *LeaderStatus {
+	return &LeaderStatus{elected: elected}
+}
+
+// Start sets the metric once this replica is elected and resets it on shutdown, when the lease
+// is released
+func (l *LeaderStatus) Start(ctx context.Context) error {
+	leaderGauge.Set(0)
+	select {
+	case <-l.elected:
+		log.FromContext(ctx).Info("Holding the leader lease")
+		leaderGauge.Set(1)
+	case <-ctx.Done():
+		return nil
+	}
+	<-ctx.Done()
+	leaderGauge.Set(0)
+	return nil
+}
+
+// NeedLeaderElection returns false so standby replicas report their status too
+func (l *LeaderStatus) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestHealthChecks(t *testing.T) {
+	torchrun := &metav1.APIResourceList{
+		GroupVersion: "torchrun.ai/v1alpha1",
+		APIResources: []metav1.APIResource{{Name: "torchrunjobs"}, {Name: "torchrunqueues"}},
+	}
+	kai := &metav1.APIResourceList{
+		GroupVersion: "scheduling.run.ai/v2",
+		APIResources: []metav1.APIResource{{Name: "queues"}},
+	}
+
+	tests := []struct {
+		description     string
+		resources       []*metav1.APIResourceList
+		expectCRDs      bool
+		expectScheduler bool
+	}{
+		{
+			description:     "all CRDs are served",
+			resources:       []*metav1.APIResourceList{torchrun, kai},
+			expectCRDs:      true,
+			expectScheduler: true,
+		},
+		{
+			description: "newer kai-scheduler version is served",
+			resources: []*metav1.APIResourceList{
+				torchrun,
+				{GroupVersion: "scheduling.run.ai/v3", APIResources: []metav1.APIResource{{Name: "queues"}}},
+			},
+			expectCRDs:      true,
+			expectScheduler: true,
+		},
+		{
+			description: "missing kai-scheduler fails its check only",
+			resources:   []*metav1.APIResourceList{torchrun},
+			expectCRDs:  true,
+		},
+		{
+			description: "partially installed CRDs fail",
+			resources: []*metav1.APIResourceList{
+				{GroupVersion: "torchrun.ai/v1alpha1", APIResources: []metav1.APIResource{{Name: "torchrunjobs"}}},
+				kai,
+			},
+			expectScheduler: true,
+		},
+	}
+
+	for _, test := range tests {
+		h := NewHealthChecks(&fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: test.resources}})
+		if err := h.APIServer(nil); err != nil {
+			t.Errorf("%s: expected API server check to pass, got %v", test.description, err)
+		}
+		if err := h.CRDs(nil); (err == nil) != test.expectCRDs {
+			t.Errorf("%s: expected CRD check passing %v, got %v", test.description, test.expectCRDs, err)
+		}
+		if err := h.KaiScheduler(nil); (err == nil) != test.expectScheduler {
+			t.Errorf("%s: expected kai-scheduler check passing %v, got %v", test.description, test.expectScheduler, err)
+		}
+	}
+}
+
+func TestLeaderStatus(t *testing.T) {
+	elected := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = NewLeaderStatus(elected).Start(ctx)
+	}()
+
+	// The gauge follows the lease: standby, elected, then released on shutdown
+	waitForGauge(t, 0)
+	close(elected)
+	waitForGauge(t, 1)
+	cancel()
+	<-done
+	if value := testutil.ToFloat64(leaderGauge); value != 0 {
+		t.Errorf("expected leader gauge 0 after shutdown, got %v", value)
+	}
+}
+
+func waitForGauge(t *testing.T, expected float64) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if testutil.ToFloat64(leaderGauge) == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected leader gauge %v, got %v", expected, testutil.ToFloat64(leaderGauge))
+}
@@ -0,0 +1,480 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+// AdmissionDecision is the outcome of checking a job against its queue limits
+type AdmissionDecision struct {
+	// Allowed is true when the job may proceed
+	Allowed bool
+
+	// Requeue is true when a rejected job may be admitted later (e.g. per-user limit)
+	Requeue bool
+
+	// Reason is a machine-readable reason for the decision
+	Reason string
+
+	// Message is a human-readable explanation of the decision
+	Message string
+}
+
+// AdmissionManager enforces TorchrunQueue admission limits on TorchrunJobs
+type AdmissionManager struct {
+	// apiReader counts active jobs uncached, so jobs admitted by a concurrent reconcile are seen
+	apiReader client.Reader
+
+	// schedulerName schedules the pods of queues and jobs that do not name a scheduler
+	schedulerName string
+}
+
+// NewAdmissionManager creates a new admission manager
+func NewAdmissionManager(apiReader client.Reader, schedulerName string) *AdmissionManager {
+	return &AdmissionManager{
+		apiReader:     apiReader,
+		schedulerName: schedulerName,
+	}
+}
+
+// Admit checks the job against the queue limits. Jobs with a priority the queue does not allow,
+// or exceeding the node or GPU limits, are rejected, jobs exceeding the per-user limit or from a
+// namespace without a queue binding are held for a later retry, and the active deadline is
+// clamped in place to the deadline and runtime limits of the queue. The limits are only checked
+// until the job has been admitted, and the deadline is never clamped below the one of the
+// existing batch Job of the job, so tightening the queue limits never fails jobs that are
+// already running.
+func (am *AdmissionManager) Admit(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, existing *batchv1.Job) (*AdmissionDecision, error) {
+	limits := jq.Spec.Limits
+
+	if !isConditionTrue(job, "Admitted") {
+		if decision, err := am.checkLimits(ctx, job, jq); err != nil || decision != nil {
+			return decision, err
+		}
+	}
+
+	// Clamp the active deadline. The clamped value is not persisted in the spec, so it is applied
+	// on every reconcile; a created batch Job keeps the deadline it was created with.
+	decision := &AdmissionDecision{
+		Allowed: true,
+		Reason:  "Admitted",
+		Message: fmt.Sprintf("Job admitted to queue %s", jq.Name),
+	}
+	var floor int64
+	if existing != nil && existing.Spec.ActiveDeadlineSeconds != nil {
+		floor = *existing.Spec.ActiveDeadlineSeconds
+	}
+	if max := limits.MaxActiveDeadlineSeconds; max != nil {
+		clamped := *max
+		if clamped < floor {
+			clamped = floor
+		}
+		deadline := job.Spec.Reliability.ActiveDeadlineSeconds
+		if deadline == nil || *deadline > clamped {
+			log.FromContext(ctx).Info("Clamping active deadline to queue limit", "name", job.Name, "maxActiveDeadlineSeconds", *max)
+			job.Spec.Reliability.ActiveDeadlineSeconds = &clamped
+			decision.Reason = "DeadlineClamped"
+			decision.Message = fmt.Sprintf("Job admitted to queue %s with activeDeadlineSeconds clamped to %d", jq.Name, clamped)
+		}
+	}
+
+	// The maximum runtime of the queue ends in the active deadline after its grace period
+	if max := getRuntimeLimitDeadline(limits); max != nil {
+		clamped := *max
+		if clamped < floor {
+			clamped = floor
+		}
+		deadline := job.Spec.Reliability.ActiveDeadlineSeconds
+		if deadline == nil || *deadline > clamped {
+			log.FromContext(ctx).Info("Clamping active deadline to queue runtime limit", "name", job.Name, "maxRuntimeSeconds", *limits.MaxRuntimeSeconds)
+			job.Spec.Reliability.ActiveDeadlineSeconds = &clamped
+			decision.Reason = "DeadlineClamped"
+			decision.Message = fmt.Sprintf("Job admitted to queue %s with activeDeadlineSeconds clamped to %d, its maximum runtime and grace period", jq.Name, clamped)
+		}
+	}
+
+	return decision, nil
+}
+
+// checkLimits returns a rejecting decision if the job exceeds the queue limits, or nil if it fits
+func (am *AdmissionManager) checkLimits(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*AdmissionDecision, error) {
+	limits := jq.Spec.Limits
+
+	// A queue being deleted only waits for the jobs it already admitted
+	if !jq.DeletionTimestamp.IsZero() {
+		return &AdmissionDecision{
+			Reason:  "QueueTerminating",
+			Message: fmt.Sprintf("TorchrunQueue %s/%s is being deleted and admits no new jobs", jq.Namespace, jq.Name),
+		}, nil
+	}
+
+	// Queue binding. A queue only accepts jobs from other namespaces that a binding grants access.
+	if job.Namespace != jq.Namespace {
+		bound, err := am.isBound(ctx, job, jq)
+		if err != nil {
+			return nil, err
+		}
+		if !bound {
+			return &AdmissionDecision{
+				Requeue: true,
+				Reason:  "QueueNotBound",
+				Message: fmt.Sprintf("no TorchrunQueueBinding in namespace %s grants namespace %s access to queue %s", jq.Namespace, job.Namespace, jq.Name),
+			}, nil
+		}
+	}
+
+	// The command may come from a template, so it can only be required once the template is merged.
+	// Notebook jobs only start training by hand, so they may leave it out.
+	if job.Spec.Command == "" && !isNotebookJob(job) {
+		return &AdmissionDecision{
+			Reason:  "MissingCommand",
+			Message: "job has no command and its template does not provide one",
+		}, nil
+	}
+
+	if decision, err := am.checkSpec(job, jq); err != nil || decision != nil {
+		return decision, err
+	}
+
+	// Per-user limit. Jobs without a user label would bypass the limit, so they are rejected.
+	if limits.MaxJobsPerUser > 0 {
+		user := job.Labels["torchrun.ai/user"]
+		if user == "" {
+			return &AdmissionDecision{
+				Reason:  "MissingUserLabel",
+				Message: fmt.Sprintf("queue %s limits active jobs per user; the torchrun.ai/user label is required", jq.Name),
+			}, nil
+		}
+		active, err := am.countActiveUserJobs(ctx, job, user)
+		if err != nil {
+			return nil, err
+		}
+		if active >= limits.MaxJobsPerUser {
+			return &AdmissionDecision{
+				Requeue: true,
+				Reason:  "MaxJobsPerUserExceeded",
+				Message: fmt.Sprintf("user %s already has %d active jobs in queue %s (limit %d)", user, active, jq.Name, limits.MaxJobsPerUser),
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// checkSpec returns a rejecting decision if the spec of the job does not fit the queue, or nil if
+// it does. Unlike the other limits it reads nothing from the cluster, so ValidateJob runs it too.
+func (am *AdmissionManager) checkSpec(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*AdmissionDecision, error) {
+	// Child queue. kai-scheduler only schedules pods in leaf queues, so a queue with children
+	// needs the job to pick one of them.
+	if children := jq.Spec.Queue.Children; job.Spec.ChildQueue == "" && len(children) > 0 {
+		return &AdmissionDecision{
+			Reason:  "MissingChildQueue",
+			Message: fmt.Sprintf("queue %s has child queues; the job must set childQueue (one of: %s)", jq.Name, strings.Join(getChildQueueNames(jq), ", ")),
+		}, nil
+	}
+	if job.Spec.ChildQueue != "" && !slices.Contains(getChildQueueNames(jq), job.Spec.ChildQueue) {
+		return &AdmissionDecision{
+			Reason:  "UnknownChildQueue",
+			Message: fmt.Sprintf("queue %s has no child queue %s", jq.Name, job.Spec.ChildQueue),
+		}, nil
+	}
+
+	// Profile. The worker shapes are defined by the queue.
+	if job.Spec.Profile != "" && !slices.Contains(getProfileNames(jq), job.Spec.Profile) {
+		return &AdmissionDecision{
+			Reason:  "UnknownProfile",
+			Message: fmt.Sprintf("queue %s has no profile %s (profiles: %s)", jq.Name, job.Spec.Profile, strings.Join(getProfileNames(jq), ", ")),
+		}, nil
+	}
+
+	// Capacity type. Spot and on-demand placement is defined by the queue.
+	if capacityType := job.Spec.CapacityType; jq.Spec.Capacity == nil &&
+		(capacityType == torchrunv1alpha1.CapacityTypeSpot || capacityType == torchrunv1alpha1.CapacityTypeOnDemand) {
+		return &AdmissionDecision{
+			Reason:  "CapacityNotConfigured",
+			Message: fmt.Sprintf("queue %s does not configure %s capacity", jq.Name, capacityType),
+		}, nil
+	}
+
+	// Experiment tracking. MLflow has no default server to create the run on.
+	if tracking := job.Spec.ExperimentTracking; tracking != nil && tracking.Provider == torchrunv1alpha1.TrackingProviderMLflow && tracking.URL == "" {
+		return &AdmissionDecision{
+			Reason:  "InvalidExperimentTracking",
+			Message: "experimentTracking.url is required for the mlflow provider",
+		}, nil
+	}
+
+	// GPU sharing. kai-scheduler takes either a fraction or an amount of GPU memory.
+	if job.Spec.GPUFraction != "" && job.Spec.GPUMemory > 0 {
+		return &AdmissionDecision{
+			Reason:  "InvalidGPUSharing",
+			Message: "gpuFraction and gpuMemory are mutually exclusive",
+		}, nil
+	}
+	if fraction := job.Spec.GPUFraction; fraction != "" {
+		if value, err := strconv.ParseFloat(fraction, 64); err != nil || value <= 0 || value >= 1 {
+			return &AdmissionDecision{
+				Reason:  "InvalidGPUSharing",
+				Message: fmt.Sprintf("gpuFraction %s must be between 0 and 1", fraction),
+			}, nil
+		}
+	}
+
+	// Direct workspace delivery mounts the workspace PVC into the workers of every node at once
+	if isDirectWorkspace(job, jq) && job.Spec.NumNodes > 1 {
+		modes := getWorkspaceAccessModes(job, jq)
+		if !slices.Contains(modes, corev1.ReadOnlyMany) && !slices.Contains(modes, corev1.ReadWriteMany) {
+			return &AdmissionDecision{
+				Reason:  "InvalidWorkspaceDelivery",
+				Message: fmt.Sprintf("direct workspace delivery to %d nodes needs a ReadOnlyMany or ReadWriteMany workspace PVC, got accessModes %v", job.Spec.NumNodes, modes),
+			}, nil
+		}
+	}
+
+	// Priority
+	if priority := getJobPriority(job, jq); priority != "" && len(jq.Spec.Priorities.Allowed) > 0 &&
+		!slices.Contains(jq.Spec.Priorities.Allowed, priority) {
+		return &AdmissionDecision{
+			Reason:  "PriorityNotAllowed",
+			Message: fmt.Sprintf("queue %s does not allow priority %s (allowed: %s)", jq.Name, priority, strings.Join(jq.Spec.Priorities.Allowed, ", ")),
+		}, nil
+	}
+
+	if decision, err := checkSize(job, jq); err != nil || decision != nil {
+		return decision, err
+	}
+	if decision, err := am.checkQueueQuota(job, jq); err != nil || decision != nil {
+		return decision, err
+	}
+
+	return nil, nil
+}
+
+// CheckResize checks a changed node count of an admitted job against the node and GPU limits
+// of the queue. It returns nil if the job was not resized or the new size fits; a rejected
+// resize keeps the existing Job.
+func (am *AdmissionManager) CheckResize(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*AdmissionDecision, error) {
+	if job.Status.NumNodes == 0 || job.Status.NumNodes == job.Spec.NumNodes {
+		return nil, nil
+	}
+	decision, err := checkSize(job, jq)
+	if err == nil && decision == nil {
+		decision, err = am.checkQueueQuota(job, jq)
+	}
+	if err != nil || decision == nil {
+		return nil, err
+	}
+	return &AdmissionDecision{
+		Reason:  "ResizeRejected",
+		Message: fmt.Sprintf("keeping %d nodes: %s", job.Status.NumNodes, decision.Message),
+	}, nil
+}
+
+// checkSize returns a rejecting decision if the job exceeds the node or GPU limits of the queue
+func checkSize(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*AdmissionDecision, error) {
+	limits := jq.Spec.Limits
+
+	// Debug and notebook jobs run one worker, a larger size would never be used
+	if isDebugJob(job) && job.Spec.NumNodes > 1 {
+		return &AdmissionDecision{
+			Reason:  "InvalidDebugJob",
+			Message: fmt.Sprintf("debug jobs run a single node, got numNodes %d", job.Spec.NumNodes),
+		}, nil
+	}
+	if isNotebookJob(job) && job.Spec.NumNodes > 1 {
+		return &AdmissionDecision{
+			Reason:  "InvalidNotebookJob",
+			Message: fmt.Sprintf("notebook jobs run a single node, got numNodes %d", job.Spec.NumNodes),
+		}, nil
+	}
+
+	// Node limit
+	if limits.MaxNodesPerJob > 0 && job.Spec.NumNodes > limits.MaxNodesPerJob {
+		return &AdmissionDecision{
+			Reason:  "MaxNodesExceeded",
+			Message: fmt.Sprintf("job requests %d nodes but queue %s allows at most %d", job.Spec.NumNodes, jq.Name, limits.MaxNodesPerJob),
+		}, nil
+	}
+
+	// GPU limit, computed from the trainer container of the queue pod template as patched by the job
+	if limits.MaxGPUsPerJob > 0 && jq.Spec.PodTemplateConfig.Spec.Raw != nil {
+		gpus, err := getJobGPUs(job, jq)
+		if err != nil {
+			return nil, err
+		}
+		if gpus > limits.MaxGPUsPerJob {
+			return &AdmissionDecision{
+				Reason:  "MaxGPUsExceeded",
+				Message: fmt.Sprintf("job requests %d GPUs but queue %s allows at most %d", gpus, jq.Name, limits.MaxGPUsPerJob),
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// checkQueueQuota returns a rejecting decision if the workers of the job request more than the
+// kai-scheduler queue of the job can ever give them: more than its limit, or for jobs that
+// cannot be preempted, more than its quota. Such jobs would stay unschedulable forever.
+// Preemptible jobs may use resources over the quota while other queues leave them unused.
+// Unlimited and zero quotas and limits are left to the scheduler.
+func (am *AdmissionManager) checkQueueQuota(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*AdmissionDecision, error) {
+	if getSchedulerName(job, jq, am.schedulerName) != config.KaiSchedulerName || jq.Spec.PodTemplateConfig.Spec.Raw == nil {
+		return nil, nil
+	}
+	podSpec, err := getPodSpec(job, jq)
+	if err != nil {
+		return nil, err
+	}
+	requests := getPodSpecRequests(&podSpec)
+	cpu := requests[corev1.ResourceCPU]
+	memory := requests[corev1.ResourceMemory]
+	gpu := requests[gpuResourceName]
+	// Each worker on a shared GPU holds part of one GPU
+	gpus := int(gpu.Value())
+	if sharesGPU(job) {
+		gpus = 1
+	}
+
+	// Requests in the units of the kai-scheduler quota: CPU in millicores, memory in megabytes
+	resources := getKaiQueueResources(job, jq)
+	nonPreemptible := slices.Contains([]string{"build", "inference"}, getPriorityClassName(job, jq))
+	checks := []struct {
+		name    string
+		perNode int
+		config  torchrunv1alpha1.ResourceConfig
+	}{
+		{"cpu", int(cpu.MilliValue()), resources.CPU},
+		{"gpu", gpus, resources.GPU},
+		{"memory", int(memory.Value() / 1000 / 1000), resources.Memory},
+	}
+
+	var limitExceeded, quotaExceeded []string
+	for _, check := range checks {
+		total := check.perNode * job.Spec.NumNodes
+		requested := fmt.Sprintf("%s %d (%d per node x %d nodes)", check.name, total, check.perNode, job.Spec.NumNodes)
+		switch {
+		case check.config.Limit > 0 && total > check.config.Limit:
+			limitExceeded = append(limitExceeded, fmt.Sprintf("%s exceeds the limit of %d", requested, check.config.Limit))
+		case nonPreemptible && check.config.Quota > 0 && total > check.config.Quota:
+			quotaExceeded = append(quotaExceeded, fmt.Sprintf("%s exceeds the quota of %d", requested, check.config.Quota))
+		}
+	}
+	queue := getKaiQueueName(job, jq)
+	if len(limitExceeded) > 0 {
+		return &AdmissionDecision{
+			Reason:  "QueueLimitExceeded",
+			Message: fmt.Sprintf("job can never be scheduled in kai-scheduler queue %s: %s", queue, strings.Join(append(limitExceeded, quotaExceeded...), "; ")),
+		}, nil
+	}
+	if len(quotaExceeded) > 0 {
+		return &AdmissionDecision{
+			Reason: "QueueQuotaExceeded",
+			Message: fmt.Sprintf("non-preemptible job can never be scheduled in kai-scheduler queue %s: %s; use the preemptible priority to run over quota",
+				queue, strings.Join(quotaExceeded, "; ")),
+		}, nil
+	}
+	return nil, nil
+}
+
+// getPodSpecRequests returns the effective resource requests of a pod spec: the containers plus
+// the sidecars, or the largest init container if that is more, plus the pod overhead
+func getPodSpecRequests(podSpec *corev1.PodSpec) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	add := func(list corev1.ResourceList) {
+		for name, quantity := range list {
+			total := requests[name]
+			total.Add(quantity)
+			requests[name] = total
+		}
+	}
+
+	for _, container := range podSpec.Containers {
+		add(container.Resources.Requests)
+	}
+	for _, container := range podSpec.InitContainers {
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			add(container.Resources.Requests)
+		}
+	}
+	for _, container := range podSpec.InitContainers {
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			continue
+		}
+		for name, quantity := range container.Resources.Requests {
+			if total := requests[name]; quantity.Cmp(total) > 0 {
+				requests[name] = quantity
+			}
+		}
+	}
+	add(podSpec.Overhead)
+	return requests
+}
+
+// getJobGPUs returns the GPUs of all workers of the job, computed from the trainer container of
+// the queue pod template as patched by the job
+func getJobGPUs(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (int, error) {
+	// Each worker on a shared GPU holds part of one GPU
+	if sharesGPU(job) {
+		return job.Spec.NumNodes, nil
+	}
+	if jq.Spec.PodTemplateConfig.Spec.Raw == nil {
+		return 0, nil
+	}
+	podSpec, err := getPodSpec(job, jq)
+	if err != nil {
+		return 0, err
+	}
+	return getTrainerGPUs(&podSpec) * job.Spec.NumNodes, nil
+}
+
+// isBound returns true if a TorchrunQueueBinding in the namespace of the queue grants the
+// namespace of the job access to the queue
+func (am *AdmissionManager) isBound(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (bool, error) {
+	bindings := &torchrunv1alpha1.TorchrunQueueBindingList{}
+	if err := am.apiReader.List(ctx, bindings, client.InNamespace(jq.Namespace)); err != nil {
+		return false, fmt.Errorf("failed to list queue bindings in namespace %s: %w", jq.Namespace, err)
+	}
+	for _, binding := range bindings.Items {
+		if binding.Spec.Queue == jq.Name && slices.Contains(binding.Spec.Namespaces, job.Namespace) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// countActiveUserJobs counts the admitted, non-terminal jobs of a user in the same queue, across
+// all namespaces bound to the queue
+func (am *AdmissionManager) countActiveUserJobs(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, user string) (int, error) {
+	jobs := &torchrunv1alpha1.TorchrunJobList{}
+	if err := am.apiReader.List(ctx, jobs,
+		client.MatchingLabels{"torchrun.ai/user": user},
+	); err != nil {
+		return 0, fmt.Errorf("failed to list jobs for user %s: %w", user, err)
+	}
+
+	active := 0
+	for i := range jobs.Items {
+		other := &jobs.Items[i]
+		if other.UID == job.UID || other.Spec.Queue != job.Spec.Queue || getQueueNamespace(other) != getQueueNamespace(job) {
+			continue
+		}
+		if isTerminalPhase(other.Status.Phase) || !isConditionTrue(other, "Admitted") {
+			continue
+		}
+		active++
+	}
+
+	return active, nil
+}
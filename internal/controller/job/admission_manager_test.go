@@ -0,0 +1,944 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestAdmit(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	maxDeadline := int64(3600)
+	longDeadline := int64(7200)
+
+	// An already admitted job for user alice in the same queue
+	running := &torchrunv1alpha1.TorchrunJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "running",
+			Namespace: "default",
+			UID:       "running-uid",
+			Labels:    map[string]string{"torchrun.ai/user": "alice"},
+		},
+		Spec: torchrunv1alpha1.TorchrunJobSpec{Queue: "dev"},
+		Status: torchrunv1alpha1.TorchrunJobStatus{
+			Phase:      torchrunv1alpha1.PhaseRunning,
+			Conditions: []torchrunv1alpha1.TorchrunJobCondition{{Type: "Admitted", Status: "True"}},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(running).Build()
+	am := NewAdmissionManager(client, config.KaiSchedulerName)
+
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+				Spec: runtime.RawExtension{
+					Raw: []byte(`{"containers":[{"name":"trainer","resources":{"requests":{"nvidia.com/gpu":"8"}}}]}`),
+				},
+			},
+			Limits: torchrunv1alpha1.QueueLimits{
+				MaxNodesPerJob:           4,
+				MaxGPUsPerJob:            16,
+				MaxActiveDeadlineSeconds: &maxDeadline,
+				MaxJobsPerUser:           1,
+			},
+			Priorities: torchrunv1alpha1.QueuePriorityConfig{
+				Allowed: []string{torchrunv1alpha1.PriorityPreemptible, torchrunv1alpha1.PriorityNormal},
+				Default: torchrunv1alpha1.PriorityPreemptible,
+			},
+			Profiles: []torchrunv1alpha1.JobProfile{{
+				Name:      "1xgpu",
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")}},
+			}},
+		},
+	}
+
+	tests := []struct {
+		description    string
+		numNodes       int
+		profile        string
+		noCommand      bool
+		user           string
+		priority       string
+		capacityType   string
+		tracking       *torchrunv1alpha1.ExperimentTrackingConfig
+		gpuFraction    string
+		gpuMemory      int32
+		podPatch       *torchrunv1alpha1.PodTemplatePatch
+		mode           string
+		admitted       bool
+		deadline       *int64
+		expectAllowed  bool
+		expectRequeue  bool
+		expectReason   string
+		expectDeadline int64
+	}{
+		{
+			description:    "job within limits is admitted with clamped deadline",
+			numNodes:       2,
+			user:           "bob",
+			expectAllowed:  true,
+			expectReason:   "DeadlineClamped",
+			expectDeadline: maxDeadline,
+		},
+		{
+			description:    "longer deadline is clamped",
+			numNodes:       1,
+			user:           "bob",
+			deadline:       &longDeadline,
+			expectAllowed:  true,
+			expectReason:   "DeadlineClamped",
+			expectDeadline: maxDeadline,
+		},
+		{
+			description:    "allowed priority is admitted",
+			numNodes:       1,
+			user:           "bob",
+			priority:       torchrunv1alpha1.PriorityNormal,
+			expectAllowed:  true,
+			expectReason:   "DeadlineClamped",
+			expectDeadline: maxDeadline,
+		},
+		{
+			description:  "priority not allowed by the queue is rejected",
+			numNodes:     1,
+			user:         "bob",
+			priority:     torchrunv1alpha1.PriorityHigh,
+			expectReason: "PriorityNotAllowed",
+		},
+		{
+			description:    "any capacity needs no queue placement",
+			numNodes:       1,
+			user:           "bob",
+			capacityType:   torchrunv1alpha1.CapacityTypeAny,
+			expectAllowed:  true,
+			expectReason:   "DeadlineClamped",
+			expectDeadline: maxDeadline,
+		},
+		{
+			description:  "spot capacity without queue placement is rejected",
+			numNodes:     1,
+			user:         "bob",
+			capacityType: torchrunv1alpha1.CapacityTypeSpot,
+			expectReason: "CapacityNotConfigured",
+		},
+		{
+			description:  "MLflow tracking without server is rejected",
+			numNodes:     1,
+			user:         "bob",
+			tracking:     &torchrunv1alpha1.ExperimentTrackingConfig{Provider: "mlflow", Project: "vision"},
+			expectReason: "InvalidExperimentTracking",
+		},
+		{
+			description:  "GPU fraction and memory together are rejected",
+			numNodes:     1,
+			user:         "bob",
+			gpuFraction:  "0.5",
+			gpuMemory:    2000,
+			expectReason: "InvalidGPUSharing",
+		},
+		{
+			description:  "GPU fraction of a whole GPU is rejected",
+			numNodes:     1,
+			user:         "bob",
+			gpuFraction:  ".0",
+			expectReason: "InvalidGPUSharing",
+		},
+		{
+			description:    "workers sharing GPUs count one GPU each against the limit",
+			numNodes:       3,
+			user:           "bob",
+			gpuFraction:    "0.25",
+			expectAllowed:  true,
+			expectReason:   "DeadlineClamped",
+			expectDeadline: maxDeadline,
+		},
+		{
+			description:  "debug job on several nodes is rejected",
+			numNodes:     2,
+			user:         "bob",
+			mode:         torchrunv1alpha1.ModeDebug,
+			expectReason: "InvalidDebugJob",
+		},
+		{
+			description:  "notebook job on several nodes is rejected",
+			numNodes:     2,
+			user:         "bob",
+			mode:         torchrunv1alpha1.ModeNotebook,
+			expectReason: "InvalidNotebookJob",
+		},
+		{
+			description:  "too many nodes is rejected",
+			numNodes:     5,
+			user:         "bob",
+			expectReason: "MaxNodesExceeded",
+		},
+		{
+			description:  "too many GPUs is rejected",
+			numNodes:     3,
+			user:         "bob",
+			expectReason: "MaxGPUsExceeded",
+		},
+		{
+			description: "GPUs added by the pod template patch count towards the limit",
+			numNodes:    2,
+			user:        "bob",
+			podPatch: &torchrunv1alpha1.PodTemplatePatch{StrategicMerge: &runtime.RawExtension{
+				Raw: []byte(`{"containers":[{"name":"trainer","resources":{"requests":{"nvidia.com/gpu":"16"}}}]}`),
+			}},
+			expectReason: "MaxGPUsExceeded",
+		},
+		{
+			description:   "user over job limit is requeued",
+			numNodes:      1,
+			user:          "alice",
+			expectRequeue: true,
+			expectReason:  "MaxJobsPerUserExceeded",
+		},
+		{
+			description:  "job without user label is rejected",
+			numNodes:     1,
+			expectReason: "MissingUserLabel",
+		},
+		{
+			description:  "job without command is rejected",
+			numNodes:     1,
+			noCommand:    true,
+			user:         "bob",
+			expectReason: "MissingCommand",
+		},
+		{
+			description:    "notebook job without command is admitted",
+			numNodes:       1,
+			noCommand:      true,
+			user:           "bob",
+			mode:           torchrunv1alpha1.ModeNotebook,
+			expectAllowed:  true,
+			expectReason:   "DeadlineClamped",
+			expectDeadline: maxDeadline,
+		},
+		{
+			description:    "profile GPUs count against the GPU limit",
+			numNodes:       4,
+			user:           "bob",
+			profile:        "1xgpu",
+			expectAllowed:  true,
+			expectReason:   "DeadlineClamped",
+			expectDeadline: maxDeadline,
+		},
+		{
+			description:  "unknown profile is rejected",
+			numNodes:     1,
+			user:         "bob",
+			profile:      "8xgpu",
+			expectReason: "UnknownProfile",
+		},
+		{
+			description:    "admitted job is not rechecked after limits are lowered",
+			numNodes:       5,
+			admitted:       true,
+			expectAllowed:  true,
+			expectReason:   "DeadlineClamped",
+			expectDeadline: maxDeadline,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "default", UID: "new-uid"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:              "dev",
+				Command:            "python train.py",
+				NumNodes:           test.numNodes,
+				Priority:           test.priority,
+				CapacityType:       test.capacityType,
+				ExperimentTracking: test.tracking,
+				GPUFraction:        test.gpuFraction,
+				GPUMemory:          test.gpuMemory,
+				PodTemplatePatch:   test.podPatch,
+				Mode:               test.mode,
+				Profile:            test.profile,
+				Reliability:        torchrunv1alpha1.ReliabilityConfig{ActiveDeadlineSeconds: test.deadline},
+			},
+		}
+		if test.noCommand {
+			job.Spec.Command = ""
+		}
+		if test.user != "" {
+			job.Labels = map[string]string{"torchrun.ai/user": test.user}
+		}
+		if test.admitted {
+			job.Status.Conditions = []torchrunv1alpha1.TorchrunJobCondition{{Type: "Admitted", Status: "True"}}
+		}
+
+		decision, err := am.Admit(context.Background(), job, jq, nil)
+		if err != nil {
+			t.Fatalf("%s: Admit failed: %v", test.description, err)
+		}
+		if decision.Allowed != test.expectAllowed || decision.Requeue != test.expectRequeue || decision.Reason != test.expectReason {
+			t.Errorf("%s: got allowed=%v requeue=%v reason=%s", test.description, decision.Allowed, decision.Requeue, decision.Reason)
+		}
+		if test.expectAllowed && *job.Spec.Reliability.ActiveDeadlineSeconds != test.expectDeadline {
+			t.Errorf("%s: expected deadline %d, got %d", test.description, test.expectDeadline, *job.Spec.Reliability.ActiveDeadlineSeconds)
+		}
+	}
+}
+
+func TestAdmitChildQueue(t *testing.T) {
+	am := NewAdmissionManager(fake.NewClientBuilder().Build(), config.KaiSchedulerName)
+	hierarchy := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue: torchrunv1alpha1.QueueConfig{
+				Name:     "research",
+				Children: []torchrunv1alpha1.ChildQueueConfig{{Name: "research-vision"}, {Name: "research-nlp"}},
+			},
+		},
+	}
+	flat := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+		Spec:       torchrunv1alpha1.JobQueueSpec{Queue: torchrunv1alpha1.QueueConfig{Name: "dev"}},
+	}
+
+	tests := []struct {
+		description   string
+		jq            *torchrunv1alpha1.TorchrunQueue
+		childQueue    string
+		expectAllowed bool
+		expectReason  string
+	}{
+		{
+			description:   "job in a child queue is admitted",
+			jq:            hierarchy,
+			childQueue:    "research-nlp",
+			expectAllowed: true,
+			expectReason:  "Admitted",
+		},
+		{
+			description:  "job without child queue is rejected by a queue with children",
+			jq:           hierarchy,
+			expectReason: "MissingChildQueue",
+		},
+		{
+			description:  "unknown child queue is rejected",
+			jq:           hierarchy,
+			childQueue:   "research-audio",
+			expectReason: "UnknownChildQueue",
+		},
+		{
+			description:  "child queue is rejected by a queue without children",
+			jq:           flat,
+			childQueue:   "research-nlp",
+			expectReason: "UnknownChildQueue",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "default"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{Queue: test.jq.Name, Command: "python train.py", NumNodes: 1, ChildQueue: test.childQueue},
+		}
+
+		decision, err := am.Admit(context.Background(), job, test.jq, nil)
+		if err != nil {
+			t.Fatalf("%s: Admit failed: %v", test.description, err)
+		}
+		if decision.Allowed != test.expectAllowed || decision.Reason != test.expectReason {
+			t.Errorf("%s: got allowed=%v reason=%s", test.description, decision.Allowed, decision.Reason)
+		}
+	}
+}
+
+func TestAdmitTerminatingQueue(t *testing.T) {
+	am := NewAdmissionManager(fake.NewClientBuilder().Build(), config.KaiSchedulerName)
+	deleted := metav1.Now()
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default", DeletionTimestamp: &deleted, Finalizers: []string{"torchrun.ai/queue-protection"}},
+		Spec:       torchrunv1alpha1.JobQueueSpec{Queue: torchrunv1alpha1.QueueConfig{Name: "dev"}},
+	}
+
+	tests := []struct {
+		description   string
+		admitted      bool
+		expectAllowed bool
+		expectReason  string
+	}{
+		{
+			description:  "new job is rejected by a queue being deleted",
+			expectReason: "QueueTerminating",
+		},
+		{
+			description:   "admitted job keeps running in a queue being deleted",
+			admitted:      true,
+			expectAllowed: true,
+			expectReason:  "Admitted",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "default"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", Command: "python train.py", NumNodes: 1},
+		}
+		if test.admitted {
+			job.Status.Conditions = []torchrunv1alpha1.TorchrunJobCondition{{Type: "Admitted", Status: "True"}}
+		}
+
+		decision, err := am.Admit(context.Background(), job, jq, nil)
+		if err != nil {
+			t.Fatalf("%s: Admit failed: %v", test.description, err)
+		}
+		if decision.Allowed != test.expectAllowed || decision.Requeue || decision.Reason != test.expectReason {
+			t.Errorf("%s: got allowed=%v requeue=%v reason=%s", test.description, decision.Allowed, decision.Requeue, decision.Reason)
+		}
+	}
+}
+
+func TestAdmitRuntimeLimit(t *testing.T) {
+	am := NewAdmissionManager(fake.NewClientBuilder().Build(), config.KaiSchedulerName)
+	maxRuntime := int64(3600)
+	maxDeadline := int64(7200)
+	shortDeadline := int64(1800)
+	longDeadline := int64(86400)
+
+	tests := []struct {
+		description    string
+		limits         torchrunv1alpha1.QueueLimits
+		deadline       *int64
+		expectReason   string
+		expectDeadline int64
+	}{
+		{
+			description:    "job without a deadline gets the maximum runtime and default grace period",
+			limits:         torchrunv1alpha1.QueueLimits{MaxRuntimeSeconds: &maxRuntime},
+			expectReason:   "DeadlineClamped",
+			expectDeadline: 4200,
+		},
+		{
+			description:    "longer deadline is clamped to the maximum runtime and grace period",
+			limits:         torchrunv1alpha1.QueueLimits{MaxRuntimeSeconds: &maxRuntime, RuntimeGracePeriodSeconds: 300},
+			deadline:       &longDeadline,
+			expectReason:   "DeadlineClamped",
+			expectDeadline: 3900,
+		},
+		{
+			description:    "shorter deadline is kept",
+			limits:         torchrunv1alpha1.QueueLimits{MaxRuntimeSeconds: &maxRuntime},
+			deadline:       &shortDeadline,
+			expectReason:   "Admitted",
+			expectDeadline: 1800,
+		},
+		{
+			description:    "maximum active deadline of the queue below the runtime limit is kept",
+			limits:         torchrunv1alpha1.QueueLimits{MaxRuntimeSeconds: &maxDeadline, MaxActiveDeadlineSeconds: &maxRuntime},
+			expectReason:   "DeadlineClamped",
+			expectDeadline: 3600,
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+			Spec:       torchrunv1alpha1.JobQueueSpec{Queue: torchrunv1alpha1.QueueConfig{Name: "dev"}, Limits: test.limits},
+		}
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "default"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:       "dev",
+				Command:     "python train.py",
+				NumNodes:    1,
+				Reliability: torchrunv1alpha1.ReliabilityConfig{ActiveDeadlineSeconds: test.deadline},
+			},
+		}
+
+		decision, err := am.Admit(context.Background(), job, jq, nil)
+		if err != nil {
+			t.Fatalf("%s: Admit failed: %v", test.description, err)
+		}
+		if !decision.Allowed || decision.Reason != test.expectReason {
+			t.Errorf("%s: got allowed=%v reason=%s", test.description, decision.Allowed, decision.Reason)
+		}
+		if deadline := job.Spec.Reliability.ActiveDeadlineSeconds; deadline == nil || *deadline != test.expectDeadline {
+			t.Errorf("%s: expected deadline %d, got %v", test.description, test.expectDeadline, deadline)
+		}
+	}
+}
+
+func TestAdmitTightenedLimits(t *testing.T) {
+	am := NewAdmissionManager(fake.NewClientBuilder().Build(), config.KaiSchedulerName)
+	maxDeadline := int64(3600)
+	runningDeadline := int64(7200)
+	longDeadline := int64(86400)
+	// The queue limits were lowered after the batch Job was created with a deadline of 2h
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue:  torchrunv1alpha1.QueueConfig{Name: "dev"},
+			Limits: torchrunv1alpha1.QueueLimits{MaxActiveDeadlineSeconds: &maxDeadline},
+		},
+	}
+	running := &batchv1.Job{Spec: batchv1.JobSpec{ActiveDeadlineSeconds: &runningDeadline}}
+
+	tests := []struct {
+		description    string
+		deadline       *int64
+		existing       *batchv1.Job
+		expectDeadline int64
+	}{
+		{
+			description:    "running job keeps the deadline of its batch Job",
+			existing:       running,
+			expectDeadline: 7200,
+		},
+		{
+			description:    "running job cannot extend its deadline past the one of its batch Job",
+			deadline:       &longDeadline,
+			existing:       running,
+			expectDeadline: 7200,
+		},
+		{
+			description:    "job without a batch Job gets the lowered limit",
+			expectDeadline: 3600,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:       "dev",
+				Command:     "python train.py",
+				NumNodes:    1,
+				Reliability: torchrunv1alpha1.ReliabilityConfig{ActiveDeadlineSeconds: test.deadline},
+			},
+			Status: torchrunv1alpha1.TorchrunJobStatus{Conditions: []torchrunv1alpha1.TorchrunJobCondition{{Type: "Admitted", Status: "True"}}},
+		}
+
+		decision, err := am.Admit(context.Background(), job, jq, test.existing)
+		if err != nil {
+			t.Fatalf("%s: Admit failed: %v", test.description, err)
+		}
+		if !decision.Allowed {
+			t.Errorf("%s: expected the job to stay admitted, got reason %s", test.description, decision.Reason)
+		}
+		if deadline := job.Spec.Reliability.ActiveDeadlineSeconds; deadline == nil || *deadline != test.expectDeadline {
+			t.Errorf("%s: expected deadline %d, got %v", test.description, test.expectDeadline, deadline)
+		}
+	}
+}
+
+func TestAdmitDirectWorkspace(t *testing.T) {
+	am := NewAdmissionManager(fake.NewClientBuilder().Build(), config.KaiSchedulerName)
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue:            torchrunv1alpha1.QueueConfig{Name: "dev"},
+			WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{DeliveryMode: torchrunv1alpha1.WorkspaceDeliveryDirect},
+		},
+	}
+
+	tests := []struct {
+		description   string
+		numNodes      int
+		accessModes   []corev1.PersistentVolumeAccessMode
+		expectAllowed bool
+		expectReason  string
+	}{
+		{
+			description:   "default access modes are read by every node",
+			numNodes:      4,
+			expectAllowed: true,
+			expectReason:  "Admitted",
+		},
+		{
+			description:   "single node reads a ReadWriteOnce PVC",
+			numNodes:      1,
+			accessModes:   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			expectAllowed: true,
+			expectReason:  "Admitted",
+		},
+		{
+			description:  "several nodes cannot mount a ReadWriteOnce PVC",
+			numNodes:     4,
+			accessModes:  []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			expectReason: "InvalidWorkspaceDelivery",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "default"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:            "dev",
+				Command:          "python train.py",
+				NumNodes:         test.numNodes,
+				WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{AccessModes: test.accessModes},
+			},
+		}
+
+		decision, err := am.Admit(context.Background(), job, jq, nil)
+		if err != nil {
+			t.Fatalf("%s: Admit failed: %v", test.description, err)
+		}
+		if decision.Allowed != test.expectAllowed || decision.Reason != test.expectReason {
+			t.Errorf("%s: got allowed=%v reason=%s", test.description, decision.Allowed, decision.Reason)
+		}
+	}
+}
+
+func TestAdmitQueueBinding(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	jq := &torchrunv1alpha1.TorchrunQueue{ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "ml-platform"}}
+	binding := &torchrunv1alpha1.TorchrunQueueBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "research-teams", Namespace: "ml-platform"},
+		Spec:       torchrunv1alpha1.TorchrunQueueBindingSpec{Queue: "research", Namespaces: []string{"team-vision"}},
+	}
+	otherQueue := &torchrunv1alpha1.TorchrunQueueBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev-teams", Namespace: "ml-platform"},
+		Spec:       torchrunv1alpha1.TorchrunQueueBindingSpec{Queue: "dev", Namespaces: []string{"team-nlp"}},
+	}
+	otherNamespace := &torchrunv1alpha1.TorchrunQueueBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "research-teams", Namespace: "team-nlp"},
+		Spec:       torchrunv1alpha1.TorchrunQueueBindingSpec{Queue: "research", Namespaces: []string{"team-nlp"}},
+	}
+	am := NewAdmissionManager(fake.NewClientBuilder().WithScheme(scheme).WithObjects(binding, otherQueue, otherNamespace).Build(), config.KaiSchedulerName)
+
+	tests := []struct {
+		description   string
+		namespace     string
+		expectAllowed bool
+		expectReason  string
+	}{
+		{
+			description:   "job in the queue namespace needs no binding",
+			namespace:     "ml-platform",
+			expectAllowed: true,
+			expectReason:  "Admitted",
+		},
+		{
+			description:   "job in a bound namespace is admitted",
+			namespace:     "team-vision",
+			expectAllowed: true,
+			expectReason:  "Admitted",
+		},
+		{
+			description:  "job bound to another queue or by a binding outside the queue namespace is held",
+			namespace:    "team-nlp",
+			expectReason: "QueueNotBound",
+		},
+		{
+			description:  "job in an unbound namespace is held",
+			namespace:    "team-audio",
+			expectReason: "QueueNotBound",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: test.namespace},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{Queue: "research", QueueNamespace: "ml-platform", Command: "python train.py", NumNodes: 1},
+		}
+
+		decision, err := am.Admit(context.Background(), job, jq, nil)
+		if err != nil {
+			t.Fatalf("%s: Admit failed: %v", test.description, err)
+		}
+		if decision.Allowed != test.expectAllowed || decision.Reason != test.expectReason {
+			t.Errorf("%s: got allowed=%v reason=%s", test.description, decision.Allowed, decision.Reason)
+		}
+		if !decision.Allowed && !decision.Requeue {
+			t.Errorf("%s: expected an unbound job to be requeued", test.description)
+		}
+	}
+}
+
+func TestCheckResize(t *testing.T) {
+	am := NewAdmissionManager(fake.NewClientBuilder().Build(), config.KaiSchedulerName)
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+				Spec: runtime.RawExtension{
+					Raw: []byte(`{"containers":[{"name":"trainer","resources":{"requests":{"nvidia.com/gpu":"8"}}}]}`),
+				},
+			},
+			Limits: torchrunv1alpha1.QueueLimits{MaxNodesPerJob: 8, MaxGPUsPerJob: 32},
+		},
+	}
+
+	tests := []struct {
+		description  string
+		numNodes     int
+		jobNodes     int
+		expectReason string
+	}{
+		{description: "job without a Kubernetes Job", numNodes: 16},
+		{description: "unchanged node count", numNodes: 2, jobNodes: 2},
+		{description: "resize within the limits", numNodes: 4, jobNodes: 2},
+		{description: "resize above the node limit", numNodes: 16, jobNodes: 2, expectReason: "ResizeRejected"},
+		{description: "resize above the GPU limit", numNodes: 6, jobNodes: 2, expectReason: "ResizeRejected"},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", NumNodes: test.numNodes},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{NumNodes: test.jobNodes},
+		}
+		decision, err := am.CheckResize(job, jq)
+		if err != nil {
+			t.Fatalf("%s: CheckResize() error = %v", test.description, err)
+		}
+		if test.expectReason == "" && decision != nil {
+			t.Errorf("%s: expected the resize to be allowed, got %+v", test.description, decision)
+		}
+		if test.expectReason != "" && (decision == nil || decision.Reason != test.expectReason) {
+			t.Errorf("%s: expected reason %s, got %+v", test.description, test.expectReason, decision)
+		}
+	}
+}
+
+func TestCheckQueueQuota(t *testing.T) {
+	am := NewAdmissionManager(fake.NewClientBuilder().Build(), config.KaiSchedulerName)
+	newQueue := func(resources torchrunv1alpha1.QueueResources) *torchrunv1alpha1.TorchrunQueue {
+		return &torchrunv1alpha1.TorchrunQueue{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+			Spec: torchrunv1alpha1.JobQueueSpec{
+				PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+					Spec: runtime.RawExtension{
+						Raw: []byte(`{"containers":[{"name":"trainer","resources":{"requests":{"cpu":"32","memory":"256G","nvidia.com/gpu":"8"}}}]}`),
+					},
+				},
+				Queue: torchrunv1alpha1.QueueConfig{
+					Name:      "dev",
+					Resources: resources,
+					Children: []torchrunv1alpha1.ChildQueueConfig{{
+						Name:      "dev-small",
+						Resources: torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: 8, Limit: 8}},
+					}},
+				},
+			},
+		}
+	}
+	unlimited := torchrunv1alpha1.ResourceConfig{Quota: -1, Limit: -1}
+
+	tests := []struct {
+		description   string
+		resources     torchrunv1alpha1.QueueResources
+		spec          torchrunv1alpha1.TorchrunJobSpec
+		expectReason  string
+		expectMessage string
+	}{
+		{
+			description: "unlimited queue",
+			resources:   torchrunv1alpha1.QueueResources{CPU: unlimited, GPU: unlimited, Memory: unlimited},
+			spec:        torchrunv1alpha1.TorchrunJobSpec{NumNodes: 16},
+		},
+		{
+			description: "job within the limit",
+			resources:   torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: -1, Limit: 16}},
+			spec:        torchrunv1alpha1.TorchrunJobSpec{NumNodes: 2},
+		},
+		{
+			description:   "job above the GPU limit",
+			resources:     torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: -1, Limit: 16}},
+			spec:          torchrunv1alpha1.TorchrunJobSpec{NumNodes: 4},
+			expectReason:  "QueueLimitExceeded",
+			expectMessage: "job can never be scheduled in kai-scheduler queue dev: gpu 32 (8 per node x 4 nodes) exceeds the limit of 16",
+		},
+		{
+			description: "job above several limits",
+			resources: torchrunv1alpha1.QueueResources{
+				CPU:    torchrunv1alpha1.ResourceConfig{Quota: -1, Limit: 64000},
+				Memory: torchrunv1alpha1.ResourceConfig{Quota: -1, Limit: 512000},
+			},
+			spec:         torchrunv1alpha1.TorchrunJobSpec{NumNodes: 4},
+			expectReason: "QueueLimitExceeded",
+			expectMessage: "job can never be scheduled in kai-scheduler queue dev: cpu 128000 (32000 per node x 4 nodes) exceeds the limit of 64000; " +
+				"memory 1024000 (256000 per node x 4 nodes) exceeds the limit of 512000",
+		},
+		{
+			description:   "non-preemptible job above the quota",
+			resources:     torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: 8, Limit: -1}},
+			spec:          torchrunv1alpha1.TorchrunJobSpec{NumNodes: 2, Priority: torchrunv1alpha1.PriorityNormal},
+			expectReason:  "QueueQuotaExceeded",
+			expectMessage: "non-preemptible job can never be scheduled in kai-scheduler queue dev: gpu 16 (8 per node x 2 nodes) exceeds the quota of 8; use the preemptible priority to run over quota",
+		},
+		{
+			description: "preemptible job above the quota",
+			resources:   torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: 8, Limit: -1}},
+			spec:        torchrunv1alpha1.TorchrunJobSpec{NumNodes: 2, Priority: torchrunv1alpha1.PriorityPreemptible},
+		},
+		{
+			description:  "job above the limit of its child queue",
+			resources:    torchrunv1alpha1.QueueResources{GPU: unlimited},
+			spec:         torchrunv1alpha1.TorchrunJobSpec{NumNodes: 2, ChildQueue: "dev-small"},
+			expectReason: "QueueLimitExceeded",
+		},
+		{
+			description: "job of another scheduler",
+			resources:   torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: -1, Limit: 8}},
+			spec:        torchrunv1alpha1.TorchrunJobSpec{NumNodes: 4, SchedulerName: "default-scheduler"},
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Spec:       test.spec,
+		}
+		job.Spec.Queue = "dev"
+		decision, err := am.checkQueueQuota(job, newQueue(test.resources))
+		if err != nil {
+			t.Fatalf("%s: checkQueueQuota() error = %v", test.description, err)
+		}
+		if test.expectReason == "" && decision != nil {
+			t.Errorf("%s: expected the job to fit the queue, got %+v", test.description, decision)
+			continue
+		}
+		if test.expectReason != "" && (decision == nil || decision.Reason != test.expectReason) {
+			t.Errorf("%s: expected reason %s, got %+v", test.description, test.expectReason, decision)
+			continue
+		}
+		if test.expectMessage != "" && decision.Message != test.expectMessage {
+			t.Errorf("%s: expected message %q, got %q", test.description, test.expectMessage, decision.Message)
+		}
+	}
+}
+
+func TestGetPodSpecRequests(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	podSpec := &corev1.PodSpec{
+		InitContainers: []corev1.Container{
+			{Name: "setup", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("8"),
+				corev1.ResourceMemory: resource.MustParse("1Gi"),
+			}}},
+			{Name: "sidecar", RestartPolicy: &always, Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("500m"),
+			}}},
+		},
+		Containers: []corev1.Container{
+			{Name: "trainer", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("16Gi"),
+				gpuResourceName:       resource.MustParse("8"),
+			}}},
+		},
+		Overhead: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")},
+	}
+
+	requests := getPodSpecRequests(podSpec)
+	expected := map[corev1.ResourceName]string{
+		// The setup init container needs more CPU than the trainer and the sidecar
+		corev1.ResourceCPU:    "8250m",
+		corev1.ResourceMemory: "16Gi",
+		gpuResourceName:       "8",
+	}
+	for name, quantity := range expected {
+		actual := requests[name]
+		if actual.Cmp(resource.MustParse(quantity)) != 0 {
+			t.Errorf("expected %s request %s, got %s", name, quantity, actual.String())
+		}
+	}
+}
+
+func TestAdmitConcurrently(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	maxDeadline := int64(3600)
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Limits: torchrunv1alpha1.QueueLimits{MaxJobsPerUser: 1, MaxActiveDeadlineSeconds: &maxDeadline},
+		},
+	}
+
+	// Pending jobs of the same user, reconciled in parallel
+	jobs := make([]*torchrunv1alpha1.TorchrunJob, 8)
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for i := range jobs {
+		jobs[i] = &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("job-%d", i),
+				Namespace: "default",
+				UID:       types.UID(fmt.Sprintf("job-%d-uid", i)),
+				Labels:    map[string]string{"torchrun.ai/user": "alice"},
+			},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", Command: "python train.py"},
+		}
+		builder = builder.WithObjects(jobs[i]).WithStatusSubresource(jobs[i])
+	}
+	// Delay list responses so unserialized admissions would all count the jobs before any is admitted
+	c := builder.WithInterceptorFuncs(interceptor.Funcs{
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			err := c.List(ctx, list, opts...)
+			time.Sleep(10 * time.Millisecond)
+			return err
+		},
+	}).Build()
+	r := &TorchrunJobReconciler{Client: c, APIReader: c, Scheme: scheme}
+
+	var wg sync.WaitGroup
+	decisions := make([]*AdmissionDecision, len(jobs))
+	for i := range jobs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			job := &torchrunv1alpha1.TorchrunJob{}
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(jobs[i]), job); err != nil {
+				t.Errorf("failed to get job: %v", err)
+				return
+			}
+			decision, err := r.admit(context.Background(), NewAdmissionManager(c, config.KaiSchedulerName), NewStatusManager(c), job, jq)
+			if err != nil {
+				t.Errorf("admit() error = %v", err)
+				return
+			}
+			decisions[i] = decision
+
+			// The clamped deadline survives persisting the admission
+			if decision.Allowed && (job.Spec.Reliability.ActiveDeadlineSeconds == nil || *job.Spec.Reliability.ActiveDeadlineSeconds != maxDeadline) {
+				t.Errorf("expected active deadline to stay clamped, got %v", job.Spec.Reliability.ActiveDeadlineSeconds)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	allowed := 0
+	for _, decision := range decisions {
+		if decision != nil && decision.Allowed {
+			allowed++
+		}
+	}
+	if allowed != 1 {
+		t.Errorf("expected exactly 1 admitted job, got %d", allowed)
+	}
+}
@@ -0,0 +1,437 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+const (
+	// artifactsManifestName is the manifest the trainer writes into its checkpoint directory or
+	// workspace
+	artifactsManifestName = ".artifacts.json"
+
+	// artifactsMountPath is where the collector pod mounts the checkpoint directory
+	artifactsMountPath = "/checkpoints"
+
+	// artifactsNoManifestExitCode is the exit code of the collector when there is no manifest
+	artifactsNoManifestExitCode = 3
+
+	// artifactsLogLimitBytes limits how much of the manifest is read
+	artifactsLogLimitBytes = 256 * 1024
+
+	// maxArtifacts limits the artifacts recorded in the status of a job
+	maxArtifacts = 100
+
+	// maxTerminationMessageBytes is the size the kubelet truncates termination messages to, which
+	// limits the manifest of the workspace
+	maxTerminationMessageBytes = 4096
+)
+
+// artifactsCollectScript prints the modification time of the manifest on the first line and the
+// manifest after it
+var artifactsCollectScript = fmt.Sprintf(`
+	manifest="%s/%s"
+	[ -f "$manifest" ] || exit %d
+	stat -c %%Y "$manifest"
+	cat "$manifest"
+`, artifactsMountPath, artifactsManifestName, artifactsNoManifestExitCode)
+
+// buildArtifactsManifestWrapper wraps the trainer script so rank 0 writes the modification time
+// and the manifest of its workspace into its termination message once it exited successfully.
+// The workspace is deleted with the worker, the pod status keeps the manifest for the controller.
+// SIGTERM is forwarded to the script, which bash would otherwise ignore as PID 1.
+func buildArtifactsManifestWrapper(script, terminationMessagePath string) string {
+	return fmt.Sprintf(`trap 'kill -TERM "$child" 2>/dev/null' TERM
+(%s) &
+child=$!
+while kill -0 "$child" 2>/dev/null; do wait "$child"; done
+wait "$child"
+rc=$?
+if [ "$rc" = 0 ] && [ "$JOB_COMPLETION_INDEX" = 0 ] && [ -f "$TORCHRUN_ARTIFACTS_MANIFEST" ]; then
+  { stat -c %%Y "$TORCHRUN_ARTIFACTS_MANIFEST"; cat "$TORCHRUN_ARTIFACTS_MANIFEST"; } > %s
+fi
+exit $rc`, script, shellQuote(terminationMessagePath))
+}
+
+// artifactsManifest is the manifest the trainer writes
+type artifactsManifest struct {
+	Artifacts []struct {
+		Name   string `json:"name"`
+		Path   string `json:"path"`
+		Size   *int64 `json:"size"`
+		SHA256 string `json:"sha256"`
+	} `json:"artifacts"`
+}
+
+// ArtifactsResult is the state of the artifact collection of a finished job
+type ArtifactsResult struct {
+	// Status of the ArtifactsCollected condition: Unknown while the collector runs, then True or
+	// False
+	Status string
+
+	// Reason is a machine-readable reason for the state
+	Reason string
+
+	// Message is a human-readable explanation of the state
+	Message string
+
+	// Artifacts listed in the manifest, set once it was read
+	Artifacts []torchrunv1alpha1.ArtifactStatus
+}
+
+// ArtifactManager records the artifacts finished jobs list in the manifest of their checkpoint
+// directory, or of the workspace of rank 0 for jobs without checkpoints
+type ArtifactManager struct {
+	client    client.Client
+	clientset kubernetes.Interface
+	images    config.Images
+}
+
+// NewArtifactManager creates a new artifact manager. The manifest is read from the logs of the
+// collector pod through clientset, which the controller-runtime client cannot.
+func NewArtifactManager(client client.Client, clientset kubernetes.Interface, images config.Images) *ArtifactManager {
+	return &ArtifactManager{
+		client:    client,
+		clientset: clientset,
+		images:    images,
+	}
+}
+
+// CollectArtifacts creates the collector pod of a finished job and records the artifacts of its
+// manifest. It returns nil for jobs that are not finished, that do not collect artifacts, or
+// whose artifacts were already collected. The collector pod is deleted once the manifest was read
+// or found missing and kept when it failed. Jobs without checkpoints read the manifest rank 0 left
+// in its termination message instead.
+func (am *ArtifactManager) CollectArtifacts(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*ArtifactsResult, error) {
+	if !collectsArtifacts(job) || !isTerminalPhase(job.Status.Phase) ||
+		job.Status.Phase == torchrunv1alpha1.PhaseDeleted || isArtifactCollectionFinished(job) {
+		return nil, nil
+	}
+	if collectsWorkspaceArtifacts(job) {
+		return am.collectWorkspaceArtifacts(ctx, job)
+	}
+	if am.clientset == nil {
+		return nil, nil
+	}
+	volume, err := getCheckpointVolume(job, jq)
+	if err != nil {
+		return &ArtifactsResult{Status: "False", Reason: "InvalidCheckpointVolume", Message: err.Error()}, nil
+	}
+
+	existing := &corev1.Pod{}
+	err = am.client.Get(ctx, types.NamespacedName{Name: GetArtifactsPodName(job), Namespace: job.Namespace}, existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if errors.IsNotFound(err) {
+		pod := buildArtifactsPod(job, jq, volume, am.images)
+		log.FromContext(ctx).Info("Creating artifacts collector pod", "name", pod.Name)
+		if err := am.client.Create(ctx, pod); err != nil && !errors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		return &ArtifactsResult{Status: "Unknown", Reason: "Collecting", Message: fmt.Sprintf("Reading the artifacts manifest of checkpoint volume %s", volume.Name)}, nil
+	}
+
+	var result *ArtifactsResult
+	switch existing.Status.Phase {
+	case corev1.PodSucceeded:
+		limitBytes := int64(artifactsLogLimitBytes)
+		logs, err := am.clientset.CoreV1().Pods(job.Namespace).GetLogs(existing.Name, &corev1.PodLogOptions{
+			Container:  "collect",
+			LimitBytes: &limitBytes,
+		}).DoRaw(ctx)
+		if err != nil {
+			return nil, err
+		}
+		artifacts, err := parseArtifactsManifest(string(logs), job, volume)
+		switch {
+		case err != nil:
+			result = &ArtifactsResult{Status: "False", Reason: "InvalidManifest", Message: fmt.Sprintf("Invalid artifacts manifest: %v", err)}
+		case artifacts == nil:
+			result = &ArtifactsResult{Status: "False", Reason: "StaleManifest", Message: "The artifacts manifest was written before the job was created"}
+		default:
+			result = &ArtifactsResult{Status: "True", Reason: "Collected", Message: fmt.Sprintf("Recorded %d artifacts", len(artifacts)), Artifacts: artifacts}
+		}
+	case corev1.PodFailed:
+		if getTerminatedExitCode(existing, "collect") != artifactsNoManifestExitCode {
+			return &ArtifactsResult{
+				Status:  "False",
+				Reason:  "CollectFailed",
+				Message: fmt.Sprintf("Artifacts collector pod %s failed, see its logs", existing.Name),
+			}, nil
+		}
+		result = &ArtifactsResult{Status: "False", Reason: "NoManifest", Message: fmt.Sprintf("The trainer wrote no %s into its checkpoint directory", artifactsManifestName)}
+	default:
+		return &ArtifactsResult{Status: "Unknown", Reason: "Collecting", Message: fmt.Sprintf("Waiting for artifacts collector pod %s", existing.Name)}, nil
+	}
+
+	log.FromContext(ctx).Info("Artifacts manifest read, deleting artifacts collector pod", "name", existing.Name, "reason", result.Reason)
+	if err := am.client.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	return result, nil
+}
+
+// collectWorkspaceArtifacts records the artifacts of the manifest in the termination message of
+// the trainer of rank 0. The message is only written when the trainer exited successfully.
+func (am *ArtifactManager) collectWorkspaceArtifacts(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) (*ArtifactsResult, error) {
+	pods := &corev1.PodList{}
+	if err := am.client.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{
+		"app":                "torchrun",
+		"torchrun.ai/job-id": job.Spec.JobID,
+	}); err != nil {
+		return nil, err
+	}
+
+	var message string
+	for i := range pods.Items {
+		rank, ok := getRankExit(&pods.Items[i])
+		if !ok || rank.Rank != 0 || rank.ExitCode != 0 {
+			continue
+		}
+		message = getTrainerTerminationMessage(&pods.Items[i])
+		break
+	}
+	if strings.TrimSpace(message) == "" {
+		return &ArtifactsResult{
+			Status:  "False",
+			Reason:  "NoManifest",
+			Message: fmt.Sprintf("Rank 0 did not exit successfully with a %s in its workspace", artifactsManifestName),
+		}, nil
+	}
+	if len(message) >= maxTerminationMessageBytes {
+		return &ArtifactsResult{
+			Status:  "False",
+			Reason:  "InvalidManifest",
+			Message: fmt.Sprintf("The artifacts manifest of the workspace exceeds %d bytes, write it into a checkpoint directory instead", maxTerminationMessageBytes),
+		}, nil
+	}
+
+	artifacts, err := parseArtifactsManifest(message, job, nil)
+	switch {
+	case err != nil:
+		return &ArtifactsResult{Status: "False", Reason: "InvalidManifest", Message: fmt.Sprintf("Invalid artifacts manifest: %v", err)}, nil
+	case artifacts == nil:
+		return &ArtifactsResult{Status: "False", Reason: "StaleManifest", Message: "The artifacts manifest was written before the job was created"}, nil
+	}
+	return &ArtifactsResult{Status: "True", Reason: "Collected", Message: fmt.Sprintf("Recorded %d artifacts", len(artifacts)), Artifacts: artifacts}, nil
+}
+
+// getTrainerTerminationMessage returns the termination message of the trainer of a worker pod
+func getTrainerTerminationMessage(pod *corev1.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == "trainer" && status.State.Terminated != nil {
+			return status.State.Terminated.Message
+		}
+	}
+	return ""
+}
+
+// parseArtifactsManifest returns the artifacts of the collector output, or nil if the manifest
+// is older than the job and so left behind by an earlier run of the job name
+func parseArtifactsManifest(logs string, job *torchrunv1alpha1.TorchrunJob, volume *corev1.Volume) ([]torchrunv1alpha1.ArtifactStatus, error) {
+	first, data, _ := strings.Cut(logs, "\n")
+	modified, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("no modification time: %w", err)
+	}
+	if modified < job.CreationTimestamp.Unix() {
+		return nil, nil
+	}
+
+	var manifest artifactsManifest
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, err
+	}
+	if len(manifest.Artifacts) > maxArtifacts {
+		return nil, fmt.Errorf("at most %d artifacts are allowed, got %d", maxArtifacts, len(manifest.Artifacts))
+	}
+	artifacts := make([]torchrunv1alpha1.ArtifactStatus, 0, len(manifest.Artifacts))
+	for i, artifact := range manifest.Artifacts {
+		location, err := getArtifactLocation(job, volume, artifact.Path)
+		if err != nil {
+			return nil, fmt.Errorf("artifact %d: %w", i, err)
+		}
+		if artifact.Size != nil && *artifact.Size < 0 {
+			return nil, fmt.Errorf("artifact %d: size must not be negative", i)
+		}
+		artifacts = append(artifacts, torchrunv1alpha1.ArtifactStatus{
+			Name:      artifact.Name,
+			Path:      artifact.Path,
+			Location:  location,
+			SizeBytes: artifact.Size,
+			SHA256:    strings.ToLower(artifact.SHA256),
+		})
+	}
+	return artifacts, nil
+}
+
+// getArtifactLocation returns where an artifact of the manifest is stored. URLs, e.g. of models
+// the trainer uploaded itself, are kept; other paths must stay inside the checkpoint directory.
+// Without a checkpoint volume only URLs are accepted, the workspace is deleted with the workers.
+func getArtifactLocation(job *torchrunv1alpha1.TorchrunJob, volume *corev1.Volume, artifactPath string) (string, error) {
+	if strings.Contains(artifactPath, "://") {
+		return artifactPath, nil
+	}
+	if volume == nil {
+		return "", fmt.Errorf("path %q is in the workspace, which is deleted with the workers; upload the artifact and list its URL", artifactPath)
+	}
+	mountPath := job.Spec.Checkpoints.MountPath
+	if mountPath == "" {
+		mountPath = "/checkpoints"
+	}
+	// Paths of the trainer are relative to its mount path
+	if path.IsAbs(artifactPath) {
+		relative, ok := strings.CutPrefix(path.Clean(artifactPath), path.Clean(mountPath)+"/")
+		if !ok {
+			return "", fmt.Errorf("path %q is outside the checkpoint directory %s", artifactPath, mountPath)
+		}
+		artifactPath = relative
+	}
+	cleaned := path.Clean(artifactPath)
+	if artifactPath == "" || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("path %q is outside the checkpoint directory %s", artifactPath, mountPath)
+	}
+	if volume.PersistentVolumeClaim != nil {
+		return fmt.Sprintf("pvc://%s/%s/%s", volume.PersistentVolumeClaim.ClaimName, job.Spec.JobName, cleaned), nil
+	}
+	return fmt.Sprintf("%s/%s/%s", volume.Name, job.Spec.JobName, cleaned), nil
+}
+
+// collectsArtifacts returns true if the job records the artifacts of its manifest
+func collectsArtifacts(job *torchrunv1alpha1.TorchrunJob) bool {
+	return job.Spec.CollectArtifacts || (job.Spec.Checkpoints != nil && job.Spec.Checkpoints.CollectArtifacts)
+}
+
+// collectsWorkspaceArtifacts returns true if the job reads the manifest from the workspace of
+// rank 0, as it has no checkpoint directory
+func collectsWorkspaceArtifacts(job *torchrunv1alpha1.TorchrunJob) bool {
+	return job.Spec.CollectArtifacts && job.Spec.Checkpoints == nil && !isInteractiveJob(job)
+}
+
+// attachArtifactsManifest points the trainer of jobs collecting the artifacts of their workspace
+// at the manifest and wraps its script so rank 0 hands the manifest to the controller
+func attachArtifactsManifest(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) {
+	trainer := &podSpec.Containers[0]
+	if !collectsWorkspaceArtifacts(job) || len(trainer.Command) == 0 {
+		return
+	}
+	trainer.Env = append(trainer.Env, corev1.EnvVar{
+		Name:  "TORCHRUN_ARTIFACTS_MANIFEST",
+		Value: path.Join(getWorkspaceMountPath(job, jq), artifactsManifestName),
+	})
+	terminationMessagePath := trainer.TerminationMessagePath
+	if terminationMessagePath == "" {
+		terminationMessagePath = corev1.TerminationMessagePathDefault
+	}
+	script := trainer.Command[len(trainer.Command)-1]
+	trainer.Command[len(trainer.Command)-1] = buildArtifactsManifestWrapper(script, terminationMessagePath)
+}
+
+// getCheckpointVolume returns the checkpoint volume of the job from the job volumes or the pod
+// template of the queue
+func getCheckpointVolume(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*corev1.Volume, error) {
+	name := job.Spec.Checkpoints.Volume
+	if job.Spec.Volumes != nil {
+		for i := range job.Spec.Volumes.AdditionalVolumes {
+			if job.Spec.Volumes.AdditionalVolumes[i].Name == name {
+				return &job.Spec.Volumes.AdditionalVolumes[i], nil
+			}
+		}
+	}
+	podSpec, err := getPodSpec(job, jq)
+	if err != nil {
+		return nil, err
+	}
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == name {
+			return &podSpec.Volumes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("checkpoint volume %s is neither a job volume nor a volume of the queue pod template", name)
+}
+
+// getTerminatedExitCode returns the exit code of the terminated container of a pod, or -1
+func getTerminatedExitCode(pod *corev1.Pod, container string) int32 {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container && status.State.Terminated != nil {
+			return status.State.Terminated.ExitCode
+		}
+	}
+	return -1
+}
+
+// isArtifactCollectionFinished returns true if the artifacts of the job were collected or failed
+func isArtifactCollectionFinished(job *torchrunv1alpha1.TorchrunJob) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == "ArtifactsCollected" {
+			return condition.Status != "Unknown"
+		}
+	}
+	return false
+}
+
+// buildArtifactsPod builds the collector pod, which mounts the checkpoint directory of the job
+// read-only and prints its manifest
+func buildArtifactsPod(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, volume *corev1.Volume, images config.Images) *corev1.Pod {
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("10m"),
+			corev1.ResourceMemory: resource.MustParse("32Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GetArtifactsPodName(job),
+			Namespace: job.Namespace,
+			Labels: map[string]string{
+				"torchrun.ai/job-name": job.Spec.JobName,
+				"torchrun.ai/role":     "artifacts",
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, job.GroupVersionKind()),
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:      corev1.RestartPolicyNever,
+			ServiceAccountName: jq.Spec.ServiceAccountName,
+			Containers: []corev1.Container{
+				{
+					Name:    "collect",
+					Image:   images.WorkspaceInit,
+					Command: []string{"/bin/sh", "-c", artifactsCollectScript},
+					VolumeMounts: []corev1.VolumeMount{{
+						Name:      volume.Name,
+						MountPath: artifactsMountPath,
+						SubPath:   job.Spec.JobName,
+						ReadOnly:  true,
+					}},
+					Resources: resources,
+				},
+			},
+			Volumes: []corev1.Volume{*volume.DeepCopy()},
+		},
+	}
+}
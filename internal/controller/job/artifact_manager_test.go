@@ -0,0 +1,443 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestParseArtifactsManifest(t *testing.T) {
+	created := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	job := &torchrunv1alpha1.TorchrunJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "train", CreationTimestamp: metav1.NewTime(created)},
+		Spec: torchrunv1alpha1.TorchrunJobSpec{
+			JobName:     "llama",
+			Checkpoints: &torchrunv1alpha1.CheckpointConfig{Volume: "checkpoints", MountPath: "/checkpoints", CollectArtifacts: true},
+		},
+	}
+	pvc := &corev1.Volume{Name: "checkpoints", VolumeSource: corev1.VolumeSource{
+		PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "shared-checkpoints"},
+	}}
+	nfs := &corev1.Volume{Name: "checkpoints", VolumeSource: corev1.VolumeSource{
+		NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: "/exports"},
+	}}
+	modified := fmt.Sprintf("%d\n", created.Add(time.Hour).Unix())
+
+	tests := []struct {
+		description     string
+		logs            string
+		volume          *corev1.Volume
+		expectError     bool
+		expectStale     bool
+		expectLocations []string
+	}{
+		{
+			description:     "relative, absolute and URL paths",
+			logs:            modified + `{"artifacts": [{"name": "model", "path": "final/model.pt", "size": 1024, "sha256": "ABC"}, {"path": "/checkpoints/step-100"}, {"path": "s3://models/llama"}]}`,
+			volume:          pvc,
+			expectLocations: []string{"pvc://shared-checkpoints/llama/final/model.pt", "pvc://shared-checkpoints/llama/step-100", "s3://models/llama"},
+		},
+		{
+			description:     "volume other than a PVC",
+			logs:            modified + `{"artifacts": [{"path": "./final/model.pt"}]}`,
+			volume:          nfs,
+			expectLocations: []string{"checkpoints/llama/final/model.pt"},
+		},
+		{
+			description:     "empty manifest",
+			logs:            modified + `{"artifacts": []}`,
+			volume:          pvc,
+			expectLocations: []string{},
+		},
+		{
+			description: "manifest of an earlier run",
+			logs:        fmt.Sprintf("%d\n", created.Add(-time.Hour).Unix()) + `{"artifacts": [{"path": "model.pt"}]}`,
+			volume:      pvc,
+			expectStale: true,
+		},
+		{
+			description: "path outside the checkpoint directory",
+			logs:        modified + `{"artifacts": [{"path": "../other/model.pt"}]}`,
+			volume:      pvc,
+			expectError: true,
+		},
+		{
+			description: "absolute path outside the mount path",
+			logs:        modified + `{"artifacts": [{"path": "/app/model.pt"}]}`,
+			volume:      pvc,
+			expectError: true,
+		},
+		{
+			description:     "URL in the manifest of the workspace",
+			logs:            modified + `{"artifacts": [{"path": "s3://models/llama"}]}`,
+			expectLocations: []string{"s3://models/llama"},
+		},
+		{
+			description: "path in the manifest of the workspace",
+			logs:        modified + `{"artifacts": [{"path": "/app/model.pt"}]}`,
+			expectError: true,
+		},
+		{
+			description: "unknown field",
+			logs:        modified + `{"artifacts": [{"file": "model.pt"}]}`,
+			volume:      pvc,
+			expectError: true,
+		},
+		{
+			description: "no modification time",
+			logs:        "fake logs",
+			volume:      pvc,
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		artifacts, err := parseArtifactsManifest(test.logs, job, test.volume)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", test.description, artifacts)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.description, err)
+			continue
+		}
+		if test.expectStale {
+			if artifacts != nil {
+				t.Errorf("%s: expected a stale manifest, got %+v", test.description, artifacts)
+			}
+			continue
+		}
+		if artifacts == nil || len(artifacts) != len(test.expectLocations) {
+			t.Errorf("%s: expected %d artifacts, got %+v", test.description, len(test.expectLocations), artifacts)
+			continue
+		}
+		for i, location := range test.expectLocations {
+			if artifacts[i].Location != location {
+				t.Errorf("%s: expected location %q, got %q", test.description, location, artifacts[i].Location)
+			}
+		}
+	}
+
+	artifacts, _ := parseArtifactsManifest(tests[0].logs, job, pvc)
+	if artifacts[0].Name != "model" || artifacts[0].SizeBytes == nil || *artifacts[0].SizeBytes != 1024 || artifacts[0].SHA256 != "abc" {
+		t.Errorf("expected the name, size and checksum of the manifest, got %+v", artifacts[0])
+	}
+}
+
+func TestCollectArtifacts(t *testing.T) {
+	queue := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "research"},
+		Spec:       torchrunv1alpha1.JobQueueSpec{ServiceAccountName: "trainer"},
+	}
+	collector := func(phase corev1.PodPhase, exitCode int32) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "train-artifacts", Namespace: "default"},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+		if phase == corev1.PodFailed {
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				Name:  "collect",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode}},
+			}}
+		}
+		return pod
+	}
+
+	tests := []struct {
+		description   string
+		collect       bool
+		volume        string
+		phase         string
+		conditions    []torchrunv1alpha1.TorchrunJobCondition
+		existing      []client.Object
+		expectStatus  string
+		expectReason  string
+		expectCreated bool
+		expectDeleted bool
+	}{
+		{
+			description: "job without artifacts",
+			volume:      "checkpoints",
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+		},
+		{
+			description: "running job is not collected",
+			collect:     true,
+			volume:      "checkpoints",
+			phase:       torchrunv1alpha1.PhaseRunning,
+		},
+		{
+			description: "collected job is not collected again",
+			collect:     true,
+			volume:      "checkpoints",
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+			conditions:  []torchrunv1alpha1.TorchrunJobCondition{{Type: "ArtifactsCollected", Status: "True"}},
+		},
+		{
+			description:  "missing checkpoint volume",
+			collect:      true,
+			volume:       "missing",
+			phase:        torchrunv1alpha1.PhaseSucceeded,
+			expectStatus: "False",
+			expectReason: "InvalidCheckpointVolume",
+		},
+		{
+			description:   "finished job gets a collector pod",
+			collect:       true,
+			volume:        "checkpoints",
+			phase:         torchrunv1alpha1.PhaseFailed,
+			expectStatus:  "Unknown",
+			expectReason:  "Collecting",
+			expectCreated: true,
+		},
+		{
+			description:  "running collector is waited for",
+			collect:      true,
+			volume:       "checkpoints",
+			phase:        torchrunv1alpha1.PhaseSucceeded,
+			existing:     []client.Object{collector(corev1.PodRunning, 0)},
+			expectStatus: "Unknown",
+			expectReason: "Collecting",
+		},
+		{
+			description:   "missing manifest",
+			collect:       true,
+			volume:        "checkpoints",
+			phase:         torchrunv1alpha1.PhaseSucceeded,
+			existing:      []client.Object{collector(corev1.PodFailed, artifactsNoManifestExitCode)},
+			expectStatus:  "False",
+			expectReason:  "NoManifest",
+			expectDeleted: true,
+		},
+		{
+			description:  "failed collector is kept",
+			collect:      true,
+			volume:       "checkpoints",
+			phase:        torchrunv1alpha1.PhaseSucceeded,
+			existing:     []client.Object{collector(corev1.PodFailed, 1)},
+			expectStatus: "False",
+			expectReason: "CollectFailed",
+		},
+		{
+			// The fake clientset returns "fake logs" for every pod
+			description:   "unreadable manifest",
+			collect:       true,
+			volume:        "checkpoints",
+			phase:         torchrunv1alpha1.PhaseSucceeded,
+			existing:      []client.Object{collector(corev1.PodSucceeded, 0)},
+			expectStatus:  "False",
+			expectReason:  "InvalidManifest",
+			expectDeleted: true,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default", UID: "uid"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:       "research",
+				JobName:     "llama",
+				Checkpoints: &torchrunv1alpha1.CheckpointConfig{Volume: test.volume, CollectArtifacts: test.collect},
+				Volumes: &torchrunv1alpha1.VolumeOverride{AdditionalVolumes: []corev1.Volume{{
+					Name: "checkpoints",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "shared-checkpoints"},
+					},
+				}}},
+			},
+			Status: torchrunv1alpha1.TorchrunJobStatus{Phase: test.phase, Conditions: test.conditions},
+		}
+		c := fake.NewClientBuilder().WithObjects(test.existing...).Build()
+		am := NewArtifactManager(c, kubefake.NewSimpleClientset(), config.Images{WorkspaceInit: "alpine:3.18"})
+
+		result, err := am.CollectArtifacts(context.Background(), job, queue)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.description, err)
+		}
+		if test.expectStatus == "" {
+			if result != nil {
+				t.Errorf("%s: expected no result, got %+v", test.description, result)
+			}
+			continue
+		}
+		if result == nil || result.Status != test.expectStatus || result.Reason != test.expectReason {
+			t.Errorf("%s: expected %s/%s, got %+v", test.description, test.expectStatus, test.expectReason, result)
+			continue
+		}
+
+		pod := &corev1.Pod{}
+		err = c.Get(context.Background(), types.NamespacedName{Name: "train-artifacts", Namespace: "default"}, pod)
+		switch {
+		case test.expectDeleted:
+			if !errors.IsNotFound(err) {
+				t.Errorf("%s: expected collector pod to be deleted, got %v", test.description, err)
+			}
+		case test.expectCreated:
+			if err != nil {
+				t.Fatalf("%s: expected collector pod, got %v", test.description, err)
+			}
+			mount := pod.Spec.Containers[0].VolumeMounts[0]
+			if mount.Name != "checkpoints" || mount.SubPath != "llama" || !mount.ReadOnly {
+				t.Errorf("%s: expected the checkpoint directory mounted read-only, got %+v", test.description, mount)
+			}
+			if claim := pod.Spec.Volumes[0].PersistentVolumeClaim; claim == nil || claim.ClaimName != "shared-checkpoints" {
+				t.Errorf("%s: expected the checkpoint PVC, got %+v", test.description, pod.Spec.Volumes)
+			}
+			if pod.Spec.ServiceAccountName != "trainer" || pod.Spec.Containers[0].Image != "alpine:3.18" {
+				t.Errorf("%s: expected the queue service account and the workspaceInit image, got %q and %q",
+					test.description, pod.Spec.ServiceAccountName, pod.Spec.Containers[0].Image)
+			}
+		}
+	}
+}
+
+func TestCollectWorkspaceArtifacts(t *testing.T) {
+	created := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	modified := fmt.Sprintf("%d\n", created.Add(time.Hour).Unix())
+	// A worker pod of the given rank whose trainer exited with the given code and message
+	worker := func(rank string, exitCode int32, message string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "train-" + rank,
+				Namespace:   "default",
+				Labels:      map[string]string{"app": "torchrun", "torchrun.ai/job-id": "id"},
+				Annotations: map[string]string{batchv1.JobCompletionIndexAnnotation: rank},
+			},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "trainer",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Message: message}},
+			}}},
+		}
+	}
+
+	tests := []struct {
+		description     string
+		existing        []client.Object
+		expectStatus    string
+		expectReason    string
+		expectLocations []string
+	}{
+		{
+			description:     "manifest of rank 0",
+			existing:        []client.Object{worker("1", 0, ""), worker("0", 0, modified+`{"artifacts": [{"path": "s3://models/llama"}]}`)},
+			expectStatus:    "True",
+			expectReason:    "Collected",
+			expectLocations: []string{"s3://models/llama"},
+		},
+		{
+			description:  "failed rank 0",
+			existing:     []client.Object{worker("0", 1, "RuntimeError: NCCL communicator was aborted")},
+			expectStatus: "False",
+			expectReason: "NoManifest",
+		},
+		{
+			description:  "rank 0 is gone",
+			existing:     []client.Object{worker("1", 0, "")},
+			expectStatus: "False",
+			expectReason: "NoManifest",
+		},
+		{
+			description:  "manifest truncated by the kubelet",
+			existing:     []client.Object{worker("0", 0, modified+`{"artifacts": [`+strings.Repeat(" ", maxTerminationMessageBytes))},
+			expectStatus: "False",
+			expectReason: "InvalidManifest",
+		},
+		{
+			description:  "path of the workspace",
+			existing:     []client.Object{worker("0", 0, modified+`{"artifacts": [{"path": "model.pt"}]}`)},
+			expectStatus: "False",
+			expectReason: "InvalidManifest",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default", CreationTimestamp: metav1.NewTime(created)},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{JobName: "llama", JobID: "id", CollectArtifacts: true},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{Phase: torchrunv1alpha1.PhaseSucceeded},
+		}
+		c := fake.NewClientBuilder().WithObjects(test.existing...).Build()
+		am := NewArtifactManager(c, nil, config.Images{})
+
+		result, err := am.CollectArtifacts(context.Background(), job, &torchrunv1alpha1.TorchrunQueue{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.description, err)
+		}
+		if result == nil || result.Status != test.expectStatus || result.Reason != test.expectReason {
+			t.Errorf("%s: expected %s/%s, got %+v", test.description, test.expectStatus, test.expectReason, result)
+			continue
+		}
+		if len(result.Artifacts) != len(test.expectLocations) {
+			t.Errorf("%s: expected %d artifacts, got %+v", test.description, len(test.expectLocations), result.Artifacts)
+			continue
+		}
+		for i, location := range test.expectLocations {
+			if result.Artifacts[i].Location != location {
+				t.Errorf("%s: expected location %q, got %q", test.description, location, result.Artifacts[i].Location)
+			}
+		}
+	}
+}
+
+func TestAttachArtifactsManifest(t *testing.T) {
+	queue := &torchrunv1alpha1.TorchrunQueue{}
+	tests := []struct {
+		description string
+		spec        torchrunv1alpha1.TorchrunJobSpec
+		expectWrap  bool
+	}{
+		{
+			description: "job without artifacts",
+		},
+		{
+			description: "artifacts of the checkpoint directory",
+			spec: torchrunv1alpha1.TorchrunJobSpec{CollectArtifacts: true,
+				Checkpoints: &torchrunv1alpha1.CheckpointConfig{Volume: "checkpoints"}},
+		},
+		{
+			description: "artifacts of the workspace",
+			spec:        torchrunv1alpha1.TorchrunJobSpec{CollectArtifacts: true},
+			expectWrap:  true,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{Spec: test.spec}
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{
+			Name:    "trainer",
+			Command: []string{"/bin/bash", "-c", "torchrun train.py"},
+		}}}
+
+		attachArtifactsManifest(job, queue, podSpec)
+		trainer := podSpec.Containers[0]
+		script := trainer.Command[len(trainer.Command)-1]
+		if !test.expectWrap {
+			if script != "torchrun train.py" || len(trainer.Env) != 0 {
+				t.Errorf("%s: expected the trainer to be kept, got %q and %+v", test.description, script, trainer.Env)
+			}
+			continue
+		}
+		if len(trainer.Env) != 1 || trainer.Env[0].Name != "TORCHRUN_ARTIFACTS_MANIFEST" || trainer.Env[0].Value != "/app/.artifacts.json" {
+			t.Errorf("%s: expected the manifest of the workspace, got %+v", test.description, trainer.Env)
+		}
+		if !strings.Contains(script, "(torchrun train.py) &") || !strings.Contains(script, "> '/dev/termination-log'") {
+			t.Errorf("%s: expected the script to write the manifest into the termination message, got %q", test.description, script)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/patch"
+)
+
+// preemptionReasons are the DisruptionTarget reasons of pods whose node went away, e.g. a
+// reclaimed spot instance that was drained, tainted or deleted
+var preemptionReasons = []string{"TerminationByKubelet", "DeletionByTaintManager", "DeletionByPodGC"}
+
+// CapacityManager decides the capacity type the workers of a job are placed on
+type CapacityManager struct {
+	client client.Client
+}
+
+// NewCapacityManager creates a new capacity manager
+func NewCapacityManager(client client.Client) *CapacityManager {
+	return &CapacityManager{
+		client: client,
+	}
+}
+
+// CheckCapacity records the capacity decision of the job and the preemptions of its spot
+// workers. Once the queue fallback threshold is reached the job moves to on-demand capacity
+// and its current Job is deleted; it reports whether the job fell back.
+func (cm *CapacityManager) CheckCapacity(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, now time.Time) (bool, error) {
+	base := job.DeepCopy()
+	requested := job.Spec.CapacityType
+	capacity := job.Status.Capacity
+	if requested == "" {
+		job.Status.Capacity = nil
+		return false, nil
+	}
+
+	// A fallback holds as long as the job asks for spot, other spec changes are followed
+	fellBack := capacity != nil && capacity.Reason == "SpotFallback" && requested == torchrunv1alpha1.CapacityTypeSpot
+	if capacity == nil || (capacity.Type != requested && !fellBack) {
+		capacity = &torchrunv1alpha1.CapacityStatus{
+			Type:         requested,
+			Reason:       "Requested",
+			Message:      fmt.Sprintf("Workers are placed on %s capacity", requested),
+			DecisionTime: &metav1.Time{Time: now},
+		}
+		job.Status.Capacity = capacity
+	}
+
+	var fallback *torchrunv1alpha1.CapacityFallbackConfig
+	if jq.Spec.Capacity != nil {
+		fallback = jq.Spec.Capacity.Fallback
+	}
+	if capacity.Type != torchrunv1alpha1.CapacityTypeSpot || fallback == nil {
+		capacity.Preemptions = nil
+		return false, nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := cm.client.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{
+		"app":                "torchrun",
+		"torchrun.ai/job-id": job.Spec.JobID,
+	}); err != nil {
+		return false, err
+	}
+	for i := range pods.Items {
+		preemption := getPodPreemption(&pods.Items[i], now)
+		if preemption == nil || slices.ContainsFunc(capacity.Preemptions, func(p torchrunv1alpha1.CapacityPreemption) bool {
+			return p.Pod == preemption.Pod
+		}) {
+			continue
+		}
+		capacity.Preemptions = append(capacity.Preemptions, *preemption)
+	}
+
+	// Only preemptions within the window count towards the fallback
+	window := now.Add(-time.Duration(fallback.WindowSeconds) * time.Second)
+	capacity.Preemptions = slices.DeleteFunc(capacity.Preemptions, func(p torchrunv1alpha1.CapacityPreemption) bool {
+		return p.Time.Time.Before(window)
+	})
+	slices.SortFunc(capacity.Preemptions, func(a, b torchrunv1alpha1.CapacityPreemption) int {
+		return a.Time.Compare(b.Time.Time)
+	})
+	if int32(len(capacity.Preemptions)) < fallback.MaxPreemptions {
+		return false, nil
+	}
+
+	// Persist the decision before deleting the Job, so the spot Job is never created again
+	log.FromContext(ctx).Info("Falling back to on-demand capacity", "name", job.Name, "preemptions", len(capacity.Preemptions))
+	capacity.Type = torchrunv1alpha1.CapacityTypeOnDemand
+	capacity.Reason = "SpotFallback"
+	capacity.Message = fmt.Sprintf("Workers were preempted %d times within %ds on spot capacity", len(capacity.Preemptions), fallback.WindowSeconds)
+	capacity.DecisionTime = &metav1.Time{Time: now}
+	if err := patch.Status(ctx, cm.client, job, base); err != nil {
+		return false, err
+	}
+
+	// Foreground deletion keeps the Job until its spot pods are gone, so the on-demand pods
+	// never run next to them
+	spotJob := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: GetJobName(job), Namespace: job.Namespace}}
+	if err := cm.client.Delete(ctx, spotJob, client.PropagationPolicy(metav1.DeletePropagationForeground)); err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// getPodPreemption returns the preemption of a pod whose node went away, or nil
+func getPodPreemption(pod *corev1.Pod, now time.Time) *torchrunv1alpha1.CapacityPreemption {
+	disruption := getDisruptionTarget(pod)
+	if disruption == nil || !slices.Contains(preemptionReasons, disruption.Reason) {
+		return nil
+	}
+	preemptionTime := disruption.LastTransitionTime
+	if preemptionTime.IsZero() {
+		preemptionTime = metav1.Time{Time: now}
+	}
+	return &torchrunv1alpha1.CapacityPreemption{
+		Pod:    pod.Name,
+		Node:   pod.Spec.NodeName,
+		Reason: disruption.Reason,
+		Time:   preemptionTime,
+	}
+}
+
+// getDisruptionTarget returns the DisruptionTarget condition of a pod that is about to be
+// stopped by Kubernetes or the scheduler, or nil
+func getDisruptionTarget(pod *corev1.Pod) *corev1.PodCondition {
+	for i := range pod.Status.Conditions {
+		condition := &pod.Status.Conditions[i]
+		if condition.Type == corev1.DisruptionTarget && condition.Status == corev1.ConditionTrue {
+			return condition
+		}
+	}
+	return nil
+}
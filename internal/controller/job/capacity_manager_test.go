@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestCheckCapacity(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Capacity: &torchrunv1alpha1.CapacityConfig{
+				Fallback: &torchrunv1alpha1.CapacityFallbackConfig{MaxPreemptions: 2, WindowSeconds: 3600},
+			},
+		},
+	}
+	preemptedPod := func(name, reason string, preemptedAt time.Time) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{"app": "torchrun", "torchrun.ai/job-id": "train-id"},
+			},
+			Spec: corev1.PodSpec{NodeName: "spot-node"},
+			Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{
+				Type:               corev1.DisruptionTarget,
+				Status:             corev1.ConditionTrue,
+				Reason:             reason,
+				LastTransitionTime: metav1.NewTime(preemptedAt),
+			}}},
+		}
+	}
+	recorded := func(pod string, preemptedAt time.Time) torchrunv1alpha1.CapacityPreemption {
+		return torchrunv1alpha1.CapacityPreemption{Pod: pod, Reason: "TerminationByKubelet", Time: metav1.NewTime(preemptedAt)}
+	}
+
+	tests := []struct {
+		description       string
+		capacityType      string
+		status            *torchrunv1alpha1.CapacityStatus
+		pods              []*corev1.Pod
+		expectFallback    bool
+		expectType        string
+		expectReason      string
+		expectPreemptions int
+	}{
+		{
+			description: "job without capacity type records no decision",
+		},
+		{
+			description:  "requested capacity is recorded",
+			capacityType: torchrunv1alpha1.CapacityTypeSpot,
+			expectType:   torchrunv1alpha1.CapacityTypeSpot,
+			expectReason: "Requested",
+		},
+		{
+			description:  "changed capacity type replaces the requested decision",
+			capacityType: torchrunv1alpha1.CapacityTypeAny,
+			status:       &torchrunv1alpha1.CapacityStatus{Type: torchrunv1alpha1.CapacityTypeSpot, Reason: "Requested"},
+			expectType:   torchrunv1alpha1.CapacityTypeAny,
+			expectReason: "Requested",
+		},
+		{
+			description:       "preemption below the threshold is recorded",
+			capacityType:      torchrunv1alpha1.CapacityTypeSpot,
+			pods:              []*corev1.Pod{preemptedPod("train-0", "TerminationByKubelet", now.Add(-time.Minute))},
+			expectType:        torchrunv1alpha1.CapacityTypeSpot,
+			expectReason:      "Requested",
+			expectPreemptions: 1,
+		},
+		{
+			description:  "disruptions other than node loss are not preemptions",
+			capacityType: torchrunv1alpha1.CapacityTypeSpot,
+			pods:         []*corev1.Pod{preemptedPod("train-0", "PreemptionByScheduler", now.Add(-time.Minute))},
+			expectType:   torchrunv1alpha1.CapacityTypeSpot,
+			expectReason: "Requested",
+		},
+		{
+			description:  "preemptions outside the window are dropped",
+			capacityType: torchrunv1alpha1.CapacityTypeSpot,
+			status: &torchrunv1alpha1.CapacityStatus{
+				Type:        torchrunv1alpha1.CapacityTypeSpot,
+				Reason:      "Requested",
+				Preemptions: []torchrunv1alpha1.CapacityPreemption{recorded("train-old", now.Add(-2*time.Hour))},
+			},
+			pods:              []*corev1.Pod{preemptedPod("train-0", "DeletionByTaintManager", now.Add(-time.Minute))},
+			expectType:        torchrunv1alpha1.CapacityTypeSpot,
+			expectReason:      "Requested",
+			expectPreemptions: 1,
+		},
+		{
+			description:  "recorded preemptions of deleted pods count towards the fallback",
+			capacityType: torchrunv1alpha1.CapacityTypeSpot,
+			status: &torchrunv1alpha1.CapacityStatus{
+				Type:        torchrunv1alpha1.CapacityTypeSpot,
+				Reason:      "Requested",
+				Preemptions: []torchrunv1alpha1.CapacityPreemption{recorded("train-old", now.Add(-10*time.Minute))},
+			},
+			pods:              []*corev1.Pod{preemptedPod("train-0", "TerminationByKubelet", now.Add(-time.Minute))},
+			expectFallback:    true,
+			expectType:        torchrunv1alpha1.CapacityTypeOnDemand,
+			expectReason:      "SpotFallback",
+			expectPreemptions: 2,
+		},
+		{
+			description:  "fallback holds while the job asks for spot",
+			capacityType: torchrunv1alpha1.CapacityTypeSpot,
+			status:       &torchrunv1alpha1.CapacityStatus{Type: torchrunv1alpha1.CapacityTypeOnDemand, Reason: "SpotFallback"},
+			pods: []*corev1.Pod{
+				preemptedPod("train-0", "TerminationByKubelet", now.Add(-time.Minute)),
+				preemptedPod("train-1", "TerminationByKubelet", now.Add(-time.Minute)),
+			},
+			expectType:   torchrunv1alpha1.CapacityTypeOnDemand,
+			expectReason: "SpotFallback",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{JobName: "train", JobID: "train-id", CapacityType: test.capacityType},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{Capacity: test.status},
+		}
+		k8sJob := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: GetJobName(job), Namespace: "default"}}
+		objects := []client.Object{job, k8sJob}
+		for _, pod := range test.pods {
+			objects = append(objects, pod)
+		}
+
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).WithStatusSubresource(job).Build()
+		cm := NewCapacityManager(c)
+		fellBack, err := cm.CheckCapacity(context.Background(), job, jq, now)
+		if err != nil {
+			t.Fatalf("%s: CheckCapacity() error = %v", test.description, err)
+		}
+		if fellBack != test.expectFallback {
+			t.Errorf("%s: expected fallback %v, got %v", test.description, test.expectFallback, fellBack)
+		}
+
+		capacity := job.Status.Capacity
+		if test.expectType == "" {
+			if capacity != nil {
+				t.Errorf("%s: expected no capacity decision, got %+v", test.description, capacity)
+			}
+			continue
+		}
+		if capacity == nil || capacity.Type != test.expectType || capacity.Reason != test.expectReason {
+			t.Fatalf("%s: expected capacity %s (%s), got %+v", test.description, test.expectType, test.expectReason, capacity)
+		}
+		if len(capacity.Preemptions) != test.expectPreemptions {
+			t.Errorf("%s: expected %d preemptions, got %+v", test.description, test.expectPreemptions, capacity.Preemptions)
+		}
+
+		// The fallback is persisted and the spot Job deleted
+		err = c.Get(context.Background(), types.NamespacedName{Name: k8sJob.Name, Namespace: "default"}, &batchv1.Job{})
+		if deleted := apierrors.IsNotFound(err); deleted != test.expectFallback {
+			t.Errorf("%s: expected Job deleted %v, got %v", test.description, test.expectFallback, err)
+		}
+		if test.expectFallback {
+			persisted := &torchrunv1alpha1.TorchrunJob{}
+			if err := c.Get(context.Background(), types.NamespacedName{Name: "train", Namespace: "default"}, persisted); err != nil {
+				t.Fatalf("%s: failed to get job: %v", test.description, err)
+			}
+			if persisted.Status.Capacity == nil || persisted.Status.Capacity.Type != torchrunv1alpha1.CapacityTypeOnDemand {
+				t.Errorf("%s: expected persisted on-demand capacity, got %+v", test.description, persisted.Status.Capacity)
+			}
+		}
+	}
+}
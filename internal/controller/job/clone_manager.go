@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// CloneManager copies the settings of the TorchrunJobs that jobs are cloned from
+type CloneManager struct {
+	client client.Client
+}
+
+// NewCloneManager creates a new clone manager
+func NewCloneManager(client client.Client) *CloneManager {
+	return &CloneManager{
+		client: client,
+	}
+}
+
+// ApplyClone copies the settings of the job named by cloneFrom into the spec of the job and
+// reports whether the spec changed. Jobs without a cloneFrom are left unchanged.
+func (cm *CloneManager) ApplyClone(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) (bool, error) {
+	if job.Spec.CloneFrom == nil {
+		return false, nil
+	}
+
+	source := &torchrunv1alpha1.TorchrunJob{}
+	if err := cm.client.Get(ctx, types.NamespacedName{Name: job.Spec.CloneFrom.Name, Namespace: job.Namespace}, source); err != nil {
+		return false, err
+	}
+
+	merged, err := mergeClone(&job.Spec, &source.Spec)
+	if err != nil {
+		return false, err
+	}
+	if equality.Semantic.DeepEqual(job.Spec, *merged) {
+		return false, nil
+	}
+	job.Spec = *merged
+	return true, nil
+}
+
+// mergeClone copies the command, setup command, image, node count, env and workspace storage of
+// the source job into the fields the job does not set. Env is merged by variable name and the
+// workspace storage field by field, as for templates.
+func mergeClone(spec, source *torchrunv1alpha1.TorchrunJobSpec) (*torchrunv1alpha1.TorchrunJobSpec, error) {
+	merged := spec.DeepCopy()
+	if merged.Command == "" {
+		merged.Command = source.Command
+	}
+	if merged.SetupCommand == "" {
+		merged.SetupCommand = source.SetupCommand
+	}
+	if merged.Image == "" {
+		merged.Image = source.Image
+	}
+	if merged.NumNodes == 0 {
+		merged.NumNodes = source.NumNodes
+	}
+	merged.Env = mergeEnv(source.Env, spec.Env)
+
+	base, err := toJSONMap(&source.WorkspaceStorage)
+	if err != nil {
+		return nil, err
+	}
+	override, err := toJSONMap(&spec.WorkspaceStorage)
+	if err != nil {
+		return nil, err
+	}
+	deepMerge(base, override)
+	raw, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+	merged.WorkspaceStorage = torchrunv1alpha1.WorkspaceStorageConfig{}
+	if err := json.Unmarshal(raw, &merged.WorkspaceStorage); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestApplyClone(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	source := &torchrunv1alpha1.TorchrunJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "llama", Namespace: "default"},
+		Spec: torchrunv1alpha1.TorchrunJobSpec{
+			Queue:        "research",
+			JobName:      "llama",
+			Command:      "python train.py --config llama.yaml",
+			SetupCommand: "pip install -e .",
+			NumNodes:     4,
+			Priority:     "high",
+			Env: []corev1.EnvVar{
+				{Name: "NCCL_DEBUG", Value: "WARN"},
+				{Name: "LR", Value: "3e-4"},
+			},
+			WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{
+				Size:   "50Gi",
+				Source: "git",
+				URL:    "https://github.com/example/llama.git",
+			},
+		},
+	}
+
+	tests := []struct {
+		description   string
+		spec          torchrunv1alpha1.TorchrunJobSpec
+		expectChanged bool
+		expectError   bool
+		expected      torchrunv1alpha1.TorchrunJobSpec
+	}{
+		{
+			description: "job without cloneFrom is unchanged",
+			spec:        torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", Command: "python train.py"},
+			expected:    torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", Command: "python train.py"},
+		},
+		{
+			description: "cloned job fills the command, env, nodes and workspace",
+			spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:     "dev",
+				JobName:   "llama-lr",
+				CloneFrom: &torchrunv1alpha1.CloneSource{Name: "llama"},
+			},
+			expectChanged: true,
+			expected: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:        "dev",
+				JobName:      "llama-lr",
+				CloneFrom:    &torchrunv1alpha1.CloneSource{Name: "llama"},
+				Command:      "python train.py --config llama.yaml",
+				SetupCommand: "pip install -e .",
+				NumNodes:     4,
+				Env: []corev1.EnvVar{
+					{Name: "NCCL_DEBUG", Value: "WARN"},
+					{Name: "LR", Value: "3e-4"},
+				},
+				WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{
+					Size:   "50Gi",
+					Source: "git",
+					URL:    "https://github.com/example/llama.git",
+				},
+			},
+		},
+		{
+			description: "job fields take precedence over the cloned job",
+			spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:     "dev",
+				JobName:   "llama-lr",
+				CloneFrom: &torchrunv1alpha1.CloneSource{Name: "llama"},
+				NumNodes:  2,
+				Env:       []corev1.EnvVar{{Name: "LR", Value: "1e-4"}},
+				WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{
+					URL: "https://github.com/example/llama.git#lr-sweep",
+				},
+			},
+			expectChanged: true,
+			expected: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:        "dev",
+				JobName:      "llama-lr",
+				CloneFrom:    &torchrunv1alpha1.CloneSource{Name: "llama"},
+				Command:      "python train.py --config llama.yaml",
+				SetupCommand: "pip install -e .",
+				NumNodes:     2,
+				Env: []corev1.EnvVar{
+					{Name: "NCCL_DEBUG", Value: "WARN"},
+					{Name: "LR", Value: "1e-4"},
+				},
+				WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{
+					Size:   "50Gi",
+					Source: "git",
+					URL:    "https://github.com/example/llama.git#lr-sweep",
+				},
+			},
+		},
+		{
+			description: "missing cloned job is an error",
+			spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:     "dev",
+				CloneFrom: &torchrunv1alpha1.CloneSource{Name: "missing"},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(source.DeepCopy()).Build()
+		cm := NewCloneManager(c)
+
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "llama-lr", Namespace: "default"},
+			Spec:       test.spec,
+		}
+		changed, err := cm.ApplyClone(context.Background(), job)
+		if test.expectError {
+			if !apierrors.IsNotFound(err) {
+				t.Errorf("%s: expected not found error, got %v", test.description, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: ApplyClone() error = %v", test.description, err)
+		}
+		if changed != test.expectChanged {
+			t.Errorf("%s: expected changed %v, got %v", test.description, test.expectChanged, changed)
+		}
+		if !equality.Semantic.DeepEqual(job.Spec, test.expected) {
+			t.Errorf("%s: expected spec %+v, got %+v", test.description, test.expected, job.Spec)
+		}
+
+		// Applying the clone again leaves the merged spec as it is
+		if changed, err := cm.ApplyClone(context.Background(), job); err != nil || changed {
+			t.Errorf("%s: expected a second clone to change nothing, got %v %v", test.description, changed, err)
+		}
+	}
+}
@@ -4,34 +4,80 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
-	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/internal/v1alpha1"
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+	"github.com/dream3d/torchrun-controller/internal/patch"
+	"github.com/dream3d/torchrun-controller/internal/shard"
+	"github.com/dream3d/torchrun-controller/internal/tracing"
+	"github.com/dream3d/torchrun-controller/internal/upload"
 )
 
 // TorchrunJobReconciler reconciles a TorchrunJob object
 type TorchrunJobReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// NativeSidecars is true when the cluster supports restartPolicy: Always init containers
+	NativeSidecars bool
+
+	// APIReader reads Secrets directly from the API server so they are never cached
+	APIReader client.Reader
+
+	// Clientset reads the logs of worker pods. Without it the rendezvous is not followed.
+	Clientset kubernetes.Interface
+
+	// ControllerOptions sets the reconcile concurrency and rate limits
+	ControllerOptions controller.Options
+
+	// QueueShard selects the TorchrunQueues whose jobs the controller reconciles. Nil owns every queue.
+	QueueShard labels.Selector
+
+	// Config holds the operator configuration, reloaded when its ConfigMap changes
+	Config *config.Store
+
+	// admissionMu serializes the admission of new jobs across concurrent reconciles. Only the
+	// leader reconciles, so it also serializes admissions across controller replicas.
+	admissionMu sync.Mutex
 }
 
+//+kubebuilder:rbac:groups=torchrun.ai,resources=torchrunjobrecords,verbs=get;list;watch;create
 //+kubebuilder:rbac:groups=torchrun.ai,resources=torchrunjobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=torchrun.ai,resources=torchrunjobs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=torchrun.ai,resources=torchrunjobs/finalizers,verbs=update
+//+kubebuilder:rbac:groups=torchrun.ai,resources=torchruntemplates,verbs=get;list;watch
+//+kubebuilder:rbac:groups=torchrun.ai,resources=torchrunqueuebindings,verbs=get;list;watch
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=persistentvolumes,verbs=get
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;create
 //+kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=podtemplates,verbs=get;create
+//+kubebuilder:rbac:groups=autoscaling.x-k8s.io,resources=provisioningrequests,verbs=get;create;delete
+//+kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;create
 
 // Reconcile handles the reconciliation loop for TorchrunJob
 // The flow is as follows:
@@ -45,7 +91,7 @@ type TorchrunJobReconciler struct {
 //   - Create the Kubernetes Job for training
 //
 // 5. Update status based on the current state
-func (r *TorchrunJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *TorchrunJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reconcileErr error) {
 	log := log.FromContext(ctx)
 
 	// Fetch the TorchrunJob instance
@@ -56,6 +102,19 @@ func (r *TorchrunJobReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 		return ctrl.Result{}, err
 	}
+	// Status changes are patched against the job as it was read
+	original := job.DeepCopy()
+
+	// Trace the reconcile in the trace of the job, with the phases it saw end
+	ctx, span := startReconcileSpan(ctx, &job)
+	defer func() {
+		if reconcileErr == nil {
+			traceJobPhases(ctx, original, &job, time.Now())
+		}
+		tracing.EndSpan(span, reconcileErr)
+	}()
+	steps := tracing.NewSteps(ctx)
+	defer steps.End()
 
 	// Check if job is being deleted
 	if job.DeletionTimestamp != nil {
@@ -63,97 +122,640 @@ func (r *TorchrunJobReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
+	// A finished job whose workspace was garbage collected must not recreate it
+	if isConditionTrue(&job, "WorkspaceCollected") {
+		return ctrl.Result{}, nil
+	}
+
+	// Jobs omitting their queue are only given the default queue by the webhook when they are created
+	if job.Spec.Queue == "" {
+		statusManager := NewStatusManager(r.Client)
+		statusManager.UpdateCondition(&job, "QueueNotFound", "False", "QueueNotSet",
+			"spec.queue is not set and the webhook setting the default queue is not enabled")
+		setPhase(&job, torchrunv1alpha1.PhaseFailed)
+		return ctrl.Result{}, patch.Status(ctx, r.Client, &job, original)
+	}
+
 	// Fetch the referenced TorchrunQueue
 	var jobQueue torchrunv1alpha1.TorchrunQueue
 	if err := r.Get(ctx, types.NamespacedName{
 		Name:      job.Spec.Queue,
-		Namespace: job.Namespace,
+		Namespace: getQueueNamespace(&job),
 	}, &jobQueue); err != nil {
-		log.Error(err, "Failed to get JobQueue", "name", job.Spec.Queue)
+		// Without its queue the shard of the job is unknown, it is left to unsharded controllers.
+		// Creating the queue reconciles the job again.
+		if errors.IsNotFound(err) && shard.IsSharded(r.QueueShard) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get JobQueue", "name", job.Spec.Queue, "namespace", getQueueNamespace(&job))
 		statusManager := NewStatusManager(r.Client)
 		statusManager.UpdateCondition(&job, "QueueNotFound", "False", "QueueNotFound",
-			fmt.Sprintf("TorchrunQueue %s not found", job.Spec.Queue))
-		job.Status.Phase = torchrunv1alpha1.PhaseFailed
-		return ctrl.Result{}, r.Status().Update(ctx, &job)
+			fmt.Sprintf("TorchrunQueue %s/%s not found", getQueueNamespace(&job), job.Spec.Queue))
+		setPhase(&job, torchrunv1alpha1.PhaseFailed)
+		return ctrl.Result{}, patch.Status(ctx, r.Client, &job, original)
 	}
 
-	// Initialize managers
-	workspaceManager := NewWorkspaceManager(r.Client)
-	jobManager := NewJobManager(r.Client)
+	// Jobs of queues of other shards are reconciled by their controller deployment
+	if !shard.Owns(r.QueueShard, &jobQueue) {
+		return ctrl.Result{}, nil
+	}
+
+	// Initialize managers with the operator config of this reconcile
+	operatorConfig := r.Config.Get()
+	admissionManager := NewAdmissionManager(r.APIReader, operatorConfig.SchedulerName)
+	workspaceManager := NewWorkspaceManager(r.Client, r.APIReader, operatorConfig.Images)
+	jobManager := NewJobManager(r.Client, r.NativeSidecars, operatorConfig)
 	statusManager := NewStatusManager(r.Client)
+	templateManager := NewTemplateManager(r.Client)
+	cloneManager := NewCloneManager(r.Client)
+	retryManager := NewRetryManager(r.Client)
+	scheduleManager := NewScheduleManager(r.Client)
+	capacityManager := NewCapacityManager(r.Client)
+	notificationManager := NewNotificationManager(r.Client, r.APIReader)
+	trackingManager := NewTrackingManager(r.Client, r.APIReader)
+	tensorboardManager := NewTensorboardManager(r.Client, jobManager)
+	notebookManager := NewNotebookManager(r.Client, r.APIReader)
+	preflightManager := NewPreflightManager(r.Client, jobManager)
+	provisioningManager := NewProvisioningManager(r.Client, jobManager)
+	logArchiveManager := NewLogArchiveManager(r.Client, operatorConfig.Images)
+	artifactManager := NewArtifactManager(r.Client, r.Clientset, operatorConfig.Images)
+	snapshotManager := NewSnapshotManager(r.Client)
+	queuePositionManager := NewQueuePositionManager(r.Client)
+	disruptionManager := NewDisruptionManager(r.Client)
+	recordManager := NewRecordManager(r.Client)
+	rendezvousManager := NewRendezvousManager(r.Clientset)
+	gangRestartManager := NewGangRestartManager(r.Client, operatorConfig.RdzvBackend)
+	gpuMetricsManager := NewGPUMetricsManager(r.Clientset)
+	runtimeLimitManager := NewRuntimeLimitManager(r.Client)
+	dispatchManager := NewDispatchManager(r.APIReader)
+	quotaManager := NewQuotaManager(r.Client)
 
-	// Step 1: Create workspace PVC if it doesn't exist
-	if err := workspaceManager.CreateWorkspacePVC(ctx, &job, &jobQueue); err != nil {
-		log.Error(err, "Failed to create workspace PVC")
+	// Merge the cloned job and the job template before admission and persist the result, so the
+	// limits are checked against the merged spec and later changes of either do not affect the job
+	ctx = steps.Start("Merge")
+	if !isConditionTrue(&job, "Admitted") {
+		// The template fills in what neither the job nor the cloned job set
+		cloned, err := cloneManager.ApplyClone(ctx, &job)
+		if errors.IsNotFound(err) {
+			log.Info("Cloned job not found", "name", job.Name, "cloneFrom", job.Spec.CloneFrom.Name)
+			statusManager.UpdateCondition(&job, "Admitted", "False", "CloneSourceNotFound",
+				fmt.Sprintf("TorchrunJob %s to clone not found", job.Spec.CloneFrom.Name))
+			setPhase(&job, torchrunv1alpha1.PhasePending)
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, patch.Status(ctx, r.Client, &job, original)
+		}
+		if err != nil {
+			log.Error(err, "Failed to clone job")
+			return ctrl.Result{}, err
+		}
+		if cloned {
+			log.Info("Cloned job", "name", job.Name, "cloneFrom", job.Spec.CloneFrom.Name)
+			if err := r.Update(ctx, &job); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+
+		changed, err := templateManager.ApplyTemplate(ctx, &job)
+		if errors.IsNotFound(err) {
+			log.Info("Job template not found", "name", job.Name, "template", job.Spec.TemplateRef.Name)
+			statusManager.UpdateCondition(&job, "Admitted", "False", "TemplateNotFound",
+				fmt.Sprintf("TorchrunTemplate %s not found", job.Spec.TemplateRef.Name))
+			setPhase(&job, torchrunv1alpha1.PhasePending)
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, patch.Status(ctx, r.Client, &job, original)
+		}
+		if err != nil {
+			log.Error(err, "Failed to apply job template")
+			return ctrl.Result{}, err
+		}
+		if changed {
+			log.Info("Applied job template", "name", job.Name, "template", job.Spec.TemplateRef.Name)
+			if err := r.Update(ctx, &job); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	// Record edits of the merged spec, so a failed run tells whether it was edited in flight
+	if err := recordSpecChange(&job, time.Now()); err != nil {
+		log.Error(err, "Failed to record spec change")
 		return ctrl.Result{}, err
 	}
 
-	// Step 2: Check if workspace PVC is ready (has sync-completed label)
-	workspaceReady, err := workspaceManager.CheckWorkspacePVCStatus(ctx, &job)
+	// Enforce queue admission limits before allocating any resources
+	ctx = steps.Start("Admit")
+	decision, err := r.admit(ctx, admissionManager, statusManager, &job, &jobQueue)
 	if err != nil {
-		// Check if this is a sync pod failure
-		if strings.Contains(err.Error(), "sync pod failed") {
-			log.Error(err, "Sync pod failed")
-			statusManager.UpdateCondition(&job, "WorkspaceSync", "False", "SyncFailed", err.Error())
-			job.Status.Phase = torchrunv1alpha1.PhaseFailed
-			if updateErr := r.Status().Update(ctx, &job); updateErr != nil {
-				return ctrl.Result{}, updateErr
+		log.Error(err, "Failed to check queue admission limits")
+		return ctrl.Result{}, err
+	}
+	if !decision.Allowed {
+		log.Info("Job not admitted", "name", job.Name, "reason", decision.Reason)
+		statusManager.UpdateCondition(&job, "Admitted", "False", decision.Reason, decision.Message)
+		if decision.Requeue {
+			setPhase(&job, torchrunv1alpha1.PhasePending)
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, patch.Status(ctx, r.Client, &job, original)
+		}
+		setPhase(&job, torchrunv1alpha1.PhaseFailed)
+		return ctrl.Result{}, patch.Status(ctx, r.Client, &job, original)
+	}
+
+	// Ephemeral workspaces have no PVC to resume in, create or sync
+	ctx = steps.Start("Workspace")
+	ephemeral := isEphemeralWorkspace(&job, &jobQueue)
+	workspaceReady := ephemeral
+	if !ephemeral {
+		// Resume in the workspace of an earlier run of the jobName, unless that run is still active
+		holder, err := workspaceManager.AdoptWorkspacePVC(ctx, &job)
+		if err != nil {
+			log.Error(err, "Failed to adopt workspace PVC")
+			return ctrl.Result{}, err
+		}
+		if holder != "" {
+			log.Info("Job name in use", "name", job.Name, "jobName", job.Spec.JobName, "holder", holder)
+			statusManager.UpdateCondition(&job, "WorkspaceReady", "False", "JobNameInUse",
+				fmt.Sprintf("Workspace of job name %s is used by TorchrunJob %s", job.Spec.JobName, holder))
+			setPhase(&job, torchrunv1alpha1.PhasePending)
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, patch.Status(ctx, r.Client, &job, original)
+		}
+
+		// Step 1: Create workspace PVC if it doesn't exist
+		if err := workspaceManager.CreateWorkspacePVC(ctx, &job, &jobQueue); err != nil {
+			log.Error(err, "Failed to create workspace PVC")
+			return ctrl.Result{}, err
+		}
+
+		// Step 2: Check if workspace PVC is ready (has sync-completed label)
+		workspaceReady, err = workspaceManager.CheckWorkspacePVCStatus(ctx, &job)
+		if err != nil {
+			// Check if this is a sync pod failure
+			if strings.Contains(err.Error(), "sync pod failed") {
+				log.Error(err, "Sync pod failed")
+				statusManager.UpdateCondition(&job, "WorkspaceSync", "False", "SyncFailed", err.Error())
+				setPhase(&job, torchrunv1alpha1.PhaseFailed)
+				if updateErr := patch.Status(ctx, r.Client, &job, original); updateErr != nil {
+					return ctrl.Result{}, updateErr
+				}
+				// Don't requeue on sync failure
+				return ctrl.Result{}, nil
 			}
-			// Don't requeue on sync failure
-			return ctrl.Result{}, nil
+			log.Error(err, "Failed to check workspace PVC status")
+			return ctrl.Result{}, err
 		}
-		log.Error(err, "Failed to check workspace PVC status")
-		return ctrl.Result{}, err
 	}
 
 	// Step 3: If workspace is ready, create the job; otherwise create sync pod
 	if workspaceReady {
 		// Workspace is ready, create the job
 		log.Info("Workspace is ready, creating job", "name", job.Name)
-		statusManager.UpdateCondition(&job, "WorkspaceReady", "True", "WorkspaceReady", "Workspace sync completed successfully")
+		if ephemeral {
+			statusManager.UpdateCondition(&job, "WorkspaceReady", "True", "EphemeralWorkspace", "Workers get an ephemeral workspace volume, nothing to sync")
+		} else {
+			statusManager.UpdateCondition(&job, "WorkspaceReady", "True", "WorkspaceReady", "Workspace sync completed successfully")
+		}
+		job.Status.WorkspaceUploadURL = ""
+
+		// Replace a Job that exhausted its backoff limit with the next attempt
+		ctx = steps.Start("Retry")
+		retrying, wait, err := retryManager.RetryFailedJob(ctx, &job)
+		if err != nil {
+			log.Error(err, "Failed to retry job")
+			return ctrl.Result{}, err
+		}
+		if retrying && wait > 0 {
+			statusManager.UpdateCondition(&job, "Retrying", "True", "BackoffWaiting",
+				fmt.Sprintf("Job attempt %d failed, waiting to create the next attempt", job.Status.Attempts[len(job.Status.Attempts)-1].Attempt))
+			setPhase(&job, torchrunv1alpha1.PhasePending)
+			if _, err := notificationManager.Notify(ctx, &job, &jobQueue, time.Now()); err != nil {
+				log.Error(err, "Failed to notify job events")
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: wait}, patch.Status(ctx, r.Client, &job, original)
+		}
+		if retrying {
+			statusManager.UpdateCondition(&job, "Retrying", "False", "JobRetried",
+				fmt.Sprintf("Created Job attempt %d", job.Status.Attempt))
+		}
+
+		// Hold the job back until its schedule and the queue maintenance windows let it start
+		ctx = steps.Start("Schedule")
+		wait, err = scheduleManager.CheckSchedule(ctx, &job, &jobQueue, time.Now())
+		if err != nil {
+			log.Error(err, "Invalid job schedule")
+			statusManager.UpdateCondition(&job, "Scheduled", "False", "InvalidSchedule", err.Error())
+			setPhase(&job, torchrunv1alpha1.PhasePending)
+			return ctrl.Result{RequeueAfter: time.Minute}, patch.Status(ctx, r.Client, &job, original)
+		}
+		if wait > 0 {
+			log.Info("Waiting for schedule window", "name", job.Name, "wait", wait)
+			statusManager.UpdateCondition(&job, "Scheduled", "False", "WaitingForWindow",
+				fmt.Sprintf("Job starts at %s", time.Now().Add(wait).UTC().Format(time.RFC3339)))
+			setPhase(&job, torchrunv1alpha1.PhaseSuspended)
+			return ctrl.Result{RequeueAfter: wait}, patch.Status(ctx, r.Client, &job, original)
+		}
+		if hasCondition(&job, "Scheduled") {
+			statusManager.UpdateCondition(&job, "Scheduled", "True", "WindowOpen", "Job schedule allows the job to start")
+		}
+
+		// Move spot jobs that were preempted too often to on-demand capacity
+		fellBack, err := capacityManager.CheckCapacity(ctx, &job, &jobQueue, time.Now())
+		if err != nil {
+			log.Error(err, "Failed to check job capacity")
+			return ctrl.Result{}, err
+		}
+		if fellBack {
+			statusManager.UpdateCondition(&job, "CapacityFallback", "True", "SpotFallback", job.Status.Capacity.Message)
+		}
+
+		// Hold the job back until it is next in the dispatch line of its queue
+		ctx = steps.Start("Dispatch")
+		dispatch, err := r.dispatch(ctx, dispatchManager, statusManager, &job, &jobQueue)
+		if err != nil {
+			log.Error(err, "Failed to dispatch job")
+			return ctrl.Result{}, err
+		}
+		if dispatch != nil && !dispatch.Dispatched {
+			log.Info("Waiting for dispatch", "name", job.Name, "reason", dispatch.Reason)
+			setPhase(&job, torchrunv1alpha1.PhaseQueued)
+			if job.Spec.Suspend {
+				setPhase(&job, torchrunv1alpha1.PhaseSuspended)
+			}
+			if _, err := queuePositionManager.UpdateQueuePosition(ctx, &job, &jobQueue, time.Now()); err != nil {
+				log.Error(err, "Failed to update queue position")
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: operatorConfig.Reconcile.PollInterval.Duration}, patch.Status(ctx, r.Client, &job, original)
+		}
+		if jobQueue.Spec.Dispatch == nil && hasCondition(&job, "Dispatched") && !isConditionTrue(&job, "Dispatched") {
+			statusManager.UpdateCondition(&job, "Dispatched", "True", "DispatchDisabled", "Queue creates the Jobs of its jobs right away")
+		}
+
+		// Hold a multi-node job back until the cluster autoscaler provisioned the nodes of all workers
+		ctx = steps.Start("Provision")
+		provisioning, err := provisioningManager.EnsureProvisioning(ctx, &job, &jobQueue)
+		if err != nil {
+			log.Error(err, "Failed to provision nodes")
+			return ctrl.Result{}, err
+		}
+		if provisioning != nil && provisioning.Status != "" {
+			statusManager.UpdateCondition(&job, "Provisioned", provisioning.Status, provisioning.Reason, provisioning.Message)
+		}
+		if provisioning != nil && !provisioning.Ready {
+			log.Info("Waiting for node provisioning", "name", job.Name, "reason", provisioning.Reason)
+			setPhase(&job, torchrunv1alpha1.PhasePending)
+			if job.Spec.Suspend {
+				setPhase(&job, torchrunv1alpha1.PhaseSuspended)
+			}
+			return ctrl.Result{RequeueAfter: operatorConfig.Reconcile.PollInterval.Duration}, patch.Status(ctx, r.Client, &job, original)
+		}
 
-		if err := jobManager.CreateJob(ctx, &job, &jobQueue); err != nil {
-			log.Error(err, "Failed to create job")
-			statusManager.UpdateCondition(&job, "JobCreated", "False", "CreateFailed", err.Error())
-			if updateErr := r.Status().Update(ctx, &job); updateErr != nil {
+		// Test the interconnect of the nodes before the training Job takes them
+		ctx = steps.Start("Preflight")
+		preflight, err := preflightManager.RunPreflight(ctx, &job, &jobQueue)
+		if err != nil {
+			log.Error(err, "Failed to run preflight")
+			statusManager.UpdateCondition(&job, "Preflight", "False", "CreateFailed", err.Error())
+			if updateErr := patch.Status(ctx, r.Client, &job, original); updateErr != nil {
 				return ctrl.Result{}, updateErr
 			}
 			return ctrl.Result{}, err
 		}
-		statusManager.UpdateCondition(&job, "JobCreated", "True", "JobCreated", "Kubernetes Job created successfully")
+		if preflight.Failed {
+			log.Info("Preflight failed", "name", job.Name, "message", preflight.Message)
+			statusManager.UpdateCondition(&job, "Preflight", "False", preflight.Reason, preflight.Message)
+			setPhase(&job, torchrunv1alpha1.PhaseFailed)
+			return ctrl.Result{}, patch.Status(ctx, r.Client, &job, original)
+		}
+		if !preflight.Passed {
+			// Unknown until the preflight finishes, so its failure replaces the condition
+			if preflight.Reason != "" {
+				statusManager.UpdateCondition(&job, "Preflight", "Unknown", preflight.Reason, preflight.Message)
+			}
+			setPhase(&job, torchrunv1alpha1.PhasePending)
+			if job.Spec.Suspend {
+				setPhase(&job, torchrunv1alpha1.PhaseSuspended)
+			}
+			return ctrl.Result{RequeueAfter: operatorConfig.Reconcile.PollInterval.Duration}, patch.Status(ctx, r.Client, &job, original)
+		}
+		if preflight.Reason != "" {
+			statusManager.UpdateCondition(&job, "Preflight", "True", preflight.Reason, preflight.Message)
+		}
+
+		// Create the experiment tracking run before the Job, so the trainer logs to it
+		if err := trackingManager.EnsureRun(ctx, &job); err != nil {
+			log.Error(err, "Failed to create experiment tracking run")
+			statusManager.UpdateCondition(&job, "ExperimentTracking", "False", "RunCreateFailed", err.Error())
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, patch.Status(ctx, r.Client, &job, original)
+		}
+		if hasCondition(&job, "ExperimentTracking") {
+			statusManager.UpdateCondition(&job, "ExperimentTracking", "True", "RunCreated",
+				fmt.Sprintf("Linked experiment tracking run %s", job.Status.TrackingRunID))
+		}
+
+		// Create the token of a notebook before the Job, so the Jupyter server starts with it
+		if err := notebookManager.EnsureNotebook(ctx, &job); err != nil {
+			log.Error(err, "Failed to provision notebook")
+			statusManager.UpdateCondition(&job, "NotebookReady", "False", "ProvisionFailed", err.Error())
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, patch.Status(ctx, r.Client, &job, original)
+		}
+		if job.Status.Notebook != nil {
+			statusManager.UpdateCondition(&job, "NotebookReady", "True", "Provisioned",
+				fmt.Sprintf("Jupyter serves at %s with the token in Secret %s", job.Status.Notebook.URL, job.Status.Notebook.TokenSecretName))
+		} else if hasCondition(&job, "NotebookReady") {
+			statusManager.UpdateCondition(&job, "NotebookReady", "False", "Disabled", "Job is not a notebook")
+		}
+
+		// A new node count must fit the queue limits; a rejected resize keeps the existing Job
+		ctx = steps.Start("CreateJob")
+		resize, err := admissionManager.CheckResize(&job, &jobQueue)
+		if err != nil {
+			log.Error(err, "Failed to check resize against queue limits")
+			return ctrl.Result{}, err
+		}
+		var update *JobUpdate
+		if resize != nil {
+			log.Info("Resize rejected", "name", job.Name, "numNodes", job.Spec.NumNodes)
+			update = &JobUpdate{Reason: resize.Reason, Message: resize.Message}
+		} else {
+			update, err = jobManager.CreateJob(ctx, &job, &jobQueue)
+			if err != nil {
+				log.Error(err, "Failed to create job")
+				statusManager.UpdateCondition(&job, "JobCreated", "False", "CreateFailed", err.Error())
+				if updateErr := patch.Status(ctx, r.Client, &job, original); updateErr != nil {
+					return ctrl.Result{}, updateErr
+				}
+				return ctrl.Result{}, err
+			}
+			statusManager.UpdateCondition(&job, "JobCreated", "True", "JobCreated", "Kubernetes Job created successfully")
+		}
+
+		// Report how a changed spec was applied to the existing Job
+		if update != nil {
+			log.Info("Job spec changed", "name", job.Name, "reason", update.Reason)
+			status := "False"
+			if update.Synced {
+				status = "True"
+			}
+			statusManager.UpdateCondition(&job, "JobSynced", status, update.Reason, update.Message)
+		} else if hasCondition(&job, "JobSynced") {
+			statusManager.UpdateCondition(&job, "JobSynced", "True", "UpToDate", "Kubernetes Job matches the spec")
+		}
+
+		// Serve the logs of the job on TensorBoard. A failed deployment does not hold back training.
+		if err := tensorboardManager.EnsureTensorboard(ctx, &job, &jobQueue); err != nil {
+			log.Error(err, "Failed to deploy tensorboard")
+			statusManager.UpdateCondition(&job, "TensorboardReady", "False", "DeployFailed", err.Error())
+		} else if job.Status.TensorboardURL != "" {
+			statusManager.UpdateCondition(&job, "TensorboardReady", "True", "Deployed",
+				fmt.Sprintf("TensorBoard serves %s at %s", job.Spec.Tensorboard.LogDir, job.Status.TensorboardURL))
+		} else if hasCondition(&job, "TensorboardReady") {
+			statusManager.UpdateCondition(&job, "TensorboardReady", "False", "Disabled", "TensorBoard is disabled")
+		}
 	} else {
-		// Workspace not ready, create sync pod if it doesn't exist
+		// Workspace not ready, publish the presigned upload URL if the queue runs an upload server,
+		// re-signing it once the previous one has expired
+		ctx = steps.Start("SyncWorkspace")
+		if UsesUploadServer(&job, &jobQueue) && upload.Expired(job.Status.WorkspaceUploadURL, time.Now()) {
+			uploadURL, _, err := workspaceManager.GetUploadURLs(ctx, &job, &jobQueue)
+			if err != nil {
+				log.Error(err, "Failed to create workspace upload URL")
+				return ctrl.Result{}, err
+			}
+			job.Status.WorkspaceUploadURL = uploadURL
+		}
+
+		// Create sync pod if it doesn't exist
 		log.Info("Workspace not ready, creating sync pod", "name", job.Name)
 		if err := workspaceManager.CreateSyncPod(ctx, &job, &jobQueue); err != nil {
 			log.Error(err, "Failed to create sync pod")
 			statusManager.UpdateCondition(&job, "WorkspaceSync", "False", "CreateSyncPodFailed", err.Error())
 			return ctrl.Result{}, err
 		}
-		statusManager.UpdateCondition(&job, "WorkspaceSync", "True", "SyncInProgress", "Workspace sync pod created and running")
+		// The sync pod waits for the workspace PVC, which is never provisioned without a storage class
+		message, err := workspaceManager.DiagnoseWorkspacePVC(ctx, &job)
+		if err != nil {
+			log.Error(err, "Failed to diagnose workspace PVC")
+			return ctrl.Result{}, err
+		}
+		if message != "" {
+			statusManager.UpdateCondition(&job, "WorkspaceSync", "False", "NoStorageClass", message)
+		} else {
+			statusManager.UpdateCondition(&job, "WorkspaceSync", "True", "SyncInProgress", "Workspace sync pod created and running")
+		}
 
-		// Requeue to check sync pod status
-		if err := statusManager.UpdateStatus(ctx, &job); err != nil {
+		// Changes of the sync pod and the workspace PVC reconcile the job again
+		if err := statusManager.UpdateStatus(ctx, &job, original); err != nil {
 			log.Error(err, "Failed to update status")
 			return ctrl.Result{}, err
 		}
-		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		return ctrl.Result{RequeueAfter: getRequeueInterval(&job, &jobQueue, operatorConfig.Reconcile, time.Now())}, nil
 	}
 
 	// Update status
-	if err := statusManager.UpdateStatus(ctx, &job); err != nil {
+	ctx = steps.Start("UpdateStatus")
+	if err := statusManager.UpdateStatus(ctx, &job, original); err != nil {
 		log.Error(err, "Failed to update status")
 		return ctrl.Result{}, err
 	}
+	if operatorConfig.Metrics.GPUUsage {
+		recordGPUUsage(&job, original)
+	}
 
-	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	// Follow the rendezvous of multi-node workers, whose hangs only show in their logs
+	ctx = steps.Start("CheckRendezvous")
+	rendezvous := rendezvousManager.CheckRendezvous(ctx, &job)
+	if rendezvous != nil {
+		statusManager.UpdateCondition(&job, "RendezvousReady", rendezvous.Status, rendezvous.Reason, rendezvous.Message)
+	}
+
+	// Restart the other workers when rank 0 fails, as the static rendezvous cannot recover from it
+	gangRestart, err := gangRestartManager.RestartOnRank0Failure(ctx, &job, &jobQueue)
+	if err != nil {
+		log.Error(err, "Failed to restart workers after rank 0 failure")
+		return ctrl.Result{}, err
+	}
+	if gangRestart != nil {
+		statusManager.UpdateCondition(&job, "Rank0Failed", "True", gangRestart.Reason, gangRestart.Message)
+	}
+
+	// Sum the GPU samples of the workers and flag jobs whose GPUs idle
+	gpuMetrics := gpuMetricsManager.CollectGPUMetrics(ctx, &job, &jobQueue, time.Now())
+	if gpuMetrics != nil {
+		statusManager.UpdateCondition(&job, "LowGPUUtilization", gpuMetrics.Status, gpuMetrics.Reason, gpuMetrics.Message)
+	}
+
+	// Signal the training processes of jobs over the maximum runtime of the queue to checkpoint
+	runtimeLimit, err := runtimeLimitManager.EnforceMaxRuntime(ctx, &job, &jobQueue, time.Now())
+	if err != nil {
+		log.Error(err, "Failed to enforce maximum runtime")
+		return ctrl.Result{}, err
+	}
+	if runtimeLimit != nil {
+		statusManager.UpdateCondition(&job, "MaxRuntimeExceeded", runtimeLimit.Status, runtimeLimit.Reason, runtimeLimit.Message)
+	}
+
+	// Tell jobs running on GPUs borrowed beyond the queue quota that they are preempted first
+	overQuota, err := quotaManager.CheckQuota(ctx, &job, &jobQueue)
+	if err != nil {
+		log.Error(err, "Failed to check queue quota")
+		return ctrl.Result{}, err
+	}
+	if overQuota != nil {
+		statusManager.UpdateCondition(&job, "OverQuota", overQuota.Status, overQuota.Reason, overQuota.Message)
+	}
+
+	// Keep node drains from evicting the workers of a running job. A missing budget does not
+	// hold back training.
+	if err := disruptionManager.EnsurePodDisruptionBudget(ctx, &job); err != nil {
+		log.Error(err, "Failed to reconcile pod disruption budget")
+	}
+
+	// Place a Queued job in the line of its queue
+	positioned, err := queuePositionManager.UpdateQueuePosition(ctx, &job, &jobQueue, time.Now())
+	if err != nil {
+		log.Error(err, "Failed to update queue position")
+		return ctrl.Result{}, err
+	}
+
+	// Upload the worker logs of a finished job to the log archive of the queue
+	ctx = steps.Start("Finish")
+	archive, err := logArchiveManager.ArchiveLogs(ctx, &job, &jobQueue)
+	if err != nil {
+		log.Error(err, "Failed to archive job logs")
+		return ctrl.Result{}, err
+	}
+	if archive != nil {
+		statusManager.UpdateCondition(&job, "LogsArchived", archive.Status, archive.Reason, archive.Message)
+		job.Status.LogArchiveURL = archive.URL
+	}
+
+	// Record the artifacts a finished job lists in the manifest of its checkpoint directory or workspace
+	artifacts, err := artifactManager.CollectArtifacts(ctx, &job, &jobQueue)
+	if err != nil {
+		log.Error(err, "Failed to collect artifacts")
+		return ctrl.Result{}, err
+	}
+	if artifacts != nil {
+		statusManager.UpdateCondition(&job, "ArtifactsCollected", artifacts.Status, artifacts.Reason, artifacts.Message)
+		if artifacts.Artifacts != nil {
+			job.Status.Artifacts = artifacts.Artifacts
+		}
+	}
+
+	// Snapshot the workspace of a finished job for later jobs to start from
+	snapshot, err := snapshotManager.SnapshotWorkspace(ctx, &job, &jobQueue)
+	if err != nil {
+		log.Error(err, "Failed to snapshot workspace")
+		return ctrl.Result{}, err
+	}
+	if snapshot != nil {
+		statusManager.UpdateCondition(&job, "WorkspaceSnapshotted", snapshot.Status, snapshot.Reason, snapshot.Message)
+		job.Status.WorkspaceSnapshot = snapshot.Name
+	}
+
+	// Post the lifecycle events of the updated status to the queue notification targets
+	notified, err := notificationManager.Notify(ctx, &job, &jobQueue, time.Now())
+	if err != nil {
+		log.Error(err, "Failed to notify job events")
+		return ctrl.Result{}, err
+	}
+	// Keep a record of the finished job that outlives it
+	recorded, err := recordManager.RecordJob(ctx, &job, &jobQueue, time.Now())
+	if err != nil {
+		log.Error(err, "Failed to record job")
+		return ctrl.Result{}, err
+	}
+	if notified || archive != nil || artifacts != nil || snapshot != nil || positioned || recorded || rendezvous != nil || gangRestart != nil || gpuMetrics != nil || runtimeLimit != nil || overQuota != nil {
+		if err := patch.Status(ctx, r.Client, &job, original); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{RequeueAfter: getRequeueInterval(&job, &jobQueue, operatorConfig.Reconcile, time.Now())}, nil
+}
+
+// admit checks the job against the queue limits and records the Admitted condition.
+// Jobs that are not admitted yet are checked under a lock and persisted as admitted before
+// it is released, so concurrent reconciles cannot admit more jobs than the per-user limit.
+func (r *TorchrunJobReconciler) admit(ctx context.Context, am *AdmissionManager, sm *StatusManager, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*AdmissionDecision, error) {
+	admitted := isConditionTrue(job, "Admitted")
+	if !admitted {
+		r.admissionMu.Lock()
+		defer r.admissionMu.Unlock()
+	}
+
+	// A running batch Job keeps its deadline when the queue limits are tightened
+	var existing *batchv1.Job
+	if admitted {
+		existing = &batchv1.Job{}
+		err := r.Get(ctx, types.NamespacedName{Name: GetJobName(job), Namespace: job.Namespace}, existing)
+		if errors.IsNotFound(err) {
+			existing = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	decision, err := am.Admit(ctx, job, jq, existing)
+	if err != nil || !decision.Allowed {
+		return decision, err
+	}
+	base := job.DeepCopy()
+	sm.UpdateCondition(job, "Admitted", "True", decision.Reason, decision.Message)
+	if admitted {
+		return decision, nil
+	}
+
+	// The patch leaves the clamped active deadline in the spec of the job
+	if err := patch.Status(ctx, r.Client, job, base); err != nil {
+		return nil, err
+	}
+	return decision, nil
+}
+
+// dispatch places the job in the dispatch line of its queue and records the Dispatched condition.
+// Jobs are dispatched under the admission lock and persisted as dispatched before it is released,
+// so concurrent reconciles cannot dispatch more jobs than fit the queue.
+func (r *TorchrunJobReconciler) dispatch(ctx context.Context, dm *DispatchManager, sm *StatusManager, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*DispatchDecision, error) {
+	if jq.Spec.Dispatch == nil || isDispatched(job) {
+		return nil, nil
+	}
+	r.admissionMu.Lock()
+	defer r.admissionMu.Unlock()
+
+	decision, err := dm.CheckDispatch(ctx, job, jq, time.Now())
+	if err != nil || decision == nil {
+		return decision, err
+	}
+	if !decision.Dispatched {
+		sm.UpdateCondition(job, "Dispatched", "False", decision.Reason, decision.Message)
+		return decision, nil
+	}
+	base := job.DeepCopy()
+	sm.UpdateCondition(job, "Dispatched", "True", decision.Reason, decision.Message)
+	if err := patch.Status(ctx, r.Client, job, base); err != nil {
+		return nil, err
+	}
+	return decision, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *TorchrunJobReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := setupQueueIndex(context.Background(), mgr); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&torchrunv1alpha1.TorchrunJob{}).
 		Owns(&batchv1.Job{}).
-		Owns(&corev1.PersistentVolumeClaim{}).
-		Owns(&corev1.Pod{}).
+		// The sync completion of a workspace is marked by a label of its PVC
+		Owns(&corev1.PersistentVolumeClaim{}, builder.WithPredicates(predicate.LabelChangedPredicate{})).
+		// Sync, log collector and preflight pods are owned by the TorchrunJob, worker pods by its Job
+		Owns(&corev1.Pod{}, builder.WithPredicates(podStatusChangedPredicate)).
+		Watches(&corev1.Pod{},
+			handler.EnqueueRequestsFromMapFunc(r.findJobForWorkerPod),
+			builder.WithPredicates(podStatusChangedPredicate)).
+		// Only spec changes of a queue affect its jobs, not its periodic status updates
+		Watches(&torchrunv1alpha1.TorchrunQueue{},
+			handler.EnqueueRequestsFromMapFunc(r.findJobsForQueue),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}, shard.Predicate(r.QueueShard))).
+		WithOptions(r.ControllerOptions).
 		Complete(r)
 }
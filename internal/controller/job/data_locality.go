@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// defaultDataLocalityWeight is the weight of the preferred node affinity of a dataset when the
+// spec does not set one
+const defaultDataLocalityWeight int32 = 50
+
+// attachDataLocality places the workers on the nodes holding the datasets of the job. Each dataset
+// adds its node terms as preferred node affinity, or, when the locality is required, is ANDed into
+// every required term of the pod, as the terms of a dataset are alternatives like the required
+// terms. Datasets whose PVC is not bound yet hold no nodes and are skipped.
+func (jm *JobManager) attachDataLocality(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, podSpec *corev1.PodSpec) error {
+	locality := job.Spec.DataLocality
+	if locality == nil {
+		return nil
+	}
+
+	var datasetTerms [][]corev1.NodeSelectorTerm
+	for _, dataset := range locality.Datasets {
+		terms, err := jm.getDatasetNodeTerms(ctx, job.Namespace, dataset)
+		if err != nil {
+			return err
+		}
+		if len(terms) > 0 {
+			datasetTerms = append(datasetTerms, terms)
+		}
+	}
+	if len(datasetTerms) == 0 {
+		return nil
+	}
+
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = &corev1.Affinity{}
+	}
+	if podSpec.Affinity.NodeAffinity == nil {
+		podSpec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	nodeAffinity := podSpec.Affinity.NodeAffinity
+
+	if !locality.Required {
+		weight := locality.Weight
+		if weight == 0 {
+			weight = defaultDataLocalityWeight
+		}
+		for _, terms := range datasetTerms {
+			for _, term := range terms {
+				nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+					corev1.PreferredSchedulingTerm{Weight: weight, Preference: term})
+			}
+		}
+		return nil
+	}
+
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	required := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(required.NodeSelectorTerms) == 0 {
+		required.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+	for _, terms := range datasetTerms {
+		var combined []corev1.NodeSelectorTerm
+		for _, term := range required.NodeSelectorTerms {
+			for _, datasetTerm := range terms {
+				var combinedTerm corev1.NodeSelectorTerm
+				combinedTerm.MatchExpressions = append(append(combinedTerm.MatchExpressions, term.MatchExpressions...), datasetTerm.MatchExpressions...)
+				combinedTerm.MatchFields = append(append(combinedTerm.MatchFields, term.MatchFields...), datasetTerm.MatchFields...)
+				combined = append(combined, combinedTerm)
+			}
+		}
+		required.NodeSelectorTerms = combined
+	}
+	return nil
+}
+
+// getDatasetNodeTerms returns the alternative node terms of the nodes holding a dataset: the
+// required node affinity of the PersistentVolume bound to its PVC, or its node labels.
+func (jm *JobManager) getDatasetNodeTerms(ctx context.Context, namespace string, dataset torchrunv1alpha1.DatasetLocality) ([]corev1.NodeSelectorTerm, error) {
+	if dataset.PVCName == "" {
+		if len(dataset.NodeLabels) == 0 {
+			return nil, nil
+		}
+		keys := make([]string, 0, len(dataset.NodeLabels))
+		for key := range dataset.NodeLabels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		term := corev1.NodeSelectorTerm{}
+		for _, key := range keys {
+			term.MatchExpressions = append(term.MatchExpressions, corev1.NodeSelectorRequirement{
+				Key:      key,
+				Operator: corev1.NodeSelectorOpIn,
+				Values:   []string{dataset.NodeLabels[key]},
+			})
+		}
+		return []corev1.NodeSelectorTerm{term}, nil
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := jm.client.Get(ctx, types.NamespacedName{Name: dataset.PVCName, Namespace: namespace}, pvc); err != nil {
+		return nil, fmt.Errorf("failed to get dataset PVC %s: %w", dataset.PVCName, err)
+	}
+	if pvc.Spec.VolumeName == "" {
+		return nil, nil
+	}
+	pv := &corev1.PersistentVolume{}
+	if err := jm.client.Get(ctx, types.NamespacedName{Name: pvc.Spec.VolumeName}, pv); err != nil {
+		return nil, fmt.Errorf("failed to get the PersistentVolume %s of dataset PVC %s: %w", pvc.Spec.VolumeName, dataset.PVCName, err)
+	}
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return nil, nil
+	}
+	return pv.Spec.NodeAffinity.Required.DeepCopy().NodeSelectorTerms, nil
+}
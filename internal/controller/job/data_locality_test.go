@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestAttachDataLocality(t *testing.T) {
+	onNodes := func(nodes ...string) corev1.NodeSelectorTerm {
+		return corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+			{Key: "kubernetes.io/hostname", Operator: corev1.NodeSelectorOpIn, Values: nodes},
+		}}
+	}
+	cached := corev1.NodeSelectorRequirement{Key: "fluid.io/s-ml-platform-imagenet", Operator: corev1.NodeSelectorOpIn, Values: []string{"true"}}
+	poolA100 := corev1.NodeSelectorRequirement{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"a100"}}
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "imagenet", Namespace: "ml-platform"},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-imagenet"},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-imagenet"},
+			Spec: corev1.PersistentVolumeSpec{NodeAffinity: &corev1.VolumeNodeAffinity{Required: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{onNodes("gpu-node-1", "gpu-node-2")},
+			}}},
+		},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "ml-platform"}},
+	).Build()
+	jm := NewJobManager(c, true, config.Default())
+
+	tests := []struct {
+		description     string
+		locality        *torchrunv1alpha1.DataLocalityConfig
+		affinity        *corev1.Affinity
+		expectPreferred []corev1.PreferredSchedulingTerm
+		expectRequired  []corev1.NodeSelectorTerm
+		expectErr       bool
+	}{
+		{
+			description: "job without data locality",
+		},
+		{
+			description: "nodes of the volume of a PVC are preferred",
+			locality: &torchrunv1alpha1.DataLocalityConfig{
+				Datasets: []torchrunv1alpha1.DatasetLocality{{PVCName: "imagenet"}},
+				Weight:   80,
+			},
+			expectPreferred: []corev1.PreferredSchedulingTerm{{Weight: 80, Preference: onNodes("gpu-node-1", "gpu-node-2")}},
+		},
+		{
+			description: "nodes labeled by the cache are preferred with the default weight",
+			locality: &torchrunv1alpha1.DataLocalityConfig{
+				Datasets: []torchrunv1alpha1.DatasetLocality{{NodeLabels: map[string]string{"fluid.io/s-ml-platform-imagenet": "true"}}},
+			},
+			expectPreferred: []corev1.PreferredSchedulingTerm{{Weight: 50, Preference: corev1.NodeSelectorTerm{
+				MatchExpressions: []corev1.NodeSelectorRequirement{cached},
+			}}},
+		},
+		{
+			description: "required datasets are added to every required term",
+			locality: &torchrunv1alpha1.DataLocalityConfig{
+				Datasets: []torchrunv1alpha1.DatasetLocality{
+					{PVCName: "imagenet"},
+					{NodeLabels: map[string]string{"fluid.io/s-ml-platform-imagenet": "true"}},
+				},
+				Required: true,
+			},
+			affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{poolA100}}},
+			}}},
+			expectRequired: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+				poolA100, onNodes("gpu-node-1", "gpu-node-2").MatchExpressions[0], cached,
+			}}},
+		},
+		{
+			description: "unbound PVC holds no nodes",
+			locality: &torchrunv1alpha1.DataLocalityConfig{
+				Datasets: []torchrunv1alpha1.DatasetLocality{{PVCName: "pending"}},
+				Required: true,
+			},
+		},
+		{
+			description: "missing PVC fails the build",
+			locality: &torchrunv1alpha1.DataLocalityConfig{
+				Datasets: []torchrunv1alpha1.DatasetLocality{{PVCName: "deleted"}},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "ml-platform"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{DataLocality: test.locality},
+		}
+		podSpec := corev1.PodSpec{Affinity: test.affinity}
+		err := jm.attachDataLocality(context.Background(), job, &podSpec)
+		if (err != nil) != test.expectErr {
+			t.Errorf("%s: expected error %v, got %v", test.description, test.expectErr, err)
+			continue
+		}
+
+		var preferred []corev1.PreferredSchedulingTerm
+		var required []corev1.NodeSelectorTerm
+		if podSpec.Affinity != nil && podSpec.Affinity.NodeAffinity != nil {
+			preferred = podSpec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+			if podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+				required = podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+			}
+		}
+		if !reflect.DeepEqual(preferred, test.expectPreferred) {
+			t.Errorf("%s: expected preferred terms %+v, got %+v", test.description, test.expectPreferred, preferred)
+		}
+		if !reflect.DeepEqual(required, test.expectRequired) {
+			t.Errorf("%s: expected required terms %+v, got %+v", test.description, test.expectRequired, required)
+		}
+	}
+}
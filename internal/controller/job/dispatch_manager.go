@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// DispatchDecision is the outcome of placing a job in the dispatch line of its queue
+type DispatchDecision struct {
+	// Dispatched is true if the Job of the job may be created
+	Dispatched bool
+
+	// Reason is a machine-readable reason for the decision
+	Reason string
+
+	// Message is a human-readable explanation of the decision
+	Message string
+}
+
+// DispatchManager holds the jobs of queues with a dispatch config back until they are next in
+// line, so jobs start in order of priority and waiting time rather than the order their Jobs
+// happened to be created in
+type DispatchManager struct {
+	apiReader client.Reader
+}
+
+// NewDispatchManager creates a new dispatch manager. Jobs are listed through apiReader, so the
+// jobs dispatched by an earlier reconcile are seen.
+func NewDispatchManager(apiReader client.Reader) *DispatchManager {
+	return &DispatchManager{
+		apiReader: apiReader,
+	}
+}
+
+// CheckDispatch places a job in the dispatch line of its kai-scheduler queue. Waiting jobs are
+// ordered by priority, raised by one level per aging interval they waited, then creation time.
+// The line is dispatched from its head while the GPUs of the dispatched jobs fit the GPU quota
+// and their count fits the dispatched job limit, so a large job at the head is not overtaken by
+// the smaller jobs behind it. With backfill, the jobs behind a head waiting for GPUs are
+// dispatched if they fit the free GPUs and their estimated duration ends before the head could
+// start. It returns nil for queues without a dispatch config and for jobs that were dispatched,
+// including those whose Job was created before dispatch was configured.
+func (dm *DispatchManager) CheckDispatch(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, now time.Time) (*DispatchDecision, error) {
+	if jq.Spec.Dispatch == nil || isDispatched(job) {
+		return nil, nil
+	}
+	queue := getKaiQueueName(job, jq)
+	if job.Spec.Suspend {
+		return &DispatchDecision{Reason: "Suspended", Message: "Job is dispatched once it is resumed"}, nil
+	}
+
+	jobs := &torchrunv1alpha1.TorchrunJobList{}
+	if err := dm.apiReader.List(ctx, jobs); err != nil {
+		return nil, fmt.Errorf("failed to list jobs of queue %s: %w", jq.Name, err)
+	}
+	used := 0
+	// The listed copy of the job may lag behind its conditions
+	waiting := []*torchrunv1alpha1.TorchrunJob{job}
+	var active []*torchrunv1alpha1.TorchrunJob
+	for i := range jobs.Items {
+		other := &jobs.Items[i]
+		if other.UID == job.UID || other.Spec.Queue != job.Spec.Queue || getQueueNamespace(other) != getQueueNamespace(job) || other.Spec.ChildQueue != job.Spec.ChildQueue {
+			continue
+		}
+		if isTerminalPhase(other.Status.Phase) || other.Spec.Suspend {
+			continue
+		}
+		switch {
+		case isDispatched(other):
+			gpus, err := getJobGPUs(other, jq)
+			if err != nil {
+				return nil, err
+			}
+			used += gpus
+			active = append(active, other)
+		case isWaitingForDispatch(other):
+			waiting = append(waiting, other)
+		}
+	}
+	sortQueuedJobs(waiting, jq, now)
+
+	quota := getQueueGPUQuota(job, jq)
+	maxJobs := int(jq.Spec.Dispatch.MaxDispatchedJobs)
+	// The job at the head of the line that waits for GPUs, the time it could start and what it
+	// waits for
+	var head *torchrunv1alpha1.TorchrunJob
+	var headStart *time.Time
+	var headBlocked string
+	for _, other := range waiting {
+		gpus, err := getJobGPUs(other, jq)
+		if err != nil {
+			return nil, err
+		}
+		dispatched := len(active)
+		// A job larger than the quota is dispatched alone, the scheduler may lend it GPUs
+		var blocked string
+		overQuota := false
+		switch {
+		case maxJobs > 0 && dispatched >= maxJobs:
+			blocked = fmt.Sprintf("%d of %d dispatched jobs to finish", dispatched-maxJobs+1, maxJobs)
+		case quota > 0 && dispatched > 0 && used+gpus > quota:
+			blocked = fmt.Sprintf("%d GPUs, %d of the %d GPUs of the quota are dispatched", used+gpus-quota, used, quota)
+			overQuota = true
+		}
+
+		if head != nil {
+			// Behind the head only jobs that release their GPUs before it could start are dispatched
+			estimate := other.Spec.EstimatedDuration
+			fits := blocked == "" && estimate != nil && !now.Add(estimate.Duration).After(*headStart)
+			if other.UID == job.UID && fits {
+				return &DispatchDecision{Dispatched: true, Reason: "Backfilled", Message: fmt.Sprintf(
+					"Job is backfilled in the dispatch line of queue %s, its estimated duration ends before %s could start at %s",
+					queue, head.Name, headStart.Format(time.RFC3339))}, nil
+			}
+			if other.UID == job.UID {
+				return &DispatchDecision{Reason: "WaitingForDispatch", Message: fmt.Sprintf(
+					"Waiting in the dispatch line of queue %s for %s", queue, headBlocked)}, nil
+			}
+			if fits {
+				used += gpus
+				active = append(active, other)
+			}
+			continue
+		}
+
+		if blocked != "" && overQuota && jq.Spec.Dispatch.Backfill && other.UID != job.UID {
+			// The head needs all GPUs of the quota if it has more
+			headStart, err = estimateStartTime(min(gpus, quota), active, jq, quota, now)
+			if err != nil {
+				return nil, err
+			}
+			if headStart != nil {
+				head, headBlocked = other, blocked
+				continue
+			}
+		}
+		// The position changes while the job waits, status.queuePosition follows it
+		if blocked != "" {
+			return &DispatchDecision{Reason: "WaitingForDispatch", Message: fmt.Sprintf(
+				"Waiting in the dispatch line of queue %s for %s", queue, blocked)}, nil
+		}
+		if other.UID == job.UID {
+			return &DispatchDecision{Dispatched: true, Reason: "Dispatched", Message: fmt.Sprintf(
+				"Job is next in the dispatch line of queue %s", queue)}, nil
+		}
+		used += gpus
+		active = append(active, other)
+	}
+	return nil, fmt.Errorf("job %s is missing from the dispatch line of queue %s", job.Name, queue)
+}
+
+// isDispatched returns true if the Job of the job may be created: it was dispatched, or its Job
+// was created before its queue dispatched jobs
+func isDispatched(job *torchrunv1alpha1.TorchrunJob) bool {
+	return isConditionTrue(job, "Dispatched") || (isConditionTrue(job, "JobCreated") && !hasCondition(job, "Dispatched"))
+}
+
+// isWaitingForDispatch returns true if the job waits in the dispatch line of its queue
+func isWaitingForDispatch(job *torchrunv1alpha1.TorchrunJob) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == "Dispatched" {
+			return condition.Status == "False" && condition.Reason == "WaitingForDispatch"
+		}
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestCheckDispatch(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// A job of the queue with 8 GPUs per node
+	trainingJob := func(name string, nodes int, created time.Time, dispatched string) *torchrunv1alpha1.TorchrunJob {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				UID:               types.UID(name + "-uid"),
+				CreationTimestamp: metav1.NewTime(created),
+			},
+			Spec:   torchrunv1alpha1.TorchrunJobSpec{Queue: "research", NumNodes: nodes},
+			Status: torchrunv1alpha1.TorchrunJobStatus{Phase: torchrunv1alpha1.PhaseQueued},
+		}
+		switch dispatched {
+		case "True":
+			job.Status.Conditions = []torchrunv1alpha1.TorchrunJobCondition{{Type: "Dispatched", Status: "True", Reason: "Dispatched"}}
+		case "False":
+			job.Status.Conditions = []torchrunv1alpha1.TorchrunJobCondition{{Type: "Dispatched", Status: "False", Reason: "WaitingForDispatch"}}
+		}
+		return job
+	}
+	withPriority := func(job *torchrunv1alpha1.TorchrunJob, priority string) *torchrunv1alpha1.TorchrunJob {
+		job.Spec.Priority = priority
+		return job
+	}
+	withPhase := func(job *torchrunv1alpha1.TorchrunJob, phase string) *torchrunv1alpha1.TorchrunJob {
+		job.Status.Phase = phase
+		return job
+	}
+	withEstimate := func(job *torchrunv1alpha1.TorchrunJob, estimate time.Duration) *torchrunv1alpha1.TorchrunJob {
+		job.Spec.EstimatedDuration = &metav1.Duration{Duration: estimate}
+		return job
+	}
+	withDeadline := func(job *torchrunv1alpha1.TorchrunJob, deadline time.Time) *torchrunv1alpha1.TorchrunJob {
+		job.Status.DeadlineTime = &metav1.Time{Time: deadline}
+		return job
+	}
+	created := func(job *torchrunv1alpha1.TorchrunJob) *torchrunv1alpha1.TorchrunJob {
+		job.Status.Conditions = []torchrunv1alpha1.TorchrunJobCondition{{Type: "JobCreated", Status: "True"}}
+		return job
+	}
+
+	tests := []struct {
+		description      string
+		dispatch         *torchrunv1alpha1.DispatchConfig
+		nodes            int
+		priority         string
+		suspend          bool
+		estimate         time.Duration
+		existing         []client.Object
+		expectDecision   bool
+		expectDispatched bool
+		expectReason     string
+		expectMessage    string
+	}{
+		{
+			description: "queue without dispatch config",
+			nodes:       1,
+		},
+		{
+			description:      "job fitting the quota is dispatched",
+			dispatch:         &torchrunv1alpha1.DispatchConfig{},
+			nodes:            2,
+			existing:         []client.Object{trainingJob("running", 2, now.Add(-2*time.Hour), "True")},
+			expectDecision:   true,
+			expectDispatched: true,
+			expectReason:     "Dispatched",
+			expectMessage:    "Job is next in the dispatch line of queue research",
+		},
+		{
+			description: "jobs created before dispatch was configured hold their GPUs",
+			dispatch:    &torchrunv1alpha1.DispatchConfig{},
+			nodes:       2,
+			existing: []client.Object{
+				created(trainingJob("legacy", 3, now.Add(-2*time.Hour), "")),
+				withPhase(trainingJob("finished", 4, now.Add(-2*time.Hour), "True"), torchrunv1alpha1.PhaseSucceeded),
+			},
+			expectDecision: true,
+			expectReason:   "WaitingForDispatch",
+			expectMessage:  "Waiting in the dispatch line of queue research for 8 GPUs, 24 of the 32 GPUs of the quota are dispatched",
+		},
+		{
+			description: "large job at the head is not overtaken",
+			dispatch:    &torchrunv1alpha1.DispatchConfig{},
+			nodes:       1,
+			existing: []client.Object{
+				trainingJob("running", 2, now.Add(-3*time.Hour), "True"),
+				trainingJob("large", 3, now.Add(-2*time.Hour), "False"),
+			},
+			expectDecision: true,
+			expectReason:   "WaitingForDispatch",
+			expectMessage:  "Waiting in the dispatch line of queue research for 8 GPUs, 16 of the 32 GPUs of the quota are dispatched",
+		},
+		{
+			description: "higher priority goes first",
+			dispatch:    &torchrunv1alpha1.DispatchConfig{MaxDispatchedJobs: 2},
+			nodes:       1,
+			priority:    torchrunv1alpha1.PriorityHigh,
+			existing: []client.Object{
+				trainingJob("running", 1, now.Add(-3*time.Hour), "True"),
+				trainingJob("older", 1, now.Add(-2*time.Hour), "False"),
+			},
+			expectDecision:   true,
+			expectDispatched: true,
+			expectReason:     "Dispatched",
+			expectMessage:    "Job is next in the dispatch line of queue research",
+		},
+		{
+			description: "dispatched job limit holds the line",
+			dispatch:    &torchrunv1alpha1.DispatchConfig{MaxDispatchedJobs: 2},
+			nodes:       1,
+			existing: []client.Object{
+				trainingJob("running", 1, now.Add(-3*time.Hour), "True"),
+				trainingJob("older", 1, now.Add(-2*time.Hour), "False"),
+			},
+			expectDecision: true,
+			expectReason:   "WaitingForDispatch",
+			expectMessage:  "Waiting in the dispatch line of queue research for 1 of 2 dispatched jobs to finish",
+		},
+		{
+			description: "aged preemptible job overtakes newer normal jobs",
+			dispatch:    &torchrunv1alpha1.DispatchConfig{MaxDispatchedJobs: 1, AgingSeconds: 3600},
+			nodes:       1,
+			priority:    torchrunv1alpha1.PriorityPreemptible,
+			existing: []client.Object{
+				trainingJob("newer", 1, now.Add(-30*time.Minute), "False"),
+			},
+			expectDecision:   true,
+			expectDispatched: true,
+			expectReason:     "Dispatched",
+			expectMessage:    "Job is next in the dispatch line of queue research",
+		},
+		{
+			description: "job larger than the quota is dispatched alone",
+			dispatch:    &torchrunv1alpha1.DispatchConfig{},
+			nodes:       5,
+			existing: []client.Object{
+				withPhase(trainingJob("failed", 1, now.Add(-3*time.Hour), "True"), torchrunv1alpha1.PhaseFailed),
+			},
+			expectDecision:   true,
+			expectDispatched: true,
+			expectReason:     "Dispatched",
+			expectMessage:    "Job is next in the dispatch line of queue research",
+		},
+		{
+			description: "short job is backfilled ahead of a large job",
+			dispatch:    &torchrunv1alpha1.DispatchConfig{Backfill: true},
+			nodes:       1,
+			estimate:    time.Hour,
+			existing: []client.Object{
+				withDeadline(trainingJob("running", 2, now.Add(-3*time.Hour), "True"), now.Add(2*time.Hour)),
+				trainingJob("large", 3, now.Add(-2*time.Hour), "False"),
+			},
+			expectDecision:   true,
+			expectDispatched: true,
+			expectReason:     "Backfilled",
+			expectMessage:    "Job is backfilled in the dispatch line of queue research, its estimated duration ends before large could start at 2024-05-01T14:00:00Z",
+		},
+		{
+			description: "job ending after the large job could start is not backfilled",
+			dispatch:    &torchrunv1alpha1.DispatchConfig{Backfill: true},
+			nodes:       1,
+			estimate:    3 * time.Hour,
+			existing: []client.Object{
+				withDeadline(trainingJob("running", 2, now.Add(-3*time.Hour), "True"), now.Add(2*time.Hour)),
+				trainingJob("large", 3, now.Add(-2*time.Hour), "False"),
+			},
+			expectDecision: true,
+			expectReason:   "WaitingForDispatch",
+			expectMessage:  "Waiting in the dispatch line of queue research for 8 GPUs, 16 of the 32 GPUs of the quota are dispatched",
+		},
+		{
+			description: "backfilled jobs ahead fill the free GPUs",
+			dispatch:    &torchrunv1alpha1.DispatchConfig{Backfill: true},
+			nodes:       1,
+			estimate:    time.Hour,
+			existing: []client.Object{
+				withDeadline(trainingJob("running", 2, now.Add(-3*time.Hour), "True"), now.Add(2*time.Hour)),
+				trainingJob("large", 3, now.Add(-2*time.Hour), "False"),
+				withEstimate(trainingJob("backfill-a", 1, now.Add(-100*time.Minute), "False"), time.Hour),
+				withEstimate(trainingJob("backfill-b", 1, now.Add(-95*time.Minute), "False"), time.Hour),
+			},
+			expectDecision: true,
+			expectReason:   "WaitingForDispatch",
+			expectMessage:  "Waiting in the dispatch line of queue research for 8 GPUs, 16 of the 32 GPUs of the quota are dispatched",
+		},
+		{
+			description: "no backfill while the large job cannot be placed in time",
+			dispatch:    &torchrunv1alpha1.DispatchConfig{Backfill: true},
+			nodes:       1,
+			estimate:    time.Hour,
+			existing: []client.Object{
+				trainingJob("running", 2, now.Add(-3*time.Hour), "True"),
+				trainingJob("large", 3, now.Add(-2*time.Hour), "False"),
+			},
+			expectDecision: true,
+			expectReason:   "WaitingForDispatch",
+			expectMessage:  "Waiting in the dispatch line of queue research for 8 GPUs, 16 of the 32 GPUs of the quota are dispatched",
+		},
+		{
+			description:    "suspended job waits until it is resumed",
+			dispatch:       &torchrunv1alpha1.DispatchConfig{},
+			nodes:          1,
+			suspend:        true,
+			expectDecision: true,
+			expectReason:   "Suspended",
+			expectMessage:  "Job is dispatched once it is resumed",
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"},
+			Spec: torchrunv1alpha1.JobQueueSpec{
+				Queue: torchrunv1alpha1.QueueConfig{
+					Name:      "research",
+					Resources: torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: 32}},
+				},
+				PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+					Spec: runtime.RawExtension{Raw: []byte(`{"containers":[{"name":"trainer","resources":{"requests":{"nvidia.com/gpu":"8"}}}]}`)},
+				},
+				Priorities: torchrunv1alpha1.QueuePriorityConfig{Default: torchrunv1alpha1.PriorityNormal},
+				Dispatch:   test.dispatch,
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(test.existing...).Build()
+		job := withPriority(trainingJob("train", test.nodes, now.Add(-90*time.Minute), ""), test.priority)
+		job.Spec.Suspend = test.suspend
+		if test.estimate != 0 {
+			job = withEstimate(job, test.estimate)
+		}
+
+		decision, err := NewDispatchManager(c).CheckDispatch(context.Background(), job, jq, now)
+		if err != nil {
+			t.Fatalf("%s: CheckDispatch() error = %v", test.description, err)
+		}
+		if (decision != nil) != test.expectDecision {
+			t.Errorf("%s: expected decision %v, got %v", test.description, test.expectDecision, decision)
+			continue
+		}
+		if decision == nil {
+			continue
+		}
+		if decision.Dispatched != test.expectDispatched || decision.Reason != test.expectReason || decision.Message != test.expectMessage {
+			t.Errorf("%s: expected %v %s %q, got %v %s %q", test.description,
+				test.expectDispatched, test.expectReason, test.expectMessage, decision.Dispatched, decision.Reason, decision.Message)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// DisruptionManager protects the worker pods of running jobs from voluntary disruptions
+type DisruptionManager struct {
+	client client.Client
+}
+
+// NewDisruptionManager creates a new disruption manager
+func NewDisruptionManager(client client.Client) *DisruptionManager {
+	return &DisruptionManager{
+		client: client,
+	}
+}
+
+// EnsurePodDisruptionBudget creates a PodDisruptionBudget that allows no worker pod of a running
+// job to be evicted, so node drains and autoscaler scale-downs wait for the job instead of
+// killing it. The budget is removed once the job stops running or opts out.
+func (dm *DisruptionManager) EnsurePodDisruptionBudget(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) error {
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GetPodDisruptionBudgetName(job),
+			Namespace: job.Namespace,
+		},
+	}
+	if job.Spec.Reliability.DisablePodDisruptionBudget || job.Status.Phase != torchrunv1alpha1.PhaseRunning {
+		return dm.deletePodDisruptionBudget(ctx, pdb)
+	}
+
+	op, err := controllerutil.CreateOrUpdate(ctx, dm.client, pdb, func() error {
+		maxUnavailable := intstr.FromInt32(0)
+
+		pdb.Labels = map[string]string{
+			"torchrun.ai/job-id":    job.Spec.JobID,
+			"torchrun.ai/job-name":  job.Spec.JobName,
+			"torchrun.ai/job-queue": job.Spec.Queue,
+		}
+		pdb.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(job, job.GroupVersionKind())}
+		pdb.Spec.MaxUnavailable = &maxUnavailable
+		pdb.Spec.MinAvailable = nil
+		pdb.Spec.Selector = &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"app":                "torchrun",
+				"torchrun.ai/job-id": job.Spec.JobID,
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reconcile pod disruption budget: %w", err)
+	}
+	if op != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info("Reconciled pod disruption budget", "name", pdb.Name, "operation", op)
+	}
+	return nil
+}
+
+// deletePodDisruptionBudget deletes the PodDisruptionBudget of a job if it exists
+func (dm *DisruptionManager) deletePodDisruptionBudget(ctx context.Context, pdb *policyv1.PodDisruptionBudget) error {
+	// Check the cache first so a missing budget does not cost a DELETE on every reconcile
+	if err := dm.client.Get(ctx, client.ObjectKeyFromObject(pdb), pdb); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	log.FromContext(ctx).Info("Deleting pod disruption budget", "name", pdb.Name)
+	return client.IgnoreNotFound(dm.client.Delete(ctx, pdb))
+}
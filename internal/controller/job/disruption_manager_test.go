@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestEnsurePodDisruptionBudget(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	tests := []struct {
+		description string
+		phase       string
+		disabled    bool
+		expectPDB   bool
+	}{
+		{
+			description: "running job is protected",
+			phase:       torchrunv1alpha1.PhaseRunning,
+			expectPDB:   true,
+		},
+		{
+			description: "queued job is not protected",
+			phase:       torchrunv1alpha1.PhaseQueued,
+		},
+		{
+			description: "finished job is not protected",
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+		},
+		{
+			description: "running job opted out",
+			phase:       torchrunv1alpha1.PhaseRunning,
+			disabled:    true,
+		},
+	}
+
+	for _, test := range tests {
+		c := fake.NewClientBuilder().WithScheme(scheme).Build()
+		dm := NewDisruptionManager(c)
+		job := &torchrunv1alpha1.TorchrunJob{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "torchrun.ai/v1alpha1", Kind: "TorchrunJob"},
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default", UID: "train-uid"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{JobID: "train-1", JobName: "train", Queue: "research"},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{Phase: torchrunv1alpha1.PhaseRunning},
+		}
+
+		// The budget of the running job exists before the change under test
+		if err := dm.EnsurePodDisruptionBudget(context.Background(), job); err != nil {
+			t.Fatalf("%s: EnsurePodDisruptionBudget() error = %v", test.description, err)
+		}
+		job.Status.Phase = test.phase
+		job.Spec.Reliability.DisablePodDisruptionBudget = test.disabled
+		if err := dm.EnsurePodDisruptionBudget(context.Background(), job); err != nil {
+			t.Fatalf("%s: EnsurePodDisruptionBudget() error = %v", test.description, err)
+		}
+
+		pdb := &policyv1.PodDisruptionBudget{}
+		err := c.Get(context.Background(), types.NamespacedName{Name: "train-workers", Namespace: "default"}, pdb)
+		if !test.expectPDB {
+			if !errors.IsNotFound(err) {
+				t.Errorf("%s: expected no pod disruption budget, got %v", test.description, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: expected a pod disruption budget, got %v", test.description, err)
+		}
+		if pdb.Spec.MaxUnavailable == nil || pdb.Spec.MaxUnavailable.IntValue() != 0 {
+			t.Errorf("%s: expected maxUnavailable 0, got %v", test.description, pdb.Spec.MaxUnavailable)
+		}
+		selector := pdb.Spec.Selector.MatchLabels
+		if selector["app"] != "torchrun" || selector["torchrun.ai/job-id"] != "train-1" {
+			t.Errorf("%s: expected the worker pods to be selected, got %v", test.description, selector)
+		}
+		if len(pdb.OwnerReferences) != 1 || pdb.OwnerReferences[0].Name != "train" {
+			t.Errorf("%s: expected the job to own the budget, got %v", test.description, pdb.OwnerReferences)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// Reasons a trainer container exited with, recorded in status.exitInfo
+const (
+	ExitReasonCompleted       = "Completed"
+	ExitReasonOOMKilled       = "OOMKilled"
+	ExitReasonSegfault        = "Segfault"
+	ExitReasonPythonException = "PythonException"
+	ExitReasonSignal          = "Signal"
+	ExitReasonError           = "Error"
+)
+
+// maxExitMessageLength limits the message recorded for a rank
+const maxExitMessageLength = 256
+
+// segfaultPattern matches the termination messages of a trainer whose training process crashed
+// with a segmentation fault. torchrun exits with code 1 and reports the signal of the process.
+var segfaultPattern = regexp.MustCompile(`SIGSEGV|Segmentation fault`)
+
+// pythonExceptionPattern matches the last line of a Python traceback, e.g.
+// "torch.cuda.OutOfMemoryError: CUDA out of memory", with the rank prefix torchrun adds to the
+// output of its worker processes
+var pythonExceptionPattern = regexp.MustCompile(`^(?:\[(?:default)?rank\d+\]:\s*)?([A-Za-z_][\w.]*(?:Error|Exception|Interrupt))(?::\s*(.*))?$`)
+
+// childFailedError is the exception torchrun raises when a worker process fails. It only
+// summarizes the failure, the exception of the worker comes before it.
+const childFailedError = "torch.distributed.elastic.multiprocessing.errors.ChildFailedError"
+
+// attachTerminationMessagePolicy falls back to the end of the trainer logs for the termination
+// message of a failed trainer, so the exception of the training process is in the pod status.
+// A policy the queue pod template sets is kept.
+func attachTerminationMessagePolicy(podSpec *corev1.PodSpec) {
+	trainer := &podSpec.Containers[0]
+	if trainer.TerminationMessagePolicy == "" {
+		trainer.TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+	}
+}
+
+// recordExitInfo records how the trainer of rank 0 and of every failed rank exited once the job
+// finished. The info is kept when the pods of the job are gone.
+func recordExitInfo(job *torchrunv1alpha1.TorchrunJob, pods []corev1.Pod, phase string) {
+	switch phase {
+	case torchrunv1alpha1.PhaseSucceeded, torchrunv1alpha1.PhaseFailed, torchrunv1alpha1.PhaseTimedOut:
+	default:
+		return
+	}
+
+	var ranks []torchrunv1alpha1.RankExit
+	for i := range pods {
+		rank, ok := getRankExit(&pods[i])
+		if !ok || (rank.Rank != 0 && rank.ExitCode == 0) {
+			continue
+		}
+		ranks = append(ranks, rank)
+	}
+	if len(ranks) == 0 {
+		return
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		if ranks[i].Rank != ranks[j].Rank {
+			return ranks[i].Rank < ranks[j].Rank
+		}
+		return ranks[i].Pod < ranks[j].Pod
+	})
+
+	// The rank that failed first is the cause, the others usually fail on its absence
+	cause := &ranks[0]
+	for i := range ranks {
+		rank := &ranks[i]
+		if rank.ExitCode == 0 {
+			continue
+		}
+		if cause.ExitCode == 0 || exitedBefore(rank, cause) {
+			cause = rank
+		}
+	}
+
+	attempt := job.Status.Attempt
+	if attempt < 1 {
+		attempt = 1
+	}
+	job.Status.ExitInfo = &torchrunv1alpha1.ExitInfo{
+		Attempt: attempt,
+		Reason:  cause.Reason,
+		Message: cause.Message,
+		Ranks:   ranks,
+	}
+}
+
+// exitedBefore reports whether a rank exited before another, ranks without a time last
+func exitedBefore(a, b *torchrunv1alpha1.RankExit) bool {
+	if a.FinishedAt == nil {
+		return false
+	}
+	return b.FinishedAt == nil || a.FinishedAt.Before(b.FinishedAt)
+}
+
+// getRankExit returns how the trainer of a worker pod last exited: its current state, or the
+// last state of a trainer restarted in place
+func getRankExit(pod *corev1.Pod) (torchrunv1alpha1.RankExit, bool) {
+	// Indexed Jobs record the rank of each pod in this annotation
+	rank, err := strconv.Atoi(pod.Annotations[batchv1.JobCompletionIndexAnnotation])
+	if err != nil {
+		return torchrunv1alpha1.RankExit{}, false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != "trainer" {
+			continue
+		}
+		terminated := status.State.Terminated
+		if terminated == nil {
+			terminated = status.LastTerminationState.Terminated
+		}
+		if terminated == nil {
+			return torchrunv1alpha1.RankExit{}, false
+		}
+		reason, message := classifyExit(terminated)
+		exit := torchrunv1alpha1.RankExit{
+			Rank:            int32(rank),
+			Pod:             pod.Name,
+			ExitCode:        terminated.ExitCode,
+			Reason:          reason,
+			ContainerReason: terminated.Reason,
+			Message:         message,
+		}
+		if !terminated.FinishedAt.IsZero() {
+			exit.FinishedAt = &metav1.Time{Time: terminated.FinishedAt.Time}
+		}
+		return exit, true
+	}
+	return torchrunv1alpha1.RankExit{}, false
+}
+
+// classifyExit tells apart the ways a trainer container exits from its exit code, reason and
+// termination message, and returns the line of the message that explains it
+func classifyExit(terminated *corev1.ContainerStateTerminated) (string, string) {
+	lines := strings.Split(strings.TrimSpace(terminated.Message), "\n")
+	switch {
+	case terminated.ExitCode == 0:
+		return ExitReasonCompleted, ""
+
+	case terminated.Reason == "OOMKilled":
+		return ExitReasonOOMKilled, "The trainer exceeded its memory limit"
+
+	case terminated.ExitCode == 128+11:
+		return ExitReasonSegfault, lastLine(lines)
+	}
+
+	for _, line := range lines {
+		if segfaultPattern.MatchString(line) {
+			return ExitReasonSegfault, truncateExitMessage(strings.TrimSpace(line))
+		}
+	}
+	if exception := findPythonException(lines); exception != "" {
+		return ExitReasonPythonException, exception
+	}
+	if terminated.ExitCode > 128 {
+		return ExitReasonSignal, lastLine(lines)
+	}
+	return ExitReasonError, lastLine(lines)
+}
+
+// findPythonException returns the last exception line of the tracebacks in the termination
+// message, skipping the summary of torchrun
+func findPythonException(lines []string) string {
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		match := pythonExceptionPattern.FindStringSubmatch(line)
+		if match == nil || match[1] == childFailedError {
+			continue
+		}
+		exception := match[1]
+		if match[2] != "" {
+			exception += ": " + match[2]
+		}
+		return truncateExitMessage(exception)
+	}
+	return ""
+}
+
+// lastLine returns the last non-empty line of the termination message
+func lastLine(lines []string) string {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return truncateExitMessage(line)
+		}
+	}
+	return ""
+}
+
+func truncateExitMessage(message string) string {
+	if len(message) > maxExitMessageLength {
+		return message[:maxExitMessageLength]
+	}
+	return message
+}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestClassifyExit(t *testing.T) {
+	torchrunSummary := `torch.distributed.elastic.multiprocessing.errors.ChildFailedError:
+============================================================
+train.py FAILED
+------------------------------------------------------------
+Root Cause (first observed failure):
+[0]:
+  rank      : 0 (local_rank: 0)
+  exitcode  : 1 (pid: 42)
+  error_file: <N/A>
+============================================================`
+
+	tests := []struct {
+		description   string
+		terminated    corev1.ContainerStateTerminated
+		expectReason  string
+		expectMessage string
+	}{
+		{
+			description:  "completed",
+			terminated:   corev1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"},
+			expectReason: ExitReasonCompleted,
+		},
+		{
+			description:   "killed over the memory limit",
+			terminated:    corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"},
+			expectReason:  ExitReasonOOMKilled,
+			expectMessage: "The trainer exceeded its memory limit",
+		},
+		{
+			description:   "segfault of the trainer",
+			terminated:    corev1.ContainerStateTerminated{ExitCode: 139, Reason: "Error", Message: "loading data\n"},
+			expectReason:  ExitReasonSegfault,
+			expectMessage: "loading data",
+		},
+		{
+			description: "segfault of a worker process reported by torchrun",
+			terminated: corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error",
+				Message: "step 10\n  exitcode  : -11 (pid: 42)\n  traceback : Signal 11 (SIGSEGV) received by PID 42\n"},
+			expectReason:  ExitReasonSegfault,
+			expectMessage: "traceback : Signal 11 (SIGSEGV) received by PID 42",
+		},
+		{
+			description: "python exception of a worker process",
+			terminated: corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error",
+				Message: "[rank0]: Traceback (most recent call last):\n[rank0]:   File \"train.py\", line 10, in <module>\n" +
+					"[rank0]: torch.OutOfMemoryError: CUDA out of memory. Tried to allocate 2.00 GiB\n" + torchrunSummary},
+			expectReason:  ExitReasonPythonException,
+			expectMessage: "torch.OutOfMemoryError: CUDA out of memory. Tried to allocate 2.00 GiB",
+		},
+		{
+			description: "python exception without a message",
+			terminated: corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error",
+				Message: "Traceback (most recent call last):\n  File \"train.py\", line 3, in <module>\nKeyboardInterrupt\n"},
+			expectReason:  ExitReasonPythonException,
+			expectMessage: "KeyboardInterrupt",
+		},
+		{
+			description:   "terminated by a signal",
+			terminated:    corev1.ContainerStateTerminated{ExitCode: 143, Reason: "Error", Message: "step 20\n"},
+			expectReason:  ExitReasonSignal,
+			expectMessage: "step 20",
+		},
+		{
+			description:   "other error",
+			terminated:    corev1.ContainerStateTerminated{ExitCode: 2, Reason: "Error", Message: "python: can't open file 'train.py'\n"},
+			expectReason:  ExitReasonError,
+			expectMessage: "python: can't open file 'train.py'",
+		},
+	}
+
+	for _, test := range tests {
+		reason, message := classifyExit(&test.terminated)
+		if reason != test.expectReason || message != test.expectMessage {
+			t.Errorf("%s: expected %s %q, got %s %q", test.description, test.expectReason, test.expectMessage, reason, message)
+		}
+	}
+}
+
+func TestRecordExitInfo(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	// A worker pod of the given rank whose trainer exited at the given offset from now
+	pod := func(rank string, exitCode int32, reason, message string, offset time.Duration) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "train-" + rank,
+				Annotations: map[string]string{batchv1.JobCompletionIndexAnnotation: rank},
+			},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "trainer",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					ExitCode: exitCode, Reason: reason, Message: message, FinishedAt: metav1.NewTime(now.Add(offset)),
+				}},
+			}}},
+		}
+	}
+	at := func(offset time.Duration) *metav1.Time {
+		return &metav1.Time{Time: now.Add(offset)}
+	}
+	previous := &torchrunv1alpha1.ExitInfo{Attempt: 1, Reason: ExitReasonError, Ranks: []torchrunv1alpha1.RankExit{
+		{Rank: 0, Pod: "train-0", ExitCode: 1, Reason: ExitReasonError},
+	}}
+
+	tests := []struct {
+		description string
+		phase       string
+		attempt     int32
+		pods        []corev1.Pod
+		previous    *torchrunv1alpha1.ExitInfo
+		expect      *torchrunv1alpha1.ExitInfo
+	}{
+		{
+			description: "running job",
+			phase:       torchrunv1alpha1.PhaseRunning,
+			pods:        []corev1.Pod{pod("0", 1, "Error", "ValueError: bad config", 0)},
+		},
+		{
+			description: "succeeded job records rank 0",
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+			pods:        []corev1.Pod{pod("1", 0, "Completed", "", 0), pod("0", 0, "Completed", "", 0)},
+			expect: &torchrunv1alpha1.ExitInfo{Attempt: 1, Reason: ExitReasonCompleted, Ranks: []torchrunv1alpha1.RankExit{
+				{Rank: 0, Pod: "train-0", ExitCode: 0, Reason: ExitReasonCompleted, ContainerReason: "Completed", FinishedAt: at(0)},
+			}},
+		},
+		{
+			description: "failed job records the rank that failed first",
+			phase:       torchrunv1alpha1.PhaseFailed,
+			attempt:     2,
+			pods: []corev1.Pod{
+				pod("0", 1, "Error", "RuntimeError: NCCL communicator was aborted", time.Minute),
+				pod("1", 0, "Completed", "", 0),
+				pod("2", 137, "OOMKilled", "", 0),
+			},
+			expect: &torchrunv1alpha1.ExitInfo{
+				Attempt: 2,
+				Reason:  ExitReasonOOMKilled,
+				Message: "The trainer exceeded its memory limit",
+				Ranks: []torchrunv1alpha1.RankExit{
+					{Rank: 0, Pod: "train-0", ExitCode: 1, Reason: ExitReasonPythonException, ContainerReason: "Error",
+						Message: "RuntimeError: NCCL communicator was aborted", FinishedAt: at(time.Minute)},
+					{Rank: 2, Pod: "train-2", ExitCode: 137, Reason: ExitReasonOOMKilled, ContainerReason: "OOMKilled",
+						Message: "The trainer exceeded its memory limit", FinishedAt: at(0)},
+				},
+			},
+		},
+		{
+			description: "info is kept once the pods are gone",
+			phase:       torchrunv1alpha1.PhaseFailed,
+			previous:    previous,
+			expect:      previous,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{Status: torchrunv1alpha1.TorchrunJobStatus{Attempt: test.attempt, ExitInfo: test.previous}}
+
+		recordExitInfo(job, test.pods, test.phase)
+		if !reflect.DeepEqual(job.Status.ExitInfo, test.expect) {
+			t.Errorf("%s: expected exit info %+v, got %+v", test.description, test.expect, job.Status.ExitInfo)
+		}
+	}
+}
+
+func TestAttachTerminationMessagePolicy(t *testing.T) {
+	podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}}}
+	attachTerminationMessagePolicy(podSpec)
+	if policy := podSpec.Containers[0].TerminationMessagePolicy; policy != corev1.TerminationMessageFallbackToLogsOnError {
+		t.Errorf("expected the trainer to fall back to its logs, got %q", policy)
+	}
+
+	podSpec.Containers[0].TerminationMessagePolicy = corev1.TerminationMessageReadFile
+	attachTerminationMessagePolicy(podSpec)
+	if policy := podSpec.Containers[0].TerminationMessagePolicy; policy != corev1.TerminationMessageReadFile {
+		t.Errorf("expected the policy of the queue to be kept, got %q", policy)
+	}
+}
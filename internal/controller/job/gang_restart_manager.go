@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// GangRestartResult is the state of the Rank0Failed condition of a job whose gang was restarted
+type GangRestartResult struct {
+	// Reason is a machine-readable reason for the restart
+	Reason string
+
+	// Message is a human-readable explanation of the restart, naming the failed rank 0 pod
+	Message string
+}
+
+// GangRestartManager restarts the workers of multi-node jobs on the static rendezvous backend
+// when their rank 0 worker fails. The static backend runs its TCP store in the rank 0 worker,
+// so the other workers never rendezvous with the restarted rank 0 and hang until they time out.
+type GangRestartManager struct {
+	client      client.Client
+	rdzvBackend string
+}
+
+// NewGangRestartManager creates a new gang restart manager. rdzvBackend is the rendezvous backend
+// of queues that do not set one.
+func NewGangRestartManager(client client.Client, rdzvBackend string) *GangRestartManager {
+	return &GangRestartManager{
+		client:      client,
+		rdzvBackend: rdzvBackend,
+	}
+}
+
+// RestartOnRank0Failure deletes the workers of the other ranks that started before the last
+// failure of the rank 0 trainer, so the Job recreates them and the whole gang rendezvouses with
+// the new rank 0. Workers started after the failure are kept, so a failure restarts the gang
+// once. It returns nil if no worker was deleted, and for jobs that do not use the static backend
+// or restart as a whole Job.
+func (gm *GangRestartManager) RestartOnRank0Failure(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*GangRestartResult, error) {
+	rdzvBackend := jq.Spec.Distributed.RdzvBackend
+	if rdzvBackend == "" {
+		rdzvBackend = gm.rdzvBackend
+	}
+	if rdzvBackend != "static" || job.Spec.NumNodes <= 1 || isDebugJob(job) ||
+		job.Spec.Reliability.RestartMode == torchrunv1alpha1.RestartModeWholeJob || isTerminalPhase(job.Status.Phase) {
+		return nil, nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := gm.client.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{
+		"app":                "torchrun",
+		"torchrun.ai/job-id": job.Spec.JobID,
+	}); err != nil {
+		return nil, err
+	}
+
+	var rank0 *corev1.Pod
+	var failedAt time.Time
+	var exitCode int32
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Annotations[batchv1.JobCompletionIndexAnnotation] != "0" {
+			continue
+		}
+		if failureTime, code, ok := getTrainerFailure(pod); ok && failureTime.After(failedAt) {
+			rank0, failedAt, exitCode = pod, failureTime, code
+		}
+	}
+	if rank0 == nil {
+		return nil, nil
+	}
+
+	var restarted []int
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		index := pod.Annotations[batchv1.JobCompletionIndexAnnotation]
+		if index == "0" || pod.DeletionTimestamp != nil || !pod.CreationTimestamp.Time.Before(failedAt) ||
+			pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		log.FromContext(ctx).Info("Restarting worker after rank 0 failure", "pod", pod.Name, "rank0", rank0.Name)
+		if err := gm.client.Delete(ctx, pod); err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		restarted = append(restarted, int(buildWorkerPodStatus(pod).Index))
+	}
+	if len(restarted) == 0 {
+		return nil, nil
+	}
+
+	sort.Ints(restarted)
+	return &GangRestartResult{Reason: "GangRestarted", Message: fmt.Sprintf(
+		"Rank 0 worker %s failed with exit code %d at %s, restarted %s as the static rendezvous cannot recover from a rank 0 failure",
+		rank0.Name, exitCode, failedAt.UTC().Format(time.RFC3339), describeRanks(restarted))}, nil
+}
+
+// getTrainerFailure returns when and with which exit code the trainer of a pod last failed: the
+// current state of a failed trainer, or the last state of a trainer restarted in place
+func getTrainerFailure(pod *corev1.Pod) (time.Time, int32, bool) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != "trainer" {
+			continue
+		}
+		if terminated := status.State.Terminated; terminated != nil {
+			return terminated.FinishedAt.Time, terminated.ExitCode, terminated.ExitCode != 0
+		}
+		if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return terminated.FinishedAt.Time, terminated.ExitCode, true
+		}
+	}
+	return time.Time{}, 0, false
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestRestartOnRank0Failure(t *testing.T) {
+	failedAt := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	worker := func(name string, index int, createdAt time.Time, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Labels:            map[string]string{"app": "torchrun", "torchrun.ai/job-id": "train-id"},
+				Annotations:       map[string]string{batchv1.JobCompletionIndexAnnotation: strconv.Itoa(index)},
+				CreationTimestamp: metav1.NewTime(createdAt),
+			},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+	exited := func(pod *corev1.Pod, exitCode int32, inPlace bool) *corev1.Pod {
+		terminated := &corev1.ContainerStateTerminated{ExitCode: exitCode, FinishedAt: metav1.NewTime(failedAt)}
+		status := corev1.ContainerStatus{Name: "trainer", State: corev1.ContainerState{Terminated: terminated}}
+		if inPlace {
+			status = corev1.ContainerStatus{Name: "trainer", LastTerminationState: corev1.ContainerState{Terminated: terminated}}
+		}
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{status}
+		return pod
+	}
+	before := failedAt.Add(-time.Hour)
+	after := failedAt.Add(time.Minute)
+
+	tests := []struct {
+		description   string
+		rdzvBackend   string
+		rdzvDefault   string
+		restartMode   string
+		pods          []*corev1.Pod
+		expectRestart bool
+		expectPods    []string
+	}{
+		{
+			description: "failed rank 0 restarts the other workers",
+			rdzvBackend: "static",
+			pods: []*corev1.Pod{
+				exited(worker("train-0-a", 0, before, corev1.PodFailed), 1, false),
+				worker("train-0-b", 0, after, corev1.PodRunning),
+				worker("train-1-a", 1, before, corev1.PodRunning),
+				worker("train-2-a", 2, before, corev1.PodRunning),
+			},
+			expectRestart: true,
+			expectPods:    []string{"train-0-a", "train-0-b"},
+		},
+		{
+			description: "rank 0 restarted in place restarts the other workers",
+			rdzvBackend: "static",
+			pods: []*corev1.Pod{
+				exited(worker("train-0-a", 0, before, corev1.PodRunning), 137, true),
+				worker("train-1-a", 1, before, corev1.PodRunning),
+			},
+			expectRestart: true,
+			expectPods:    []string{"train-0-a"},
+		},
+		{
+			description: "workers started after the failure are kept",
+			rdzvBackend: "static",
+			pods: []*corev1.Pod{
+				exited(worker("train-0-a", 0, before, corev1.PodFailed), 1, false),
+				worker("train-1-b", 1, after, corev1.PodRunning),
+			},
+			expectPods: []string{"train-0-a", "train-1-b"},
+		},
+		{
+			description: "succeeded rank 0 keeps the other workers",
+			rdzvBackend: "static",
+			pods: []*corev1.Pod{
+				exited(worker("train-0-a", 0, before, corev1.PodSucceeded), 0, false),
+				worker("train-1-a", 1, before, corev1.PodRunning),
+			},
+			expectPods: []string{"train-0-a", "train-1-a"},
+		},
+		{
+			description: "queue without a backend uses the static backend of the operator",
+			pods: []*corev1.Pod{
+				exited(worker("train-0-a", 0, before, corev1.PodFailed), 1, false),
+				worker("train-1-a", 1, before, corev1.PodRunning),
+			},
+			rdzvDefault:   "static",
+			expectRestart: true,
+			expectPods:    []string{"train-0-a"},
+		},
+		{
+			description: "c10d rendezvous recovers from a rank 0 failure",
+			rdzvBackend: "c10d",
+			pods: []*corev1.Pod{
+				exited(worker("train-0-a", 0, before, corev1.PodFailed), 1, false),
+				worker("train-1-a", 1, before, corev1.PodRunning),
+			},
+			expectPods: []string{"train-0-a", "train-1-a"},
+		},
+		{
+			description: "whole job restarts already restart every worker",
+			rdzvBackend: "static",
+			restartMode: torchrunv1alpha1.RestartModeWholeJob,
+			pods: []*corev1.Pod{
+				exited(worker("train-0-a", 0, before, corev1.PodFailed), 1, false),
+				worker("train-1-a", 1, before, corev1.PodRunning),
+			},
+			expectPods: []string{"train-0-a", "train-1-a"},
+		},
+	}
+
+	for _, test := range tests {
+		objects := make([]client.Object, 0, len(test.pods))
+		for _, pod := range test.pods {
+			objects = append(objects, pod)
+		}
+		c := fake.NewClientBuilder().WithObjects(objects...).Build()
+		rdzvDefault := test.rdzvDefault
+		if rdzvDefault == "" {
+			rdzvDefault = "c10d"
+		}
+		gm := NewGangRestartManager(c, rdzvDefault)
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{
+			Distributed: torchrunv1alpha1.DistributedConfig{RdzvBackend: test.rdzvBackend},
+		}}
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				JobID:       "train-id",
+				NumNodes:    3,
+				Reliability: torchrunv1alpha1.ReliabilityConfig{RestartMode: test.restartMode},
+			},
+			Status: torchrunv1alpha1.TorchrunJobStatus{Phase: torchrunv1alpha1.PhaseRunning},
+		}
+
+		result, err := gm.RestartOnRank0Failure(context.Background(), job, jq)
+		if err != nil {
+			t.Fatalf("%s: RestartOnRank0Failure() error = %v", test.description, err)
+		}
+		if (result != nil) != test.expectRestart {
+			t.Errorf("%s: expected restart %v, got %+v", test.description, test.expectRestart, result)
+		}
+
+		pods := &corev1.PodList{}
+		if err := c.List(context.Background(), pods); err != nil {
+			t.Fatalf("%s: failed to list pods: %v", test.description, err)
+		}
+		var names []string
+		for _, pod := range pods.Items {
+			names = append(names, pod.Name)
+		}
+		if !reflect.DeepEqual(names, test.expectPods) {
+			t.Errorf("%s: expected pods %v, got %v", test.description, test.expectPods, names)
+		}
+	}
+}
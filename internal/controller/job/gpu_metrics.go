@@ -0,0 +1,256 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+const (
+	// gpuMetricsContainerName is the name of the GPU metrics sidecar
+	gpuMetricsContainerName = "gpu-metrics"
+
+	// gpuMetricsVolumeName is the emptyDir the trainer writes its GPU samples to
+	gpuMetricsVolumeName = "gpu-metrics"
+
+	// gpuMetricsMountPath is where the GPU metrics volume is mounted in the trainer and the sidecar
+	gpuMetricsMountPath = "/var/run/gpu-metrics"
+
+	// gpuMetricsFile is the file of the GPU samples
+	gpuMetricsFile = gpuMetricsMountPath + "/samples"
+)
+
+// gpuMetricsSamplerScript starts the trainer command ("$0" "$@") after starting a background loop
+// that appends one line per sample with the GPU count, the average utilization and the summed
+// memory of the GPUs nvidia-smi sees. It runs in the trainer container, which sees only the GPUs
+// allocated to it. The trainer command replaces the shell, so it still receives the signals of
+// the container.
+const gpuMetricsSamplerScript = `while true; do
+  nvidia-smi --query-gpu=utilization.gpu,memory.used,memory.total --format=csv,noheader,nounits |
+    awk -F', *' '{ utilization += $1; used += $2; total += $3; gpus++ }
+      END { if (gpus) printf "gpu-metrics gpus=%d utilization=%d memoryUsedMiB=%d memoryTotalMiB=%d\n", gpus, utilization / gpus, used, total }' >> "$GPU_METRICS_FILE"
+  sleep "$GPU_METRICS_INTERVAL"
+done 2>/dev/null &
+exec "$0" "$@"`
+
+// gpuMetricsTailScript logs the samples of the trainer, waiting for the file to be created
+const gpuMetricsTailScript = `exec tail -n +1 -F "$GPU_METRICS_FILE" 2>/dev/null`
+
+// gpuMetricsSamplePattern matches a sample logged by gpuMetricsSamplerScript
+var gpuMetricsSamplePattern = regexp.MustCompile(`gpu-metrics gpus=(\d+) utilization=(\d+) memoryUsedMiB=(\d+) memoryTotalMiB=(\d+)`)
+
+// gpuMetricsSample is a sample of the GPUs of a worker
+type gpuMetricsSample struct {
+	gpus           int32
+	utilization    int32
+	memoryUsedMiB  int64
+	memoryTotalMiB int64
+}
+
+// GPUMetricsResult is the state of the LowGPUUtilization condition of a job
+type GPUMetricsResult struct {
+	// Status of the LowGPUUtilization condition: True while the GPUs of the job idle
+	Status string
+
+	// Reason is a machine-readable reason for the state
+	Reason string
+
+	// Message is a human-readable explanation of the state
+	Message string
+}
+
+// GPUMetricsManager reads the GPU samples the GPU metrics sidecars of the workers log and sums them
+// into the GPU utilization of the job
+type GPUMetricsManager struct {
+	clientset kubernetes.Interface
+}
+
+// NewGPUMetricsManager creates a new GPU metrics manager. The logs of the worker pods are read
+// through clientset, which the controller-runtime client cannot.
+func NewGPUMetricsManager(clientset kubernetes.Interface) *GPUMetricsManager {
+	return &GPUMetricsManager{
+		clientset: clientset,
+	}
+}
+
+// attachGPUMetrics samples the GPUs of workers whose trainer requests GPUs from the trainer
+// container and injects the sidecar of the queue that logs the samples for the controller. It
+// must run after the trainer command is attached and before the sidecar lifecycle, so the
+// sidecar stops with the trainer. The sidecar requests no GPUs and is given no access to them.
+func (jm *JobManager) attachGPUMetrics(jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) {
+	metrics := jq.Spec.GPUMetrics
+	trainer := &podSpec.Containers[0]
+	if metrics == nil || getTrainerGPUs(podSpec) == 0 || len(trainer.Command) == 0 {
+		return
+	}
+	image := metrics.Image
+	if image == "" {
+		image = jm.config.Images.GPUMetrics
+	}
+
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: gpuMetricsVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	})
+	mount := corev1.VolumeMount{Name: gpuMetricsVolumeName, MountPath: gpuMetricsMountPath}
+	fileEnv := corev1.EnvVar{Name: "GPU_METRICS_FILE", Value: gpuMetricsFile}
+
+	// The trainer command stays the last argument, where the other attach functions wrap it
+	trainer.Command = append([]string{"/bin/bash", "-c", gpuMetricsSamplerScript}, trainer.Command...)
+	trainer.Env = append(trainer.Env,
+		corev1.EnvVar{Name: "GPU_METRICS_INTERVAL", Value: strconv.Itoa(int(getGPUMetricsInterval(metrics).Seconds()))},
+		fileEnv,
+	)
+	trainer.VolumeMounts = append(trainer.VolumeMounts, mount)
+
+	podSpec.Containers = append(podSpec.Containers, corev1.Container{
+		Name:         gpuMetricsContainerName,
+		Image:        image,
+		Command:      []string{"/bin/sh", "-c", gpuMetricsTailScript},
+		Env:          []corev1.EnvVar{fileEnv},
+		VolumeMounts: []corev1.VolumeMount{mount},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("32Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("128Mi"),
+			},
+		},
+	})
+}
+
+// CollectGPUMetrics reads the samples of the last lowUtilizationSeconds from the GPU metrics
+// sidecars of the running workers into status.gpuUtilization, at most once per sample interval.
+// The job is flagged as low while every worker logged samples for the whole window and all of
+// them stayed below lowUtilizationPercent. It returns nil for queues without GPU metrics, jobs
+// that are not running and jobs without samples.
+func (gm *GPUMetricsManager) CollectGPUMetrics(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, now time.Time) *GPUMetricsResult {
+	metrics := jq.Spec.GPUMetrics
+	if gm.clientset == nil || metrics == nil || job.Status.Phase != torchrunv1alpha1.PhaseRunning {
+		return nil
+	}
+	interval := getGPUMetricsInterval(metrics)
+	if utilization := job.Status.GPUUtilization; utilization != nil && utilization.SampleTime != nil && now.Sub(utilization.SampleTime.Time) < interval {
+		return nil
+	}
+	threshold, window := getLowUtilization(metrics)
+	windowSamples := int64((window + interval - 1) / interval)
+
+	var workerSamples [][]gpuMetricsSample
+	for _, worker := range job.Status.Workers.Pods {
+		if worker.Phase != string(corev1.PodRunning) {
+			continue
+		}
+		logs, err := gm.clientset.CoreV1().Pods(job.Namespace).GetLogs(worker.Name, &corev1.PodLogOptions{
+			Container: gpuMetricsContainerName,
+			TailLines: &windowSamples,
+		}).DoRaw(ctx)
+		if err != nil {
+			// Workers created before the queue enabled GPU metrics have no sidecar
+			log.FromContext(ctx).V(1).Info("Failed to read GPU metrics", "pod", worker.Name, "error", err.Error())
+		}
+		workerSamples = append(workerSamples, parseGPUMetricsLogs(string(logs)))
+	}
+	status := buildGPUUtilization(workerSamples, threshold, int(windowSamples))
+	if status == nil {
+		return nil
+	}
+	status.SampleTime = &metav1.Time{Time: now}
+	job.Status.GPUUtilization = status
+
+	if status.Low {
+		return &GPUMetricsResult{Status: "True", Reason: "LowUtilization", Message: fmt.Sprintf(
+			"GPU utilization of the job stayed below %d%% for %s, %d%% of %d GPUs now", threshold, window, status.UtilizationPercent, status.GPUs)}
+	}
+	return &GPUMetricsResult{Status: "False", Reason: "UtilizationNormal", Message: fmt.Sprintf(
+		"%d%% of %d GPUs utilized", status.UtilizationPercent, status.GPUs)}
+}
+
+// buildGPUUtilization sums the last samples of the workers. The GPUs are low while every worker
+// has windowSamples samples and all of them are below threshold. It returns nil without samples.
+func buildGPUUtilization(workerSamples [][]gpuMetricsSample, threshold int32, windowSamples int) *torchrunv1alpha1.GPUUtilizationStatus {
+	status := &torchrunv1alpha1.GPUUtilizationStatus{Low: true}
+	var utilization int64
+	for _, samples := range workerSamples {
+		if len(samples) < windowSamples {
+			status.Low = false
+		}
+		for _, sample := range samples {
+			if sample.utilization >= threshold {
+				status.Low = false
+			}
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		last := samples[len(samples)-1]
+		status.GPUs += last.gpus
+		status.MemoryUsedMiB += last.memoryUsedMiB
+		status.MemoryTotalMiB += last.memoryTotalMiB
+		utilization += int64(last.utilization) * int64(last.gpus)
+	}
+	if status.GPUs == 0 {
+		return nil
+	}
+	status.UtilizationPercent = int32(utilization / int64(status.GPUs))
+	return status
+}
+
+// parseGPUMetricsLogs returns the samples in the logs of a GPU metrics sidecar, oldest first
+func parseGPUMetricsLogs(logs string) []gpuMetricsSample {
+	var samples []gpuMetricsSample
+	for _, line := range strings.Split(logs, "\n") {
+		match := gpuMetricsSamplePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		gpus, _ := strconv.ParseInt(match[1], 10, 32)
+		utilization, _ := strconv.ParseInt(match[2], 10, 32)
+		used, _ := strconv.ParseInt(match[3], 10, 64)
+		total, _ := strconv.ParseInt(match[4], 10, 64)
+		samples = append(samples, gpuMetricsSample{
+			gpus:           int32(gpus),
+			utilization:    int32(utilization),
+			memoryUsedMiB:  used,
+			memoryTotalMiB: total,
+		})
+	}
+	return samples
+}
+
+// getGPUMetricsInterval returns the time between two GPU samples
+func getGPUMetricsInterval(metrics *torchrunv1alpha1.GPUMetricsConfig) time.Duration {
+	if metrics.IntervalSeconds == 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(metrics.IntervalSeconds) * time.Second
+}
+
+// getLowUtilization returns the utilization below which GPUs idle and how long they must idle
+// before the job is flagged
+func getLowUtilization(metrics *torchrunv1alpha1.GPUMetricsConfig) (int32, time.Duration) {
+	threshold := metrics.LowUtilizationPercent
+	if threshold == 0 {
+		threshold = 20
+	}
+	window := time.Duration(metrics.LowUtilizationSeconds) * time.Second
+	if window == 0 {
+		window = 30 * time.Minute
+	}
+	return threshold, window
+}
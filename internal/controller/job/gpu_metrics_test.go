@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestAttachGPUMetrics(t *testing.T) {
+	jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+	trainer := func(gpus string) corev1.PodSpec {
+		container := corev1.Container{Name: "trainer", Command: []string{"/bin/bash", "-c", "torchrun train.py"}}
+		if gpus != "" {
+			container.Resources.Requests = corev1.ResourceList{gpuResourceName: resource.MustParse(gpus)}
+		}
+		return corev1.PodSpec{Containers: []corev1.Container{container}}
+	}
+
+	tests := []struct {
+		description    string
+		metrics        *torchrunv1alpha1.GPUMetricsConfig
+		podSpec        corev1.PodSpec
+		expectImage    string
+		expectInterval string
+	}{
+		{
+			description: "queue without GPU metrics",
+			podSpec:     trainer("8"),
+		},
+		{
+			description: "CPU workers are not sampled",
+			metrics:     &torchrunv1alpha1.GPUMetricsConfig{},
+			podSpec:     trainer(""),
+		},
+		{
+			description:    "GPU workers get the default image",
+			metrics:        &torchrunv1alpha1.GPUMetricsConfig{},
+			podSpec:        trainer("8"),
+			expectImage:    config.Default().Images.GPUMetrics,
+			expectInterval: "30",
+		},
+		{
+			description:    "queue image and interval",
+			metrics:        &torchrunv1alpha1.GPUMetricsConfig{Image: "registry.example.com/dcgm-poller:1.0", IntervalSeconds: 10},
+			podSpec:        trainer("8"),
+			expectImage:    "registry.example.com/dcgm-poller:1.0",
+			expectInterval: "10",
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{GPUMetrics: test.metrics}}
+		podSpec := test.podSpec
+		jm.attachGPUMetrics(jq, &podSpec)
+
+		var sidecar *corev1.Container
+		for i := range podSpec.Containers {
+			if podSpec.Containers[i].Name == gpuMetricsContainerName {
+				sidecar = &podSpec.Containers[i]
+			}
+		}
+		if (sidecar != nil) != (test.expectImage != "") {
+			t.Errorf("%s: expected sidecar %v, got %+v", test.description, test.expectImage != "", sidecar)
+			continue
+		}
+		if sidecar == nil {
+			continue
+		}
+		if sidecar.Image != test.expectImage {
+			t.Errorf("%s: expected image %s, got %s", test.description, test.expectImage, sidecar.Image)
+		}
+		for _, e := range sidecar.Env {
+			if e.Name == "NVIDIA_VISIBLE_DEVICES" {
+				t.Errorf("%s: expected the sidecar to get no GPUs, got %s", test.description, e.Value)
+			}
+		}
+
+		trainer := podSpec.Containers[0]
+		env := map[string]string{}
+		for _, e := range trainer.Env {
+			env[e.Name] = e.Value
+		}
+		if env["GPU_METRICS_INTERVAL"] != test.expectInterval || env["GPU_METRICS_FILE"] != gpuMetricsFile {
+			t.Errorf("%s: expected interval %s and the samples file, got %v", test.description, test.expectInterval, env)
+		}
+		expectCommand := []string{"/bin/bash", "-c", gpuMetricsSamplerScript, "/bin/bash", "-c", "torchrun train.py"}
+		if !reflect.DeepEqual(trainer.Command, expectCommand) {
+			t.Errorf("%s: expected the sampler to start the trainer command, got %q", test.description, trainer.Command)
+		}
+		if len(trainer.VolumeMounts) != 1 || len(sidecar.VolumeMounts) != 1 || trainer.VolumeMounts[0] != sidecar.VolumeMounts[0] {
+			t.Errorf("%s: expected the samples volume mounted in both containers, got %v and %v",
+				test.description, trainer.VolumeMounts, sidecar.VolumeMounts)
+		}
+	}
+}
+
+func TestBuildGPUUtilization(t *testing.T) {
+	logs := func(utilizations ...string) []gpuMetricsSample {
+		var lines string
+		for _, utilization := range utilizations {
+			lines += "gpu-metrics gpus=8 utilization=" + utilization + " memoryUsedMiB=40000 memoryTotalMiB=655360\n"
+		}
+		return parseGPUMetricsLogs("NVIDIA-SMI has failed once\n" + lines)
+	}
+
+	tests := []struct {
+		description   string
+		workerSamples [][]gpuMetricsSample
+		expectStatus  *torchrunv1alpha1.GPUUtilizationStatus
+	}{
+		{
+			description:   "workers without samples",
+			workerSamples: [][]gpuMetricsSample{nil, nil},
+		},
+		{
+			description:   "last samples of the workers are summed",
+			workerSamples: [][]gpuMetricsSample{logs("90", "95"), logs("85", "75")},
+			expectStatus:  &torchrunv1alpha1.GPUUtilizationStatus{GPUs: 16, UtilizationPercent: 85, MemoryUsedMiB: 80000, MemoryTotalMiB: 1310720},
+		},
+		{
+			description:   "idle workers for the whole window are low",
+			workerSamples: [][]gpuMetricsSample{logs("3", "5", "0"), logs("10", "12", "8")},
+			expectStatus:  &torchrunv1alpha1.GPUUtilizationStatus{GPUs: 16, UtilizationPercent: 4, MemoryUsedMiB: 80000, MemoryTotalMiB: 1310720, Low: true},
+		},
+		{
+			description:   "one busy sample in the window is not low",
+			workerSamples: [][]gpuMetricsSample{logs("3", "50", "0"), logs("10", "12", "8")},
+			expectStatus:  &torchrunv1alpha1.GPUUtilizationStatus{GPUs: 16, UtilizationPercent: 4, MemoryUsedMiB: 80000, MemoryTotalMiB: 1310720},
+		},
+		{
+			description:   "workers sampled for less than the window are not low",
+			workerSamples: [][]gpuMetricsSample{logs("3", "5", "0"), logs("8")},
+			expectStatus:  &torchrunv1alpha1.GPUUtilizationStatus{GPUs: 16, UtilizationPercent: 4, MemoryUsedMiB: 80000, MemoryTotalMiB: 1310720},
+		},
+	}
+
+	for _, test := range tests {
+		status := buildGPUUtilization(test.workerSamples, 20, 3)
+		if !reflect.DeepEqual(status, test.expectStatus) {
+			t.Errorf("%s: expected status %+v, got %+v", test.description, test.expectStatus, status)
+		}
+	}
+}
@@ -2,85 +2,238 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"path"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
-	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/internal/v1alpha1"
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
 )
 
+const (
+	// specHashAnnotation is the hash of the Job spec built from the TorchrunJob
+	specHashAnnotation = "torchrun.ai/spec-hash"
+
+	// templateHashAnnotation is the hash of the Job spec without the fields that can be patched
+	templateHashAnnotation = "torchrun.ai/template-hash"
+
+	// queueGenerationAnnotation is the generation of the TorchrunQueue the Job spec was built from
+	queueGenerationAnnotation = "torchrun.ai/queue-generation"
+)
+
+// JobUpdate describes how a change of the TorchrunJob spec was applied to its existing Job
+type JobUpdate struct {
+	// Synced is true if the Job matches the TorchrunJob spec again
+	Synced bool
+
+	// Reason is a machine-readable reason for the update
+	Reason string
+
+	// Message is a human-readable explanation of the update
+	Message string
+}
+
 // JobManager handles Kubernetes Job creation and management
 type JobManager struct {
-	client client.Client
+	client         client.Client
+	nativeSidecars bool
+	config         *config.OperatorConfig
 }
 
 // NewJobManager creates a new job manager
-func NewJobManager(client client.Client) *JobManager {
+// nativeSidecars selects restartPolicy: Always init containers for sidecars (Kubernetes 1.29+)
+// instead of the shared process namespace kill wrapper. The operator config provides the
+// scheduler, rendezvous backend and workspace init image of queues that do not set them.
+func NewJobManager(client client.Client, nativeSidecars bool, operatorConfig *config.OperatorConfig) *JobManager {
 	return &JobManager{
-		client: client,
+		client:         client,
+		nativeSidecars: nativeSidecars,
+		config:         operatorConfig,
 	}
 }
 
-// CreateJob creates the Kubernetes Job for training
+// getSchedulerName returns the scheduler of the job pods
+func (jm *JobManager) getSchedulerName(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) string {
+	return getSchedulerName(job, jq, jm.config.SchedulerName)
+}
+
+// CreateJob creates the Kubernetes Job for training, or applies changes of the TorchrunJob to
+// the existing Job. It returns how a changed spec was applied, or nil if the Job was up to date.
 // The pod template from the TorchrunQueue must contain a container named "trainer" as the first container.
 // This is a reserved container name where:
 // - The torchrun command will be executed
 // - The workspace will be mounted
 // - Environment variables will be injected
 // - The main training workload will run
-func (jm *JobManager) CreateJob(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) error {
+func (jm *JobManager) CreateJob(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*JobUpdate, error) {
 	log := log.FromContext(ctx)
 
-	// Parse the pod template config
-	var podSpec corev1.PodSpec
-	if err := json.Unmarshal(jq.Spec.PodTemplateConfig.Spec.Raw, &podSpec); err != nil {
-		return err
+	k8sJob, err := jm.BuildJob(ctx, job, jq)
+	if err != nil {
+		return nil, err
+	}
+
+	// The worker DNS names resolve through the headless worker Service
+	if job.Spec.NumNodes > 1 {
+		if err := jm.createWorkerService(ctx, job); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check if job already exists
+	existingJob := &batchv1.Job{}
+	err = jm.client.Get(ctx, types.NamespacedName{Name: k8sJob.Name, Namespace: job.Namespace}, existingJob)
+	if err == nil {
+		return jm.updateJob(ctx, job, existingJob, k8sJob)
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	// Create the job. A cache lagging behind a previous leader may miss a Job it created, the
+	// next reconcile updates it.
+	log.Info("Creating Job", "name", k8sJob.Name)
+	if err := jm.client.Create(ctx, k8sJob); err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// BuildJob builds the Kubernetes Job of the current attempt of the job from the pod template of
+// the queue, without creating it. It sets the rendezvous id in the status of the job.
+func (jm *JobManager) BuildJob(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*batchv1.Job, error) {
+	// Parse the pod template config with the patch of the job
+	podSpec, err := getPodSpec(job, jq)
+	if err != nil {
+		return nil, err
 	}
 
 	// Validate the pod spec
 	if err := jm.validatePodSpec(podSpec); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Translate resource names in volumes based on TorchrunQueue resources
 	if err := jm.translateResourceNames(&podSpec, jq); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Set scheduler name
-	podSpec.SchedulerName = "kai-scheduler"
+	podSpec.SchedulerName = jm.getSchedulerName(job, jq)
+
+	// Set the priority class, overriding the one of the queue pod template
+	if priorityClassName := getPriorityClassName(job, jq); priorityClassName != "" {
+		podSpec.PriorityClassName = priorityClassName
+	}
 
 	// Set restart policy
-	podSpec.RestartPolicy = corev1.RestartPolicy(job.Spec.Reliability.RestartPolicy)
+	restartPolicy, backoffLimit, podFailurePolicy := getRestartSemantics(job)
+	podSpec.RestartPolicy = restartPolicy
 
 	// Attach the workspace to the trainer container
-	jm.attachWorkspaceToTrainer(job, jq, &podSpec)
+	if err := jm.attachWorkspaceToTrainer(job, jq, &podSpec); err != nil {
+		return nil, err
+	}
 
-	// Build trainer command
+	// Build trainer command, rendezvousing apart from the other jobs on the endpoint
+	job.Status.RdzvID = getRdzvID(job)
 	jm.attachTrainerCommand(job, jq, &podSpec)
 
+	// Keep the trainer of debug jobs idle, so users can exec into it
+	attachDebugCommand(job, &podSpec)
+
+	// Serve Jupyter from the trainer of notebook jobs
+	attachNotebookCommand(job, &podSpec)
+
+	// Inject the watchdog that restarts stalled training
+	jm.attachWatchdog(job, jq, &podSpec)
+
+	// Sample the GPU utilization of the trainer and inject the sidecar that logs it
+	jm.attachGPUMetrics(jq, &podSpec)
+
+	// Hand the artifacts manifest of the workspace of rank 0 to the controller
+	attachArtifactsManifest(job, jq, &podSpec)
+
+	// Inject the sidecar that signals the training processes over the maximum runtime
+	jm.attachRuntimeLimit(job, jq, &podSpec)
+
+	// Restart the trainer when it hangs in its startup or stops being healthy
+	jm.attachTrainerProbes(job, jq, &podSpec)
+
+	// Surface the end of the trainer logs in the pod status when it fails
+	attachTerminationMessagePolicy(&podSpec)
+
+	// Make sure sidecars stop when the trainer exits so the Job can complete
+	if err := jm.attachSidecarLifecycle(ctx, &podSpec); err != nil {
+		return nil, err
+	}
+
+	// Point the experiment tracking client at the run of the job
+	jm.attachExperimentTracking(job, &podSpec)
+
+	// Mount the checkpoints of the job name and tell the trainer it resumes an earlier run
+	jm.attachCheckpoints(job, &podSpec)
+
+	// Give the workers stable DNS names and point them at the rank 0 worker
+	jm.attachWorkerService(job, jq, &podSpec)
+
+	// Tell launchers that bypass the torchrun rendezvous the rank of each worker
+	jm.attachRankEnvironment(job, &podSpec)
+
+	// Plumb the host network and RDMA devices of the queue into the workers
+	if err := jm.attachNetworking(jq, &podSpec); err != nil {
+		return nil, err
+	}
+
 	// Extend the environment variables
 	jm.attachEnvironment(job, jq, &podSpec)
 
 	// Build additional volumes and mounts
 	jm.attachVolumes(job, jq, &podSpec)
 
+	// Place the workers on the capacity type of the job
+	jm.attachCapacityPlacement(job, jq, &podSpec)
+
+	// Enforce the node placement and runtime of the queue over the pod template
+	jm.attachSchedulingConstraints(jq, &podSpec)
+
+	// Keep the workers off the nodes the job excludes
+	jm.attachNodeExclusion(job, &podSpec)
+
+	// Place the workers on the nodes holding the datasets of the job
+	if err := jm.attachDataLocality(ctx, job, &podSpec); err != nil {
+		return nil, err
+	}
+
+	// Replace the whole GPUs of the trainer with a share of one GPU
+	jm.attachGPUSharing(job, &podSpec)
+
+	// Enforce the security policy of the queue over everything added above
+	attachSecurityPolicy(jq, &podSpec)
+
 	// Calculate parallelism - each node is a single pod
 	parallelism := int32(job.Spec.NumNodes)
 
 	// Create job object
 	k8sJob := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      job.Name,
+			Name:      GetJobName(job),
 			Namespace: job.Namespace,
 			Labels: map[string]string{
 				"app":                   "torchrun",
@@ -95,7 +248,8 @@ func (jm *JobManager) CreateJob(ctx context.Context, job *torchrunv1alpha1.Torch
 		Spec: batchv1.JobSpec{
 			Parallelism:             &parallelism,
 			Completions:             &parallelism,
-			BackoffLimit:            &job.Spec.Reliability.MaxRestarts,
+			BackoffLimit:            &backoffLimit,
+			PodFailurePolicy:        podFailurePolicy,
 			TTLSecondsAfterFinished: job.Spec.Reliability.TTLSecondsAfterFinished,
 			ActiveDeadlineSeconds:   job.Spec.Reliability.ActiveDeadlineSeconds,
 			Suspend:                 &job.Spec.Suspend,
@@ -110,48 +264,256 @@ func (jm *JobManager) CreateJob(ctx context.Context, job *torchrunv1alpha1.Torch
 		},
 	}
 
-	// Check if job already exists
-	existingJob := &batchv1.Job{}
-	err := jm.client.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, existingJob)
-	if err == nil {
-		// Job exists, update if needed
-		log.Info("Job already exists", "name", job.Name)
-		return nil
-	} else if !errors.IsNotFound(err) {
-		return err
+	// Record the built spec, so later changes of the TorchrunJob are detected
+	specHash, templateHash, err := getJobSpecHashes(&k8sJob.Spec)
+	if err != nil {
+		return nil, err
 	}
+	k8sJob.Annotations = map[string]string{
+		specHashAnnotation:        specHash,
+		templateHashAnnotation:    templateHash,
+		queueGenerationAnnotation: strconv.FormatInt(jq.Generation, 10),
+	}
+	return k8sJob, nil
+}
 
-	// Create the job
-	log.Info("Creating Job", "name", job.Name)
-	return jm.client.Create(ctx, k8sJob)
+// updateJob applies changes of the TorchrunJob to its existing Job. Deadline, TTL and suspend
+// are patched; other fields are immutable, so the Job is recreated as the update policy allows.
+// Finished Jobs are left alone.
+func (jm *JobManager) updateJob(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, existing, desired *batchv1.Job) (*JobUpdate, error) {
+	log := log.FromContext(ctx)
+
+	// The recreated Job is created once the old one and its pods are gone
+	if existing.DeletionTimestamp != nil {
+		return &JobUpdate{
+			Reason:  "Recreating",
+			Message: fmt.Sprintf("Waiting for the pods of Job %s to stop before recreating it", existing.Name),
+		}, nil
+	}
+	if isJobFinished(existing) {
+		return nil, nil
+	}
+
+	specHash := existing.Annotations[specHashAnnotation]
+	if specHash == desired.Annotations[specHashAnnotation] {
+		// Queue changes that do not change the Job are applied as well
+		if generation := desired.Annotations[queueGenerationAnnotation]; existing.Annotations[queueGenerationAnnotation] != generation {
+			patch := client.MergeFrom(existing.DeepCopy())
+			metav1.SetMetaDataAnnotation(&existing.ObjectMeta, queueGenerationAnnotation, generation)
+			return nil, jm.client.Patch(ctx, existing, patch)
+		}
+		return nil, nil
+	}
+
+	// Jobs created before drift detection have no hash; their current spec is taken as applied
+	if specHash == "" {
+		patch := client.MergeFrom(existing.DeepCopy())
+		metav1.SetMetaDataAnnotation(&existing.ObjectMeta, specHashAnnotation, desired.Annotations[specHashAnnotation])
+		metav1.SetMetaDataAnnotation(&existing.ObjectMeta, templateHashAnnotation, desired.Annotations[templateHashAnnotation])
+		metav1.SetMetaDataAnnotation(&existing.ObjectMeta, queueGenerationAnnotation, desired.Annotations[queueGenerationAnnotation])
+		return nil, jm.client.Patch(ctx, existing, patch)
+	}
+
+	if existing.Annotations[templateHashAnnotation] == desired.Annotations[templateHashAnnotation] {
+		patch := client.MergeFrom(existing.DeepCopy())
+		existing.Spec.ActiveDeadlineSeconds = desired.Spec.ActiveDeadlineSeconds
+		existing.Spec.TTLSecondsAfterFinished = desired.Spec.TTLSecondsAfterFinished
+		existing.Spec.Suspend = desired.Spec.Suspend
+		metav1.SetMetaDataAnnotation(&existing.ObjectMeta, specHashAnnotation, desired.Annotations[specHashAnnotation])
+		metav1.SetMetaDataAnnotation(&existing.ObjectMeta, queueGenerationAnnotation, desired.Annotations[queueGenerationAnnotation])
+		log.Info("Patching Job", "name", existing.Name)
+		if err := jm.client.Patch(ctx, existing, patch); err != nil {
+			return nil, err
+		}
+		return &JobUpdate{
+			Synced:  true,
+			Reason:  "Patched",
+			Message: fmt.Sprintf("Updated the deadline, TTL and suspend of Job %s", existing.Name),
+		}, nil
+	}
+
+	// Tell apart jobs left stale by a change of their queue from edits of the job itself
+	stale := "the spec"
+	if generation := existing.Annotations[queueGenerationAnnotation]; generation != "" && generation != desired.Annotations[queueGenerationAnnotation] {
+		stale = fmt.Sprintf("the spec of TorchrunQueue %s, which changed since the Job was created,", job.Spec.Queue)
+	}
+	switch policy := job.Spec.UpdatePolicy; {
+	case policy == torchrunv1alpha1.UpdatePolicyNever:
+		return &JobUpdate{
+			Reason:  "UpdateSkipped",
+			Message: fmt.Sprintf("Job %s does not match %s and updatePolicy is Never", existing.Name, stale),
+		}, nil
+	case policy != torchrunv1alpha1.UpdatePolicyRecreate && isJobRunning(existing):
+		return &JobUpdate{
+			Reason:  "RecreateBlocked",
+			Message: fmt.Sprintf("Job %s does not match %s but has running pods; set updatePolicy to Recreate to restart it", existing.Name, stale),
+		}, nil
+	}
+
+	// Foreground deletion keeps the Job until its pods are gone, so the new pods never run
+	// next to the old ones
+	log.Info("Recreating Job for a changed spec", "name", existing.Name)
+	if err := jm.client.Delete(ctx, existing, client.PropagationPolicy(metav1.DeletePropagationForeground)); err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	// A new node count changes the parallelism and the torchrun flags of every worker
+	if nodes := *desired.Spec.Parallelism; existing.Spec.Parallelism != nil && *existing.Spec.Parallelism != nodes {
+		return &JobUpdate{
+			Reason:  "Resizing",
+			Message: fmt.Sprintf("Recreating Job %s with %d nodes instead of %d", existing.Name, nodes, *existing.Spec.Parallelism),
+		}, nil
+	}
+	return &JobUpdate{
+		Reason:  "Recreating",
+		Message: fmt.Sprintf("Recreating Job %s because its pod template or parallelism changed", existing.Name),
+	}, nil
 }
 
-// attachTrainerCommand builds the torchrun command and attaches it to the trainer container
+// getRestartSemantics returns the pod restart policy, backoff limit and pod failure policy of the
+// restart mode of the job
+func getRestartSemantics(job *torchrunv1alpha1.TorchrunJob) (corev1.RestartPolicy, int32, *batchv1.PodFailurePolicy) {
+	reliability := job.Spec.Reliability
+	trainer := "trainer"
+	switch reliability.RestartMode {
+	case torchrunv1alpha1.RestartModePerPod:
+		return corev1.RestartPolicyOnFailure, reliability.MaxRestarts, nil
+	case torchrunv1alpha1.RestartModeWholeJob:
+		// The first failed trainer fails the Job, which the retry manager recreates. Disrupted pods,
+		// e.g. preempted ones, are replaced without failing the Job.
+		return corev1.RestartPolicyNever, 0, &batchv1.PodFailurePolicy{
+			Rules: []batchv1.PodFailurePolicyRule{
+				{
+					Action:          batchv1.PodFailurePolicyActionIgnore,
+					OnPodConditions: []batchv1.PodFailurePolicyOnPodConditionsPattern{{Type: corev1.DisruptionTarget, Status: corev1.ConditionTrue}},
+				},
+				{
+					Action: batchv1.PodFailurePolicyActionFailJob,
+					OnExitCodes: &batchv1.PodFailurePolicyOnExitCodesRequirement{
+						ContainerName: &trainer,
+						Operator:      batchv1.PodFailurePolicyOnExitCodesOpNotIn,
+						Values:        []int32{0},
+					},
+				},
+			},
+		}
+	}
+	return corev1.RestartPolicy(reliability.RestartPolicy), reliability.MaxRestarts, nil
+}
+
+// getJobSpecHashes returns the hash of the Job spec and of the spec without the fields that
+// can be patched on an existing Job
+func getJobSpecHashes(spec *batchv1.JobSpec) (string, string, error) {
+	specHash, err := hashObject(spec)
+	if err != nil {
+		return "", "", err
+	}
+	immutable := spec.DeepCopy()
+	immutable.ActiveDeadlineSeconds = nil
+	immutable.TTLSecondsAfterFinished = nil
+	immutable.Suspend = nil
+	templateHash, err := hashObject(immutable)
+	if err != nil {
+		return "", "", err
+	}
+	return specHash, templateHash, nil
+}
+
+// hashObject returns a short hash of the JSON encoding of obj
+func hashObject(obj interface{}) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// getPodSpec returns the pod spec of the queue pod template with the pod template patch, image
+// and image pull secrets of the job applied
+func getPodSpec(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (corev1.PodSpec, error) {
+	var podSpec corev1.PodSpec
+	raw := jq.Spec.PodTemplateConfig.Spec.Raw
+	profile, err := getJobProfile(job, jq)
+	if err != nil {
+		return podSpec, err
+	}
+	if profile != nil {
+		if raw, err = applyJobProfile(raw, profile); err != nil {
+			return podSpec, fmt.Errorf("failed to apply profile %s: %w", profile.Name, err)
+		}
+	}
+	if job.Spec.PodTemplatePatch != nil {
+		if raw, err = applyPodTemplatePatch(raw, job.Spec.PodTemplatePatch); err != nil {
+			return podSpec, fmt.Errorf("failed to apply the pod template patch of the job: %w", err)
+		}
+	}
+	if err := json.Unmarshal(raw, &podSpec); err != nil {
+		return podSpec, err
+	}
+
+	// The trainer is the first container, which validatePodSpec enforces
+	if job.Spec.Image != "" && len(podSpec.Containers) > 0 {
+		podSpec.Containers[0].Image = job.Spec.Image
+	}
+	for _, secret := range job.Spec.ImagePullSecrets {
+		if !slices.Contains(podSpec.ImagePullSecrets, secret) {
+			podSpec.ImagePullSecrets = append(podSpec.ImagePullSecrets, secret)
+		}
+	}
+	return podSpec, nil
+}
+
+// applyPodTemplatePatch applies the strategic merge patch and then the JSON patch to the pod spec
+func applyPodTemplatePatch(podSpec []byte, podTemplatePatch *torchrunv1alpha1.PodTemplatePatch) ([]byte, error) {
+	if podTemplatePatch.StrategicMerge != nil && len(podTemplatePatch.StrategicMerge.Raw) > 0 {
+		patched, err := strategicpatch.StrategicMergePatch(podSpec, podTemplatePatch.StrategicMerge.Raw, corev1.PodSpec{})
+		if err != nil {
+			return nil, fmt.Errorf("strategic merge patch: %w", err)
+		}
+		podSpec = patched
+	}
+
+	if len(podTemplatePatch.JSONPatch) > 0 {
+		ops, err := json.Marshal(podTemplatePatch.JSONPatch)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := jsonpatch.DecodePatch(ops)
+		if err != nil {
+			return nil, fmt.Errorf("json patch: %w", err)
+		}
+		if podSpec, err = decoded.Apply(podSpec); err != nil {
+			return nil, fmt.Errorf("json patch: %w", err)
+		}
+	}
+	return podSpec, nil
+}
+
+// attachTrainerCommand builds the torchrun command and attaches it to the trainer container.
+// The setup command and command of the job reach the script through TORCHRUN_SETUP_COMMAND and
+// TORCHRUN_COMMAND instead of being spliced into it, and every other value is quoted, so nothing
+// in the job spec can change the structure of the script.
 func (jm *JobManager) attachTrainerCommand(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) {
 	var cmdParts []string
+	trainer := &podSpec.Containers[0]
 
-	// Add setup command if provided
+	// Add setup command if provided. It is evaluated in the shell of torchrun, so directory
+	// changes and exported variables carry over.
 	if job.Spec.SetupCommand != "" {
-		cmdParts = append(cmdParts, job.Spec.SetupCommand, "&&")
+		trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "TORCHRUN_SETUP_COMMAND", Value: job.Spec.SetupCommand})
+		cmdParts = append(cmdParts, `eval "$TORCHRUN_SETUP_COMMAND"`, "&&")
 	}
 
 	// Build torchrun command
 	cmdParts = append(cmdParts, "torchrun")
 
 	// Lookup nproc (num gpus) from resource requests nvidia.com/gpu on the pod spec
-	// it will be on the "trainer" container
-	nproc := 0
-	for _, container := range podSpec.Containers {
-		if container.Name == "trainer" {
-			if val, ok := container.Resources.Requests[corev1.ResourceName("nvidia.com/gpu")]; ok {
-				nproc = int(val.Value())
-			}
-		}
-	}
+	// it will be on the "trainer" container, unless the profile of the job sets it
+	nproc := getNprocPerNode(job, jq, podSpec)
 
-	// if RdzvBackend is empty set it to c10d
+	// if RdzvBackend is empty use the default of the operator
 	if jq.Spec.Distributed.RdzvBackend == "" {
-		jq.Spec.Distributed.RdzvBackend = "c10d"
+		jq.Spec.Distributed.RdzvBackend = jm.config.RdzvBackend
 	}
 
 	// Node configuration
@@ -160,32 +522,537 @@ func (jm *JobManager) attachTrainerCommand(job *torchrunv1alpha1.TorchrunJob, jq
 			"--node_rank", "$(JOB_COMPLETION_INDEX)",
 			"--nnodes", strconv.Itoa(job.Spec.NumNodes),
 			"--nproc-per-node", strconv.Itoa(nproc),
-			"--rdzv-backend", jq.Spec.Distributed.RdzvBackend,
-			"--rdzv-endpoint", jq.Spec.Distributed.RdzvEndpoint,
-			"--rdzv-id", job.Spec.JobName,
-			"--no-python",
+			"--rdzv-backend", shellQuote(jq.Spec.Distributed.RdzvBackend),
+			"--rdzv-endpoint", shellQuote(getJobRdzvEndpoint(job, jq)),
+			"--rdzv-id", shellQuote(getRdzvID(job)),
 		)
+		// The agents of the surviving nodes restart their workers when a restarted worker pod
+		// rejoins the rendezvous, instead of exiting
+		if job.Spec.Reliability.RestartMode == torchrunv1alpha1.RestartModePerPod {
+			cmdParts = append(cmdParts, "--max-restarts", strconv.Itoa(int(job.Spec.Reliability.MaxRestarts)))
+		}
+		cmdParts = append(cmdParts, "--no-python")
 	} else {
 		// Single node training
 		cmdParts = append(cmdParts,
 			"--standalone",
 			"--nproc-per-node", strconv.Itoa(nproc),
-			"--rdzv-id", job.Spec.JobName,
+			"--rdzv-id", shellQuote(getRdzvID(job)),
 			"--no-python",
 		)
 	}
 
-	// Add the actual command
-	cmdParts = append(cmdParts, job.Spec.Command)
+	// Add the actual command. Each worker process runs it in its own shell, as it is a shell
+	// command line rather than a program.
+	trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "TORCHRUN_COMMAND", Value: job.Spec.Command})
+	cmdParts = append(cmdParts, "/bin/bash", "-c", `"$TORCHRUN_COMMAND"`)
+
+	trainer.Command = []string{"/bin/bash", "-c", strings.Join(cmdParts, " ")}
+}
+
+// debugIdleScript keeps the trainer of a debug job running until the pod is stopped
+const debugIdleScript = `echo "Debug mode: start training with bash -c \"$TORCHRUN_LAUNCH_COMMAND\""
+trap 'exit 0' TERM
+sleep infinity &
+wait`
+
+// attachDebugCommand replaces the torchrun command of debug jobs with an idle one. The torchrun
+// command stays in TORCHRUN_LAUNCH_COMMAND, so it can be started by hand in the pod.
+func attachDebugCommand(job *torchrunv1alpha1.TorchrunJob, podSpec *corev1.PodSpec) {
+	if !isDebugJob(job) {
+		return
+	}
+	trainer := &podSpec.Containers[0]
+	keepLaunchCommand(trainer)
+	trainer.Command = []string{"/bin/bash", "-c", debugIdleScript}
+}
+
+// keepLaunchCommand stores the torchrun command of the trainer in TORCHRUN_LAUNCH_COMMAND before
+// it is replaced
+func keepLaunchCommand(trainer *corev1.Container) {
+	// The kubelet expands $(VAR) in env values, the command must reach the shell as built
+	launch := strings.ReplaceAll(trainer.Command[len(trainer.Command)-1], "$(", "$$(")
+	trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "TORCHRUN_LAUNCH_COMMAND", Value: launch})
+}
 
-	podSpec.Containers[0].Command = []string{"/bin/bash", "-c", strings.Join(cmdParts, " ")}
+// attachSidecarLifecycle ties the lifetime of the sidecar containers to the trainer container.
+// Any container after the trainer is a sidecar (metrics exporters, data loaders, ...), which would
+// otherwise keep running after training finished and prevent the Job from completing.
+func (jm *JobManager) attachSidecarLifecycle(ctx context.Context, podSpec *corev1.PodSpec) error {
+	if len(podSpec.Containers) < 2 {
+		return nil
+	}
+
+	if jm.nativeSidecars {
+		// Native sidecars are init containers with restartPolicy Always. They are started before
+		// the trainer and terminated by the kubelet once the trainer exits.
+		always := corev1.ContainerRestartPolicyAlways
+		for _, sidecar := range podSpec.Containers[1:] {
+			sidecar.RestartPolicy = &always
+			podSpec.InitContainers = append(podSpec.InitContainers, sidecar)
+		}
+		podSpec.Containers = podSpec.Containers[:1]
+		return nil
+	}
+
+	// Without native sidecars the trainer signals the sidecars itself once it exits, and each
+	// sidecar runs under a TERM trap so the signal ends it with status 0.
+	for i := range podSpec.Containers[1:] {
+		sidecar := &podSpec.Containers[i+1]
+		if len(sidecar.Command) == 0 {
+			return fmt.Errorf("sidecar container %s must set command when native sidecars are not available", sidecar.Name)
+		}
+		sidecar.Command = append([]string{"/bin/sh", "-c", sidecarTermTrap, sidecar.Name}, sidecar.Command...)
+	}
+
+	// Sidecars are not restarted after they were stopped, so an in-place trainer restart would run
+	// without them. Replace the whole pod instead.
+	if podSpec.RestartPolicy == corev1.RestartPolicyOnFailure {
+		log.FromContext(ctx).Info("Using restartPolicy Never, sidecars cannot survive an in-place trainer restart")
+		podSpec.RestartPolicy = corev1.RestartPolicyNever
+	}
+
+	shareProcessNamespace := true
+	podSpec.ShareProcessNamespace = &shareProcessNamespace
+
+	trainer := &podSpec.Containers[0]
+	script := trainer.Command[len(trainer.Command)-1]
+	trainer.Command[len(trainer.Command)-1] = buildSidecarKillWrapper(script)
+	return nil
+}
+
+// sidecarTermTrap runs the sidecar command ("$@") and exits 0 once the trainer sends SIGTERM,
+// otherwise it exits with the status of the sidecar command
+const sidecarTermTrap = `trap 'kill -TERM "$child" 2>/dev/null; wait "$child"; exit 0' TERM
+"$@" &
+child=$!
+wait "$child"`
+
+// sidecarKillGracePeriodSeconds is how long sidecars get to exit after SIGTERM before they are killed
+const sidecarKillGracePeriodSeconds = 20
+
+// buildSidecarKillWrapper wraps the trainer script so it terminates every other process in the
+// shared process namespace when it exits, escalating to SIGKILL after a grace period and
+// preserving the trainer's exit code
+func buildSidecarKillWrapper(script string) string {
+	return fmt.Sprintf(`(%s)
+rc=$?
+pids=""
+for p in /proc/[0-9]*; do
+  pid=${p#/proc/}
+  if [ "$pid" = 1 ] || [ "$pid" = $$ ]; then continue; fi
+  if kill -TERM "$pid"; then
+    pids="$pids $pid"
+  elif [ -d "$p" ]; then
+    echo "torchrun: failed to stop sidecar process $pid" >&2
+  fi
+done
+deadline=$(( $(date +%%s) + %d ))
+for pid in $pids; do
+  while [ -d "/proc/$pid" ] && [ "$(date +%%s)" -lt "$deadline" ]; do sleep 1; done
+  if [ -d "/proc/$pid" ]; then
+    echo "torchrun: sidecar process $pid ignored SIGTERM, sending SIGKILL" >&2
+    kill -KILL "$pid" || echo "torchrun: failed to kill sidecar process $pid" >&2
+  fi
+done
+exit $rc`, script, sidecarKillGracePeriodSeconds)
+}
+
+// attachCapacityPlacement adds the node selector and tolerations of the job capacity type
+// from the queue. Jobs on any capacity tolerate spot nodes without being restricted to them.
+func (jm *JobManager) attachCapacityPlacement(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) {
+	capacity := jq.Spec.Capacity
+	if capacity == nil {
+		return
+	}
+
+	var placement torchrunv1alpha1.CapacityPlacement
+	switch getCapacityType(job) {
+	case torchrunv1alpha1.CapacityTypeSpot:
+		placement = capacity.Spot
+	case torchrunv1alpha1.CapacityTypeOnDemand:
+		placement = capacity.OnDemand
+	case torchrunv1alpha1.CapacityTypeAny:
+		placement.Tolerations = append(placement.Tolerations, capacity.Spot.Tolerations...)
+		placement.Tolerations = append(placement.Tolerations, capacity.OnDemand.Tolerations...)
+	default:
+		return
+	}
+
+	if len(placement.NodeSelector) > 0 && podSpec.NodeSelector == nil {
+		podSpec.NodeSelector = map[string]string{}
+	}
+	for k, v := range placement.NodeSelector {
+		podSpec.NodeSelector[k] = v
+	}
+	podSpec.Tolerations = append(podSpec.Tolerations, placement.Tolerations...)
+}
+
+// attachSchedulingConstraints enforces the scheduling constraints of the queue. Node selector
+// values of the queue replace those of the pod template, and its tolerations are added. The
+// priority class is enforced by getPriorityClassName.
+func (jm *JobManager) attachSchedulingConstraints(jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) {
+	constraints := jq.Spec.SchedulingConstraints
+	if constraints == nil {
+		return
+	}
+
+	if len(constraints.NodeSelector) > 0 && podSpec.NodeSelector == nil {
+		podSpec.NodeSelector = map[string]string{}
+	}
+	for k, v := range constraints.NodeSelector {
+		podSpec.NodeSelector[k] = v
+	}
+	for i := range constraints.Tolerations {
+		toleration := &constraints.Tolerations[i]
+		if !slices.ContainsFunc(podSpec.Tolerations, func(t corev1.Toleration) bool { return t.MatchToleration(toleration) }) {
+			podSpec.Tolerations = append(podSpec.Tolerations, *toleration)
+		}
+	}
+	if constraints.RuntimeClassName != "" {
+		runtimeClassName := constraints.RuntimeClassName
+		podSpec.RuntimeClassName = &runtimeClassName
+	}
+}
+
+// attachNodeExclusion adds the excluded nodes and node labels of the job to every required node
+// affinity term of the pod, as the terms are alternatives. The suspect nodes of earlier attempts
+// are excluded with the nodes of the spec. Node names are matched by field, one requirement per
+// node, as field requirements take a single value.
+func (jm *JobManager) attachNodeExclusion(job *torchrunv1alpha1.TorchrunJob, podSpec *corev1.PodSpec) {
+	nodes := append([]string{}, job.Spec.ExcludedNodes...)
+	for _, node := range getExcludedSuspectNodes(job) {
+		if !slices.Contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 && len(job.Spec.ExcludedNodeLabels) == 0 {
+		return
+	}
+
+	var fields, expressions []corev1.NodeSelectorRequirement
+	for _, node := range nodes {
+		fields = append(fields, corev1.NodeSelectorRequirement{
+			Key:      "metadata.name",
+			Operator: corev1.NodeSelectorOpNotIn,
+			Values:   []string{node},
+		})
+	}
+	keys := make([]string, 0, len(job.Spec.ExcludedNodeLabels))
+	for key := range job.Spec.ExcludedNodeLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		requirement := corev1.NodeSelectorRequirement{Key: key, Operator: corev1.NodeSelectorOpDoesNotExist}
+		if value := job.Spec.ExcludedNodeLabels[key]; value != "" {
+			requirement.Operator = corev1.NodeSelectorOpNotIn
+			requirement.Values = []string{value}
+		}
+		expressions = append(expressions, requirement)
+	}
+
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = &corev1.Affinity{}
+	}
+	if podSpec.Affinity.NodeAffinity == nil {
+		podSpec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	nodeAffinity := podSpec.Affinity.NodeAffinity
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	required := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(required.NodeSelectorTerms) == 0 {
+		required.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+	for i := range required.NodeSelectorTerms {
+		term := &required.NodeSelectorTerms[i]
+		term.MatchFields = append(term.MatchFields, fields...)
+		term.MatchExpressions = append(term.MatchExpressions, expressions...)
+	}
+}
+
+// attachGPUSharing removes the GPU request of the trainer container for jobs sharing a GPU.
+// kai-scheduler places them by the gpu-fraction or gpu-memory pod annotation instead.
+func (jm *JobManager) attachGPUSharing(job *torchrunv1alpha1.TorchrunJob, podSpec *corev1.PodSpec) {
+	if !sharesGPU(job) {
+		return
+	}
+	trainer := &podSpec.Containers[0]
+	delete(trainer.Resources.Requests, gpuResourceName)
+	delete(trainer.Resources.Limits, gpuResourceName)
+}
+
+// efaResourceName is the device plugin resource of AWS Elastic Fabric Adapters
+const efaResourceName = "vpc.amazonaws.com/efa"
+
+// attachNetworking applies the networking of the queue to the worker pods: host network and
+// IPC, a memory-backed /dev/shm, and the RDMA devices of the trainer with the environment NCCL
+// needs to use them. The environment comes before the job env, so the job can override it.
+func (jm *JobManager) attachNetworking(jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) error {
+	networking := jq.Spec.Networking
+	if networking == nil {
+		return nil
+	}
+	if networking.HostNetwork {
+		podSpec.HostNetwork = true
+		podSpec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+	}
+	if networking.HostIPC {
+		podSpec.HostIPC = true
+	}
+
+	trainer := &podSpec.Containers[0]
+	if networking.SharedMemorySize != "" {
+		size, err := resource.ParseQuantity(networking.SharedMemorySize)
+		if err != nil {
+			return fmt.Errorf("invalid sharedMemorySize %q: %w", networking.SharedMemorySize, err)
+		}
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "shm",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory, SizeLimit: &size},
+			},
+		})
+		trainer.VolumeMounts = append(trainer.VolumeMounts, corev1.VolumeMount{Name: "shm", MountPath: "/dev/shm"})
+	}
+	if len(networking.RDMA) == 0 {
+		return nil
+	}
+
+	// Extended resources are requested through equal requests and limits
+	if trainer.Resources.Requests == nil {
+		trainer.Resources.Requests = corev1.ResourceList{}
+	}
+	if trainer.Resources.Limits == nil {
+		trainer.Resources.Limits = corev1.ResourceList{}
+	}
+	efa := false
+	for _, device := range networking.RDMA {
+		count := device.Count
+		if count < 1 {
+			count = 1
+		}
+		quantity := *resource.NewQuantity(int64(count), resource.DecimalSI)
+		trainer.Resources.Requests[corev1.ResourceName(device.ResourceName)] = quantity
+		trainer.Resources.Limits[corev1.ResourceName(device.ResourceName)] = quantity
+		efa = efa || device.ResourceName == efaResourceName
+	}
+
+	// RDMA registers the buffers of NCCL as locked memory
+	if trainer.SecurityContext == nil {
+		trainer.SecurityContext = &corev1.SecurityContext{}
+	}
+	if trainer.SecurityContext.Capabilities == nil {
+		trainer.SecurityContext.Capabilities = &corev1.Capabilities{}
+	}
+	if !slices.Contains(trainer.SecurityContext.Capabilities.Add, "IPC_LOCK") {
+		trainer.SecurityContext.Capabilities.Add = append(trainer.SecurityContext.Capabilities.Add, "IPC_LOCK")
+	}
+
+	if backend := jq.Spec.Distributed.Backend; backend != "" && backend != "nccl" {
+		return nil
+	}
+	if efa {
+		// NCCL reaches EFA through libfabric and the aws-ofi-nccl plugin of the image
+		trainer.Env = append(trainer.Env,
+			corev1.EnvVar{Name: "FI_PROVIDER", Value: "efa"},
+			corev1.EnvVar{Name: "FI_EFA_USE_DEVICE_RDMA", Value: "1"},
+		)
+	} else {
+		trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "NCCL_IB_DISABLE", Value: "0"})
+	}
+	return nil
+}
+
+// attachExperimentTracking adds the environment variables of the experiment tracking client
+// and the keys of the tracking Secret to the trainer container. They come before the job env,
+// so the job can override them.
+func (jm *JobManager) attachExperimentTracking(job *torchrunv1alpha1.TorchrunJob, podSpec *corev1.PodSpec) {
+	tracking := job.Spec.ExperimentTracking
+	if tracking == nil {
+		return
+	}
+	trainer := &podSpec.Containers[0]
+	runID := job.Status.TrackingRunID
+
+	switch tracking.Provider {
+	case torchrunv1alpha1.TrackingProviderWandb:
+		trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "WANDB_PROJECT", Value: tracking.Project})
+		if tracking.Entity != "" {
+			trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "WANDB_ENTITY", Value: tracking.Entity})
+		}
+		if tracking.URL != "" {
+			trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "WANDB_BASE_URL", Value: tracking.URL})
+		}
+		if runID != "" {
+			trainer.Env = append(trainer.Env,
+				corev1.EnvVar{Name: "WANDB_RUN_ID", Value: runID},
+				corev1.EnvVar{Name: "WANDB_RESUME", Value: "allow"},
+			)
+		}
+	case torchrunv1alpha1.TrackingProviderMLflow:
+		trainer.Env = append(trainer.Env,
+			corev1.EnvVar{Name: "MLFLOW_TRACKING_URI", Value: tracking.URL},
+			corev1.EnvVar{Name: "MLFLOW_EXPERIMENT_NAME", Value: tracking.Project},
+		)
+		if runID != "" {
+			trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "MLFLOW_RUN_ID", Value: runID})
+		}
+	}
+
+	if tracking.SecretRef != nil {
+		trainer.EnvFrom = append(trainer.EnvFrom, corev1.EnvFromSource{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: *tracking.SecretRef},
+		})
+	}
+}
+
+// attachCheckpoints mounts the checkpoint directory of the job name into the trainer and sets
+// TORCHRUN_CHECKPOINT_DIR, TORCHRUN_ARTIFACTS_MANIFEST for jobs collecting artifacts, and
+// TORCHRUN_RESUME_COUNT once the job resumed an earlier run. They come before the job env, so the
+// job can override them.
+func (jm *JobManager) attachCheckpoints(job *torchrunv1alpha1.TorchrunJob, podSpec *corev1.PodSpec) {
+	trainer := &podSpec.Containers[0]
+	if checkpoints := job.Spec.Checkpoints; checkpoints != nil {
+		mountPath := checkpoints.MountPath
+		if mountPath == "" {
+			mountPath = "/checkpoints"
+		}
+		trainer.VolumeMounts = append(trainer.VolumeMounts, corev1.VolumeMount{
+			Name:      checkpoints.Volume,
+			MountPath: mountPath,
+			SubPath:   job.Spec.JobName,
+		})
+		trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "TORCHRUN_CHECKPOINT_DIR", Value: mountPath})
+		if checkpoints.CollectArtifacts {
+			trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "TORCHRUN_ARTIFACTS_MANIFEST", Value: path.Join(mountPath, artifactsManifestName)})
+		}
+	}
+	if job.Status.ResumeCount > 0 {
+		trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "TORCHRUN_RESUME_COUNT", Value: strconv.Itoa(int(job.Status.ResumeCount))})
+	}
+}
+
+// attachWorkerService puts the workers of multi-node jobs in the subdomain of the headless worker
+// Service and points MASTER_ADDR and MASTER_PORT at the rank 0 worker. Job env still overrides them.
+func (jm *JobManager) attachWorkerService(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) {
+	if job.Spec.NumNodes <= 1 {
+		return
+	}
+	podSpec.Subdomain = GetWorkerServiceName(job)
+
+	trainer := &podSpec.Containers[0]
+	trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "MASTER_ADDR", Value: getMasterAddr(job)})
+	// Queues with a port already export it with the distributed environment
+	if jq.Spec.Distributed.Port == 0 {
+		trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "MASTER_PORT", Value: strconv.Itoa(defaultMasterPort)})
+	}
+}
+
+// attachRankEnvironment exports the node rank and node count of the worker as NODE_RANK, RANK and
+// WORLD_SIZE, the environment launchers such as the DeepSpeed launcher or Ray start from. torchrun
+// sets the per-process RANK and WORLD_SIZE of the processes it starts itself, so they do not
+// change torchrun jobs. Job env still overrides them.
+func (jm *JobManager) attachRankEnvironment(job *torchrunv1alpha1.TorchrunJob, podSpec *corev1.PodSpec) {
+	// Indexed Jobs record the rank of each pod in this annotation
+	rank := &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{
+		FieldPath: fmt.Sprintf("metadata.annotations['%s']", batchv1.JobCompletionIndexAnnotation),
+	}}
+	trainer := &podSpec.Containers[0]
+	trainer.Env = append(trainer.Env,
+		corev1.EnvVar{Name: "NODE_RANK", ValueFrom: rank},
+		corev1.EnvVar{Name: "RANK", ValueFrom: rank},
+		corev1.EnvVar{Name: "WORLD_SIZE", Value: strconv.Itoa(job.Spec.NumNodes)},
+	)
+}
+
+// createWorkerService creates the headless Service that publishes the DNS names of the worker
+// pods, <job>-<index>.<service>.<namespace>.svc
+func (jm *JobManager) createWorkerService(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) error {
+	existing := &corev1.Service{}
+	err := jm.client.Get(ctx, types.NamespacedName{Name: GetWorkerServiceName(job), Namespace: job.Namespace}, existing)
+	if err == nil || !errors.IsNotFound(err) {
+		return err
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GetWorkerServiceName(job),
+			Namespace: job.Namespace,
+			Labels: map[string]string{
+				"app":                  "torchrun",
+				"torchrun.ai/job-id":   job.Spec.JobID,
+				"torchrun.ai/job-name": job.Spec.JobName,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, job.GroupVersionKind()),
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  map[string]string{"torchrun.ai/job-id": job.Spec.JobID},
+			// Workers look up the rank 0 worker while it is still starting
+			PublishNotReadyAddresses: true,
+		},
+	}
+	log.FromContext(ctx).Info("Creating worker Service", "name", service.Name)
+	if err := jm.client.Create(ctx, service); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
 }
 
 // attachEnvironment attaches the environment variables to the trainer container
 func (jm *JobManager) attachEnvironment(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) {
+	// The job env comes last so it overrides the queue network tuning
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, buildDistributedEnvironment(&jq.Spec.Distributed)...)
+	if jm.config.ProgressURL != "" {
+		podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, corev1.EnvVar{Name: "TORCHRUN_PROGRESS_URL", Value: jm.config.ProgressURL})
+	}
 	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, job.Spec.Env...)
 }
 
+// buildDistributedEnvironment builds the process group and network tuning variables of the queue
+func buildDistributedEnvironment(distributed *torchrunv1alpha1.DistributedConfig) []corev1.EnvVar {
+	backend := distributed.Backend
+	if backend == "" {
+		backend = "nccl"
+	}
+	env := []corev1.EnvVar{{Name: "TORCH_DISTRIBUTED_BACKEND", Value: backend}}
+
+	if distributed.Port != 0 {
+		env = append(env, corev1.EnvVar{Name: "MASTER_PORT", Value: strconv.Itoa(int(distributed.Port))})
+	}
+
+	// Gloo also carries CPU collectives and the store traffic of nccl jobs
+	if distributed.SocketIfname != "" {
+		env = append(env, corev1.EnvVar{Name: "GLOO_SOCKET_IFNAME", Value: distributed.SocketIfname})
+	}
+	if backend != "nccl" {
+		return env
+	}
+
+	if distributed.SocketIfname != "" {
+		env = append(env, corev1.EnvVar{Name: "NCCL_SOCKET_IFNAME", Value: distributed.SocketIfname})
+	}
+	if distributed.NCCLDebug != "" {
+		env = append(env, corev1.EnvVar{Name: "NCCL_DEBUG", Value: distributed.NCCLDebug})
+	}
+
+	// Sorted so the pod template does not change between reconciles
+	names := make([]string, 0, len(distributed.NCCLTuning))
+	for name := range distributed.NCCLTuning {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, corev1.EnvVar{Name: name, Value: distributed.NCCLTuning[name]})
+	}
+	return env
+}
+
 // attachVolumes attaches additional volumes and mounts to the pod spec
 func (jm *JobManager) attachVolumes(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) {
 	// Add additional volumes from job
@@ -204,19 +1071,126 @@ func (jm *JobManager) attachVolumes(job *torchrunv1alpha1.TorchrunJob, jq *torch
 			})
 		}
 	}
+
+	// Expand the secret and configMap shorthands into volumes mounted read-only in the trainer
+	for i, mount := range job.Spec.SecretMounts {
+		name := fmt.Sprintf("secret-mount-%d", i)
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: mount.SecretName, Items: mount.Items},
+			},
+		})
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: mount.MountPath,
+			ReadOnly:  true,
+		})
+	}
+	for i, mount := range job.Spec.ConfigMapMounts {
+		name := fmt.Sprintf("configmap-mount-%d", i)
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: mount.Name},
+					Items:                mount.Items,
+				},
+			},
+		})
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: mount.MountPath,
+			ReadOnly:  true,
+		})
+	}
+}
+
+// workspaceInitScript waits for the sync pod to mark the workspace PVC as synced and copies it
+// into the worker. It exits non-zero once the timeout expires, so a failed or stuck sync fails
+// the worker instead of keeping it pending forever.
+const workspaceInitScript = `
+deadline=$(( $(date +%s) + WORKSPACE_SYNC_TIMEOUT ))
+until [ -f /workspace-pvc/.sync_success ]; do
+  if [ "$(date +%s)" -ge "$deadline" ]; then
+    echo "ERROR: Timed out after ${WORKSPACE_SYNC_TIMEOUT}s waiting for workspace sync" >&2
+    exit 1
+  fi
+  echo "Waiting for workspace sync..."
+  sleep "$WORKSPACE_SYNC_POLL_INTERVAL"
+done
+cp -r /workspace-pvc/* "$WORKSPACE_MOUNT_PATH"
+`
+
+// getWorkspaceInitConfig returns the init container settings with the job overriding the queue
+// field by field, and defaults for the fields neither sets
+func (jm *JobManager) getWorkspaceInitConfig(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) torchrunv1alpha1.WorkspaceInitContainerConfig {
+	config := torchrunv1alpha1.WorkspaceInitContainerConfig{
+		Image:               jm.config.Images.WorkspaceInit,
+		ImagePullPolicy:     corev1.PullIfNotPresent,
+		PollIntervalSeconds: 5,
+		TimeoutSeconds:      1800,
+	}
+	for _, override := range []*torchrunv1alpha1.WorkspaceInitContainerConfig{jq.Spec.WorkspaceStorage.InitContainer, job.Spec.WorkspaceStorage.InitContainer} {
+		if override == nil {
+			continue
+		}
+		if override.Image != "" {
+			config.Image = override.Image
+		}
+		if override.ImagePullPolicy != "" {
+			config.ImagePullPolicy = override.ImagePullPolicy
+		}
+		if override.PollIntervalSeconds > 0 {
+			config.PollIntervalSeconds = override.PollIntervalSeconds
+		}
+		if override.TimeoutSeconds > 0 {
+			config.TimeoutSeconds = override.TimeoutSeconds
+		}
+	}
+	return config
 }
 
 // attachWorkspaceToTrainer attaches the workspace to the trainer container
-func (jm *JobManager) attachWorkspaceToTrainer(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) {
+func (jm *JobManager) attachWorkspaceToTrainer(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) error {
+	if isEphemeralWorkspace(job, jq) {
+		return attachEphemeralWorkspace(job, jq, podSpec)
+	}
+	mountPath := getWorkspaceMountPath(job, jq)
+
+	// The Job is only created once the workspace is synced, so the PVC is mounted as it is
+	if isDirectWorkspace(job, jq) {
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "workspace",
+			MountPath: mountPath,
+			ReadOnly:  true,
+		})
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "workspace",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: GetWorkspacePVCName(job),
+					ReadOnly:  true,
+				},
+			},
+		})
+		return nil
+	}
+
 	// Attach the workspace pvc to the init container to copy files to the workspace volume
+	initConfig := jm.getWorkspaceInitConfig(job, jq)
 	podSpec.InitContainers = append(podSpec.InitContainers, corev1.Container{
 		Name:            "workspace-sync",
-		Image:           "alpine:3.18",
-		ImagePullPolicy: corev1.PullIfNotPresent,
-		Command:         []string{"/bin/sh", "-c"},
-		Args: []string{
-			fmt.Sprintf("while [ ! -f /workspace-pvc/.sync_success ]; do echo 'Waiting for workspace sync...'; sleep 5; done; cp -r /workspace-pvc/* %s", jq.Spec.WorkspaceStorage.MountPath),
+		Image:           initConfig.Image,
+		ImagePullPolicy: initConfig.ImagePullPolicy,
+		Command:         []string{"/bin/sh", "-c", workspaceInitScript},
+		Env: []corev1.EnvVar{
+			{Name: "WORKSPACE_SYNC_POLL_INTERVAL", Value: strconv.Itoa(int(initConfig.PollIntervalSeconds))},
+			{Name: "WORKSPACE_SYNC_TIMEOUT", Value: strconv.Itoa(int(initConfig.TimeoutSeconds))},
+			{Name: "WORKSPACE_MOUNT_PATH", Value: mountPath},
 		},
+		// Surface the timeout error in the pod status
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
 		VolumeMounts: []corev1.VolumeMount{
 			{
 				Name:      "workspace-pvc",
@@ -225,7 +1199,7 @@ func (jm *JobManager) attachWorkspaceToTrainer(job *torchrunv1alpha1.TorchrunJob
 			},
 			{
 				Name:      "workspace",
-				MountPath: jq.Spec.WorkspaceStorage.MountPath,
+				MountPath: mountPath,
 			},
 		},
 	})
@@ -233,7 +1207,7 @@ func (jm *JobManager) attachWorkspaceToTrainer(job *torchrunv1alpha1.TorchrunJob
 	// Attach the workspace volume to the trainer container
 	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
 		Name:      "workspace",
-		MountPath: jq.Spec.WorkspaceStorage.MountPath,
+		MountPath: mountPath,
 	})
 
 	// Workspace PVC
@@ -253,6 +1227,62 @@ func (jm *JobManager) attachWorkspaceToTrainer(job *torchrunv1alpha1.TorchrunJob
 			EmptyDir: &corev1.EmptyDirVolumeSource{},
 		},
 	})
+	return nil
+}
+
+// attachEphemeralWorkspace attaches an empty workspace volume to the trainer container of jobs
+// whose code is baked into the image. The volume is a generic ephemeral volume when a storage
+// class is set, otherwise an emptyDir limited to the workspace size.
+func attachEphemeralWorkspace(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) error {
+	size, err := getWorkspaceSize(job, jq)
+	if err != nil {
+		return err
+	}
+
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "workspace",
+		MountPath: getWorkspaceMountPath(job, jq),
+	})
+
+	storageClassName := job.Spec.WorkspaceStorage.StorageClass
+	if storageClassName == "" {
+		storageClassName = jq.Spec.WorkspaceStorage.StorageClass
+	}
+	if storageClassName == "" {
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "workspace",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{SizeLimit: &size},
+			},
+		})
+		return nil
+	}
+
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "workspace",
+		VolumeSource: corev1.VolumeSource{
+			Ephemeral: &corev1.EphemeralVolumeSource{
+				VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{
+							"torchrun.ai/job-id":   job.Spec.JobID,
+							"torchrun.ai/job-name": job.Spec.JobName,
+						},
+					},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						StorageClassName: &storageClassName,
+						AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+						Resources: corev1.VolumeResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceStorage: size,
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	return nil
 }
 
 // validatePodSpec validates the pod specification
@@ -279,14 +1309,12 @@ func (jm *JobManager) validatePodSpec(podSpec corev1.PodSpec) error {
 	return nil
 }
 
-// buildPodLabels builds the pod labels
+// buildPodLabels builds the pod labels. Queue pod template labels are overridden by the job
+// labels, and both by the labels the controller and kai-scheduler rely on.
 func (jm *JobManager) buildPodLabels(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) map[string]string {
-	labels := map[string]string{
-		"app":                   "torchrun",
-		"torchrun.ai/job-id":    job.Spec.JobID,
-		"torchrun.ai/job-name":  job.Spec.JobName,
-		"torchrun.ai/job-queue": job.Spec.Queue,
-		"kai.scheduler/queue":   jq.Spec.Queue.Name,
+	labels := map[string]string{}
+	for k, v := range jq.Spec.PodTemplateConfig.Metadata.Labels {
+		labels[k] = v
 	}
 
 	// Add user-specified labels
@@ -294,15 +1322,30 @@ func (jm *JobManager) buildPodLabels(job *torchrunv1alpha1.TorchrunJob, jq *torc
 		labels[k] = v
 	}
 
+	labels["app"] = "torchrun"
+	labels["torchrun.ai/job-id"] = job.Spec.JobID
+	labels["torchrun.ai/job-name"] = job.Spec.JobName
+	labels["torchrun.ai/job-queue"] = job.Spec.Queue
+	labels["kai.scheduler/queue"] = getKaiQueueName(job, jq)
+
+	// Pods of a queue in another namespace are counted in the queue usage by this label
+	if jq.Namespace != job.Namespace {
+		labels["torchrun.ai/job-queue-namespace"] = jq.Namespace
+	}
+
+	// kai-scheduler reads the priority class from the pod label
+	if priorityClassName := getPriorityClassName(job, jq); priorityClassName != "" {
+		labels["priorityClassName"] = priorityClassName
+	}
+
 	return labels
 }
 
-// buildPodAnnotations builds the pod annotations
+// buildPodAnnotations builds the pod annotations with the same precedence as the labels
 func (jm *JobManager) buildPodAnnotations(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) map[string]string {
-	annotations := map[string]string{
-		"torchrun.ai/job-id":    job.Spec.JobID,
-		"torchrun.ai/job-name":  job.Spec.JobName,
-		"torchrun.ai/job-queue": job.Spec.Queue,
+	annotations := map[string]string{}
+	for k, v := range jq.Spec.PodTemplateConfig.Metadata.Annotations {
+		annotations[k] = v
 	}
 
 	// Add user-specified annotations
@@ -310,6 +1353,20 @@ func (jm *JobManager) buildPodAnnotations(job *torchrunv1alpha1.TorchrunJob, jq
 		annotations[k] = v
 	}
 
+	annotations["torchrun.ai/job-id"] = job.Spec.JobID
+	annotations["torchrun.ai/job-name"] = job.Spec.JobName
+	annotations["torchrun.ai/job-queue"] = job.Spec.Queue
+
+	// kai-scheduler reads the GPU share from the pod annotations
+	if job.Spec.GPUFraction != "" {
+		annotations["gpu-fraction"] = job.Spec.GPUFraction
+	} else if job.Spec.GPUMemory > 0 {
+		annotations["gpu-memory"] = strconv.Itoa(int(job.Spec.GPUMemory))
+	}
+
+	// Keep autoscalers from removing the nodes of the workers and consume their provisioned nodes
+	attachProvisioningAnnotations(job, jq, annotations)
+
 	return annotations
 }
 
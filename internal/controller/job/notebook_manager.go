@@ -0,0 +1,282 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+const (
+	// notebookPort is the port Jupyter listens on in the trainer container
+	notebookPort = 8888
+
+	// notebookTokenKey is the key of the Jupyter token in the notebook Secret
+	notebookTokenKey = "token"
+
+	// defaultNotebookIdleTimeoutSeconds is the idle time after which a notebook shuts down when
+	// the job does not set one
+	defaultNotebookIdleTimeoutSeconds = 3600
+)
+
+// notebookScript runs the setup command of the job and serves Jupyter in its place, until the
+// server shuts down after the idle timeout. Kernels and terminals idle for the timeout are culled
+// first, as they would keep the server running. Jupyter reads its token from JUPYTER_TOKEN.
+const notebookScript = `echo "Notebook mode: start training with bash -c \"$TORCHRUN_LAUNCH_COMMAND\""
+if [ -n "$TORCHRUN_SETUP_COMMAND" ]; then
+  eval "$TORCHRUN_SETUP_COMMAND" || exit
+fi
+exec jupyter lab --ip=0.0.0.0 --port="$NOTEBOOK_PORT" --no-browser --allow-root \
+  --ServerApp.base_url="$NOTEBOOK_BASE_URL" \
+  --ServerApp.shutdown_no_activity_timeout="$NOTEBOOK_IDLE_TIMEOUT" \
+  --MappingKernelManager.cull_idle_timeout="$NOTEBOOK_IDLE_TIMEOUT" \
+  --MappingKernelManager.cull_connected=True \
+  --MappingKernelManager.cull_interval=60 \
+  --TerminalManager.cull_inactive_timeout="$NOTEBOOK_IDLE_TIMEOUT" \
+  --TerminalManager.cull_interval=60`
+
+// NotebookManager provisions the token and endpoint of notebook jobs
+type NotebookManager struct {
+	client    client.Client
+	apiReader client.Reader
+}
+
+// NewNotebookManager creates a new notebook manager. The token Secret is read through the API
+// reader, so Secrets are never cached.
+func NewNotebookManager(client client.Client, apiReader client.Reader) *NotebookManager {
+	return &NotebookManager{
+		client:    client,
+		apiReader: apiReader,
+	}
+}
+
+// attachNotebookCommand replaces the torchrun command of notebook jobs with a Jupyter server on
+// the named port jupyter of the trainer container. The torchrun command stays in
+// TORCHRUN_LAUNCH_COMMAND, so it can be started from a notebook terminal.
+func attachNotebookCommand(job *torchrunv1alpha1.TorchrunJob, podSpec *corev1.PodSpec) {
+	if !isNotebookJob(job) {
+		return
+	}
+	trainer := &podSpec.Containers[0]
+	keepLaunchCommand(trainer)
+	trainer.Env = append(trainer.Env,
+		corev1.EnvVar{Name: "NOTEBOOK_PORT", Value: strconv.Itoa(notebookPort)},
+		corev1.EnvVar{Name: "NOTEBOOK_BASE_URL", Value: getNotebookPathPrefix(job) + "/"},
+		corev1.EnvVar{Name: "NOTEBOOK_IDLE_TIMEOUT", Value: strconv.FormatInt(getNotebookIdleTimeoutSeconds(job), 10)},
+		corev1.EnvVar{
+			Name: "JUPYTER_TOKEN",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: GetNotebookName(job)},
+					Key:                  notebookTokenKey,
+				},
+			},
+		},
+	)
+	trainer.Ports = append(trainer.Ports, corev1.ContainerPort{Name: "jupyter", ContainerPort: notebookPort})
+	trainer.Command = []string{"/bin/bash", "-c", notebookScript}
+}
+
+// EnsureNotebook creates the token Secret, Service and optional Ingress of a notebook job and
+// records the URL and the Secret in the status. The token is generated once. A job that is no
+// longer a notebook has its Service and Ingress removed; the Secret is deleted with the job.
+func (nm *NotebookManager) EnsureNotebook(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) error {
+	if !isNotebookJob(job) {
+		if job.Status.Notebook == nil {
+			return nil
+		}
+		for _, obj := range []client.Object{
+			&corev1.Service{ObjectMeta: nm.objectMeta(job)},
+			&networkingv1.Ingress{ObjectMeta: nm.objectMeta(job)},
+		} {
+			if err := nm.deleteObject(ctx, obj); err != nil {
+				return err
+			}
+		}
+		job.Status.Notebook = nil
+		return nil
+	}
+
+	if job.Status.Notebook == nil || job.Status.Notebook.TokenSecretName == "" {
+		if err := nm.createTokenSecret(ctx, job); err != nil {
+			return err
+		}
+	}
+	if err := nm.createOrUpdateService(ctx, job); err != nil {
+		return err
+	}
+
+	status := &torchrunv1alpha1.NotebookStatus{TokenSecretName: GetNotebookName(job)}
+	serviceHost := fmt.Sprintf("%s.%s.svc", GetNotebookName(job), job.Namespace)
+	pathPrefix := getNotebookPathPrefix(job)
+	if job.Spec.Notebook == nil || job.Spec.Notebook.IngressClass == "" {
+		if err := nm.deleteObject(ctx, &networkingv1.Ingress{ObjectMeta: nm.objectMeta(job)}); err != nil {
+			return err
+		}
+		status.URL = fmt.Sprintf("http://%s/", serviceHost)
+	} else {
+		ingress, err := nm.createOrUpdateIngress(ctx, job, pathPrefix)
+		if err != nil {
+			return err
+		}
+		status.URL = getIngressURL(ingress, job.Spec.Notebook.Host, serviceHost, pathPrefix) + "/"
+	}
+	job.Status.Notebook = status
+	return nil
+}
+
+// notebookLabels returns the labels of the notebook resources of a job
+func notebookLabels(job *torchrunv1alpha1.TorchrunJob) map[string]string {
+	return map[string]string{
+		"app":                   "torchrun-notebook",
+		"torchrun.ai/job-id":    job.Spec.JobID,
+		"torchrun.ai/job-name":  job.Spec.JobName,
+		"torchrun.ai/job-queue": job.Spec.Queue,
+	}
+}
+
+// objectMeta returns the name and namespace of the notebook resources of a job
+func (nm *NotebookManager) objectMeta(job *torchrunv1alpha1.TorchrunJob) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      GetNotebookName(job),
+		Namespace: job.Namespace,
+	}
+}
+
+// createTokenSecret creates the Secret holding the Jupyter token of the job, keeping an existing one
+func (nm *NotebookManager) createTokenSecret(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) error {
+	existing := &corev1.Secret{}
+	err := nm.apiReader.Get(ctx, client.ObjectKey{Name: GetNotebookName(job), Namespace: job.Namespace}, existing)
+	if err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return fmt.Errorf("failed to generate notebook token: %w", err)
+	}
+
+	secret := &corev1.Secret{ObjectMeta: nm.objectMeta(job)}
+	secret.Labels = notebookLabels(job)
+	secret.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(job, job.GroupVersionKind())}
+	secret.StringData = map[string]string{notebookTokenKey: hex.EncodeToString(token)}
+
+	log.FromContext(ctx).Info("Creating notebook token", "name", secret.Name)
+	if err := nm.client.Create(ctx, secret); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create notebook token: %w", err)
+	}
+	return nil
+}
+
+// createOrUpdateService creates or updates the Service of the Jupyter server on the worker pod
+func (nm *NotebookManager) createOrUpdateService(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) error {
+	service := &corev1.Service{ObjectMeta: nm.objectMeta(job)}
+	_, err := controllerutil.CreateOrUpdate(ctx, nm.client, service, func() error {
+		service.Labels = notebookLabels(job)
+		service.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(job, job.GroupVersionKind())}
+		service.Spec.Selector = map[string]string{
+			"app":                "torchrun",
+			"torchrun.ai/job-id": job.Spec.JobID,
+		}
+		service.Spec.Ports = []corev1.ServicePort{
+			{
+				Name:       "http",
+				Port:       80,
+				TargetPort: intstr.FromString("jupyter"),
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reconcile notebook service: %w", err)
+	}
+	return nil
+}
+
+// createOrUpdateIngress creates or updates the notebook Ingress. Without a host, the notebook is
+// served below a path of its own so jobs can share the host of the ingress controller.
+func (nm *NotebookManager) createOrUpdateIngress(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, pathPrefix string) (*networkingv1.Ingress, error) {
+	notebook := job.Spec.Notebook
+	ingress := &networkingv1.Ingress{ObjectMeta: nm.objectMeta(job)}
+	_, err := controllerutil.CreateOrUpdate(ctx, nm.client, ingress, func() error {
+		pathType := networkingv1.PathTypePrefix
+		ingressPath := pathPrefix
+		if ingressPath == "" {
+			ingressPath = "/"
+		}
+
+		ingress.Labels = notebookLabels(job)
+		ingress.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(job, job.GroupVersionKind())}
+		ingress.Spec.IngressClassName = &notebook.IngressClass
+		ingress.Spec.Rules = []networkingv1.IngressRule{
+			{
+				Host: notebook.Host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{
+							{
+								Path:     ingressPath,
+								PathType: &pathType,
+								Backend: networkingv1.IngressBackend{
+									Service: &networkingv1.IngressServiceBackend{
+										Name: GetNotebookName(job),
+										Port: networkingv1.ServiceBackendPort{Name: "http"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile notebook ingress: %w", err)
+	}
+	return ingress, nil
+}
+
+// deleteObject deletes a notebook resource if it exists
+func (nm *NotebookManager) deleteObject(ctx context.Context, obj client.Object) error {
+	// Check the cache first so a missing resource does not cost a DELETE on every reconcile
+	if err := nm.client.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	log.FromContext(ctx).Info("Deleting notebook resource", "name", obj.GetName())
+	if err := nm.client.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// getNotebookPathPrefix returns the path the notebook is served below. Notebooks on an Ingress
+// without host get a path of their own, the others are served at the root.
+func getNotebookPathPrefix(job *torchrunv1alpha1.TorchrunJob) string {
+	if notebook := job.Spec.Notebook; notebook != nil && notebook.IngressClass != "" && notebook.Host == "" {
+		return fmt.Sprintf("/notebook/%s/%s", job.Namespace, job.Name)
+	}
+	return ""
+}
+
+// getNotebookIdleTimeoutSeconds returns the idle time after which the notebook of a job shuts down
+func getNotebookIdleTimeoutSeconds(job *torchrunv1alpha1.TorchrunJob) int64 {
+	if job.Spec.Notebook == nil || job.Spec.Notebook.IdleTimeoutSeconds == 0 {
+		return defaultNotebookIdleTimeoutSeconds
+	}
+	return job.Spec.Notebook.IdleTimeoutSeconds
+}
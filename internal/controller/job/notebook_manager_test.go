@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestAttachNotebookCommand(t *testing.T) {
+	tests := []struct {
+		description   string
+		mode          string
+		notebook      *torchrunv1alpha1.NotebookConfig
+		expectBaseURL string
+		expectTimeout string
+	}{
+		{
+			description: "training jobs keep the torchrun command",
+		},
+		{
+			description:   "notebook without ingress serves at the root",
+			mode:          torchrunv1alpha1.ModeNotebook,
+			expectBaseURL: "/",
+			expectTimeout: "3600",
+		},
+		{
+			description:   "notebook on an ingress without host serves below the job path",
+			mode:          torchrunv1alpha1.ModeNotebook,
+			notebook:      &torchrunv1alpha1.NotebookConfig{IngressClass: "nginx", IdleTimeoutSeconds: 600},
+			expectBaseURL: "/notebook/default/explore/",
+			expectTimeout: "600",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "explore", Namespace: "default"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{Mode: test.mode, Notebook: test.notebook},
+		}
+		podSpec := corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer", Command: []string{"/bin/bash", "-c", "torchrun --standalone"}}}}
+		attachNotebookCommand(job, &podSpec)
+
+		trainer := podSpec.Containers[0]
+		if test.expectBaseURL == "" {
+			if trainer.Command[2] != "torchrun --standalone" || len(trainer.Env) != 0 {
+				t.Errorf("%s: expected the torchrun command, got %v with env %v", test.description, trainer.Command, trainer.Env)
+			}
+			continue
+		}
+		if trainer.Command[2] != notebookScript {
+			t.Errorf("%s: expected the notebook script, got %v", test.description, trainer.Command)
+		}
+		env := map[string]corev1.EnvVar{}
+		for _, e := range trainer.Env {
+			env[e.Name] = e
+		}
+		if env["TORCHRUN_LAUNCH_COMMAND"].Value != "torchrun --standalone" {
+			t.Errorf("%s: expected the torchrun command kept, got %q", test.description, env["TORCHRUN_LAUNCH_COMMAND"].Value)
+		}
+		if env["NOTEBOOK_BASE_URL"].Value != test.expectBaseURL {
+			t.Errorf("%s: expected base URL %q, got %q", test.description, test.expectBaseURL, env["NOTEBOOK_BASE_URL"].Value)
+		}
+		if env["NOTEBOOK_IDLE_TIMEOUT"].Value != test.expectTimeout {
+			t.Errorf("%s: expected idle timeout %q, got %q", test.description, test.expectTimeout, env["NOTEBOOK_IDLE_TIMEOUT"].Value)
+		}
+		if token := env["JUPYTER_TOKEN"].ValueFrom; token == nil || token.SecretKeyRef == nil || token.SecretKeyRef.Name != "explore-notebook" {
+			t.Errorf("%s: expected the token from the notebook Secret, got %+v", test.description, env["JUPYTER_TOKEN"])
+		}
+		if len(trainer.Ports) != 1 || trainer.Ports[0].Name != "jupyter" || trainer.Ports[0].ContainerPort != notebookPort {
+			t.Errorf("%s: expected the jupyter port, got %v", test.description, trainer.Ports)
+		}
+	}
+}
+
+func TestEnsureNotebook(t *testing.T) {
+	tests := []struct {
+		description   string
+		mode          string
+		notebook      *torchrunv1alpha1.NotebookConfig
+		status        *torchrunv1alpha1.NotebookStatus
+		token         string
+		expectURL     string
+		expectIngress string
+		expectToken   string
+	}{
+		{
+			description: "training job provisions nothing",
+		},
+		{
+			description: "notebook without ingress is served through the Service",
+			mode:        torchrunv1alpha1.ModeNotebook,
+			expectURL:   "http://explore-notebook.default.svc/",
+		},
+		{
+			description:   "ingress without host serves below the job path",
+			mode:          torchrunv1alpha1.ModeNotebook,
+			notebook:      &torchrunv1alpha1.NotebookConfig{IngressClass: "nginx"},
+			expectURL:     "http://explore-notebook.default.svc/notebook/default/explore/",
+			expectIngress: "/notebook/default/explore",
+		},
+		{
+			description:   "ingress with host serves at the root",
+			mode:          torchrunv1alpha1.ModeNotebook,
+			notebook:      &torchrunv1alpha1.NotebookConfig{IngressClass: "nginx", Host: "explore.example.com"},
+			expectURL:     "http://explore.example.com/",
+			expectIngress: "/",
+		},
+		{
+			description: "existing token is kept",
+			mode:        torchrunv1alpha1.ModeNotebook,
+			token:       "existing",
+			expectURL:   "http://explore-notebook.default.svc/",
+			expectToken: "existing",
+		},
+		{
+			description: "job that is no longer a notebook has its endpoint removed",
+			status:      &torchrunv1alpha1.NotebookStatus{URL: "http://explore-notebook.default.svc/", TokenSecretName: "explore-notebook"},
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "explore", Namespace: "default", UID: "uid"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:    "research",
+				JobName:  "explore",
+				JobID:    "explore-id",
+				Mode:     test.mode,
+				Notebook: test.notebook,
+			},
+			Status: torchrunv1alpha1.TorchrunJobStatus{Notebook: test.status},
+		}
+		meta := metav1.ObjectMeta{Name: "explore-notebook", Namespace: "default"}
+		builder := fake.NewClientBuilder()
+		if test.token != "" {
+			builder = builder.WithObjects(&corev1.Secret{ObjectMeta: *meta.DeepCopy(), Data: map[string][]byte{notebookTokenKey: []byte(test.token)}})
+		}
+		if test.status != nil {
+			builder = builder.WithObjects(&corev1.Service{ObjectMeta: *meta.DeepCopy()}, &networkingv1.Ingress{ObjectMeta: *meta.DeepCopy()})
+		}
+		c := builder.Build()
+
+		nm := NewNotebookManager(c, c)
+		if err := nm.EnsureNotebook(context.Background(), job); err != nil {
+			t.Fatalf("%s: EnsureNotebook() error = %v", test.description, err)
+		}
+		if test.expectURL == "" {
+			if job.Status.Notebook != nil {
+				t.Errorf("%s: expected no notebook status, got %+v", test.description, job.Status.Notebook)
+			}
+		} else if job.Status.Notebook == nil || job.Status.Notebook.URL != test.expectURL || job.Status.Notebook.TokenSecretName != "explore-notebook" {
+			t.Errorf("%s: expected URL %q and Secret explore-notebook, got %+v", test.description, test.expectURL, job.Status.Notebook)
+		}
+
+		key := types.NamespacedName{Name: "explore-notebook", Namespace: "default"}
+		service := &corev1.Service{}
+		err := c.Get(context.Background(), key, service)
+		if test.expectURL == "" {
+			if !errors.IsNotFound(err) {
+				t.Errorf("%s: expected no service, got %v", test.description, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: expected service, got %v", test.description, err)
+		} else if service.Spec.Selector["torchrun.ai/job-id"] != "explore-id" || service.Spec.Ports[0].TargetPort.StrVal != "jupyter" {
+			t.Errorf("%s: expected service of the jupyter port of the worker, got %+v", test.description, service.Spec)
+		}
+
+		secret := &corev1.Secret{}
+		err = c.Get(context.Background(), key, secret)
+		if test.expectURL == "" {
+			if test.status == nil && !errors.IsNotFound(err) {
+				t.Errorf("%s: expected no secret, got %v", test.description, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: expected secret, got %v", test.description, err)
+		} else {
+			// The fake client does not move StringData into Data
+			token := secret.StringData[notebookTokenKey]
+			if test.token != "" {
+				token = string(secret.Data[notebookTokenKey])
+			}
+			if test.expectToken != "" && token != test.expectToken {
+				t.Errorf("%s: expected token %q, got %q", test.description, test.expectToken, token)
+			}
+			if len(token) != 48 && test.expectToken == "" {
+				t.Errorf("%s: expected a generated token, got %q", test.description, token)
+			}
+		}
+
+		ingress := &networkingv1.Ingress{}
+		err = c.Get(context.Background(), key, ingress)
+		if test.expectIngress == "" {
+			if !errors.IsNotFound(err) {
+				t.Errorf("%s: expected no ingress, got %v", test.description, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: expected ingress, got %v", test.description, err)
+		} else if path := ingress.Spec.Rules[0].HTTP.Paths[0].Path; path != test.expectIngress {
+			t.Errorf("%s: expected ingress path %q, got %q", test.description, test.expectIngress, path)
+		}
+	}
+}
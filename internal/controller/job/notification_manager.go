@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// slackURLKey is the key of the Slack incoming webhook URL in the notification Secret
+const slackURLKey = "url"
+
+// NotificationManager posts job lifecycle events to the notification targets of the queue
+type NotificationManager struct {
+	client     client.Client
+	apiReader  client.Reader
+	httpClient *http.Client
+}
+
+// NewNotificationManager creates a new notification manager. Slack Secrets are read through
+// apiReader so they are never cached by the manager.
+func NewNotificationManager(client client.Client, apiReader client.Reader) *NotificationManager {
+	return &NotificationManager{
+		client:     client,
+		apiReader:  apiReader,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NotificationEvent is the JSON body posted to webhook targets
+type NotificationEvent struct {
+	Event     string    `json:"event"`
+	Job       string    `json:"job"`
+	Namespace string    `json:"namespace"`
+	Queue     string    `json:"queue"`
+	Phase     string    `json:"phase"`
+	Attempt   int32     `json:"attempt,omitempty"`
+	Pod       string    `json:"pod,omitempty"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+}
+
+// Notify posts the lifecycle events of the job that were not posted yet and records them in
+// the status. It reports whether events were recorded. Events are recorded per target once it
+// accepted them, so failed posts are retried on the next reconcile to that target only.
+func (nm *NotificationManager) Notify(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, now time.Time) (bool, error) {
+	log := log.FromContext(ctx)
+	if len(jq.Spec.Notifications) == 0 {
+		return false, nil
+	}
+
+	events, err := nm.getPendingEvents(ctx, job, jq.Spec.Notifications, now)
+	if err != nil {
+		return false, err
+	}
+
+	notified := false
+	for _, event := range events {
+		for _, target := range jq.Spec.Notifications {
+			if !isEventPending(job, target, event) {
+				continue
+			}
+			if err := nm.post(ctx, jq, target, event); err != nil {
+				log.Error(err, "Failed to post job notification", "name", job.Name, "event", event.Event, "target", target.Name)
+				continue
+			}
+			job.Status.Notifications = append(job.Status.Notifications, torchrunv1alpha1.JobNotification{
+				Event:   event.Event,
+				Attempt: event.Attempt,
+				Pod:     event.Pod,
+				Target:  target.Name,
+				Time:    metav1.Time{Time: now},
+			})
+			notified = true
+		}
+	}
+	return notified, nil
+}
+
+// getPendingEvents returns the lifecycle events of the job that were not posted yet to every
+// target they are for: the start and end of the current attempt, the failure of earlier attempts
+// and preempted worker pods
+func (nm *NotificationManager) getPendingEvents(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, targets []torchrunv1alpha1.NotificationConfig, now time.Time) ([]NotificationEvent, error) {
+	attempt := job.Status.Attempt
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	var events []NotificationEvent
+	add := func(name string, attempt int32, pod, message string) {
+		event := NotificationEvent{
+			Event:     name,
+			Job:       job.Name,
+			Namespace: job.Namespace,
+			Queue:     job.Spec.Queue,
+			Phase:     job.Status.Phase,
+			Attempt:   attempt,
+			Pod:       pod,
+			Message:   message,
+			Time:      now,
+		}
+		pending := slices.ContainsFunc(targets, func(target torchrunv1alpha1.NotificationConfig) bool {
+			return isEventPending(job, target, event)
+		})
+		if pending && !slices.ContainsFunc(events, func(e NotificationEvent) bool {
+			return e.Event == event.Event && e.Attempt == event.Attempt && e.Pod == event.Pod
+		}) {
+			events = append(events, event)
+		}
+	}
+
+	for _, failed := range job.Status.Attempts {
+		add(torchrunv1alpha1.NotificationFailed, failed.Attempt, "",
+			fmt.Sprintf("Job attempt %d failed: %s %s", failed.Attempt, failed.Reason, failed.Message))
+	}
+	switch job.Status.Phase {
+	case torchrunv1alpha1.PhaseRunning:
+		add(torchrunv1alpha1.NotificationStarted, attempt, "",
+			fmt.Sprintf("Job started on %d nodes", job.Spec.NumNodes))
+	case torchrunv1alpha1.PhaseSucceeded:
+		add(torchrunv1alpha1.NotificationSucceeded, attempt, "", "Job succeeded")
+	case torchrunv1alpha1.PhaseFailed:
+		add(torchrunv1alpha1.NotificationFailed, attempt, "",
+			fmt.Sprintf("Job failed, workers %s", job.Status.WorkersStatus))
+	case torchrunv1alpha1.PhaseTimedOut:
+		add(torchrunv1alpha1.NotificationFailed, attempt, "", "Job timed out, it was active longer than its active deadline")
+	}
+
+	pods := &corev1.PodList{}
+	if err := nm.client.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{
+		"app":                "torchrun",
+		"torchrun.ai/job-id": job.Spec.JobID,
+	}); err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if disruption := getDisruptionTarget(pod); disruption != nil {
+			add(torchrunv1alpha1.NotificationPreempted, attempt, pod.Name,
+				fmt.Sprintf("Worker pod %s on node %s was preempted: %s", pod.Name, pod.Spec.NodeName, disruption.Reason))
+		}
+	}
+
+	return events, nil
+}
+
+// isEventPending returns true if the target takes the event and the job status does not record
+// it as posted to the target. Events recorded without a target were posted to every target.
+func isEventPending(job *torchrunv1alpha1.TorchrunJob, target torchrunv1alpha1.NotificationConfig, event NotificationEvent) bool {
+	if len(target.Events) > 0 && !slices.Contains(target.Events, event.Event) {
+		return false
+	}
+	return !slices.ContainsFunc(job.Status.Notifications, func(n torchrunv1alpha1.JobNotification) bool {
+		return n.Event == event.Event && n.Attempt == event.Attempt && n.Pod == event.Pod &&
+			(n.Target == "" || n.Target == target.Name)
+	})
+}
+
+// post sends the event to a target, as JSON to webhooks and as a message to Slack
+func (nm *NotificationManager) post(ctx context.Context, jq *torchrunv1alpha1.TorchrunQueue, target torchrunv1alpha1.NotificationConfig, event NotificationEvent) error {
+	url := target.WebhookURL
+	var body interface{} = event
+	if target.Slack != nil {
+		secret := &corev1.Secret{}
+		if err := nm.apiReader.Get(ctx, types.NamespacedName{Name: target.Slack.SecretRef.Name, Namespace: jq.Namespace}, secret); err != nil {
+			return err
+		}
+		url = string(secret.Data[slackURLKey])
+		if url == "" {
+			return fmt.Errorf("secret %s has no %s key", secret.Name, slackURLKey)
+		}
+		body = map[string]string{"text": buildSlackMessage(event)}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := nm.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("target %s responded with %s", target.Name, resp.Status)
+	}
+	return nil
+}
+
+// buildSlackMessage formats an event as a Slack message
+func buildSlackMessage(event NotificationEvent) string {
+	return fmt.Sprintf("*%s* TorchrunJob `%s/%s` in queue `%s`: %s", event.Event, event.Namespace, event.Job, event.Queue, event.Message)
+}
@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestNotify(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	// Collect the posted bodies, failing every post while fail is set and every post to /down
+	var mu sync.Mutex
+	var posts []map[string]interface{}
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail || r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		posts = append(posts, body)
+	}))
+	defer server.Close()
+
+	slackSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "slack", Namespace: "default"},
+		Data:       map[string][]byte{"url": []byte(server.URL + "/slack")},
+	}
+	webhook := torchrunv1alpha1.NotificationConfig{Name: "webhook", WebhookURL: server.URL}
+	archive := torchrunv1alpha1.NotificationConfig{Name: "archive", WebhookURL: server.URL + "/archive"}
+	down := torchrunv1alpha1.NotificationConfig{Name: "down", WebhookURL: server.URL + "/down"}
+	slack := torchrunv1alpha1.NotificationConfig{
+		Name:   "slack",
+		Slack:  &torchrunv1alpha1.SlackNotificationConfig{SecretRef: corev1.LocalObjectReference{Name: "slack"}},
+		Events: []string{torchrunv1alpha1.NotificationFailed},
+	}
+	preemptedPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "train-0",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "torchrun", "torchrun.ai/job-id": "train-id"},
+		},
+		Spec: corev1.PodSpec{NodeName: "node-a"},
+		Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{
+			Type:   corev1.DisruptionTarget,
+			Status: corev1.ConditionTrue,
+			Reason: "PreemptionByScheduler",
+		}}},
+	}
+
+	tests := []struct {
+		description  string
+		targets      []torchrunv1alpha1.NotificationConfig
+		phase        string
+		attempts     []torchrunv1alpha1.JobAttempt
+		notified     []torchrunv1alpha1.JobNotification
+		pods         []client.Object
+		fail         bool
+		expectEvents []string
+		expectPosts  int
+	}{
+		{
+			description: "queue without targets posts nothing",
+			phase:       torchrunv1alpha1.PhaseRunning,
+		},
+		{
+			description:  "started job is posted to the webhook",
+			targets:      []torchrunv1alpha1.NotificationConfig{webhook},
+			phase:        torchrunv1alpha1.PhaseRunning,
+			expectEvents: []string{torchrunv1alpha1.NotificationStarted},
+			expectPosts:  1,
+		},
+		{
+			description: "posted event is not posted again",
+			targets:     []torchrunv1alpha1.NotificationConfig{webhook},
+			phase:       torchrunv1alpha1.PhaseRunning,
+			notified:    []torchrunv1alpha1.JobNotification{{Event: torchrunv1alpha1.NotificationStarted, Attempt: 1}},
+		},
+		{
+			description:  "preempted worker pod is posted",
+			targets:      []torchrunv1alpha1.NotificationConfig{webhook},
+			phase:        torchrunv1alpha1.PhaseRunning,
+			notified:     []torchrunv1alpha1.JobNotification{{Event: torchrunv1alpha1.NotificationStarted, Attempt: 1}},
+			pods:         []client.Object{preemptedPod},
+			expectEvents: []string{torchrunv1alpha1.NotificationPreempted},
+			expectPosts:  1,
+		},
+		{
+			description: "succeeded job is not posted to a target filtering for failures",
+			targets:     []torchrunv1alpha1.NotificationConfig{slack},
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+		},
+		{
+			description:  "failed attempt is posted once to both targets",
+			targets:      []torchrunv1alpha1.NotificationConfig{webhook, slack},
+			phase:        torchrunv1alpha1.PhaseFailed,
+			attempts:     []torchrunv1alpha1.JobAttempt{{Attempt: 1, Reason: "BackoffLimitExceeded"}},
+			expectEvents: []string{torchrunv1alpha1.NotificationFailed, torchrunv1alpha1.NotificationFailed},
+			expectPosts:  2,
+		},
+		{
+			description:  "event rejected by one target is recorded for the other",
+			targets:      []torchrunv1alpha1.NotificationConfig{webhook, down},
+			phase:        torchrunv1alpha1.PhaseRunning,
+			expectEvents: []string{torchrunv1alpha1.NotificationStarted},
+			expectPosts:  1,
+		},
+		{
+			description: "event is not posted again to the target that accepted it",
+			targets:     []torchrunv1alpha1.NotificationConfig{webhook, down},
+			phase:       torchrunv1alpha1.PhaseRunning,
+			notified:    []torchrunv1alpha1.JobNotification{{Event: torchrunv1alpha1.NotificationStarted, Attempt: 1, Target: "webhook"}},
+		},
+		{
+			description:  "event is posted to the target that did not get it yet",
+			targets:      []torchrunv1alpha1.NotificationConfig{webhook, archive},
+			phase:        torchrunv1alpha1.PhaseRunning,
+			notified:     []torchrunv1alpha1.JobNotification{{Event: torchrunv1alpha1.NotificationStarted, Attempt: 1, Target: "webhook"}},
+			expectEvents: []string{torchrunv1alpha1.NotificationStarted},
+			expectPosts:  1,
+		},
+		{
+			description: "event rejected by a target is not recorded",
+			targets:     []torchrunv1alpha1.NotificationConfig{webhook},
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+			fail:        true,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{Queue: "research", JobName: "train", JobID: "train-id", NumNodes: 2},
+			Status: torchrunv1alpha1.TorchrunJobStatus{
+				Phase:         test.phase,
+				Attempts:      test.attempts,
+				Notifications: slices.Clone(test.notified),
+			},
+		}
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"},
+			Spec:       torchrunv1alpha1.JobQueueSpec{Notifications: test.targets},
+		}
+
+		mu.Lock()
+		posts = nil
+		fail = test.fail
+		mu.Unlock()
+
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(test.pods, slackSecret)...).Build()
+		nm := NewNotificationManager(c, c)
+		notified, err := nm.Notify(context.Background(), job, jq, time.Now())
+		if err != nil {
+			t.Fatalf("%s: Notify() error = %v", test.description, err)
+		}
+
+		var events []string
+		for _, n := range job.Status.Notifications[len(test.notified):] {
+			events = append(events, n.Event)
+		}
+		if !slices.Equal(events, test.expectEvents) {
+			t.Errorf("%s: expected recorded events %v, got %v", test.description, test.expectEvents, events)
+		}
+		if notified != (len(test.expectEvents) > 0) {
+			t.Errorf("%s: expected notified %v, got %v", test.description, len(test.expectEvents) > 0, notified)
+		}
+		mu.Lock()
+		if len(posts) != test.expectPosts {
+			t.Errorf("%s: expected %d posts, got %v", test.description, test.expectPosts, posts)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestBuildSlackMessage(t *testing.T) {
+	message := buildSlackMessage(NotificationEvent{
+		Event:     torchrunv1alpha1.NotificationFailed,
+		Job:       "train",
+		Namespace: "default",
+		Queue:     "research",
+		Message:   "Job failed, workers 0/2 failed",
+	})
+	expected := "*Failed* TorchrunJob `default/train` in queue `research`: Job failed, workers 0/2 failed"
+	if message != expected {
+		t.Errorf("expected %q, got %q", expected, message)
+	}
+}
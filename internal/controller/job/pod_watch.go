@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+// podStatusChangedPredicate passes pod events that change the status of the pod, e.g. its phase,
+// readiness, scheduling or container restarts, and drops updates of its metadata
+var podStatusChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldPod, ok := e.ObjectOld.(*corev1.Pod)
+		if !ok {
+			return true
+		}
+		newPod, ok := e.ObjectNew.(*corev1.Pod)
+		if !ok {
+			return true
+		}
+		return !equality.Semantic.DeepEqual(oldPod.Status, newPod.Status)
+	},
+}
+
+// findJobForWorkerPod maps a worker pod to the TorchrunJob owning its Kubernetes Job. The pods of
+// a Job are owned by the Job, not by the TorchrunJob, so owner watches do not see them.
+func (r *TorchrunJobReconciler) findJobForWorkerPod(ctx context.Context, obj client.Object) []reconcile.Request {
+	key, ok := getWorkerPodJob(ctx, r.Client, obj)
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: key}}
+}
+
+// getWorkerPodJob returns the TorchrunJob owning the Kubernetes Job of a worker pod, or false if
+// the pod is not a worker of a TorchrunJob
+func getWorkerPodJob(ctx context.Context, c client.Reader, obj client.Object) (types.NamespacedName, bool) {
+	owner := metav1.GetControllerOf(obj)
+	if owner == nil || owner.Kind != "Job" || owner.APIVersion != batchv1.SchemeGroupVersion.String() {
+		return types.NamespacedName{}, false
+	}
+	var k8sJob batchv1.Job
+	if err := c.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: owner.Name}, &k8sJob); err != nil {
+		return types.NamespacedName{}, false
+	}
+	jobOwner := metav1.GetControllerOf(&k8sJob)
+	if jobOwner == nil || jobOwner.Kind != "TorchrunJob" {
+		return types.NamespacedName{}, false
+	}
+	// Any served version of the TorchrunJob may be recorded in the owner reference
+	if gv, err := schema.ParseGroupVersion(jobOwner.APIVersion); err != nil || gv.Group != torchrunv1alpha1.GroupVersion.Group {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Namespace: obj.GetNamespace(), Name: jobOwner.Name}, true
+}
+
+// getRequeueInterval returns when the job is reconciled again without a watch event. Jobs waiting
+// on what is not watched are polled, a job with an active deadline is requeued when it is due its
+// deadline warning, a job with a maximum runtime when it exceeds it, a running job of a queue with
+// GPU metrics when its next sample is due, and the others are resynced slowly.
+func getRequeueInterval(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, cfg config.Reconcile, now time.Time) time.Duration {
+	interval := cfg.ResyncInterval.Duration
+	polled := job.Status.Phase == torchrunv1alpha1.PhasePending || job.Status.Phase == torchrunv1alpha1.PhaseQueued
+	for _, condition := range []string{"RendezvousReady", "LogsArchived", "WorkspaceSnapshotted"} {
+		polled = polled || getConditionStatus(job, condition) == "Unknown"
+	}
+	if polled && cfg.PollInterval.Duration < interval {
+		interval = cfg.PollInterval.Duration
+	}
+
+	deadline := job.Spec.Reliability.ActiveDeadlineSeconds
+	if job.Status.DeadlineTime != nil && deadline != nil && !isConditionTrue(job, "DeadlineApproaching") {
+		budget := time.Duration(*deadline) * time.Second
+		warnAt := job.Status.DeadlineTime.Add(-budget * time.Duration(100-getDeadlineWarningPercent(job)) / 100)
+		if until := warnAt.Sub(now); until < interval {
+			interval = max(until, time.Second)
+		}
+	}
+	if job.Status.RuntimeLimitTime != nil && !isConditionTrue(job, "MaxRuntimeExceeded") {
+		if until := job.Status.RuntimeLimitTime.Sub(now); until < interval {
+			interval = max(until, time.Second)
+		}
+	}
+	if metrics := jq.Spec.GPUMetrics; metrics != nil && job.Status.Phase == torchrunv1alpha1.PhaseRunning {
+		until := getGPUMetricsInterval(metrics)
+		if utilization := job.Status.GPUUtilization; utilization != nil && utilization.SampleTime != nil {
+			until = utilization.SampleTime.Add(until).Sub(now)
+		}
+		if until < interval {
+			interval = max(until, time.Second)
+		}
+	}
+	return interval
+}
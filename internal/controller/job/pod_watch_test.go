@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestFindJobForWorkerPod(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	isController := true
+	ownedBy := func(apiVersion, kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name, Controller: &isController}}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "train-attempt-2", Namespace: "ml-platform",
+			OwnerReferences: ownedBy("torchrun.ai/v1beta1", "TorchrunJob", "train")}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "etl", Namespace: "ml-platform"}},
+	).Build()
+	r := &TorchrunJobReconciler{Client: c, Scheme: scheme}
+
+	tests := []struct {
+		description string
+		owners      []metav1.OwnerReference
+		expectJob   string
+	}{
+		{
+			description: "worker pod maps to the TorchrunJob of its Job",
+			owners:      ownedBy("batch/v1", "Job", "train-attempt-2"),
+			expectJob:   "ml-platform/train",
+		},
+		{
+			description: "pod of a Job not owned by a TorchrunJob is ignored",
+			owners:      ownedBy("batch/v1", "Job", "etl"),
+		},
+		{
+			description: "pod of a missing Job is ignored",
+			owners:      ownedBy("batch/v1", "Job", "deleted"),
+		},
+		{
+			description: "pod without a Job is ignored",
+			owners:      ownedBy("apps/v1", "ReplicaSet", "train"),
+		},
+	}
+
+	for _, test := range tests {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "ml-platform", OwnerReferences: test.owners}}
+		requests := r.findJobForWorkerPod(context.Background(), pod)
+		if test.expectJob == "" && len(requests) > 0 {
+			t.Errorf("%s: expected no request, got %v", test.description, requests)
+		}
+		if test.expectJob != "" && (len(requests) != 1 || requests[0].String() != test.expectJob) {
+			t.Errorf("%s: expected a request for %s, got %v", test.description, test.expectJob, requests)
+		}
+	}
+}
+
+func TestGetRequeueInterval(t *testing.T) {
+	now := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	deadline := int64(3600)
+	cfg := config.Default().Reconcile
+
+	tests := []struct {
+		description      string
+		phase            string
+		conditions       []torchrunv1alpha1.TorchrunJobCondition
+		deadlineTime     *metav1.Time
+		runtimeLimitTime *metav1.Time
+		gpuMetrics       *torchrunv1alpha1.GPUMetricsConfig
+		gpuUtilization   *torchrunv1alpha1.GPUUtilizationStatus
+		expectInterval   time.Duration
+	}{
+		{
+			description:    "running job is resynced slowly",
+			phase:          torchrunv1alpha1.PhaseRunning,
+			expectInterval: 5 * time.Minute,
+		},
+		{
+			description:    "queued job is polled for its queue position",
+			phase:          torchrunv1alpha1.PhaseQueued,
+			expectInterval: 15 * time.Second,
+		},
+		{
+			description:    "running job waiting for its rendezvous is polled",
+			phase:          torchrunv1alpha1.PhaseRunning,
+			conditions:     []torchrunv1alpha1.TorchrunJobCondition{{Type: "RendezvousReady", Status: "Unknown"}},
+			expectInterval: 15 * time.Second,
+		},
+		{
+			description:    "job due its deadline warning is requeued when it is due",
+			phase:          torchrunv1alpha1.PhaseRunning,
+			deadlineTime:   &metav1.Time{Time: now.Add(8 * time.Minute)},
+			expectInterval: 2 * time.Minute,
+		},
+		{
+			description:    "warned job is resynced slowly",
+			phase:          torchrunv1alpha1.PhaseRunning,
+			conditions:     []torchrunv1alpha1.TorchrunJobCondition{{Type: "DeadlineApproaching", Status: "True"}},
+			deadlineTime:   &metav1.Time{Time: now.Add(4 * time.Minute)},
+			expectInterval: 5 * time.Minute,
+		},
+		{
+			description:      "job due its maximum runtime is requeued when it exceeds it",
+			phase:            torchrunv1alpha1.PhaseRunning,
+			runtimeLimitTime: &metav1.Time{Time: now.Add(3 * time.Minute)},
+			expectInterval:   3 * time.Minute,
+		},
+		{
+			description:      "signaled job is resynced slowly",
+			phase:            torchrunv1alpha1.PhaseRunning,
+			conditions:       []torchrunv1alpha1.TorchrunJobCondition{{Type: "MaxRuntimeExceeded", Status: "True"}},
+			runtimeLimitTime: &metav1.Time{Time: now.Add(-time.Minute)},
+			expectInterval:   5 * time.Minute,
+		},
+		{
+			description:    "running job with GPU metrics is requeued for its first sample",
+			phase:          torchrunv1alpha1.PhaseRunning,
+			gpuMetrics:     &torchrunv1alpha1.GPUMetricsConfig{IntervalSeconds: 60},
+			expectInterval: time.Minute,
+		},
+		{
+			description:    "running job with GPU metrics is requeued when its next sample is due",
+			phase:          torchrunv1alpha1.PhaseRunning,
+			gpuMetrics:     &torchrunv1alpha1.GPUMetricsConfig{IntervalSeconds: 60},
+			gpuUtilization: &torchrunv1alpha1.GPUUtilizationStatus{SampleTime: &metav1.Time{Time: now.Add(-20 * time.Second)}},
+			expectInterval: 40 * time.Second,
+		},
+		{
+			description:    "queued job with GPU metrics is polled",
+			phase:          torchrunv1alpha1.PhaseQueued,
+			gpuMetrics:     &torchrunv1alpha1.GPUMetricsConfig{IntervalSeconds: 5},
+			expectInterval: 15 * time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			Spec: torchrunv1alpha1.TorchrunJobSpec{Reliability: torchrunv1alpha1.ReliabilityConfig{ActiveDeadlineSeconds: &deadline}},
+			Status: torchrunv1alpha1.TorchrunJobStatus{
+				Phase:            test.phase,
+				Conditions:       test.conditions,
+				DeadlineTime:     test.deadlineTime,
+				RuntimeLimitTime: test.runtimeLimitTime,
+				GPUUtilization:   test.gpuUtilization,
+			},
+		}
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{GPUMetrics: test.gpuMetrics}}
+		if interval := getRequeueInterval(job, jq, cfg, now); interval != test.expectInterval {
+			t.Errorf("%s: expected interval %s, got %s", test.description, test.expectInterval, interval)
+		}
+	}
+}
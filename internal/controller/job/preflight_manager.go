@@ -0,0 +1,267 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// preflightBenchmark is the default preflight: an all-reduce of a 256 MiB buffer over every GPU
+// of the job that reports the bus bandwidth, computed like nccl-tests, and fails below
+// TORCHRUN_PREFLIGHT_MIN_BUSBW
+const preflightBenchmark = `import os, sys, time
+import torch
+import torch.distributed as dist
+
+dist.init_process_group("nccl")
+torch.cuda.set_device(int(os.environ["LOCAL_RANK"]))
+rank, world = dist.get_rank(), dist.get_world_size()
+size = 256 * 1024 * 1024
+x = torch.ones(size // 4, dtype=torch.float32, device="cuda")
+for _ in range(5):
+    dist.all_reduce(x)
+torch.cuda.synchronize()
+iters = 20
+start = time.time()
+for _ in range(iters):
+    dist.all_reduce(x)
+torch.cuda.synchronize()
+elapsed = (time.time() - start) / iters
+busbw = size / elapsed * 2 * (world - 1) / max(world, 1) / 1e9
+if rank == 0:
+    print(f"all_reduce of {size >> 20} MiB over {world} ranks: bus bandwidth {busbw:.1f} GB/s", flush=True)
+dist.destroy_process_group()
+minimum = float(os.environ.get("TORCHRUN_PREFLIGHT_MIN_BUSBW", "0"))
+if world > 1 and busbw < minimum:
+    print(f"bus bandwidth {busbw:.1f} GB/s is below the minimum of {minimum:g} GB/s", file=sys.stderr, flush=True)
+    sys.exit(1)
+`
+
+// PreflightResult is the state of the preflight of a job
+type PreflightResult struct {
+	// Passed is true when the training Job may be created
+	Passed bool
+
+	// Failed is true when the preflight failed and the job must not start
+	Failed bool
+
+	// Reason is a machine-readable reason for the state, empty for jobs without a preflight and
+	// suspended jobs waiting for it
+	Reason string
+
+	// Message is a human-readable explanation of the state
+	Message string
+}
+
+// PreflightManager runs the interconnect test of a job before its training Job is created
+type PreflightManager struct {
+	client     client.Client
+	jobManager *JobManager
+}
+
+// NewPreflightManager creates a new preflight manager. The job manager builds the preflight
+// workers from the queue pod template the same way as the training workers.
+func NewPreflightManager(client client.Client, jobManager *JobManager) *PreflightManager {
+	return &PreflightManager{
+		client:     client,
+		jobManager: jobManager,
+	}
+}
+
+// RunPreflight creates the preflight Job of the job and reports its state. The preflight runs
+// once, before the first training Job; once it passed its Job is deleted. Jobs without a
+// preflight, on shared GPUs or without GPUs pass right away.
+func (pm *PreflightManager) RunPreflight(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*PreflightResult, error) {
+	preflight := job.Spec.Preflight
+	if preflight == nil || !preflight.Enabled || isConditionTrue(job, "JobCreated") || isConditionTrue(job, "Preflight") {
+		return &PreflightResult{Passed: true}, nil
+	}
+	if sharesGPU(job) {
+		return &PreflightResult{Passed: true, Reason: "PreflightSkipped", Message: "Jobs sharing a GPU skip the preflight"}, nil
+	}
+	if isDebugJob(job) {
+		return &PreflightResult{Passed: true, Reason: "PreflightSkipped", Message: "Debug jobs skip the preflight"}, nil
+	}
+	if isNotebookJob(job) {
+		return &PreflightResult{Passed: true, Reason: "PreflightSkipped", Message: "Notebook jobs skip the preflight"}, nil
+	}
+
+	existing := &batchv1.Job{}
+	err := pm.client.Get(ctx, types.NamespacedName{Name: GetPreflightJobName(job), Namespace: job.Namespace}, existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if errors.IsNotFound(err) {
+		if job.Spec.Suspend {
+			// Suspended jobs wait without a condition, the preflight starts once they are resumed
+			return &PreflightResult{}, nil
+		}
+		preflightJob, err := pm.buildPreflightJob(ctx, job, jq)
+		if err != nil {
+			return nil, err
+		}
+		if preflightJob == nil {
+			return &PreflightResult{Passed: true, Reason: "PreflightSkipped", Message: "Trainer requests no GPUs, skipped the preflight"}, nil
+		}
+		if job.Spec.NumNodes > 1 {
+			if err := pm.jobManager.createWorkerService(ctx, job); err != nil {
+				return nil, err
+			}
+		}
+		log.FromContext(ctx).Info("Creating preflight Job", "name", preflightJob.Name)
+		if err := pm.client.Create(ctx, preflightJob); err != nil && !errors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		return &PreflightResult{Reason: "PreflightRunning", Message: fmt.Sprintf("Preflight Job %s created", preflightJob.Name)}, nil
+	}
+
+	if failed := getJobFailedCondition(existing); failed != nil {
+		return &PreflightResult{
+			Failed:  true,
+			Reason:  "PreflightFailed",
+			Message: fmt.Sprintf("Preflight Job %s failed: %s; see its pod logs", existing.Name, failed.Message),
+		}, nil
+	}
+	for _, condition := range existing.Status.Conditions {
+		if condition.Type == batchv1.JobComplete && condition.Status == corev1.ConditionTrue {
+			// The workers of the training Job take the nodes of the preflight workers
+			log.FromContext(ctx).Info("Preflight passed, deleting preflight Job", "name", existing.Name)
+			if err := pm.client.Delete(ctx, existing, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+				return nil, err
+			}
+			return &PreflightResult{
+				Passed:  true,
+				Reason:  "PreflightPassed",
+				Message: fmt.Sprintf("Preflight all-reduce on %d nodes succeeded", job.Spec.NumNodes),
+			}, nil
+		}
+	}
+	return &PreflightResult{Reason: "PreflightRunning", Message: fmt.Sprintf("Waiting for preflight Job %s", existing.Name)}, nil
+}
+
+// buildPreflightJob builds the preflight Job from the queue pod template: the trainer alone,
+// placed, scheduled and tuned like the training workers, running the preflight under torchrun.
+// It returns nil if the trainer requests no GPUs.
+func (pm *PreflightManager) buildPreflightJob(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*batchv1.Job, error) {
+	jm := pm.jobManager
+	podSpec, err := getPodSpec(job, jq)
+	if err != nil {
+		return nil, err
+	}
+	if err := jm.validatePodSpec(podSpec); err != nil {
+		return nil, err
+	}
+	if err := jm.translateResourceNames(&podSpec, jq); err != nil {
+		return nil, err
+	}
+	nproc := getTrainerGPUs(&podSpec)
+	if nproc == 0 {
+		return nil, nil
+	}
+
+	// Sidecars would keep the preflight workers running after the test
+	podSpec.Containers = podSpec.Containers[:1]
+	podSpec.SchedulerName = jm.getSchedulerName(job, jq)
+	if priorityClassName := getPriorityClassName(job, jq); priorityClassName != "" {
+		podSpec.PriorityClassName = priorityClassName
+	}
+	podSpec.RestartPolicy = corev1.RestartPolicyNever
+	if err := jm.attachNetworking(jq, &podSpec); err != nil {
+		return nil, err
+	}
+	jm.attachEnvironment(job, jq, &podSpec)
+	jm.attachCapacityPlacement(job, jq, &podSpec)
+	jm.attachSchedulingConstraints(jq, &podSpec)
+	jm.attachNodeExclusion(job, &podSpec)
+	if err := jm.attachDataLocality(ctx, job, &podSpec); err != nil {
+		return nil, err
+	}
+	attachSecurityPolicy(jq, &podSpec)
+
+	preflight := job.Spec.Preflight
+	trainer := &podSpec.Containers[0]
+	if preflight.Image != "" {
+		trainer.Image = preflight.Image
+	}
+	trainer.Args = nil
+	trainer.Env = append(trainer.Env,
+		corev1.EnvVar{Name: "TORCHRUN_PREFLIGHT_BENCHMARK", Value: preflightBenchmark},
+		corev1.EnvVar{Name: "TORCHRUN_PREFLIGHT_MIN_BUSBW", Value: strconv.Itoa(int(preflight.MinBusBandwidthGBps))},
+	)
+	script := preflight.Script
+	if script == "" {
+		script = `python -c "$TORCHRUN_PREFLIGHT_BENCHMARK"`
+	}
+	trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "TORCHRUN_COMMAND", Value: script})
+
+	name := GetPreflightJobName(job)
+	rdzvID := shellQuote(job.Spec.JobName + "-preflight")
+	cmdParts := []string{"torchrun"}
+	if job.Spec.NumNodes > 1 {
+		podSpec.Subdomain = GetWorkerServiceName(job)
+		endpoint := fmt.Sprintf("%s-0.%s.%s.svc:%d", name, GetWorkerServiceName(job), job.Namespace, getMasterPort(jq))
+		cmdParts = append(cmdParts,
+			"--node_rank", "$(JOB_COMPLETION_INDEX)",
+			"--nnodes", strconv.Itoa(job.Spec.NumNodes),
+			"--nproc-per-node", strconv.Itoa(nproc),
+			"--rdzv-backend", "c10d",
+			"--rdzv-endpoint", shellQuote(endpoint),
+			"--rdzv-id", rdzvID,
+		)
+	} else {
+		cmdParts = append(cmdParts, "--standalone", "--nproc-per-node", strconv.Itoa(nproc), "--rdzv-id", rdzvID)
+	}
+	cmdParts = append(cmdParts, "--no-python", "/bin/bash", "-c", `"$TORCHRUN_COMMAND"`)
+	trainer.Command = []string{"/bin/bash", "-c", strings.Join(cmdParts, " ")}
+
+	// The preflight workers are not counted as training workers, but their GPUs count in the queue
+	labels := jm.buildPodLabels(job, jq)
+	labels["app"] = "torchrun-preflight"
+
+	parallelism := int32(job.Spec.NumNodes)
+	backoffLimit := int32(0)
+	deadline := int64(preflight.TimeoutSeconds)
+	if deadline <= 0 {
+		deadline = 600
+	}
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: job.Namespace,
+			Labels: map[string]string{
+				"app":                   "torchrun-preflight",
+				"torchrun.ai/job-id":    job.Spec.JobID,
+				"torchrun.ai/job-name":  job.Spec.JobName,
+				"torchrun.ai/job-queue": job.Spec.Queue,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, job.GroupVersionKind()),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Parallelism:           &parallelism,
+			Completions:           &parallelism,
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &deadline,
+			CompletionMode:        completionModePtr(batchv1.IndexedCompletion),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      labels,
+					Annotations: jm.buildPodAnnotations(job, jq),
+				},
+				Spec: podSpec,
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,249 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestRunPreflight(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue: torchrunv1alpha1.QueueConfig{Name: "research"},
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+				Spec: runtime.RawExtension{Raw: []byte(`{"containers":[
+					{"name":"trainer","image":"pytorch:2.3","resources":{"requests":{"nvidia.com/gpu":"8"}}},
+					{"name":"exporter","image":"exporter","command":["exporter"]}
+				]}`)},
+			},
+			Distributed: torchrunv1alpha1.DistributedConfig{NCCLTuning: map[string]string{"NCCL_IB_HCA": "mlx5"}},
+		},
+	}
+	preflightJob := func(condition batchv1.JobConditionType) *batchv1.Job {
+		k8sJob := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "train-preflight", Namespace: "default"}}
+		if condition != "" {
+			k8sJob.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue, Message: "Job has reached the specified backoff limit"}}
+		}
+		return k8sJob
+	}
+
+	tests := []struct {
+		description   string
+		preflight     *torchrunv1alpha1.PreflightConfig
+		gpuFraction   string
+		suspend       bool
+		conditions    []torchrunv1alpha1.TorchrunJobCondition
+		existing      *batchv1.Job
+		expectPassed  bool
+		expectFailed  bool
+		expectReason  string
+		expectCreated bool
+		expectDeleted bool
+	}{
+		{
+			description:  "job without preflight passes",
+			expectPassed: true,
+		},
+		{
+			description:  "disabled preflight passes",
+			preflight:    &torchrunv1alpha1.PreflightConfig{Enabled: false},
+			expectPassed: true,
+		},
+		{
+			description:  "job whose training Job was created does not run the preflight",
+			preflight:    &torchrunv1alpha1.PreflightConfig{Enabled: true},
+			conditions:   []torchrunv1alpha1.TorchrunJobCondition{{Type: "JobCreated", Status: "True"}},
+			expectPassed: true,
+		},
+		{
+			description:  "job sharing a GPU skips the preflight",
+			preflight:    &torchrunv1alpha1.PreflightConfig{Enabled: true},
+			gpuFraction:  "0.5",
+			expectPassed: true,
+			expectReason: "PreflightSkipped",
+		},
+		{
+			description:   "preflight Job is created",
+			preflight:     &torchrunv1alpha1.PreflightConfig{Enabled: true, TimeoutSeconds: 300},
+			expectReason:  "PreflightRunning",
+			expectCreated: true,
+		},
+		{
+			description: "suspended job waits without a preflight Job",
+			preflight:   &torchrunv1alpha1.PreflightConfig{Enabled: true},
+			suspend:     true,
+		},
+		{
+			description:  "running preflight Job is waited for",
+			preflight:    &torchrunv1alpha1.PreflightConfig{Enabled: true},
+			existing:     preflightJob(""),
+			expectReason: "PreflightRunning",
+		},
+		{
+			description:  "failed preflight Job fails the job",
+			preflight:    &torchrunv1alpha1.PreflightConfig{Enabled: true},
+			existing:     preflightJob(batchv1.JobFailed),
+			expectFailed: true,
+			expectReason: "PreflightFailed",
+		},
+		{
+			description:   "succeeded preflight Job passes and is deleted",
+			preflight:     &torchrunv1alpha1.PreflightConfig{Enabled: true},
+			existing:      preflightJob(batchv1.JobComplete),
+			expectPassed:  true,
+			expectReason:  "PreflightPassed",
+			expectDeleted: true,
+		},
+	}
+
+	for _, test := range tests {
+		builder := fake.NewClientBuilder().WithScheme(scheme)
+		if test.existing != nil {
+			builder = builder.WithObjects(test.existing)
+		}
+		c := builder.Build()
+		pm := NewPreflightManager(c, NewJobManager(c, true, config.Default()))
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default", UID: "train-uid"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:       "research",
+				JobName:     "train",
+				JobID:       "train-id",
+				NumNodes:    2,
+				GPUFraction: test.gpuFraction,
+				Suspend:     test.suspend,
+				Preflight:   test.preflight,
+			},
+			Status: torchrunv1alpha1.TorchrunJobStatus{Conditions: test.conditions},
+		}
+
+		result, err := pm.RunPreflight(context.Background(), job, jq)
+		if err != nil {
+			t.Fatalf("%s: RunPreflight() error = %v", test.description, err)
+		}
+		if result.Passed != test.expectPassed || result.Failed != test.expectFailed || result.Reason != test.expectReason {
+			t.Errorf("%s: got passed=%v failed=%v reason=%s", test.description, result.Passed, result.Failed, result.Reason)
+		}
+
+		created := &batchv1.Job{}
+		err = c.Get(context.Background(), types.NamespacedName{Name: "train-preflight", Namespace: "default"}, created)
+		if test.expectCreated {
+			if err != nil {
+				t.Fatalf("%s: expected the preflight Job to be created: %v", test.description, err)
+			}
+			service := &corev1.Service{}
+			if err := c.Get(context.Background(), client.ObjectKey{Name: "train-workers", Namespace: "default"}, service); err != nil {
+				t.Errorf("%s: expected the worker Service for the preflight: %v", test.description, err)
+			}
+		}
+		if test.expectDeleted && !errors.IsNotFound(err) {
+			t.Errorf("%s: expected the preflight Job to be deleted, got %v", test.description, err)
+		}
+		if test.existing == nil && !test.expectCreated && !errors.IsNotFound(err) {
+			t.Errorf("%s: expected no preflight Job, got %v", test.description, err)
+		}
+	}
+}
+
+func TestBuildPreflightJob(t *testing.T) {
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue: torchrunv1alpha1.QueueConfig{Name: "research"},
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+				Spec: runtime.RawExtension{Raw: []byte(`{"containers":[
+					{"name":"trainer","image":"pytorch:2.3","resources":{"requests":{"nvidia.com/gpu":"8"}}},
+					{"name":"exporter","image":"exporter","command":["exporter"]}
+				]}`)},
+			},
+			Distributed: torchrunv1alpha1.DistributedConfig{NCCLTuning: map[string]string{"NCCL_IB_HCA": "mlx5"}},
+		},
+	}
+	job := &torchrunv1alpha1.TorchrunJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+		Spec: torchrunv1alpha1.TorchrunJobSpec{
+			Queue:     "research",
+			JobName:   "train",
+			JobID:     "train-id",
+			NumNodes:  4,
+			Preflight: &torchrunv1alpha1.PreflightConfig{Enabled: true, Image: "nccl-tests:latest", MinBusBandwidthGBps: 100, TimeoutSeconds: 300},
+		},
+	}
+	pm := NewPreflightManager(fake.NewClientBuilder().Build(), NewJobManager(fake.NewClientBuilder().Build(), true, config.Default()))
+
+	preflightJob, err := pm.buildPreflightJob(context.Background(), job, jq)
+	if err != nil {
+		t.Fatalf("buildPreflightJob() error = %v", err)
+	}
+
+	if *preflightJob.Spec.Parallelism != 4 || *preflightJob.Spec.Completions != 4 || *preflightJob.Spec.BackoffLimit != 0 {
+		t.Errorf("expected 4 workers without retries, got parallelism=%d completions=%d backoffLimit=%d",
+			*preflightJob.Spec.Parallelism, *preflightJob.Spec.Completions, *preflightJob.Spec.BackoffLimit)
+	}
+	if *preflightJob.Spec.ActiveDeadlineSeconds != 300 {
+		t.Errorf("expected the timeout as deadline, got %d", *preflightJob.Spec.ActiveDeadlineSeconds)
+	}
+	labels := preflightJob.Spec.Template.Labels
+	if labels["app"] != "torchrun-preflight" || labels["kai.scheduler/queue"] != "research" || labels["torchrun.ai/job-id"] != "train-id" {
+		t.Errorf("expected preflight pods scheduled in the queue but not counted as workers, got labels %v", labels)
+	}
+
+	podSpec := preflightJob.Spec.Template.Spec
+	if len(podSpec.Containers) != 1 || len(podSpec.InitContainers) != 0 {
+		t.Fatalf("expected the trainer alone, got %d containers and %d init containers", len(podSpec.Containers), len(podSpec.InitContainers))
+	}
+	if podSpec.Subdomain != "train-workers" || podSpec.RestartPolicy != corev1.RestartPolicyNever {
+		t.Errorf("expected subdomain train-workers and restartPolicy Never, got %q and %q", podSpec.Subdomain, podSpec.RestartPolicy)
+	}
+	trainer := podSpec.Containers[0]
+	if trainer.Image != "nccl-tests:latest" {
+		t.Errorf("expected the preflight image, got %s", trainer.Image)
+	}
+	script := trainer.Command[2]
+	for _, part := range []string{
+		"--nnodes 4",
+		"--nproc-per-node 8",
+		"--rdzv-endpoint 'train-preflight-0.train-workers.default.svc:29500'",
+		`"$TORCHRUN_COMMAND"`,
+	} {
+		if !strings.Contains(script, part) {
+			t.Errorf("expected %q in the preflight command %q", part, script)
+		}
+	}
+	env := map[string]string{}
+	for _, e := range trainer.Env {
+		env[e.Name] = e.Value
+	}
+	if env["NCCL_IB_HCA"] != "mlx5" || env["TORCHRUN_PREFLIGHT_MIN_BUSBW"] != "100" || env["TORCHRUN_COMMAND"] != `python -c "$TORCHRUN_PREFLIGHT_BENCHMARK"` {
+		t.Errorf("expected the queue NCCL tuning and the benchmark in the env, got %v", env)
+	}
+
+	// A trainer without GPUs has no interconnect to test
+	cpuQueue := jq.DeepCopy()
+	cpuQueue.Spec.PodTemplateConfig.Spec.Raw = []byte(`{"containers":[{"name":"trainer","image":"python:3.12"}]}`)
+	if preflightJob, err := pm.buildPreflightJob(context.Background(), job, cpuQueue); err != nil || preflightJob != nil {
+		t.Errorf("expected no preflight Job for a trainer without GPUs, got %v, %v", preflightJob, err)
+	}
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// workerProcessesProbeScript passes when the processes of the given number of local ranks run.
+// torchrun sets LOCAL_RANK in the environment of every worker process, which their children
+// inherit, so the distinct values count the workers.
+const workerProcessesProbeScript = `ranks=()
+for environ in /proc/[0-9]*/environ; do
+  while IFS= read -r -d '' var; do
+    case "$var" in LOCAL_RANK=*) ranks[${var#LOCAL_RANK=}]=1 ;; esac
+  done 2>/dev/null < "$environ"
+done
+[ "${#ranks[@]}" -ge %d ]`
+
+// attachTrainerProbes adds the startup and liveness probes of the job to the trainer container,
+// replacing those of the queue pod template. The trainer of debug and notebook jobs is not probed.
+func (jm *JobManager) attachTrainerProbes(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) {
+	probes := job.Spec.Reliability.Probes
+	if probes == nil || isInteractiveJob(job) {
+		return
+	}
+	trainer := &podSpec.Containers[0]
+	// CPU jobs run a single worker process
+	nproc := getNprocPerNode(job, jq, podSpec)
+	if nproc < 1 {
+		nproc = 1
+	}
+	if probes.Startup != nil {
+		trainer.StartupProbe = buildTrainerProbe(probes.Startup, nproc)
+	}
+	if probes.Liveness != nil {
+		trainer.LivenessProbe = buildTrainerProbe(probes.Liveness, nproc)
+	}
+}
+
+// buildTrainerProbe builds the exec probe of a trainer probe config, defaulting the fields the
+// API server defaults for objects created before they had defaults
+func buildTrainerProbe(config *torchrunv1alpha1.TrainerProbe, nproc int) *corev1.Probe {
+	command := fmt.Sprintf(workerProcessesProbeScript, nproc)
+	if config.Mode == "command" {
+		command = config.Command
+	}
+	probe := &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{Command: []string{"/bin/bash", "-c", command}},
+		},
+		InitialDelaySeconds: config.InitialDelaySeconds,
+		PeriodSeconds:       config.PeriodSeconds,
+		TimeoutSeconds:      config.TimeoutSeconds,
+		FailureThreshold:    config.FailureThreshold,
+	}
+	if probe.PeriodSeconds == 0 {
+		probe.PeriodSeconds = 10
+	}
+	if probe.TimeoutSeconds == 0 {
+		probe.TimeoutSeconds = 5
+	}
+	if probe.FailureThreshold == 0 {
+		probe.FailureThreshold = 3
+	}
+	return probe
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestAttachTrainerProbes(t *testing.T) {
+	jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+	// The exec probe of the trainer running the given command
+	exec := func(command string, period, timeout, threshold int32) *corev1.Probe {
+		return &corev1.Probe{
+			ProbeHandler:     corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"/bin/bash", "-c", command}}},
+			PeriodSeconds:    period,
+			TimeoutSeconds:   timeout,
+			FailureThreshold: threshold,
+		}
+	}
+
+	tests := []struct {
+		description    string
+		probes         *torchrunv1alpha1.TrainerProbesConfig
+		mode           string
+		gpuFraction    string
+		expectStartup  *corev1.Probe
+		expectLiveness *corev1.Probe
+	}{
+		{
+			description: "job without probes",
+		},
+		{
+			description:   "startup probe waits for a worker process per GPU",
+			probes:        &torchrunv1alpha1.TrainerProbesConfig{Startup: &torchrunv1alpha1.TrainerProbe{Mode: "processes", PeriodSeconds: 30, FailureThreshold: 40}},
+			expectStartup: exec(fmt.Sprintf(workerProcessesProbeScript, 8), 30, 5, 40),
+		},
+		{
+			description:   "worker on a shared GPU runs a single process",
+			probes:        &torchrunv1alpha1.TrainerProbesConfig{Startup: &torchrunv1alpha1.TrainerProbe{}},
+			gpuFraction:   "0.5",
+			expectStartup: exec(fmt.Sprintf(workerProcessesProbeScript, 1), 10, 5, 3),
+		},
+		{
+			description: "liveness probe runs the command of the job",
+			probes: &torchrunv1alpha1.TrainerProbesConfig{
+				Liveness: &torchrunv1alpha1.TrainerProbe{Mode: "command", Command: "python health.py", PeriodSeconds: 60, TimeoutSeconds: 10, FailureThreshold: 2},
+			},
+			expectLiveness: exec("python health.py", 60, 10, 2),
+		},
+		{
+			description: "idle trainer of a debug job is not probed",
+			probes:      &torchrunv1alpha1.TrainerProbesConfig{Startup: &torchrunv1alpha1.TrainerProbe{}},
+			mode:        torchrunv1alpha1.ModeDebug,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{Spec: torchrunv1alpha1.TorchrunJobSpec{
+			Mode:        test.mode,
+			GPUFraction: test.gpuFraction,
+			Reliability: torchrunv1alpha1.ReliabilityConfig{Probes: test.probes},
+		}}
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{
+			Name:      "trainer",
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{gpuResourceName: resource.MustParse("8")}},
+		}}}
+
+		jm.attachTrainerProbes(job, &torchrunv1alpha1.TorchrunQueue{}, podSpec)
+		trainer := podSpec.Containers[0]
+		if !reflect.DeepEqual(trainer.StartupProbe, test.expectStartup) {
+			t.Errorf("%s: expected startup probe %+v, got %+v", test.description, test.expectStartup, trainer.StartupProbe)
+		}
+		if !reflect.DeepEqual(trainer.LivenessProbe, test.expectLiveness) {
+			t.Errorf("%s: expected liveness probe %+v, got %+v", test.description, test.expectLiveness, trainer.LivenessProbe)
+		}
+	}
+}
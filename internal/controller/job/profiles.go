@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// getJobProfile returns the profile of the queue the job selects, or nil for jobs without a
+// profile. It fails for a profile the queue does not define.
+func getJobProfile(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*torchrunv1alpha1.JobProfile, error) {
+	if job.Spec.Profile == "" {
+		return nil, nil
+	}
+	for i := range jq.Spec.Profiles {
+		if jq.Spec.Profiles[i].Name == job.Spec.Profile {
+			return &jq.Spec.Profiles[i], nil
+		}
+	}
+	return nil, fmt.Errorf("queue %s has no profile %s", jq.Name, job.Spec.Profile)
+}
+
+// getProfileNames returns the names of the profiles of the queue
+func getProfileNames(jq *torchrunv1alpha1.TorchrunQueue) []string {
+	names := make([]string, 0, len(jq.Spec.Profiles))
+	for _, profile := range jq.Spec.Profiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// applyJobProfile applies a profile to the raw pod spec of the queue pod template: the resources
+// of the profile replace those of the trainer, its node selector replaces the values of the same
+// keys and its tolerations are added
+func applyJobProfile(raw []byte, profile *torchrunv1alpha1.JobProfile) ([]byte, error) {
+	var podSpec corev1.PodSpec
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &podSpec); err != nil {
+			return nil, err
+		}
+	}
+
+	// The trainer is the first container, which validatePodSpec enforces
+	if len(podSpec.Containers) > 0 && (len(profile.Resources.Requests) > 0 || len(profile.Resources.Limits) > 0) {
+		podSpec.Containers[0].Resources = *profile.Resources.DeepCopy()
+	}
+	if len(profile.NodeSelector) > 0 && podSpec.NodeSelector == nil {
+		podSpec.NodeSelector = map[string]string{}
+	}
+	for key, value := range profile.NodeSelector {
+		podSpec.NodeSelector[key] = value
+	}
+	for i := range profile.Tolerations {
+		toleration := &profile.Tolerations[i]
+		if !slices.ContainsFunc(podSpec.Tolerations, func(t corev1.Toleration) bool { return t.MatchToleration(toleration) }) {
+			podSpec.Tolerations = append(podSpec.Tolerations, *toleration)
+		}
+	}
+	return json.Marshal(podSpec)
+}
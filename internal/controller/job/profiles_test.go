@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestGetPodSpecProfile(t *testing.T) {
+	gpuToleration := corev1.Toleration{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}
+	a100Toleration := corev1.Toleration{Key: "pool", Operator: corev1.TolerationOpEqual, Value: "a100", Effect: corev1.TaintEffectNoSchedule}
+	gpus := func(count string) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{gpuResourceName: resource.MustParse(count)},
+			Limits:   corev1.ResourceList{gpuResourceName: resource.MustParse(count)},
+		}
+	}
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{Spec: runtime.RawExtension{Raw: []byte(
+				`{"nodeSelector":{"pool":"h100","zone":"a"},"tolerations":[{"key":"nvidia.com/gpu","operator":"Exists","effect":"NoSchedule"}],` +
+					`"containers":[{"name":"trainer","image":"pytorch:2.2","resources":{"requests":{"nvidia.com/gpu":"8"},"limits":{"nvidia.com/gpu":"8"}}}]}`)}},
+			Profiles: []torchrunv1alpha1.JobProfile{
+				{
+					Name:         "1xa100",
+					Resources:    gpus("1"),
+					NodeSelector: map[string]string{"pool": "a100"},
+					Tolerations:  []corev1.Toleration{a100Toleration, gpuToleration},
+				},
+				{
+					Name:         "8xa100-4proc",
+					Resources:    gpus("8"),
+					NodeSelector: map[string]string{"pool": "a100"},
+					NprocPerNode: 4,
+				},
+				{
+					Name:         "placement-only",
+					NodeSelector: map[string]string{"zone": "b"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		description       string
+		profile           string
+		patch             string
+		expectError       bool
+		expectResources   corev1.ResourceRequirements
+		expectSelector    map[string]string
+		expectTolerations []corev1.Toleration
+		expectNproc       int
+	}{
+		{
+			description:       "job without a profile keeps the pod template",
+			expectResources:   gpus("8"),
+			expectSelector:    map[string]string{"pool": "h100", "zone": "a"},
+			expectTolerations: []corev1.Toleration{gpuToleration},
+			expectNproc:       8,
+		},
+		{
+			description:       "profile replaces the trainer resources and the node selector keys",
+			profile:           "1xa100",
+			expectResources:   gpus("1"),
+			expectSelector:    map[string]string{"pool": "a100", "zone": "a"},
+			expectTolerations: []corev1.Toleration{gpuToleration, a100Toleration},
+			expectNproc:       1,
+		},
+		{
+			description:       "profile processes per worker",
+			profile:           "8xa100-4proc",
+			expectResources:   gpus("8"),
+			expectSelector:    map[string]string{"pool": "a100", "zone": "a"},
+			expectTolerations: []corev1.Toleration{gpuToleration},
+			expectNproc:       4,
+		},
+		{
+			description:       "profile without resources keeps the trainer resources",
+			profile:           "placement-only",
+			expectResources:   gpus("8"),
+			expectSelector:    map[string]string{"pool": "h100", "zone": "b"},
+			expectTolerations: []corev1.Toleration{gpuToleration},
+			expectNproc:       8,
+		},
+		{
+			description:       "job patch overrides the profile",
+			profile:           "1xa100",
+			patch:             `{"nodeSelector":{"pool":"a100-80gb"}}`,
+			expectResources:   gpus("1"),
+			expectSelector:    map[string]string{"pool": "a100-80gb", "zone": "a"},
+			expectTolerations: []corev1.Toleration{gpuToleration, a100Toleration},
+			expectNproc:       1,
+		},
+		{
+			description: "unknown profile fails",
+			profile:     "8xh200",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{Spec: torchrunv1alpha1.TorchrunJobSpec{Profile: test.profile}}
+		if test.patch != "" {
+			job.Spec.PodTemplatePatch = &torchrunv1alpha1.PodTemplatePatch{StrategicMerge: &runtime.RawExtension{Raw: []byte(test.patch)}}
+		}
+
+		podSpec, err := getPodSpec(job, jq)
+		if (err != nil) != test.expectError {
+			t.Fatalf("%s: getPodSpec() error = %v, expected error %v", test.description, err, test.expectError)
+		}
+		if err != nil {
+			continue
+		}
+		if resources := podSpec.Containers[0].Resources; !reflect.DeepEqual(resources, test.expectResources) {
+			t.Errorf("%s: expected resources %v, got %v", test.description, test.expectResources, resources)
+		}
+		if !reflect.DeepEqual(podSpec.NodeSelector, test.expectSelector) {
+			t.Errorf("%s: expected node selector %v, got %v", test.description, test.expectSelector, podSpec.NodeSelector)
+		}
+		if !reflect.DeepEqual(podSpec.Tolerations, test.expectTolerations) {
+			t.Errorf("%s: expected tolerations %v, got %v", test.description, test.expectTolerations, podSpec.Tolerations)
+		}
+		if nproc := getNprocPerNode(job, jq, &podSpec); nproc != test.expectNproc {
+			t.Errorf("%s: expected %d processes per worker, got %d", test.description, test.expectNproc, nproc)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/patch"
+)
+
+const (
+	// podIPIndexKey indexes pods by their IPs, so a progress report is matched to its worker
+	podIPIndexKey = "status.podIPs"
+
+	// maxProgressBodyBytes limits the size of a progress report
+	maxProgressBodyBytes = 64 << 10
+
+	// maxProgressMetrics limits the metrics of a progress report, which are kept in the job status
+	maxProgressMetrics = 32
+
+	// progressFlushInterval is how often the latest reports are written to the status of their
+	// jobs, so reporting every step costs at most one status write per job and interval
+	progressFlushInterval = 10 * time.Second
+)
+
+// ProgressServer serves the progress endpoint at /progress, where the training scripts report
+// their step, epoch and loss, and writes the latest report of each job to its status
+type ProgressServer struct {
+	// Addr is the address the server listens on
+	Addr string
+
+	// Handler receives the reports
+	Handler *ProgressHandler
+}
+
+// SetupWithManager indexes the pods by IP in the cache of the manager and adds the server to it
+func (s *ProgressServer) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.Pod{}, podIPIndexKey, indexPodIPs); err != nil {
+		return err
+	}
+	return mgr.Add(s)
+}
+
+// Start serves the progress endpoint and flushes the reports until the context is cancelled
+func (s *ProgressServer) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("/progress", s.Handler)
+	server := &http.Server{Addr: s.Addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		ticker := time.NewTicker(progressFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				_ = server.Shutdown(shutdownCtx)
+				// Reports received until the shutdown are not lost with the replica
+				s.Handler.Flush(shutdownCtx)
+				return
+			case <-ticker.C:
+				s.Handler.Flush(ctx)
+			}
+		}
+	}()
+
+	log.FromContext(ctx).WithName("progress").Info("Serving the progress endpoint", "addr", s.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection serves the progress endpoint on every replica, as the Service of the
+// controller sends the reports to any of them
+func (s *ProgressServer) NeedLeaderElection() bool {
+	return false
+}
+
+// progressReport is the JSON body of a progress report. Every field is optional.
+type progressReport struct {
+	Step    *int64             `json:"step"`
+	Epoch   *int64             `json:"epoch"`
+	Loss    *float64           `json:"loss"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// ProgressHandler receives the progress reports of the workers. A report is accepted from a
+// running worker pod of a TorchrunJob only, which is found by the source IP of the request, so
+// the training scripts need no credentials. Each report replaces the previous one of its job.
+type ProgressHandler struct {
+	// Client reads the pods by IP, their Jobs and TorchrunJobs from the cache and patches the
+	// status of the TorchrunJobs
+	Client client.Client
+
+	mu      sync.Mutex
+	pending map[types.NamespacedName]*torchrunv1alpha1.TrainingProgressStatus
+}
+
+// ServeHTTP records the report of the request until the next flush
+func (h *ProgressHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var report progressReport
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxProgressBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&report); err != nil {
+		http.Error(w, fmt.Sprintf("invalid progress report: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(report.Metrics) > maxProgressMetrics {
+		http.Error(w, fmt.Sprintf("invalid progress report: at most %d metrics are allowed", maxProgressMetrics), http.StatusBadRequest)
+		return
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pod, key, err := h.findWorker(r.Context(), ip)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pod == nil {
+		http.Error(w, fmt.Sprintf("%s is not a running worker pod of a TorchrunJob", ip), http.StatusForbidden)
+		return
+	}
+
+	progress := &torchrunv1alpha1.TrainingProgressStatus{
+		Step:       report.Step,
+		Epoch:      report.Epoch,
+		Pod:        pod.Name,
+		ReportTime: &metav1.Time{Time: time.Now()},
+	}
+	if report.Loss != nil {
+		progress.Loss = formatProgressValue(*report.Loss)
+	}
+	if len(report.Metrics) > 0 {
+		progress.Metrics = make(map[string]string, len(report.Metrics))
+		for name, value := range report.Metrics {
+			progress.Metrics[name] = formatProgressValue(value)
+		}
+	}
+
+	h.mu.Lock()
+	if h.pending == nil {
+		h.pending = map[types.NamespacedName]*torchrunv1alpha1.TrainingProgressStatus{}
+	}
+	h.pending[key] = progress
+	h.mu.Unlock()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// findWorker returns the running worker pod with the IP and its TorchrunJob, or nil if the IP is
+// not the one of a single worker pod
+func (h *ProgressHandler) findWorker(ctx context.Context, ip string) (*corev1.Pod, types.NamespacedName, error) {
+	pods := &corev1.PodList{}
+	if err := h.Client.List(ctx, pods, client.MatchingFields{podIPIndexKey: ip}); err != nil {
+		return nil, types.NamespacedName{}, err
+	}
+	var worker *corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		// A finished pod may still hold the IP that was assigned to a new pod
+		if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		if worker != nil {
+			return nil, types.NamespacedName{}, nil
+		}
+		worker = pod
+	}
+	if worker == nil || worker.Labels["app"] != "torchrun" {
+		return nil, types.NamespacedName{}, nil
+	}
+	key, ok := getWorkerPodJob(ctx, h.Client, worker)
+	if !ok {
+		return nil, types.NamespacedName{}, nil
+	}
+	return worker, key, nil
+}
+
+// Flush writes the latest report of each job received since the last flush to its status. A
+// report older than the one in the status, which another replica received, is dropped.
+func (h *ProgressHandler) Flush(ctx context.Context) {
+	h.mu.Lock()
+	pending := h.pending
+	h.pending = nil
+	h.mu.Unlock()
+
+	logger := log.FromContext(ctx).WithName("progress")
+	for key, progress := range pending {
+		job := &torchrunv1alpha1.TorchrunJob{}
+		if err := h.Client.Get(ctx, key, job); err != nil {
+			if !apierrors.IsNotFound(err) {
+				logger.Error(err, "Failed to get the job of a progress report", "job", key)
+			}
+			continue
+		}
+		if current := job.Status.TrainingProgress; current != nil && current.ReportTime != nil && progress.ReportTime.Before(current.ReportTime) {
+			continue
+		}
+		original := job.DeepCopy()
+		job.Status.TrainingProgress = progress
+		if err := patch.Status(ctx, h.Client, job, original); err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, "Failed to record training progress", "job", key)
+		}
+	}
+}
+
+// indexPodIPs indexes a pod by its IPs. Pods on the host network share the IP of their node, so
+// they are not indexed.
+func indexPodIPs(obj client.Object) []string {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || pod.Spec.HostNetwork {
+		return nil
+	}
+	ips := make([]string, 0, len(pod.Status.PodIPs))
+	for _, podIP := range pod.Status.PodIPs {
+		ips = append(ips, podIP.IP)
+	}
+	if len(ips) == 0 && pod.Status.PodIP != "" {
+		ips = append(ips, pod.Status.PodIP)
+	}
+	return ips
+}
+
+// formatProgressValue formats a reported value with 6 significant digits
+func formatProgressValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', 6, 64)
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestProgressHandler(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	isController := true
+
+	tests := []struct {
+		description  string
+		method       string
+		remoteAddr   string
+		body         string
+		reported     *metav1.Time
+		expectCode   int
+		expectStep   int64
+		expectLoss   string
+		expectMetric string
+	}{
+		{
+			description:  "report of a worker is recorded",
+			remoteAddr:   "10.0.0.1:40000",
+			body:         `{"step": 4200, "epoch": 3, "loss": 1.87312345, "metrics": {"lr": 0.0003}}`,
+			expectCode:   http.StatusAccepted,
+			expectStep:   4200,
+			expectLoss:   "1.87312",
+			expectMetric: "0.0003",
+		},
+		{
+			description: "report of an unknown IP is rejected",
+			remoteAddr:  "10.0.0.9:40000",
+			body:        `{"step": 1}`,
+			expectCode:  http.StatusForbidden,
+		},
+		{
+			description: "report of a finished pod is rejected",
+			remoteAddr:  "10.0.0.2:40000",
+			body:        `{"step": 1}`,
+			expectCode:  http.StatusForbidden,
+		},
+		{
+			description: "unknown field is rejected",
+			remoteAddr:  "10.0.0.1:40000",
+			body:        `{"steps": 1}`,
+			expectCode:  http.StatusBadRequest,
+		},
+		{
+			description: "get is not allowed",
+			method:      http.MethodGet,
+			remoteAddr:  "10.0.0.1:40000",
+			expectCode:  http.StatusMethodNotAllowed,
+		},
+		{
+			description: "report older than the status is dropped",
+			remoteAddr:  "10.0.0.1:40000",
+			body:        `{"step": 4200}`,
+			reported:    &metav1.Time{Time: time.Now().Add(time.Hour)},
+			expectCode:  http.StatusAccepted,
+			expectStep:  100,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default", UID: "uid"},
+		}
+		if test.reported != nil {
+			step := int64(100)
+			job.Status.TrainingProgress = &torchrunv1alpha1.TrainingProgressStatus{Step: &step, ReportTime: test.reported}
+		}
+		k8sJob := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name:      "train",
+			Namespace: "default",
+			UID:       "job-uid",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: torchrunv1alpha1.GroupVersion.String(), Kind: "TorchrunJob", Name: "train", UID: "uid", Controller: &isController,
+			}},
+		}}
+		worker := func(name, ip string, phase corev1.PodPhase) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: "default",
+					Labels:    map[string]string{"app": "torchrun"},
+					OwnerReferences: []metav1.OwnerReference{{
+						APIVersion: batchv1.SchemeGroupVersion.String(), Kind: "Job", Name: "train", UID: "job-uid", Controller: &isController,
+					}},
+				},
+				Status: corev1.PodStatus{Phase: phase, PodIP: ip},
+			}
+		}
+		objects := []client.Object{job, k8sJob, worker("train-0", "10.0.0.1", corev1.PodRunning), worker("train-old", "10.0.0.2", corev1.PodSucceeded)}
+		c := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(objects...).
+			WithStatusSubresource(job).
+			WithIndex(&corev1.Pod{}, podIPIndexKey, indexPodIPs).
+			Build()
+		handler := &ProgressHandler{Client: c}
+
+		method := test.method
+		if method == "" {
+			method = http.MethodPost
+		}
+		request := httptest.NewRequest(method, "/progress", strings.NewReader(test.body))
+		request.RemoteAddr = test.remoteAddr
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != test.expectCode {
+			t.Errorf("%s: expected status %d, got %d: %s", test.description, test.expectCode, recorder.Code, recorder.Body.String())
+		}
+
+		handler.Flush(context.Background())
+		if err := c.Get(context.Background(), types.NamespacedName{Name: "train", Namespace: "default"}, job); err != nil {
+			t.Fatalf("%s: failed to get job: %v", test.description, err)
+		}
+		progress := job.Status.TrainingProgress
+		if test.expectStep == 0 {
+			if progress != nil {
+				t.Errorf("%s: expected no progress, got %+v", test.description, progress)
+			}
+			continue
+		}
+		if progress == nil || progress.Step == nil || *progress.Step != test.expectStep {
+			t.Errorf("%s: expected step %d, got %+v", test.description, test.expectStep, progress)
+			continue
+		}
+		if progress.Loss != test.expectLoss {
+			t.Errorf("%s: expected loss %q, got %q", test.description, test.expectLoss, progress.Loss)
+		}
+		if progress.Metrics["lr"] != test.expectMetric {
+			t.Errorf("%s: expected lr %q, got %q", test.description, test.expectMetric, progress.Metrics["lr"])
+		}
+		if test.expectLoss != "" && progress.Pod != "train-0" {
+			t.Errorf("%s: expected the report of train-0, got %q", test.description, progress.Pod)
+		}
+	}
+}
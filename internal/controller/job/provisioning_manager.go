@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// provisioningRequestGVK is the ProvisioningRequest kind of the cluster autoscaler, which is not
+// part of the core API
+var provisioningRequestGVK = schema.GroupVersionKind{Group: "autoscaling.x-k8s.io", Version: "v1beta1", Kind: "ProvisioningRequest"}
+
+// defaultProvisioningClassName provisions the nodes of all pods of a request or none of them
+const defaultProvisioningClassName = "best-effort-atomic-scale-up.autoscaling.x-k8s.io"
+
+// ProvisioningResult is the state of the ProvisioningRequest of a job
+type ProvisioningResult struct {
+	// Ready is true when the Job may be created
+	Ready bool
+
+	// Status of the Provisioned condition: Unknown while the nodes are provisioned, then True or
+	// False. Empty for suspended jobs waiting without a request.
+	Status string
+
+	// Reason is a machine-readable reason for the state
+	Reason string
+
+	// Message is a human-readable explanation of the state
+	Message string
+}
+
+// ProvisioningManager asks the cluster autoscaler for the nodes of all workers of a job before
+// its Job is created
+type ProvisioningManager struct {
+	client     client.Client
+	jobManager *JobManager
+}
+
+// NewProvisioningManager creates a new provisioning manager. The job manager builds the worker
+// pod template the nodes are provisioned for.
+func NewProvisioningManager(client client.Client, jobManager *JobManager) *ProvisioningManager {
+	return &ProvisioningManager{
+		client:     client,
+		jobManager: jobManager,
+	}
+}
+
+// EnsureProvisioning creates the ProvisioningRequest of a multi-node job and its PodTemplate and
+// reports the state of the request. It returns nil for jobs of queues without provisioning
+// requests, single-node jobs and jobs whose nodes were provisioned or whose Job exists. A failed
+// request is deleted, so the next reconcile requests the nodes again.
+func (pm *ProvisioningManager) EnsureProvisioning(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*ProvisioningResult, error) {
+	config := jq.Spec.Provisioning
+	if config == nil || !config.ProvisioningRequest || job.Spec.NumNodes <= 1 || isConditionTrue(job, "JobCreated") || isConditionTrue(job, "Provisioned") {
+		return nil, nil
+	}
+	name := GetProvisioningRequestName(job)
+
+	request := &unstructured.Unstructured{}
+	request.SetGroupVersionKind(provisioningRequestGVK)
+	err := pm.client.Get(ctx, types.NamespacedName{Name: name, Namespace: job.Namespace}, request)
+	if meta.IsNoMatchError(err) {
+		return &ProvisioningResult{
+			Ready:   true,
+			Status:  "False",
+			Reason:  "ProvisioningUnavailable",
+			Message: "The cluster does not serve ProvisioningRequests of autoscaling.x-k8s.io/v1beta1, workers scale up as they become pending",
+		}, nil
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if errors.IsNotFound(err) {
+		if job.Spec.Suspend {
+			// Suspended jobs wait without a request, the nodes are provisioned once they are resumed
+			return &ProvisioningResult{}, nil
+		}
+		if err := pm.createProvisioningRequest(ctx, job, jq); err != nil {
+			return nil, err
+		}
+		return &ProvisioningResult{
+			Status:  "Unknown",
+			Reason:  "Provisioning",
+			Message: fmt.Sprintf("Waiting for ProvisioningRequest %s of %d workers", name, job.Spec.NumNodes),
+		}, nil
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(request.Object, "status", "conditions")
+	if condition := getProvisioningCondition(conditions, "Failed"); condition != nil {
+		log.FromContext(ctx).Info("ProvisioningRequest failed, deleting it", "name", name)
+		if err := pm.client.Delete(ctx, request); err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		return &ProvisioningResult{
+			Status:  "False",
+			Reason:  "ProvisioningFailed",
+			Message: fmt.Sprintf("ProvisioningRequest %s failed, requesting the nodes again: %s", name, condition["message"]),
+		}, nil
+	}
+	if condition := getProvisioningCondition(conditions, "Provisioned"); condition != nil {
+		return &ProvisioningResult{
+			Ready:   true,
+			Status:  "True",
+			Reason:  "Provisioned",
+			Message: fmt.Sprintf("Nodes of %d workers provisioned by ProvisioningRequest %s", job.Spec.NumNodes, name),
+		}, nil
+	}
+	return &ProvisioningResult{
+		Status:  "Unknown",
+		Reason:  "Provisioning",
+		Message: fmt.Sprintf("Waiting for ProvisioningRequest %s of %d workers", name, job.Spec.NumNodes),
+	}, nil
+}
+
+// createProvisioningRequest creates the PodTemplate of the workers and the ProvisioningRequest
+// for all of them, both owned by the job
+func (pm *ProvisioningManager) createProvisioningRequest(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) error {
+	k8sJob, err := pm.jobManager.BuildJob(ctx, job, jq)
+	if err != nil {
+		return err
+	}
+	name := GetProvisioningRequestName(job)
+	ownerReferences := []metav1.OwnerReference{*metav1.NewControllerRef(job, job.GroupVersionKind())}
+	labels := map[string]string{
+		"torchrun.ai/job-id":    job.Spec.JobID,
+		"torchrun.ai/job-name":  job.Spec.JobName,
+		"torchrun.ai/job-queue": job.Spec.Queue,
+	}
+
+	podTemplate := &corev1.PodTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       job.Namespace,
+			Labels:          labels,
+			OwnerReferences: ownerReferences,
+		},
+		Template: k8sJob.Spec.Template,
+	}
+	if err := pm.client.Create(ctx, podTemplate); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	className := jq.Spec.Provisioning.ClassName
+	if className == "" {
+		className = defaultProvisioningClassName
+	}
+	spec := map[string]interface{}{
+		"provisioningClassName": className,
+		"podSets": []interface{}{
+			map[string]interface{}{
+				"podTemplateRef": map[string]interface{}{"name": name},
+				"count":          int64(job.Spec.NumNodes),
+			},
+		},
+	}
+	if len(jq.Spec.Provisioning.Parameters) > 0 {
+		parameters := make(map[string]interface{}, len(jq.Spec.Provisioning.Parameters))
+		for key, value := range jq.Spec.Provisioning.Parameters {
+			parameters[key] = value
+		}
+		spec["parameters"] = parameters
+	}
+	request := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	request.SetGroupVersionKind(provisioningRequestGVK)
+	request.SetName(name)
+	request.SetNamespace(job.Namespace)
+	request.SetLabels(labels)
+	request.SetOwnerReferences(ownerReferences)
+
+	log.FromContext(ctx).Info("Creating ProvisioningRequest", "name", name, "workers", job.Spec.NumNodes, "class", className)
+	if err := pm.client.Create(ctx, request); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// getProvisioningCondition returns the condition of the given type of a ProvisioningRequest if
+// it is True
+func getProvisioningCondition(conditions []interface{}, conditionType string) map[string]interface{} {
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == conditionType && condition["status"] == string(metav1.ConditionTrue) {
+			return condition
+		}
+	}
+	return nil
+}
+
+// attachProvisioningAnnotations annotates the worker pods of queues with provisioning, so the
+// cluster autoscaler and Karpenter keep their nodes while they run. The workers of the first
+// attempt of a job whose nodes were provisioned consume its ProvisioningRequest; later attempts
+// scale up like other pods, as the request was used up.
+func attachProvisioningAnnotations(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, annotations map[string]string) {
+	config := jq.Spec.Provisioning
+	if config == nil {
+		return
+	}
+	annotations["cluster-autoscaler.kubernetes.io/safe-to-evict"] = "false"
+	annotations["karpenter.sh/do-not-disrupt"] = "true"
+	if !isConditionTrue(job, "Provisioned") || job.Status.Attempt > 1 {
+		return
+	}
+	className := config.ClassName
+	if className == "" {
+		className = defaultProvisioningClassName
+	}
+	annotations["autoscaling.x-k8s.io/consume-provisioning-request"] = GetProvisioningRequestName(job)
+	annotations["autoscaling.x-k8s.io/provisioning-class-name"] = className
+	// Cluster autoscalers before 1.30 read the annotations of their own group
+	annotations["cluster-autoscaler.kubernetes.io/consume-provisioning-request"] = GetProvisioningRequestName(job)
+	annotations["cluster-autoscaler.kubernetes.io/provisioning-class-name"] = className
+}
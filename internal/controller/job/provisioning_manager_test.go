@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestEnsureProvisioning(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	// The ProvisioningRequest of the job with the given conditions
+	request := func(conditions ...interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{"status": map[string]interface{}{"conditions": conditions}}}
+		obj.SetGroupVersionKind(provisioningRequestGVK)
+		obj.SetName("train-provisioning")
+		obj.SetNamespace("default")
+		return obj
+	}
+	condition := func(conditionType, status string) map[string]interface{} {
+		return map[string]interface{}{"type": conditionType, "status": status, "message": "out of quota"}
+	}
+
+	tests := []struct {
+		description   string
+		provisioning  *torchrunv1alpha1.ProvisioningConfig
+		numNodes      int
+		suspend       bool
+		conditions    []torchrunv1alpha1.TorchrunJobCondition
+		existing      []client.Object
+		expectResult  bool
+		expectReady   bool
+		expectStatus  string
+		expectReason  string
+		expectCreated bool
+		expectDeleted bool
+	}{
+		{
+			description: "queue without provisioning",
+			numNodes:    4,
+		},
+		{
+			description:  "queue with provisioning hints only",
+			provisioning: &torchrunv1alpha1.ProvisioningConfig{},
+			numNodes:     4,
+		},
+		{
+			description:  "single-node job is not provisioned",
+			provisioning: &torchrunv1alpha1.ProvisioningConfig{ProvisioningRequest: true},
+			numNodes:     1,
+		},
+		{
+			description:  "job whose Job was created is not provisioned",
+			provisioning: &torchrunv1alpha1.ProvisioningConfig{ProvisioningRequest: true},
+			numNodes:     4,
+			conditions:   []torchrunv1alpha1.TorchrunJobCondition{{Type: "JobCreated", Status: "True"}},
+		},
+		{
+			description:  "suspended job waits without a request",
+			provisioning: &torchrunv1alpha1.ProvisioningConfig{ProvisioningRequest: true},
+			numNodes:     4,
+			suspend:      true,
+			expectResult: true,
+		},
+		{
+			description:   "multi-node job requests its nodes",
+			provisioning:  &torchrunv1alpha1.ProvisioningConfig{ProvisioningRequest: true, Parameters: map[string]string{"ValidUntilSeconds": "600"}},
+			numNodes:      4,
+			expectResult:  true,
+			expectStatus:  "Unknown",
+			expectReason:  "Provisioning",
+			expectCreated: true,
+		},
+		{
+			description:  "request waiting for nodes",
+			provisioning: &torchrunv1alpha1.ProvisioningConfig{ProvisioningRequest: true},
+			numNodes:     4,
+			existing:     []client.Object{request(condition("Accepted", "True"), condition("Provisioned", "False"))},
+			expectResult: true,
+			expectStatus: "Unknown",
+			expectReason: "Provisioning",
+		},
+		{
+			description:  "provisioned request lets the Job be created",
+			provisioning: &torchrunv1alpha1.ProvisioningConfig{ProvisioningRequest: true},
+			numNodes:     4,
+			existing:     []client.Object{request(condition("Accepted", "True"), condition("Provisioned", "True"))},
+			expectResult: true,
+			expectReady:  true,
+			expectStatus: "True",
+			expectReason: "Provisioned",
+		},
+		{
+			description:   "failed request is deleted",
+			provisioning:  &torchrunv1alpha1.ProvisioningConfig{ProvisioningRequest: true},
+			numNodes:      4,
+			existing:      []client.Object{request(condition("Failed", "True"))},
+			expectResult:  true,
+			expectStatus:  "False",
+			expectReason:  "ProvisioningFailed",
+			expectDeleted: true,
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"},
+			Spec: torchrunv1alpha1.JobQueueSpec{
+				Queue: torchrunv1alpha1.QueueConfig{Name: "research"},
+				PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+					Spec: runtime.RawExtension{Raw: []byte(`{"containers":[{"name":"trainer","image":"pytorch:2.3","resources":{"requests":{"nvidia.com/gpu":"8"}}}]}`)},
+				},
+				Provisioning: test.provisioning,
+			},
+		}
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default", UID: "train-uid"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:    "research",
+				JobName:  "train",
+				JobID:    "train-id",
+				Command:  "python train.py",
+				NumNodes: test.numNodes,
+				Suspend:  test.suspend,
+			},
+			Status: torchrunv1alpha1.TorchrunJobStatus{Conditions: test.conditions},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(test.existing...).Build()
+		pm := NewProvisioningManager(c, NewJobManager(c, true, config.Default()))
+
+		result, err := pm.EnsureProvisioning(context.Background(), job, jq)
+		if err != nil {
+			t.Fatalf("%s: EnsureProvisioning() error = %v", test.description, err)
+		}
+		if (result != nil) != test.expectResult {
+			t.Errorf("%s: expected result %v, got %v", test.description, test.expectResult, result)
+			continue
+		}
+		if result != nil && (result.Ready != test.expectReady || result.Status != test.expectStatus || result.Reason != test.expectReason) {
+			t.Errorf("%s: expected ready=%v %s %s, got ready=%v %s %s", test.description,
+				test.expectReady, test.expectStatus, test.expectReason, result.Ready, result.Status, result.Reason)
+		}
+
+		created := &unstructured.Unstructured{}
+		created.SetGroupVersionKind(provisioningRequestGVK)
+		err = c.Get(context.Background(), types.NamespacedName{Name: "train-provisioning", Namespace: "default"}, created)
+		if test.expectDeleted && !errors.IsNotFound(err) {
+			t.Errorf("%s: expected the failed request to be deleted, got %v", test.description, err)
+		}
+		if len(test.existing) == 0 && !test.expectCreated && !errors.IsNotFound(err) {
+			t.Errorf("%s: expected no request, got %v", test.description, err)
+		}
+		if !test.expectCreated {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: expected the request to be created: %v", test.description, err)
+		}
+		if class, _, _ := unstructured.NestedString(created.Object, "spec", "provisioningClassName"); class != defaultProvisioningClassName {
+			t.Errorf("%s: expected the default provisioning class, got %q", test.description, class)
+		}
+		podSets, _, _ := unstructured.NestedSlice(created.Object, "spec", "podSets")
+		if len(podSets) != 1 || podSets[0].(map[string]interface{})["count"] != int64(4) {
+			t.Errorf("%s: expected one pod set of 4 workers, got %v", test.description, podSets)
+		}
+		if validUntil, _, _ := unstructured.NestedString(created.Object, "spec", "parameters", "ValidUntilSeconds"); validUntil != "600" {
+			t.Errorf("%s: expected the parameters of the queue, got %v", test.description, created.Object["spec"])
+		}
+		podTemplate := &corev1.PodTemplate{}
+		if err := c.Get(context.Background(), types.NamespacedName{Name: "train-provisioning", Namespace: "default"}, podTemplate); err != nil {
+			t.Fatalf("%s: expected the worker pod template to be created: %v", test.description, err)
+		}
+		if len(podTemplate.Template.Spec.Containers) == 0 || podTemplate.Template.Spec.Containers[0].Resources.Requests.Name("nvidia.com/gpu", "").Value() != 8 {
+			t.Errorf("%s: expected the pod template of the workers, got %+v", test.description, podTemplate.Template.Spec.Containers)
+		}
+	}
+}
+
+func TestAttachProvisioningAnnotations(t *testing.T) {
+	provisioned := []torchrunv1alpha1.TorchrunJobCondition{{Type: "Provisioned", Status: "True"}}
+
+	tests := []struct {
+		description  string
+		provisioning *torchrunv1alpha1.ProvisioningConfig
+		conditions   []torchrunv1alpha1.TorchrunJobCondition
+		attempt      int32
+		expected     map[string]string
+	}{
+		{
+			description: "queue without provisioning",
+			conditions:  provisioned,
+			expected:    map[string]string{},
+		},
+		{
+			description:  "workers keep their nodes",
+			provisioning: &torchrunv1alpha1.ProvisioningConfig{ProvisioningRequest: true},
+			expected: map[string]string{
+				"cluster-autoscaler.kubernetes.io/safe-to-evict": "false",
+				"karpenter.sh/do-not-disrupt":                    "true",
+			},
+		},
+		{
+			description:  "workers consume the provisioned nodes",
+			provisioning: &torchrunv1alpha1.ProvisioningConfig{ProvisioningRequest: true, ClassName: "queued-provisioning.gke.io"},
+			conditions:   provisioned,
+			attempt:      1,
+			expected: map[string]string{
+				"cluster-autoscaler.kubernetes.io/safe-to-evict":                "false",
+				"karpenter.sh/do-not-disrupt":                                   "true",
+				"autoscaling.x-k8s.io/consume-provisioning-request":             "train-provisioning",
+				"autoscaling.x-k8s.io/provisioning-class-name":                  "queued-provisioning.gke.io",
+				"cluster-autoscaler.kubernetes.io/consume-provisioning-request": "train-provisioning",
+				"cluster-autoscaler.kubernetes.io/provisioning-class-name":      "queued-provisioning.gke.io",
+			},
+		},
+		{
+			description:  "later attempts scale up like other pods",
+			provisioning: &torchrunv1alpha1.ProvisioningConfig{ProvisioningRequest: true},
+			conditions:   provisioned,
+			attempt:      2,
+			expected: map[string]string{
+				"cluster-autoscaler.kubernetes.io/safe-to-evict": "false",
+				"karpenter.sh/do-not-disrupt":                    "true",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{Conditions: test.conditions, Attempt: test.attempt},
+		}
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{Provisioning: test.provisioning}}
+
+		annotations := map[string]string{}
+		attachProvisioningAnnotations(job, jq, annotations)
+		if len(annotations) != len(test.expected) {
+			t.Errorf("%s: expected annotations %v, got %v", test.description, test.expected, annotations)
+			continue
+		}
+		for k, v := range test.expected {
+			if annotations[k] != v {
+				t.Errorf("%s: expected annotation %s=%s, got %q", test.description, k, v, annotations[k])
+			}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// priorityRanks orders the waiting jobs of a queue, higher ranks first
+var priorityRanks = map[string]int{
+	torchrunv1alpha1.PriorityPreemptible: 0,
+	torchrunv1alpha1.PriorityNormal:      1,
+	torchrunv1alpha1.PriorityHigh:        2,
+}
+
+// QueuePositionManager places Queued jobs in the line of their queue and estimates when they start
+type QueuePositionManager struct {
+	client client.Client
+}
+
+// NewQueuePositionManager creates a new queue position manager
+func NewQueuePositionManager(client client.Client) *QueuePositionManager {
+	return &QueuePositionManager{
+		client: client,
+	}
+}
+
+// UpdateQueuePosition sets the queue position and estimated start time of a Queued job, clears
+// them for jobs in any other phase and reports whether either changed. Jobs are placed among the
+// Queued jobs of the same queue and child queue by aged priority, then creation time. The start is
+// estimated from the GPU quota of the queue: the GPUs of this job and the jobs ahead of it must
+// fit next to the running jobs, which release theirs at their active deadline.
+func (qm *QueuePositionManager) UpdateQueuePosition(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, now time.Time) (bool, error) {
+	position, estimate := job.Status.QueuePosition, job.Status.EstimatedStartTime
+	if job.Status.Phase != torchrunv1alpha1.PhaseQueued {
+		job.Status.QueuePosition = 0
+		job.Status.EstimatedStartTime = nil
+		return position != 0 || estimate != nil, nil
+	}
+
+	jobs := &torchrunv1alpha1.TorchrunJobList{}
+	if err := qm.client.List(ctx, jobs); err != nil {
+		return false, fmt.Errorf("failed to list jobs of queue %s: %w", jq.Name, err)
+	}
+	// The listed copy of the job may lag behind its phase
+	queued := []*torchrunv1alpha1.TorchrunJob{job}
+	var running []*torchrunv1alpha1.TorchrunJob
+	for i := range jobs.Items {
+		other := &jobs.Items[i]
+		if other.UID == job.UID || other.Spec.Queue != job.Spec.Queue || getQueueNamespace(other) != getQueueNamespace(job) || other.Spec.ChildQueue != job.Spec.ChildQueue {
+			continue
+		}
+		switch other.Status.Phase {
+		case torchrunv1alpha1.PhaseQueued:
+			queued = append(queued, other)
+		case torchrunv1alpha1.PhaseRunning:
+			running = append(running, other)
+		}
+	}
+	sortQueuedJobs(queued, jq, now)
+
+	needed := 0
+	for i, other := range queued {
+		gpus, err := getJobGPUs(other, jq)
+		if err != nil {
+			return false, err
+		}
+		needed += gpus
+		if other.UID == job.UID {
+			job.Status.QueuePosition = int32(i + 1)
+			break
+		}
+	}
+
+	start, err := estimateStartTime(needed, running, jq, getQueueGPUQuota(job, jq), now)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case start == nil:
+		job.Status.EstimatedStartTime = nil
+	case start.Equal(now) && estimate != nil && !estimate.After(now):
+		// A job that fits the quota keeps its estimate, so it is not patched on every reconcile
+	case estimate == nil || !estimate.Time.Equal(start.Truncate(time.Second)):
+		job.Status.EstimatedStartTime = &metav1.Time{Time: start.Truncate(time.Second)}
+	}
+	return job.Status.QueuePosition != position || !job.Status.EstimatedStartTime.Equal(estimate), nil
+}
+
+// sortQueuedJobs orders jobs by priority, aged by the dispatch config of the queue, then creation
+// time, then namespace and name
+func sortQueuedJobs(jobs []*torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, now time.Time) {
+	sort.SliceStable(jobs, func(i, j int) bool {
+		a, b := jobs[i], jobs[j]
+		if rankA, rankB := getPriorityRank(a, jq, now), getPriorityRank(b, jq, now); rankA != rankB {
+			return rankA > rankB
+		}
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+}
+
+// getPriorityRank returns the rank of the priority of a job, raised by one for every aging
+// interval of the queue the job waited since it was created
+func getPriorityRank(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, now time.Time) int {
+	rank := priorityRanks[getJobPriority(job, jq)]
+	if jq.Spec.Dispatch != nil && jq.Spec.Dispatch.AgingSeconds > 0 && !job.CreationTimestamp.IsZero() {
+		rank += int(now.Sub(job.CreationTimestamp.Time) / (time.Duration(jq.Spec.Dispatch.AgingSeconds) * time.Second))
+	}
+	return rank
+}
+
+// estimateStartTime returns when the needed GPUs fit into the quota, releasing the GPUs of the
+// running jobs in the order of their expected ends. It returns nil if the queue has no GPU quota,
+// the needed GPUs exceed it, or a running job without a deadline or estimated duration holds them.
+func estimateStartTime(needed int, running []*torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, quota int, now time.Time) (*time.Time, error) {
+	if quota <= 0 || needed > quota {
+		return nil, nil
+	}
+
+	used := 0
+	gpus := make(map[*torchrunv1alpha1.TorchrunJob]int, len(running))
+	ends := make(map[*torchrunv1alpha1.TorchrunJob]*time.Time, len(running))
+	for _, other := range running {
+		count, err := getJobGPUs(other, jq)
+		if err != nil {
+			return nil, err
+		}
+		gpus[other] = count
+		ends[other] = getExpectedEndTime(other, now)
+		used += count
+	}
+	if quota-used >= needed {
+		return &now, nil
+	}
+
+	// Jobs without an expected end may run forever, so they are released last
+	sort.SliceStable(running, func(i, j int) bool {
+		a, b := ends[running[i]], ends[running[j]]
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.Before(*b)
+	})
+	for _, other := range running {
+		if ends[other] == nil {
+			return nil, nil
+		}
+		used -= gpus[other]
+		if quota-used >= needed {
+			start := *ends[other]
+			if start.Before(now) {
+				start = now
+			}
+			return &start, nil
+		}
+	}
+	return nil, nil
+}
+
+// getExpectedEndTime returns when a job is expected to release its GPUs: at its active deadline,
+// otherwise its estimated duration after it started, or from now for jobs yet to start. It
+// returns nil for jobs with neither.
+func getExpectedEndTime(job *torchrunv1alpha1.TorchrunJob, now time.Time) *time.Time {
+	if job.Status.DeadlineTime != nil {
+		end := job.Status.DeadlineTime.Time
+		return &end
+	}
+	if job.Spec.EstimatedDuration == nil {
+		return nil
+	}
+	start := now
+	if job.Status.StartTime != nil {
+		start = job.Status.StartTime.Time
+	}
+	end := start.Add(job.Spec.EstimatedDuration.Duration)
+	return &end
+}
+
+// getKaiQueueResources returns the quotas and limits of the kai-scheduler queue of the job: its
+// child queue if set, otherwise the queue itself
+func getKaiQueueResources(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) torchrunv1alpha1.QueueResources {
+	if job.Spec.ChildQueue != "" {
+		for _, child := range jq.Spec.Queue.Children {
+			if child.Name == job.Spec.ChildQueue {
+				return child.Resources
+			}
+		}
+	}
+	return jq.Spec.Queue.Resources
+}
+
+// getQueueGPUQuota returns the GPU quota of the kai-scheduler queue of the job. Unlimited quotas
+// are negative.
+func getQueueGPUQuota(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) int {
+	return getKaiQueueResources(job, jq).GPU.Quota
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestUpdateQueuePosition(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue: torchrunv1alpha1.QueueConfig{
+				Name:      "research",
+				Resources: torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: 32}},
+			},
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+				Spec: runtime.RawExtension{Raw: []byte(`{"containers":[{"name":"trainer","resources":{"requests":{"nvidia.com/gpu":"8"}}}]}`)},
+			},
+			Priorities: torchrunv1alpha1.QueuePriorityConfig{Default: torchrunv1alpha1.PriorityNormal},
+		},
+	}
+	// A job of the queue with 8 GPUs per node
+	trainingJob := func(name, phase string, nodes int, created time.Time) *torchrunv1alpha1.TorchrunJob {
+		return &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				UID:               types.UID(name + "-uid"),
+				CreationTimestamp: metav1.NewTime(created),
+			},
+			Spec:   torchrunv1alpha1.TorchrunJobSpec{Queue: "research", NumNodes: nodes},
+			Status: torchrunv1alpha1.TorchrunJobStatus{Phase: phase},
+		}
+	}
+	withDeadline := func(job *torchrunv1alpha1.TorchrunJob, deadline time.Time) *torchrunv1alpha1.TorchrunJob {
+		job.Status.DeadlineTime = &metav1.Time{Time: deadline}
+		return job
+	}
+	withPriority := func(job *torchrunv1alpha1.TorchrunJob, priority string) *torchrunv1alpha1.TorchrunJob {
+		job.Spec.Priority = priority
+		return job
+	}
+	other := func(job *torchrunv1alpha1.TorchrunJob) *torchrunv1alpha1.TorchrunJob {
+		job.Spec.Queue = "other"
+		return job
+	}
+
+	tests := []struct {
+		description    string
+		phase          string
+		priority       string
+		existing       []client.Object
+		expectPosition int32
+		expectStart    *time.Time
+	}{
+		{
+			description: "running job has no position",
+			phase:       torchrunv1alpha1.PhaseRunning,
+		},
+		{
+			description:    "first queued job fitting the quota starts now",
+			phase:          torchrunv1alpha1.PhaseQueued,
+			existing:       []client.Object{trainingJob("running", torchrunv1alpha1.PhaseRunning, 2, now.Add(-time.Hour))},
+			expectPosition: 1,
+			expectStart:    &now,
+		},
+		{
+			description: "older queued jobs are ahead",
+			phase:       torchrunv1alpha1.PhaseQueued,
+			existing: []client.Object{
+				withDeadline(trainingJob("running", torchrunv1alpha1.PhaseRunning, 2, now.Add(-3*time.Hour)), now.Add(2*time.Hour)),
+				trainingJob("older", torchrunv1alpha1.PhaseQueued, 1, now.Add(-2*time.Hour)),
+				trainingJob("newer", torchrunv1alpha1.PhaseQueued, 1, now),
+				other(trainingJob("elsewhere", torchrunv1alpha1.PhaseQueued, 1, now.Add(-2*time.Hour))),
+			},
+			expectPosition: 2,
+			expectStart:    &[]time.Time{now.Add(2 * time.Hour)}[0],
+		},
+		{
+			description: "higher priority goes first",
+			phase:       torchrunv1alpha1.PhaseQueued,
+			priority:    torchrunv1alpha1.PriorityHigh,
+			existing: []client.Object{
+				trainingJob("older", torchrunv1alpha1.PhaseQueued, 1, now.Add(-2*time.Hour)),
+				withPriority(trainingJob("preemptible", torchrunv1alpha1.PhaseQueued, 1, now.Add(-2*time.Hour)), torchrunv1alpha1.PriorityPreemptible),
+			},
+			expectPosition: 1,
+			expectStart:    &now,
+		},
+		{
+			description: "running job without a deadline holds the quota",
+			phase:       torchrunv1alpha1.PhaseQueued,
+			existing: []client.Object{
+				withDeadline(trainingJob("ending", torchrunv1alpha1.PhaseRunning, 1, now.Add(-3*time.Hour)), now.Add(time.Hour)),
+				trainingJob("endless", torchrunv1alpha1.PhaseRunning, 3, now.Add(-3*time.Hour)),
+			},
+			expectPosition: 1,
+		},
+	}
+
+	for _, test := range tests {
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(test.existing...).Build()
+		qm := NewQueuePositionManager(c)
+		job := trainingJob("train", test.phase, 2, now.Add(-time.Hour))
+		job.Spec.Priority = test.priority
+		job.Status.QueuePosition = 7
+
+		changed, err := qm.UpdateQueuePosition(context.Background(), job, jq, now)
+		if err != nil {
+			t.Fatalf("%s: UpdateQueuePosition() error = %v", test.description, err)
+		}
+		if !changed || job.Status.QueuePosition != test.expectPosition {
+			t.Errorf("%s: expected position %d, got %d (changed %v)", test.description, test.expectPosition, job.Status.QueuePosition, changed)
+		}
+		start := job.Status.EstimatedStartTime
+		if (start == nil) != (test.expectStart == nil) || (start != nil && !start.Time.Equal(*test.expectStart)) {
+			t.Errorf("%s: expected estimated start %v, got %v", test.description, test.expectStart, start)
+		}
+	}
+}
+
+func TestEstimateStartTimeQuota(t *testing.T) {
+	now := time.Now()
+	jq := &torchrunv1alpha1.TorchrunQueue{}
+
+	// Unlimited and exceeded quotas have no estimate
+	for _, quota := range []int{-1, 0, 8} {
+		if start, err := estimateStartTime(16, nil, jq, quota, now); err != nil || start != nil {
+			t.Errorf("quota %d: expected no estimate, got %v, %v", quota, start, err)
+		}
+	}
+	if start, err := estimateStartTime(16, nil, jq, 16, now); err != nil || start == nil || !start.Equal(now) {
+		t.Errorf("expected a job fitting the quota to start now, got %v, %v", start, err)
+	}
+}
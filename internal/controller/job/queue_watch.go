@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// queueIndexKey indexes TorchrunJobs by the namespace/name of their TorchrunQueue
+const queueIndexKey = "spec.queueRef"
+
+// indexJobQueue returns the namespace/name of the TorchrunQueue of a TorchrunJob
+func indexJobQueue(obj client.Object) []string {
+	job, ok := obj.(*torchrunv1alpha1.TorchrunJob)
+	if !ok || job.Spec.Queue == "" {
+		return nil
+	}
+	return []string{types.NamespacedName{Namespace: getQueueNamespace(job), Name: job.Spec.Queue}.String()}
+}
+
+// setupQueueIndex registers the index of TorchrunJobs by their TorchrunQueue
+func setupQueueIndex(ctx context.Context, mgr ctrl.Manager) error {
+	return mgr.GetFieldIndexer().IndexField(ctx, &torchrunv1alpha1.TorchrunJob{}, queueIndexKey, indexJobQueue)
+}
+
+// findJobsForQueue maps a changed TorchrunQueue to its unfinished TorchrunJobs. Pending jobs pick
+// up the change before they are admitted, and the existing Jobs of the others are compared with
+// the pod template of the changed queue, which recreates or reports them as the update policy allows.
+func (r *TorchrunJobReconciler) findJobsForQueue(ctx context.Context, obj client.Object) []reconcile.Request {
+	var jobs torchrunv1alpha1.TorchrunJobList
+	queue := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	if err := r.List(ctx, &jobs, client.MatchingFields{queueIndexKey: queue.String()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list the jobs of a changed queue", "queue", queue)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, job := range jobs.Items {
+		if isTerminalPhase(job.Status.Phase) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&job)})
+	}
+	return requests
+}
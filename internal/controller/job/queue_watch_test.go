@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestFindJobsForQueue(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	newJob := func(namespace, name, queue, queueNamespace, phase string) *torchrunv1alpha1.TorchrunJob {
+		return &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{Queue: queue, QueueNamespace: queueNamespace},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{Phase: phase},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithIndex(&torchrunv1alpha1.TorchrunJob{}, queueIndexKey, indexJobQueue).
+		WithObjects(
+			newJob("ml-platform", "pending", "research", "", torchrunv1alpha1.PhasePending),
+			newJob("ml-platform", "queued", "research", "", torchrunv1alpha1.PhaseQueued),
+			newJob("ml-platform", "running", "research", "", torchrunv1alpha1.PhaseRunning),
+			newJob("ml-platform", "succeeded", "research", "", torchrunv1alpha1.PhaseSucceeded),
+			newJob("ml-platform", "other-queue", "dev", "", torchrunv1alpha1.PhasePending),
+			newJob("team-vision", "bound", "research", "ml-platform", torchrunv1alpha1.PhasePending),
+			newJob("team-vision", "same-name", "research", "", torchrunv1alpha1.PhasePending),
+		).Build()
+	r := &TorchrunJobReconciler{Client: c, Scheme: scheme}
+
+	queue := &torchrunv1alpha1.TorchrunQueue{ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "ml-platform"}}
+	var jobs []string
+	for _, request := range r.findJobsForQueue(context.Background(), queue) {
+		jobs = append(jobs, request.String())
+	}
+	slices.Sort(jobs)
+
+	// Finished jobs, jobs of other queues and of a queue of the same name elsewhere are not reconciled
+	expected := []string{"ml-platform/pending", "ml-platform/queued", "ml-platform/running", "team-vision/bound"}
+	if !slices.Equal(jobs, expected) {
+		t.Errorf("expected jobs %v to be reconciled, got %v", expected, jobs)
+	}
+}
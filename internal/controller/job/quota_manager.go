@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// QuotaResult is the state of the OverQuota condition of a job
+type QuotaResult struct {
+	// Status of the OverQuota condition: True while the job runs on borrowed GPUs
+	Status string
+
+	// Reason is a machine-readable reason for the state
+	Reason string
+
+	// Message is a human-readable explanation of the state
+	Message string
+}
+
+// QuotaManager tells the running jobs of a queue that borrow GPUs beyond its quota, through the
+// overQuotaWeight of kai-scheduler, apart from those within the quota. Borrowed GPUs are taken
+// back first when other queues reclaim their quota.
+type QuotaManager struct {
+	client client.Client
+}
+
+// NewQuotaManager creates a new quota manager
+func NewQuotaManager(client client.Client) *QuotaManager {
+	return &QuotaManager{
+		client: client,
+	}
+}
+
+// CheckQuota places a running job among the running jobs of its kai-scheduler queue by priority,
+// then start time, and reports it as over quota if its GPUs do not fit into the GPU quota next to
+// the jobs ahead of it, which kai-scheduler keeps longest. It returns nil for jobs that are not
+// running, unless they were over quota, and for queues with an unlimited GPU quota.
+func (qm *QuotaManager) CheckQuota(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*QuotaResult, error) {
+	queue := getKaiQueueName(job, jq)
+	quota := getQueueGPUQuota(job, jq)
+	if job.Status.Phase != torchrunv1alpha1.PhaseRunning || quota < 0 {
+		if isConditionTrue(job, "OverQuota") {
+			return &QuotaResult{Status: "False", Reason: "NotRunning", Message: fmt.Sprintf("Job holds no GPUs of queue %s", queue)}, nil
+		}
+		return nil, nil
+	}
+
+	jobs := &torchrunv1alpha1.TorchrunJobList{}
+	if err := qm.client.List(ctx, jobs); err != nil {
+		return nil, fmt.Errorf("failed to list jobs of queue %s: %w", jq.Name, err)
+	}
+	// The listed copy of the job may lag behind its phase
+	running := []*torchrunv1alpha1.TorchrunJob{job}
+	for i := range jobs.Items {
+		other := &jobs.Items[i]
+		if other.UID == job.UID || other.Spec.Queue != job.Spec.Queue || getQueueNamespace(other) != getQueueNamespace(job) || other.Spec.ChildQueue != job.Spec.ChildQueue {
+			continue
+		}
+		if other.Status.Phase == torchrunv1alpha1.PhaseRunning {
+			running = append(running, other)
+		}
+	}
+	sortRunningJobs(running, jq)
+
+	used := 0
+	for _, other := range running {
+		gpus, err := getJobGPUs(other, jq)
+		if err != nil {
+			return nil, err
+		}
+		used += gpus
+		if other.UID != job.UID {
+			continue
+		}
+		if used <= quota {
+			return &QuotaResult{Status: "False", Reason: "WithinQuota", Message: fmt.Sprintf(
+				"Job runs within the quota of %d GPUs of queue %s", quota, queue)}, nil
+		}
+		return &QuotaResult{Status: "True", Reason: "BorrowingGPUs", Message: fmt.Sprintf(
+			"Job runs on GPUs borrowed beyond the quota of %d GPUs of queue %s, its workers are preempted first when other queues reclaim their quota",
+			quota, queue)}, nil
+	}
+	return nil, nil
+}
+
+// sortRunningJobs orders jobs in the order kai-scheduler keeps them when it reclaims GPUs: by
+// priority, then the jobs that started first, then namespace and name
+func sortRunningJobs(jobs []*torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) {
+	sort.SliceStable(jobs, func(i, j int) bool {
+		a, b := jobs[i], jobs[j]
+		if rankA, rankB := priorityRanks[getJobPriority(a, jq)], priorityRanks[getJobPriority(b, jq)]; rankA != rankB {
+			return rankA > rankB
+		}
+		if startA, startB := a.Status.StartTime, b.Status.StartTime; !startA.Equal(startB) {
+			// Jobs without a start time started last
+			if startA == nil || startB == nil {
+				return startB == nil
+			}
+			return startA.Before(startB)
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+}
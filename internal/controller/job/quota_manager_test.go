@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestCheckQuota(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// A running job of the queue with 8 GPUs per node
+	trainingJob := func(name string, nodes int, started time.Time) *torchrunv1alpha1.TorchrunJob {
+		return &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name + "-uid")},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{Queue: "research", NumNodes: nodes},
+			Status: torchrunv1alpha1.TorchrunJobStatus{
+				Phase:     torchrunv1alpha1.PhaseRunning,
+				StartTime: &metav1.Time{Time: started},
+			},
+		}
+	}
+	withPriority := func(job *torchrunv1alpha1.TorchrunJob, priority string) *torchrunv1alpha1.TorchrunJob {
+		job.Spec.Priority = priority
+		return job
+	}
+
+	tests := []struct {
+		description  string
+		quota        int
+		phase        string
+		priority     string
+		conditions   []torchrunv1alpha1.TorchrunJobCondition
+		existing     []client.Object
+		expectResult bool
+		expectStatus string
+		expectReason string
+	}{
+		{
+			description: "unlimited quota is never exceeded",
+			quota:       -1,
+			existing:    []client.Object{trainingJob("older", 8, now.Add(-time.Hour))},
+		},
+		{
+			description:  "job fitting next to the older jobs is within quota",
+			quota:        32,
+			existing:     []client.Object{trainingJob("older", 2, now.Add(-time.Hour))},
+			expectResult: true,
+			expectStatus: "False",
+			expectReason: "WithinQuota",
+		},
+		{
+			description:  "job started after the quota was used borrows GPUs",
+			quota:        32,
+			existing:     []client.Object{trainingJob("older", 3, now.Add(-time.Hour))},
+			expectResult: true,
+			expectStatus: "True",
+			expectReason: "BorrowingGPUs",
+		},
+		{
+			description:  "higher priority jobs are kept first",
+			quota:        32,
+			priority:     torchrunv1alpha1.PriorityHigh,
+			existing:     []client.Object{trainingJob("older", 3, now.Add(-time.Hour))},
+			expectResult: true,
+			expectStatus: "False",
+			expectReason: "WithinQuota",
+		},
+		{
+			description:  "preemptible job borrows behind a newer normal job",
+			quota:        16,
+			priority:     torchrunv1alpha1.PriorityPreemptible,
+			existing:     []client.Object{trainingJob("newer", 1, now)},
+			expectResult: true,
+			expectStatus: "True",
+			expectReason: "BorrowingGPUs",
+		},
+		{
+			description: "job that never borrowed and stopped running",
+			quota:       32,
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+		},
+		{
+			description:  "finished job releases the borrowed GPUs",
+			quota:        32,
+			phase:        torchrunv1alpha1.PhaseSucceeded,
+			conditions:   []torchrunv1alpha1.TorchrunJobCondition{{Type: "OverQuota", Status: "True"}},
+			expectResult: true,
+			expectStatus: "False",
+			expectReason: "NotRunning",
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"},
+			Spec: torchrunv1alpha1.JobQueueSpec{
+				Queue: torchrunv1alpha1.QueueConfig{
+					Name:      "research",
+					Resources: torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: test.quota}},
+				},
+				PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+					Spec: runtime.RawExtension{Raw: []byte(`{"containers":[{"name":"trainer","resources":{"requests":{"nvidia.com/gpu":"8"}}}]}`)},
+				},
+				Priorities: torchrunv1alpha1.QueuePriorityConfig{Default: torchrunv1alpha1.PriorityNormal},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(test.existing...).Build()
+		job := withPriority(trainingJob("train", 2, now.Add(-30*time.Minute)), test.priority)
+		if test.phase != "" {
+			job.Status.Phase = test.phase
+		}
+		job.Status.Conditions = test.conditions
+
+		result, err := NewQuotaManager(c).CheckQuota(context.Background(), job, jq)
+		if err != nil {
+			t.Fatalf("%s: CheckQuota() error = %v", test.description, err)
+		}
+		if (result != nil) != test.expectResult {
+			t.Errorf("%s: expected result %v, got %v", test.description, test.expectResult, result)
+			continue
+		}
+		if result != nil && (result.Status != test.expectStatus || result.Reason != test.expectReason) {
+			t.Errorf("%s: expected %s %s, got %s %s", test.description, test.expectStatus, test.expectReason, result.Status, result.Reason)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// RecordManager writes the TorchrunJobRecord of finished jobs
+type RecordManager struct {
+	client client.Client
+}
+
+// NewRecordManager creates a new record manager
+func NewRecordManager(client client.Client) *RecordManager {
+	return &RecordManager{
+		client: client,
+	}
+}
+
+// RecordJob writes the record of a finished job and names it in the status. It reports whether
+// the status changed. Jobs of queues with a log archive are recorded once the archive finished,
+// so the record links the logs.
+func (rm *RecordManager) RecordJob(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, now time.Time) (bool, error) {
+	if !isTerminalPhase(job.Status.Phase) || job.Status.JobRecord != "" {
+		return false, nil
+	}
+	if jq.Spec.LogArchive != nil && job.Status.Phase != torchrunv1alpha1.PhaseDeleted && !isLogArchiveFinished(job) {
+		return false, nil
+	}
+
+	record, err := rm.buildRecord(ctx, job, jq, now)
+	if err != nil {
+		return false, err
+	}
+	log.FromContext(ctx).Info("Writing job record", "name", record.Name, "phase", record.Spec.Phase, "gpuHours", record.Spec.GPUHours)
+	// The record of a previous leader is kept
+	if err := rm.client.Create(ctx, record); err != nil && !errors.IsAlreadyExists(err) {
+		return false, fmt.Errorf("failed to create job record: %w", err)
+	}
+	job.Status.JobRecord = record.Name
+	return true, nil
+}
+
+// buildRecord summarizes a finished job
+func (rm *RecordManager) buildRecord(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, now time.Time) (*torchrunv1alpha1.TorchrunJobRecord, error) {
+	nodes := job.Status.NumNodes
+	if nodes == 0 {
+		nodes = job.Spec.NumNodes
+	}
+	gpus, err := getJobGPUs(job, jq)
+	if err != nil {
+		return nil, err
+	}
+	if job.Spec.NumNodes > 0 {
+		gpus = gpus / job.Spec.NumNodes * nodes
+	}
+
+	reason, message, failureTime, err := rm.getExitReason(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	completion := job.Status.CompletionTime
+	if completion == nil {
+		completion = failureTime
+	}
+	if completion == nil {
+		completion = &metav1.Time{Time: now}
+	}
+	var duration time.Duration
+	if start := job.Status.StartTime; start != nil && completion.After(start.Time) {
+		duration = completion.Sub(start.Time)
+	}
+
+	gpuHours := float64(gpus) * duration.Hours()
+	if job.Status.GPUSeconds > 0 {
+		gpuHours = float64(job.Status.GPUSeconds) / 3600
+	}
+
+	attempts := job.Status.Attempt
+	if attempts < 1 {
+		attempts = 1
+	}
+	labels := map[string]string{
+		"torchrun.ai/job-id":    job.Spec.JobID,
+		"torchrun.ai/job-name":  job.Spec.JobName,
+		"torchrun.ai/job-queue": job.Spec.Queue,
+	}
+	if user := job.Labels["torchrun.ai/user"]; user != "" {
+		labels["torchrun.ai/user"] = user
+	}
+
+	record := &torchrunv1alpha1.TorchrunJobRecord{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GetJobRecordName(job),
+			Namespace: job.Namespace,
+			Labels:    labels,
+		},
+		Spec: torchrunv1alpha1.TorchrunJobRecordSpec{
+			Job:             job.Name,
+			JobName:         job.Spec.JobName,
+			JobID:           job.Spec.JobID,
+			Queue:           job.Spec.Queue,
+			QueueNamespace:  job.Spec.QueueNamespace,
+			User:            job.Labels["torchrun.ai/user"],
+			Phase:           job.Status.Phase,
+			Reason:          reason,
+			Message:         message,
+			StartTime:       job.Status.StartTime,
+			CompletionTime:  completion,
+			DurationSeconds: int64(duration.Seconds()),
+			NumNodes:        nodes,
+			GPUs:            gpus,
+			GPUSeconds:      job.Status.GPUSeconds,
+			GPUHours:        strconv.FormatFloat(gpuHours, 'f', 2, 64),
+			Attempts:        attempts,
+			Restarts:        job.Status.Restarts,
+			LogArchiveURL:   job.Status.LogArchiveURL,
+			TrackingURL:     job.Status.TrackingURL,
+		},
+	}
+	if checkpoints := job.Spec.Checkpoints; checkpoints != nil {
+		record.Spec.CheckpointLocation = checkpoints.Volume + "/" + job.Spec.JobName
+	}
+	return record, nil
+}
+
+// getExitReason returns why a finished job ended, and when the Kubernetes Job failed. Failed
+// jobs take the reason of the Failed condition of their Kubernetes Job, or of the last failed
+// attempt once the Job was removed.
+func (rm *RecordManager) getExitReason(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) (string, string, *metav1.Time, error) {
+	switch job.Status.Phase {
+	case torchrunv1alpha1.PhaseSucceeded:
+		return "Completed", "", nil, nil
+	case torchrunv1alpha1.PhaseDeleted:
+		return "Deleted", "", nil, nil
+	}
+
+	k8sJob := &batchv1.Job{}
+	err := rm.client.Get(ctx, types.NamespacedName{Name: GetJobName(job), Namespace: job.Namespace}, k8sJob)
+	if err != nil && !errors.IsNotFound(err) {
+		return "", "", nil, err
+	}
+	if err == nil {
+		if failed := getJobFailedCondition(k8sJob); failed != nil {
+			return failed.Reason, failed.Message, &failed.LastTransitionTime, nil
+		}
+	}
+	if attempts := job.Status.Attempts; len(attempts) > 0 {
+		last := attempts[len(attempts)-1]
+		return last.Reason, last.Message, last.FailureTime, nil
+	}
+	if job.Status.Phase == torchrunv1alpha1.PhaseTimedOut {
+		return batchv1.JobReasonDeadlineExceeded, "", nil, nil
+	}
+	return job.Status.Phase, "", nil, nil
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestRecordJob(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	start := metav1.NewTime(now.Add(-90 * time.Minute))
+	completion := metav1.NewTime(now.Add(-30 * time.Minute))
+	queue := func(logArchive bool) *torchrunv1alpha1.TorchrunQueue {
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"},
+			Spec: torchrunv1alpha1.JobQueueSpec{
+				PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+					Spec: runtime.RawExtension{Raw: []byte(`{"containers":[{"name":"trainer","resources":{"requests":{"nvidia.com/gpu":"8"}}}]}`)},
+				},
+			},
+		}
+		if logArchive {
+			jq.Spec.LogArchive = &torchrunv1alpha1.LogArchiveConfig{Bucket: "s3://logs"}
+		}
+		return jq
+	}
+	failedJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{
+			Type:               batchv1.JobFailed,
+			Status:             corev1.ConditionTrue,
+			Reason:             batchv1.JobReasonBackoffLimitExceeded,
+			Message:            "Job has reached the specified backoff limit",
+			LastTransitionTime: completion,
+		}}},
+	}
+
+	tests := []struct {
+		description  string
+		phase        string
+		jobRecord    string
+		gpuSeconds   int64
+		logArchive   bool
+		existing     []client.Object
+		expectRecord bool
+		expectReason string
+		expectHours  string
+	}{
+		{
+			description: "running job is not recorded",
+			phase:       torchrunv1alpha1.PhaseRunning,
+		},
+		{
+			description:  "succeeded job is recorded",
+			phase:        torchrunv1alpha1.PhaseSucceeded,
+			expectRecord: true,
+			expectReason: "Completed",
+			expectHours:  "16.00",
+		},
+		{
+			description:  "failed job takes the reason of its Kubernetes Job",
+			phase:        torchrunv1alpha1.PhaseFailed,
+			existing:     []client.Object{failedJob},
+			expectRecord: true,
+			expectReason: batchv1.JobReasonBackoffLimitExceeded,
+			expectHours:  "16.00",
+		},
+		{
+			description:  "GPU hours come from the GPU time of the worker pods",
+			phase:        torchrunv1alpha1.PhaseSucceeded,
+			gpuSeconds:   45000,
+			expectRecord: true,
+			expectReason: "Completed",
+			expectHours:  "12.50",
+		},
+		{
+			description: "recorded job is not recorded again",
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+			jobRecord:   "train-earlier",
+		},
+		{
+			description: "job waits for its log archive",
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+			logArchive:  true,
+		},
+		{
+			description: "record of a previous leader is kept",
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+			existing: []client.Object{&torchrunv1alpha1.TorchrunJobRecord{
+				ObjectMeta: metav1.ObjectMeta{Name: "train-0123abcd", Namespace: "default"},
+				Spec:       torchrunv1alpha1.TorchrunJobRecordSpec{Job: "train", Queue: "research", Phase: torchrunv1alpha1.PhaseSucceeded, Reason: "Completed", GPUHours: "16.00"},
+			}},
+			expectRecord: true,
+			expectReason: "Completed",
+			expectHours:  "16.00",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "train",
+				Namespace: "default",
+				UID:       types.UID("0123abcd-4567-89ef"),
+				Labels:    map[string]string{"torchrun.ai/user": "alice"},
+			},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:       "research",
+				JobName:     "vit",
+				JobID:       "vit-1",
+				NumNodes:    2,
+				Checkpoints: &torchrunv1alpha1.CheckpointConfig{Volume: "checkpoints"},
+			},
+			Status: torchrunv1alpha1.TorchrunJobStatus{
+				Phase:      test.phase,
+				NumNodes:   2,
+				StartTime:  &start,
+				JobRecord:  test.jobRecord,
+				GPUSeconds: test.gpuSeconds,
+			},
+		}
+		if test.phase == torchrunv1alpha1.PhaseSucceeded {
+			job.Status.CompletionTime = &completion
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(test.existing...).Build()
+
+		recorded, err := NewRecordManager(c).RecordJob(context.Background(), job, queue(test.logArchive), now)
+		if err != nil {
+			t.Fatalf("%s: RecordJob() error = %v", test.description, err)
+		}
+		if recorded != test.expectRecord {
+			t.Errorf("%s: expected recorded %v, got %v", test.description, test.expectRecord, recorded)
+		}
+		if !test.expectRecord {
+			continue
+		}
+		if job.Status.JobRecord != "train-0123abcd" {
+			t.Errorf("%s: expected status.jobRecord train-0123abcd, got %q", test.description, job.Status.JobRecord)
+		}
+
+		record := &torchrunv1alpha1.TorchrunJobRecord{}
+		if err := c.Get(context.Background(), client.ObjectKey{Name: job.Status.JobRecord, Namespace: "default"}, record); err != nil {
+			t.Fatalf("%s: expected job record: %v", test.description, err)
+		}
+		spec := record.Spec
+		if spec.Reason != test.expectReason || spec.GPUHours != test.expectHours {
+			t.Errorf("%s: expected reason %s and %s GPU hours, got %s and %s", test.description, test.expectReason, test.expectHours, spec.Reason, spec.GPUHours)
+		}
+		if len(test.existing) > 0 && test.phase == torchrunv1alpha1.PhaseSucceeded {
+			continue
+		}
+		if spec.Job != "train" || spec.User != "alice" || spec.NumNodes != 2 || spec.GPUs != 16 || spec.DurationSeconds != 3600 ||
+			spec.CheckpointLocation != "checkpoints/vit" || record.Labels["torchrun.ai/user"] != "alice" {
+			t.Errorf("%s: unexpected record %+v", test.description, record)
+		}
+	}
+}
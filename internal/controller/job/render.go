@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+// maxRenderBodyBytes limits the size of the TorchrunJob manifests posted to the render endpoint
+const maxRenderBodyBytes = 1 << 20
+
+// RenderServer serves the render endpoint at /render on its own address. The endpoint does not
+// authenticate its callers and reads with the permissions of the controller, so the address has
+// to be a loopback address, reachable only through a port forward to the controller pod.
+type RenderServer struct {
+	// Addr is the address the server listens on
+	Addr string
+
+	// Handler renders the jobs
+	Handler *RenderHandler
+}
+
+// ValidateRenderAddr checks that the render endpoint binds to a loopback address, localhost or
+// an IP of the loopback range
+func ValidateRenderAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid render address %q: %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("render address %q must bind to localhost or a loopback IP, the endpoint does not authenticate its callers", addr)
+	}
+	return nil
+}
+
+// Start serves the render endpoint until the context is cancelled
+func (s *RenderServer) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("/render", s.Handler)
+	server := &http.Server{Addr: s.Addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	log.FromContext(ctx).WithName("render").Info("Serving the render endpoint", "addr", s.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection serves the render endpoint on every replica, rendering changes nothing
+func (s *RenderServer) NeedLeaderElection() bool {
+	return false
+}
+
+// RenderHandler renders the Kubernetes Job and the workspace sync pod the controller would
+// create for a TorchrunJob, without creating them. GET renders the TorchrunJob named by the
+// namespace and name query parameters, POST the TorchrunJob manifest in the body, which the API
+// server defaults and validates in a dry run first. The manifests are returned as YAML documents.
+type RenderHandler struct {
+	// Client reads the queue, template and cloned job, and dry runs posted jobs
+	Client client.Client
+
+	// NativeSidecars renders sidecars as native sidecars, as the job reconciler does
+	NativeSidecars bool
+
+	// Config provides the images of the operator config
+	Config *config.Store
+}
+
+// ServeHTTP renders the job of the request
+func (h *RenderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	job := &torchrunv1alpha1.TorchrunJob{}
+	switch r.Method {
+	case http.MethodGet:
+		key := types.NamespacedName{Namespace: r.URL.Query().Get("namespace"), Name: r.URL.Query().Get("name")}
+		if key.Namespace == "" || key.Name == "" {
+			http.Error(w, "namespace and name query parameters are required", http.StatusBadRequest)
+			return
+		}
+		if err := h.Client.Get(ctx, key, job); err != nil {
+			writeRenderError(w, err)
+			return
+		}
+	case http.MethodPost:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRenderBodyBytes+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxRenderBodyBytes {
+			http.Error(w, "manifest too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := yaml.Unmarshal(body, job); err != nil {
+			http.Error(w, fmt.Sprintf("invalid TorchrunJob: %v", err), http.StatusBadRequest)
+			return
+		}
+		if job.Namespace == "" {
+			job.Namespace = "default"
+		}
+		// The dry run applies the CRD defaults and validation, as creating the job would
+		job.SetGroupVersionKind(torchrunv1alpha1.GroupVersion.WithKind("TorchrunJob"))
+		job.ResourceVersion = ""
+		if err := h.Client.Create(ctx, job, client.DryRunAll); err != nil {
+			writeRenderError(w, err)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	manifests, err := h.Render(ctx, job)
+	if err != nil {
+		writeRenderError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(manifests)
+}
+
+// Render merges the cloned job and the template into the job, as admission does, and returns the
+// Kubernetes Job and, for jobs with a workspace PVC, the sync pod as YAML documents. The download
+// URL of uploaded workspaces is not signed.
+func (h *RenderHandler) Render(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) ([]byte, error) {
+	if !isConditionTrue(job, "Admitted") {
+		if _, err := NewCloneManager(h.Client).ApplyClone(ctx, job); err != nil {
+			return nil, fmt.Errorf("failed to clone job: %w", err)
+		}
+		if _, err := NewTemplateManager(h.Client).ApplyTemplate(ctx, job); err != nil {
+			return nil, fmt.Errorf("failed to apply template: %w", err)
+		}
+	}
+
+	jq := &torchrunv1alpha1.TorchrunQueue{}
+	if err := h.Client.Get(ctx, types.NamespacedName{Name: job.Spec.Queue, Namespace: getQueueNamespace(job)}, jq); err != nil {
+		return nil, fmt.Errorf("failed to get TorchrunQueue %s/%s: %w", getQueueNamespace(job), job.Spec.Queue, err)
+	}
+
+	operatorConfig := h.Config.Get()
+	k8sJob, err := NewJobManager(h.Client, h.NativeSidecars, operatorConfig).BuildJob(ctx, job, jq)
+	if err != nil {
+		return nil, err
+	}
+	k8sJob.SetGroupVersionKind(batchv1.SchemeGroupVersion.WithKind("Job"))
+	objects := []client.Object{k8sJob}
+
+	if !isEphemeralWorkspace(job, jq) {
+		syncPod, err := NewWorkspaceManager(h.Client, h.Client, operatorConfig.Images).BuildSyncPod(ctx, job, jq, false)
+		if err != nil {
+			return nil, err
+		}
+		syncPod.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+		objects = append(objects, syncPod)
+	}
+
+	var manifests bytes.Buffer
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		manifests.WriteString("---\n")
+		manifests.Write(data)
+	}
+	return manifests.Bytes(), nil
+}
+
+// writeRenderError answers with the status of API errors, e.g. 404 for a missing queue or 422
+// for a job the dry run rejected
+func writeRenderError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var apiStatus apierrors.APIStatus
+	if errors.As(err, &apiStatus) && apiStatus.Status().Code != 0 {
+		status = int(apiStatus.Status().Code)
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestRenderHandler(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue: torchrunv1alpha1.QueueConfig{Name: "dev"},
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+				Spec: runtime.RawExtension{Raw: []byte(`{"containers":[{"name":"trainer","image":"pytorch"}]}`)},
+			},
+		},
+	}
+	submitted := &torchrunv1alpha1.TorchrunJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "submitted", Namespace: "default"},
+		Spec: torchrunv1alpha1.TorchrunJobSpec{
+			Queue:    "dev",
+			JobName:  "submitted",
+			JobID:    "submitted-id",
+			Command:  "python train.py",
+			NumNodes: 1,
+		},
+	}
+	manifest := `
+apiVersion: torchrun.ai/v1alpha1
+kind: TorchrunJob
+metadata:
+  name: posted
+spec:
+  queue: dev
+  jobName: posted
+  jobID: posted-id
+  command: python finetune.py
+  numNodes: 1
+`
+
+	tests := []struct {
+		description   string
+		method        string
+		target        string
+		body          string
+		expectStatus  int
+		expectContent []string
+	}{
+		{
+			description:   "submitted job",
+			method:        http.MethodGet,
+			target:        "/render?namespace=default&name=submitted",
+			expectStatus:  http.StatusOK,
+			expectContent: []string{"kind: Job", "name: submitted", "python train.py", "kind: Pod", "name: submitted-sync"},
+		},
+		{
+			description:   "posted manifest",
+			method:        http.MethodPost,
+			target:        "/render",
+			body:          manifest,
+			expectStatus:  http.StatusOK,
+			expectContent: []string{"kind: Job", "namespace: default", "python finetune.py", "name: posted-sync"},
+		},
+		{
+			description:  "missing job",
+			method:       http.MethodGet,
+			target:       "/render?namespace=default&name=missing",
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			description:  "missing queue",
+			method:       http.MethodPost,
+			target:       "/render",
+			body:         strings.Replace(manifest, "queue: dev", "queue: prod", 1),
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			description:  "job without name",
+			method:       http.MethodGet,
+			target:       "/render?namespace=default",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			description:  "unsupported method",
+			method:       http.MethodDelete,
+			target:       "/render",
+			expectStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, test := range tests {
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(jq.DeepCopy(), submitted.DeepCopy()).Build()
+		handler := &RenderHandler{Client: c, NativeSidecars: true, Config: config.NewStore(config.Default())}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(test.method, test.target, strings.NewReader(test.body)))
+		if recorder.Code != test.expectStatus {
+			t.Errorf("%s: expected status %d, got %d: %s", test.description, test.expectStatus, recorder.Code, recorder.Body.String())
+			continue
+		}
+		for _, content := range test.expectContent {
+			if !strings.Contains(recorder.Body.String(), content) {
+				t.Errorf("%s: expected the manifests to contain %q, got:\n%s", test.description, content, recorder.Body.String())
+			}
+		}
+
+		// Rendering creates nothing
+		posted := &torchrunv1alpha1.TorchrunJob{}
+		if err := c.Get(context.Background(), types.NamespacedName{Name: "posted", Namespace: "default"}, posted); err == nil {
+			t.Errorf("%s: expected the posted job not to be created", test.description)
+		}
+		k8sJobs := &batchv1.JobList{}
+		if err := c.List(context.Background(), k8sJobs, client.InNamespace("default")); err != nil {
+			t.Fatalf("%s: failed to list jobs: %v", test.description, err)
+		}
+		if len(k8sJobs.Items) != 0 {
+			t.Errorf("%s: expected no Kubernetes Job to be created, got %d", test.description, len(k8sJobs.Items))
+		}
+	}
+}
+
+func TestValidateRenderAddr(t *testing.T) {
+	tests := []struct {
+		description string
+		addr        string
+		expectError bool
+	}{
+		{description: "loopback IPv4", addr: "127.0.0.1:8082"},
+		{description: "loopback IPv6", addr: "[::1]:8082"},
+		{description: "localhost", addr: "localhost:8082"},
+		{description: "all interfaces", addr: ":8082", expectError: true},
+		{description: "pod IP", addr: "10.0.0.12:8082", expectError: true},
+		{description: "unspecified IP", addr: "0.0.0.0:8082", expectError: true},
+		{description: "hostname", addr: "torchrun-controller:8082", expectError: true},
+		{description: "missing port", addr: "127.0.0.1", expectError: true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRenderAddr(test.addr)
+		if (err != nil) != test.expectError {
+			t.Errorf("%s: expected error %v, got %v", test.description, test.expectError, err)
+		}
+	}
+}
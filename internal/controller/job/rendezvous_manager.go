@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// rendezvousLogLimitBytes is how much of the start of the trainer logs is read. The torchrun
+// agent completes or fails the rendezvous before the training code logs anything.
+const rendezvousLogLimitBytes = 64 * 1024
+
+// rendezvousCompletePattern matches the line the torchrun agent logs once all nodes joined
+var rendezvousCompletePattern = regexp.MustCompile(`Rendezvous complete for workers`)
+
+// rendezvousErrorPattern matches the errors of the torchrun agent giving up on the rendezvous:
+// the c10d and etcd backends raise the Rendezvous errors, the static backend times out on the
+// TCP store of rank 0 with e.g. "Timed out after 901 seconds waiting for clients. 1/2 clients joined."
+var rendezvousErrorPattern = regexp.MustCompile(`Rendezvous(Timeout|Closed|Connection|State)?Error|DistStoreError|Timed out after \d+ seconds waiting for clients`)
+
+// RendezvousResult is the state of the RendezvousReady condition of a multi-node job
+type RendezvousResult struct {
+	// Status of the RendezvousReady condition: Unknown while workers are missing, then True or False
+	Status string
+
+	// Reason is a machine-readable reason for the state
+	Reason string
+
+	// Message is a human-readable explanation of the state, naming the ranks that never joined
+	Message string
+}
+
+// RendezvousManager follows the torchrun rendezvous of the workers of multi-node jobs, whose
+// hangs are otherwise only visible in the worker logs
+type RendezvousManager struct {
+	clientset kubernetes.Interface
+}
+
+// NewRendezvousManager creates a new rendezvous manager. The logs of the worker pods are read
+// through clientset, which the controller-runtime client cannot.
+func NewRendezvousManager(clientset kubernetes.Interface) *RendezvousManager {
+	return &RendezvousManager{
+		clientset: clientset,
+	}
+}
+
+// CheckRendezvous reads the trainer logs of the worker pods that did not join the rendezvous yet
+// and records their rendezvous state in the worker status. It returns nil for single node and
+// debug jobs, jobs without worker pods, and finished jobs whose rendezvous state is settled.
+func (rm *RendezvousManager) CheckRendezvous(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) *RendezvousResult {
+	if rm.clientset == nil || job.Spec.NumNodes <= 1 || isDebugJob(job) || len(job.Status.Workers.Pods) == 0 {
+		return nil
+	}
+	finished := isTerminalPhase(job.Status.Phase)
+	if status := getConditionStatus(job, "RendezvousReady"); finished && status != "" && status != "Unknown" {
+		return nil
+	}
+	if job.Status.Phase == torchrunv1alpha1.PhaseSucceeded {
+		return &RendezvousResult{Status: "True", Reason: "RendezvousComplete", Message: "Workers completed training"}
+	}
+
+	limitBytes := int64(rendezvousLogLimitBytes)
+	messages := map[string]string{}
+	for i := range job.Status.Workers.Pods {
+		worker := &job.Status.Workers.Pods[i]
+		if worker.Rendezvous == torchrunv1alpha1.RendezvousJoined {
+			continue
+		}
+		if worker.Rendezvous == "" {
+			worker.Rendezvous = torchrunv1alpha1.RendezvousWaiting
+		}
+		// Pending pods have no logs yet
+		if worker.Phase != string(corev1.PodRunning) && worker.Phase != string(corev1.PodFailed) {
+			continue
+		}
+		logs, err := rm.clientset.CoreV1().Pods(job.Namespace).GetLogs(worker.Name, &corev1.PodLogOptions{
+			Container:  "trainer",
+			LimitBytes: &limitBytes,
+		}).DoRaw(ctx)
+		if err != nil {
+			// Logs of a pod that just started or was removed are not available
+			log.FromContext(ctx).V(1).Info("Failed to read worker logs", "pod", worker.Name, "error", err.Error())
+			continue
+		}
+		state, message := parseRendezvousLogs(string(logs))
+		if state != "" {
+			worker.Rendezvous = state
+			messages[worker.Name] = message
+		}
+	}
+
+	return buildRendezvousResult(job, messages, finished)
+}
+
+// parseRendezvousLogs returns the last rendezvous state in the logs of a torchrun agent: Joined
+// once the rendezvous completed, Failed with the error line when it gave up, or an empty state
+// while it waits. Agents rendezvous again after restarting their workers, so the last event wins.
+func parseRendezvousLogs(logs string) (string, string) {
+	var state, message string
+	for _, line := range strings.Split(logs, "\n") {
+		switch {
+		case rendezvousCompletePattern.MatchString(line):
+			state, message = torchrunv1alpha1.RendezvousJoined, ""
+		case rendezvousErrorPattern.MatchString(line):
+			state, message = torchrunv1alpha1.RendezvousFailed, strings.TrimSpace(line)
+		}
+	}
+	return state, message
+}
+
+// buildRendezvousResult summarizes the rendezvous state of the workers. A rank joined if any of
+// its pods joined. messages holds the errors of the pods that failed the rendezvous; the first
+// failed rank is reported. Finished jobs report the ranks that never joined as incomplete.
+func buildRendezvousResult(job *torchrunv1alpha1.TorchrunJob, messages map[string]string, finished bool) *RendezvousResult {
+	numNodes := job.Status.NumNodes
+	if numNodes <= 0 {
+		numNodes = job.Spec.NumNodes
+	}
+
+	joined := map[int32]bool{}
+	var failed *torchrunv1alpha1.WorkerPodStatus
+	for i := range job.Status.Workers.Pods {
+		worker := &job.Status.Workers.Pods[i]
+		switch worker.Rendezvous {
+		case torchrunv1alpha1.RendezvousJoined:
+			joined[worker.Index] = true
+		case torchrunv1alpha1.RendezvousFailed:
+			if failed == nil && messages[worker.Name] != "" {
+				failed = worker
+			}
+		}
+	}
+	var missing []int
+	for rank := 0; rank < numNodes; rank++ {
+		if !joined[int32(rank)] {
+			missing = append(missing, rank)
+		}
+	}
+
+	switch {
+	case len(missing) == 0:
+		return &RendezvousResult{Status: "True", Reason: "RendezvousComplete", Message: fmt.Sprintf("All %d workers joined the rendezvous", numNodes)}
+	case failed != nil:
+		return &RendezvousResult{Status: "False", Reason: "RendezvousFailed", Message: fmt.Sprintf(
+			"Worker %s (rank %d) failed the rendezvous, %s never joined: %s", failed.Name, failed.Index, describeRanks(missing), messages[failed.Name])}
+	case finished:
+		return &RendezvousResult{Status: "False", Reason: "RendezvousIncomplete", Message: fmt.Sprintf(
+			"Job ended before %s joined the rendezvous", describeRanks(missing))}
+	default:
+		return &RendezvousResult{Status: "Unknown", Reason: "RendezvousWaiting", Message: fmt.Sprintf(
+			"Waiting for %s to join the rendezvous, %d of %d workers joined", describeRanks(missing), numNodes-len(missing), numNodes)}
+	}
+}
+
+// describeRanks lists ranks for a condition message, e.g. "ranks 1, 3"
+func describeRanks(ranks []int) string {
+	names := make([]string, len(ranks))
+	for i, rank := range ranks {
+		names[i] = strconv.Itoa(rank)
+	}
+	if len(ranks) == 1 {
+		return "rank " + names[0]
+	}
+	return "ranks " + strings.Join(names, ", ")
+}
@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestParseRendezvousLogs(t *testing.T) {
+	tests := []struct {
+		description   string
+		logs          string
+		expectState   string
+		expectMessage string
+	}{
+		{
+			description: "agent waiting for the other nodes",
+			logs:        "[default] starting workers for entrypoint: bash\n[default] Rendezvous'ing worker group\n",
+		},
+		{
+			description: "agent completed the rendezvous",
+			logs:        "[default] Rendezvous'ing worker group\n[default] Rendezvous complete for workers. Result:\n  restart_count=0\n  group_rank=1\n",
+			expectState: torchrunv1alpha1.RendezvousJoined,
+		},
+		{
+			description:   "static rendezvous timed out on the store of rank 0",
+			logs:          "[default] Rendezvous'ing worker group\ntorch.distributed.DistStoreError: Timed out after 901 seconds waiting for clients. 1/2 clients joined.\n",
+			expectState:   torchrunv1alpha1.RendezvousFailed,
+			expectMessage: "torch.distributed.DistStoreError: Timed out after 901 seconds waiting for clients. 1/2 clients joined.",
+		},
+		{
+			description:   "rendezvous after a worker restart failed",
+			logs:          "[default] Rendezvous complete for workers. Result:\n[default] Worker group FAILED\n  torch.distributed.elastic.rendezvous.api.RendezvousTimeoutError\n",
+			expectState:   torchrunv1alpha1.RendezvousFailed,
+			expectMessage: "torch.distributed.elastic.rendezvous.api.RendezvousTimeoutError",
+		},
+	}
+
+	for _, test := range tests {
+		state, message := parseRendezvousLogs(test.logs)
+		if state != test.expectState || message != test.expectMessage {
+			t.Errorf("%s: expected %q %q, got %q %q", test.description, test.expectState, test.expectMessage, state, message)
+		}
+	}
+}
+
+func TestBuildRendezvousResult(t *testing.T) {
+	worker := func(name string, index int32, rendezvous string) torchrunv1alpha1.WorkerPodStatus {
+		return torchrunv1alpha1.WorkerPodStatus{Name: name, Index: index, Rendezvous: rendezvous}
+	}
+
+	tests := []struct {
+		description   string
+		workers       []torchrunv1alpha1.WorkerPodStatus
+		messages      map[string]string
+		finished      bool
+		expectStatus  string
+		expectReason  string
+		expectMessage string
+	}{
+		{
+			description:   "all ranks joined",
+			workers:       []torchrunv1alpha1.WorkerPodStatus{worker("train-0", 0, "Joined"), worker("train-1", 1, "Joined"), worker("train-2", 2, "Joined")},
+			expectStatus:  "True",
+			expectReason:  "RendezvousComplete",
+			expectMessage: "All 3 workers joined the rendezvous",
+		},
+		{
+			description:   "missing ranks are named while waiting",
+			workers:       []torchrunv1alpha1.WorkerPodStatus{worker("train-0", 0, "Joined"), worker("train-1", 1, "Waiting")},
+			expectStatus:  "Unknown",
+			expectReason:  "RendezvousWaiting",
+			expectMessage: "Waiting for ranks 1, 2 to join the rendezvous, 1 of 3 workers joined",
+		},
+		{
+			description:   "first failed rank is reported",
+			workers:       []torchrunv1alpha1.WorkerPodStatus{worker("train-0", 0, "Failed"), worker("train-1", 1, "Waiting"), worker("train-2", 2, "Failed")},
+			messages:      map[string]string{"train-0": "DistStoreError: Timed out after 901 seconds waiting for clients. 2/3 clients joined.", "train-2": "RendezvousTimeoutError"},
+			expectStatus:  "False",
+			expectReason:  "RendezvousFailed",
+			expectMessage: "Worker train-0 (rank 0) failed the rendezvous, ranks 0, 1, 2 never joined: DistStoreError: Timed out after 901 seconds waiting for clients. 2/3 clients joined.",
+		},
+		{
+			description:   "rank joined by the pod replacing a failed one",
+			workers:       []torchrunv1alpha1.WorkerPodStatus{worker("train-0", 0, "Joined"), worker("train-1-a", 1, "Failed"), worker("train-1-b", 1, "Joined"), worker("train-2", 2, "Joined")},
+			expectStatus:  "True",
+			expectReason:  "RendezvousComplete",
+			expectMessage: "All 3 workers joined the rendezvous",
+		},
+		{
+			description:   "finished job reports the ranks that never joined",
+			workers:       []torchrunv1alpha1.WorkerPodStatus{worker("train-0", 0, "Joined"), worker("train-1", 1, "Joined")},
+			finished:      true,
+			expectStatus:  "False",
+			expectReason:  "RendezvousIncomplete",
+			expectMessage: "Job ended before rank 2 joined the rendezvous",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			Spec: torchrunv1alpha1.TorchrunJobSpec{NumNodes: 3},
+			Status: torchrunv1alpha1.TorchrunJobStatus{
+				Workers: torchrunv1alpha1.WorkerStatus{Pods: test.workers},
+			},
+		}
+		result := buildRendezvousResult(job, test.messages, test.finished)
+		if result.Status != test.expectStatus || result.Reason != test.expectReason || result.Message != test.expectMessage {
+			t.Errorf("%s: expected %s %s %q, got %s %s %q", test.description,
+				test.expectStatus, test.expectReason, test.expectMessage, result.Status, result.Reason, result.Message)
+		}
+	}
+}
+
+func TestCheckRendezvous(t *testing.T) {
+	tests := []struct {
+		description      string
+		numNodes         int
+		phase            string
+		conditionStatus  string
+		workers          []torchrunv1alpha1.WorkerPodStatus
+		expectResult     bool
+		expectStatus     string
+		expectRendezvous []string
+	}{
+		{
+			description: "single node jobs are not followed",
+			numNodes:    1,
+			phase:       torchrunv1alpha1.PhaseRunning,
+			workers:     []torchrunv1alpha1.WorkerPodStatus{{Name: "train-0", Phase: "Running"}},
+		},
+		{
+			description: "jobs without workers are not followed",
+			numNodes:    2,
+			phase:       torchrunv1alpha1.PhaseQueued,
+		},
+		{
+			description: "workers without rendezvous logs are waiting",
+			numNodes:    2,
+			phase:       torchrunv1alpha1.PhaseRunning,
+			workers: []torchrunv1alpha1.WorkerPodStatus{
+				{Name: "train-0", Phase: "Running", Rendezvous: "Joined"},
+				{Name: "train-1", Index: 1, Phase: "Running"},
+			},
+			expectResult:     true,
+			expectStatus:     "Unknown",
+			expectRendezvous: []string{"Joined", "Waiting"},
+		},
+		{
+			description: "succeeded jobs completed the rendezvous",
+			numNodes:    2,
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+			workers: []torchrunv1alpha1.WorkerPodStatus{
+				{Name: "train-0", Phase: "Succeeded"},
+				{Name: "train-1", Index: 1, Phase: "Succeeded"},
+			},
+			expectResult:     true,
+			expectStatus:     "True",
+			expectRendezvous: []string{"", ""},
+		},
+		{
+			description:     "finished jobs with a settled condition are not read again",
+			numNodes:        2,
+			phase:           torchrunv1alpha1.PhaseFailed,
+			conditionStatus: "False",
+			workers:         []torchrunv1alpha1.WorkerPodStatus{{Name: "train-0", Phase: "Failed"}},
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			Spec: torchrunv1alpha1.TorchrunJobSpec{NumNodes: test.numNodes},
+			Status: torchrunv1alpha1.TorchrunJobStatus{
+				Phase:   test.phase,
+				Workers: torchrunv1alpha1.WorkerStatus{Pods: test.workers},
+			},
+		}
+		if test.conditionStatus != "" {
+			job.Status.Conditions = []torchrunv1alpha1.TorchrunJobCondition{{Type: "RendezvousReady", Status: test.conditionStatus}}
+		}
+
+		result := NewRendezvousManager(kubefake.NewSimpleClientset()).CheckRendezvous(context.Background(), job)
+		if (result != nil) != test.expectResult {
+			t.Errorf("%s: expected result %v, got %v", test.description, test.expectResult, result)
+			continue
+		}
+		if result != nil && result.Status != test.expectStatus {
+			t.Errorf("%s: expected status %s, got %s", test.description, test.expectStatus, result.Status)
+		}
+		for i, expected := range test.expectRendezvous {
+			if actual := job.Status.Workers.Pods[i].Rendezvous; actual != expected {
+				t.Errorf("%s: expected worker %d rendezvous %q, got %q", test.description, i, expected, actual)
+			}
+		}
+	}
+}
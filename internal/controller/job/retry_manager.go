@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/patch"
+)
+
+// RetryManager replaces Kubernetes Jobs that exhausted their backoff limit with new attempts
+type RetryManager struct {
+	client client.Client
+}
+
+// NewRetryManager creates a new retry manager
+func NewRetryManager(client client.Client) *RetryManager {
+	return &RetryManager{
+		client: client,
+	}
+}
+
+// RetryFailedJob records the failure of the current attempt and starts the next attempt once
+// its backoff expired. It reports whether the job is being retried and how long the backoff
+// still lasts; a retried job without wait is ready for the Job of its next attempt.
+func (rm *RetryManager) RetryFailedJob(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) (bool, time.Duration, error) {
+	retry := getRetryConfig(job)
+	if retry == nil {
+		return false, 0, nil
+	}
+	base := job.DeepCopy()
+	attempt := job.Status.Attempt
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	k8sJob := &batchv1.Job{}
+	err := rm.client.Get(ctx, types.NamespacedName{Name: GetJobName(job), Namespace: job.Namespace}, k8sJob)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, 0, err
+	}
+	if err == nil {
+		if failed := getJobFailedCondition(k8sJob); failed != nil && !isAttemptRecorded(job, attempt) {
+			job.Status.Attempts = append(job.Status.Attempts, buildJobAttempt(k8sJob, failed, attempt))
+		}
+	}
+
+	// The failure stays recorded when the Job is removed after its TTL
+	if !isAttemptRecorded(job, attempt) || attempt > retry.MaxJobRetries {
+		return false, 0, nil
+	}
+
+	failure := job.Status.Attempts[len(job.Status.Attempts)-1]
+	next := failure.FailureTime.Add(getRetryBackoff(retry, attempt))
+	if wait := time.Until(next); wait > 0 {
+		job.Status.NextAttemptTime = &metav1.Time{Time: next}
+		return true, wait, nil
+	}
+
+	// Persist the next attempt before deleting the failed Job, so the failed attempt is never
+	// created again
+	log.FromContext(ctx).Info("Retrying failed Job", "name", job.Name, "attempt", attempt+1, "reason", failure.Reason)
+	job.Status.Attempt = attempt + 1
+	job.Status.NextAttemptTime = nil
+	if err := patch.Status(ctx, rm.client, job, base); err != nil {
+		return false, 0, err
+	}
+
+	failedJob := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: failure.JobName, Namespace: job.Namespace}}
+	if err := rm.client.Delete(ctx, failedJob, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+		return false, 0, err
+	}
+	return true, 0, nil
+}
+
+// getRetryConfig returns how failed Jobs of the job are retried. In the WholeJob restart mode
+// every restart is a new Job, so without retryJobOnFailure the job gets maxRestarts retries with
+// the default backoff.
+func getRetryConfig(job *torchrunv1alpha1.TorchrunJob) *torchrunv1alpha1.RetryJobOnFailureConfig {
+	reliability := job.Spec.Reliability
+	if reliability.RetryJobOnFailure != nil || reliability.RestartMode != torchrunv1alpha1.RestartModeWholeJob || reliability.MaxRestarts == 0 {
+		return reliability.RetryJobOnFailure
+	}
+	return &torchrunv1alpha1.RetryJobOnFailureConfig{
+		MaxJobRetries:     reliability.MaxRestarts,
+		BackoffSeconds:    60,
+		MaxBackoffSeconds: 3600,
+	}
+}
+
+// getRetryBackoff returns the wait before the attempt after the given one, doubling the
+// backoff for every attempt
+func getRetryBackoff(retry *torchrunv1alpha1.RetryJobOnFailureConfig, attempt int32) time.Duration {
+	backoff := time.Duration(retry.BackoffSeconds) * time.Second
+	maxBackoff := time.Duration(retry.MaxBackoffSeconds) * time.Second
+	for i := int32(1); i < attempt && (maxBackoff == 0 || backoff < maxBackoff); i++ {
+		backoff *= 2
+	}
+	if maxBackoff > 0 && backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+// getJobFailedCondition returns the Failed condition of the Job if it is true
+func getJobFailedCondition(k8sJob *batchv1.Job) *batchv1.JobCondition {
+	for i := range k8sJob.Status.Conditions {
+		condition := &k8sJob.Status.Conditions[i]
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return condition
+		}
+	}
+	return nil
+}
+
+// isAttemptRecorded returns true if the failure of the attempt is in the attempt history
+func isAttemptRecorded(job *torchrunv1alpha1.TorchrunJob, attempt int32) bool {
+	attempts := job.Status.Attempts
+	return len(attempts) > 0 && attempts[len(attempts)-1].Attempt == attempt
+}
+
+// buildJobAttempt builds the history entry of a failed Job
+func buildJobAttempt(k8sJob *batchv1.Job, failed *batchv1.JobCondition, attempt int32) torchrunv1alpha1.JobAttempt {
+	failureTime := failed.LastTransitionTime
+	if failureTime.IsZero() {
+		failureTime = metav1.Now()
+	}
+	return torchrunv1alpha1.JobAttempt{
+		Attempt:     attempt,
+		JobName:     k8sJob.Name,
+		StartTime:   k8sJob.Status.StartTime,
+		FailureTime: &failureTime,
+		Reason:      failed.Reason,
+		Message:     failed.Message,
+	}
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestRetryFailedJob(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	retry := &torchrunv1alpha1.RetryJobOnFailureConfig{MaxJobRetries: 1, BackoffSeconds: 60, MaxBackoffSeconds: 3600}
+	batchJob := func(name string, failedAt time.Time) *batchv1.Job {
+		k8sJob := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		if !failedAt.IsZero() {
+			k8sJob.Status.Conditions = []batchv1.JobCondition{{
+				Type:               batchv1.JobFailed,
+				Status:             corev1.ConditionTrue,
+				Reason:             "BackoffLimitExceeded",
+				Message:            "Job has reached the specified backoff limit",
+				LastTransitionTime: metav1.NewTime(failedAt),
+			}}
+		}
+		return k8sJob
+	}
+
+	tests := []struct {
+		description    string
+		retry          *torchrunv1alpha1.RetryJobOnFailureConfig
+		attempt        int32
+		attempts       []torchrunv1alpha1.JobAttempt
+		k8sJob         *batchv1.Job
+		expectRetrying bool
+		expectWait     bool
+		expectAttempt  int32
+		expectHistory  int
+		expectDeleted  string
+	}{
+		{
+			description:   "job without retry config is not retried",
+			k8sJob:        batchJob("train", time.Now().Add(-time.Hour)),
+			expectAttempt: 0,
+		},
+		{
+			description:   "running job is not retried",
+			retry:         retry,
+			k8sJob:        batchJob("train", time.Time{}),
+			expectAttempt: 0,
+		},
+		{
+			description:    "failed job waits for the backoff",
+			retry:          retry,
+			k8sJob:         batchJob("train", time.Now()),
+			expectRetrying: true,
+			expectWait:     true,
+			expectAttempt:  0,
+			expectHistory:  1,
+		},
+		{
+			description:    "failed job is replaced after the backoff",
+			retry:          retry,
+			k8sJob:         batchJob("train", time.Now().Add(-2*time.Minute)),
+			expectRetrying: true,
+			expectAttempt:  2,
+			expectHistory:  1,
+			expectDeleted:  "train",
+		},
+		{
+			description: "failed attempt removed after its TTL is still replaced",
+			retry:       retry,
+			attempts: []torchrunv1alpha1.JobAttempt{
+				{Attempt: 1, JobName: "train", FailureTime: &metav1.Time{Time: time.Now().Add(-2 * time.Minute)}},
+			},
+			expectRetrying: true,
+			expectAttempt:  2,
+			expectHistory:  1,
+		},
+		{
+			description: "exhausted retries are recorded but not retried",
+			retry:       retry,
+			attempt:     2,
+			attempts: []torchrunv1alpha1.JobAttempt{
+				{Attempt: 1, JobName: "train", FailureTime: &metav1.Time{Time: time.Now().Add(-time.Hour)}},
+			},
+			k8sJob:        batchJob("train-attempt-2", time.Now().Add(-time.Hour)),
+			expectAttempt: 2,
+			expectHistory: 2,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Reliability: torchrunv1alpha1.ReliabilityConfig{RetryJobOnFailure: test.retry},
+			},
+			Status: torchrunv1alpha1.TorchrunJobStatus{Attempt: test.attempt, Attempts: test.attempts},
+		}
+		objects := []client.Object{job}
+		if test.k8sJob != nil {
+			objects = append(objects, test.k8sJob)
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).WithStatusSubresource(job).Build()
+		rm := NewRetryManager(c)
+
+		retrying, wait, err := rm.RetryFailedJob(context.Background(), job)
+		if err != nil {
+			t.Fatalf("%s: RetryFailedJob() error = %v", test.description, err)
+		}
+		if retrying != test.expectRetrying {
+			t.Errorf("%s: expected retrying %v, got %v", test.description, test.expectRetrying, retrying)
+		}
+		if (wait > 0) != test.expectWait {
+			t.Errorf("%s: expected wait %v, got %s", test.description, test.expectWait, wait)
+		}
+		if test.expectWait && (wait > time.Minute || job.Status.NextAttemptTime == nil) {
+			t.Errorf("%s: expected next attempt within a minute, got %s at %v", test.description, wait, job.Status.NextAttemptTime)
+		}
+		if job.Status.Attempt != test.expectAttempt {
+			t.Errorf("%s: expected attempt %d, got %d", test.description, test.expectAttempt, job.Status.Attempt)
+		}
+		if len(job.Status.Attempts) != test.expectHistory {
+			t.Errorf("%s: expected %d recorded attempts, got %v", test.description, test.expectHistory, job.Status.Attempts)
+		}
+		if test.expectAttempt == 2 && GetJobName(job) != "train-attempt-2" {
+			t.Errorf("%s: expected Job name train-attempt-2, got %s", test.description, GetJobName(job))
+		}
+		if test.expectDeleted != "" {
+			err := c.Get(context.Background(), types.NamespacedName{Name: test.expectDeleted, Namespace: "default"}, &batchv1.Job{})
+			if !apierrors.IsNotFound(err) {
+				t.Errorf("%s: expected Job %s to be deleted, got %v", test.description, test.expectDeleted, err)
+			}
+		}
+	}
+}
+
+func TestGetRetryBackoff(t *testing.T) {
+	retry := &torchrunv1alpha1.RetryJobOnFailureConfig{BackoffSeconds: 60, MaxBackoffSeconds: 200}
+
+	tests := []struct {
+		attempt  int32
+		expected time.Duration
+	}{
+		{attempt: 1, expected: 60 * time.Second},
+		{attempt: 2, expected: 120 * time.Second},
+		{attempt: 3, expected: 200 * time.Second},
+		{attempt: 10, expected: 200 * time.Second},
+	}
+
+	for _, test := range tests {
+		if got := getRetryBackoff(retry, test.attempt); got != test.expected {
+			t.Errorf("attempt %d: expected backoff %s, got %s", test.attempt, test.expected, got)
+		}
+	}
+}
+
+func TestGetRetryConfig(t *testing.T) {
+	retry := &torchrunv1alpha1.RetryJobOnFailureConfig{MaxJobRetries: 2, BackoffSeconds: 30}
+
+	tests := []struct {
+		description string
+		reliability torchrunv1alpha1.ReliabilityConfig
+		expectRetry bool
+		expectMax   int32
+	}{
+		{
+			description: "job without retry config",
+			reliability: torchrunv1alpha1.ReliabilityConfig{MaxRestarts: 3},
+		},
+		{
+			description: "retry config is used as is",
+			reliability: torchrunv1alpha1.ReliabilityConfig{MaxRestarts: 3, RetryJobOnFailure: retry},
+			expectRetry: true,
+			expectMax:   2,
+		},
+		{
+			description: "whole job mode retries maxRestarts times",
+			reliability: torchrunv1alpha1.ReliabilityConfig{MaxRestarts: 3, RestartMode: torchrunv1alpha1.RestartModeWholeJob},
+			expectRetry: true,
+			expectMax:   3,
+		},
+		{
+			description: "whole job mode takes the retry config",
+			reliability: torchrunv1alpha1.ReliabilityConfig{MaxRestarts: 3, RestartMode: torchrunv1alpha1.RestartModeWholeJob, RetryJobOnFailure: retry},
+			expectRetry: true,
+			expectMax:   2,
+		},
+		{
+			description: "whole job mode without restarts",
+			reliability: torchrunv1alpha1.ReliabilityConfig{RestartMode: torchrunv1alpha1.RestartModeWholeJob},
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{Spec: torchrunv1alpha1.TorchrunJobSpec{Reliability: test.reliability}}
+		got := getRetryConfig(job)
+		if (got != nil) != test.expectRetry || (got != nil && got.MaxJobRetries != test.expectMax) {
+			t.Errorf("%s: expected retry %v with %d retries, got %+v", test.description, test.expectRetry, test.expectMax, got)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+const (
+	// runtimeLimitContainerName is the name of the sidecar that signals the training processes
+	runtimeLimitContainerName = "runtime-limit"
+
+	// runtimeLimitVolumeName is the downward API volume the sidecar reads the signal from
+	runtimeLimitVolumeName = "torchrun-runtime-limit"
+
+	// runtimeLimitMountPath is where the runtime limit volume is mounted in the sidecar
+	runtimeLimitMountPath = "/etc/torchrun-runtime-limit"
+
+	// runtimeSignalAnnotation is set on the worker pods of a job that exceeded the maximum
+	// runtime of its queue, to the signal its training processes receive
+	runtimeSignalAnnotation = "torchrun.ai/runtime-signal"
+
+	// defaultRuntimeGracePeriodSeconds is the time between the runtime signal and the end of the
+	// active deadline of queues that do not set one
+	defaultRuntimeGracePeriodSeconds = 600
+)
+
+// runtimeLimitScript signals the training processes once the controller annotates the pod with
+// the runtime signal, which the kubelet writes into the downward API volume. The training
+// processes are the children of the torchrun agent, which is found by its --rdzv-id argument in
+// the shared process namespace. They are signaled once, so the sidecar stays idle afterwards.
+const runtimeLimitScript = `
+while sleep "$RUNTIME_LIMIT_CHECK_INTERVAL"; do
+  [ -s "$RUNTIME_LIMIT_SIGNAL_FILE" ] || continue
+  signal=$(cat "$RUNTIME_LIMIT_SIGNAL_FILE")
+  pids=""
+  for p in /proc/[0-9]*; do
+    if tr '\0' '\n' < "$p/cmdline" 2>/dev/null | grep -A1 -x -- '--rdzv-id' | grep -qxF -- "$RUNTIME_LIMIT_RDZV_ID"; then
+      pids="$pids $(pgrep -P "${p#/proc/}")"
+    fi
+  done
+  set -- $pids
+  if [ "$#" -eq 0 ]; then
+    echo "torchrun-runtime-limit: training processes not found" >&2
+    continue
+  fi
+  echo "torchrun-runtime-limit: maximum runtime exceeded, sending $signal to $*" >&2
+  kill -s "${signal#SIG}" "$@"
+  break
+done
+while sleep 3600; do :; done
+`
+
+// RuntimeLimitResult is the state of the MaxRuntimeExceeded condition of a job
+type RuntimeLimitResult struct {
+	// Status of the MaxRuntimeExceeded condition: True once the job ran longer than the maximum
+	// runtime of its queue
+	Status string
+
+	// Reason is a machine-readable reason for the state
+	Reason string
+
+	// Message is a human-readable explanation of the state
+	Message string
+}
+
+// RuntimeLimitManager enforces the maximum runtime of queues. Workers of a job that exceeds it
+// are annotated with the runtime signal, which their runtime limit sidecar sends to the training
+// processes, and the active deadline of the Job stops it after the grace period.
+type RuntimeLimitManager struct {
+	client client.Client
+}
+
+// NewRuntimeLimitManager creates a new runtime limit manager
+func NewRuntimeLimitManager(client client.Client) *RuntimeLimitManager {
+	return &RuntimeLimitManager{
+		client: client,
+	}
+}
+
+// attachRuntimeLimit injects the sidecar that signals the training processes when the job
+// exceeds the maximum runtime of the queue. It must run after the trainer command is built and
+// before the sidecar lifecycle is attached, so the sidecar stops with the trainer.
+func (jm *JobManager) attachRuntimeLimit(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) {
+	// Idle debug workers and notebooks run no training processes
+	if jq.Spec.Limits.MaxRuntimeSeconds == nil || isInteractiveJob(job) {
+		return
+	}
+
+	// The sidecar has to see the training processes to signal them
+	shareProcessNamespace := true
+	podSpec.ShareProcessNamespace = &shareProcessNamespace
+
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: runtimeLimitVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{{
+					Path:     "signal",
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: fmt.Sprintf("metadata.annotations['%s']", runtimeSignalAnnotation)},
+				}},
+			},
+		},
+	})
+
+	podSpec.Containers = append(podSpec.Containers, corev1.Container{
+		Name:    runtimeLimitContainerName,
+		Image:   jm.config.Images.RuntimeLimit,
+		Command: []string{"/bin/sh", "-c", runtimeLimitScript},
+		Env: []corev1.EnvVar{
+			{Name: "RUNTIME_LIMIT_SIGNAL_FILE", Value: runtimeLimitMountPath + "/signal"},
+			{Name: "RUNTIME_LIMIT_CHECK_INTERVAL", Value: "10"},
+			{Name: "RUNTIME_LIMIT_RDZV_ID", Value: getRdzvID(job)},
+		},
+		VolumeMounts: []corev1.VolumeMount{{Name: runtimeLimitVolumeName, MountPath: runtimeLimitMountPath, ReadOnly: true}},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("16Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+		},
+	})
+}
+
+// EnforceMaxRuntime records when a running job exceeds the maximum runtime of its queue in
+// status.runtimeLimitTime, and once it did annotates its worker pods with the runtime signal.
+// Workers created after the limit, e.g. by a restart, are annotated too. A job the active
+// deadline stopped after the signal has the reason of its condition changed to DeadlineExceeded.
+// It returns nil for queues without a maximum runtime, debug and notebook jobs and jobs that are
+// not running.
+func (rm *RuntimeLimitManager) EnforceMaxRuntime(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, now time.Time) (*RuntimeLimitResult, error) {
+	limits := jq.Spec.Limits
+	if limits.MaxRuntimeSeconds == nil || isInteractiveJob(job) {
+		job.Status.RuntimeLimitTime = nil
+		return nil, nil
+	}
+
+	// The hard limit is the active deadline, which the status manager reports as the phase
+	if job.Status.Phase == torchrunv1alpha1.PhaseTimedOut {
+		job.Status.RuntimeLimitTime = nil
+		condition := getCondition(job, "MaxRuntimeExceeded")
+		if condition == nil || condition.Status != "True" || condition.Reason == "DeadlineExceeded" {
+			return nil, nil
+		}
+		// The condition stays True, so only its reason and message change
+		condition.Reason = "DeadlineExceeded"
+		condition.Message = fmt.Sprintf("Job was stopped by its active deadline after it exceeded the maximum runtime of %ds of queue %s and the grace period of %ds",
+			*limits.MaxRuntimeSeconds, jq.Name, getRuntimeGracePeriodSeconds(limits))
+		return &RuntimeLimitResult{Status: condition.Status, Reason: condition.Reason, Message: condition.Message}, nil
+	}
+
+	if job.Status.Phase != torchrunv1alpha1.PhaseRunning || job.Status.StartTime == nil {
+		job.Status.RuntimeLimitTime = nil
+		return nil, nil
+	}
+	limitAt := job.Status.StartTime.Add(time.Duration(*limits.MaxRuntimeSeconds) * time.Second)
+	job.Status.RuntimeLimitTime = &metav1.Time{Time: limitAt}
+	if now.Before(limitAt) {
+		return &RuntimeLimitResult{Status: "False", Reason: "WithinRuntime", Message: fmt.Sprintf(
+			"Job exceeds the maximum runtime of %ds of queue %s at %s", *limits.MaxRuntimeSeconds, jq.Name, limitAt.UTC().Format(time.RFC3339))}, nil
+	}
+
+	signal := getRuntimeSignal(limits)
+	pods := &corev1.PodList{}
+	if err := rm.client.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{
+		"app":                "torchrun",
+		"torchrun.ai/job-id": job.Spec.JobID,
+	}); err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Annotations[runtimeSignalAnnotation] != "" || pod.DeletionTimestamp != nil ||
+			pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		log.FromContext(ctx).Info("Signaling worker over the maximum runtime", "pod", pod.Name, "signal", signal)
+		base := pod.DeepCopy()
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[runtimeSignalAnnotation] = signal
+		if err := rm.client.Patch(ctx, pod, client.MergeFrom(base)); err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	message := fmt.Sprintf("Job exceeded the maximum runtime of %ds of queue %s, sent %s to its training processes",
+		*limits.MaxRuntimeSeconds, jq.Name, signal)
+	if job.Status.DeadlineTime != nil {
+		message += fmt.Sprintf(" and stops it at %s", job.Status.DeadlineTime.UTC().Format(time.RFC3339))
+	}
+	return &RuntimeLimitResult{Status: "True", Reason: "GraceSignalSent", Message: message}, nil
+}
+
+// getRuntimeLimitDeadline returns the active deadline a queue with a maximum runtime allows: the
+// maximum runtime and the grace period after the signal. It returns nil without a maximum runtime.
+func getRuntimeLimitDeadline(limits torchrunv1alpha1.QueueLimits) *int64 {
+	if limits.MaxRuntimeSeconds == nil {
+		return nil
+	}
+	deadline := *limits.MaxRuntimeSeconds + getRuntimeGracePeriodSeconds(limits)
+	return &deadline
+}
+
+// getRuntimeGracePeriodSeconds returns the time between the runtime signal and the end of the
+// active deadline
+func getRuntimeGracePeriodSeconds(limits torchrunv1alpha1.QueueLimits) int64 {
+	if limits.RuntimeGracePeriodSeconds == 0 {
+		return defaultRuntimeGracePeriodSeconds
+	}
+	return limits.RuntimeGracePeriodSeconds
+}
+
+// getRuntimeSignal returns the signal sent to the training processes over the maximum runtime
+func getRuntimeSignal(limits torchrunv1alpha1.QueueLimits) string {
+	if limits.RuntimeSignal == "" {
+		return "SIGTERM"
+	}
+	return limits.RuntimeSignal
+}
@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestAttachRuntimeLimit(t *testing.T) {
+	jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+	maxRuntime := int64(3600)
+
+	tests := []struct {
+		description   string
+		maxRuntime    *int64
+		mode          string
+		expectSidecar bool
+	}{
+		{
+			description: "queue without a maximum runtime",
+		},
+		{
+			description:   "queue with a maximum runtime",
+			maxRuntime:    &maxRuntime,
+			expectSidecar: true,
+		},
+		{
+			description: "debug jobs run no training processes",
+			maxRuntime:  &maxRuntime,
+			mode:        torchrunv1alpha1.ModeDebug,
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{
+			Limits: torchrunv1alpha1.QueueLimits{MaxRuntimeSeconds: test.maxRuntime},
+		}}
+		job := &torchrunv1alpha1.TorchrunJob{
+			Spec:   torchrunv1alpha1.TorchrunJobSpec{JobName: "train", Mode: test.mode},
+			Status: torchrunv1alpha1.TorchrunJobStatus{RdzvID: "default-train-id-train"},
+		}
+		podSpec := corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}}}
+		jm.attachRuntimeLimit(job, jq, &podSpec)
+
+		var sidecar *corev1.Container
+		for i := range podSpec.Containers {
+			if podSpec.Containers[i].Name == runtimeLimitContainerName {
+				sidecar = &podSpec.Containers[i]
+			}
+		}
+		if (sidecar != nil) != test.expectSidecar {
+			t.Errorf("%s: expected sidecar %v, got %+v", test.description, test.expectSidecar, sidecar)
+			continue
+		}
+		if sidecar == nil {
+			continue
+		}
+		if sidecar.Image != config.Default().Images.RuntimeLimit {
+			t.Errorf("%s: expected the runtime limit image of the operator config, got %q", test.description, sidecar.Image)
+		}
+		if podSpec.ShareProcessNamespace == nil || !*podSpec.ShareProcessNamespace {
+			t.Errorf("%s: expected a shared process namespace", test.description)
+		}
+		env := map[string]string{}
+		for _, e := range sidecar.Env {
+			env[e.Name] = e.Value
+		}
+		if env["RUNTIME_LIMIT_RDZV_ID"] != "default-train-id-train" {
+			t.Errorf("%s: expected the rendezvous ID of the job, got %q", test.description, env["RUNTIME_LIMIT_RDZV_ID"])
+		}
+		if len(podSpec.Volumes) != 1 || podSpec.Volumes[0].DownwardAPI == nil ||
+			podSpec.Volumes[0].DownwardAPI.Items[0].FieldRef.FieldPath != "metadata.annotations['torchrun.ai/runtime-signal']" {
+			t.Errorf("%s: expected the runtime signal volume, got %+v", test.description, podSpec.Volumes)
+		}
+	}
+}
+
+func TestEnforceMaxRuntime(t *testing.T) {
+	startedAt := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	maxRuntime := int64(3600)
+	worker := func(name string, phase corev1.PodPhase, annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Labels:      map[string]string{"app": "torchrun", "torchrun.ai/job-id": "train-id"},
+				Annotations: annotations,
+			},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+
+	tests := []struct {
+		description   string
+		maxRuntime    *int64
+		signal        string
+		phase         string
+		conditions    []torchrunv1alpha1.TorchrunJobCondition
+		now           time.Time
+		pods          []*corev1.Pod
+		expectReason  string
+		expectSignals map[string]string
+	}{
+		{
+			description: "queue without a maximum runtime",
+			phase:       torchrunv1alpha1.PhaseRunning,
+			now:         startedAt.Add(2 * time.Hour),
+			pods:        []*corev1.Pod{worker("train-0", corev1.PodRunning, nil)},
+		},
+		{
+			description:   "job within the maximum runtime is not signaled",
+			maxRuntime:    &maxRuntime,
+			phase:         torchrunv1alpha1.PhaseRunning,
+			now:           startedAt.Add(30 * time.Minute),
+			pods:          []*corev1.Pod{worker("train-0", corev1.PodRunning, nil)},
+			expectReason:  "WithinRuntime",
+			expectSignals: map[string]string{"train-0": ""},
+		},
+		{
+			description: "job over the maximum runtime signals its running workers",
+			maxRuntime:  &maxRuntime,
+			phase:       torchrunv1alpha1.PhaseRunning,
+			now:         startedAt.Add(time.Hour),
+			pods: []*corev1.Pod{
+				worker("train-0", corev1.PodRunning, nil),
+				worker("train-1", corev1.PodPending, nil),
+				worker("train-2", corev1.PodFailed, nil),
+			},
+			expectReason:  "GraceSignalSent",
+			expectSignals: map[string]string{"train-0": "SIGTERM", "train-1": "SIGTERM", "train-2": ""},
+		},
+		{
+			description:   "queue signal is sent",
+			maxRuntime:    &maxRuntime,
+			signal:        "SIGUSR1",
+			phase:         torchrunv1alpha1.PhaseRunning,
+			now:           startedAt.Add(2 * time.Hour),
+			pods:          []*corev1.Pod{worker("train-0", corev1.PodRunning, nil)},
+			expectReason:  "GraceSignalSent",
+			expectSignals: map[string]string{"train-0": "SIGUSR1"},
+		},
+		{
+			description:   "signaled workers keep their signal",
+			maxRuntime:    &maxRuntime,
+			signal:        "SIGUSR1",
+			phase:         torchrunv1alpha1.PhaseRunning,
+			now:           startedAt.Add(2 * time.Hour),
+			pods:          []*corev1.Pod{worker("train-0", corev1.PodRunning, map[string]string{runtimeSignalAnnotation: "SIGTERM"})},
+			expectReason:  "GraceSignalSent",
+			expectSignals: map[string]string{"train-0": "SIGTERM"},
+		},
+		{
+			description:   "job stopped by the deadline after the signal records it",
+			maxRuntime:    &maxRuntime,
+			phase:         torchrunv1alpha1.PhaseTimedOut,
+			conditions:    []torchrunv1alpha1.TorchrunJobCondition{{Type: "MaxRuntimeExceeded", Status: "True", Reason: "GraceSignalSent"}},
+			now:           startedAt.Add(2 * time.Hour),
+			expectReason:  "DeadlineExceeded",
+			expectSignals: map[string]string{},
+		},
+		{
+			description:   "job timed out within the maximum runtime",
+			maxRuntime:    &maxRuntime,
+			phase:         torchrunv1alpha1.PhaseTimedOut,
+			conditions:    []torchrunv1alpha1.TorchrunJobCondition{{Type: "MaxRuntimeExceeded", Status: "False", Reason: "WithinRuntime"}},
+			now:           startedAt.Add(30 * time.Minute),
+			expectSignals: map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		objects := make([]client.Object, 0, len(test.pods))
+		for _, pod := range test.pods {
+			objects = append(objects, pod)
+		}
+		c := fake.NewClientBuilder().WithObjects(objects...).Build()
+		rm := NewRuntimeLimitManager(c)
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default"},
+			Spec: torchrunv1alpha1.JobQueueSpec{
+				Limits: torchrunv1alpha1.QueueLimits{MaxRuntimeSeconds: test.maxRuntime, RuntimeSignal: test.signal},
+			},
+		}
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{JobID: "train-id", NumNodes: 3},
+			Status: torchrunv1alpha1.TorchrunJobStatus{
+				Phase:      test.phase,
+				StartTime:  &metav1.Time{Time: startedAt},
+				Conditions: test.conditions,
+			},
+		}
+
+		result, err := rm.EnforceMaxRuntime(context.Background(), job, jq, test.now)
+		if err != nil {
+			t.Fatalf("%s: EnforceMaxRuntime() error = %v", test.description, err)
+		}
+		reason := ""
+		if result != nil {
+			reason = result.Reason
+		}
+		if reason != test.expectReason {
+			t.Errorf("%s: expected reason %q, got %+v", test.description, test.expectReason, result)
+		}
+		if test.expectReason == "DeadlineExceeded" && getCondition(job, "MaxRuntimeExceeded").Reason != "DeadlineExceeded" {
+			t.Errorf("%s: expected the condition to record the deadline, got %+v", test.description, job.Status.Conditions)
+		}
+
+		for name, signal := range test.expectSignals {
+			pod := &corev1.Pod{}
+			if err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, pod); err != nil {
+				t.Fatalf("%s: failed to get pod %s: %v", test.description, name, err)
+			}
+			if pod.Annotations[runtimeSignalAnnotation] != signal {
+				t.Errorf("%s: expected pod %s signaled with %q, got %q", test.description, name, signal, pod.Annotations[runtimeSignalAnnotation])
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// maxScheduleIterations bounds the search for a time that is in both the job windows and the
+// queue maintenance windows
+const maxScheduleIterations = 64
+
+// weekdays maps the day names of time windows to weekdays
+var weekdays = map[string]time.Weekday{
+	"Sun": time.Sunday,
+	"Mon": time.Monday,
+	"Tue": time.Tuesday,
+	"Wed": time.Wednesday,
+	"Thu": time.Thursday,
+	"Fri": time.Friday,
+	"Sat": time.Saturday,
+}
+
+// ScheduleManager holds jobs back until their schedule and the queue maintenance windows allow
+// them to start
+type ScheduleManager struct {
+	client client.Client
+}
+
+// NewScheduleManager creates a new schedule manager
+func NewScheduleManager(client client.Client) *ScheduleManager {
+	return &ScheduleManager{
+		client: client,
+	}
+}
+
+// CheckSchedule returns how long the job has to wait before its Kubernetes Job is created.
+// Jobs that already started are never held back, even when their window closed since.
+func (sm *ScheduleManager) CheckSchedule(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, now time.Time) (time.Duration, error) {
+	if job.Spec.Schedule == nil && len(jq.Spec.MaintenanceWindows) == 0 {
+		return 0, nil
+	}
+
+	err := sm.client.Get(ctx, types.NamespacedName{Name: GetJobName(job), Namespace: job.Namespace}, &batchv1.Job{})
+	if err == nil {
+		return 0, nil
+	}
+	if !errors.IsNotFound(err) {
+		return 0, err
+	}
+
+	start, err := getScheduledStartTime(job, jq, now)
+	if err != nil {
+		return 0, err
+	}
+	return start.Sub(now), nil
+}
+
+// getScheduledStartTime returns the earliest time from now on that is after startAfter and
+// in both the job windows and the queue maintenance windows
+func getScheduledStartTime(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, now time.Time) (time.Time, error) {
+	start := now
+	var jobWindows []torchrunv1alpha1.TimeWindow
+	if schedule := job.Spec.Schedule; schedule != nil {
+		if schedule.StartAfter != nil && schedule.StartAfter.After(start) {
+			start = schedule.StartAfter.Time
+		}
+		jobWindows = schedule.Windows
+	}
+
+	// Move to the next opening of whichever windows are closed until both are open
+	for i := 0; i < maxScheduleIterations; i++ {
+		next := start
+		for _, windows := range [][]torchrunv1alpha1.TimeWindow{jobWindows, jq.Spec.MaintenanceWindows} {
+			open, err := getNextWindowOpen(windows, start)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if open.After(next) {
+				next = open
+			}
+		}
+		if next.Equal(start) {
+			return start, nil
+		}
+		start = next
+	}
+	return time.Time{}, fmt.Errorf("job schedule windows do not overlap with the queue maintenance windows")
+}
+
+// getNextWindowOpen returns t if it is in one of the windows, otherwise the time the next of
+// them opens. Without windows every time is open.
+func getNextWindowOpen(windows []torchrunv1alpha1.TimeWindow, t time.Time) (time.Time, error) {
+	if len(windows) == 0 {
+		return t, nil
+	}
+
+	var next time.Time
+	for _, window := range windows {
+		open, err := getWindowOpen(window, t)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if next.IsZero() || open.Before(next) {
+			next = open
+		}
+	}
+	return next, nil
+}
+
+// getWindowOpen returns t if it is in the window, otherwise the time the window opens next
+func getWindowOpen(window torchrunv1alpha1.TimeWindow, t time.Time) (time.Time, error) {
+	location := time.UTC
+	if window.TimeZone != "" {
+		var err error
+		if location, err = time.LoadLocation(window.TimeZone); err != nil {
+			return time.Time{}, fmt.Errorf("invalid time zone %q: %w", window.TimeZone, err)
+		}
+	}
+	start, err := time.Parse("15:04", window.Start)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid window start %q: %w", window.Start, err)
+	}
+	end, err := time.Parse("15:04", window.End)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid window end %q: %w", window.End, err)
+	}
+	days := map[time.Weekday]bool{}
+	for _, day := range window.Days {
+		weekday, ok := weekdays[day]
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid window day %q", day)
+		}
+		days[weekday] = true
+	}
+
+	// Start a day early for windows that opened yesterday and close today
+	local := t.In(location)
+	for offset := -1; offset <= 7; offset++ {
+		opens := time.Date(local.Year(), local.Month(), local.Day()+offset, start.Hour(), start.Minute(), 0, 0, location)
+		if len(days) > 0 && !days[opens.Weekday()] {
+			continue
+		}
+		closes := time.Date(opens.Year(), opens.Month(), opens.Day(), end.Hour(), end.Minute(), 0, 0, location)
+		if !closes.After(opens) {
+			closes = closes.AddDate(0, 0, 1)
+		}
+
+		if !opens.After(t) && t.Before(closes) {
+			return t, nil
+		}
+		if opens.After(t) {
+			return opens, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("window %s-%s never opens", window.Start, window.End)
+}
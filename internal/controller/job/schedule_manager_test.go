@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestGetScheduledStartTime(t *testing.T) {
+	// A Wednesday afternoon
+	now := time.Date(2026, 10, 14, 15, 0, 0, 0, time.UTC)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		description  string
+		now          time.Time
+		schedule     *torchrunv1alpha1.ScheduleConfig
+		queueWindows []torchrunv1alpha1.TimeWindow
+		expected     time.Time
+		expectError  bool
+	}{
+		{
+			description: "job without schedule starts now",
+			now:         now,
+			expected:    now,
+		},
+		{
+			description: "job starts after startAfter",
+			now:         now,
+			schedule:    &torchrunv1alpha1.ScheduleConfig{StartAfter: &metav1.Time{Time: at(15, 9, 30)}},
+			expected:    at(15, 9, 30),
+		},
+		{
+			description: "past startAfter does not delay the job",
+			now:         now,
+			schedule:    &torchrunv1alpha1.ScheduleConfig{StartAfter: &metav1.Time{Time: at(1, 0, 0)}},
+			expected:    now,
+		},
+		{
+			description: "job waits for its window to open",
+			now:         now,
+			schedule: &torchrunv1alpha1.ScheduleConfig{
+				Windows: []torchrunv1alpha1.TimeWindow{{Start: "22:00", End: "06:00"}},
+			},
+			expected: at(14, 22, 0),
+		},
+		{
+			description: "job in a window spanning midnight starts now",
+			now:         at(15, 3, 0),
+			schedule: &torchrunv1alpha1.ScheduleConfig{
+				Windows: []torchrunv1alpha1.TimeWindow{{Start: "22:00", End: "06:00"}},
+			},
+			expected: at(15, 3, 0),
+		},
+		{
+			description: "window on weekends only opens on saturday",
+			now:         now,
+			schedule: &torchrunv1alpha1.ScheduleConfig{
+				Windows: []torchrunv1alpha1.TimeWindow{{Days: []string{"Sat", "Sun"}, Start: "00:00", End: "00:00"}},
+			},
+			expected: at(17, 0, 0),
+		},
+		{
+			description: "window is evaluated in its time zone",
+			now:         now,
+			schedule: &torchrunv1alpha1.ScheduleConfig{
+				Windows: []torchrunv1alpha1.TimeWindow{{Start: "22:00", End: "06:00", TimeZone: "Europe/Berlin"}},
+			},
+			expected: at(14, 20, 0),
+		},
+		{
+			description: "earliest of several windows is used",
+			now:         now,
+			schedule: &torchrunv1alpha1.ScheduleConfig{
+				Windows: []torchrunv1alpha1.TimeWindow{{Start: "22:00", End: "23:00"}, {Start: "18:00", End: "19:00"}},
+			},
+			expected: at(14, 18, 0),
+		},
+		{
+			description:  "job waits for the queue maintenance window",
+			now:          now,
+			queueWindows: []torchrunv1alpha1.TimeWindow{{Start: "20:00", End: "04:00"}},
+			expected:     at(14, 20, 0),
+		},
+		{
+			description: "job starts when both its window and the queue window are open",
+			now:         now,
+			schedule: &torchrunv1alpha1.ScheduleConfig{
+				StartAfter: &metav1.Time{Time: at(14, 23, 30)},
+				Windows:    []torchrunv1alpha1.TimeWindow{{Start: "20:00", End: "23:00"}},
+			},
+			queueWindows: []torchrunv1alpha1.TimeWindow{{Start: "22:00", End: "02:00"}},
+			expected:     at(15, 22, 0),
+		},
+		{
+			description: "windows that never overlap are an error",
+			now:         now,
+			schedule: &torchrunv1alpha1.ScheduleConfig{
+				Windows: []torchrunv1alpha1.TimeWindow{{Start: "08:00", End: "09:00"}},
+			},
+			queueWindows: []torchrunv1alpha1.TimeWindow{{Start: "20:00", End: "21:00"}},
+			expectError:  true,
+		},
+		{
+			description:  "invalid time zone is an error",
+			now:          now,
+			queueWindows: []torchrunv1alpha1.TimeWindow{{Start: "20:00", End: "21:00", TimeZone: "Mars/Olympus"}},
+			expectError:  true,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{Spec: torchrunv1alpha1.TorchrunJobSpec{Schedule: test.schedule}}
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{MaintenanceWindows: test.queueWindows}}
+
+		start, err := getScheduledStartTime(job, jq, test.now)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("%s: expected error, got start %s", test.description, start)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: getScheduledStartTime() error = %v", test.description, err)
+		}
+		if !start.Equal(test.expected) {
+			t.Errorf("%s: expected start %s, got %s", test.description, test.expected, start.UTC())
+		}
+	}
+}
+
+func TestCheckSchedule(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	now := time.Date(2026, 10, 14, 15, 0, 0, 0, time.UTC)
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			MaintenanceWindows: []torchrunv1alpha1.TimeWindow{{Start: "20:00", End: "04:00"}},
+		},
+	}
+
+	tests := []struct {
+		description string
+		objects     []client.Object
+		expected    time.Duration
+	}{
+		{
+			description: "job that has not started waits for the window",
+			expected:    5 * time.Hour,
+		},
+		{
+			description: "started job is not held back",
+			objects:     []client.Object{&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"}}},
+		},
+	}
+
+	for _, test := range tests {
+		sm := NewScheduleManager(fake.NewClientBuilder().WithScheme(scheme).WithObjects(test.objects...).Build())
+		job := &torchrunv1alpha1.TorchrunJob{ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"}}
+
+		wait, err := sm.CheckSchedule(context.Background(), job, jq, now)
+		if err != nil {
+			t.Fatalf("%s: CheckSchedule() error = %v", test.description, err)
+		}
+		if wait != test.expected {
+			t.Errorf("%s: expected wait %s, got %s", test.description, test.expected, wait)
+		}
+	}
+}
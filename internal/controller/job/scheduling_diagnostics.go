@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// gpuProductLabel is the node label of the GPU model set by GPU feature discovery
+const gpuProductLabel = "nvidia.com/gpu.product"
+
+// schedulingDiagnosis explains why worker pods of a job cannot be scheduled
+type schedulingDiagnosis struct {
+	// Reason classifies the scheduler message, e.g. InsufficientGPU or QuotaExceeded
+	Reason string
+
+	// Summary is the short form shown in workersStatus, e.g. "waiting for 32x A100 in queue research"
+	Summary string
+
+	// Message is the summary with the scheduler message
+	Message string
+}
+
+// schedulingReasons classifies scheduler messages, checked in order. Both the default scheduler
+// and kai-scheduler report these in the PodScheduled condition along with their FailedScheduling
+// and Unschedulable events.
+var schedulingReasons = []struct {
+	reason   string
+	keywords []string
+}{
+	{"QuotaExceeded", []string{"quota"}},
+	{"InsufficientGPU", []string{"insufficient nvidia.com/gpu", "insufficient amd.com/gpu", "insufficient gpu"}},
+	{"InsufficientResources", []string{"insufficient"}},
+	{"NodeSelectorMismatch", []string{"node affinity", "node selector", "nodeaffinity"}},
+	{"UntoleratedTaint", []string{"taint"}},
+}
+
+// diagnoseScheduling returns why the pending worker pods of a job cannot be scheduled, or nil
+// when no pod was rejected by the scheduler
+func diagnoseScheduling(job *torchrunv1alpha1.TorchrunJob, pods []corev1.Pod) *schedulingDiagnosis {
+	var unschedulable []*corev1.Pod
+	var schedulerMessage string
+	for i := range pods {
+		pod := &pods[i]
+		condition := getUnschedulableCondition(pod)
+		if condition == nil {
+			continue
+		}
+		unschedulable = append(unschedulable, pod)
+		if schedulerMessage == "" {
+			schedulerMessage = condition.Message
+		}
+	}
+	if len(unschedulable) == 0 {
+		return nil
+	}
+
+	reason := "Unschedulable"
+	lower := strings.ToLower(schedulerMessage)
+	for _, candidate := range schedulingReasons {
+		if containsAny(lower, candidate.keywords) {
+			reason = candidate.reason
+			break
+		}
+	}
+
+	summary := fmt.Sprintf("waiting for %s in queue %s", describeRequests(unschedulable), job.Spec.Queue)
+	message := fmt.Sprintf("%d of %d worker pods cannot be scheduled, %s", len(unschedulable), len(pods), summary)
+	if schedulerMessage != "" {
+		message = fmt.Sprintf("%s: %s", message, strings.TrimSpace(schedulerMessage))
+	}
+	return &schedulingDiagnosis{Reason: reason, Summary: summary, Message: message}
+}
+
+// getUnschedulableCondition returns the PodScheduled condition of a pending pod the scheduler
+// could not place, or nil
+func getUnschedulableCondition(pod *corev1.Pod) *corev1.PodCondition {
+	if pod.Status.Phase != corev1.PodPending || pod.Spec.NodeName != "" {
+		return nil
+	}
+	for i := range pod.Status.Conditions {
+		condition := &pod.Status.Conditions[i]
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			return condition
+		}
+	}
+	return nil
+}
+
+// describeRequests describes what the pods wait for: their GPUs, named by the GPU model the
+// pods select if any, or the pods themselves
+func describeRequests(pods []*corev1.Pod) string {
+	var gpus int64
+	resourceName := ""
+	for _, pod := range pods {
+		for _, container := range pod.Spec.Containers {
+			for name, quantity := range container.Resources.Limits {
+				if _, requested := container.Resources.Requests[name]; requested || !isGPUResource(name) {
+					continue
+				}
+				gpus += quantity.Value()
+				resourceName = string(name)
+			}
+			for name, quantity := range container.Resources.Requests {
+				if !isGPUResource(name) {
+					continue
+				}
+				gpus += quantity.Value()
+				resourceName = string(name)
+			}
+		}
+	}
+	if gpus == 0 {
+		return fmt.Sprintf("%d worker pods", len(pods))
+	}
+	if product := pods[0].Spec.NodeSelector[gpuProductLabel]; product != "" {
+		return fmt.Sprintf("%dx %s", gpus, product)
+	}
+	return fmt.Sprintf("%dx %s", gpus, resourceName)
+}
+
+// isGPUResource returns true for extended resources of GPU device plugins, e.g. nvidia.com/gpu
+func isGPUResource(name corev1.ResourceName) bool {
+	return strings.HasSuffix(string(name), "/gpu")
+}
+
+// containsAny returns true if s contains any of the substrings
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestDiagnoseScheduling(t *testing.T) {
+	job := &torchrunv1alpha1.TorchrunJob{Spec: torchrunv1alpha1.TorchrunJobSpec{Queue: "research"}}
+
+	// A worker pod requesting 8 GPUs
+	worker := func(name string, scheduled bool, message string, nodeSelector map[string]string) corev1.Pod {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PodSpec{
+				NodeSelector: nodeSelector,
+				Containers: []corev1.Container{{
+					Name: "trainer",
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("8")},
+					},
+				}},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodPending},
+		}
+		if scheduled {
+			pod.Spec.NodeName = "gpu-1"
+			return pod
+		}
+		pod.Status.Conditions = []corev1.PodCondition{{
+			Type:    corev1.PodScheduled,
+			Status:  corev1.ConditionFalse,
+			Reason:  corev1.PodReasonUnschedulable,
+			Message: message,
+		}}
+		return pod
+	}
+
+	tests := []struct {
+		description   string
+		pods          []corev1.Pod
+		expectReason  string
+		expectSummary string
+		expectMessage string
+	}{
+		{
+			description: "scheduled pods",
+			pods:        []corev1.Pod{worker("train-0", true, "", nil), worker("train-1", true, "", nil)},
+		},
+		{
+			description: "insufficient GPUs",
+			pods: []corev1.Pod{
+				worker("train-0", true, "", nil),
+				worker("train-1", false, "0/10 nodes are available: 10 Insufficient nvidia.com/gpu.", nil),
+				worker("train-2", false, "0/10 nodes are available: 10 Insufficient nvidia.com/gpu.", nil),
+			},
+			expectReason:  "InsufficientGPU",
+			expectSummary: "waiting for 16x nvidia.com/gpu in queue research",
+			expectMessage: "2 of 3 worker pods cannot be scheduled, waiting for 16x nvidia.com/gpu in queue research: " +
+				"0/10 nodes are available: 10 Insufficient nvidia.com/gpu.",
+		},
+		{
+			description:   "GPU model of the node selector",
+			pods:          []corev1.Pod{worker("train-0", false, "0/4 nodes are available: 4 Insufficient nvidia.com/gpu.", map[string]string{gpuProductLabel: "A100"})},
+			expectReason:  "InsufficientGPU",
+			expectSummary: "waiting for 8x A100 in queue research",
+		},
+		{
+			description:   "queue quota",
+			pods:          []corev1.Pod{worker("train-0", false, "Non-preemptible job requested more resources than the queue quota", nil)},
+			expectReason:  "QuotaExceeded",
+			expectSummary: "waiting for 8x nvidia.com/gpu in queue research",
+		},
+		{
+			description:   "node selector",
+			pods:          []corev1.Pod{worker("train-0", false, "0/4 nodes are available: 4 node(s) didn't match Pod's node affinity/selector.", nil)},
+			expectReason:  "NodeSelectorMismatch",
+			expectSummary: "waiting for 8x nvidia.com/gpu in queue research",
+		},
+		{
+			description:   "no scheduler message",
+			pods:          []corev1.Pod{worker("train-0", false, "", nil)},
+			expectReason:  "Unschedulable",
+			expectSummary: "waiting for 8x nvidia.com/gpu in queue research",
+			expectMessage: "1 of 1 worker pods cannot be scheduled, waiting for 8x nvidia.com/gpu in queue research",
+		},
+	}
+
+	for _, test := range tests {
+		diagnosis := diagnoseScheduling(job, test.pods)
+		if test.expectReason == "" {
+			if diagnosis != nil {
+				t.Errorf("%s: expected no diagnosis, got %+v", test.description, diagnosis)
+			}
+			continue
+		}
+		if diagnosis == nil {
+			t.Fatalf("%s: expected a diagnosis", test.description)
+		}
+		if diagnosis.Reason != test.expectReason || diagnosis.Summary != test.expectSummary {
+			t.Errorf("%s: expected %s %q, got %s %q", test.description, test.expectReason, test.expectSummary, diagnosis.Reason, diagnosis.Summary)
+		}
+		if test.expectMessage != "" && diagnosis.Message != test.expectMessage {
+			t.Errorf("%s: expected message %q, got %q", test.description, test.expectMessage, diagnosis.Message)
+		}
+	}
+}
+
+func TestUpdateSchedulingCondition(t *testing.T) {
+	sm := NewStatusManager(nil)
+	job := &torchrunv1alpha1.TorchrunJob{}
+
+	// No condition until a pod is unschedulable
+	sm.updateSchedulingCondition(job, nil)
+	if hasCondition(job, "WorkersScheduled") {
+		t.Fatalf("expected no WorkersScheduled condition, got %v", job.Status.Conditions)
+	}
+
+	sm.updateSchedulingCondition(job, &schedulingDiagnosis{Reason: "InsufficientGPU", Message: "waiting for GPUs"})
+	sm.updateSchedulingCondition(job, &schedulingDiagnosis{Reason: "QuotaExceeded", Message: "waiting for quota"})
+	condition := job.Status.Conditions[0]
+	if condition.Status != "False" || condition.Reason != "QuotaExceeded" || condition.Message != "waiting for quota" {
+		t.Errorf("expected the latest scheduler reason, got %+v", condition)
+	}
+
+	sm.updateSchedulingCondition(job, nil)
+	if !isConditionTrue(job, "WorkersScheduled") {
+		t.Errorf("expected the pods to be reported scheduled, got %v", job.Status.Conditions)
+	}
+}
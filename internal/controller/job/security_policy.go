@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// allCapabilities drops every capability of a container
+const allCapabilities corev1.Capability = "ALL"
+
+// attachSecurityPolicy force-applies the security policy of the queue to the pod and all of its
+// containers, over the pod template and the settings added by the controller. Capabilities added
+// by the template or the controller, e.g. IPC_LOCK for RDMA, are removed when dropped unless the
+// policy allows them.
+func attachSecurityPolicy(jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) {
+	policy := jq.Spec.SecurityPolicy
+	if policy == nil {
+		return
+	}
+
+	if podSpec.SecurityContext == nil {
+		podSpec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	podContext := podSpec.SecurityContext
+	if policy.RunAsNonRoot {
+		runAsNonRoot := true
+		podContext.RunAsNonRoot = &runAsNonRoot
+	}
+	if policy.RunAsUser != nil {
+		runAsUser := *policy.RunAsUser
+		podContext.RunAsUser = &runAsUser
+	}
+	if policy.FSGroup != nil {
+		fsGroup := *policy.FSGroup
+		podContext.FSGroup = &fsGroup
+	}
+	if policy.SeccompProfile != nil {
+		podContext.SeccompProfile = policy.SeccompProfile.DeepCopy()
+	}
+
+	for i := range podSpec.InitContainers {
+		applySecurityPolicy(policy, &podSpec.InitContainers[i])
+	}
+	for i := range podSpec.Containers {
+		applySecurityPolicy(policy, &podSpec.Containers[i])
+	}
+}
+
+// applySecurityPolicy enforces the security policy on the security context of a container, which
+// would otherwise override the pod security context
+func applySecurityPolicy(policy *torchrunv1alpha1.SecurityPolicy, container *corev1.Container) {
+	if container.SecurityContext == nil {
+		container.SecurityContext = &corev1.SecurityContext{}
+	}
+	sc := container.SecurityContext
+	if policy.RunAsNonRoot {
+		runAsNonRoot := true
+		sc.RunAsNonRoot = &runAsNonRoot
+	}
+	if policy.RunAsUser != nil {
+		runAsUser := *policy.RunAsUser
+		sc.RunAsUser = &runAsUser
+	} else if policy.RunAsNonRoot && sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+		sc.RunAsUser = nil
+	}
+	if policy.SeccompProfile != nil {
+		sc.SeccompProfile = policy.SeccompProfile.DeepCopy()
+	}
+	if policy.AllowPrivilegeEscalation != nil {
+		allowPrivilegeEscalation := *policy.AllowPrivilegeEscalation
+		sc.AllowPrivilegeEscalation = &allowPrivilegeEscalation
+		if !allowPrivilegeEscalation {
+			// Privileged containers always escalate
+			privileged := false
+			sc.Privileged = &privileged
+		}
+	}
+
+	if len(policy.DropCapabilities) > 0 {
+		if sc.Capabilities == nil {
+			sc.Capabilities = &corev1.Capabilities{}
+		}
+		for _, capability := range policy.DropCapabilities {
+			if !slices.Contains(sc.Capabilities.Drop, capability) {
+				sc.Capabilities.Drop = append(sc.Capabilities.Drop, capability)
+			}
+		}
+		dropAll := slices.Contains(policy.DropCapabilities, allCapabilities)
+		sc.Capabilities.Add = slices.DeleteFunc(sc.Capabilities.Add, func(capability corev1.Capability) bool {
+			dropped := dropAll || slices.Contains(policy.DropCapabilities, capability)
+			return dropped && !slices.Contains(policy.AllowedCapabilities, capability)
+		})
+	}
+
+	if policy.ReadOnlyRootFilesystem && !slices.Contains(policy.ReadOnlyRootFilesystemExceptions, container.Name) {
+		readOnlyRootFilesystem := true
+		sc.ReadOnlyRootFilesystem = &readOnlyRootFilesystem
+	}
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestAttachSecurityPolicy(t *testing.T) {
+	uid := int64(1000)
+	fsGroup := int64(2000)
+	noEscalation := false
+	restricted := &torchrunv1alpha1.SecurityPolicy{
+		RunAsNonRoot:                     true,
+		RunAsUser:                        &uid,
+		FSGroup:                          &fsGroup,
+		SeccompProfile:                   &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+		AllowPrivilegeEscalation:         &noEscalation,
+		DropCapabilities:                 []corev1.Capability{"ALL"},
+		AllowedCapabilities:              []corev1.Capability{"IPC_LOCK"},
+		ReadOnlyRootFilesystem:           true,
+		ReadOnlyRootFilesystemExceptions: []string{"trainer"},
+	}
+
+	tests := []struct {
+		description        string
+		policy             *torchrunv1alpha1.SecurityPolicy
+		patch              string
+		expectRunAsUser    *int64
+		expectAdd          []corev1.Capability
+		expectDrop         []corev1.Capability
+		expectPrivileged   bool
+		expectReadOnlyRoot map[string]bool
+	}{
+		{
+			description:        "queue without policy keeps the pod template",
+			expectAdd:          []corev1.Capability{"SYS_ADMIN", "IPC_LOCK"},
+			expectPrivileged:   true,
+			expectReadOnlyRoot: map[string]bool{"trainer": false, "logger": false},
+		},
+		{
+			description:        "policy is enforced on every container",
+			policy:             restricted,
+			expectRunAsUser:    &uid,
+			expectAdd:          []corev1.Capability{"IPC_LOCK"},
+			expectDrop:         []corev1.Capability{"ALL"},
+			expectReadOnlyRoot: map[string]bool{"trainer": false, "logger": true},
+		},
+		{
+			description:        "job patches cannot escape the policy",
+			policy:             restricted,
+			patch:              `{"containers":[{"name":"trainer","securityContext":{"runAsUser":0,"privileged":true}}]}`,
+			expectRunAsUser:    &uid,
+			expectAdd:          []corev1.Capability{"IPC_LOCK"},
+			expectDrop:         []corev1.Capability{"ALL"},
+			expectReadOnlyRoot: map[string]bool{"trainer": false, "logger": true},
+		},
+		{
+			description: "dropped capabilities are removed unless allowed",
+			policy: &torchrunv1alpha1.SecurityPolicy{
+				RunAsNonRoot:     true,
+				DropCapabilities: []corev1.Capability{"SYS_ADMIN", "NET_RAW"},
+			},
+			expectAdd:          []corev1.Capability{"IPC_LOCK"},
+			expectDrop:         []corev1.Capability{"SYS_ADMIN", "NET_RAW"},
+			expectPrivileged:   true,
+			expectReadOnlyRoot: map[string]bool{"trainer": false, "logger": false},
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{Spec: runtime.RawExtension{Raw: []byte(
+				`{"containers":[{"name":"trainer","image":"pytorch:2.2","securityContext":{"privileged":true,` +
+					`"capabilities":{"add":["SYS_ADMIN","IPC_LOCK"]}}},{"name":"logger","image":"fluent-bit"}]}`)}},
+			SecurityPolicy: test.policy,
+		}}
+		job := &torchrunv1alpha1.TorchrunJob{}
+		if test.patch != "" {
+			job.Spec.PodTemplatePatch = &torchrunv1alpha1.PodTemplatePatch{StrategicMerge: &runtime.RawExtension{Raw: []byte(test.patch)}}
+		}
+
+		podSpec, err := getPodSpec(job, jq)
+		if err != nil {
+			t.Fatalf("%s: getPodSpec() error = %v", test.description, err)
+		}
+		attachSecurityPolicy(jq, &podSpec)
+
+		if test.policy != nil {
+			if podSpec.SecurityContext == nil || podSpec.SecurityContext.RunAsNonRoot == nil || !*podSpec.SecurityContext.RunAsNonRoot {
+				t.Errorf("%s: expected the pod to run as non-root, got %+v", test.description, podSpec.SecurityContext)
+			}
+			if !reflect.DeepEqual(podSpec.SecurityContext.FSGroup, test.policy.FSGroup) {
+				t.Errorf("%s: expected fsGroup %v, got %v", test.description, test.policy.FSGroup, podSpec.SecurityContext.FSGroup)
+			}
+		}
+		trainer := podSpec.Containers[0].SecurityContext
+		if !reflect.DeepEqual(trainer.RunAsUser, test.expectRunAsUser) {
+			t.Errorf("%s: expected runAsUser %v, got %v", test.description, test.expectRunAsUser, trainer.RunAsUser)
+		}
+		if !reflect.DeepEqual(trainer.Capabilities.Add, test.expectAdd) {
+			t.Errorf("%s: expected added capabilities %v, got %v", test.description, test.expectAdd, trainer.Capabilities.Add)
+		}
+		if !reflect.DeepEqual(trainer.Capabilities.Drop, test.expectDrop) {
+			t.Errorf("%s: expected dropped capabilities %v, got %v", test.description, test.expectDrop, trainer.Capabilities.Drop)
+		}
+		if privileged := trainer.Privileged != nil && *trainer.Privileged; privileged != test.expectPrivileged {
+			t.Errorf("%s: expected privileged %v, got %v", test.description, test.expectPrivileged, privileged)
+		}
+		for _, container := range podSpec.Containers {
+			sc := container.SecurityContext
+			readOnly := sc != nil && sc.ReadOnlyRootFilesystem != nil && *sc.ReadOnlyRootFilesystem
+			if readOnly != test.expectReadOnlyRoot[container.Name] {
+				t.Errorf("%s: expected read-only root of %s %v, got %v", test.description, container.Name, test.expectReadOnlyRoot[container.Name], readOnly)
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// volumeSnapshotGVK is the VolumeSnapshot kind of the CSI external snapshotter, which is not
+// part of the core API
+var volumeSnapshotGVK = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshot"}
+
+// SnapshotResult is the state of the workspace snapshot of a finished job
+type SnapshotResult struct {
+	// Status of the WorkspaceSnapshotted condition: Unknown until the snapshot is ready to use,
+	// then True or False
+	Status string
+
+	// Reason is a machine-readable reason for the state
+	Reason string
+
+	// Message is a human-readable explanation of the state
+	Message string
+
+	// Name of the VolumeSnapshot, set once it was created
+	Name string
+}
+
+// SnapshotManager takes VolumeSnapshots of the workspaces of finished jobs
+type SnapshotManager struct {
+	client client.Client
+}
+
+// NewSnapshotManager creates a new snapshot manager
+func NewSnapshotManager(client client.Client) *SnapshotManager {
+	return &SnapshotManager{
+		client: client,
+	}
+}
+
+// SnapshotWorkspace creates the VolumeSnapshot of the workspace PVC of a finished job and reports
+// its state. It returns nil for jobs that are not finished, whose queue and job do not snapshot
+// their workspace or have no workspace PVC, and whose snapshot already finished. The snapshot is
+// not owned by the job, so it outlives the job and its workspace.
+func (sm *SnapshotManager) SnapshotWorkspace(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*SnapshotResult, error) {
+	config := getWorkspaceSnapshotConfig(job, jq)
+	if config == nil || !shouldSnapshotWorkspace(job.Status.Phase, config.When) || isEphemeralWorkspace(job, jq) || isWorkspaceSnapshotFinished(job) {
+		return nil, nil
+	}
+	name := GetWorkspaceSnapshotName(job)
+
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	err := sm.client.Get(ctx, types.NamespacedName{Name: name, Namespace: job.Namespace}, snapshot)
+	if meta.IsNoMatchError(err) {
+		return &SnapshotResult{Status: "False", Reason: "SnapshotsUnavailable", Message: "The cluster does not serve VolumeSnapshots of snapshot.storage.k8s.io/v1"}, nil
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if errors.IsNotFound(err) {
+		pvc := &corev1.PersistentVolumeClaim{}
+		err := sm.client.Get(ctx, types.NamespacedName{Name: GetWorkspacePVCName(job), Namespace: job.Namespace}, pvc)
+		if errors.IsNotFound(err) {
+			return &SnapshotResult{Status: "False", Reason: "NoWorkspace", Message: fmt.Sprintf("Workspace PVC %s to snapshot not found", GetWorkspacePVCName(job))}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		snapshot = buildWorkspaceSnapshot(job, config, pvc.Name)
+		log.FromContext(ctx).Info("Creating workspace snapshot", "name", name, "pvc", pvc.Name)
+		if err := sm.client.Create(ctx, snapshot); err != nil && !errors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		return &SnapshotResult{Status: "Unknown", Reason: "Snapshotting", Message: fmt.Sprintf("Taking VolumeSnapshot %s of workspace PVC %s", name, pvc.Name), Name: name}, nil
+	}
+
+	if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found {
+		return &SnapshotResult{Status: "False", Reason: "SnapshotFailed", Message: fmt.Sprintf("VolumeSnapshot %s failed: %s", name, message), Name: name}, nil
+	}
+	if ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse"); ready {
+		return &SnapshotResult{Status: "True", Reason: "SnapshotReady", Message: fmt.Sprintf("Workspace snapshotted to VolumeSnapshot %s", name), Name: name}, nil
+	}
+	return &SnapshotResult{Status: "Unknown", Reason: "Snapshotting", Message: fmt.Sprintf("Taking VolumeSnapshot %s of workspace PVC %s", name, GetWorkspacePVCName(job)), Name: name}, nil
+}
+
+// buildWorkspaceSnapshot builds the VolumeSnapshot of the workspace PVC of a job. The labels and
+// annotations record the job it was taken of and where that job's workspace came from.
+func buildWorkspaceSnapshot(job *torchrunv1alpha1.TorchrunJob, config *torchrunv1alpha1.WorkspaceSnapshotConfig, pvcName string) *unstructured.Unstructured {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	snapshot.SetName(GetWorkspaceSnapshotName(job))
+	snapshot.SetNamespace(job.Namespace)
+	snapshot.SetLabels(map[string]string{
+		"torchrun.ai/type":      "workspace-snapshot",
+		"torchrun.ai/job-name":  job.Spec.JobName,
+		"torchrun.ai/job-id":    job.Spec.JobID,
+		"torchrun.ai/job-queue": job.Spec.Queue,
+		"torchrun.ai/phase":     job.Status.Phase,
+	})
+	annotations := map[string]string{
+		"torchrun.ai/torchrunjob": job.Name,
+		"torchrun.ai/command":     job.Spec.Command,
+	}
+	if job.Spec.Image != "" {
+		annotations["torchrun.ai/image"] = job.Spec.Image
+	}
+	if job.Spec.SnapshotRef != nil {
+		annotations["torchrun.ai/restored-from"] = job.Spec.SnapshotRef.Name
+	}
+	if job.Spec.CloneFrom != nil {
+		annotations["torchrun.ai/cloned-from"] = job.Spec.CloneFrom.Name
+	}
+	snapshot.SetAnnotations(annotations)
+
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{"persistentVolumeClaimName": pvcName},
+	}
+	if config.VolumeSnapshotClassName != "" {
+		spec["volumeSnapshotClassName"] = config.VolumeSnapshotClassName
+	}
+	snapshot.Object["spec"] = spec
+	return snapshot
+}
+
+// getWorkspaceSnapshotConfig returns the snapshot settings with the job overriding the queue
+// field by field, or nil if neither snapshots the workspace
+func getWorkspaceSnapshotConfig(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) *torchrunv1alpha1.WorkspaceSnapshotConfig {
+	var config *torchrunv1alpha1.WorkspaceSnapshotConfig
+	for _, override := range []*torchrunv1alpha1.WorkspaceSnapshotConfig{jq.Spec.WorkspaceStorage.Snapshot, job.Spec.WorkspaceStorage.Snapshot} {
+		if override == nil {
+			continue
+		}
+		if config == nil {
+			config = &torchrunv1alpha1.WorkspaceSnapshotConfig{When: "Succeeded"}
+		}
+		if override.When != "" {
+			config.When = override.When
+		}
+		if override.VolumeSnapshotClassName != "" {
+			config.VolumeSnapshotClassName = override.VolumeSnapshotClassName
+		}
+	}
+	return config
+}
+
+// shouldSnapshotWorkspace returns true if a job in phase is snapshotted when its snapshot config
+// says when
+func shouldSnapshotWorkspace(phase, when string) bool {
+	switch when {
+	case "Succeeded":
+		return phase == torchrunv1alpha1.PhaseSucceeded
+	case "Finished":
+		return phase == torchrunv1alpha1.PhaseSucceeded || phase == torchrunv1alpha1.PhaseFailed
+	}
+	return false
+}
+
+// isWorkspaceSnapshotFinished returns true if the workspace snapshot of the job is ready or failed
+func isWorkspaceSnapshotFinished(job *torchrunv1alpha1.TorchrunJob) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == "WorkspaceSnapshotted" {
+			return condition.Status != "Unknown"
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestSnapshotWorkspace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	workspace := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "llama-workspace", Namespace: "default"}}
+	// The snapshot of the job with the given status
+	snapshot := func(status map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{"status": status}}
+		obj.SetGroupVersionKind(volumeSnapshotGVK)
+		obj.SetName("train-workspace-train-ui")
+		obj.SetNamespace("default")
+		return obj
+	}
+
+	tests := []struct {
+		description   string
+		phase         string
+		queueSnapshot *torchrunv1alpha1.WorkspaceSnapshotConfig
+		jobSnapshot   *torchrunv1alpha1.WorkspaceSnapshotConfig
+		existing      []client.Object
+		expectResult  bool
+		expectStatus  string
+		expectReason  string
+		expectCreated bool
+	}{
+		{
+			description: "queue without snapshots",
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+			existing:    []client.Object{workspace.DeepCopy()},
+		},
+		{
+			description:   "running job is not snapshotted",
+			phase:         torchrunv1alpha1.PhaseRunning,
+			queueSnapshot: &torchrunv1alpha1.WorkspaceSnapshotConfig{},
+			existing:      []client.Object{workspace.DeepCopy()},
+		},
+		{
+			description:   "failed job is not snapshotted by default",
+			phase:         torchrunv1alpha1.PhaseFailed,
+			queueSnapshot: &torchrunv1alpha1.WorkspaceSnapshotConfig{},
+			existing:      []client.Object{workspace.DeepCopy()},
+		},
+		{
+			description:   "job opts out of the snapshots of its queue",
+			phase:         torchrunv1alpha1.PhaseSucceeded,
+			queueSnapshot: &torchrunv1alpha1.WorkspaceSnapshotConfig{VolumeSnapshotClassName: "csi-rbd"},
+			jobSnapshot:   &torchrunv1alpha1.WorkspaceSnapshotConfig{When: "Never"},
+			existing:      []client.Object{workspace.DeepCopy()},
+		},
+		{
+			description:   "succeeded job is snapshotted",
+			phase:         torchrunv1alpha1.PhaseSucceeded,
+			queueSnapshot: &torchrunv1alpha1.WorkspaceSnapshotConfig{VolumeSnapshotClassName: "csi-rbd"},
+			existing:      []client.Object{workspace.DeepCopy()},
+			expectResult:  true,
+			expectStatus:  "Unknown",
+			expectReason:  "Snapshotting",
+			expectCreated: true,
+		},
+		{
+			description:   "failed job is snapshotted once finished",
+			phase:         torchrunv1alpha1.PhaseFailed,
+			jobSnapshot:   &torchrunv1alpha1.WorkspaceSnapshotConfig{When: "Finished"},
+			existing:      []client.Object{workspace.DeepCopy()},
+			expectResult:  true,
+			expectStatus:  "Unknown",
+			expectReason:  "Snapshotting",
+			expectCreated: true,
+		},
+		{
+			description:  "workspace already collected",
+			phase:        torchrunv1alpha1.PhaseSucceeded,
+			jobSnapshot:  &torchrunv1alpha1.WorkspaceSnapshotConfig{},
+			expectResult: true,
+			expectStatus: "False",
+			expectReason: "NoWorkspace",
+		},
+		{
+			description:  "snapshot ready to use",
+			phase:        torchrunv1alpha1.PhaseSucceeded,
+			jobSnapshot:  &torchrunv1alpha1.WorkspaceSnapshotConfig{},
+			existing:     []client.Object{workspace.DeepCopy(), snapshot(map[string]interface{}{"readyToUse": true})},
+			expectResult: true,
+			expectStatus: "True",
+			expectReason: "SnapshotReady",
+		},
+		{
+			description: "snapshot failed",
+			phase:       torchrunv1alpha1.PhaseSucceeded,
+			jobSnapshot: &torchrunv1alpha1.WorkspaceSnapshotConfig{},
+			existing: []client.Object{workspace.DeepCopy(), snapshot(map[string]interface{}{
+				"readyToUse": false,
+				"error":      map[string]interface{}{"message": "snapshot class not found"},
+			})},
+			expectResult: true,
+			expectStatus: "False",
+			expectReason: "SnapshotFailed",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default", UID: "train-uid"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				JobName:          "llama",
+				JobID:            "llama-1",
+				Queue:            "research",
+				Command:          "python train.py",
+				SnapshotRef:      &corev1.LocalObjectReference{Name: "llama-pretrained"},
+				WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{Snapshot: test.jobSnapshot},
+			},
+			Status: torchrunv1alpha1.TorchrunJobStatus{Phase: test.phase},
+		}
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			Spec: torchrunv1alpha1.JobQueueSpec{
+				WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{Snapshot: test.queueSnapshot},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(test.existing...).Build()
+
+		result, err := NewSnapshotManager(c).SnapshotWorkspace(context.Background(), job, jq)
+		if err != nil {
+			t.Fatalf("%s: SnapshotWorkspace() error = %v", test.description, err)
+		}
+		if (result != nil) != test.expectResult {
+			t.Errorf("%s: expected result %v, got %v", test.description, test.expectResult, result)
+			continue
+		}
+		if result != nil && (result.Status != test.expectStatus || result.Reason != test.expectReason) {
+			t.Errorf("%s: expected %s %s, got %s %s", test.description, test.expectStatus, test.expectReason, result.Status, result.Reason)
+		}
+		if !test.expectCreated {
+			continue
+		}
+
+		created := &unstructured.Unstructured{}
+		created.SetGroupVersionKind(volumeSnapshotGVK)
+		if err := c.Get(context.Background(), types.NamespacedName{Name: GetWorkspaceSnapshotName(job), Namespace: "default"}, created); err != nil {
+			t.Fatalf("%s: failed to get snapshot: %v", test.description, err)
+		}
+		if source, _, _ := unstructured.NestedString(created.Object, "spec", "source", "persistentVolumeClaimName"); source != "llama-workspace" {
+			t.Errorf("%s: expected a snapshot of llama-workspace, got %q", test.description, source)
+		}
+		class, _, _ := unstructured.NestedString(created.Object, "spec", "volumeSnapshotClassName")
+		if expected := getWorkspaceSnapshotConfig(job, jq).VolumeSnapshotClassName; class != expected {
+			t.Errorf("%s: expected snapshot class %q, got %q", test.description, expected, class)
+		}
+		if labels := created.GetLabels(); labels["torchrun.ai/job-id"] != "llama-1" || labels["torchrun.ai/phase"] != test.phase {
+			t.Errorf("%s: expected the job id and phase labels, got %v", test.description, labels)
+		}
+		if restoredFrom := created.GetAnnotations()["torchrun.ai/restored-from"]; restoredFrom != "llama-pretrained" {
+			t.Errorf("%s: expected the snapshot to record it was restored from llama-pretrained, got %q", test.description, restoredFrom)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// maxSpecChanges is the number of spec changes kept in the status of a job
+const maxSpecChanges = 10
+
+// recordSpecChange records in the status of the job which top-level spec fields changed since the
+// generation the controller last observed, and which field manager changed them when. The first
+// observation of a job records its spec without a change.
+func recordSpecChange(job *torchrunv1alpha1.TorchrunJob, now time.Time) error {
+	if job.Generation != 0 && job.Generation == job.Status.ObservedGeneration {
+		return nil
+	}
+	hashes, err := getSpecFieldHashes(&job.Spec)
+	if err != nil {
+		return err
+	}
+
+	if job.Status.ObservedGeneration != 0 {
+		if fields := getChangedSpecFields(job.Status.SpecFieldHashes, hashes); len(fields) > 0 {
+			change := torchrunv1alpha1.SpecChange{
+				Generation: job.Generation,
+				Time:       metav1.NewTime(now),
+				Fields:     fields,
+				Phase:      job.Status.Phase,
+			}
+			if entry := getSpecEditor(job.ManagedFields, fields); entry != nil {
+				change.Manager = entry.Manager
+				change.Operation = string(entry.Operation)
+				if entry.Time != nil {
+					change.Time = *entry.Time
+				}
+			}
+			job.Status.SpecChanges = append(job.Status.SpecChanges, change)
+			if len(job.Status.SpecChanges) > maxSpecChanges {
+				job.Status.SpecChanges = job.Status.SpecChanges[len(job.Status.SpecChanges)-maxSpecChanges:]
+			}
+		}
+	}
+	job.Status.ObservedGeneration = job.Generation
+	job.Status.SpecFieldHashes = hashes
+	return nil
+}
+
+// getSpecFieldHashes returns the hashes of the top-level fields of the spec by their JSON name.
+// Unset fields are left out.
+func getSpecFieldHashes(spec *torchrunv1alpha1.TorchrunJobSpec) (map[string]string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, len(fields))
+	for name, value := range fields {
+		h := fnv.New64a()
+		h.Write(value)
+		hashes[name] = fmt.Sprintf("%016x", h.Sum64())
+	}
+	return hashes, nil
+}
+
+// getChangedSpecFields returns the sorted fields that were set, changed or removed between the
+// previous and the current hashes
+func getChangedSpecFields(previous, current map[string]string) []string {
+	var fields []string
+	for name, hash := range current {
+		if previous[name] != hash {
+			fields = append(fields, name)
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// getSpecEditor returns the latest managed fields entry owning one of the changed spec fields.
+// Removed fields are owned by no one, so without such an entry the latest entry owning any spec
+// field is returned.
+func getSpecEditor(managedFields []metav1.ManagedFieldsEntry, fields []string) *metav1.ManagedFieldsEntry {
+	var editor, fallback *metav1.ManagedFieldsEntry
+	for i := range managedFields {
+		entry := &managedFields[i]
+		if entry.Subresource != "" {
+			continue
+		}
+		owned := getOwnedSpecFields(entry)
+		if len(owned) == 0 {
+			continue
+		}
+		if isLaterEntry(entry, fallback) {
+			fallback = entry
+		}
+		for _, field := range fields {
+			if owned[field] && isLaterEntry(entry, editor) {
+				editor = entry
+				break
+			}
+		}
+	}
+	if editor != nil {
+		return editor
+	}
+	return fallback
+}
+
+// getOwnedSpecFields returns the top-level spec fields a managed fields entry owns
+func getOwnedSpecFields(entry *metav1.ManagedFieldsEntry) map[string]bool {
+	if entry.FieldsV1 == nil {
+		return nil
+	}
+	var fieldSet struct {
+		Spec map[string]json.RawMessage `json:"f:spec"`
+	}
+	if err := json.Unmarshal(entry.FieldsV1.Raw, &fieldSet); err != nil {
+		return nil
+	}
+	owned := make(map[string]bool, len(fieldSet.Spec))
+	for key := range fieldSet.Spec {
+		if name, ok := strings.CutPrefix(key, "f:"); ok {
+			owned[name] = true
+		}
+	}
+	return owned
+}
+
+// isLaterEntry returns true if entry was written after other, or other is nil
+func isLaterEntry(entry, other *metav1.ManagedFieldsEntry) bool {
+	if other == nil {
+		return true
+	}
+	if entry.Time == nil || other.Time == nil {
+		return other.Time == nil
+	}
+	return !entry.Time.Before(other.Time)
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestRecordSpecChange(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	created := metav1.NewTime(now.Add(-time.Hour))
+	edited := metav1.NewTime(now.Add(-time.Minute))
+	entry := func(manager string, time *metav1.Time, fields string) metav1.ManagedFieldsEntry {
+		return metav1.ManagedFieldsEntry{
+			Manager:    manager,
+			Operation:  metav1.ManagedFieldsOperationUpdate,
+			Time:       time,
+			FieldsType: "FieldsV1",
+			FieldsV1:   &metav1.FieldsV1{Raw: []byte(fmt.Sprintf(`{"f:spec":{%s}}`, fields))},
+		}
+	}
+
+	observed := torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", JobName: "llama", Command: "python train.py", NumNodes: 2}
+	hashes, err := getSpecFieldHashes(&observed)
+	if err != nil {
+		t.Fatalf("getSpecFieldHashes() error = %v", err)
+	}
+
+	tests := []struct {
+		description   string
+		generation    int64
+		observed      int64
+		spec          torchrunv1alpha1.TorchrunJobSpec
+		managedFields []metav1.ManagedFieldsEntry
+		previous      []torchrunv1alpha1.SpecChange
+		expectChanges []torchrunv1alpha1.SpecChange
+	}{
+		{
+			description: "first observation records no change",
+			generation:  1,
+			spec:        observed,
+		},
+		{
+			description: "observed generation is not recorded again",
+			generation:  1,
+			observed:    1,
+			spec:        torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", JobName: "llama", Command: "python finetune.py", NumNodes: 2},
+		},
+		{
+			description: "edit records the changed fields and their manager",
+			generation:  2,
+			observed:    1,
+			spec:        torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", JobName: "llama", Command: "python finetune.py", NumNodes: 4},
+			managedFields: []metav1.ManagedFieldsEntry{
+				entry("kubectl-client-side-apply", &created, `"f:queue":{},"f:jobName":{},"f:command":{},"f:numNodes":{}`),
+				entry("kubectl-edit", &edited, `"f:command":{},"f:numNodes":{}`),
+			},
+			expectChanges: []torchrunv1alpha1.SpecChange{
+				{Generation: 2, Time: edited, Manager: "kubectl-edit", Operation: "Update", Fields: []string{"command", "numNodes"}, Phase: torchrunv1alpha1.PhaseRunning},
+			},
+		},
+		{
+			description: "removed field is recorded with the latest spec manager",
+			generation:  3,
+			observed:    1,
+			spec:        torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", JobName: "llama", NumNodes: 2},
+			managedFields: []metav1.ManagedFieldsEntry{
+				entry("kubectl-client-side-apply", &created, `"f:queue":{},"f:jobName":{},"f:numNodes":{}`),
+			},
+			expectChanges: []torchrunv1alpha1.SpecChange{
+				{Generation: 3, Time: created, Manager: "kubectl-client-side-apply", Operation: "Update", Fields: []string{"command"}, Phase: torchrunv1alpha1.PhaseRunning},
+			},
+		},
+		{
+			description: "change without managed fields is recorded at the time it was observed",
+			generation:  2,
+			observed:    1,
+			spec:        torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", JobName: "llama", Command: "python train.py", NumNodes: 2, Suspend: true},
+			expectChanges: []torchrunv1alpha1.SpecChange{
+				{Generation: 2, Time: metav1.NewTime(now), Fields: []string{"suspend"}, Phase: torchrunv1alpha1.PhaseRunning},
+			},
+		},
+		{
+			description: "only the latest changes are kept",
+			generation:  12,
+			observed:    11,
+			spec:        torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", JobName: "llama", Command: "python train.py", NumNodes: 8},
+			previous: []torchrunv1alpha1.SpecChange{
+				{Generation: 2}, {Generation: 3}, {Generation: 4}, {Generation: 5}, {Generation: 6},
+				{Generation: 7}, {Generation: 8}, {Generation: 9}, {Generation: 10}, {Generation: 11},
+			},
+			expectChanges: []torchrunv1alpha1.SpecChange{
+				{Generation: 3}, {Generation: 4}, {Generation: 5}, {Generation: 6}, {Generation: 7},
+				{Generation: 8}, {Generation: 9}, {Generation: 10}, {Generation: 11},
+				{Generation: 12, Time: metav1.NewTime(now), Fields: []string{"numNodes"}, Phase: torchrunv1alpha1.PhaseRunning},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "llama", Namespace: "default", Generation: test.generation, ManagedFields: test.managedFields},
+			Spec:       test.spec,
+			Status: torchrunv1alpha1.TorchrunJobStatus{
+				Phase:              torchrunv1alpha1.PhaseRunning,
+				ObservedGeneration: test.observed,
+				SpecChanges:        test.previous,
+			},
+		}
+		if test.observed != 0 {
+			job.Status.SpecFieldHashes = hashes
+		}
+
+		if err := recordSpecChange(job, now); err != nil {
+			t.Fatalf("%s: recordSpecChange() error = %v", test.description, err)
+		}
+		if !reflect.DeepEqual(job.Status.SpecChanges, test.expectChanges) {
+			t.Errorf("%s: expected changes %+v, got %+v", test.description, test.expectChanges, job.Status.SpecChanges)
+		}
+		if job.Status.ObservedGeneration != test.generation {
+			t.Errorf("%s: expected observed generation %d, got %d", test.description, test.generation, job.Status.ObservedGeneration)
+		}
+		// The next edit is compared with the spec of this generation
+		if test.generation != test.observed {
+			expected, _ := getSpecFieldHashes(&job.Spec)
+			if !reflect.DeepEqual(job.Status.SpecFieldHashes, expected) {
+				t.Errorf("%s: expected the hashes of the current spec, got %v", test.description, job.Status.SpecFieldHashes)
+			}
+		}
+	}
+}
@@ -3,6 +3,9 @@ package controller
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
+	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
@@ -11,7 +14,8 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
-	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/internal/v1alpha1"
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/patch"
 )
 
 // StatusManager handles status updates and condition management
@@ -26,8 +30,17 @@ func NewStatusManager(client client.Client) *StatusManager {
 	}
 }
 
-// UpdateStatus updates the TorchrunJob status
-func (sm *StatusManager) UpdateStatus(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) error {
+// UpdateStatus updates the TorchrunJob status and patches the changes since base, the job as
+// it was read
+func (sm *StatusManager) UpdateStatus(ctx context.Context, job, base *torchrunv1alpha1.TorchrunJob) error {
+	if err := sm.updateStatus(ctx, job); err != nil {
+		return err
+	}
+	return patch.Status(ctx, sm.client, job, base)
+}
+
+// updateStatus determines the phase of the job from its Kubernetes Job or workspace
+func (sm *StatusManager) updateStatus(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) error {
 	// First, check for deletion
 	if job.DeletionTimestamp != nil {
 		return sm.updatePhase(ctx, job, torchrunv1alpha1.PhaseDeleted)
@@ -35,7 +48,7 @@ func (sm *StatusManager) UpdateStatus(ctx context.Context, job *torchrunv1alpha1
 
 	// Get the underlying Kubernetes Job
 	k8sJob := &batchv1.Job{}
-	err := sm.client.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, k8sJob)
+	err := sm.client.Get(ctx, types.NamespacedName{Name: GetJobName(job), Namespace: job.Namespace}, k8sJob)
 
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -72,13 +85,29 @@ func (sm *StatusManager) updatePreJobPhase(ctx context.Context, job *torchrunv1a
 func (sm *StatusManager) updateJobPhase(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, k8sJob *batchv1.Job) error {
 	var phase string
 
+	// Nodes of the existing Job, which lag behind a resize of the spec until the Job is recreated
+	if k8sJob.Spec.Parallelism != nil {
+		job.Status.NumNodes = int(*k8sJob.Spec.Parallelism)
+	}
+
 	// Update worker counts from K8s Job
 	job.Status.Workers.Running = k8sJob.Status.Active
 	job.Status.Workers.Succeeded = k8sJob.Status.Succeeded
 	job.Status.Workers.Failed = k8sJob.Status.Failed
 
+	// Update per-worker details from the pods
+	pods, diagnosis, err := sm.updateWorkerPods(ctx, job)
+	if err != nil {
+		return err
+	}
+	sm.updateSchedulingCondition(job, diagnosis)
+
 	// Determine phase based on Job status
+	failed := getJobFailedCondition(k8sJob)
 	switch {
+	case failed != nil && failed.Reason == batchv1.JobReasonDeadlineExceeded:
+		phase = torchrunv1alpha1.PhaseTimedOut
+
 	case k8sJob.Spec.Suspend != nil && *k8sJob.Spec.Suspend:
 		phase = torchrunv1alpha1.PhaseSuspended
 
@@ -118,23 +147,300 @@ func (sm *StatusManager) updateJobPhase(ctx context.Context, job *torchrunv1alph
 	} else {
 		job.Status.WorkersStatus = fmt.Sprintf("%d/%d ready", job.Status.Workers.Ready, job.Status.NumNodes)
 	}
+	if diagnosis != nil {
+		job.Status.WorkersStatus += ", " + diagnosis.Summary
+	}
+
+	recordExitInfo(job, pods, phase)
+	sm.updateStartTime(job, k8sJob, phase, time.Now())
+	sm.updateDeadline(job, k8sJob, phase, time.Now())
 
 	return sm.updatePhase(ctx, job, phase)
 }
 
+// updateStartTime records when the workers of the job first ran. Jobs that finished before a
+// reconcile saw them running start with their Kubernetes Job.
+func (sm *StatusManager) updateStartTime(job *torchrunv1alpha1.TorchrunJob, k8sJob *batchv1.Job, phase string, now time.Time) {
+	if job.Status.StartTime != nil {
+		return
+	}
+	switch phase {
+	case torchrunv1alpha1.PhaseRunning:
+		job.Status.StartTime = &metav1.Time{Time: now}
+	case torchrunv1alpha1.PhaseSucceeded, torchrunv1alpha1.PhaseFailed, torchrunv1alpha1.PhaseTimedOut:
+		job.Status.StartTime = k8sJob.Status.StartTime
+	}
+}
+
+// updateDeadline records when the active deadline of the Job ends and warns with the
+// DeadlineApproaching condition once the job used deadlineWarningPercent of it. A Job killed by
+// the deadline sets the Failed condition with reason DeadlineExceeded.
+func (sm *StatusManager) updateDeadline(job *torchrunv1alpha1.TorchrunJob, k8sJob *batchv1.Job, phase string, now time.Time) {
+	deadline := k8sJob.Spec.ActiveDeadlineSeconds
+	if phase == torchrunv1alpha1.PhaseTimedOut {
+		job.Status.DeadlineTime = nil
+		failed := getJobFailedCondition(k8sJob)
+		if job.Status.CompletionTime == nil && !failed.LastTransitionTime.IsZero() {
+			job.Status.CompletionTime = &failed.LastTransitionTime
+		}
+		message := "Job was active longer than its active deadline"
+		if deadline != nil {
+			message = fmt.Sprintf("Job was active longer than its active deadline of %ds", *deadline)
+		}
+		sm.UpdateCondition(job, "Failed", "True", batchv1.JobReasonDeadlineExceeded, message)
+		return
+	}
+
+	// The deadline of a suspended Job starts over when it is resumed
+	if deadline == nil || k8sJob.Status.StartTime == nil || phase == torchrunv1alpha1.PhaseSuspended || isJobFinished(k8sJob) {
+		job.Status.DeadlineTime = nil
+		return
+	}
+	budget := time.Duration(*deadline) * time.Second
+	start := k8sJob.Status.StartTime.Time
+	end := start.Add(budget)
+	job.Status.DeadlineTime = &metav1.Time{Time: end}
+
+	percent := getDeadlineWarningPercent(job)
+	if warnAt := start.Add(budget * time.Duration(percent) / 100); !now.Before(warnAt) {
+		sm.UpdateCondition(job, "DeadlineApproaching", "True", "DeadlineWarning",
+			fmt.Sprintf("Job used %d%% of its active deadline of %ds and times out at %s", percent, *deadline, end.UTC().Format(time.RFC3339)))
+	} else if hasCondition(job, "DeadlineApproaching") {
+		// The deadline was extended
+		sm.UpdateCondition(job, "DeadlineApproaching", "False", "WithinDeadline",
+			fmt.Sprintf("Job times out at %s", end.UTC().Format(time.RFC3339)))
+	}
+}
+
+// updateWorkerPods lists the worker pods of the job and records their details and GPU time and
+// the pending and ready counts, which the K8s Job status does not report. It returns the pods and
+// why pending pods cannot be scheduled, if the scheduler rejected any.
+func (sm *StatusManager) updateWorkerPods(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) ([]v1.Pod, *schedulingDiagnosis, error) {
+	now := time.Now()
+	pods := &v1.PodList{}
+	if err := sm.client.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{
+		"app":                "torchrun",
+		"torchrun.ai/job-id": job.Spec.JobID,
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	// The rendezvous state is read from the logs, only until the worker joined
+	rendezvous := make(map[string]string, len(job.Status.Workers.Pods))
+	for _, worker := range job.Status.Workers.Pods {
+		rendezvous[worker.Name] = worker.Rendezvous
+	}
+
+	workers := make([]torchrunv1alpha1.WorkerPodStatus, 0, len(pods.Items))
+	var pending, ready int32
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == v1.PodPending {
+			pending++
+		}
+		if isPodReady(pod) {
+			ready++
+		}
+		worker := buildWorkerPodStatus(pod)
+		worker.GPUSeconds = getPodGPUSeconds(pod, now)
+		worker.Rendezvous = rendezvous[pod.Name]
+		workers = append(workers, worker)
+		if trackingURL := pod.Annotations[TrackingURLAnnotation]; trackingURL != "" {
+			job.Status.TrackingURL = trackingURL
+		}
+	}
+
+	sort.Slice(workers, func(i, j int) bool {
+		if workers[i].Index != workers[j].Index {
+			return workers[i].Index < workers[j].Index
+		}
+		return workers[i].Name < workers[j].Name
+	})
+
+	updateGPUSeconds(job, workers)
+	recordSuspectNodes(job, pods.Items, now)
+	job.Status.Workers.Pending = pending
+	job.Status.Workers.Ready = ready
+	job.Status.Workers.Pods = workers
+	return pods.Items, diagnoseScheduling(job, pods.Items), nil
+}
+
+// updateSchedulingCondition reports why worker pods cannot be scheduled in the WorkersScheduled
+// condition. Its reason and message follow the scheduler while the pods stay unschedulable.
+func (sm *StatusManager) updateSchedulingCondition(job *torchrunv1alpha1.TorchrunJob, diagnosis *schedulingDiagnosis) {
+	if diagnosis == nil {
+		if hasCondition(job, "WorkersScheduled") {
+			sm.UpdateCondition(job, "WorkersScheduled", "True", "Scheduled", "All worker pods are scheduled")
+		}
+		return
+	}
+
+	sm.UpdateCondition(job, "WorkersScheduled", "False", diagnosis.Reason, diagnosis.Message)
+	for i := range job.Status.Conditions {
+		if job.Status.Conditions[i].Type == "WorkersScheduled" {
+			job.Status.Conditions[i].Reason = diagnosis.Reason
+			job.Status.Conditions[i].Message = diagnosis.Message
+		}
+	}
+}
+
+// buildWorkerPodStatus summarizes a worker pod
+func buildWorkerPodStatus(pod *v1.Pod) torchrunv1alpha1.WorkerPodStatus {
+	worker := torchrunv1alpha1.WorkerPodStatus{
+		Name:      pod.Name,
+		NodeName:  pod.Spec.NodeName,
+		Phase:     string(pod.Status.Phase),
+		LastError: podLastError(pod),
+	}
+
+	// Indexed Jobs record the rank of each pod in this annotation
+	if index, err := strconv.Atoi(pod.Annotations[batchv1.JobCompletionIndexAnnotation]); err == nil {
+		worker.Index = int32(index)
+	}
+
+	for _, status := range pod.Status.InitContainerStatuses {
+		worker.RestartCount += status.RestartCount
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		worker.RestartCount += status.RestartCount
+	}
+
+	return worker
+}
+
+// podLastError returns the most relevant error of a pod, or an empty string if it is healthy
+func podLastError(pod *v1.Pod) string {
+	if pod.Status.Phase == v1.PodSucceeded {
+		return ""
+	}
+
+	// Pod level failures, e.g. evictions
+	if pod.Status.Reason != "" {
+		return fmt.Sprintf("%s: %s", pod.Status.Reason, pod.Status.Message)
+	}
+
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		// Containers stuck waiting, e.g. CrashLoopBackOff or ImagePullBackOff
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason != "ContainerCreating" && waiting.Reason != "PodInitializing" {
+			return fmt.Sprintf("container %s: %s: %s", status.Name, waiting.Reason, waiting.Message)
+		}
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return fmt.Sprintf("container %s exited with code %d: %s", status.Name, terminated.ExitCode, terminated.Reason)
+		}
+		if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return fmt.Sprintf("container %s exited with code %d: %s", status.Name, terminated.ExitCode, terminated.Reason)
+		}
+	}
+
+	// Pods that cannot be scheduled
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse {
+			return fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+		}
+	}
+
+	return ""
+}
+
+// isPodReady reports whether the pod has the Ready condition
+func isPodReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
 // updatePhase updates the job phase and last reconcile time
 func (sm *StatusManager) updatePhase(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, phase string) error {
-	job.Status.Phase = phase
+	setPhase(job, phase)
 
 	// Update last reconcile time
 	now := metav1.Now()
 	job.Status.LastReconcileTime = &now
 
-	return sm.client.Status().Update(ctx, job)
+	return nil
+}
+
+// setPhase sets the phase of the job and records its first entry in the timeline
+func setPhase(job *torchrunv1alpha1.TorchrunJob, phase string) {
+	job.Status.Phase = phase
+	updateTimeline(job, phase, time.Now())
+}
+
+// updateTimeline records the time the job entered the phase, unless it entered it before, and
+// the queue wait and runtime once the job ran or finished
+func updateTimeline(job *torchrunv1alpha1.TorchrunJob, phase string, now time.Time) {
+	switch phase {
+	case torchrunv1alpha1.PhasePending, torchrunv1alpha1.PhaseSyncing, torchrunv1alpha1.PhaseQueued,
+		torchrunv1alpha1.PhaseRunning, torchrunv1alpha1.PhaseSucceeded, torchrunv1alpha1.PhaseFailed,
+		torchrunv1alpha1.PhaseTimedOut:
+	default:
+		return
+	}
+	if job.Status.Timeline == nil {
+		job.Status.Timeline = &torchrunv1alpha1.JobTimeline{}
+	}
+	timeline := job.Status.Timeline
+	at := &metav1.Time{Time: now}
+
+	if !isTerminalPhase(phase) {
+		// A retry leaves the finished phase, so the job completes again later
+		timeline.CompletedAt = nil
+		timeline.Runtime = ""
+	}
+	switch phase {
+	case torchrunv1alpha1.PhasePending:
+		if timeline.PendingAt == nil {
+			timeline.PendingAt = at
+		}
+	case torchrunv1alpha1.PhaseSyncing:
+		if timeline.SyncingAt == nil {
+			timeline.SyncingAt = at
+		}
+	case torchrunv1alpha1.PhaseQueued:
+		if timeline.QueuedAt == nil {
+			timeline.QueuedAt = at
+		}
+	case torchrunv1alpha1.PhaseRunning:
+		if timeline.RunningAt == nil {
+			timeline.RunningAt = at
+			queuedAt := job.CreationTimestamp.Time
+			if timeline.QueuedAt != nil {
+				queuedAt = timeline.QueuedAt.Time
+			}
+			timeline.QueueWait = now.Sub(queuedAt).Round(time.Second).String()
+		}
+	default:
+		if timeline.CompletedAt == nil {
+			timeline.CompletedAt = at
+			if timeline.RunningAt != nil {
+				timeline.Runtime = now.Sub(timeline.RunningAt.Time).Round(time.Second).String()
+			}
+		}
+	}
+}
+
+// getDeadlineWarningPercent returns the share of the active deadline after which the job is
+// warned, 90% unless the job sets another
+func getDeadlineWarningPercent(job *torchrunv1alpha1.TorchrunJob) int32 {
+	if percent := job.Spec.Reliability.DeadlineWarningPercent; percent > 0 {
+		return percent
+	}
+	return 90
 }
 
 // isWorkspaceReady checks if the workspace PVC has the sync-completed label
 func (sm *StatusManager) isWorkspaceReady(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) (bool, error) {
+	// Ephemeral workspaces have no PVC to sync
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == "WorkspaceReady" && cond.Reason == "EphemeralWorkspace" {
+			return cond.Status == "True", nil
+		}
+	}
+
 	pvcName := GetWorkspacePVCName(job)
 	workspacePVC := &v1.PersistentVolumeClaim{}
 	err := sm.client.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: job.Namespace}, workspacePVC)
@@ -0,0 +1,380 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestUpdateStatusWorkerPods(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	job := &torchrunv1alpha1.TorchrunJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+		Spec:       torchrunv1alpha1.TorchrunJobSpec{JobID: "train-1", NumNodes: 3},
+		Status:     torchrunv1alpha1.TorchrunJobStatus{NumNodes: 3},
+	}
+	k8sJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+		Status:     batchv1.JobStatus{Active: 3},
+	}
+
+	workerPod := func(name, index string, status corev1.PodStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Labels:      map[string]string{"app": "torchrun", "torchrun.ai/job-id": "train-1"},
+				Annotations: map[string]string{batchv1.JobCompletionIndexAnnotation: index},
+			},
+			Spec:   corev1.PodSpec{NodeName: "node-" + index},
+			Status: status,
+		}
+	}
+
+	objects := []client.Object{
+		job,
+		k8sJob,
+		workerPod("train-2-abc", "2", corev1.PodStatus{
+			Phase: corev1.PodPending,
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: "Unschedulable", Message: "0/4 nodes are available"},
+			},
+		}),
+		workerPod("train-0-abc", "0", corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "trainer", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+		}),
+		workerPod("train-1-abc", "1", corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name:         "trainer",
+					RestartCount: 3,
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+						Reason:  "CrashLoopBackOff",
+						Message: "back-off 40s restarting failed container",
+					}},
+				},
+			},
+		}),
+		// Pods of other jobs are ignored
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      "other-0-abc",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "torchrun", "torchrun.ai/job-id": "other"},
+		}},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).WithStatusSubresource(job).Build()
+	sm := NewStatusManager(c)
+
+	if err := sm.UpdateStatus(context.Background(), job, job.DeepCopy()); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+
+	expected := []torchrunv1alpha1.WorkerPodStatus{
+		{Name: "train-0-abc", NodeName: "node-0", Index: 0, Phase: "Running"},
+		{
+			Name:         "train-1-abc",
+			NodeName:     "node-1",
+			Index:        1,
+			Phase:        "Running",
+			RestartCount: 3,
+			LastError:    "container trainer: CrashLoopBackOff: back-off 40s restarting failed container",
+		},
+		{Name: "train-2-abc", NodeName: "node-2", Index: 2, Phase: "Pending", LastError: "Unschedulable: 0/4 nodes are available"},
+	}
+
+	workers := job.Status.Workers
+	if len(workers.Pods) != len(expected) {
+		t.Fatalf("expected %d worker pods, got %v", len(expected), workers.Pods)
+	}
+	for i := range expected {
+		if workers.Pods[i] != expected[i] {
+			t.Errorf("worker %d: expected %+v, got %+v", i, expected[i], workers.Pods[i])
+		}
+	}
+	if workers.Pending != 1 || workers.Ready != 1 || workers.Running != 3 {
+		t.Errorf("expected 1 pending, 1 ready and 3 running workers, got %+v", workers)
+	}
+}
+
+func TestPodLastError(t *testing.T) {
+	tests := []struct {
+		description string
+		status      corev1.PodStatus
+		expected    string
+	}{
+		{
+			description: "healthy pod has no error",
+			status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "trainer", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				},
+			},
+		},
+		{
+			description: "starting container is not an error",
+			status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "trainer", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+				},
+			},
+		},
+		{
+			description: "evicted pod reports the pod reason",
+			status:      corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted", Message: "node was low on memory"},
+			expected:    "Evicted: node was low on memory",
+		},
+		{
+			description: "failed container reports its exit code",
+			status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "trainer", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}}},
+				},
+			},
+			expected: "container trainer exited with code 137: OOMKilled",
+		},
+		{
+			description: "restarted container reports its previous failure",
+			status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name:                 "trainer",
+						State:                corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+						LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}},
+					},
+				},
+			},
+			expected: "container trainer exited with code 1: Error",
+		},
+		{
+			description: "succeeded pod has no error",
+			status: corev1.PodStatus{
+				Phase: corev1.PodSucceeded,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "sidecar", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 143}}},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if got := podLastError(&corev1.Pod{Status: test.status}); got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.description, test.expected, got)
+		}
+	}
+}
+
+func TestUpdateDeadline(t *testing.T) {
+	start := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	deadline := int64(3600)
+	running := func() *batchv1.Job {
+		return &batchv1.Job{
+			Spec:   batchv1.JobSpec{ActiveDeadlineSeconds: &deadline},
+			Status: batchv1.JobStatus{Active: 2, StartTime: &metav1.Time{Time: start}},
+		}
+	}
+	timedOut := running()
+	timedOut.Status.Active = 0
+	timedOut.Status.Conditions = []batchv1.JobCondition{{
+		Type:               batchv1.JobFailed,
+		Status:             corev1.ConditionTrue,
+		Reason:             batchv1.JobReasonDeadlineExceeded,
+		LastTransitionTime: metav1.Time{Time: start.Add(time.Hour)},
+	}}
+
+	tests := []struct {
+		description     string
+		k8sJob          *batchv1.Job
+		phase           string
+		warningPercent  int32
+		conditions      []torchrunv1alpha1.TorchrunJobCondition
+		now             time.Time
+		expectDeadline  bool
+		expectCondition string
+		expectReason    string
+	}{
+		{
+			description:    "job early in its deadline has no warning",
+			k8sJob:         running(),
+			phase:          torchrunv1alpha1.PhaseRunning,
+			now:            start.Add(30 * time.Minute),
+			expectDeadline: true,
+		},
+		{
+			description:     "job past the default warning percentage is warned",
+			k8sJob:          running(),
+			phase:           torchrunv1alpha1.PhaseRunning,
+			now:             start.Add(55 * time.Minute),
+			expectDeadline:  true,
+			expectCondition: "DeadlineApproaching",
+			expectReason:    "DeadlineWarning",
+		},
+		{
+			description:     "job past its own warning percentage is warned",
+			k8sJob:          running(),
+			phase:           torchrunv1alpha1.PhaseRunning,
+			warningPercent:  50,
+			now:             start.Add(31 * time.Minute),
+			expectDeadline:  true,
+			expectCondition: "DeadlineApproaching",
+			expectReason:    "DeadlineWarning",
+		},
+		{
+			description:     "extended deadline clears the warning",
+			k8sJob:          running(),
+			phase:           torchrunv1alpha1.PhaseRunning,
+			conditions:      []torchrunv1alpha1.TorchrunJobCondition{{Type: "DeadlineApproaching", Status: "True"}},
+			now:             start.Add(10 * time.Minute),
+			expectDeadline:  true,
+			expectCondition: "DeadlineApproaching",
+			expectReason:    "WithinDeadline",
+		},
+		{
+			description: "suspended job has no deadline",
+			k8sJob:      running(),
+			phase:       torchrunv1alpha1.PhaseSuspended,
+			now:         start.Add(55 * time.Minute),
+		},
+		{
+			description:     "job killed by its deadline failed with DeadlineExceeded",
+			k8sJob:          timedOut,
+			phase:           torchrunv1alpha1.PhaseTimedOut,
+			now:             start.Add(61 * time.Minute),
+			expectCondition: "Failed",
+			expectReason:    batchv1.JobReasonDeadlineExceeded,
+		},
+	}
+
+	sm := NewStatusManager(fake.NewClientBuilder().Build())
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			Spec:   torchrunv1alpha1.TorchrunJobSpec{Reliability: torchrunv1alpha1.ReliabilityConfig{DeadlineWarningPercent: test.warningPercent}},
+			Status: torchrunv1alpha1.TorchrunJobStatus{Conditions: test.conditions},
+		}
+		sm.updateDeadline(job, test.k8sJob, test.phase, test.now)
+
+		if hasDeadline := job.Status.DeadlineTime != nil; hasDeadline != test.expectDeadline {
+			t.Errorf("%s: expected deadline time %v, got %v", test.description, test.expectDeadline, job.Status.DeadlineTime)
+		} else if hasDeadline && !job.Status.DeadlineTime.Time.Equal(start.Add(time.Hour)) {
+			t.Errorf("%s: expected deadline time %s, got %s", test.description, start.Add(time.Hour), job.Status.DeadlineTime)
+		}
+		var reason string
+		for _, condition := range job.Status.Conditions {
+			if condition.Type == test.expectCondition {
+				reason = condition.Reason
+			}
+		}
+		if test.expectCondition == "" && len(job.Status.Conditions) > 0 {
+			t.Errorf("%s: expected no conditions, got %v", test.description, job.Status.Conditions)
+		} else if reason != test.expectReason {
+			t.Errorf("%s: expected %s condition with reason %q, got %v", test.description, test.expectCondition, test.expectReason, job.Status.Conditions)
+		}
+		if test.phase == torchrunv1alpha1.PhaseTimedOut && (job.Status.CompletionTime == nil || !job.Status.CompletionTime.Time.Equal(start.Add(time.Hour))) {
+			t.Errorf("%s: expected the failure time as completion time, got %v", test.description, job.Status.CompletionTime)
+		}
+	}
+}
+
+func TestUpdateTimeline(t *testing.T) {
+	created := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return created.Add(time.Duration(minutes) * time.Minute) }
+	queued := at(2)
+	type transition struct {
+		phase string
+		at    time.Time
+	}
+
+	tests := []struct {
+		description   string
+		transitions   []transition
+		expectQueued  *time.Time
+		expectWait    string
+		expectRuntime string
+		expectDone    bool
+	}{
+		{
+			description:  "queued job has no wait yet",
+			transitions:  []transition{{torchrunv1alpha1.PhasePending, at(0)}, {torchrunv1alpha1.PhaseQueued, at(2)}},
+			expectQueued: &queued,
+		},
+		{
+			description: "finished job records its wait and runtime",
+			transitions: []transition{
+				{torchrunv1alpha1.PhaseSyncing, at(1)},
+				{torchrunv1alpha1.PhaseQueued, at(2)},
+				{torchrunv1alpha1.PhaseQueued, at(5)},
+				{torchrunv1alpha1.PhaseRunning, at(7)},
+				{torchrunv1alpha1.PhaseSucceeded, at(97)},
+			},
+			expectQueued:  &queued,
+			expectWait:    "5m0s",
+			expectRuntime: "1h30m0s",
+			expectDone:    true,
+		},
+		{
+			description:   "job never queued waits from its creation",
+			transitions:   []transition{{torchrunv1alpha1.PhaseRunning, at(3)}, {torchrunv1alpha1.PhaseFailed, at(4)}},
+			expectWait:    "3m0s",
+			expectRuntime: "1m0s",
+			expectDone:    true,
+		},
+		{
+			description: "retried job completes again",
+			transitions: []transition{
+				{torchrunv1alpha1.PhaseRunning, at(3)},
+				{torchrunv1alpha1.PhaseFailed, at(4)},
+				{torchrunv1alpha1.PhasePending, at(5)},
+			},
+			expectWait: "3m0s",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.Time{Time: created}}}
+		for _, transition := range test.transitions {
+			updateTimeline(job, transition.phase, transition.at)
+		}
+
+		timeline := job.Status.Timeline
+		if test.expectQueued == nil && timeline.QueuedAt != nil {
+			t.Errorf("%s: expected no queued time, got %s", test.description, timeline.QueuedAt)
+		}
+		if test.expectQueued != nil && (timeline.QueuedAt == nil || !timeline.QueuedAt.Time.Equal(*test.expectQueued)) {
+			t.Errorf("%s: expected queued time %s, got %v", test.description, *test.expectQueued, timeline.QueuedAt)
+		}
+		if timeline.QueueWait != test.expectWait {
+			t.Errorf("%s: expected queue wait %q, got %q", test.description, test.expectWait, timeline.QueueWait)
+		}
+		if timeline.Runtime != test.expectRuntime {
+			t.Errorf("%s: expected runtime %q, got %q", test.description, test.expectRuntime, timeline.Runtime)
+		}
+		if done := timeline.CompletedAt != nil; done != test.expectDone {
+			t.Errorf("%s: expected completed %v, got %v", test.description, test.expectDone, timeline.CompletedAt)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// maxSuspectNodeMessageLength limits the log line recorded for a suspect node
+const maxSuspectNodeMessageLength = 256
+
+// nodeFaultPatterns match the trainer log lines of errors that point at the node of a worker.
+// Network errors are limited to the local NIC: when a node fails, the workers on every other
+// node report errors of their connection to it.
+var nodeFaultPatterns = []struct {
+	reason  string
+	pattern *regexp.Regexp
+}{
+	{"GPUError", regexp.MustCompile(`(?i)uncorrectable ECC|ECC error|\bXid\b|fallen off the bus|GPU is lost|GPU_IS_LOST|ECC_UNCORRECTABLE`)},
+	{"NetworkError", regexp.MustCompile(`ibv_\w+ failed|NET/IB ?: Got async event|IBV_WC_LOC_\w+|local catastrophic error`)},
+}
+
+// recordSuspectNodes records the nodes of worker pods whose trainer failed with a GPU or local
+// network error. The termination message of the trainer falls back to the end of its logs, so
+// the errors of the training process are found there. A node is recorded once; a later failure
+// on it replaces the entry.
+func recordSuspectNodes(job *torchrunv1alpha1.TorchrunJob, pods []corev1.Pod, now time.Time) {
+	attempt := job.Status.Attempt
+	if attempt < 1 {
+		attempt = 1
+	}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		reason, message := detectNodeFault(pod)
+		if reason == "" {
+			continue
+		}
+		suspect := torchrunv1alpha1.SuspectNode{
+			Node:    pod.Spec.NodeName,
+			Reason:  reason,
+			Message: message,
+			Pod:     pod.Name,
+			Attempt: attempt,
+			Time:    metav1.NewTime(now),
+		}
+		recorded := false
+		for j := range job.Status.SuspectNodes {
+			existing := &job.Status.SuspectNodes[j]
+			if existing.Node != suspect.Node {
+				continue
+			}
+			recorded = true
+			// The same failure is seen on every reconcile until the pod is removed
+			if existing.Pod != suspect.Pod || existing.Reason != suspect.Reason {
+				*existing = suspect
+			}
+		}
+		if !recorded {
+			job.Status.SuspectNodes = append(job.Status.SuspectNodes, suspect)
+		}
+	}
+}
+
+// detectNodeFault returns the kind of node error and its log line if the trainer of a pod failed
+// with one, in its current or last termination
+func detectNodeFault(pod *corev1.Pod) (string, string) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != "trainer" {
+			continue
+		}
+		for _, terminated := range []*corev1.ContainerStateTerminated{status.State.Terminated, status.LastTerminationState.Terminated} {
+			if terminated == nil || terminated.ExitCode == 0 {
+				continue
+			}
+			for _, line := range strings.Split(terminated.Message, "\n") {
+				for _, fault := range nodeFaultPatterns {
+					if fault.pattern.MatchString(line) {
+						line = strings.TrimSpace(line)
+						if len(line) > maxSuspectNodeMessageLength {
+							line = line[:maxSuspectNodeMessageLength]
+						}
+						return fault.reason, line
+					}
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+// getExcludedSuspectNodes returns the suspect nodes the workers of the current attempt are kept
+// off: those of earlier attempts. The nodes of the current attempt are left out, so recording
+// them does not change the Job of the attempt.
+func getExcludedSuspectNodes(job *torchrunv1alpha1.TorchrunJob) []string {
+	attempt := job.Status.Attempt
+	if attempt < 1 {
+		attempt = 1
+	}
+	var nodes []string
+	for _, suspect := range job.Status.SuspectNodes {
+		if suspect.Attempt < attempt {
+			nodes = append(nodes, suspect.Node)
+		}
+	}
+	return nodes
+}
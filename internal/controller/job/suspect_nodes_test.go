@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestRecordSuspectNodes(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	earlier := metav1.NewTime(now.Add(-time.Hour))
+	// A worker pod on the given node whose trainer exited with the given message
+	pod := func(name, node string, exitCode int32, message string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "trainer",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Message: message}},
+			}}},
+		}
+	}
+
+	tests := []struct {
+		description   string
+		attempt       int32
+		pods          []corev1.Pod
+		previous      []torchrunv1alpha1.SuspectNode
+		expectSuspect []torchrunv1alpha1.SuspectNode
+	}{
+		{
+			description: "healthy workers",
+			pods:        []corev1.Pod{pod("train-0", "gpu-node-1", 0, "training done"), pod("train-1", "gpu-node-2", 1, "ValueError: bad config")},
+		},
+		{
+			description: "GPU error",
+			attempt:     1,
+			pods: []corev1.Pod{pod("train-0", "gpu-node-1", 1,
+				"step 100\nRuntimeError: CUDA error: uncorrectable ECC error encountered\n")},
+			expectSuspect: []torchrunv1alpha1.SuspectNode{{
+				Node: "gpu-node-1", Reason: "GPUError", Message: "RuntimeError: CUDA error: uncorrectable ECC error encountered",
+				Pod: "train-0", Attempt: 1, Time: metav1.NewTime(now),
+			}},
+		},
+		{
+			description: "local network error, but not the errors of its peers",
+			attempt:     2,
+			pods: []corev1.Pod{
+				pod("train-0", "gpu-node-1", 1, "NCCL WARN NET/IB : Got async event : local catastrophic error"),
+				pod("train-1", "gpu-node-2", 1, "NCCL WARN NET/IB : Got completion from peer 10.0.0.1 with error 12, opcode 0, len 0, vendor err 129 (Recv)"),
+			},
+			expectSuspect: []torchrunv1alpha1.SuspectNode{{
+				Node: "gpu-node-1", Reason: "NetworkError", Message: "NCCL WARN NET/IB : Got async event : local catastrophic error",
+				Pod: "train-0", Attempt: 2, Time: metav1.NewTime(now),
+			}},
+		},
+		{
+			description: "failure seen again is not recorded again",
+			attempt:     1,
+			pods:        []corev1.Pod{pod("train-0", "gpu-node-1", 1, "Xid 79: GPU has fallen off the bus")},
+			previous: []torchrunv1alpha1.SuspectNode{{
+				Node: "gpu-node-1", Reason: "GPUError", Message: "Xid 79: GPU has fallen off the bus", Pod: "train-0", Attempt: 1, Time: earlier,
+			}},
+			expectSuspect: []torchrunv1alpha1.SuspectNode{{
+				Node: "gpu-node-1", Reason: "GPUError", Message: "Xid 79: GPU has fallen off the bus", Pod: "train-0", Attempt: 1, Time: earlier,
+			}},
+		},
+		{
+			description: "later failure on a node replaces its entry",
+			attempt:     3,
+			pods:        []corev1.Pod{pod("train-b-0", "gpu-node-1", 1, "Xid 79: GPU has fallen off the bus")},
+			previous: []torchrunv1alpha1.SuspectNode{{
+				Node: "gpu-node-1", Reason: "NetworkError", Message: "ibv_post_send failed", Pod: "train-a-0", Attempt: 1, Time: earlier,
+			}},
+			expectSuspect: []torchrunv1alpha1.SuspectNode{{
+				Node: "gpu-node-1", Reason: "GPUError", Message: "Xid 79: GPU has fallen off the bus", Pod: "train-b-0", Attempt: 3, Time: metav1.NewTime(now),
+			}},
+		},
+		{
+			description: "unscheduled pod is skipped",
+			pods:        []corev1.Pod{pod("train-0", "", 1, "GPU is lost")},
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{Status: torchrunv1alpha1.TorchrunJobStatus{Attempt: test.attempt, SuspectNodes: test.previous}}
+
+		recordSuspectNodes(job, test.pods, now)
+		if !reflect.DeepEqual(job.Status.SuspectNodes, test.expectSuspect) {
+			t.Errorf("%s: expected suspect nodes %+v, got %+v", test.description, test.expectSuspect, job.Status.SuspectNodes)
+		}
+	}
+}
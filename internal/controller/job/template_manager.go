@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// TemplateManager merges TorchrunTemplates into the jobs that reference them
+type TemplateManager struct {
+	client client.Client
+}
+
+// NewTemplateManager creates a new template manager
+func NewTemplateManager(client client.Client) *TemplateManager {
+	return &TemplateManager{
+		client: client,
+	}
+}
+
+// ApplyTemplate merges the template referenced by the job into its spec and reports whether
+// the spec changed. Jobs without a templateRef are left unchanged.
+func (tm *TemplateManager) ApplyTemplate(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) (bool, error) {
+	if job.Spec.TemplateRef == nil {
+		return false, nil
+	}
+
+	template := &torchrunv1alpha1.TorchrunTemplate{}
+	if err := tm.client.Get(ctx, types.NamespacedName{Name: job.Spec.TemplateRef.Name, Namespace: job.Namespace}, template); err != nil {
+		return false, err
+	}
+
+	merged, err := mergeTemplate(&job.Spec, &template.Spec)
+	if err != nil {
+		return false, err
+	}
+	if equality.Semantic.DeepEqual(job.Spec, *merged) {
+		return false, nil
+	}
+	job.Spec = *merged
+	return true, nil
+}
+
+// mergeTemplate deep-merges the template under the job spec. Every field the job sets wins,
+// so zero values such as maxRestarts: 0 cannot unset a template value.
+func mergeTemplate(spec *torchrunv1alpha1.TorchrunJobSpec, template *torchrunv1alpha1.TorchrunTemplateSpec) (*torchrunv1alpha1.TorchrunJobSpec, error) {
+	base, err := toJSONMap(template)
+	if err != nil {
+		return nil, err
+	}
+	override, err := toJSONMap(spec)
+	if err != nil {
+		return nil, err
+	}
+	deepMerge(base, override)
+
+	raw, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+	merged := &torchrunv1alpha1.TorchrunJobSpec{}
+	if err := json.Unmarshal(raw, merged); err != nil {
+		return nil, err
+	}
+
+	// Lists are replaced by the merge, env is merged by variable name instead
+	merged.Env = mergeEnv(template.Env, spec.Env)
+	return merged, nil
+}
+
+// toJSONMap converts v to its generic JSON representation
+func toJSONMap(v interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	return m, json.Unmarshal(raw, &m)
+}
+
+// deepMerge copies src into dst, merging nested objects so src wins for every field it sets
+func deepMerge(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if srcMap, ok := value.(map[string]interface{}); ok {
+			if dstMap, ok := dst[key].(map[string]interface{}); ok {
+				deepMerge(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// mergeEnv returns the template env with the job env applied, keeping the template order and
+// appending variables only the job sets
+func mergeEnv(template, job []corev1.EnvVar) []corev1.EnvVar {
+	if len(template) == 0 {
+		return job
+	}
+
+	merged := make([]corev1.EnvVar, 0, len(template)+len(job))
+	index := map[string]int{}
+	for _, e := range template {
+		index[e.Name] = len(merged)
+		merged = append(merged, e)
+	}
+	for _, e := range job {
+		if i, ok := index[e.Name]; ok {
+			merged[i] = e
+			continue
+		}
+		index[e.Name] = len(merged)
+		merged = append(merged, e)
+	}
+	return merged
+}
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestApplyTemplate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	deadline := int64(86400)
+	template := &torchrunv1alpha1.TorchrunTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "llama", Namespace: "default"},
+		Spec: torchrunv1alpha1.TorchrunTemplateSpec{
+			Command:  "python train.py --config llama.yaml",
+			NumNodes: 4,
+			Priority: "high",
+			Env: []corev1.EnvVar{
+				{Name: "NCCL_DEBUG", Value: "WARN"},
+				{Name: "WANDB_PROJECT", Value: "llama"},
+			},
+			Reliability: &torchrunv1alpha1.ReliabilityConfig{
+				MaxRestarts:           5,
+				ActiveDeadlineSeconds: &deadline,
+			},
+			Labels: map[string]string{"team": "research", "model": "llama"},
+		},
+	}
+
+	tests := []struct {
+		description   string
+		spec          torchrunv1alpha1.TorchrunJobSpec
+		expectChanged bool
+		expectError   bool
+		expected      torchrunv1alpha1.TorchrunJobSpec
+	}{
+		{
+			description: "job without templateRef is unchanged",
+			spec:        torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", Command: "python train.py"},
+			expected:    torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", Command: "python train.py"},
+		},
+		{
+			description: "template fills fields the job leaves unset",
+			spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:       "dev",
+				TemplateRef: &corev1.LocalObjectReference{Name: "llama"},
+			},
+			expectChanged: true,
+			expected: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:       "dev",
+				TemplateRef: &corev1.LocalObjectReference{Name: "llama"},
+				Command:     "python train.py --config llama.yaml",
+				NumNodes:    4,
+				Priority:    "high",
+				Env: []corev1.EnvVar{
+					{Name: "NCCL_DEBUG", Value: "WARN"},
+					{Name: "WANDB_PROJECT", Value: "llama"},
+				},
+				Reliability: torchrunv1alpha1.ReliabilityConfig{
+					MaxRestarts:           5,
+					ActiveDeadlineSeconds: &deadline,
+				},
+				Labels: map[string]string{"team": "research", "model": "llama"},
+			},
+		},
+		{
+			description: "job fields take precedence over the template",
+			spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:       "dev",
+				TemplateRef: &corev1.LocalObjectReference{Name: "llama"},
+				NumNodes:    2,
+				Env: []corev1.EnvVar{
+					{Name: "NCCL_DEBUG", Value: "INFO"},
+					{Name: "SEED", Value: "1"},
+				},
+				Reliability: torchrunv1alpha1.ReliabilityConfig{RestartPolicy: "Never"},
+				Labels:      map[string]string{"model": "llama-70b"},
+			},
+			expectChanged: true,
+			expected: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:       "dev",
+				TemplateRef: &corev1.LocalObjectReference{Name: "llama"},
+				Command:     "python train.py --config llama.yaml",
+				NumNodes:    2,
+				Priority:    "high",
+				Env: []corev1.EnvVar{
+					{Name: "NCCL_DEBUG", Value: "INFO"},
+					{Name: "WANDB_PROJECT", Value: "llama"},
+					{Name: "SEED", Value: "1"},
+				},
+				Reliability: torchrunv1alpha1.ReliabilityConfig{
+					MaxRestarts:           5,
+					RestartPolicy:         "Never",
+					ActiveDeadlineSeconds: &deadline,
+				},
+				Labels: map[string]string{"team": "research", "model": "llama-70b"},
+			},
+		},
+		{
+			description: "missing template is an error",
+			spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:       "dev",
+				TemplateRef: &corev1.LocalObjectReference{Name: "missing"},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(template.DeepCopy()).Build()
+		tm := NewTemplateManager(c)
+
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Spec:       test.spec,
+		}
+		changed, err := tm.ApplyTemplate(context.Background(), job)
+		if test.expectError {
+			if !apierrors.IsNotFound(err) {
+				t.Errorf("%s: expected not found error, got %v", test.description, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: ApplyTemplate() error = %v", test.description, err)
+		}
+		if changed != test.expectChanged {
+			t.Errorf("%s: expected changed %v, got %v", test.description, test.expectChanged, changed)
+		}
+		if !equality.Semantic.DeepEqual(job.Spec, test.expected) {
+			t.Errorf("%s: expected spec %+v, got %+v", test.description, test.expected, job.Spec)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// tensorboardPort is the port TensorBoard listens on
+const tensorboardPort = 6006
+
+// TensorboardManager deploys TensorBoard for jobs that enable it
+type TensorboardManager struct {
+	client     client.Client
+	jobManager *JobManager
+}
+
+// NewTensorboardManager creates a new tensorboard manager. The job manager resolves the
+// volumes of the trainer container the same way the Job is built.
+func NewTensorboardManager(client client.Client, jobManager *JobManager) *TensorboardManager {
+	return &TensorboardManager{
+		client:     client,
+		jobManager: jobManager,
+	}
+}
+
+// EnsureTensorboard creates or updates the TensorBoard Deployment, Service and optional Ingress
+// of the job and records its URL in the status, or removes them once TensorBoard is disabled.
+// TensorBoard mounts the trainer volume holding the log directory read-only, so the volume
+// must be shared between pods.
+func (tm *TensorboardManager) EnsureTensorboard(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) error {
+	tensorboard := job.Spec.Tensorboard
+	if tensorboard == nil || !tensorboard.Enabled {
+		if job.Status.TensorboardURL == "" {
+			return nil
+		}
+		if err := tm.deleteTensorboard(ctx, job); err != nil {
+			return err
+		}
+		job.Status.TensorboardURL = ""
+		return nil
+	}
+
+	volume, mount, err := tm.getLogVolume(job, jq)
+	if err != nil {
+		return err
+	}
+
+	pathPrefix := ""
+	if tensorboard.IngressClass != "" && tensorboard.Host == "" {
+		pathPrefix = fmt.Sprintf("/tensorboard/%s/%s", job.Namespace, job.Name)
+	}
+
+	if err := tm.createOrUpdateDeployment(ctx, job, volume, mount, pathPrefix); err != nil {
+		return err
+	}
+	if err := tm.createOrUpdateService(ctx, job); err != nil {
+		return err
+	}
+	if tensorboard.IngressClass == "" {
+		if err := tm.deleteObject(ctx, &networkingv1.Ingress{ObjectMeta: tm.objectMeta(job)}); err != nil {
+			return err
+		}
+		job.Status.TensorboardURL = fmt.Sprintf("http://%s.%s.svc", GetTensorboardName(job), job.Namespace)
+		return nil
+	}
+
+	ingress, err := tm.createOrUpdateIngress(ctx, job, pathPrefix)
+	if err != nil {
+		return err
+	}
+	job.Status.TensorboardURL = getIngressURL(ingress, tensorboard.Host, fmt.Sprintf("%s.%s.svc", GetTensorboardName(job), job.Namespace), pathPrefix)
+	return nil
+}
+
+// getLogVolume returns the trainer volume and mount holding the log directory, using the
+// deepest mount that contains it. Volumes local to a pod or node cannot be read by TensorBoard.
+func (tm *TensorboardManager) getLogVolume(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*corev1.Volume, *corev1.VolumeMount, error) {
+	podSpec, err := getPodSpec(job, jq)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tm.jobManager.validatePodSpec(podSpec); err != nil {
+		return nil, nil, err
+	}
+	if err := tm.jobManager.translateResourceNames(&podSpec, jq); err != nil {
+		return nil, nil, err
+	}
+	tm.jobManager.attachVolumes(job, jq, &podSpec)
+
+	logDir := path.Clean(job.Spec.Tensorboard.LogDir)
+	var mount *corev1.VolumeMount
+	for i := range podSpec.Containers[0].VolumeMounts {
+		candidate := &podSpec.Containers[0].VolumeMounts[i]
+		mountPath := path.Clean(candidate.MountPath)
+		if logDir != mountPath && !strings.HasPrefix(logDir, strings.TrimSuffix(mountPath, "/")+"/") {
+			continue
+		}
+		if mount == nil || len(mountPath) > len(path.Clean(mount.MountPath)) {
+			mount = candidate
+		}
+	}
+	// The workspace is copied into every worker or mounted read-only, so logs cannot be shared there
+	if mount == nil || mount.MountPath == getWorkspaceMountPath(job, jq) {
+		return nil, nil, fmt.Errorf("log directory %s is not on a volume of the trainer container shared between pods", logDir)
+	}
+
+	for i := range podSpec.Volumes {
+		volume := &podSpec.Volumes[i]
+		if volume.Name != mount.Name {
+			continue
+		}
+		if volume.PersistentVolumeClaim == nil && volume.NFS == nil && volume.CSI == nil {
+			return nil, nil, fmt.Errorf("log directory %s is on volume %s, which is not shared between pods", logDir, volume.Name)
+		}
+		return volume, mount, nil
+	}
+	return nil, nil, fmt.Errorf("volume %s of the log directory %s not found", mount.Name, logDir)
+}
+
+// tensorboardLabels returns the labels of the TensorBoard resources of a job. They do not match
+// the worker pod labels, so TensorBoard is never counted as a worker.
+func tensorboardLabels(job *torchrunv1alpha1.TorchrunJob) map[string]string {
+	return map[string]string{
+		"app":                   "torchrun-tensorboard",
+		"torchrun.ai/job-id":    job.Spec.JobID,
+		"torchrun.ai/job-name":  job.Spec.JobName,
+		"torchrun.ai/job-queue": job.Spec.Queue,
+	}
+}
+
+// objectMeta returns the name and namespace of the TensorBoard resources of a job
+func (tm *TensorboardManager) objectMeta(job *torchrunv1alpha1.TorchrunJob) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      GetTensorboardName(job),
+		Namespace: job.Namespace,
+	}
+}
+
+// createOrUpdateDeployment creates or updates the TensorBoard Deployment, mounting the volume of
+// the log directory read-only at the same path as in the trainer container
+func (tm *TensorboardManager) createOrUpdateDeployment(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, volume *corev1.Volume, mount *corev1.VolumeMount, pathPrefix string) error {
+	image := job.Spec.Tensorboard.Image
+	if image == "" {
+		image = "tensorflow/tensorflow:latest"
+	}
+	args := []string{
+		"--logdir=" + path.Clean(job.Spec.Tensorboard.LogDir),
+		"--bind_all",
+		fmt.Sprintf("--port=%d", tensorboardPort),
+	}
+	if pathPrefix != "" {
+		args = append(args, "--path_prefix="+pathPrefix)
+	}
+
+	deployment := &appsv1.Deployment{ObjectMeta: tm.objectMeta(job)}
+	op, err := controllerutil.CreateOrUpdate(ctx, tm.client, deployment, func() error {
+		labels := tensorboardLabels(job)
+		replicas := int32(1)
+
+		deployment.Labels = labels
+		deployment.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(job, job.GroupVersionKind())}
+		deployment.Spec.Replicas = &replicas
+		deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+		deployment.Spec.Template = corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: labels},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:    "tensorboard",
+						Image:   image,
+						Command: []string{"tensorboard"},
+						Args:    args,
+						Ports: []corev1.ContainerPort{
+							{Name: "http", ContainerPort: tensorboardPort},
+						},
+						ReadinessProbe: &corev1.Probe{
+							ProbeHandler: corev1.ProbeHandler{
+								HTTPGet: &corev1.HTTPGetAction{Path: pathPrefix + "/", Port: intstr.FromString("http")},
+							},
+						},
+						VolumeMounts: []corev1.VolumeMount{
+							{
+								Name:      mount.Name,
+								MountPath: mount.MountPath,
+								SubPath:   mount.SubPath,
+								ReadOnly:  true,
+							},
+						},
+					},
+				},
+				Volumes: []corev1.Volume{*volume},
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reconcile tensorboard deployment: %w", err)
+	}
+	if op != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info("Reconciled tensorboard deployment", "name", deployment.Name, "operation", op)
+	}
+	return nil
+}
+
+// createOrUpdateService creates or updates the TensorBoard Service
+func (tm *TensorboardManager) createOrUpdateService(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) error {
+	service := &corev1.Service{ObjectMeta: tm.objectMeta(job)}
+	_, err := controllerutil.CreateOrUpdate(ctx, tm.client, service, func() error {
+		service.Labels = tensorboardLabels(job)
+		service.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(job, job.GroupVersionKind())}
+		service.Spec.Selector = tensorboardLabels(job)
+		service.Spec.Ports = []corev1.ServicePort{
+			{
+				Name:       "http",
+				Port:       80,
+				TargetPort: intstr.FromString("http"),
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reconcile tensorboard service: %w", err)
+	}
+	return nil
+}
+
+// createOrUpdateIngress creates or updates the TensorBoard Ingress. Without a host, TensorBoard
+// is served below a path of its own so jobs can share the host of the ingress controller.
+func (tm *TensorboardManager) createOrUpdateIngress(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, pathPrefix string) (*networkingv1.Ingress, error) {
+	tensorboard := job.Spec.Tensorboard
+	ingress := &networkingv1.Ingress{ObjectMeta: tm.objectMeta(job)}
+	_, err := controllerutil.CreateOrUpdate(ctx, tm.client, ingress, func() error {
+		pathType := networkingv1.PathTypePrefix
+		ingressPath := pathPrefix
+		if ingressPath == "" {
+			ingressPath = "/"
+		}
+
+		ingress.Labels = tensorboardLabels(job)
+		ingress.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(job, job.GroupVersionKind())}
+		ingress.Spec.IngressClassName = &tensorboard.IngressClass
+		ingress.Spec.Rules = []networkingv1.IngressRule{
+			{
+				Host: tensorboard.Host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{
+							{
+								Path:     ingressPath,
+								PathType: &pathType,
+								Backend: networkingv1.IngressBackend{
+									Service: &networkingv1.IngressServiceBackend{
+										Name: GetTensorboardName(job),
+										Port: networkingv1.ServiceBackendPort{Name: "http"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile tensorboard ingress: %w", err)
+	}
+	return ingress, nil
+}
+
+// getIngressURL returns the URL of a Service exposed on the Ingress with the given host, falling
+// back to the host of the Service until the ingress controller reports the address of an Ingress
+// without host
+func getIngressURL(ingress *networkingv1.Ingress, host, serviceHost, pathPrefix string) string {
+	if host == "" {
+		for _, lb := range ingress.Status.LoadBalancer.Ingress {
+			if lb.Hostname != "" {
+				host = lb.Hostname
+			} else {
+				host = lb.IP
+			}
+			if host != "" {
+				break
+			}
+		}
+	}
+	if host == "" {
+		host = serviceHost
+	}
+	return fmt.Sprintf("http://%s%s", host, pathPrefix)
+}
+
+// deleteTensorboard removes the TensorBoard Deployment, Service and Ingress of a job
+func (tm *TensorboardManager) deleteTensorboard(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) error {
+	objects := []client.Object{
+		&appsv1.Deployment{ObjectMeta: tm.objectMeta(job)},
+		&corev1.Service{ObjectMeta: tm.objectMeta(job)},
+		&networkingv1.Ingress{ObjectMeta: tm.objectMeta(job)},
+	}
+	for _, obj := range objects {
+		if err := tm.deleteObject(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteObject deletes a TensorBoard resource if it exists
+func (tm *TensorboardManager) deleteObject(ctx context.Context, obj client.Object) error {
+	// Check the cache first so a missing resource does not cost a DELETE on every reconcile
+	if err := tm.client.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	log.FromContext(ctx).Info("Deleting tensorboard resource", "name", obj.GetName())
+	if err := tm.client.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestEnsureTensorboard(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	// The queue mounts the shared "checkpoints" PVC, prefixed by the queue, and a scratch emptyDir
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{
+				Spec: runtime.RawExtension{Raw: []byte(`{
+					"containers":[{"name":"trainer","volumeMounts":[
+						{"name":"checkpoints","mountPath":"/checkpoints"},
+						{"name":"scratch","mountPath":"/scratch"}
+					]}],
+					"volumes":[
+						{"name":"checkpoints","persistentVolumeClaim":{"claimName":"checkpoints"}},
+						{"name":"scratch","emptyDir":{}}
+					]
+				}`)},
+			},
+			Resources: []torchrunv1alpha1.ResourceTemplate{
+				{
+					Name:     "checkpoints",
+					NameMode: "prefix",
+					Template: runtime.RawExtension{Raw: []byte(`{"kind":"PersistentVolumeClaim","metadata":{"name":"checkpoints"}}`)},
+				},
+			},
+			WorkspaceStorage: torchrunv1alpha1.WorkspaceStorageConfig{MountPath: "/workspace"},
+		},
+	}
+	nfsVolumes := &torchrunv1alpha1.VolumeOverride{
+		AdditionalVolumes: []corev1.Volume{{Name: "logs", VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: "/logs"}}}},
+		AdditionalMounts:  []torchrunv1alpha1.AdditionalMount{{Name: "logs", MountPath: "/checkpoints/logs"}},
+	}
+
+	tests := []struct {
+		description   string
+		tensorboard   *torchrunv1alpha1.TensorboardConfig
+		volumes       *torchrunv1alpha1.VolumeOverride
+		url           string
+		expectError   bool
+		expectURL     string
+		expectClaim   string
+		expectNFS     bool
+		expectArgs    []string
+		expectIngress string
+	}{
+		{
+			description: "job without tensorboard deploys nothing",
+		},
+		{
+			description: "logs on the queue PVC are served through the Service",
+			tensorboard: &torchrunv1alpha1.TensorboardConfig{Enabled: true, LogDir: "/checkpoints/runs/"},
+			expectURL:   "http://train-tensorboard.default.svc",
+			expectClaim: "research-checkpoints",
+			expectArgs:  []string{"--logdir=/checkpoints/runs", "--bind_all", "--port=6006"},
+		},
+		{
+			description: "deepest mount of the log directory is used",
+			tensorboard: &torchrunv1alpha1.TensorboardConfig{Enabled: true, LogDir: "/checkpoints/logs"},
+			volumes:     nfsVolumes,
+			expectURL:   "http://train-tensorboard.default.svc",
+			expectNFS:   true,
+			expectArgs:  []string{"--logdir=/checkpoints/logs", "--bind_all", "--port=6006"},
+		},
+		{
+			description:   "ingress without host serves below the job path",
+			tensorboard:   &torchrunv1alpha1.TensorboardConfig{Enabled: true, LogDir: "/checkpoints", IngressClass: "nginx"},
+			expectURL:     "http://train-tensorboard.default.svc/tensorboard/default/train",
+			expectClaim:   "research-checkpoints",
+			expectArgs:    []string{"--logdir=/checkpoints", "--bind_all", "--port=6006", "--path_prefix=/tensorboard/default/train"},
+			expectIngress: "/tensorboard/default/train",
+		},
+		{
+			description:   "ingress with host serves at the root",
+			tensorboard:   &torchrunv1alpha1.TensorboardConfig{Enabled: true, LogDir: "/checkpoints", IngressClass: "nginx", Host: "train.example.com"},
+			expectURL:     "http://train.example.com",
+			expectClaim:   "research-checkpoints",
+			expectArgs:    []string{"--logdir=/checkpoints", "--bind_all", "--port=6006"},
+			expectIngress: "/",
+		},
+		{
+			description: "logs in the workspace are rejected",
+			tensorboard: &torchrunv1alpha1.TensorboardConfig{Enabled: true, LogDir: "/workspace/runs"},
+			expectError: true,
+		},
+		{
+			description: "logs on an emptyDir are rejected",
+			tensorboard: &torchrunv1alpha1.TensorboardConfig{Enabled: true, LogDir: "/scratch/runs"},
+			expectError: true,
+		},
+		{
+			description: "mount path prefix of another directory does not match",
+			tensorboard: &torchrunv1alpha1.TensorboardConfig{Enabled: true, LogDir: "/checkpoints-old"},
+			expectError: true,
+		},
+		{
+			description: "disabled tensorboard is removed",
+			tensorboard: &torchrunv1alpha1.TensorboardConfig{Enabled: false, LogDir: "/checkpoints"},
+			url:         "http://train-tensorboard.default.svc",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default", UID: "uid"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				Queue:       "research",
+				JobName:     "train",
+				JobID:       "train-id",
+				Volumes:     test.volumes,
+				Tensorboard: test.tensorboard,
+			},
+			Status: torchrunv1alpha1.TorchrunJobStatus{TensorboardURL: test.url},
+		}
+		meta := metav1.ObjectMeta{Name: "train-tensorboard", Namespace: "default"}
+		existing := []client.Object{
+			&appsv1.Deployment{ObjectMeta: *meta.DeepCopy()},
+			&corev1.Service{ObjectMeta: *meta.DeepCopy()},
+			&networkingv1.Ingress{ObjectMeta: *meta.DeepCopy()},
+		}
+		builder := fake.NewClientBuilder().WithScheme(scheme)
+		if test.url != "" {
+			builder = builder.WithObjects(existing...)
+		}
+		c := builder.Build()
+
+		tm := NewTensorboardManager(c, NewJobManager(c, false, config.Default()))
+		err := tm.EnsureTensorboard(context.Background(), job, jq)
+		if (err != nil) != test.expectError {
+			t.Fatalf("%s: EnsureTensorboard() error = %v, expectError %v", test.description, err, test.expectError)
+		}
+		if job.Status.TensorboardURL != test.expectURL {
+			t.Errorf("%s: expected URL %q, got %q", test.description, test.expectURL, job.Status.TensorboardURL)
+		}
+
+		key := types.NamespacedName{Name: "train-tensorboard", Namespace: "default"}
+		deployment := &appsv1.Deployment{}
+		err = c.Get(context.Background(), key, deployment)
+		if test.expectArgs == nil {
+			if !errors.IsNotFound(err) {
+				t.Errorf("%s: expected no deployment, got %v", test.description, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: expected deployment, got %v", test.description, err)
+		} else {
+			container := deployment.Spec.Template.Spec.Containers[0]
+			volume := deployment.Spec.Template.Spec.Volumes[0]
+			if !slices.Equal(container.Args, test.expectArgs) {
+				t.Errorf("%s: expected args %v, got %v", test.description, test.expectArgs, container.Args)
+			}
+			if !container.VolumeMounts[0].ReadOnly {
+				t.Errorf("%s: expected read-only log volume", test.description)
+			}
+			if test.expectClaim != "" && (volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName != test.expectClaim) {
+				t.Errorf("%s: expected claim %s, got %+v", test.description, test.expectClaim, volume)
+			}
+			if test.expectNFS && volume.NFS == nil {
+				t.Errorf("%s: expected NFS volume, got %+v", test.description, volume)
+			}
+			if len(deployment.OwnerReferences) != 1 || deployment.OwnerReferences[0].UID != job.UID {
+				t.Errorf("%s: expected deployment owned by the job, got %v", test.description, deployment.OwnerReferences)
+			}
+			if err := c.Get(context.Background(), key, &corev1.Service{}); err != nil {
+				t.Errorf("%s: expected service, got %v", test.description, err)
+			}
+		}
+
+		ingress := &networkingv1.Ingress{}
+		err = c.Get(context.Background(), key, ingress)
+		if test.expectIngress == "" {
+			if !errors.IsNotFound(err) {
+				t.Errorf("%s: expected no ingress, got %v", test.description, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: expected ingress, got %v", test.description, err)
+		} else if path := ingress.Spec.Rules[0].HTTP.Paths[0].Path; path != test.expectIngress || *ingress.Spec.IngressClassName != "nginx" {
+			t.Errorf("%s: expected nginx ingress at %s, got %s", test.description, test.expectIngress, path)
+		}
+	}
+}
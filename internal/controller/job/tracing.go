@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/tracing"
+)
+
+// jobSpanPhase is a phase of the trace of a job, ended by the reconcile that saw it end
+type jobSpanPhase struct {
+	name  string
+	start time.Time
+	end   time.Time
+}
+
+// getJobSpanAttributes returns the attributes of the spans of a job
+func getJobSpanAttributes(job *torchrunv1alpha1.TorchrunJob) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("k8s.namespace.name", job.Namespace),
+		attribute.String("torchrun.job.name", job.Name),
+		attribute.String("torchrun.job.id", job.Spec.JobID),
+		attribute.String("torchrun.queue", job.Spec.Queue),
+		attribute.Int("torchrun.num_nodes", job.Spec.NumNodes),
+	}
+}
+
+// startReconcileSpan starts the span of a reconcile of a job in the trace of the job
+func startReconcileSpan(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(tracing.JobContext(ctx, job.UID), "Reconcile",
+		trace.WithAttributes(getJobSpanAttributes(job)...),
+		trace.WithAttributes(attribute.String("torchrun.phase", job.Status.Phase)))
+}
+
+// traceJobPhases exports the spans of the phases of a job that ended in a reconcile: Sync until
+// the workspace is ready, Queue until the workers first run and Run until the job finished. The
+// root span of the job, from its creation until it finished, is exported with the last one.
+func traceJobPhases(ctx context.Context, original, job *torchrunv1alpha1.TorchrunJob, now time.Time) {
+	created := job.CreationTimestamp.Time
+	synced := created
+	if condition := getCondition(job, "WorkspaceReady"); condition != nil && condition.Status == "True" && condition.LastTransitionTime != nil {
+		synced = condition.LastTransitionTime.Time
+	}
+	completed := now
+	if job.Status.CompletionTime != nil {
+		completed = job.Status.CompletionTime.Time
+	}
+
+	var phases []jobSpanPhase
+	if !isConditionTrue(original, "WorkspaceReady") && isConditionTrue(job, "WorkspaceReady") {
+		phases = append(phases, jobSpanPhase{name: "Sync", start: created, end: synced})
+	}
+	if original.Status.StartTime == nil && job.Status.StartTime != nil {
+		phases = append(phases, jobSpanPhase{name: "Queue", start: synced, end: job.Status.StartTime.Time})
+	}
+	finished := !isTerminalPhase(original.Status.Phase) && isTerminalPhase(job.Status.Phase)
+	if finished && job.Status.StartTime != nil {
+		phases = append(phases, jobSpanPhase{name: "Run", start: job.Status.StartTime.Time, end: completed})
+	}
+
+	attributes := getJobSpanAttributes(job)
+	parent := tracing.JobContext(ctx, job.UID)
+	for _, phase := range phases {
+		_, span := tracing.Tracer().Start(parent, phase.name, trace.WithTimestamp(phase.start), trace.WithAttributes(attributes...))
+		span.End(trace.WithTimestamp(phase.end))
+	}
+	if finished {
+		_, span := tracing.StartJob(ctx, job.UID, "TorchrunJob "+job.Namespace+"/"+job.Name, created,
+			trace.WithAttributes(attributes...), trace.WithAttributes(attribute.String("torchrun.phase", job.Status.Phase)))
+		span.End(trace.WithTimestamp(completed))
+	}
+}
+
+// getCondition returns the condition of the given type of the job
+func getCondition(job *torchrunv1alpha1.TorchrunJob, condType string) *torchrunv1alpha1.TorchrunJobCondition {
+	for i := range job.Status.Conditions {
+		if job.Status.Conditions[i].Type == condType {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/tracing"
+)
+
+func TestTraceJobPhases(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := tracing.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	synced := created.Add(2 * time.Minute)
+	started := created.Add(10 * time.Minute)
+	completed := created.Add(time.Hour)
+	now := completed.Add(time.Second)
+	// The job as seen by a reconcile after the given events
+	newJob := func(sync, start, complete bool) *torchrunv1alpha1.TorchrunJob {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "team-a", UID: "uid-1", CreationTimestamp: metav1.NewTime(created)},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{Phase: "Pending"},
+		}
+		if sync {
+			transition := metav1.NewTime(synced)
+			job.Status.Conditions = []torchrunv1alpha1.TorchrunJobCondition{{Type: "WorkspaceReady", Status: "True", LastTransitionTime: &transition}}
+		}
+		if start {
+			job.Status.Phase = "Running"
+			job.Status.StartTime = &metav1.Time{Time: started}
+		}
+		if complete {
+			job.Status.Phase = "Succeeded"
+			job.Status.CompletionTime = &metav1.Time{Time: completed}
+		}
+		return job
+	}
+
+	type span struct {
+		Name  string
+		Start time.Time
+		End   time.Time
+	}
+	tests := []struct {
+		description string
+		original    *torchrunv1alpha1.TorchrunJob
+		job         *torchrunv1alpha1.TorchrunJob
+		expected    []span
+	}{
+		{
+			description: "reconcile without transitions",
+			original:    newJob(false, false, false),
+			job:         newJob(false, false, false),
+		},
+		{
+			description: "workspace became ready",
+			original:    newJob(false, false, false),
+			job:         newJob(true, false, false),
+			expected:    []span{{"Sync", created, synced}},
+		},
+		{
+			description: "workers started",
+			original:    newJob(true, false, false),
+			job:         newJob(true, true, false),
+			expected:    []span{{"Queue", synced, started}},
+		},
+		{
+			description: "job finished",
+			original:    newJob(true, true, false),
+			job:         newJob(true, true, true),
+			expected: []span{
+				{"Run", started, completed},
+				{"TorchrunJob team-a/train", created, completed},
+			},
+		},
+		{
+			description: "job without workspace sync finished in a single reconcile",
+			original:    newJob(false, false, false),
+			job:         newJob(false, true, true),
+			expected: []span{
+				{"Queue", created, started},
+				{"Run", started, completed},
+				{"TorchrunJob team-a/train", created, completed},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		recorder.Reset()
+		traceJobPhases(context.Background(), test.original, test.job, now)
+
+		var spans []span
+		for _, s := range recorder.Ended() {
+			spans = append(spans, span{s.Name(), s.StartTime(), s.EndTime()})
+			if s.SpanContext().TraceID() != tracing.GetJobTraceID(test.job.UID) {
+				t.Errorf("%s: expected span %s in the trace of the job", test.description, s.Name())
+			}
+		}
+		if !reflect.DeepEqual(spans, test.expected) {
+			t.Errorf("%s: expected spans %+v, got %+v", test.description, test.expected, spans)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/patch"
+)
+
+// TrackingURLAnnotation on a worker pod overrides the tracking URL of the job, e.g. with the
+// run link the training code reported
+const TrackingURLAnnotation = "torchrun.ai/tracking-url"
+
+// wandbAPIURL is the default W&B server; its runs are shown on wandbAppURL
+const (
+	wandbAPIURL = "https://api.wandb.ai"
+	wandbAppURL = "https://wandb.ai"
+)
+
+// TrackingManager links jobs to their experiment tracking runs
+type TrackingManager struct {
+	client     client.Client
+	apiReader  client.Reader
+	httpClient *http.Client
+}
+
+// NewTrackingManager creates a new tracking manager. Tracking Secrets are read through
+// apiReader so they are never cached by the manager.
+func NewTrackingManager(client client.Client, apiReader client.Reader) *TrackingManager {
+	return &TrackingManager{
+		client:     client,
+		apiReader:  apiReader,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// EnsureRun records the experiment tracking run of the job before its Job is created, so the
+// trainer environment points at it. W&B runs get a fixed ID the trainer creates or resumes;
+// MLflow runs are created on the tracking server. The run is persisted right away, so every
+// attempt of the job logs to the same run.
+func (tm *TrackingManager) EnsureRun(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) error {
+	tracking := job.Spec.ExperimentTracking
+	if tracking == nil || job.Status.TrackingRunID != "" {
+		return nil
+	}
+	base := job.DeepCopy()
+
+	switch tracking.Provider {
+	case torchrunv1alpha1.TrackingProviderWandb:
+		job.Status.TrackingRunID = job.Spec.JobID
+		job.Status.TrackingURL = buildWandbRunURL(tracking, job.Spec.JobID)
+	case torchrunv1alpha1.TrackingProviderMLflow:
+		experimentID, runID, err := tm.createMLflowRun(ctx, job)
+		if err != nil {
+			return err
+		}
+		job.Status.TrackingRunID = runID
+		job.Status.TrackingURL = fmt.Sprintf("%s/#/experiments/%s/runs/%s", strings.TrimSuffix(tracking.URL, "/"), experimentID, runID)
+	default:
+		return fmt.Errorf("unknown experiment tracking provider %q", tracking.Provider)
+	}
+
+	log.FromContext(ctx).Info("Linked experiment tracking run", "name", job.Name, "provider", tracking.Provider, "run", job.Status.TrackingRunID)
+	return patch.Status(ctx, tm.client, job, base)
+}
+
+// buildWandbRunURL returns the W&B page of the run, or an empty URL if the entity is unknown
+func buildWandbRunURL(tracking *torchrunv1alpha1.ExperimentTrackingConfig, runID string) string {
+	if tracking.Entity == "" {
+		return ""
+	}
+	host := strings.TrimSuffix(tracking.URL, "/")
+	if host == "" || host == wandbAPIURL {
+		host = wandbAppURL
+	}
+	return fmt.Sprintf("%s/%s/%s/runs/%s", host, tracking.Entity, tracking.Project, runID)
+}
+
+// createMLflowRun creates a run for the job in its MLflow experiment, creating the experiment
+// if it does not exist, and returns the experiment and run IDs
+func (tm *TrackingManager) createMLflowRun(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) (string, string, error) {
+	tracking := job.Spec.ExperimentTracking
+	var secret *corev1.Secret
+	if tracking.SecretRef != nil {
+		secret = &corev1.Secret{}
+		if err := tm.apiReader.Get(ctx, types.NamespacedName{Name: tracking.SecretRef.Name, Namespace: job.Namespace}, secret); err != nil {
+			return "", "", err
+		}
+	}
+
+	var experiment struct {
+		Experiment struct {
+			ExperimentID string `json:"experiment_id"`
+		} `json:"experiment"`
+	}
+	found, err := tm.callMLflow(ctx, tracking, secret, http.MethodGet,
+		"experiments/get-by-name?experiment_name="+url.QueryEscape(tracking.Project), nil, &experiment)
+	if err != nil {
+		return "", "", err
+	}
+	experimentID := experiment.Experiment.ExperimentID
+	if !found {
+		var created struct {
+			ExperimentID string `json:"experiment_id"`
+		}
+		if _, err := tm.callMLflow(ctx, tracking, secret, http.MethodPost, "experiments/create",
+			map[string]string{"name": tracking.Project}, &created); err != nil {
+			return "", "", err
+		}
+		experimentID = created.ExperimentID
+	}
+
+	var run struct {
+		Run struct {
+			Info struct {
+				RunID string `json:"run_id"`
+			} `json:"info"`
+		} `json:"run"`
+	}
+	if _, err := tm.callMLflow(ctx, tracking, secret, http.MethodPost, "runs/create", map[string]interface{}{
+		"experiment_id": experimentID,
+		"run_name":      job.Name,
+		"start_time":    time.Now().UnixMilli(),
+		"tags": []map[string]string{
+			{"key": "torchrun.ai/job-id", "value": job.Spec.JobID},
+			{"key": "torchrun.ai/job-queue", "value": job.Spec.Queue},
+		},
+	}, &run); err != nil {
+		return "", "", err
+	}
+	if run.Run.Info.RunID == "" {
+		return "", "", fmt.Errorf("MLflow did not return a run ID")
+	}
+	return experimentID, run.Run.Info.RunID, nil
+}
+
+// callMLflow calls the MLflow REST API with the credentials of the tracking Secret and decodes
+// the response into out. It returns false if the resource does not exist.
+func (tm *TrackingManager) callMLflow(ctx context.Context, tracking *torchrunv1alpha1.ExperimentTrackingConfig, secret *corev1.Secret, method, path string, body, out interface{}) (bool, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return false, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(tracking.URL, "/")+"/api/2.0/mlflow/"+path, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != nil {
+		if token := string(secret.Data["MLFLOW_TRACKING_TOKEN"]); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else if user := string(secret.Data["MLFLOW_TRACKING_USERNAME"]); user != "" {
+			req.SetBasicAuth(user, string(secret.Data["MLFLOW_TRACKING_PASSWORD"]))
+		}
+	}
+
+	resp, err := tm.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode >= 300 {
+		return false, fmt.Errorf("MLflow %s %s responded with %s", method, path, resp.Status)
+	}
+	return true, json.NewDecoder(resp.Body).Decode(out)
+}
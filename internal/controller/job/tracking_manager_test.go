@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestEnsureRun(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	// A minimal MLflow server with the experiment "existing"
+	var runRequest map[string]interface{}
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/api/2.0/mlflow/experiments/get-by-name":
+			if r.URL.Query().Get("experiment_name") != "existing" {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error_code":"RESOURCE_DOES_NOT_EXIST"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"experiment":{"experiment_id":"7","name":"existing"}}`))
+		case "/api/2.0/mlflow/experiments/create":
+			_, _ = w.Write([]byte(`{"experiment_id":"8"}`))
+		case "/api/2.0/mlflow/runs/create":
+			runRequest = map[string]interface{}{}
+			if err := json.NewDecoder(r.Body).Decode(&runRequest); err != nil {
+				t.Errorf("failed to decode run: %v", err)
+			}
+			_, _ = w.Write([]byte(`{"run":{"info":{"run_id":"abc123"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "mlflow", Namespace: "default"},
+		Data:       map[string][]byte{"MLFLOW_TRACKING_TOKEN": []byte("token")},
+	}
+
+	tests := []struct {
+		description         string
+		tracking            *torchrunv1alpha1.ExperimentTrackingConfig
+		runID               string
+		expectRunID         string
+		expectURL           string
+		expectExperiment    string
+		expectAuthorization string
+	}{
+		{
+			description: "job without experiment tracking has no run",
+		},
+		{
+			description: "W&B run is the job ID",
+			tracking:    &torchrunv1alpha1.ExperimentTrackingConfig{Provider: "wandb", Project: "vision", Entity: "research"},
+			expectRunID: "train-id",
+			expectURL:   "https://wandb.ai/research/vision/runs/train-id",
+		},
+		{
+			description: "self-hosted W&B run links to the server",
+			tracking:    &torchrunv1alpha1.ExperimentTrackingConfig{Provider: "wandb", Project: "vision", Entity: "research", URL: "https://wandb.example.com/"},
+			expectRunID: "train-id",
+			expectURL:   "https://wandb.example.com/research/vision/runs/train-id",
+		},
+		{
+			description: "W&B run without entity has no link",
+			tracking:    &torchrunv1alpha1.ExperimentTrackingConfig{Provider: "wandb", Project: "vision"},
+			expectRunID: "train-id",
+		},
+		{
+			description:         "MLflow run is created in the existing experiment",
+			tracking:            &torchrunv1alpha1.ExperimentTrackingConfig{Provider: "mlflow", Project: "existing", URL: server.URL, SecretRef: &corev1.LocalObjectReference{Name: "mlflow"}},
+			expectRunID:         "abc123",
+			expectURL:           server.URL + "/#/experiments/7/runs/abc123",
+			expectExperiment:    "7",
+			expectAuthorization: "Bearer token",
+		},
+		{
+			description:      "MLflow experiment is created if missing",
+			tracking:         &torchrunv1alpha1.ExperimentTrackingConfig{Provider: "mlflow", Project: "new", URL: server.URL},
+			expectRunID:      "abc123",
+			expectURL:        server.URL + "/#/experiments/8/runs/abc123",
+			expectExperiment: "8",
+		},
+		{
+			description: "recorded run is kept",
+			tracking:    &torchrunv1alpha1.ExperimentTrackingConfig{Provider: "mlflow", Project: "existing", URL: server.URL},
+			runID:       "previous",
+			expectRunID: "previous",
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{JobName: "train", JobID: "train-id", ExperimentTracking: test.tracking},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{TrackingRunID: test.runID},
+		}
+		runRequest = nil
+		authorization = ""
+
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(job, secret).WithStatusSubresource(job).Build()
+		tm := NewTrackingManager(c, c)
+		if err := tm.EnsureRun(context.Background(), job); err != nil {
+			t.Fatalf("%s: EnsureRun() error = %v", test.description, err)
+		}
+
+		if job.Status.TrackingRunID != test.expectRunID || job.Status.TrackingURL != test.expectURL {
+			t.Errorf("%s: expected run %q at %q, got %q at %q", test.description, test.expectRunID, test.expectURL, job.Status.TrackingRunID, job.Status.TrackingURL)
+		}
+		if test.expectExperiment != "" && (runRequest == nil || runRequest["experiment_id"] != test.expectExperiment || runRequest["run_name"] != "train") {
+			t.Errorf("%s: expected run in experiment %s, got %v", test.description, test.expectExperiment, runRequest)
+		}
+		if authorization != test.expectAuthorization {
+			t.Errorf("%s: expected authorization %q, got %q", test.description, test.expectAuthorization, authorization)
+		}
+
+		// The run is persisted so later attempts log to the same run
+		persisted := &torchrunv1alpha1.TorchrunJob{}
+		if err := c.Get(context.Background(), types.NamespacedName{Name: "train", Namespace: "default"}, persisted); err != nil {
+			t.Fatalf("%s: failed to get job: %v", test.description, err)
+		}
+		if test.runID == "" && persisted.Status.TrackingRunID != test.expectRunID {
+			t.Errorf("%s: expected persisted run %q, got %q", test.description, test.expectRunID, persisted.Status.TrackingRunID)
+		}
+	}
+}
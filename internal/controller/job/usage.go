@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// gpuSecondsCounter counts the GPU time of the jobs per queue, for charging teams back against
+// their quota
+var gpuSecondsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "torchrun_queue_gpu_seconds_total",
+	Help: "GPU time the worker pods of the jobs of a TorchrunQueue used, in seconds.",
+}, []string{"namespace", "queue"})
+
+func init() {
+	metrics.Registry.MustRegister(gpuSecondsCounter)
+}
+
+// updateGPUSeconds adds the GPU time the listed worker pods used since they were last listed to
+// the GPU time of the job. Pods no longer listed, e.g. those of failed attempts or of a finished
+// Job removed after its TTL, stay counted with the GPU time they had when they were last listed.
+func updateGPUSeconds(job *torchrunv1alpha1.TorchrunJob, workers []torchrunv1alpha1.WorkerPodStatus) {
+	previous := make(map[string]int64, len(job.Status.Workers.Pods))
+	for _, worker := range job.Status.Workers.Pods {
+		previous[worker.Name] = worker.GPUSeconds
+	}
+	total := job.Status.GPUSeconds
+	for _, worker := range workers {
+		if delta := worker.GPUSeconds - previous[worker.Name]; delta > 0 {
+			total += delta
+		}
+	}
+	job.Status.GPUSeconds = total
+}
+
+// getPodGPUSeconds returns the GPU time of a worker pod: the GPUs of the trainer container
+// times the time from the start of the pod until the trainer ended, or until now while it runs
+func getPodGPUSeconds(pod *corev1.Pod, now time.Time) int64 {
+	gpus := getTrainerGPUs(&pod.Spec)
+	if gpus == 0 || pod.Status.StartTime == nil {
+		return 0
+	}
+	duration := getTrainerEndTime(pod, now).Sub(pod.Status.StartTime.Time)
+	if duration <= 0 {
+		return 0
+	}
+	return int64(gpus) * int64(duration.Seconds())
+}
+
+// getTrainerEndTime returns when the trainer container of a pod ended. Pods that finished
+// without a terminated trainer, e.g. after an eviction, end with their last condition change.
+func getTrainerEndTime(pod *corev1.Pod, now time.Time) time.Time {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == "trainer" && status.State.Terminated != nil {
+			return status.State.Terminated.FinishedAt.Time
+		}
+	}
+	if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+		return now
+	}
+	end := pod.Status.StartTime.Time
+	for _, condition := range pod.Status.Conditions {
+		if condition.LastTransitionTime.After(end) {
+			end = condition.LastTransitionTime.Time
+		}
+	}
+	return end
+}
+
+// recordGPUUsage adds the GPU time the job used since base, the job as it was read, to the
+// counter of its queue
+func recordGPUUsage(job, base *torchrunv1alpha1.TorchrunJob) {
+	if delta := job.Status.GPUSeconds - base.Status.GPUSeconds; delta > 0 {
+		gpuSecondsCounter.WithLabelValues(getQueueNamespace(job), job.Spec.Queue).Add(float64(delta))
+	}
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestGetPodGPUSeconds(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	start := metav1.NewTime(now.Add(-time.Hour))
+	pod := func(gpus string, phase corev1.PodPhase) *corev1.Pod {
+		pod := &corev1.Pod{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer"}}},
+			Status: corev1.PodStatus{
+				Phase:     phase,
+				StartTime: &start,
+			},
+		}
+		if gpus != "" {
+			pod.Spec.Containers[0].Resources.Requests = corev1.ResourceList{gpuResourceName: resource.MustParse(gpus)}
+		}
+		return pod
+	}
+
+	tests := []struct {
+		description string
+		pod         *corev1.Pod
+		expected    int64
+	}{
+		{
+			description: "running pod counts until now",
+			pod:         pod("8", corev1.PodRunning),
+			expected:    8 * 3600,
+		},
+		{
+			description: "pod without GPUs uses no GPU time",
+			pod:         pod("", corev1.PodRunning),
+		},
+		{
+			description: "pod that did not start uses no GPU time",
+			pod: func() *corev1.Pod {
+				pod := pod("8", corev1.PodPending)
+				pod.Status.StartTime = nil
+				return pod
+			}(),
+		},
+		{
+			description: "pod counts until its trainer terminated",
+			pod: func() *corev1.Pod {
+				pod := pod("4", corev1.PodRunning)
+				pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+					Name:  "trainer",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{FinishedAt: metav1.NewTime(now.Add(-30 * time.Minute))}},
+				}}
+				return pod
+			}(),
+			expected: 4 * 1800,
+		},
+		{
+			description: "evicted pod counts until its last condition change",
+			pod: func() *corev1.Pod {
+				pod := pod("2", corev1.PodFailed)
+				pod.Status.Conditions = []corev1.PodCondition{
+					{Type: corev1.PodScheduled, LastTransitionTime: metav1.NewTime(now.Add(-2 * time.Hour))},
+					{Type: corev1.PodReady, LastTransitionTime: metav1.NewTime(now.Add(-15 * time.Minute))},
+				}
+				return pod
+			}(),
+			expected: 2 * 2700,
+		},
+	}
+
+	for _, test := range tests {
+		if actual := getPodGPUSeconds(test.pod, now); actual != test.expected {
+			t.Errorf("%s: expected %d GPU seconds, got %d", test.description, test.expected, actual)
+		}
+	}
+}
+
+func TestUpdateGPUSeconds(t *testing.T) {
+	worker := func(name string, gpuSeconds int64) torchrunv1alpha1.WorkerPodStatus {
+		return torchrunv1alpha1.WorkerPodStatus{Name: name, GPUSeconds: gpuSeconds}
+	}
+
+	tests := []struct {
+		description string
+		gpuSeconds  int64
+		previous    []torchrunv1alpha1.WorkerPodStatus
+		workers     []torchrunv1alpha1.WorkerPodStatus
+		expected    int64
+	}{
+		{
+			description: "GPU time of the listed pods is summed",
+			workers:     []torchrunv1alpha1.WorkerPodStatus{worker("train-0", 100), worker("train-1", 200)},
+			expected:    300,
+		},
+		{
+			description: "listed pods add the GPU time since the last update",
+			gpuSeconds:  300,
+			previous:    []torchrunv1alpha1.WorkerPodStatus{worker("train-0", 100), worker("train-1", 200)},
+			workers:     []torchrunv1alpha1.WorkerPodStatus{worker("train-0", 150), worker("train-1", 250)},
+			expected:    400,
+		},
+		{
+			description: "pods of a failed attempt keep their GPU time",
+			gpuSeconds:  300,
+			previous:    []torchrunv1alpha1.WorkerPodStatus{worker("train-0", 100), worker("train-1", 200)},
+			workers:     []torchrunv1alpha1.WorkerPodStatus{worker("train-attempt-2-0", 10)},
+			expected:    310,
+		},
+		{
+			description: "removed pods of a finished Job keep their GPU time",
+			gpuSeconds:  500,
+			previous:    []torchrunv1alpha1.WorkerPodStatus{worker("train-0", 100), worker("train-1", 200)},
+			expected:    500,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{Status: torchrunv1alpha1.TorchrunJobStatus{
+			GPUSeconds: test.gpuSeconds,
+			Workers:    torchrunv1alpha1.WorkerStatus{Pods: test.previous},
+		}}
+		updateGPUSeconds(job, test.workers)
+		if job.Status.GPUSeconds != test.expected {
+			t.Errorf("%s: expected %d GPU seconds, got %d", test.description, test.expected, job.Status.GPUSeconds)
+		}
+	}
+}
@@ -2,10 +2,12 @@ package controller
 
 import (
 	"fmt"
+	"strings"
 
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 
-	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/internal/v1alpha1"
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
 )
 
 // GetWorkspacePVCName returns the consistent name for the workspace PVC
@@ -13,12 +15,321 @@ func GetWorkspacePVCName(job *torchrunv1alpha1.TorchrunJob) string {
 	return fmt.Sprintf("%s-workspace", job.Spec.JobName)
 }
 
+// GetTensorboardName returns the consistent name for the TensorBoard Deployment, Service and Ingress
+func GetTensorboardName(job *torchrunv1alpha1.TorchrunJob) string {
+	return fmt.Sprintf("%s-tensorboard", job.Name)
+}
+
+// GetNotebookName returns the consistent name for the notebook Secret, Service and Ingress
+func GetNotebookName(job *torchrunv1alpha1.TorchrunJob) string {
+	return fmt.Sprintf("%s-notebook", job.Name)
+}
+
 // GetSyncPodName returns the consistent name for the sync pod
 func GetSyncPodName(job *torchrunv1alpha1.TorchrunJob) string {
 	return fmt.Sprintf("%s-sync", job.Name)
 }
 
+// GetPreflightJobName returns the consistent name for the preflight Job
+func GetPreflightJobName(job *torchrunv1alpha1.TorchrunJob) string {
+	return fmt.Sprintf("%s-preflight", job.Name)
+}
+
+// GetLogArchivePodName returns the consistent name for the log collector pod
+func GetLogArchivePodName(job *torchrunv1alpha1.TorchrunJob) string {
+	return fmt.Sprintf("%s-logs", job.Name)
+}
+
+// GetArtifactsPodName returns the consistent name for the artifacts collector pod
+func GetArtifactsPodName(job *torchrunv1alpha1.TorchrunJob) string {
+	return fmt.Sprintf("%s-artifacts", job.Name)
+}
+
+// GetWorkerServiceName returns the consistent name for the headless Service of the worker pods
+func GetWorkerServiceName(job *torchrunv1alpha1.TorchrunJob) string {
+	return fmt.Sprintf("%s-workers", job.Name)
+}
+
+// GetPodDisruptionBudgetName returns the consistent name for the PodDisruptionBudget of the worker pods
+func GetPodDisruptionBudgetName(job *torchrunv1alpha1.TorchrunJob) string {
+	return fmt.Sprintf("%s-workers", job.Name)
+}
+
+// GetProvisioningRequestName returns the consistent name for the ProvisioningRequest of the
+// workers and the PodTemplate it references
+func GetProvisioningRequestName(job *torchrunv1alpha1.TorchrunJob) string {
+	return fmt.Sprintf("%s-provisioning", job.Name)
+}
+
+// GetJobRecordName returns the consistent name for the TorchrunJobRecord of a job. The UID tells
+// apart the records of jobs recreated under the same name.
+func GetJobRecordName(job *torchrunv1alpha1.TorchrunJob) string {
+	uid := string(job.UID)
+	if len(uid) > 8 {
+		uid = uid[:8]
+	}
+	return fmt.Sprintf("%s-%s", job.Name, uid)
+}
+
+// GetWorkspaceSnapshotName returns the consistent name for the VolumeSnapshot of the workspace of
+// a finished job. The UID tells apart the snapshots of jobs recreated under the same name.
+func GetWorkspaceSnapshotName(job *torchrunv1alpha1.TorchrunJob) string {
+	uid := string(job.UID)
+	if len(uid) > 8 {
+		uid = uid[:8]
+	}
+	return fmt.Sprintf("%s-workspace-%s", job.Name, uid)
+}
+
+// getQueueNamespace returns the namespace of the TorchrunQueue of the job
+func getQueueNamespace(job *torchrunv1alpha1.TorchrunJob) string {
+	if job.Spec.QueueNamespace != "" {
+		return job.Spec.QueueNamespace
+	}
+	return job.Namespace
+}
+
+// GetJobName returns the name of the Kubernetes Job of the current attempt
+func GetJobName(job *torchrunv1alpha1.TorchrunJob) string {
+	return getAttemptJobName(job, job.Status.Attempt)
+}
+
+// getAttemptJobName returns the name of the Kubernetes Job of an attempt. The first attempt
+// keeps the name of the TorchrunJob.
+func getAttemptJobName(job *torchrunv1alpha1.TorchrunJob, attempt int32) string {
+	if attempt <= 1 {
+		return job.Name
+	}
+	return fmt.Sprintf("%s-attempt-%d", job.Name, attempt)
+}
+
 // completionModePtr returns a pointer to a completion mode
 func completionModePtr(mode batchv1.CompletionMode) *batchv1.CompletionMode {
 	return &mode
 }
+
+// gpuResourceName is the resource name of whole GPUs
+const gpuResourceName corev1.ResourceName = "nvidia.com/gpu"
+
+// getTrainerGPUs returns the nvidia.com/gpu request of the trainer container
+func getTrainerGPUs(podSpec *corev1.PodSpec) int {
+	for _, container := range podSpec.Containers {
+		if container.Name == "trainer" {
+			if val, ok := container.Resources.Requests[gpuResourceName]; ok {
+				return int(val.Value())
+			}
+		}
+	}
+	return 0
+}
+
+// getNprocPerNode returns the number of worker processes torchrun starts per node: one per GPU of
+// the trainer, one for workers on a shared GPU, or the processes of the profile of the job
+func getNprocPerNode(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) int {
+	if sharesGPU(job) {
+		return 1
+	}
+	if profile, _ := getJobProfile(job, jq); profile != nil && profile.NprocPerNode > 0 {
+		return int(profile.NprocPerNode)
+	}
+	return getTrainerGPUs(podSpec)
+}
+
+// getRdzvEndpoint returns the rendezvous endpoint of the queue, preferring the etcd the queue
+// controller provisioned over the configured endpoint
+func getRdzvEndpoint(jq *torchrunv1alpha1.TorchrunQueue) string {
+	if jq.Status.RdzvEndpoint != "" {
+		return jq.Status.RdzvEndpoint
+	}
+	return jq.Spec.Distributed.RdzvEndpoint
+}
+
+// defaultMasterPort is the port of the rank 0 worker of queues without a distributed port
+const defaultMasterPort = 29500
+
+// getMasterAddr returns the DNS name of the rank 0 worker of the current attempt. Indexed Jobs
+// name their pods <job>-<index>, which the headless worker Service publishes.
+func getMasterAddr(job *torchrunv1alpha1.TorchrunJob) string {
+	return fmt.Sprintf("%s-0.%s.%s.svc", GetJobName(job), GetWorkerServiceName(job), job.Namespace)
+}
+
+// getMasterPort returns the port of the rank 0 worker
+func getMasterPort(jq *torchrunv1alpha1.TorchrunQueue) int32 {
+	if jq.Spec.Distributed.Port != 0 {
+		return jq.Spec.Distributed.Port
+	}
+	return defaultMasterPort
+}
+
+// getJobRdzvEndpoint returns the rendezvous endpoint of the job: the rank 0 worker for the static
+// backend, which needs no etcd, otherwise the endpoint of the queue
+func getJobRdzvEndpoint(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) string {
+	if jq.Spec.Distributed.RdzvBackend == "static" {
+		return fmt.Sprintf("%s:%d", getMasterAddr(job), getMasterPort(jq))
+	}
+	return getRdzvEndpoint(jq)
+}
+
+// getRdzvID returns the torchrun rendezvous id of the job. Jobs of the same jobName in other
+// namespaces or earlier runs may rendezvous on the same etcd, so the id is prefixed with the
+// namespace and job id. Jobs keep the id of their first Job, and jobs whose Job was created
+// before the prefix keep the jobName, so running jobs never change rendezvous.
+func getRdzvID(job *torchrunv1alpha1.TorchrunJob) string {
+	if job.Status.RdzvID != "" {
+		return job.Status.RdzvID
+	}
+	if isConditionTrue(job, "JobCreated") {
+		return job.Spec.JobName
+	}
+	return fmt.Sprintf("%s-%s-%s", job.Namespace, job.Spec.JobID, job.Spec.JobName)
+}
+
+// isDebugJob returns true if the job runs an idle worker to exec into instead of training
+func isDebugJob(job *torchrunv1alpha1.TorchrunJob) bool {
+	return job.Spec.Mode == torchrunv1alpha1.ModeDebug
+}
+
+// isNotebookJob returns true if the job runs a Jupyter server instead of training
+func isNotebookJob(job *torchrunv1alpha1.TorchrunJob) bool {
+	return job.Spec.Mode == torchrunv1alpha1.ModeNotebook
+}
+
+// isInteractiveJob returns true if the worker of the job does not run torchrun by itself, so the
+// features following the training processes do not apply
+func isInteractiveJob(job *torchrunv1alpha1.TorchrunJob) bool {
+	return isDebugJob(job) || isNotebookJob(job)
+}
+
+// sharesGPU returns true if the workers of the job get a share of one GPU
+func sharesGPU(job *torchrunv1alpha1.TorchrunJob) bool {
+	return job.Spec.GPUFraction != "" || job.Spec.GPUMemory > 0
+}
+
+// isTerminalPhase returns true if the phase is a final job phase
+func isTerminalPhase(phase string) bool {
+	switch phase {
+	case torchrunv1alpha1.PhaseSucceeded,
+		torchrunv1alpha1.PhaseFailed,
+		torchrunv1alpha1.PhaseTimedOut,
+		torchrunv1alpha1.PhaseDeleted:
+		return true
+	}
+	return false
+}
+
+// isConditionTrue returns true if the job has the given condition set to True
+func isConditionTrue(job *torchrunv1alpha1.TorchrunJob, condType string) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == condType {
+			return condition.Status == "True"
+		}
+	}
+	return false
+}
+
+// hasCondition returns true if the job has the given condition
+func hasCondition(job *torchrunv1alpha1.TorchrunJob, condType string) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == condType {
+			return true
+		}
+	}
+	return false
+}
+
+// getConditionStatus returns the status of the given condition of the job, or an empty string
+// if the job does not have it
+func getConditionStatus(job *torchrunv1alpha1.TorchrunJob, condType string) string {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == condType {
+			return condition.Status
+		}
+	}
+	return ""
+}
+
+// priorityClassNames maps TorchrunJob priorities to kai-scheduler priority classes
+var priorityClassNames = map[string]string{
+	torchrunv1alpha1.PriorityPreemptible: "train",
+	torchrunv1alpha1.PriorityNormal:      "build",
+	torchrunv1alpha1.PriorityHigh:        "inference",
+}
+
+// getPriorityClassName returns the priority class of the worker pods: the priority class the
+// queue enforces, otherwise the one of the job priority
+func getPriorityClassName(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) string {
+	if constraints := jq.Spec.SchedulingConstraints; constraints != nil && constraints.PriorityClassName != "" {
+		return constraints.PriorityClassName
+	}
+	if priority := getJobPriority(job, jq); priority != "" {
+		return priorityClassNames[priority]
+	}
+	return ""
+}
+
+// getJobPriority returns the priority of the job, falling back to the queue default
+func getJobPriority(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) string {
+	if job.Spec.Priority != "" {
+		return job.Spec.Priority
+	}
+	return jq.Spec.Priorities.Default
+}
+
+// getSchedulerName returns the scheduler of the job pods: the scheduler of the job if set,
+// otherwise the scheduler of the TorchrunQueue, otherwise the default of the operator
+func getSchedulerName(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, defaultScheduler string) string {
+	if job.Spec.SchedulerName != "" {
+		return job.Spec.SchedulerName
+	}
+	if jq.Spec.SchedulerName != "" {
+		return jq.Spec.SchedulerName
+	}
+	return defaultScheduler
+}
+
+// getKaiQueueName returns the kai-scheduler queue the job pods are scheduled in: the child queue
+// of the job if set, otherwise the queue of the TorchrunQueue
+func getKaiQueueName(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) string {
+	if job.Spec.ChildQueue != "" {
+		return job.Spec.ChildQueue
+	}
+	return jq.Spec.Queue.Name
+}
+
+// getCapacityType returns the capacity type the job workers are placed on: the recorded
+// capacity decision if there is one, otherwise the requested capacity type
+func getCapacityType(job *torchrunv1alpha1.TorchrunJob) string {
+	if job.Status.Capacity != nil {
+		return job.Status.Capacity.Type
+	}
+	return job.Spec.CapacityType
+}
+
+// getChildQueueNames returns the names of the child kai-scheduler queues of the queue
+func getChildQueueNames(jq *torchrunv1alpha1.TorchrunQueue) []string {
+	names := make([]string, 0, len(jq.Spec.Queue.Children))
+	for _, child := range jq.Spec.Queue.Children {
+		names = append(names, child.Name)
+	}
+	return names
+}
+
+// isJobFinished returns true if the Kubernetes Job completed or failed
+func isJobFinished(k8sJob *batchv1.Job) bool {
+	for _, condition := range k8sJob.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// isJobRunning returns true if any pod of the Kubernetes Job is ready, i.e. training started
+func isJobRunning(k8sJob *batchv1.Job) bool {
+	return k8sJob.Status.Ready != nil && *k8sJob.Status.Ready > 0
+}
+
+// shellQuote quotes s as a single word for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// ValidateJob checks a TorchrunJob against its TorchrunQueue as admission does, without reading
+// the cluster: the pod template of the queue patched by the job, the child queue, profile,
+// priority, size and quota checks. Queue bindings and the per-user limit depend on the cluster
+// and are not checked. A job with templateRef or cloneFrom is checked as written, so fields its
+// template or cloned job provides are not required. schedulerName is the scheduler of queues and
+// jobs that do not name one, as in the operator config.
+func ValidateJob(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, schedulerName string) error {
+	var errs []error
+	if job.Spec.Queue != "" && job.Spec.Queue != jq.Name {
+		errs = append(errs, fmt.Errorf("job is submitted to queue %s, not %s", job.Spec.Queue, jq.Name))
+	}
+	if namespace := getQueueNamespace(job); namespace != "" && jq.Namespace != "" && namespace != jq.Namespace {
+		errs = append(errs, fmt.Errorf("job is submitted to a queue of namespace %s, not %s", namespace, jq.Namespace))
+	}
+	if job.Spec.Command == "" && !isNotebookJob(job) && job.Spec.TemplateRef == nil && job.Spec.CloneFrom == nil {
+		errs = append(errs, fmt.Errorf("MissingCommand: job has no command"))
+	}
+
+	podSpec, err := getPodSpec(job, jq)
+	if err == nil {
+		err = (&JobManager{}).validatePodSpec(podSpec)
+	}
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid pod template: %w", err))
+	}
+
+	decision, err := NewAdmissionManager(nil, schedulerName).checkSpec(job, jq)
+	if err != nil {
+		errs = append(errs, err)
+	} else if decision != nil {
+		errs = append(errs, fmt.Errorf("%s: %s", decision.Reason, decision.Message))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestValidateJob(t *testing.T) {
+	queue := func(podSpec string) *torchrunv1alpha1.TorchrunQueue {
+		return &torchrunv1alpha1.TorchrunQueue{
+			ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "ml"},
+			Spec: torchrunv1alpha1.JobQueueSpec{
+				Queue:             torchrunv1alpha1.QueueConfig{Name: "research"},
+				PodTemplateConfig: torchrunv1alpha1.PodTemplateConfig{Spec: runtime.RawExtension{Raw: []byte(podSpec)}},
+				Limits:            torchrunv1alpha1.QueueLimits{MaxNodesPerJob: 4, MaxGPUsPerJob: 16},
+			},
+		}
+	}
+	trainer := `{"containers":[{"name":"trainer","resources":{"requests":{"nvidia.com/gpu":"8"}}}]}`
+
+	tests := []struct {
+		description  string
+		spec         torchrunv1alpha1.TorchrunJobSpec
+		podSpec      string
+		expectErrors []string
+	}{
+		{
+			description: "job within the limits",
+			spec:        torchrunv1alpha1.TorchrunJobSpec{Queue: "research", Command: "python train.py", NumNodes: 2},
+			podSpec:     trainer,
+		},
+		{
+			description: "templated job without command",
+			spec:        torchrunv1alpha1.TorchrunJobSpec{Queue: "research", TemplateRef: &corev1.LocalObjectReference{Name: "llama"}, NumNodes: 1},
+			podSpec:     trainer,
+		},
+		{
+			description:  "job of another queue",
+			spec:         torchrunv1alpha1.TorchrunJobSpec{Queue: "dev", Command: "python train.py", NumNodes: 1},
+			podSpec:      trainer,
+			expectErrors: []string{"job is submitted to queue dev, not research"},
+		},
+		{
+			description:  "every problem is reported",
+			spec:         torchrunv1alpha1.TorchrunJobSpec{Queue: "research", NumNodes: 3},
+			podSpec:      trainer,
+			expectErrors: []string{"MissingCommand", "MaxGPUsExceeded: job requests 24 GPUs but queue research allows at most 16"},
+		},
+		{
+			description:  "unknown profile",
+			spec:         torchrunv1alpha1.TorchrunJobSpec{Queue: "research", Command: "python train.py", NumNodes: 1, Profile: "8xa100"},
+			podSpec:      trainer,
+			expectErrors: []string{"UnknownProfile"},
+		},
+		{
+			description:  "pod template without trainer",
+			spec:         torchrunv1alpha1.TorchrunJobSpec{Queue: "research", Command: "python train.py", NumNodes: 1},
+			podSpec:      `{"containers":[{"name":"main"}]}`,
+			expectErrors: []string{"invalid pod template: first container must be named 'trainer'"},
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "ml"},
+			Spec:       test.spec,
+		}
+		err := ValidateJob(job, queue(test.podSpec), config.KaiSchedulerName)
+		if len(test.expectErrors) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.description, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected errors %q", test.description, test.expectErrors)
+			continue
+		}
+		for _, expected := range test.expectErrors {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("%s: expected error %q, got %v", test.description, expected, err)
+			}
+		}
+	}
+}
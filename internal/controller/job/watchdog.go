@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+const (
+	// watchdogVolumeName is the emptyDir shared by the trainer and the watchdog
+	watchdogVolumeName = "torchrun-watchdog"
+
+	// watchdogMountPath is where the watchdog volume is mounted in both containers
+	watchdogMountPath = "/var/run/torchrun-watchdog"
+
+	// watchdogStopGracePeriodSeconds is how long the torchrun agent gets to stop its workers
+	// after SIGTERM before the watchdog kills it
+	watchdogStopGracePeriodSeconds = 30
+)
+
+// watchdogScript restarts training when it stops making progress. Progress is the modification
+// time of the heartbeat file, or a successful TCP connection to the rendezvous endpoint.
+// Training is restarted by stopping the torchrun agent, which is found by its --rdzv-id argument
+// in the shared process namespace; the trainer shell only has the whole command as one argument.
+const watchdogScript = `
+last_progress=$(( $(date +%s) + WATCHDOG_STARTUP_GRACE ))
+while sleep "$WATCHDOG_CHECK_INTERVAL"; do
+  now=$(date +%s)
+  case "$WATCHDOG_MODE" in
+    tcpStore)
+      if nc -z -w 5 "${RDZV_ENDPOINT%:*}" "${RDZV_ENDPOINT##*:}"; then last_progress=$now; fi
+      ;;
+    *)
+      if [ -f "$TORCHRUN_HEARTBEAT_FILE" ]; then
+        heartbeat=$(stat -c %Y "$TORCHRUN_HEARTBEAT_FILE")
+        if [ "$heartbeat" -gt "$last_progress" ]; then last_progress=$heartbeat; fi
+      fi
+      ;;
+  esac
+
+  stalled=$(( now - last_progress ))
+  if [ "$stalled" -lt "$WATCHDOG_STALL_TIMEOUT" ]; then continue; fi
+
+  echo "torchrun-watchdog: no progress for ${stalled}s, restarting training" >&2
+  pids=""
+  for p in /proc/[0-9]*; do
+    if tr '\0' '\n' < "$p/cmdline" 2>/dev/null | grep -A1 -x -- '--rdzv-id' | grep -qxF -- "$WATCHDOG_RDZV_ID"; then
+      pids="$pids ${p#/proc/}"
+    fi
+  done
+  if [ -z "$pids" ]; then
+    echo "torchrun-watchdog: torchrun agent not found" >&2
+  else
+    kill -TERM $pids
+    deadline=$(( $(date +%s) + WATCHDOG_STOP_GRACE ))
+    for pid in $pids; do
+      while [ -d "/proc/$pid" ] && [ "$(date +%s)" -lt "$deadline" ]; do sleep 1; done
+      if [ -d "/proc/$pid" ]; then
+        echo "torchrun-watchdog: torchrun agent $pid ignored SIGTERM, sending SIGKILL" >&2
+        kill -KILL "$pid"
+      fi
+    done
+  fi
+  last_progress=$(( $(date +%s) + WATCHDOG_STARTUP_GRACE ))
+done
+`
+
+// attachWatchdog injects the watchdog sidecar when enabled. It must run after the trainer
+// command is built and before the sidecar lifecycle is attached, so the watchdog is stopped
+// together with the other sidecars.
+func (jm *JobManager) attachWatchdog(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, podSpec *corev1.PodSpec) {
+	// Idle debug workers and notebooks send no heartbeats
+	watchdog := job.Spec.Reliability.Watchdog
+	if !watchdog.Enabled || isInteractiveJob(job) {
+		return
+	}
+
+	// Single node jobs rendezvous on a random local port, so only heartbeats can be checked
+	mode := watchdog.Mode
+	if mode == "" || job.Spec.NumNodes <= 1 {
+		mode = "heartbeat"
+	}
+	stallTimeout := watchdog.StallTimeoutSeconds
+	if stallTimeout == 0 {
+		stallTimeout = 600
+	}
+	checkInterval := watchdog.CheckIntervalSeconds
+	if checkInterval == 0 {
+		checkInterval = 30
+	}
+	image := watchdog.Image
+	if image == "" {
+		image = jm.config.Images.Watchdog
+	}
+	heartbeatFile := watchdogMountPath + "/heartbeat"
+
+	// The watchdog has to see the torchrun agent to stop it
+	shareProcessNamespace := true
+	podSpec.ShareProcessNamespace = &shareProcessNamespace
+
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: watchdogVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	})
+	mount := corev1.VolumeMount{Name: watchdogVolumeName, MountPath: watchdogMountPath}
+
+	trainer := &podSpec.Containers[0]
+	trainer.VolumeMounts = append(trainer.VolumeMounts, mount)
+	trainer.Env = append(trainer.Env, corev1.EnvVar{Name: "TORCHRUN_HEARTBEAT_FILE", Value: heartbeatFile})
+
+	podSpec.Containers = append(podSpec.Containers, corev1.Container{
+		Name:    "watchdog",
+		Image:   image,
+		Command: []string{"/bin/sh", "-c", watchdogScript},
+		Env: []corev1.EnvVar{
+			{Name: "WATCHDOG_MODE", Value: mode},
+			{Name: "WATCHDOG_STALL_TIMEOUT", Value: strconv.Itoa(int(stallTimeout))},
+			{Name: "WATCHDOG_STARTUP_GRACE", Value: strconv.Itoa(int(watchdog.StartupGraceSeconds))},
+			{Name: "WATCHDOG_CHECK_INTERVAL", Value: strconv.Itoa(int(checkInterval))},
+			{Name: "WATCHDOG_STOP_GRACE", Value: strconv.Itoa(watchdogStopGracePeriodSeconds)},
+			{Name: "WATCHDOG_RDZV_ID", Value: getRdzvID(job)},
+			{Name: "RDZV_ENDPOINT", Value: getJobRdzvEndpoint(job, jq)},
+			{Name: "TORCHRUN_HEARTBEAT_FILE", Value: heartbeatFile},
+		},
+		VolumeMounts: []corev1.VolumeMount{mount},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("16Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+		},
+	})
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestAttachWatchdog(t *testing.T) {
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Distributed: torchrunv1alpha1.DistributedConfig{RdzvEndpoint: "etcd:2379"},
+		},
+	}
+
+	tests := []struct {
+		description    string
+		watchdog       torchrunv1alpha1.WatchdogConfig
+		numNodes       int
+		expectWatchdog bool
+		expectMode     string
+		expectImage    string
+	}{
+		{
+			description: "disabled watchdog is not injected",
+			numNodes:    2,
+		},
+		{
+			description:    "enabled watchdog defaults to heartbeat mode",
+			watchdog:       torchrunv1alpha1.WatchdogConfig{Enabled: true},
+			numNodes:       2,
+			expectWatchdog: true,
+			expectMode:     "heartbeat",
+			expectImage:    config.Default().Images.Watchdog,
+		},
+		{
+			description:    "multi-node job probes the rendezvous endpoint",
+			watchdog:       torchrunv1alpha1.WatchdogConfig{Enabled: true, Mode: "tcpStore"},
+			numNodes:       2,
+			expectWatchdog: true,
+			expectMode:     "tcpStore",
+			expectImage:    config.Default().Images.Watchdog,
+		},
+		{
+			description:    "watchdog image of the job overrides the operator config",
+			watchdog:       torchrunv1alpha1.WatchdogConfig{Enabled: true, Image: "registry.local/busybox:1.36"},
+			numNodes:       2,
+			expectWatchdog: true,
+			expectMode:     "heartbeat",
+			expectImage:    "registry.local/busybox:1.36",
+		},
+		{
+			description:    "single node job falls back to heartbeat mode",
+			watchdog:       torchrunv1alpha1.WatchdogConfig{Enabled: true, Mode: "tcpStore"},
+			numNodes:       1,
+			expectWatchdog: true,
+			expectMode:     "heartbeat",
+			expectImage:    config.Default().Images.Watchdog,
+		},
+	}
+
+	for _, test := range tests {
+		jm := NewJobManager(fake.NewClientBuilder().Build(), true, config.Default())
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default"},
+			Spec: torchrunv1alpha1.TorchrunJobSpec{
+				JobID:       "id",
+				JobName:     "train",
+				NumNodes:    test.numNodes,
+				Reliability: torchrunv1alpha1.ReliabilityConfig{Watchdog: test.watchdog},
+			},
+		}
+		podSpec := &corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "trainer", Command: []string{"/bin/bash", "-c", "torchrun train.py"}}},
+		}
+		jm.attachWatchdog(job, jq, podSpec)
+
+		if !test.expectWatchdog {
+			if len(podSpec.Containers) != 1 || podSpec.ShareProcessNamespace != nil {
+				t.Errorf("%s: expected pod spec to be unchanged", test.description)
+			}
+			continue
+		}
+
+		if len(podSpec.Containers) != 2 || podSpec.Containers[1].Name != "watchdog" {
+			t.Fatalf("%s: expected watchdog container, got %v", test.description, podSpec.Containers)
+		}
+		if podSpec.Containers[1].Image != test.expectImage {
+			t.Errorf("%s: expected image %s, got %s", test.description, test.expectImage, podSpec.Containers[1].Image)
+		}
+		if podSpec.ShareProcessNamespace == nil || !*podSpec.ShareProcessNamespace {
+			t.Errorf("%s: expected shareProcessNamespace to be enabled", test.description)
+		}
+		env := map[string]string{}
+		for _, e := range podSpec.Containers[1].Env {
+			env[e.Name] = e.Value
+		}
+		if env["WATCHDOG_MODE"] != test.expectMode {
+			t.Errorf("%s: expected mode %s, got %s", test.description, test.expectMode, env["WATCHDOG_MODE"])
+		}
+		if env["WATCHDOG_STALL_TIMEOUT"] != "600" || env["WATCHDOG_CHECK_INTERVAL"] != "30" {
+			t.Errorf("%s: expected default thresholds, got %v", test.description, env)
+		}
+		if env["WATCHDOG_RDZV_ID"] != "default-id-train" || env["RDZV_ENDPOINT"] != "etcd:2379" {
+			t.Errorf("%s: expected rendezvous settings, got %v", test.description, env)
+		}
+
+		trainer := podSpec.Containers[0]
+		if len(trainer.Env) != 1 || trainer.Env[0].Name != "TORCHRUN_HEARTBEAT_FILE" || trainer.Env[0].Value != env["TORCHRUN_HEARTBEAT_FILE"] {
+			t.Errorf("%s: expected heartbeat file in trainer env, got %v", test.description, trainer.Env)
+		}
+		if len(trainer.VolumeMounts) != 1 || trainer.VolumeMounts[0].Name != watchdogVolumeName {
+			t.Errorf("%s: expected watchdog volume mounted in trainer, got %v", test.description, trainer.VolumeMounts)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+	"github.com/dream3d/torchrun-controller/internal/patch"
+	"github.com/dream3d/torchrun-controller/internal/shard"
+)
+
+// KeepWorkspaceAnnotation opts a TorchrunJob or its workspace PVC out of garbage collection
+const KeepWorkspaceAnnotation = "torchrun.ai/keep-workspace"
+
+// WorkspaceGarbageCollector deletes the workspace PVCs of Succeeded and Failed jobs once their
+// retention expired. The Job TTL only removes the Kubernetes Job, so without it workspaces are
+// kept until the TorchrunJob is deleted.
+type WorkspaceGarbageCollector struct {
+	Client client.Client
+
+	// QueueShard selects the TorchrunQueues whose jobs are collected. Nil collects the jobs of
+	// every queue.
+	QueueShard labels.Selector
+
+	// Config provides the retention and interval of the operator config, so changes apply at
+	// the next check. A retention of 0 keeps all workspaces.
+	Config *config.Store
+}
+
+// Start runs the garbage collection every interval until the context is cancelled
+func (gc *WorkspaceGarbageCollector) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("workspace-gc")
+	settings := gc.Config.Get().WorkspaceGC
+	log.Info("Starting workspace garbage collection", "retention", settings.Retention.Duration, "interval", settings.Interval.Duration)
+
+	interval := settings.Interval.Duration
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := gc.Collect(ctx, time.Now()); err != nil {
+			log.Error(err, "Failed to collect workspaces")
+		}
+		if next := gc.Config.Get().WorkspaceGC.Interval.Duration; next != interval {
+			interval = next
+			ticker.Reset(interval)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection runs the garbage collection on the leader only
+func (gc *WorkspaceGarbageCollector) NeedLeaderElection() bool {
+	return true
+}
+
+// Collect deletes the workspace PVCs whose retention expired at now
+func (gc *WorkspaceGarbageCollector) Collect(ctx context.Context, now time.Time) error {
+	log := log.FromContext(ctx).WithName("workspace-gc")
+	retention := gc.Config.Get().WorkspaceGC.Retention.Duration
+	if retention <= 0 {
+		return nil
+	}
+
+	var jobs torchrunv1alpha1.TorchrunJobList
+	if err := gc.Client.List(ctx, &jobs); err != nil {
+		return err
+	}
+
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.Status.Phase != torchrunv1alpha1.PhaseSucceeded && job.Status.Phase != torchrunv1alpha1.PhaseFailed && job.Status.Phase != torchrunv1alpha1.PhaseTimedOut {
+			continue
+		}
+		if job.Annotations[KeepWorkspaceAnnotation] == "true" {
+			continue
+		}
+		finished := getFinishTime(job)
+		if finished.IsZero() || now.Sub(finished) < retention {
+			continue
+		}
+		owned, err := gc.ownsJob(ctx, job)
+		if err != nil {
+			return err
+		}
+		if !owned {
+			continue
+		}
+
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = gc.Client.Get(ctx, types.NamespacedName{Name: GetWorkspacePVCName(job), Namespace: job.Namespace}, pvc)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if pvc.Annotations[KeepWorkspaceAnnotation] == "true" || !metav1.IsControlledBy(pvc, job) {
+			continue
+		}
+
+		// Record the collection first, so the job reconcile never recreates the workspace
+		if !isConditionTrue(job, "WorkspaceCollected") {
+			base := job.DeepCopy()
+			NewStatusManager(gc.Client).UpdateCondition(job, "WorkspaceCollected", "True", "RetentionExpired",
+				fmt.Sprintf("Workspace PVC %s deleted %s after the job finished", pvc.Name, retention))
+			if err := patch.Status(ctx, gc.Client, job, base); err != nil {
+				return err
+			}
+		}
+
+		log.Info("Deleting workspace PVC", "job", job.Name, "namespace", job.Namespace, "pvc", pvc.Name)
+		if err := gc.Client.Delete(ctx, pvc); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ownsJob returns true if the queue of the job belongs to the shard of the collector. Jobs whose
+// queue does not exist belong to unsharded controllers.
+func (gc *WorkspaceGarbageCollector) ownsJob(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) (bool, error) {
+	if !shard.IsSharded(gc.QueueShard) {
+		return true, nil
+	}
+	queue := &torchrunv1alpha1.TorchrunQueue{}
+	err := gc.Client.Get(ctx, types.NamespacedName{Name: job.Spec.Queue, Namespace: getQueueNamespace(job)}, queue)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return shard.Owns(gc.QueueShard, queue), nil
+}
+
+// getFinishTime returns when the job finished: its completion time, or for jobs that failed
+// without one the last time a condition changed
+func getFinishTime(job *torchrunv1alpha1.TorchrunJob) time.Time {
+	if job.Status.CompletionTime != nil {
+		return job.Status.CompletionTime.Time
+	}
+	var finished time.Time
+	for _, condition := range job.Status.Conditions {
+		if condition.LastTransitionTime != nil && condition.LastTransitionTime.After(finished) {
+			finished = condition.LastTransitionTime.Time
+		}
+	}
+	return finished
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+	"github.com/dream3d/torchrun-controller/internal/shard"
+)
+
+func TestCollectWorkspaces(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	now := time.Date(2026, 10, 14, 15, 0, 0, 0, time.UTC)
+	keep := map[string]string{KeepWorkspaceAnnotation: "true"}
+
+	tests := []struct {
+		description     string
+		phase           string
+		completionTime  time.Time
+		conditionTime   time.Time
+		jobAnnotations  map[string]string
+		pvcAnnotations  map[string]string
+		adopted         bool
+		queueShard      string
+		expectDeleted   bool
+		expectCollected bool
+	}{
+		{
+			description:     "succeeded job past its retention loses its workspace",
+			phase:           torchrunv1alpha1.PhaseSucceeded,
+			completionTime:  now.Add(-2 * time.Hour),
+			expectDeleted:   true,
+			expectCollected: true,
+		},
+		{
+			description:    "succeeded job within its retention keeps its workspace",
+			phase:          torchrunv1alpha1.PhaseSucceeded,
+			completionTime: now.Add(-30 * time.Minute),
+		},
+		{
+			description:     "failed job without completion time finishes with its last condition",
+			phase:           torchrunv1alpha1.PhaseFailed,
+			conditionTime:   now.Add(-2 * time.Hour),
+			expectDeleted:   true,
+			expectCollected: true,
+		},
+		{
+			description:   "running job keeps its workspace",
+			phase:         torchrunv1alpha1.PhaseRunning,
+			conditionTime: now.Add(-2 * time.Hour),
+		},
+		{
+			description:    "annotated job keeps its workspace",
+			phase:          torchrunv1alpha1.PhaseSucceeded,
+			completionTime: now.Add(-2 * time.Hour),
+			jobAnnotations: keep,
+		},
+		{
+			description:    "annotated PVC is kept",
+			phase:          torchrunv1alpha1.PhaseSucceeded,
+			completionTime: now.Add(-2 * time.Hour),
+			pvcAnnotations: keep,
+		},
+		{
+			description:    "PVC adopted by a later run of the job name is kept",
+			phase:          torchrunv1alpha1.PhaseSucceeded,
+			completionTime: now.Add(-2 * time.Hour),
+			adopted:        true,
+		},
+		{
+			description:     "job in a queue of the shard loses its workspace",
+			phase:           torchrunv1alpha1.PhaseSucceeded,
+			completionTime:  now.Add(-2 * time.Hour),
+			queueShard:      "torchrun.ai/shard=a",
+			expectDeleted:   true,
+			expectCollected: true,
+		},
+		{
+			description:    "job in a queue of another shard is left to its controller",
+			phase:          torchrunv1alpha1.PhaseSucceeded,
+			completionTime: now.Add(-2 * time.Hour),
+			queueShard:     "torchrun.ai/shard=b",
+		},
+	}
+
+	queue := &torchrunv1alpha1.TorchrunQueue{ObjectMeta: metav1.ObjectMeta{
+		Name:      "dev",
+		Namespace: "default",
+		Labels:    map[string]string{"torchrun.ai/shard": "a"},
+	}}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default", UID: "train-uid", Annotations: test.jobAnnotations},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{JobName: "train", Queue: "dev"},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{Phase: test.phase},
+		}
+		if !test.completionTime.IsZero() {
+			job.Status.CompletionTime = &metav1.Time{Time: test.completionTime}
+		}
+		if !test.conditionTime.IsZero() {
+			job.Status.Conditions = []torchrunv1alpha1.TorchrunJobCondition{
+				{Type: "JobCreated", Status: "True", LastTransitionTime: &metav1.Time{Time: test.conditionTime}},
+			}
+		}
+		isController := true
+		controller := metav1.OwnerReference{APIVersion: torchrunv1alpha1.GroupVersion.String(), Kind: "TorchrunJob", Name: "train", UID: "train-uid", Controller: &isController}
+		if test.adopted {
+			controller.Name, controller.UID = "train-2", "train-2-uid"
+		}
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            GetWorkspacePVCName(job),
+				Namespace:       "default",
+				Annotations:     test.pvcAnnotations,
+				OwnerReferences: []metav1.OwnerReference{controller},
+			},
+		}
+
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(job, pvc, queue.DeepCopy()).WithStatusSubresource(job).Build()
+		operatorConfig := config.Default()
+		operatorConfig.WorkspaceGC.Retention.Duration = time.Hour
+		queueShard, err := shard.Parse(test.queueShard)
+		if err != nil {
+			t.Fatalf("%s: invalid queue shard: %v", test.description, err)
+		}
+		gc := &WorkspaceGarbageCollector{Client: c, QueueShard: queueShard, Config: config.NewStore(operatorConfig)}
+		if err := gc.Collect(context.Background(), now); err != nil {
+			t.Fatalf("%s: Collect() error = %v", test.description, err)
+		}
+
+		err = c.Get(context.Background(), types.NamespacedName{Name: pvc.Name, Namespace: "default"}, &corev1.PersistentVolumeClaim{})
+		if deleted := apierrors.IsNotFound(err); deleted != test.expectDeleted {
+			t.Errorf("%s: expected PVC deleted %v, got %v", test.description, test.expectDeleted, err)
+		}
+
+		updated := &torchrunv1alpha1.TorchrunJob{}
+		if err := c.Get(context.Background(), types.NamespacedName{Name: "train", Namespace: "default"}, updated); err != nil {
+			t.Fatalf("%s: failed to get job: %v", test.description, err)
+		}
+		if collected := isConditionTrue(updated, "WorkspaceCollected"); collected != test.expectCollected {
+			t.Errorf("%s: expected WorkspaceCollected %v, got %v", test.description, test.expectCollected, collected)
+		}
+	}
+}
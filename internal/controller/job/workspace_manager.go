@@ -3,78 +3,65 @@ package controller
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	corev1 "k8s.io/api/core/v1"
-	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
-	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/internal/v1alpha1"
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+	"github.com/dream3d/torchrun-controller/internal/patch"
+	"github.com/dream3d/torchrun-controller/internal/upload"
 )
 
 // WorkspaceManager handles workspace-related operations
 type WorkspaceManager struct {
-	client client.Client
+	client    client.Client
+	apiReader client.Reader
+	images    config.Images
 }
 
-// NewWorkspaceManager creates a new workspace manager
-func NewWorkspaceManager(client client.Client) *WorkspaceManager {
+// NewWorkspaceManager creates a new workspace manager. Secrets are read through apiReader
+// so they are never cached by the manager. The sync pods use the images of the operator
+// config unless the queue or job sets one.
+func NewWorkspaceManager(client client.Client, apiReader client.Reader, images config.Images) *WorkspaceManager {
 	return &WorkspaceManager{
-		client: client,
+		client:    client,
+		apiReader: apiReader,
+		images:    images,
 	}
 }
 
-// getDefaultStorageClass finds the default StorageClass in the cluster
-func (wm *WorkspaceManager) getDefaultStorageClass(ctx context.Context) (string, error) {
-	storageClasses := &storagev1.StorageClassList{}
-	if err := wm.client.List(ctx, storageClasses); err != nil {
-		return "", fmt.Errorf("failed to list storage classes: %w", err)
-	}
-
-	for _, sc := range storageClasses.Items {
-		if sc.Annotations != nil && sc.Annotations["storageclass.kubernetes.io/is-default-class"] == "true" {
-			return sc.Name, nil
-		}
-	}
-
-	return "", fmt.Errorf("no default storage class found in the cluster")
-}
-
 // CreateWorkspacePVC creates the workspace PVC
 func (wm *WorkspaceManager) CreateWorkspacePVC(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) error {
 	log := log.FromContext(ctx)
 
-	// Determine storage class to use, with job override taking precedence over jq
-	storageClassName := ""
+	// Determine storage class to use, with job override taking precedence over jq. Without one
+	// the API server assigns the default StorageClass, so the controller needs no cluster-wide
+	// access to StorageClasses.
+	var storageClassName *string
 	if job.Spec.WorkspaceStorage.StorageClass != "" {
-		storageClassName = job.Spec.WorkspaceStorage.StorageClass
-	} else {
-		storageClassName = jq.Spec.WorkspaceStorage.StorageClass
-	}
-	if storageClassName == "" {
-		// Look up the default storage class
-		defaultSC, err := wm.getDefaultStorageClass(ctx)
-		if err != nil {
-			log.Error(err, "Failed to find default storage class")
-			return err
-		}
-		storageClassName = defaultSC
-		log.Info("Using default storage class", "storageClass", storageClassName)
+		storageClassName = &job.Spec.WorkspaceStorage.StorageClass
+	} else if jq.Spec.WorkspaceStorage.StorageClass != "" {
+		storageClassName = &jq.Spec.WorkspaceStorage.StorageClass
 	}
 
-	// Storage size, with job override taking precedence over jq
-	storageSize := ""
-	if job.Spec.WorkspaceStorage.Size != "" {
-		storageSize = job.Spec.WorkspaceStorage.Size
-	} else if jq.Spec.WorkspaceStorage.Size != "" {
-		storageSize = jq.Spec.WorkspaceStorage.Size
-	} else {
-		storageSize = "1Gi"
+	storageSize, err := getWorkspaceSize(job, jq)
+	if err != nil {
+		return err
 	}
 
 	pvc := &corev1.PersistentVolumeClaim{
@@ -91,14 +78,11 @@ func (wm *WorkspaceManager) CreateWorkspacePVC(ctx context.Context, job *torchru
 			},
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
-			StorageClassName: &storageClassName,
-			AccessModes: []corev1.PersistentVolumeAccessMode{
-				corev1.ReadWriteOnce,
-				corev1.ReadOnlyMany,
-			},
+			StorageClassName: storageClassName,
+			AccessModes:      getWorkspaceAccessModes(job, jq),
 			Resources: corev1.VolumeResourceRequirements{
 				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: resource.MustParse(storageSize),
+					corev1.ResourceStorage: storageSize,
 				},
 			},
 		},
@@ -106,7 +90,7 @@ func (wm *WorkspaceManager) CreateWorkspacePVC(ctx context.Context, job *torchru
 
 	// Check if PVC already exists
 	existingPVC := &corev1.PersistentVolumeClaim{}
-	err := wm.client.Get(ctx, types.NamespacedName{Name: pvc.Name, Namespace: pvc.Namespace}, existingPVC)
+	err = wm.client.Get(ctx, types.NamespacedName{Name: pvc.Name, Namespace: pvc.Namespace}, existingPVC)
 	if err == nil {
 		log.Info("Workspace PVC already exists", "name", pvc.Name)
 		return nil
@@ -114,15 +98,284 @@ func (wm *WorkspaceManager) CreateWorkspacePVC(ctx context.Context, job *torchru
 		return err
 	}
 
-	log.Info("Creating workspace PVC", "name", pvc.Name, "storageClass", storageClassName)
-	return wm.client.Create(ctx, pvc)
+	// Clone the synced workspace of the cloned job instead of syncing the workspace again
+	if job.Spec.CloneFrom != nil && job.Spec.CloneFrom.ReuseWorkspace {
+		source, err := wm.getCloneWorkspacePVC(ctx, job)
+		if err != nil {
+			return err
+		}
+		// CSI volume cloning needs the storage class of the source and at least its size
+		if sourceSize := source.Spec.Resources.Requests[corev1.ResourceStorage]; sourceSize.Cmp(storageSize) > 0 {
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = sourceSize
+		}
+		pvc.Spec.DataSource = &corev1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: source.Name}
+		pvc.Labels["torchrun.ai/sync-completed"] = "true"
+		if source.Spec.StorageClassName != nil {
+			pvc.Spec.StorageClassName = source.Spec.StorageClassName
+		}
+	}
+
+	// Restore the workspace from the snapshot instead of syncing it
+	if job.Spec.SnapshotRef != nil {
+		dataSource, restoreSize, err := wm.getSnapshotRestoreSource(ctx, job)
+		if err != nil {
+			return err
+		}
+		if restoreSize.Cmp(storageSize) > 0 {
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = restoreSize
+		}
+		pvc.Spec.DataSource = dataSource
+		pvc.Labels["torchrun.ai/sync-completed"] = "true"
+	}
+
+	storageClass := "default"
+	if pvc.Spec.StorageClassName != nil {
+		storageClass = *pvc.Spec.StorageClassName
+	}
+	log.Info("Creating workspace PVC", "name", pvc.Name, "storageClass", storageClass)
+	if err := wm.client.Create(ctx, pvc); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// getCloneWorkspacePVC returns the workspace PVC of the job named by cloneFrom. It must have
+// completed its sync, so the clone gets the whole workspace.
+func (wm *WorkspaceManager) getCloneWorkspacePVC(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) (*corev1.PersistentVolumeClaim, error) {
+	source := &torchrunv1alpha1.TorchrunJob{}
+	if err := wm.client.Get(ctx, types.NamespacedName{Name: job.Spec.CloneFrom.Name, Namespace: job.Namespace}, source); err != nil {
+		return nil, fmt.Errorf("failed to get cloned job %s: %w", job.Spec.CloneFrom.Name, err)
+	}
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := wm.client.Get(ctx, types.NamespacedName{Name: GetWorkspacePVCName(source), Namespace: job.Namespace}, pvc); err != nil {
+		return nil, fmt.Errorf("failed to get workspace PVC of cloned job %s: %w", source.Name, err)
+	}
+	if pvc.Labels["torchrun.ai/sync-completed"] != "true" {
+		return nil, fmt.Errorf("workspace PVC %s of cloned job %s has not completed its sync", pvc.Name, source.Name)
+	}
+	return pvc, nil
+}
+
+// getSnapshotRestoreSource returns the data source and the minimum size of a workspace PVC restored from
+// the snapshotRef of the job. The snapshot must be ready to use.
+func (wm *WorkspaceManager) getSnapshotRestoreSource(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) (*corev1.TypedLocalObjectReference, resource.Quantity, error) {
+	name := job.Spec.SnapshotRef.Name
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	if err := wm.client.Get(ctx, types.NamespacedName{Name: name, Namespace: job.Namespace}, snapshot); err != nil {
+		return nil, resource.Quantity{}, fmt.Errorf("failed to get workspace snapshot %s: %w", name, err)
+	}
+	if ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse"); !ready {
+		return nil, resource.Quantity{}, fmt.Errorf("workspace snapshot %s is not ready to use", name)
+	}
+
+	var size resource.Quantity
+	if restoreSize, found, _ := unstructured.NestedString(snapshot.Object, "status", "restoreSize"); found {
+		parsed, err := resource.ParseQuantity(restoreSize)
+		if err != nil {
+			return nil, resource.Quantity{}, fmt.Errorf("invalid restore size %q of workspace snapshot %s: %w", restoreSize, name, err)
+		}
+		size = parsed
+	}
+	group := volumeSnapshotGVK.Group
+	return &corev1.TypedLocalObjectReference{APIGroup: &group, Kind: volumeSnapshotGVK.Kind, Name: name}, size, nil
+}
+
+// getWorkspaceSize returns the size of the workspace, with job override taking precedence over jq
+func getWorkspaceSize(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (resource.Quantity, error) {
+	size := "1Gi"
+	if job.Spec.WorkspaceStorage.Size != "" {
+		size = job.Spec.WorkspaceStorage.Size
+	} else if jq.Spec.WorkspaceStorage.Size != "" {
+		size = jq.Spec.WorkspaceStorage.Size
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return resource.Quantity{}, fmt.Errorf("invalid workspace size %q: %w", size, err)
+	}
+	return quantity, nil
+}
+
+// getWorkspaceMountPath returns the mount path of the workspace in the trainer, with job
+// override taking precedence over jq
+func getWorkspaceMountPath(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) string {
+	if job.Spec.WorkspaceStorage.MountPath != "" {
+		return job.Spec.WorkspaceStorage.MountPath
+	}
+	if jq.Spec.WorkspaceStorage.MountPath != "" {
+		return jq.Spec.WorkspaceStorage.MountPath
+	}
+	return "/app"
+}
+
+// getWorkspaceAccessModes returns the access modes of the workspace PVC, with job override
+// taking precedence over jq. The default lets the sync pod write the workspace and the workers
+// of every node read it.
+func getWorkspaceAccessModes(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) []corev1.PersistentVolumeAccessMode {
+	if len(job.Spec.WorkspaceStorage.AccessModes) > 0 {
+		return job.Spec.WorkspaceStorage.AccessModes
+	}
+	if len(jq.Spec.WorkspaceStorage.AccessModes) > 0 {
+		return jq.Spec.WorkspaceStorage.AccessModes
+	}
+	return []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce, corev1.ReadOnlyMany}
+}
+
+// getSyncResources returns the resources of the sync pod, with the job override taking
+// precedence over jq
+func getSyncResources(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) corev1.ResourceRequirements {
+	if resources := job.Spec.WorkspaceStorage.SyncResources; resources != nil {
+		return *resources.DeepCopy()
+	}
+	if resources := jq.Spec.WorkspaceStorage.SyncResources; resources != nil {
+		return *resources.DeepCopy()
+	}
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("200m"),
+			corev1.ResourceMemory: resource.MustParse("2Gi"),
+		},
+	}
+}
+
+// streamsArchive returns true if zip and s3 archives are extracted while they download
+func streamsArchive(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) bool {
+	return job.Spec.WorkspaceStorage.StreamArchive || jq.Spec.WorkspaceStorage.StreamArchive
+}
+
+// isEphemeralWorkspace returns true if the workers get an empty workspace volume instead of
+// the synced workspace PVC
+func isEphemeralWorkspace(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) bool {
+	return job.Spec.WorkspaceStorage.Ephemeral || jq.Spec.WorkspaceStorage.Ephemeral
+}
+
+// getWorkspaceDeliveryMode returns how the workers get the synced workspace, with job override
+// taking precedence over jq
+func getWorkspaceDeliveryMode(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) string {
+	if job.Spec.WorkspaceStorage.DeliveryMode != "" {
+		return job.Spec.WorkspaceStorage.DeliveryMode
+	}
+	if jq.Spec.WorkspaceStorage.DeliveryMode != "" {
+		return jq.Spec.WorkspaceStorage.DeliveryMode
+	}
+	return torchrunv1alpha1.WorkspaceDeliveryCopy
+}
+
+// isDirectWorkspace returns true if the trainer mounts the synced workspace PVC read-only
+// instead of a copy of it
+func isDirectWorkspace(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) bool {
+	return !isEphemeralWorkspace(job, jq) && getWorkspaceDeliveryMode(job, jq) == torchrunv1alpha1.WorkspaceDeliveryDirect
+}
+
+// AdoptWorkspacePVC takes over the workspace PVC of an earlier TorchrunJob with the same
+// jobName, so the job resumes in its workspace instead of syncing a new one, and persists the
+// resumption in the status. The workspace of a run that did not finish is not adopted; its
+// TorchrunJob is returned instead.
+func (wm *WorkspaceManager) AdoptWorkspacePVC(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) (string, error) {
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := wm.client.Get(ctx, types.NamespacedName{Name: GetWorkspacePVCName(job), Namespace: job.Namespace}, pvc)
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if metav1.IsControlledBy(pvc, job) {
+		return "", nil
+	}
+	if pvc.DeletionTimestamp != nil {
+		return "", fmt.Errorf("workspace PVC %s is being deleted", pvc.Name)
+	}
+
+	// The count carries over from the run that is resumed
+	base := job.DeepCopy()
+	resumeCount := job.Status.ResumeCount
+	owner := metav1.GetControllerOf(pvc)
+	if owner != nil && owner.Kind == "TorchrunJob" {
+		previous := &torchrunv1alpha1.TorchrunJob{}
+		err := wm.client.Get(ctx, types.NamespacedName{Name: owner.Name, Namespace: job.Namespace}, previous)
+		if err != nil && !errors.IsNotFound(err) {
+			return "", err
+		}
+		if err == nil && previous.UID == owner.UID {
+			if previous.DeletionTimestamp == nil && !isTerminalPhase(previous.Status.Phase) {
+				return previous.Name, nil
+			}
+			resumeCount = previous.Status.ResumeCount
+		}
+		job.Status.ResumedFrom = owner.Name
+	}
+
+	// Replace the controller, so the PVC outlives the TorchrunJob it was created for
+	pvcPatch := client.MergeFrom(pvc.DeepCopy())
+	var ownerReferences []metav1.OwnerReference
+	for _, ref := range pvc.OwnerReferences {
+		if ref.Controller == nil || !*ref.Controller {
+			ownerReferences = append(ownerReferences, ref)
+		}
+	}
+	pvc.OwnerReferences = append(ownerReferences, *metav1.NewControllerRef(job, job.GroupVersionKind()))
+	if err := wm.client.Patch(ctx, pvc, pvcPatch); err != nil {
+		return "", err
+	}
+
+	log.FromContext(ctx).Info("Adopted workspace PVC", "name", job.Name, "pvc", pvc.Name, "resumedFrom", job.Status.ResumedFrom)
+	job.Status.ResumeCount = resumeCount + 1
+	return "", patch.Status(ctx, wm.client, job, base)
 }
 
 // CreateSyncPod creates the workspace sync pod
 func (wm *WorkspaceManager) CreateSyncPod(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) error {
 	log := log.FromContext(ctx)
 
+	// Check if sync pod already exists
+	existingPod := &corev1.Pod{}
+	err := wm.client.Get(ctx, types.NamespacedName{Name: GetSyncPodName(job), Namespace: job.Namespace}, existingPod)
+	if err == nil {
+		log.Info("Sync pod already exists", "name", existingPod.Name)
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	// Check if workspace PVC exists
+	workspacePVC := &corev1.PersistentVolumeClaim{}
+	err = wm.client.Get(ctx, types.NamespacedName{Name: GetWorkspacePVCName(job), Namespace: job.Namespace}, workspacePVC)
+	if err != nil {
+		return err
+	}
+
+	// Check if workspace PVC has sync-completed label
+	if workspacePVC.Labels != nil && workspacePVC.Labels["torchrun.ai/sync-completed"] == "true" {
+		log.Info("Workspace PVC already has sync completed label", "name", workspacePVC.Name)
+		return nil
+	}
+
+	// Build the sync pod last, so URLs are only signed for a pod that is actually created
+	syncPod, err := wm.BuildSyncPod(ctx, job, jq, true)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Creating sync pod", "name", syncPod.Name)
+	if err := wm.client.Create(ctx, syncPod); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// BuildSyncPod builds the workspace sync pod of the job without creating it. Without presign,
+// the download URL of workspaces uploaded to the upload server is left out.
+func (wm *WorkspaceManager) BuildSyncPod(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, presign bool) (*corev1.Pod, error) {
 	// Build sync pod
+	syncImage := jq.Spec.WorkspaceStorage.Image
+	if syncImage == "" {
+		syncImage = wm.images.WorkspaceSync
+	}
 	syncPod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      GetSyncPodName(job),
@@ -141,28 +394,18 @@ func (wm *WorkspaceManager) CreateSyncPod(ctx context.Context, job *torchrunv1al
 			Containers: []corev1.Container{
 				{
 					Name:            "sync",
-					Image:           jq.Spec.WorkspaceStorage.Image,
+					Image:           syncImage,
 					ImagePullPolicy: jq.Spec.WorkspaceStorage.ImagePullPolicy,
 					Command:         []string{"/bin/sh", "-c"},
 					Args:            []string{wm.buildSyncCommand(job, jq)},
 					WorkingDir:      "/workspace",
-					Env:             wm.buildSyncEnvironment(job, jq),
 					VolumeMounts: []corev1.VolumeMount{
 						{
 							Name:      "workspace",
 							MountPath: "/workspace",
 						},
 					},
-					Resources: corev1.ResourceRequirements{
-						Requests: corev1.ResourceList{
-							corev1.ResourceCPU:    resource.MustParse("100m"),
-							corev1.ResourceMemory: resource.MustParse("1Gi"),
-						},
-						Limits: corev1.ResourceList{
-							corev1.ResourceCPU:    resource.MustParse("200m"),
-							corev1.ResourceMemory: resource.MustParse("2Gi"),
-						},
-					},
+					Resources: getSyncResources(job, jq),
 				},
 			},
 			Volumes: []corev1.Volume{
@@ -178,31 +421,33 @@ func (wm *WorkspaceManager) CreateSyncPod(ctx context.Context, job *torchrunv1al
 		},
 	}
 
-	// Check if sync pod already exists
-	existingPod := &corev1.Pod{}
-	err := wm.client.Get(ctx, types.NamespacedName{Name: syncPod.Name, Namespace: syncPod.Namespace}, existingPod)
-	if err == nil {
-		log.Info("Sync pod already exists", "name", syncPod.Name)
-		return nil
-	} else if !errors.IsNotFound(err) {
-		return err
-	}
-
-	// Check if workspace PVC exists
-	workspacePVC := &corev1.PersistentVolumeClaim{}
-	err = wm.client.Get(ctx, types.NamespacedName{Name: GetWorkspacePVCName(job), Namespace: job.Namespace}, workspacePVC)
+	env, err := wm.buildSyncEnvironment(ctx, job, jq, presign)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	syncPod.Spec.Containers[0].Env = env
 
-	// Check if workspace PVC has sync-completed label
-	if workspacePVC.Labels != nil && workspacePVC.Labels["torchrun.ai/sync-completed"] == "true" {
-		log.Info("Workspace PVC already has sync completed label", "name", workspacePVC.Name)
-		return nil
+	// S3 and rsync sources bring their own tools instead of the workspace sync image
+	switch source, _ := getWorkspaceSource(job, jq); source {
+	case "s3":
+		s3, err := getS3Config(job, jq)
+		if err != nil {
+			return nil, err
+		}
+		syncPod.Spec.Containers[0].Image = wm.images.S3Sync
+		if s3.Image != "" {
+			syncPod.Spec.Containers[0].Image = s3.Image
+		}
+	case "rsync":
+		rsync, err := getRsyncConfig(job, jq)
+		if err != nil {
+			return nil, err
+		}
+		attachRsyncSource(rsync, wm.images.RsyncSync, &syncPod.Spec)
 	}
 
-	log.Info("Creating sync pod", "name", syncPod.Name)
-	return wm.client.Create(ctx, syncPod)
+	attachSecurityPolicy(jq, &syncPod.Spec)
+	return syncPod, nil
 }
 
 // CheckWorkspacePVCStatus checks if the workspace PVC is ready by checking the sync-completed label,
@@ -257,8 +502,68 @@ func (wm *WorkspaceManager) CheckWorkspacePVCStatus(ctx context.Context, job *to
 	}
 }
 
-// buildSyncCommand builds the sync command based on workspace source
-func (wm *WorkspaceManager) buildSyncCommand(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) string {
+// DiagnoseWorkspacePVC explains why the workspace PVC of a job cannot be provisioned, or returns
+// "" when it is bound or may still be. The API server assigns the default StorageClass to PVCs
+// created without one, so a pending PVC without a storage class means the cluster has no default
+// StorageClass, and the PVC only binds to a PersistentVolume without a class.
+func (wm *WorkspaceManager) DiagnoseWorkspacePVC(ctx context.Context, job *torchrunv1alpha1.TorchrunJob) (string, error) {
+	workspacePVC := &corev1.PersistentVolumeClaim{}
+	if err := wm.client.Get(ctx, types.NamespacedName{Name: GetWorkspacePVCName(job), Namespace: job.Namespace}, workspacePVC); err != nil {
+		return "", err
+	}
+	if workspacePVC.Status.Phase != corev1.ClaimPending || workspacePVC.Spec.VolumeName != "" {
+		return "", nil
+	}
+	if workspacePVC.Spec.StorageClassName != nil && *workspacePVC.Spec.StorageClassName != "" {
+		return "", nil
+	}
+	return fmt.Sprintf("Workspace PVC %s has no storage class and the cluster has no default StorageClass; "+
+		"set workspaceStorage.storageClass on the job or queue, or mark a StorageClass as default", workspacePVC.Name), nil
+}
+
+// GetUploadURLs returns presigned upload (PUT) and download (GET) URLs for the job's workspace archive
+// on the queue's upload server
+func (wm *WorkspaceManager) GetUploadURLs(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (string, string, error) {
+	secret := &corev1.Secret{}
+	err := wm.apiReader.Get(ctx, types.NamespacedName{Name: upload.SecretName(jq.Name), Namespace: jq.Namespace}, secret)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get upload server signing key: %w", err)
+	}
+	key, ok := secret.Data[upload.SigningKeySecretKey]
+	if !ok {
+		return "", "", fmt.Errorf("secret %s has no %s key", secret.Name, upload.SigningKeySecretKey)
+	}
+
+	expirySeconds := jq.Spec.UploadServer.URLExpirySeconds
+	if expirySeconds == 0 {
+		expirySeconds = 3600
+	}
+	expires := time.Now().Add(time.Duration(expirySeconds) * time.Second)
+	// The sync pod polls the download URL until the upload arrives, so it must outlive the wait
+	downloadExpires := expires.Add(syncWaitTimeoutSeconds * time.Second)
+
+	// Downloads always go through the in-cluster Service, uploads through the external URL if set
+	internalURL := fmt.Sprintf("http://%s.%s.svc", upload.ServerName(jq.Name), jq.Namespace)
+	externalURL := strings.TrimSuffix(jq.Spec.UploadServer.ExternalURL, "/")
+	if externalURL == "" {
+		externalURL = internalURL
+	}
+
+	signer := upload.NewSigner(key)
+	path := upload.WorkspacePath(job.Namespace, job.Spec.JobID)
+	return signer.Sign(http.MethodPut, externalURL, path, expires),
+		signer.Sign(http.MethodGet, internalURL, path, downloadExpires),
+		nil
+}
+
+// UsesUploadServer returns true if the workspace archive is delivered through the queue's upload server
+func UsesUploadServer(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) bool {
+	source, url := getWorkspaceSource(job, jq)
+	return jq.Spec.UploadServer.Enabled && source == "zip" && url == "" && !isEphemeralWorkspace(job, jq)
+}
+
+// getWorkspaceSource returns the workspace source and URL, with job override taking precedence over jq
+func getWorkspaceSource(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (string, string) {
 	var source string
 	var url string
 
@@ -276,75 +581,136 @@ func (wm *WorkspaceManager) buildSyncCommand(job *torchrunv1alpha1.TorchrunJob,
 		source = "zip"
 	}
 
+	return source, url
+}
+
+// scpLikeGitURL matches the user@host:path form of git SSH URLs
+var scpLikeGitURL = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^/]`)
+
+// validateWorkspaceURL checks that the URL of a zip or git source is a plain URL that wget or
+// git cannot mistake for an option or a local path
+func validateWorkspaceURL(source, rawURL string) error {
+	if strings.HasPrefix(rawURL, "-") || strings.ContainsFunc(rawURL, isInvalidURLRune) {
+		return fmt.Errorf("invalid %s workspace URL %q", source, rawURL)
+	}
+	if source == "git" && scpLikeGitURL.MatchString(rawURL) {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid %s workspace URL %q: %w", source, rawURL, err)
+	}
+	schemes := []string{"http", "https"}
+	if source == "git" {
+		schemes = append(schemes, "git", "ssh")
+	}
+	if !slices.Contains(schemes, u.Scheme) || u.Host == "" {
+		return fmt.Errorf("%s workspace URL %q must be an absolute %s URL", source, rawURL, strings.Join(schemes, ", "))
+	}
+	return nil
+}
+
+// isInvalidURLRune returns true for runes that must be percent-encoded in any URL
+func isInvalidURLRune(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsControl(r)
+}
+
+// secretURLReference matches the {{secret:name/key}} references of workspace URLs to a key of a
+// Secret in the namespace of the job
+var secretURLReference = regexp.MustCompile(`\{\{\s*secret:([a-z0-9]([-a-z0-9.]*[a-z0-9])?)/([-._a-zA-Z0-9]+)\s*\}\}`)
+
+// buildWorkspaceURLEnvironment passes the workspace URL to the sync pod as WORKSPACE_URL. Each
+// secret reference becomes a WORKSPACE_URL_SECRET_<n> variable from the Secret, which the kubelet
+// expands into WORKSPACE_URL, so tokens never show up in the pod spec. The sync script logs
+// WORKSPACE_URL_TEMPLATE, the URL with the references, instead of the expanded URL.
+func buildWorkspaceURLEnvironment(rawURL string) []corev1.EnvVar {
+	template := corev1.EnvVar{Name: "WORKSPACE_URL_TEMPLATE", Value: rawURL}
+	if !secretURLReference.MatchString(rawURL) {
+		return []corev1.EnvVar{{Name: "WORKSPACE_URL", Value: rawURL}, template}
+	}
+
+	var env []corev1.EnvVar
+	names := map[string]string{}
+	var expanded strings.Builder
+	last := 0
+	for _, match := range secretURLReference.FindAllStringSubmatchIndex(rawURL, -1) {
+		// The kubelet expands $(VAR) in env values, so literal dollar signs are escaped
+		expanded.WriteString(strings.ReplaceAll(rawURL[last:match[0]], "$", "$$"))
+		last = match[1]
+
+		secret, key := rawURL[match[2]:match[3]], rawURL[match[6]:match[7]]
+		name, ok := names[secret+"/"+key]
+		if !ok {
+			name = fmt.Sprintf("WORKSPACE_URL_SECRET_%d", len(names))
+			names[secret+"/"+key] = name
+			env = append(env, corev1.EnvVar{
+				Name: name,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: secret},
+						Key:                  key,
+					},
+				},
+			})
+		}
+		expanded.WriteString("$(" + name + ")")
+	}
+	expanded.WriteString(strings.ReplaceAll(rawURL[last:], "$", "$$"))
+
+	// The secret variables come first, as the kubelet only expands variables defined earlier
+	return append(env, corev1.EnvVar{Name: "WORKSPACE_URL", Value: expanded.String()}, template)
+}
+
+// buildSyncCommand builds the sync command based on workspace source
+func (wm *WorkspaceManager) buildSyncCommand(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) string {
+	source, url := getWorkspaceSource(job, jq)
+
 	switch source {
 	case "zip":
+		if UsesUploadServer(job, jq) {
+			// Fetch from the upload server, discarding partial downloads between attempts
+			return waitForWorkspaceArchive("to be uploaded to the upload server",
+				`{ wget -q -O /workspace/workspace.zip "$WORKSPACE_DOWNLOAD_URL" || { rm -f /workspace/workspace.zip; false; }; }`)
+		}
 		if url == "" {
-			return `
-				echo "Waiting for workspace.zip to be uploaded (timeout: 10 minutes)..."
-				start_time=$(date +%s)
-				timeout_seconds=600   # 10 minutes
-
-				while true; do
-					if [ -f /workspace/workspace.zip ]; then
-						if unzip -t /workspace/workspace.zip >/dev/null 2>&1; then
-							break   # valid archive, proceed
-						fi
-						echo "workspace.zip detected but still copying – waiting..."
-					fi
-
-					# check timeout
-					current_time=$(date +%s)
-					elapsed=$((current_time - start_time))
-					if [ "$elapsed" -ge "$timeout_seconds" ]; then
-						echo "ERROR: Timed out waiting for workspace.zip to finish uploading"
-						exit 1
-					fi
-
-					sleep 5
-				done
-
-				echo "Extracting workspace.zip..."
-				unzip -q /workspace/workspace.zip -d /workspace/
-				rm -f /workspace/workspace.zip
-				echo "Workspace sync completed"
-				touch /workspace/.sync_success
-			`
+			// The archive is copied into the PVC directly; wait until it is complete
+			return waitForWorkspaceArchive("to finish uploading",
+				`{ [ -f /workspace/workspace.zip ] && unzip -t /workspace/workspace.zip >/dev/null 2>&1; }`)
+		}
+		if streamsArchive(job, jq) {
+			return zipStreamScript
 		}
 		// Download from URL
-		return fmt.Sprintf(`
-			echo "Downloading workspace from %s..."
-			wget -q -O /workspace/workspace.zip "%s"
+		return `
+			echo "Downloading workspace from $WORKSPACE_URL_TEMPLATE..."
+			wget -q -O /workspace/workspace.zip "$WORKSPACE_URL"
 			echo "Extracting workspace.zip..."
 			unzip -q /workspace/workspace.zip -d /workspace/
 			rm -f /workspace/workspace.zip
 			echo "Workspace sync completed"
 			touch /workspace/.sync_success
-		`, url, url)
+		`
 
 	case "git":
-		ref := "main"
-		if url != "" {
-			ref = url
-		}
-		return fmt.Sprintf(`
-			echo "Cloning git repository %s..."
-			git clone --branch %s --depth 1 %s /workspace/repo
+		return `
+			echo "Cloning git repository $WORKSPACE_URL_TEMPLATE..."
+			git clone --depth 1 -- "$WORKSPACE_URL" /workspace/repo
 			mv /workspace/repo/* /workspace/ 2>/dev/null || true
 			mv /workspace/repo/.[^.]* /workspace/ 2>/dev/null || true
 			rm -rf /workspace/repo
 			echo "Workspace sync completed"
 			touch /workspace/.sync_success
-		`, url, ref, url)
+		`
 
 	case "s3":
-		return fmt.Sprintf(`
-			echo "Downloading from S3: %s..."
-			aws s3 cp %s /workspace/workspace.tar.gz
-			tar -xzf /workspace/workspace.tar.gz -C /workspace/
-			rm -f /workspace/workspace.tar.gz
-			echo "Workspace sync completed"
-			touch /workspace/.sync_success
-		`, url, url)
+		if streamsArchive(job, jq) {
+			return s3StreamScript
+		}
+		return s3SyncScript
+
+	case "rsync":
+		return rsyncSyncScript
 
 	default:
 		// Just create success marker for existing workspace
@@ -355,10 +721,247 @@ func (wm *WorkspaceManager) buildSyncCommand(job *torchrunv1alpha1.TorchrunJob,
 	}
 }
 
+// s3SyncScript downloads the archive with rclone, configured through RCLONE_CONFIG_S3_* and
+// S3_BUCKET/S3_KEY in the environment so no credentials or names end up in the pod command
+const s3SyncScript = `
+	set -e
+	echo "Downloading workspace from s3://$S3_BUCKET/$S3_KEY..."
+	rclone copyto --retries 5 "s3:$S3_BUCKET/$S3_KEY" /workspace/.workspace-archive
+	echo "Extracting workspace archive..."
+	case "$S3_KEY" in
+		*.zip) unzip -q /workspace/.workspace-archive -d /workspace/ ;;
+		*.tar) tar -xf /workspace/.workspace-archive -C /workspace/ ;;
+		*) tar -xzf /workspace/.workspace-archive -C /workspace/ ;;
+	esac
+	rm -f /workspace/.workspace-archive
+	echo "Workspace sync completed"
+	touch /workspace/.sync_success
+`
+
+// zipStreamScript extracts the zip archive of the URL while it downloads. A failed download or
+// extraction leaves a partial workspace, which is cleared before the sync pod retries.
+const zipStreamScript = `
+	set -e -o pipefail
+	find /workspace -mindepth 1 -delete
+	echo "Streaming workspace from $WORKSPACE_URL_TEMPLATE..."
+	wget -q -O - "$WORKSPACE_URL" | unzip -q - -d /workspace/
+	echo "Workspace sync completed"
+	touch /workspace/.sync_success
+`
+
+// s3StreamScript extracts the archive with rclone cat while it downloads, configured like
+// s3SyncScript
+const s3StreamScript = `
+	set -e -o pipefail
+	find /workspace -mindepth 1 -delete
+	echo "Streaming workspace from s3://$S3_BUCKET/$S3_KEY..."
+	case "$S3_KEY" in
+		*.zip) rclone cat --retries 5 "s3:$S3_BUCKET/$S3_KEY" | unzip -q - -d /workspace/ ;;
+		*.tar) rclone cat --retries 5 "s3:$S3_BUCKET/$S3_KEY" | tar -xf - -C /workspace/ ;;
+		*) rclone cat --retries 5 "s3:$S3_BUCKET/$S3_KEY" | tar -xzf - -C /workspace/ ;;
+	esac
+	echo "Workspace sync completed"
+	touch /workspace/.sync_success
+`
+
+// getS3Config returns the s3 source config, with job override taking precedence over jq.
+// Sources that only set an s3://bucket/key URL are authenticated with the AWS_* variables of the job env.
+func getS3Config(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*torchrunv1alpha1.S3Config, error) {
+	storage := jq.Spec.WorkspaceStorage
+	if job.Spec.WorkspaceStorage.Source != "" {
+		storage = job.Spec.WorkspaceStorage
+	}
+	if storage.S3 != nil {
+		if storage.S3.UseIRSA && storage.S3.SecretRef != nil {
+			return nil, fmt.Errorf("s3 source sets both useIRSA and secretRef")
+		}
+		return storage.S3, nil
+	}
+
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(storage.URL, "s3://"), "/")
+	if !strings.HasPrefix(storage.URL, "s3://") || !ok || bucket == "" || key == "" {
+		return nil, fmt.Errorf("s3 source requires an s3 config or an s3://bucket/key URL, got %q", storage.URL)
+	}
+	return &torchrunv1alpha1.S3Config{Bucket: bucket, Key: key}, nil
+}
+
+// buildS3Environment configures rclone for the s3 source. Credentials come from the secret,
+// or with env_auth from the AWS_* variables or the web identity token injected for IRSA.
+func buildS3Environment(s3 *torchrunv1alpha1.S3Config) []corev1.EnvVar {
+	provider := "AWS"
+	if s3.Endpoint != "" {
+		// The generic provider uses path-style requests, which MinIO and GCS accept
+		provider = "Other"
+	}
+
+	env := []corev1.EnvVar{
+		{Name: "S3_BUCKET", Value: s3.Bucket},
+		{Name: "S3_KEY", Value: s3.Key},
+		{Name: "RCLONE_CONFIG_S3_TYPE", Value: "s3"},
+		{Name: "RCLONE_CONFIG_S3_PROVIDER", Value: provider},
+		{Name: "RCLONE_CONFIG_S3_ENV_AUTH", Value: "true"},
+	}
+	if s3.Region != "" {
+		env = append(env, corev1.EnvVar{Name: "RCLONE_CONFIG_S3_REGION", Value: s3.Region})
+	}
+	if s3.Endpoint != "" {
+		env = append(env, corev1.EnvVar{Name: "RCLONE_CONFIG_S3_ENDPOINT", Value: s3.Endpoint})
+	}
+
+	if s3.SecretRef != nil {
+		optional := true
+		for _, key := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+			env = append(env, corev1.EnvVar{
+				Name: key,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: *s3.SecretRef,
+						Key:                  key,
+						Optional:             &optional,
+					},
+				},
+			})
+		}
+	}
+
+	return env
+}
+
+// rsyncKeyMountPath is where the SSH key Secret of rsync sources is mounted
+const rsyncKeyMountPath = "/etc/torchrun-ssh"
+
+// rsyncSyncScript copies the workspace over SSH, configured through RSYNC_* in the environment.
+// The key is copied out of the Secret volume because ssh refuses keys readable by others.
+const rsyncSyncScript = `
+	set -e
+	install -m 0600 ` + rsyncKeyMountPath + `/ssh-privatekey /tmp/ssh-privatekey
+	if [ -f ` + rsyncKeyMountPath + `/known_hosts ]; then
+		host_keys="-o UserKnownHostsFile=` + rsyncKeyMountPath + `/known_hosts -o StrictHostKeyChecking=yes"
+	else
+		echo "WARNING: no known_hosts in the SSH secret, accepting the host key of $RSYNC_HOST"
+		host_keys="-o UserKnownHostsFile=/tmp/known_hosts -o StrictHostKeyChecking=accept-new"
+	fi
+	remote="$RSYNC_HOST"
+	if [ -n "$RSYNC_USER" ]; then remote="$RSYNC_USER@$RSYNC_HOST"; fi
+	echo "Copying workspace from $remote:$RSYNC_PATH..."
+	rsync -a --partial -e "ssh -i /tmp/ssh-privatekey -p $RSYNC_PORT -o BatchMode=yes $host_keys" "$remote:${RSYNC_PATH%/}/" /workspace/
+	rm -f /tmp/ssh-privatekey
+	echo "Workspace sync completed"
+	touch /workspace/.sync_success
+`
+
+// getRsyncConfig returns the rsync source config, with job override taking precedence over jq
+func getRsyncConfig(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) (*torchrunv1alpha1.RsyncConfig, error) {
+	storage := jq.Spec.WorkspaceStorage
+	if job.Spec.WorkspaceStorage.Source != "" {
+		storage = job.Spec.WorkspaceStorage
+	}
+	if storage.Rsync == nil {
+		return nil, fmt.Errorf("rsync source requires an rsync config")
+	}
+	return storage.Rsync, nil
+}
+
+// attachRsyncSource configures the sync pod to copy the workspace with rsync over SSH, with the
+// default image for rsync sources without an image
+func attachRsyncSource(rsync *torchrunv1alpha1.RsyncConfig, defaultImage string, podSpec *corev1.PodSpec) {
+	port := rsync.Port
+	if port == 0 {
+		port = 22
+	}
+
+	container := &podSpec.Containers[0]
+	container.Image = defaultImage
+	if rsync.Image != "" {
+		container.Image = rsync.Image
+	}
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "RSYNC_HOST", Value: rsync.Host},
+		corev1.EnvVar{Name: "RSYNC_PORT", Value: strconv.Itoa(int(port))},
+		corev1.EnvVar{Name: "RSYNC_USER", Value: rsync.User},
+		corev1.EnvVar{Name: "RSYNC_PATH", Value: rsync.Path},
+	)
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "ssh-key",
+		MountPath: rsyncKeyMountPath,
+		ReadOnly:  true,
+	})
+
+	defaultMode := int32(0400)
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "ssh-key",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName:  rsync.SecretRef.Name,
+				DefaultMode: &defaultMode,
+			},
+		},
+	})
+}
+
+// syncWaitTimeoutSeconds is how long the sync pod waits for a workspace upload
+const syncWaitTimeoutSeconds = 600
+
+// waitForWorkspaceArchive returns a sync script that retries check every 5 seconds until
+// /workspace/workspace.zip is in place, then extracts it
+func waitForWorkspaceArchive(description, check string) string {
+	return fmt.Sprintf(`
+		echo "Waiting for workspace.zip %[1]s (timeout: %[2]d seconds)..."
+		start_time=$(date +%%s)
+
+		until %[3]s; do
+			elapsed=$(( $(date +%%s) - start_time ))
+			if [ "$elapsed" -ge %[2]d ]; then
+				echo "ERROR: Timed out waiting for workspace.zip %[1]s"
+				exit 1
+			fi
+			sleep 5
+		done
+
+		echo "Extracting workspace.zip..."
+		unzip -q /workspace/workspace.zip -d /workspace/
+		rm -f /workspace/workspace.zip
+		echo "Workspace sync completed"
+		touch /workspace/.sync_success
+	`, description, syncWaitTimeoutSeconds, check)
+}
+
 // buildSyncEnvironment builds environment variables for sync pod
-func (wm *WorkspaceManager) buildSyncEnvironment(job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue) []corev1.EnvVar {
+func (wm *WorkspaceManager) buildSyncEnvironment(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, jq *torchrunv1alpha1.TorchrunQueue, presign bool) ([]corev1.EnvVar, error) {
 	env := []corev1.EnvVar{}
 
+	// Presigned download URL, passed as env so it does not show up in the pod command
+	if UsesUploadServer(job, jq) && presign {
+		_, downloadURL, err := wm.GetUploadURLs(ctx, job, jq)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, corev1.EnvVar{Name: "WORKSPACE_DOWNLOAD_URL", Value: downloadURL})
+	}
+
+	// Source URL, passed as env so the sync script never interprets it
+	source, url := getWorkspaceSource(job, jq)
+	if (source == "zip" || source == "git") && url != "" {
+		// Secret references stand in for a value of the same shape when validating
+		if err := validateWorkspaceURL(source, secretURLReference.ReplaceAllString(url, "secret")); err != nil {
+			return nil, err
+		}
+		env = append(env, buildWorkspaceURLEnvironment(url)...)
+	}
+
+	if source == "s3" {
+		s3, err := getS3Config(job, jq)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, buildS3Environment(s3)...)
+
+		// Secret and IRSA credentials must not be shadowed by static keys from the job env
+		if s3.SecretRef != nil || s3.UseIRSA {
+			return env, nil
+		}
+	}
+
 	// Add job environment variables that might be needed for sync
 	for _, e := range job.Spec.Env {
 		// Only include AWS/cloud credentials that might be needed for S3 sync
@@ -367,5 +970,5 @@ func (wm *WorkspaceManager) buildSyncEnvironment(job *torchrunv1alpha1.TorchrunJ
 		}
 	}
 
-	return env
+	return env, nil
 }
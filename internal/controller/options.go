@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/workqueue"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+)
+
+// ReconcilerOptions tunes the throughput of a controller. The zero value of each field keeps
+// the controller-runtime default.
+type ReconcilerOptions struct {
+	// MaxConcurrentReconciles is the number of objects reconciled in parallel
+	MaxConcurrentReconciles int
+
+	// RateLimiterBaseDelay and RateLimiterMaxDelay bound the per-object exponential backoff
+	// applied when a reconcile fails
+	RateLimiterBaseDelay time.Duration
+	RateLimiterMaxDelay  time.Duration
+
+	// RateLimiterQPS and RateLimiterBurst bound the overall rate of requeues of the controller
+	RateLimiterQPS   float64
+	RateLimiterBurst int
+
+	// QueueShard selects the TorchrunQueues the controller owns by their labels, so several
+	// controller deployments can split the queues. Nil owns every queue.
+	QueueShard labels.Selector
+}
+
+// controllerOptions builds the controller-runtime options. Every controller gets its own rate
+// limiter, so a backlog of jobs never delays queue reconciles.
+func (o ReconcilerOptions) controllerOptions() crcontroller.Options {
+	baseDelay := o.RateLimiterBaseDelay
+	if baseDelay == 0 {
+		baseDelay = 5 * time.Millisecond
+	}
+	maxDelay := o.RateLimiterMaxDelay
+	if maxDelay == 0 {
+		maxDelay = 1000 * time.Second
+	}
+	qps := o.RateLimiterQPS
+	if qps == 0 {
+		qps = 10
+	}
+	burst := o.RateLimiterBurst
+	if burst == 0 {
+		burst = 100
+	}
+
+	return crcontroller.Options{
+		MaxConcurrentReconciles: o.MaxConcurrentReconciles,
+		RateLimiter: workqueue.NewMaxOfRateLimiter(
+			workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+			&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+		),
+	}
+}
@@ -3,18 +3,30 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	goerrors "errors"
 	"fmt"
+	"net/url"
+	"slices"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
-	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/internal/v1alpha1"
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+	"github.com/dream3d/torchrun-controller/internal/kai"
+	"github.com/dream3d/torchrun-controller/internal/patch"
+	"github.com/dream3d/torchrun-controller/internal/shard"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 )
 
@@ -22,6 +34,21 @@ import (
 type TorchrunQueueReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// APIReader reads Secrets directly from the API server so they are never cached
+	APIReader client.Reader
+
+	// ControllerOptions sets the reconcile concurrency and rate limits
+	ControllerOptions controller.Options
+
+	// QueueShard selects the TorchrunQueues the controller reconciles. Nil owns every queue.
+	QueueShard labels.Selector
+
+	// Config holds the operator configuration, reloaded when its ConfigMap changes
+	Config *config.Store
+
+	// KaiQueues reads and writes the kai-scheduler Queues in the version the cluster serves
+	KaiQueues *kai.Client
 }
 
 //+kubebuilder:rbac:groups=torchrun.ai,resources=torchrunqueues,verbs=get;list;watch;create;update;patch;delete
@@ -30,8 +57,12 @@ type TorchrunQueueReconciler struct {
 //+kubebuilder:rbac:groups=scheduling.run.ai,resources=queues,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update
 // Add RBAC for managing queue resources
-//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims;configmaps;secrets;services,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=*,resources=*,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims;configmaps;services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;create
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=torchrun.ai,resources=torchrunjobs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=torchrun.ai,resources=torchrunjobrecords,verbs=get;list;watch
 
 // Reconcile handles the reconciliation loop for JobQueue
 func (r *TorchrunQueueReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -41,18 +72,75 @@ func (r *TorchrunQueueReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	var jobQueue torchrunv1alpha1.TorchrunQueue
 	if err := r.Get(ctx, req.NamespacedName, &jobQueue); err != nil {
 		if errors.IsNotFound(err) {
-			// JobQueue was deleted, cleanup will happen via owner references
+			// JobQueue was deleted, cleanup will happen via owner references. Queues created
+			// before the finalizer have their kai-scheduler Queues deleted here.
 			return r.deleteKaiQueue(ctx, req.Name)
 		}
 		return ctrl.Result{}, err
 	}
+	// Queues relabeled into another shard are reconciled by its controller deployment
+	if !shard.Owns(r.QueueShard, &jobQueue) {
+		return ctrl.Result{}, nil
+	}
+	// A deleted queue stops admitting jobs and is kept until its unfinished jobs are done
+	if !jobQueue.DeletionTimestamp.IsZero() {
+		return r.finalizeQueue(ctx, &jobQueue)
+	}
+	if controllerutil.AddFinalizer(&jobQueue, queueFinalizer) {
+		if err := r.Update(ctx, &jobQueue); err != nil {
+			log.Error(err, "Failed to add finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+	// Status changes are patched against the queue as it was read
+	original := jobQueue.DeepCopy()
 
 	// Validate the pod spec
 	if err := r.validatePodSpec(ctx, &jobQueue); err != nil {
 		log.Error(err, "Pod spec validation failed")
 		// Update status with validation error
 		r.addCondition(&jobQueue, "Valid", "False", "ValidationError", err.Error())
-		if updateErr := r.Status().Update(ctx, &jobQueue); updateErr != nil {
+		if updateErr := patch.Status(ctx, r.Client, &jobQueue, original); updateErr != nil {
+			log.Error(updateErr, "Failed to update status after validation error")
+		}
+		return ctrl.Result{}, err
+	}
+
+	// Validate the child queues
+	if err := validateChildQueues(&jobQueue); err != nil {
+		log.Error(err, "Child queue validation failed")
+		r.addCondition(&jobQueue, "Valid", "False", "InvalidChildQueues", err.Error())
+		if updateErr := patch.Status(ctx, r.Client, &jobQueue, original); updateErr != nil {
+			log.Error(updateErr, "Failed to update status after validation error")
+		}
+		return ctrl.Result{}, err
+	}
+
+	// Validate the job profiles
+	if err := validateProfiles(&jobQueue); err != nil {
+		log.Error(err, "Profile validation failed")
+		r.addCondition(&jobQueue, "Valid", "False", "InvalidProfiles", err.Error())
+		if updateErr := patch.Status(ctx, r.Client, &jobQueue, original); updateErr != nil {
+			log.Error(updateErr, "Failed to update status after validation error")
+		}
+		return ctrl.Result{}, err
+	}
+
+	// Validate the notification targets
+	if err := validateNotifications(&jobQueue); err != nil {
+		log.Error(err, "Notification validation failed")
+		r.addCondition(&jobQueue, "Valid", "False", "InvalidNotifications", err.Error())
+		if updateErr := patch.Status(ctx, r.Client, &jobQueue, original); updateErr != nil {
+			log.Error(updateErr, "Failed to update status after validation error")
+		}
+		return ctrl.Result{}, err
+	}
+
+	// Validate the kinds of the queue resources
+	if err := validateResources(&jobQueue, &r.Config.Get().ResourceTemplates); err != nil {
+		log.Error(err, "Resource validation failed")
+		r.addCondition(&jobQueue, "Valid", "False", "InvalidResources", err.Error())
+		if updateErr := patch.Status(ctx, r.Client, &jobQueue, original); updateErr != nil {
 			log.Error(updateErr, "Failed to update status after validation error")
 		}
 		return ctrl.Result{}, err
@@ -64,19 +152,54 @@ func (r *TorchrunQueueReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
-	// Create or update the kai-scheduler Queue
-	if err := r.createOrUpdateKaiQueue(ctx, &jobQueue); err != nil {
-		log.Error(err, "Failed to create/update kai-scheduler Queue")
+	// Create, update or remove the workspace upload server
+	if err := r.reconcileUploadServer(ctx, &jobQueue); err != nil {
+		log.Error(err, "Failed to reconcile upload server")
+		return ctrl.Result{}, err
+	}
+
+	// Provision or remove the etcd rendezvous of the queue
+	if err := r.reconcileEtcd(ctx, &jobQueue); err != nil {
+		log.Error(err, "Failed to reconcile etcd")
 		return ctrl.Result{}, err
 	}
 
+	// Create or update the kai-scheduler Queue and its children
+	if r.usesKaiScheduler(&jobQueue) {
+		// Without a supported kai-scheduler Queue CRD the jobs of the queue cannot be scheduled
+		if _, err := r.KaiQueues.Version(ctx); err != nil {
+			log.Error(err, "kai-scheduler Queues are not available")
+			reason := "KaiQueueVersionUnsupported"
+			if goerrors.Is(err, kai.ErrNotInstalled) {
+				reason = "KaiQueueCRDNotFound"
+			}
+			r.addCondition(&jobQueue, "QueueReady", "False", reason, err.Error())
+			if updateErr := patch.Status(ctx, r.Client, &jobQueue, original); updateErr != nil {
+				log.Error(updateErr, "Failed to update status after kai-scheduler error")
+			}
+			return ctrl.Result{}, err
+		}
+		if err := r.createOrUpdateKaiQueues(ctx, &jobQueue); err != nil {
+			log.Error(err, "Failed to create/update kai-scheduler Queues")
+			return ctrl.Result{}, err
+		}
+	} else {
+		// A queue that switched to another scheduler no longer needs its kai-scheduler Queues.
+		// Without kai-scheduler installed there are none.
+		if err := r.deleteStaleKaiQueues(ctx, &jobQueue); err != nil && !goerrors.Is(err, kai.ErrNotInstalled) {
+			log.Error(err, "Failed to delete kai-scheduler Queues")
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Update JobQueue status
-	if err := r.updateStatus(ctx, &jobQueue); err != nil {
+	if err := r.updateStatus(ctx, &jobQueue, original); err != nil {
 		log.Error(err, "Failed to update JobQueue status")
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	// Requeue to refresh the utilization
+	return ctrl.Result{RequeueAfter: r.Config.Get().Metrics.QueueUtilizationInterval.Duration}, nil
 }
 
 // validatePodSpec validates the pod spec template
@@ -118,22 +241,66 @@ func (r *TorchrunQueueReconciler) validatePodSpec(ctx context.Context, jobQueue
 	return nil
 }
 
+// validateChildQueues checks that the child queue names are unique and differ from the queue name
+func validateChildQueues(jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	names := map[string]bool{jobQueue.Spec.Queue.Name: true}
+	for _, child := range jobQueue.Spec.Queue.Children {
+		if names[child.Name] {
+			return fmt.Errorf("child queue name %s is used more than once", child.Name)
+		}
+		names[child.Name] = true
+	}
+	return nil
+}
+
+// validateProfiles checks that every job profile has a unique name
+func validateProfiles(jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	names := map[string]bool{}
+	for _, profile := range jobQueue.Spec.Profiles {
+		if names[profile.Name] {
+			return fmt.Errorf("profile name %s is used more than once", profile.Name)
+		}
+		names[profile.Name] = true
+	}
+	return nil
+}
+
+// validateNotifications checks that every notification target has a unique name and exactly
+// one of an http(s) webhook URL and a Slack Secret
+func validateNotifications(jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	names := map[string]bool{}
+	for _, target := range jobQueue.Spec.Notifications {
+		if names[target.Name] {
+			return fmt.Errorf("notification target name %s is used more than once", target.Name)
+		}
+		names[target.Name] = true
+
+		if (target.WebhookURL == "") == (target.Slack == nil) {
+			return fmt.Errorf("notification target %s must set exactly one of webhookURL and slack", target.Name)
+		}
+		if target.WebhookURL != "" {
+			u, err := url.Parse(target.WebhookURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("notification target %s has an invalid webhookURL %q", target.Name, target.WebhookURL)
+			}
+		}
+	}
+	return nil
+}
+
 // reconcileQueueResources creates or updates the resources defined in the queue
 func (r *TorchrunQueueReconciler) reconcileQueueResources(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
 	log := log.FromContext(ctx)
 
 	for _, resourceTemplate := range jobQueue.Spec.Resources {
-		// Parse the resource template
-		obj := &unstructured.Unstructured{}
-		if err := json.Unmarshal(resourceTemplate.Template.Raw, obj); err != nil {
-			return fmt.Errorf("failed to unmarshal resource template %s: %w", resourceTemplate.Name, err)
+		// Parse and render the resource template
+		obj, err := buildResourceObject(jobQueue, &resourceTemplate)
+		if err != nil {
+			return err
 		}
 
 		// Set metadata
-		resourceName := resourceTemplate.Name
-		if resourceTemplate.NameMode == "prefix" {
-			resourceName = fmt.Sprintf("%s-%s", jobQueue.Name, resourceTemplate.Name)
-		}
+		resourceName := getResourceName(jobQueue, &resourceTemplate)
 
 		obj.SetName(resourceName)
 		obj.SetNamespace(jobQueue.Namespace)
@@ -161,13 +328,14 @@ func (r *TorchrunQueueReconciler) reconcileQueueResources(ctx context.Context, j
 		// Check if resource exists
 		existing := &unstructured.Unstructured{}
 		existing.SetGroupVersionKind(obj.GroupVersionKind())
-		err := r.Get(ctx, client.ObjectKey{Name: resourceName, Namespace: jobQueue.Namespace}, existing)
+		err = r.Get(ctx, client.ObjectKey{Name: resourceName, Namespace: jobQueue.Namespace}, existing)
 
 		if err != nil {
 			if errors.IsNotFound(err) {
 				// Create the resource
 				log.Info("Creating queue resource", "kind", obj.GetKind(), "name", resourceName)
-				if err := r.Create(ctx, obj); err != nil {
+				// Already existing resources are updated by the next periodic reconcile
+				if err := r.Create(ctx, obj); err != nil && !errors.IsAlreadyExists(err) {
 					return fmt.Errorf("failed to create resource %s: %w", resourceName, err)
 				}
 			} else {
@@ -186,135 +354,197 @@ func (r *TorchrunQueueReconciler) reconcileQueueResources(ctx context.Context, j
 	return nil
 }
 
-// createOrUpdateKaiQueue creates or updates the kai-scheduler Queue resource
-func (r *TorchrunQueueReconciler) createOrUpdateKaiQueue(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+// usesKaiScheduler returns true if the jobs of the queue are scheduled by kai-scheduler, which
+// schedules queues that do not name a scheduler unless the operator config names another one
+func (r *TorchrunQueueReconciler) usesKaiScheduler(jobQueue *torchrunv1alpha1.TorchrunQueue) bool {
+	schedulerName := jobQueue.Spec.SchedulerName
+	if schedulerName == "" {
+		schedulerName = r.Config.Get().SchedulerName
+	}
+	return schedulerName == config.KaiSchedulerName
+}
+
+// createOrUpdateKaiQueues creates or updates the kai-scheduler Queue of the JobQueue and its
+// children, and deletes the Queues of removed children and of a renamed queue.name
+func (r *TorchrunQueueReconciler) createOrUpdateKaiQueues(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
 	log := log.FromContext(ctx)
 
-	// Build the kai-scheduler Queue object
-	kaiQueue := r.buildKaiQueue(jobQueue)
+	// Add parent queue if specified (default is "default" from kubebuilder annotation)
+	parentQueue := jobQueue.Spec.Queue.ParentQueue
+	if parentQueue == "" {
+		parentQueue = "default"
+	}
+
+	// The parent is created first, kai-scheduler rejects children of unknown queues
+	if err := r.createOrUpdateKaiQueue(ctx, r.buildKaiQueue(jobQueue, jobQueue.Spec.Queue.Name, parentQueue, jobQueue.Spec.Queue.Resources)); err != nil {
+		return err
+	}
+	if previous := jobQueue.Status.KaiQueueName; previous != "" && previous != jobQueue.Spec.Queue.Name {
+		log.Info("kai-scheduler Queue was renamed", "from", previous, "to", jobQueue.Spec.Queue.Name)
+	}
+	jobQueue.Status.KaiQueueName = jobQueue.Spec.Queue.Name
+	for _, child := range jobQueue.Spec.Queue.Children {
+		if err := r.createOrUpdateKaiQueue(ctx, r.buildKaiQueue(jobQueue, child.Name, jobQueue.Spec.Queue.Name, child.Resources)); err != nil {
+			return err
+		}
+	}
+
+	return r.deleteStaleKaiQueues(ctx, jobQueue)
+}
 
-	// Check if the Queue already exists
-	existingQueue := &unstructured.Unstructured{}
-	existingQueue.SetGroupVersionKind(schema.GroupVersionKind{
-		Group:   "scheduling.run.ai",
-		Version: "v2",
-		Kind:    "Queue",
-	})
+// createOrUpdateKaiQueue creates or updates a kai-scheduler Queue resource
+func (r *TorchrunQueueReconciler) createOrUpdateKaiQueue(ctx context.Context, kaiQueue *kai.Queue) error {
+	log := log.FromContext(ctx)
 
-	err := r.Get(ctx, client.ObjectKey{Name: jobQueue.Spec.Queue.Name}, existingQueue)
+	// Check if the Queue already exists
+	existingQueue, err := r.KaiQueues.Get(ctx, kaiQueue.Name)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Create the Queue
-			log.Info("Creating kai-scheduler Queue", "name", jobQueue.Spec.Queue.Name)
-			return r.Create(ctx, kaiQueue)
+			log.Info("Creating kai-scheduler Queue", "name", kaiQueue.Name)
+			if err := r.KaiQueues.Create(ctx, kaiQueue); err != nil && !errors.IsAlreadyExists(err) {
+				return err
+			}
+			return nil
 		}
 		return err
 	}
 
 	// Update the existing Queue
-	log.Info("Updating kai-scheduler Queue", "name", jobQueue.Spec.Queue.Name)
-	kaiQueue.SetResourceVersion(existingQueue.GetResourceVersion())
-	return r.Update(ctx, kaiQueue)
+	log.Info("Updating kai-scheduler Queue", "name", kaiQueue.Name)
+	kaiQueue.ResourceVersion = existingQueue.ResourceVersion
+	return r.KaiQueues.Update(ctx, kaiQueue)
 }
 
-// buildKaiQueue builds a kai-scheduler Queue object from a JobQueue
-func (r *TorchrunQueueReconciler) buildKaiQueue(jobQueue *torchrunv1alpha1.TorchrunQueue) *unstructured.Unstructured {
-	// Build the Queue spec with default values
-	spec := map[string]interface{}{
-		"resources": map[string]interface{}{
-			"cpu": map[string]interface{}{
-				"quota":           jobQueue.Spec.Queue.Resources.CPU.Quota,
-				"limit":           jobQueue.Spec.Queue.Resources.CPU.Limit,
-				"overQuotaWeight": jobQueue.Spec.Queue.Resources.CPU.OverQuotaWeight,
-			},
-			"gpu": map[string]interface{}{
-				"quota":           jobQueue.Spec.Queue.Resources.GPU.Quota,
-				"limit":           jobQueue.Spec.Queue.Resources.GPU.Limit,
-				"overQuotaWeight": jobQueue.Spec.Queue.Resources.GPU.OverQuotaWeight,
-			},
-			"memory": map[string]interface{}{
-				"quota":           jobQueue.Spec.Queue.Resources.Memory.Quota,
-				"limit":           jobQueue.Spec.Queue.Resources.Memory.Limit,
-				"overQuotaWeight": jobQueue.Spec.Queue.Resources.Memory.OverQuotaWeight,
+// buildKaiQueue builds a kai-scheduler Queue object owned by a JobQueue
+func (r *TorchrunQueueReconciler) buildKaiQueue(jobQueue *torchrunv1alpha1.TorchrunQueue, name, parentQueue string, resources torchrunv1alpha1.QueueResources) *kai.Queue {
+	return &kai.Queue{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"torchrun.ai/managed-by": "jobqueue-controller",
+				"torchrun.ai/jobqueue":   jobQueue.Name,
 			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion:         jobQueue.APIVersion,
+				Kind:               jobQueue.Kind,
+				Name:               jobQueue.Name,
+				UID:                jobQueue.UID,
+				Controller:         &[]bool{true}[0],
+				BlockOwnerDeletion: &[]bool{true}[0],
+			}},
 		},
-	}
-
-	// Add parent queue if specified (default is "default" from kubebuilder annotation)
-	parentQueue := jobQueue.Spec.Queue.ParentQueue
-	if parentQueue == "" {
-		parentQueue = "default"
-	}
-	spec["parentQueue"] = parentQueue
-
-	// Create the unstructured object
-	kaiQueue := &unstructured.Unstructured{
-		Object: map[string]interface{}{
-			"apiVersion": "scheduling.run.ai/v2",
-			"kind":       "Queue",
-			"metadata": map[string]interface{}{
-				"name": jobQueue.Spec.Queue.Name,
-				"labels": map[string]interface{}{
-					"torchrun.ai/managed-by": "jobqueue-controller",
-					"torchrun.ai/jobqueue":   jobQueue.Name,
-				},
-				"ownerReferences": []interface{}{
-					map[string]interface{}{
-						"apiVersion":         jobQueue.APIVersion,
-						"kind":               jobQueue.Kind,
-						"name":               jobQueue.Name,
-						"uid":                jobQueue.UID,
-						"controller":         true,
-						"blockOwnerDeletion": true,
-					},
-				},
+		Spec: kai.QueueSpec{
+			ParentQueue: parentQueue,
+			Resources: &kai.QueueResources{
+				CPU:    buildKaiResourceQuota(resources.CPU),
+				GPU:    buildKaiResourceQuota(resources.GPU),
+				Memory: buildKaiResourceQuota(resources.Memory),
 			},
-			"spec": spec,
 		},
 	}
+}
 
-	return kaiQueue
+// buildKaiResourceQuota converts the quota of a resource of a JobQueue to kai-scheduler
+func buildKaiResourceQuota(resource torchrunv1alpha1.ResourceConfig) kai.ResourceQuota {
+	return kai.ResourceQuota{
+		Quota:           float64(resource.Quota),
+		Limit:           float64(resource.Limit),
+		OverQuotaWeight: float64(resource.OverQuotaWeight),
+	}
 }
 
-// deleteKaiQueue deletes the kai-scheduler Queue resource
-func (r *TorchrunQueueReconciler) deleteKaiQueue(ctx context.Context, queueName string) (ctrl.Result, error) {
+// deleteStaleKaiQueues deletes the kai-scheduler Queues of the JobQueue that are no longer in its
+// spec, such as removed children or the Queue of a renamed queue.name. Deleting a Queue would
+// strand the worker pods scheduled in it, so Queues with unfinished pods are kept in
+// status.staleKaiQueues until the pods are gone.
+func (r *TorchrunQueueReconciler) deleteStaleKaiQueues(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
 	log := log.FromContext(ctx)
 
-	// Need to find the kai queue name from the JobQueue name
-	// For now, we'll just try to delete using the same name
-	// In a real implementation, you might want to list queues with the label
+	queues, err := r.KaiQueues.List(ctx, client.MatchingLabels{"torchrun.ai/jobqueue": jobQueue.Name})
+	if err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	if r.usesKaiScheduler(jobQueue) {
+		names[jobQueue.Spec.Queue.Name] = true
+		for _, child := range jobQueue.Spec.Queue.Children {
+			names[child.Name] = true
+		}
+	}
 
-	// List all kai-scheduler Queues with our label
-	queueList := &unstructured.UnstructuredList{}
-	queueList.SetGroupVersionKind(schema.GroupVersionKind{
-		Group:   "scheduling.run.ai",
-		Version: "v2",
-		Kind:    "QueueList",
-	})
+	var stale []string
+	for _, queue := range queues {
+		// Queues are cluster scoped, so JobQueues of the same name in other namespaces label theirs alike
+		if names[queue.Name] || !metav1.IsControlledBy(&queue, jobQueue) {
+			continue
+		}
+		inUse, err := r.kaiQueueInUse(ctx, jobQueue, queue.Name)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			log.Info("Keeping stale kai-scheduler Queue until its worker pods finish", "name", queue.Name)
+			stale = append(stale, queue.Name)
+			continue
+		}
+		if err := r.KaiQueues.Delete(ctx, &queue); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		log.Info("Deleted stale kai-scheduler Queue", "name", queue.Name)
+	}
+	jobQueue.Status.StaleKaiQueues = stale
 
-	labelSelector := client.MatchingLabels{
-		"torchrun.ai/jobqueue": queueName,
+	return nil
+}
+
+// kaiQueueInUse returns true if unfinished worker pods are scheduled in the kai-scheduler Queue.
+// Pods of every namespace are checked, since namespaces bound to the queue schedule in it too.
+func (r *TorchrunQueueReconciler) kaiQueueInUse(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue, name string) (bool, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.MatchingLabels{
+		"kai.scheduler/queue": name,
+	}); err != nil {
+		return false, fmt.Errorf("failed to list pods of kai-scheduler Queue %s: %w", name, err)
 	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
 
-	if err := r.List(ctx, queueList, labelSelector); err != nil {
+// deleteKaiQueue deletes the kai-scheduler Queue resource
+func (r *TorchrunQueueReconciler) deleteKaiQueue(ctx context.Context, queueName string) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// List all kai-scheduler Queues with our label, without kai-scheduler installed there are none
+	queues, err := r.KaiQueues.List(ctx, client.MatchingLabels{"torchrun.ai/jobqueue": queueName})
+	if err != nil {
+		if goerrors.Is(err, kai.ErrNotInstalled) {
+			return ctrl.Result{}, nil
+		}
 		log.Error(err, "Failed to list kai-scheduler Queues")
 		return ctrl.Result{}, err
 	}
 
 	// Delete all matching queues
-	for _, queue := range queueList.Items {
-		if err := r.Delete(ctx, &queue); err != nil && !errors.IsNotFound(err) {
-			log.Error(err, "Failed to delete kai-scheduler Queue", "name", queue.GetName())
+	for _, queue := range queues {
+		if err := r.KaiQueues.Delete(ctx, &queue); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to delete kai-scheduler Queue", "name", queue.Name)
 			return ctrl.Result{}, err
 		}
-		log.Info("Deleted kai-scheduler Queue", "name", queue.GetName())
+		log.Info("Deleted kai-scheduler Queue", "name", queue.Name)
 	}
 
 	return ctrl.Result{}, nil
 }
 
-// updateStatus updates the JobQueue status
-func (r *TorchrunQueueReconciler) updateStatus(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+// updateStatus updates the JobQueue status and patches the changes since base, the queue as it
+// was read
+func (r *TorchrunQueueReconciler) updateStatus(ctx context.Context, jobQueue, base *torchrunv1alpha1.TorchrunQueue) error {
 	// Update status fields
 	jobQueue.Status.Phase = "Active"
 	now := metav1.Now()
@@ -324,24 +554,28 @@ func (r *TorchrunQueueReconciler) updateStatus(ctx context.Context, jobQueue *to
 	// Add validation passed condition
 	r.addCondition(jobQueue, "Valid", "True", "ValidationPassed", "Pod spec validation passed")
 
-	// Check if kai-scheduler Queue exists and is ready
-	kaiQueue := &unstructured.Unstructured{}
-	kaiQueue.SetGroupVersionKind(schema.GroupVersionKind{
-		Group:   "scheduling.run.ai",
-		Version: "v2",
-		Kind:    "Queue",
-	})
-
-	err := r.Get(ctx, client.ObjectKey{Name: jobQueue.Spec.Queue.Name}, kaiQueue)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			jobQueue.Status.Phase = "Updating"
-			r.addCondition(jobQueue, "QueueReady", "False", "QueueNotFound", "Kai-scheduler Queue not found")
-		} else {
-			r.addCondition(jobQueue, "QueueReady", "Unknown", "GetQueueError", fmt.Sprintf("Failed to get Queue: %v", err))
+	// Check the kai-scheduler Queues, queues of other schedulers have none
+	if r.usesKaiScheduler(jobQueue) {
+		if err := r.updateKaiQueueStatus(ctx, jobQueue); err != nil {
+			return err
 		}
 	} else {
-		r.addCondition(jobQueue, "QueueReady", "True", "QueueExists", "Kai-scheduler Queue is ready")
+		jobQueue.Status.KaiQueueName = ""
+		jobQueue.Status.ChildQueues = nil
+		jobQueue.Status.ChildQuota = nil
+		r.removeCondition(jobQueue, "QueueReady")
+		r.removeCondition(jobQueue, "ChildQueuesReady")
+		r.removeCondition(jobQueue, "ChildQuotaValid")
+	}
+
+	// Sum the resources used by the queue and count its jobs
+	if err := r.updateUtilization(ctx, jobQueue); err != nil {
+		return err
+	}
+	if r.usesKaiScheduler(jobQueue) {
+		r.updateOverQuota(jobQueue)
+	} else {
+		r.removeCondition(jobQueue, "OverQuota")
 	}
 
 	// Check resource statuses
@@ -349,45 +583,10 @@ func (r *TorchrunQueueReconciler) updateStatus(ctx context.Context, jobQueue *to
 	jobQueue.Status.ResourceStatuses = []torchrunv1alpha1.ResourceStatus{}
 
 	for _, resourceTemplate := range jobQueue.Spec.Resources {
-		resourceName := resourceTemplate.Name
-		if resourceTemplate.NameMode == "prefix" {
-			resourceName = fmt.Sprintf("%s-%s", jobQueue.Name, resourceTemplate.Name)
-		}
-
-		// Parse the template to get the kind
-		var obj map[string]interface{}
-		if err := json.Unmarshal(resourceTemplate.Template.Raw, &obj); err != nil {
-			continue
-		}
-
-		kind, _ := obj["kind"].(string)
-
-		// Check if resource exists
-		resourceObj := &unstructured.Unstructured{}
-		resourceObj.SetGroupVersionKind(schema.GroupVersionKind{
-			Group:   "", // Core API group
-			Version: "v1",
-			Kind:    kind,
-		})
-
-		err := r.Get(ctx, client.ObjectKey{Name: resourceName, Namespace: jobQueue.Namespace}, resourceObj)
-		status := torchrunv1alpha1.ResourceStatus{
-			Name:  resourceName,
-			Kind:  kind,
-			Ready: err == nil,
-		}
-
-		if err != nil {
+		status := r.getResourceStatus(ctx, jobQueue, &resourceTemplate)
+		if !status.Ready {
 			resourcesReady = false
-			if errors.IsNotFound(err) {
-				status.Message = "Resource not found"
-			} else {
-				status.Message = fmt.Sprintf("Failed to get resource: %v", err)
-			}
-		} else {
-			status.Message = "Resource is ready"
 		}
-
 		jobQueue.Status.ResourceStatuses = append(jobQueue.Status.ResourceStatuses, status)
 	}
 
@@ -398,7 +597,57 @@ func (r *TorchrunQueueReconciler) updateStatus(ctx context.Context, jobQueue *to
 		r.addCondition(jobQueue, "ResourcesReady", "False", "ResourcesNotReady", "Some queue resources are not ready")
 	}
 
-	return r.Status().Update(ctx, jobQueue)
+	return patch.Status(ctx, r.Client, jobQueue, base)
+}
+
+// updateKaiQueueStatus checks the kai-scheduler Queue of the JobQueue and its children and sums
+// the child quotas
+func (r *TorchrunQueueReconciler) updateKaiQueueStatus(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	// Check if kai-scheduler Queue exists and is ready
+	_, err := r.KaiQueues.Get(ctx, jobQueue.Spec.Queue.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			jobQueue.Status.Phase = "Updating"
+			r.addCondition(jobQueue, "QueueReady", "False", "QueueNotFound", "Kai-scheduler Queue not found")
+		} else {
+			r.addCondition(jobQueue, "QueueReady", "Unknown", "GetQueueError", fmt.Sprintf("Failed to get Queue: %v", err))
+		}
+	} else {
+		r.addCondition(jobQueue, "QueueReady", "True", "QueueExists", "Kai-scheduler Queue is ready")
+	}
+
+	// Check the child kai-scheduler Queues and sum their quotas
+	jobQueue.Status.ChildQueues = nil
+	jobQueue.Status.ChildQuota = nil
+	if children := jobQueue.Spec.Queue.Children; len(children) > 0 {
+		childrenReady := true
+		for _, child := range children {
+			_, err := r.KaiQueues.Get(ctx, child.Name)
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			childrenReady = childrenReady && err == nil
+			jobQueue.Status.ChildQueues = append(jobQueue.Status.ChildQueues, torchrunv1alpha1.ChildQueueStatus{Name: child.Name, Ready: err == nil})
+		}
+		if childrenReady {
+			r.addCondition(jobQueue, "ChildQueuesReady", "True", "ChildQueuesExist", "Kai-scheduler child Queues are ready")
+		} else {
+			jobQueue.Status.Phase = "Updating"
+			r.addCondition(jobQueue, "ChildQueuesReady", "False", "ChildQueueNotFound", "Some kai-scheduler child Queues were not found")
+		}
+
+		// Child quotas above the parent quota cannot all be guaranteed
+		jobQueue.Status.ChildQuota = sumChildQuotas(children)
+		if exceeded := getExceededQuotas(jobQueue.Spec.Queue.Resources, jobQueue.Status.ChildQuota); len(exceeded) > 0 {
+			r.addCondition(jobQueue, "ChildQuotaValid", "False", "ChildQuotaExceedsParent", fmt.Sprintf("Child queue quotas exceed the queue quota for %s", strings.Join(exceeded, ", ")))
+		} else {
+			r.addCondition(jobQueue, "ChildQuotaValid", "True", "ChildQuotaWithinParent", "Child queue quotas fit in the queue quota")
+		}
+	} else {
+		r.removeCondition(jobQueue, "ChildQueuesReady")
+		r.removeCondition(jobQueue, "ChildQuotaValid")
+	}
+	return nil
 }
 
 // addCondition adds or updates a condition on the JobQueue
@@ -426,13 +675,54 @@ func (r *TorchrunQueueReconciler) addCondition(jobQueue *torchrunv1alpha1.Torchr
 	jobQueue.Status.Conditions = append(jobQueue.Status.Conditions, newCondition)
 }
 
+// removeCondition removes a condition from the JobQueue
+func (r *TorchrunQueueReconciler) removeCondition(jobQueue *torchrunv1alpha1.TorchrunQueue, condType string) {
+	jobQueue.Status.Conditions = slices.DeleteFunc(jobQueue.Status.Conditions, func(condition torchrunv1alpha1.JobQueueCondition) bool {
+		return condition.Type == condType
+	})
+}
+
+// sumChildQuotas sums the quotas of the child queues. Unlimited quotas (-1) are left out.
+func sumChildQuotas(children []torchrunv1alpha1.ChildQueueConfig) *torchrunv1alpha1.ChildQuotaStatus {
+	quota := &torchrunv1alpha1.ChildQuotaStatus{}
+	for _, child := range children {
+		quota.CPU += max(child.Resources.CPU.Quota, 0)
+		quota.GPU += max(child.Resources.GPU.Quota, 0)
+		quota.Memory += max(child.Resources.Memory.Quota, 0)
+	}
+	return quota
+}
+
+// getExceededQuotas returns the resources whose summed child quota is above the quota of the
+// parent. An unlimited parent quota (-1) is never exceeded.
+func getExceededQuotas(resources torchrunv1alpha1.QueueResources, quota *torchrunv1alpha1.ChildQuotaStatus) []string {
+	var exceeded []string
+	for _, resource := range []struct {
+		name   string
+		parent int
+		child  int
+	}{
+		{"cpu", resources.CPU.Quota, quota.CPU},
+		{"gpu", resources.GPU.Quota, quota.GPU},
+		{"memory", resources.Memory.Quota, quota.Memory},
+	} {
+		if resource.parent >= 0 && resource.child > resource.parent {
+			exceeded = append(exceeded, resource.name)
+		}
+	}
+	return exceeded
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *TorchrunQueueReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&torchrunv1alpha1.TorchrunQueue{}).
+		For(&torchrunv1alpha1.TorchrunQueue{}, builder.WithPredicates(shard.Predicate(r.QueueShard))).
 		// Watch for owned resources
 		Owns(&corev1.PersistentVolumeClaim{}).
 		Owns(&corev1.ConfigMap{}).
-		Owns(&corev1.Secret{}).
+		Owns(&corev1.Service{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		WithOptions(r.ControllerOptions).
 		Complete(r)
 }
@@ -0,0 +1,407 @@
+package controller
+
+import (
+	"context"
+	goerrors "errors"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/kai"
+)
+
+// kaiQueueGVK is the kind of kai-scheduler Queues, registered as unstructured in the test scheme
+var kaiQueueGVK = schema.GroupVersionKind{Group: "scheduling.run.ai", Version: "v2", Kind: "Queue"}
+
+// newKaiQueueCRD returns the CRD of kai-scheduler Queues serving v2, which the Queue client
+// detects the version from
+func newKaiQueueCRD() *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: kai.QueueCRDName},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v2", Served: true, Storage: true}},
+		},
+	}
+}
+
+func getKaiQueue(ctx context.Context, c client.Client, name string) (*unstructured.Unstructured, error) {
+	kaiQueue := &unstructured.Unstructured{}
+	kaiQueue.SetGroupVersionKind(kaiQueueGVK)
+	return kaiQueue, c.Get(ctx, client.ObjectKey{Name: name}, kaiQueue)
+}
+
+func TestCreateOrUpdateKaiQueues(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := apiextensionsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	scheme.AddKnownTypeWithName(kaiQueueGVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(kaiQueueGVK.GroupVersion().WithKind("QueueList"), &unstructured.UnstructuredList{})
+
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default", UID: "research-uid"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue: torchrunv1alpha1.QueueConfig{
+				Name:      "research",
+				Resources: torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: 16, Limit: -1, OverQuotaWeight: 1}},
+				Children: []torchrunv1alpha1.ChildQueueConfig{
+					{Name: "research-vision", Resources: torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: 8, Limit: -1, OverQuotaWeight: 3}}},
+					{Name: "research-nlp", Resources: torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: 12, Limit: -1, OverQuotaWeight: 1}}},
+				},
+			},
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(jq, newKaiQueueCRD()).WithStatusSubresource(jq).Build()
+	r := &TorchrunQueueReconciler{Client: c, APIReader: c, Scheme: scheme, KaiQueues: kai.NewClient(c, c)}
+	ctx := context.Background()
+
+	// The parent and all children are created, the children under the parent
+	if err := r.createOrUpdateKaiQueues(ctx, jq); err != nil {
+		t.Fatalf("createOrUpdateKaiQueues() error = %v", err)
+	}
+
+	parent, err := getKaiQueue(ctx, c, "research")
+	if err != nil {
+		t.Fatalf("expected parent kai-scheduler Queue: %v", err)
+	}
+	if parentQueue, _, _ := unstructured.NestedString(parent.Object, "spec", "parentQueue"); parentQueue != "default" {
+		t.Errorf("expected parent queue default, got %q", parentQueue)
+	}
+	vision, err := getKaiQueue(ctx, c, "research-vision")
+	if err != nil {
+		t.Fatalf("expected child kai-scheduler Queue: %v", err)
+	}
+	if parentQueue, _, _ := unstructured.NestedString(vision.Object, "spec", "parentQueue"); parentQueue != "research" {
+		t.Errorf("expected child parent queue research, got %q", parentQueue)
+	}
+	if weight, _, _ := unstructured.NestedInt64(vision.Object, "spec", "resources", "gpu", "overQuotaWeight"); weight != 3 {
+		t.Errorf("expected child GPU weight 3, got %d", weight)
+	}
+	if vision.GetLabels()["torchrun.ai/jobqueue"] != "research" {
+		t.Errorf("expected child to carry the jobqueue label, got %v", vision.GetLabels())
+	}
+
+	// Child quotas are summed into the status and checked against the parent quota
+	if err := r.updateStatus(ctx, jq, jq.DeepCopy()); err != nil {
+		t.Fatalf("updateStatus() error = %v", err)
+	}
+	if len(jq.Status.ChildQueues) != 2 || !jq.Status.ChildQueues[0].Ready || !jq.Status.ChildQueues[1].Ready {
+		t.Errorf("expected two ready child queues, got %+v", jq.Status.ChildQueues)
+	}
+	if jq.Status.ChildQuota == nil || jq.Status.ChildQuota.GPU != 20 {
+		t.Errorf("expected child GPU quota 20, got %+v", jq.Status.ChildQuota)
+	}
+	if !slices.ContainsFunc(jq.Status.Conditions, func(condition torchrunv1alpha1.JobQueueCondition) bool {
+		return condition.Type == "ChildQuotaValid" && condition.Status == "False" && condition.Reason == "ChildQuotaExceedsParent"
+	}) {
+		t.Errorf("expected child quota to exceed the parent, got %+v", jq.Status.Conditions)
+	}
+
+	// Removed children are deleted, the remaining queues are kept
+	jq.Spec.Queue.Children = jq.Spec.Queue.Children[:1]
+	if err := r.createOrUpdateKaiQueues(ctx, jq); err != nil {
+		t.Fatalf("createOrUpdateKaiQueues() error = %v", err)
+	}
+	if _, err := getKaiQueue(ctx, c, "research-nlp"); !errors.IsNotFound(err) {
+		t.Errorf("expected removed child to be deleted, got %v", err)
+	}
+	for _, name := range []string{"research", "research-vision"} {
+		if _, err := getKaiQueue(ctx, c, name); err != nil {
+			t.Errorf("expected kai-scheduler Queue %s to be kept: %v", name, err)
+		}
+	}
+}
+
+func TestRenameKaiQueue(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := apiextensionsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	scheme.AddKnownTypeWithName(kaiQueueGVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(kaiQueueGVK.GroupVersion().WithKind("QueueList"), &unstructured.UnstructuredList{})
+
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default", UID: "research-uid"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue: torchrunv1alpha1.QueueConfig{
+				Name:     "research",
+				Children: []torchrunv1alpha1.ChildQueueConfig{{Name: "research-vision"}},
+			},
+		},
+	}
+	// A worker pod of a running job is scheduled in the original Queue
+	worker := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "train-0", Namespace: "default", Labels: map[string]string{"kai.scheduler/queue": "research"}},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	// The JobQueue of the same name in another namespace labels its Queue alike
+	other := &torchrunv1alpha1.TorchrunQueue{ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "team-b", UID: "team-b-uid"}}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(jq, worker, newKaiQueueCRD()).WithStatusSubresource(jq).Build()
+	r := &TorchrunQueueReconciler{Client: c, APIReader: c, Scheme: scheme, KaiQueues: kai.NewClient(c, c)}
+	ctx := context.Background()
+
+	if err := r.createOrUpdateKaiQueue(ctx, r.buildKaiQueue(other, "team-b-research", "default", torchrunv1alpha1.QueueResources{})); err != nil {
+		t.Fatalf("createOrUpdateKaiQueue() error = %v", err)
+	}
+	if err := r.createOrUpdateKaiQueues(ctx, jq); err != nil {
+		t.Fatalf("createOrUpdateKaiQueues() error = %v", err)
+	}
+	if jq.Status.KaiQueueName != "research" {
+		t.Errorf("expected kai-scheduler Queue research in status, got %q", jq.Status.KaiQueueName)
+	}
+
+	// The renamed Queue is created and the children move under it, the old one is kept for the worker
+	jq.Spec.Queue.Name = "research-v2"
+	if err := r.createOrUpdateKaiQueues(ctx, jq); err != nil {
+		t.Fatalf("createOrUpdateKaiQueues() error = %v", err)
+	}
+	if jq.Status.KaiQueueName != "research-v2" || !slices.Equal(jq.Status.StaleKaiQueues, []string{"research"}) {
+		t.Errorf("expected research-v2 with stale research, got %q and %v", jq.Status.KaiQueueName, jq.Status.StaleKaiQueues)
+	}
+	vision, err := getKaiQueue(ctx, c, "research-vision")
+	if err != nil {
+		t.Fatalf("expected child kai-scheduler Queue: %v", err)
+	}
+	if parentQueue, _, _ := unstructured.NestedString(vision.Object, "spec", "parentQueue"); parentQueue != "research-v2" {
+		t.Errorf("expected child parent queue research-v2, got %q", parentQueue)
+	}
+	if _, err := getKaiQueue(ctx, c, "research"); err != nil {
+		t.Errorf("expected the Queue in use to be kept: %v", err)
+	}
+
+	// Once the worker finished the old Queue is deleted
+	worker.Status.Phase = corev1.PodSucceeded
+	if err := c.Status().Update(ctx, worker); err != nil {
+		t.Fatalf("failed to update pod: %v", err)
+	}
+	if err := r.createOrUpdateKaiQueues(ctx, jq); err != nil {
+		t.Fatalf("createOrUpdateKaiQueues() error = %v", err)
+	}
+	if _, err := getKaiQueue(ctx, c, "research"); !errors.IsNotFound(err) {
+		t.Errorf("expected the old Queue to be deleted, got %v", err)
+	}
+	if len(jq.Status.StaleKaiQueues) != 0 {
+		t.Errorf("expected no stale Queues, got %v", jq.Status.StaleKaiQueues)
+	}
+
+	// Switching to another scheduler deletes the Queues of the JobQueue only
+	jq.Spec.SchedulerName = "volcano"
+	if err := r.deleteStaleKaiQueues(ctx, jq); err != nil {
+		t.Fatalf("deleteStaleKaiQueues() error = %v", err)
+	}
+	for _, name := range []string{"research-v2", "research-vision"} {
+		if _, err := getKaiQueue(ctx, c, name); !errors.IsNotFound(err) {
+			t.Errorf("expected kai-scheduler Queue %s to be deleted, got %v", name, err)
+		}
+	}
+	if _, err := getKaiQueue(ctx, c, "team-b-research"); err != nil {
+		t.Errorf("expected the Queue of the other namespace to be kept: %v", err)
+	}
+}
+
+func TestUpdateStatusOtherScheduler(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	// kai-scheduler is not installed, so its Queues are not known to the client
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default", UID: "research-uid"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			Queue:         torchrunv1alpha1.QueueConfig{Name: "research"},
+			SchedulerName: "volcano",
+		},
+		Status: torchrunv1alpha1.JobQueueStatus{
+			Conditions: []torchrunv1alpha1.JobQueueCondition{{Type: "QueueReady", Status: "False", Reason: "QueueNotFound"}},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(jq).WithStatusSubresource(jq).Build()
+	r := &TorchrunQueueReconciler{Client: c, APIReader: c, Scheme: scheme}
+
+	if err := r.updateStatus(context.Background(), jq, jq.DeepCopy()); err != nil {
+		t.Fatalf("updateStatus() error = %v", err)
+	}
+	if jq.Status.Phase != "Active" {
+		t.Errorf("expected phase Active, got %s", jq.Status.Phase)
+	}
+	if slices.ContainsFunc(jq.Status.Conditions, func(condition torchrunv1alpha1.JobQueueCondition) bool {
+		return condition.Type == "QueueReady"
+	}) {
+		t.Errorf("expected no QueueReady condition, got %+v", jq.Status.Conditions)
+	}
+}
+
+func TestReconcileWithoutKaiQueueCRD(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := apiextensionsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default", UID: "research-uid"},
+		Spec:       torchrunv1alpha1.JobQueueSpec{Queue: torchrunv1alpha1.QueueConfig{Name: "research"}},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(jq).WithStatusSubresource(jq).Build()
+	r := &TorchrunQueueReconciler{Client: c, APIReader: c, Scheme: scheme, KaiQueues: kai.NewClient(c, c)}
+	ctx := context.Background()
+
+	// The queue fails to reconcile with a condition naming the missing CRD
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(jq)})
+	if !goerrors.Is(err, kai.ErrNotInstalled) {
+		t.Fatalf("expected ErrNotInstalled, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(jq), jq); err != nil {
+		t.Fatalf("failed to get queue: %v", err)
+	}
+	if !slices.ContainsFunc(jq.Status.Conditions, func(condition torchrunv1alpha1.JobQueueCondition) bool {
+		return condition.Type == "QueueReady" && condition.Status == "False" && condition.Reason == "KaiQueueCRDNotFound"
+	}) {
+		t.Errorf("expected QueueReady condition KaiQueueCRDNotFound, got %+v", jq.Status.Conditions)
+	}
+
+	// Deleting a queue without kai-scheduler has no Queues to clean up
+	if _, err := r.deleteKaiQueue(ctx, "research"); err != nil {
+		t.Errorf("expected deleting without kai-scheduler to pass, got %v", err)
+	}
+}
+
+func TestGetExceededQuotas(t *testing.T) {
+	children := []torchrunv1alpha1.ChildQueueConfig{
+		{Resources: torchrunv1alpha1.QueueResources{
+			CPU:    torchrunv1alpha1.ResourceConfig{Quota: 32},
+			GPU:    torchrunv1alpha1.ResourceConfig{Quota: 8},
+			Memory: torchrunv1alpha1.ResourceConfig{Quota: -1},
+		}},
+		{Resources: torchrunv1alpha1.QueueResources{
+			CPU:    torchrunv1alpha1.ResourceConfig{Quota: 32},
+			GPU:    torchrunv1alpha1.ResourceConfig{Quota: 8},
+			Memory: torchrunv1alpha1.ResourceConfig{Quota: 256},
+		}},
+	}
+
+	tests := []struct {
+		description string
+		resources   torchrunv1alpha1.QueueResources
+		expected    []string
+	}{
+		{
+			description: "children within the parent quota",
+			resources: torchrunv1alpha1.QueueResources{
+				CPU:    torchrunv1alpha1.ResourceConfig{Quota: 64},
+				GPU:    torchrunv1alpha1.ResourceConfig{Quota: 16},
+				Memory: torchrunv1alpha1.ResourceConfig{Quota: 256},
+			},
+		},
+		{
+			description: "unlimited parent quota is never exceeded",
+			resources: torchrunv1alpha1.QueueResources{
+				CPU:    torchrunv1alpha1.ResourceConfig{Quota: -1},
+				GPU:    torchrunv1alpha1.ResourceConfig{Quota: -1},
+				Memory: torchrunv1alpha1.ResourceConfig{Quota: -1},
+			},
+		},
+		{
+			description: "children above the parent quota",
+			resources: torchrunv1alpha1.QueueResources{
+				CPU:    torchrunv1alpha1.ResourceConfig{Quota: 48},
+				GPU:    torchrunv1alpha1.ResourceConfig{Quota: 16},
+				Memory: torchrunv1alpha1.ResourceConfig{Quota: 128},
+			},
+			expected: []string{"cpu", "memory"},
+		},
+	}
+
+	quota := sumChildQuotas(children)
+	if *quota != (torchrunv1alpha1.ChildQuotaStatus{CPU: 64, GPU: 16, Memory: 256}) {
+		t.Fatalf("expected unlimited quotas to be left out of the sum, got %+v", quota)
+	}
+	for _, test := range tests {
+		if exceeded := getExceededQuotas(test.resources, quota); !slices.Equal(exceeded, test.expected) {
+			t.Errorf("%s: expected exceeded quotas %v, got %v", test.description, test.expected, exceeded)
+		}
+	}
+}
+
+func TestValidateNotifications(t *testing.T) {
+	slack := &torchrunv1alpha1.SlackNotificationConfig{SecretRef: corev1.LocalObjectReference{Name: "slack"}}
+
+	tests := []struct {
+		description string
+		targets     []torchrunv1alpha1.NotificationConfig
+		expectError bool
+	}{
+		{
+			description: "webhook and Slack targets are valid",
+			targets: []torchrunv1alpha1.NotificationConfig{
+				{Name: "webhook", WebhookURL: "https://hooks.example.com/torchrun"},
+				{Name: "slack", Slack: slack},
+			},
+		},
+		{
+			description: "target without webhook or Slack is invalid",
+			targets:     []torchrunv1alpha1.NotificationConfig{{Name: "empty"}},
+			expectError: true,
+		},
+		{
+			description: "target with webhook and Slack is invalid",
+			targets:     []torchrunv1alpha1.NotificationConfig{{Name: "both", WebhookURL: "https://hooks.example.com", Slack: slack}},
+			expectError: true,
+		},
+		{
+			description: "webhook without http scheme is invalid",
+			targets:     []torchrunv1alpha1.NotificationConfig{{Name: "webhook", WebhookURL: "hooks.example.com/torchrun"}},
+			expectError: true,
+		},
+		{
+			description: "duplicate target names are invalid",
+			targets: []torchrunv1alpha1.NotificationConfig{
+				{Name: "team", WebhookURL: "https://hooks.example.com/a"},
+				{Name: "team", WebhookURL: "https://hooks.example.com/b"},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{Spec: torchrunv1alpha1.JobQueueSpec{Notifications: test.targets}}
+		if err := validateNotifications(jq); (err != nil) != test.expectError {
+			t.Errorf("%s: expected error %v, got %v", test.description, test.expectError, err)
+		}
+	}
+}
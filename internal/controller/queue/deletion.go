@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/patch"
+)
+
+// queueFinalizer keeps a deleted TorchrunQueue until its unfinished jobs are done, so no job is
+// left pointing at a queue that no longer exists
+const queueFinalizer = "torchrun.ai/queue-protection"
+
+// terminatingRequeueInterval is how often a deleted queue checks whether its jobs are done
+const terminatingRequeueInterval = 30 * time.Second
+
+// maxListedJobs is the number of blocking jobs named in the Terminating condition
+const maxListedJobs = 5
+
+// finalizeQueue waits for the unfinished jobs of a deleted queue, which admits no new jobs while
+// Terminating, then deletes its kai-scheduler Queues and removes the finalizer
+func (r *TorchrunQueueReconciler) finalizeQueue(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	if !controllerutil.ContainsFinalizer(jobQueue, queueFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	jobs, err := r.getUnfinishedJobs(ctx, jobQueue)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(jobs) > 0 {
+		original := jobQueue.DeepCopy()
+		jobQueue.Status.Phase = "Terminating"
+		names := jobs
+		if len(names) > maxListedJobs {
+			names = append(names[:maxListedJobs:maxListedJobs], fmt.Sprintf("and %d more", len(jobs)-maxListedJobs))
+		}
+		message := fmt.Sprintf("Deletion waits for %d unfinished jobs: %s", len(jobs), strings.Join(names, ", "))
+		r.addCondition(jobQueue, "Terminating", "True", "WaitingForJobs", message)
+		// The condition names the blocking jobs, so its message is refreshed while it holds
+		for i := range jobQueue.Status.Conditions {
+			if jobQueue.Status.Conditions[i].Type == "Terminating" {
+				jobQueue.Status.Conditions[i].Message = message
+			}
+		}
+		if err := patch.Status(ctx, r.Client, jobQueue, original); err != nil {
+			return ctrl.Result{}, err
+		}
+		log.Info("Queue deletion waits for unfinished jobs", "jobs", len(jobs))
+		return ctrl.Result{RequeueAfter: terminatingRequeueInterval}, nil
+	}
+
+	if result, err := r.deleteKaiQueue(ctx, jobQueue.Name); err != nil {
+		return result, err
+	}
+	controllerutil.RemoveFinalizer(jobQueue, queueFinalizer)
+	if err := r.Update(ctx, jobQueue); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	log.Info("Removed finalizer of deleted queue")
+	return ctrl.Result{}, nil
+}
+
+// getUnfinishedJobs returns the namespace/name of the jobs of the queue that have not finished.
+// Jobs of every namespace are checked, since namespaces bound to the queue submit to it too.
+func (r *TorchrunQueueReconciler) getUnfinishedJobs(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) ([]string, error) {
+	jobs := &torchrunv1alpha1.TorchrunJobList{}
+	if err := r.List(ctx, jobs); err != nil {
+		return nil, fmt.Errorf("failed to list jobs of queue %s: %w", jobQueue.Name, err)
+	}
+	var unfinished []string
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.Spec.Queue != jobQueue.Name || getJobQueueNamespace(job) != jobQueue.Namespace {
+			continue
+		}
+		switch job.Status.Phase {
+		case torchrunv1alpha1.PhaseSucceeded, torchrunv1alpha1.PhaseFailed, torchrunv1alpha1.PhaseTimedOut, torchrunv1alpha1.PhaseDeleted:
+			continue
+		}
+		unfinished = append(unfinished, job.Namespace+"/"+job.Name)
+	}
+	return unfinished, nil
+}
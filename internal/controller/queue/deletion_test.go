@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/kai"
+)
+
+func TestFinalizeQueue(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := apiextensionsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	deleted := metav1.Now()
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "research",
+			Namespace:         "default",
+			DeletionTimestamp: &deleted,
+			Finalizers:        []string{queueFinalizer},
+		},
+		Spec: torchrunv1alpha1.JobQueueSpec{Queue: torchrunv1alpha1.QueueConfig{Name: "research"}},
+	}
+	newJob := func(name, namespace, queueNamespace, phase string) *torchrunv1alpha1.TorchrunJob {
+		return &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{Queue: "research", QueueNamespace: queueNamespace},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{Phase: phase},
+		}
+	}
+	running := newJob("train", "default", "", torchrunv1alpha1.PhaseRunning)
+	bound := newJob("eval", "team-a", "default", torchrunv1alpha1.PhaseQueued)
+	finished := newJob("done", "default", "", torchrunv1alpha1.PhaseSucceeded)
+	// A job of a queue of the same name in another namespace
+	other := newJob("train", "team-b", "", torchrunv1alpha1.PhaseRunning)
+
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(jq, running, bound, finished, other).
+		WithStatusSubresource(jq).Build()
+	r := &TorchrunQueueReconciler{Client: c, APIReader: c, Scheme: scheme, KaiQueues: kai.NewClient(c, c)}
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(jq)}
+
+	// Unfinished jobs of the queue block its deletion
+	result, err := r.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if result.RequeueAfter != terminatingRequeueInterval {
+		t.Errorf("expected requeue after %v, got %v", terminatingRequeueInterval, result.RequeueAfter)
+	}
+	if err := c.Get(ctx, req.NamespacedName, jq); err != nil {
+		t.Fatalf("expected the queue to be kept: %v", err)
+	}
+	if jq.Status.Phase != "Terminating" {
+		t.Errorf("expected phase Terminating, got %q", jq.Status.Phase)
+	}
+	if len(jq.Status.Conditions) != 1 || jq.Status.Conditions[0].Reason != "WaitingForJobs" ||
+		!strings.Contains(jq.Status.Conditions[0].Message, "2 unfinished jobs: default/train, team-a/eval") {
+		t.Errorf("expected Terminating condition naming the unfinished jobs, got %+v", jq.Status.Conditions)
+	}
+
+	// Once they finished, the finalizer is removed and the queue is gone
+	for _, job := range []*torchrunv1alpha1.TorchrunJob{running, bound} {
+		job.Status.Phase = torchrunv1alpha1.PhaseSucceeded
+		if err := c.Update(ctx, job); err != nil {
+			t.Fatalf("failed to update job: %v", err)
+		}
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := c.Get(ctx, req.NamespacedName, jq); !errors.IsNotFound(err) {
+		t.Errorf("expected the queue to be deleted, got %v with finalizers %v", err, jq.Finalizers)
+	}
+}
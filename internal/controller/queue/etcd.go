@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// etcdClientPort is the client port of the provisioned etcd
+const etcdClientPort = 2379
+
+// etcdDialTimeout bounds the reachability check of the configured rendezvous endpoint
+const etcdDialTimeout = 2 * time.Second
+
+// reconcileEtcd provisions an etcd for queues with the etcd-v2 rendezvous backend whose
+// rdzvEndpoint is not reachable, and records its endpoint in the status. Once provisioned the
+// queue keeps its etcd, so running jobs never switch rendezvous. The etcd is removed when
+// provisioning is disabled or the queue uses another backend.
+func (r *TorchrunQueueReconciler) reconcileEtcd(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	distributed := jobQueue.Spec.Distributed
+	if !distributed.ProvisionEtcd || distributed.RdzvBackend != "etcd-v2" {
+		jobQueue.Status.RdzvEndpoint = ""
+		r.removeCondition(jobQueue, "RendezvousReady")
+		return r.deleteEtcd(ctx, jobQueue)
+	}
+
+	if jobQueue.Status.RdzvEndpoint == "" && isEndpointReachable(distributed.RdzvEndpoint) {
+		r.addCondition(jobQueue, "RendezvousReady", "True", "EndpointReachable",
+			fmt.Sprintf("Rendezvous endpoint %s is reachable", distributed.RdzvEndpoint))
+		return nil
+	}
+
+	if err := r.createOrUpdateEtcdService(ctx, jobQueue); err != nil {
+		return err
+	}
+	statefulSet, err := r.createOrUpdateEtcdStatefulSet(ctx, jobQueue)
+	if err != nil {
+		return err
+	}
+	jobQueue.Status.RdzvEndpoint = fmt.Sprintf("%s.%s.svc:%d", etcdName(jobQueue), jobQueue.Namespace, etcdClientPort)
+	if statefulSet.Status.ReadyReplicas > 0 {
+		r.addCondition(jobQueue, "RendezvousReady", "True", "EtcdProvisioned",
+			fmt.Sprintf("Jobs rendezvous on the provisioned etcd %s", jobQueue.Status.RdzvEndpoint))
+	} else {
+		r.addCondition(jobQueue, "RendezvousReady", "False", "EtcdStarting",
+			fmt.Sprintf("Rendezvous endpoint %s is not reachable, waiting for the provisioned etcd", distributed.RdzvEndpoint))
+	}
+	return nil
+}
+
+// isEndpointReachable returns true if a TCP connection to the endpoint succeeds
+func isEndpointReachable(endpoint string) bool {
+	if endpoint == "" {
+		return false
+	}
+	conn, err := net.DialTimeout("tcp", endpoint, etcdDialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// etcdName returns the name of the etcd StatefulSet and Service of the queue
+func etcdName(jobQueue *torchrunv1alpha1.TorchrunQueue) string {
+	return fmt.Sprintf("%s-etcd", jobQueue.Name)
+}
+
+// etcdLabels returns the labels of the etcd resources
+func etcdLabels(jobQueue *torchrunv1alpha1.TorchrunQueue) map[string]string {
+	return map[string]string{
+		"torchrun.ai/managed-by": "torchrunqueue-controller",
+		"torchrun.ai/queue":      jobQueue.Name,
+		"torchrun.ai/role":       "etcd",
+	}
+}
+
+// createOrUpdateEtcdStatefulSet creates or updates the single member etcd of the queue.
+// Rendezvous state only lives as long as the jobs, so the data directory is an emptyDir.
+func (r *TorchrunQueueReconciler) createOrUpdateEtcdStatefulSet(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) (*appsv1.StatefulSet, error) {
+	image := jobQueue.Spec.Distributed.EtcdImage
+	if image == "" {
+		image = "quay.io/coreos/etcd:v3.5.12"
+	}
+
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      etcdName(jobQueue),
+			Namespace: jobQueue.Namespace,
+		},
+	}
+
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, statefulSet, func() error {
+		labels := etcdLabels(jobQueue)
+		replicas := int32(1)
+
+		statefulSet.Labels = labels
+		statefulSet.Spec.Replicas = &replicas
+		statefulSet.Spec.ServiceName = etcdName(jobQueue)
+		statefulSet.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+		statefulSet.Spec.Template = corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: labels},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:    "etcd",
+						Image:   image,
+						Command: []string{"etcd"},
+						Args: []string{
+							"--name=etcd",
+							"--data-dir=/var/run/etcd",
+							fmt.Sprintf("--listen-client-urls=http://0.0.0.0:%d", etcdClientPort),
+							fmt.Sprintf("--advertise-client-urls=http://%s.%s.svc:%d", etcdName(jobQueue), jobQueue.Namespace, etcdClientPort),
+							// torchrun's etcd-v2 rendezvous speaks the v2 API
+							"--enable-v2=true",
+						},
+						Ports: []corev1.ContainerPort{
+							{Name: "client", ContainerPort: etcdClientPort},
+						},
+						ReadinessProbe: &corev1.Probe{
+							ProbeHandler: corev1.ProbeHandler{
+								HTTPGet: &corev1.HTTPGetAction{Path: "/health", Port: intstr.FromString("client")},
+							},
+						},
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "data", MountPath: "/var/run/etcd"},
+						},
+					},
+				},
+				Volumes: []corev1.Volume{
+					{
+						Name:         "data",
+						VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+					},
+				},
+			},
+		}
+		return controllerutil.SetControllerReference(jobQueue, statefulSet, r.Scheme)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile etcd statefulset: %w", err)
+	}
+	if op != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info("Reconciled etcd statefulset", "name", statefulSet.Name, "operation", op)
+	}
+	return statefulSet, nil
+}
+
+// createOrUpdateEtcdService creates or updates the etcd Service
+func (r *TorchrunQueueReconciler) createOrUpdateEtcdService(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      etcdName(jobQueue),
+			Namespace: jobQueue.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, service, func() error {
+		service.Labels = etcdLabels(jobQueue)
+		service.Spec.Selector = etcdLabels(jobQueue)
+		service.Spec.Ports = []corev1.ServicePort{
+			{
+				Name:       "client",
+				Port:       etcdClientPort,
+				TargetPort: intstr.FromString("client"),
+			},
+		}
+		return controllerutil.SetControllerReference(jobQueue, service, r.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reconcile etcd service: %w", err)
+	}
+	return nil
+}
+
+// deleteEtcd removes the etcd StatefulSet and Service of a queue
+func (r *TorchrunQueueReconciler) deleteEtcd(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	objects := []client.Object{
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: etcdName(jobQueue), Namespace: jobQueue.Namespace}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: etcdName(jobQueue), Namespace: jobQueue.Namespace}},
+	}
+	for _, obj := range objects {
+		// Check the cache first so queues without etcd do not cost a DELETE on every reconcile
+		if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		log.FromContext(ctx).Info("Deleting etcd resource", "name", obj.GetName())
+		if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
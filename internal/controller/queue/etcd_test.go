@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestReconcileEtcd(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	// A listening endpoint stands in for a reachable etcd, a closed one for a missing etcd
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	unreachable := closed.Addr().String()
+	closed.Close()
+
+	provisioned := "research-etcd.default.svc:2379"
+	meta := metav1.ObjectMeta{Name: "research-etcd", Namespace: "default"}
+
+	tests := []struct {
+		description     string
+		distributed     torchrunv1alpha1.DistributedConfig
+		rdzvEndpoint    string
+		existing        bool
+		expectEtcd      bool
+		expectEndpoint  string
+		expectCondition string
+	}{
+		{
+			description: "c10d queue gets no etcd",
+			distributed: torchrunv1alpha1.DistributedConfig{RdzvBackend: "c10d", RdzvEndpoint: unreachable, ProvisionEtcd: true},
+		},
+		{
+			description: "etcd is not provisioned unless enabled",
+			distributed: torchrunv1alpha1.DistributedConfig{RdzvBackend: "etcd-v2", RdzvEndpoint: unreachable},
+		},
+		{
+			description:     "reachable endpoint is used as is",
+			distributed:     torchrunv1alpha1.DistributedConfig{RdzvBackend: "etcd-v2", RdzvEndpoint: listener.Addr().String(), ProvisionEtcd: true},
+			expectCondition: "EndpointReachable",
+		},
+		{
+			description:     "unreachable endpoint gets an etcd",
+			distributed:     torchrunv1alpha1.DistributedConfig{RdzvBackend: "etcd-v2", RdzvEndpoint: unreachable, ProvisionEtcd: true},
+			expectEtcd:      true,
+			expectEndpoint:  provisioned,
+			expectCondition: "EtcdStarting",
+		},
+		{
+			description:     "provisioned etcd is kept once the endpoint is reachable",
+			distributed:     torchrunv1alpha1.DistributedConfig{RdzvBackend: "etcd-v2", RdzvEndpoint: listener.Addr().String(), ProvisionEtcd: true},
+			rdzvEndpoint:    provisioned,
+			existing:        true,
+			expectEtcd:      true,
+			expectEndpoint:  provisioned,
+			expectCondition: "EtcdStarting",
+		},
+		{
+			description:  "disabled provisioning removes the etcd",
+			distributed:  torchrunv1alpha1.DistributedConfig{RdzvBackend: "etcd-v2", RdzvEndpoint: unreachable},
+			rdzvEndpoint: provisioned,
+			existing:     true,
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default", UID: "research-uid"},
+			Spec:       torchrunv1alpha1.JobQueueSpec{Distributed: test.distributed},
+			Status:     torchrunv1alpha1.JobQueueStatus{RdzvEndpoint: test.rdzvEndpoint},
+		}
+		builder := fake.NewClientBuilder().WithScheme(scheme)
+		if test.existing {
+			builder = builder.WithObjects(&appsv1.StatefulSet{ObjectMeta: *meta.DeepCopy()}, &corev1.Service{ObjectMeta: *meta.DeepCopy()})
+		}
+		c := builder.Build()
+		r := &TorchrunQueueReconciler{Client: c, APIReader: c, Scheme: scheme}
+
+		if err := r.reconcileEtcd(context.Background(), jq); err != nil {
+			t.Fatalf("%s: reconcileEtcd() error = %v", test.description, err)
+		}
+		if jq.Status.RdzvEndpoint != test.expectEndpoint {
+			t.Errorf("%s: expected endpoint %q, got %q", test.description, test.expectEndpoint, jq.Status.RdzvEndpoint)
+		}
+
+		condition := ""
+		for _, c := range jq.Status.Conditions {
+			if c.Type == "RendezvousReady" {
+				condition = c.Reason
+			}
+		}
+		if condition != test.expectCondition {
+			t.Errorf("%s: expected RendezvousReady reason %q, got %q", test.description, test.expectCondition, condition)
+		}
+
+		for _, obj := range []client.Object{&appsv1.StatefulSet{}, &corev1.Service{}} {
+			err := c.Get(context.Background(), client.ObjectKey{Name: "research-etcd", Namespace: "default"}, obj)
+			if test.expectEtcd && err != nil {
+				t.Errorf("%s: expected etcd %T, got %v", test.description, obj, err)
+			} else if !test.expectEtcd && !errors.IsNotFound(err) {
+				t.Errorf("%s: expected no etcd %T, got %v", test.description, obj, err)
+			}
+		}
+		if test.expectEtcd {
+			statefulSet := &appsv1.StatefulSet{}
+			if err := c.Get(context.Background(), client.ObjectKey{Name: "research-etcd", Namespace: "default"}, statefulSet); err == nil {
+				args := statefulSet.Spec.Template.Spec.Containers[0].Args
+				if args[len(args)-1] != "--enable-v2=true" {
+					t.Errorf("%s: expected the v2 API enabled, got %v", test.description, args)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+// getResourceName returns the name of a queue resource, prefixed with the queue name in prefix mode
+func getResourceName(jobQueue *torchrunv1alpha1.TorchrunQueue, resourceTemplate *torchrunv1alpha1.ResourceTemplate) string {
+	if resourceTemplate.NameMode == "prefix" {
+		return fmt.Sprintf("%s-%s", jobQueue.Name, resourceTemplate.Name)
+	}
+	return resourceTemplate.Name
+}
+
+// getResourceGVK returns the kind of a queue resource
+func getResourceGVK(obj *unstructured.Unstructured) schema.GroupVersionKind {
+	gvk := obj.GroupVersionKind()
+	// Templates without an apiVersion were always looked up as core/v1 kinds
+	if gvk.Group == "" && gvk.Version == "" {
+		gvk.Version = "v1"
+	}
+	return gvk
+}
+
+// validateResources checks that the kind of every queue resource is allowed by the operator
+// config, as the controller is granted permissions on the allowed kinds only
+func validateResources(jobQueue *torchrunv1alpha1.TorchrunQueue, templates *config.ResourceTemplates) error {
+	for i := range jobQueue.Spec.Resources {
+		resourceTemplate := &jobQueue.Spec.Resources[i]
+		obj, err := buildResourceObject(jobQueue, resourceTemplate)
+		if err != nil {
+			return err
+		}
+		gvk := getResourceGVK(obj)
+		if !templates.Allows(gvk) {
+			return fmt.Errorf("resource template %s has kind %s of %s, which resourceTemplates.allowedKinds of the operator config does not allow",
+				resourceTemplate.Name, gvk.Kind, gvk.GroupVersion())
+		}
+	}
+	return nil
+}
+
+// resourceTemplateData is what the Go templates of templated queue resources render
+type resourceTemplateData struct {
+	// Queue is the TorchrunQueue, e.g. {{ .Queue.Name }} or {{ .Queue.Spec.Queue.Name }}
+	Queue *torchrunv1alpha1.TorchrunQueue
+	// Namespace of the queue and the resource
+	Namespace string
+	// Name of the resource, with the queue prefix in prefix mode
+	Name string
+	// Values of the resource template
+	Values map[string]string
+}
+
+// buildResourceObject decodes the template of a queue resource and renders the string values of
+// templated ones
+func buildResourceObject(jobQueue *torchrunv1alpha1.TorchrunQueue, resourceTemplate *torchrunv1alpha1.ResourceTemplate) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal(resourceTemplate.Template.Raw, obj); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal resource template %s: %w", resourceTemplate.Name, err)
+	}
+	if !resourceTemplate.Templated {
+		return obj, nil
+	}
+
+	data := resourceTemplateData{
+		Queue:     jobQueue,
+		Namespace: jobQueue.Namespace,
+		Name:      getResourceName(jobQueue, resourceTemplate),
+		Values:    resourceTemplate.Values,
+	}
+	rendered, err := renderTemplateValues(obj.Object, &data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render resource template %s: %w", resourceTemplate.Name, err)
+	}
+	obj.Object = rendered.(map[string]interface{})
+	return obj, nil
+}
+
+// renderTemplateValues renders the strings of a decoded JSON value as Go templates. Rendering
+// the strings rather than the JSON document keeps rendered values from breaking its structure.
+func renderTemplateValues(value interface{}, data *resourceTemplateData) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		if !strings.Contains(value, "{{") {
+			return value, nil
+		}
+		// Undefined values fail the template instead of rendering as <no value>
+		tmpl, err := template.New("resource").Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		var rendered strings.Builder
+		if err := tmpl.Execute(&rendered, data); err != nil {
+			return nil, err
+		}
+		return rendered.String(), nil
+	case map[string]interface{}:
+		for key, item := range value {
+			rendered, err := renderTemplateValues(item, data)
+			if err != nil {
+				return nil, err
+			}
+			value[key] = rendered
+		}
+		return value, nil
+	case []interface{}:
+		for i, item := range value {
+			rendered, err := renderTemplateValues(item, data)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = rendered
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
+// getResourceStatus looks up a queue resource by the apiVersion and kind of its template and
+// checks its readiness
+func (r *TorchrunQueueReconciler) getResourceStatus(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue, resourceTemplate *torchrunv1alpha1.ResourceTemplate) torchrunv1alpha1.ResourceStatus {
+	status := torchrunv1alpha1.ResourceStatus{Name: getResourceName(jobQueue, resourceTemplate)}
+
+	template, err := buildResourceObject(jobQueue, resourceTemplate)
+	if err != nil {
+		status.Message = fmt.Sprintf("Invalid resource template: %v", err)
+		return status
+	}
+	gvk := getResourceGVK(template)
+	status.APIVersion = gvk.GroupVersion().String()
+	status.Kind = gvk.Kind
+
+	resourceObj := &unstructured.Unstructured{}
+	resourceObj.SetGroupVersionKind(gvk)
+	if err := r.Get(ctx, client.ObjectKey{Name: status.Name, Namespace: jobQueue.Namespace}, resourceObj); err != nil {
+		if errors.IsNotFound(err) {
+			status.Message = "Resource not found"
+		} else if meta.IsNoMatchError(err) {
+			status.Message = fmt.Sprintf("Kind %s is not installed in the cluster", status.Kind)
+		} else {
+			status.Message = fmt.Sprintf("Failed to get resource: %v", err)
+		}
+		return status
+	}
+
+	if resourceTemplate.Readiness != nil {
+		ready, value, err := checkReadiness(resourceObj, resourceTemplate.Readiness)
+		if err != nil {
+			status.Message = fmt.Sprintf("Failed to check readiness: %v", err)
+			return status
+		}
+		if !ready {
+			status.Message = fmt.Sprintf("Resource is not ready: %s is %q", resourceTemplate.Readiness.JSONPath, value)
+			return status
+		}
+	}
+
+	status.Ready = true
+	status.Message = "Resource is ready"
+	return status
+}
+
+// checkReadiness evaluates the readiness JSONPath on the resource and returns whether it is
+// ready and the value the path yielded
+func checkReadiness(obj *unstructured.Unstructured, readiness *torchrunv1alpha1.ResourceReadiness) (bool, string, error) {
+	expression := readiness.JSONPath
+	// Accept bare paths such as .status.phase like kubectl does
+	if !strings.HasPrefix(expression, "{") {
+		expression = "{" + expression + "}"
+	}
+
+	path := jsonpath.New("readiness").AllowMissingKeys(true)
+	if err := path.Parse(expression); err != nil {
+		return false, "", err
+	}
+	var out bytes.Buffer
+	if err := path.Execute(&out, obj.Object); err != nil {
+		return false, "", err
+	}
+
+	value := strings.TrimSpace(out.String())
+	if readiness.Value == "" {
+		return value != "", value, nil
+	}
+	return value == readiness.Value, value, nil
+}
@@ -0,0 +1,269 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+// externalSecretGVK is a CRD kind, registered as unstructured in the test scheme
+var externalSecretGVK = schema.GroupVersionKind{Group: "external-secrets.io", Version: "v1beta1", Kind: "ExternalSecret"}
+
+func TestGetResourceStatus(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	scheme.AddKnownTypeWithName(externalSecretGVK, &unstructured.Unstructured{})
+
+	externalSecret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "False"},
+			},
+			"refreshTime": "2024-01-01T00:00:00Z",
+		},
+	}}
+	externalSecret.SetGroupVersionKind(externalSecretGVK)
+	externalSecret.SetName("research-credentials")
+	externalSecret.SetNamespace("default")
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"}}
+
+	jq := &torchrunv1alpha1.TorchrunQueue{ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(externalSecret, configMap).Build()
+	r := &TorchrunQueueReconciler{Client: c, APIReader: c, Scheme: scheme}
+
+	externalSecretTemplate := `{"apiVersion":"external-secrets.io/v1beta1","kind":"ExternalSecret"}`
+	tests := []struct {
+		description      string
+		resource         torchrunv1alpha1.ResourceTemplate
+		expectAPIVersion string
+		expectReady      bool
+		expectMessage    string
+	}{
+		{
+			description:      "core resource without apiVersion",
+			resource:         torchrunv1alpha1.ResourceTemplate{Name: "settings", Template: runtime.RawExtension{Raw: []byte(`{"kind":"ConfigMap"}`)}},
+			expectAPIVersion: "v1",
+			expectReady:      true,
+			expectMessage:    "Resource is ready",
+		},
+		{
+			description:      "CRD resource is looked up by its apiVersion",
+			resource:         torchrunv1alpha1.ResourceTemplate{Name: "credentials", NameMode: "prefix", Template: runtime.RawExtension{Raw: []byte(externalSecretTemplate)}},
+			expectAPIVersion: "external-secrets.io/v1beta1",
+			expectReady:      true,
+			expectMessage:    "Resource is ready",
+		},
+		{
+			description: "readiness value must match",
+			resource: torchrunv1alpha1.ResourceTemplate{
+				Name:      "credentials",
+				NameMode:  "prefix",
+				Template:  runtime.RawExtension{Raw: []byte(externalSecretTemplate)},
+				Readiness: &torchrunv1alpha1.ResourceReadiness{JSONPath: `{.status.conditions[?(@.type=="Ready")].status}`, Value: "True"},
+			},
+			expectAPIVersion: "external-secrets.io/v1beta1",
+			expectMessage:    `Resource is not ready: {.status.conditions[?(@.type=="Ready")].status} is "False"`,
+		},
+		{
+			description: "bare readiness path without value needs a result",
+			resource: torchrunv1alpha1.ResourceTemplate{
+				Name:      "credentials",
+				NameMode:  "prefix",
+				Template:  runtime.RawExtension{Raw: []byte(externalSecretTemplate)},
+				Readiness: &torchrunv1alpha1.ResourceReadiness{JSONPath: ".status.refreshTime"},
+			},
+			expectAPIVersion: "external-secrets.io/v1beta1",
+			expectReady:      true,
+			expectMessage:    "Resource is ready",
+		},
+		{
+			description: "missing readiness field is not ready",
+			resource: torchrunv1alpha1.ResourceTemplate{
+				Name:      "credentials",
+				NameMode:  "prefix",
+				Template:  runtime.RawExtension{Raw: []byte(externalSecretTemplate)},
+				Readiness: &torchrunv1alpha1.ResourceReadiness{JSONPath: "{.status.binding.name}"},
+			},
+			expectAPIVersion: "external-secrets.io/v1beta1",
+			expectMessage:    `Resource is not ready: {.status.binding.name} is ""`,
+		},
+		{
+			description:      "missing resource is not found",
+			resource:         torchrunv1alpha1.ResourceTemplate{Name: "credentials", Template: runtime.RawExtension{Raw: []byte(externalSecretTemplate)}},
+			expectAPIVersion: "external-secrets.io/v1beta1",
+			expectMessage:    "Resource not found",
+		},
+	}
+
+	for _, test := range tests {
+		status := r.getResourceStatus(context.Background(), jq, &test.resource)
+		if status.APIVersion != test.expectAPIVersion || status.Ready != test.expectReady || !strings.HasPrefix(status.Message, test.expectMessage) {
+			t.Errorf("%s: expected %s ready=%v %q, got %s ready=%v %q", test.description,
+				test.expectAPIVersion, test.expectReady, test.expectMessage, status.APIVersion, status.Ready, status.Message)
+		}
+	}
+}
+
+func TestBuildResourceObject(t *testing.T) {
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "ml"},
+		Spec:       torchrunv1alpha1.JobQueueSpec{Queue: torchrunv1alpha1.QueueConfig{Name: "research-gpu"}},
+	}
+	pvcTemplate := `{"apiVersion":"v1","kind":"PersistentVolumeClaim","metadata":{"labels":{"team":"{{ .Queue.Spec.Queue.Name }}"}},` +
+		`"spec":{"accessModes":["ReadWriteMany"],"resources":{"requests":{"storage":"{{ .Values.size }}"}},"volumeName":"{{ .Namespace }}-{{ .Name }}"}}`
+
+	tests := []struct {
+		description string
+		resource    torchrunv1alpha1.ResourceTemplate
+		expectError bool
+		expectPaths map[string][]string
+	}{
+		{
+			description: "templated resource renders queue, namespace, name and values",
+			resource: torchrunv1alpha1.ResourceTemplate{
+				Name:      "data",
+				NameMode:  "prefix",
+				Template:  runtime.RawExtension{Raw: []byte(pvcTemplate)},
+				Templated: true,
+				Values:    map[string]string{"size": "500Gi"},
+			},
+			expectPaths: map[string][]string{
+				"research-gpu":     {"metadata", "labels", "team"},
+				"500Gi":            {"spec", "resources", "requests", "storage"},
+				"ml-research-data": {"spec", "volumeName"},
+			},
+		},
+		{
+			description: "resource that is not templated is applied as written",
+			resource: torchrunv1alpha1.ResourceTemplate{
+				Name:     "data",
+				Template: runtime.RawExtension{Raw: []byte(pvcTemplate)},
+			},
+			expectPaths: map[string][]string{
+				"{{ .Values.size }}": {"spec", "resources", "requests", "storage"},
+			},
+		},
+		{
+			description: "undefined value fails the template",
+			resource: torchrunv1alpha1.ResourceTemplate{
+				Name:      "data",
+				Template:  runtime.RawExtension{Raw: []byte(pvcTemplate)},
+				Templated: true,
+			},
+			expectError: true,
+		},
+		{
+			description: "rendered values cannot break the structure of the template",
+			resource: torchrunv1alpha1.ResourceTemplate{
+				Name:      "settings",
+				Template:  runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"ConfigMap","data":{"owner":"{{ .Values.owner }}"}}`)},
+				Templated: true,
+				Values:    map[string]string{"owner": `alice", "injected": "true`},
+			},
+			expectPaths: map[string][]string{
+				`alice", "injected": "true`: {"data", "owner"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		obj, err := buildResourceObject(jq, &test.resource)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.description)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: buildResourceObject() error = %v", test.description, err)
+		}
+		for expected, path := range test.expectPaths {
+			if value, _, _ := unstructured.NestedString(obj.Object, path...); value != expected {
+				t.Errorf("%s: expected %s to be %q, got %q", test.description, strings.Join(path, "."), expected, value)
+			}
+		}
+	}
+}
+
+func TestValidateResources(t *testing.T) {
+	allowed := &config.ResourceTemplates{AllowedKinds: []config.ResourceKind{
+		{Kind: "ConfigMap", Resource: "configmaps"},
+		{Group: "external-secrets.io", Kind: "ExternalSecret", Resource: "externalsecrets"},
+	}}
+	resource := func(template string, templated bool) torchrunv1alpha1.ResourceTemplate {
+		return torchrunv1alpha1.ResourceTemplate{
+			Name:      "settings",
+			Template:  runtime.RawExtension{Raw: []byte(template)},
+			Templated: templated,
+			Values:    map[string]string{"group": "external-secrets.io"},
+		}
+	}
+
+	tests := []struct {
+		description string
+		templates   *config.ResourceTemplates
+		resource    torchrunv1alpha1.ResourceTemplate
+		expectError string
+	}{
+		{
+			description: "any kind without allowed kinds",
+			templates:   &config.ResourceTemplates{},
+			resource:    resource(`{"apiVersion":"apps/v1","kind":"Deployment"}`, false),
+		},
+		{
+			description: "allowed core kind without apiVersion",
+			templates:   allowed,
+			resource:    resource(`{"kind":"ConfigMap"}`, false),
+		},
+		{
+			description: "allowed kind of a templated apiVersion",
+			templates:   allowed,
+			resource:    resource(`{"apiVersion":"{{ .Values.group }}/v1beta1","kind":"ExternalSecret"}`, true),
+		},
+		{
+			description: "kind that is not allowed",
+			templates:   allowed,
+			resource:    resource(`{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"RoleBinding"}`, false),
+			expectError: "kind RoleBinding of rbac.authorization.k8s.io/v1",
+		},
+		{
+			description: "template without kind",
+			templates:   &config.ResourceTemplates{},
+			resource:    resource(`{"apiVersion":"v1"}`, false),
+			expectError: "'Kind' is missing",
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"},
+			Spec:       torchrunv1alpha1.JobQueueSpec{Resources: []torchrunv1alpha1.ResourceTemplate{test.resource}},
+		}
+		err := validateResources(jq, test.templates)
+		if test.expectError == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.description, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.expectError) {
+			t.Errorf("%s: expected error %q, got %v", test.description, test.expectError, err)
+		}
+	}
+}
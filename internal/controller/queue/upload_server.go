@@ -0,0 +1,263 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/upload"
+)
+
+// reconcileUploadServer creates or updates the upload server of the queue, or removes it when disabled
+func (r *TorchrunQueueReconciler) reconcileUploadServer(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	if !jobQueue.Spec.UploadServer.Enabled {
+		return r.deleteUploadServer(ctx, jobQueue)
+	}
+
+	if err := r.createUploadSecret(ctx, jobQueue); err != nil {
+		return err
+	}
+	if err := r.createUploadStorage(ctx, jobQueue); err != nil {
+		return err
+	}
+	if err := r.createOrUpdateUploadDeployment(ctx, jobQueue); err != nil {
+		return err
+	}
+	return r.createOrUpdateUploadService(ctx, jobQueue)
+}
+
+// uploadServerLabels returns the labels of the upload server resources
+func uploadServerLabels(jobQueue *torchrunv1alpha1.TorchrunQueue) map[string]string {
+	return map[string]string{
+		"torchrun.ai/managed-by": "torchrunqueue-controller",
+		"torchrun.ai/queue":      jobQueue.Name,
+		"torchrun.ai/role":       "upload-server",
+	}
+}
+
+// createUploadSecret creates the Secret holding the signing key for presigned URLs.
+// The key is generated once and never rotated by the controller.
+func (r *TorchrunQueueReconciler) createUploadSecret(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	existing := &corev1.Secret{}
+	err := r.APIReader.Get(ctx, client.ObjectKey{Name: upload.SecretName(jobQueue.Name), Namespace: jobQueue.Namespace}, existing)
+	if err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      upload.SecretName(jobQueue.Name),
+			Namespace: jobQueue.Namespace,
+			Labels:    uploadServerLabels(jobQueue),
+		},
+		StringData: map[string]string{
+			upload.SigningKeySecretKey: hex.EncodeToString(key),
+		},
+	}
+	if err := controllerutil.SetControllerReference(jobQueue, secret, r.Scheme); err != nil {
+		return err
+	}
+
+	log.FromContext(ctx).Info("Creating upload server signing key", "name", secret.Name)
+	// A key created by a previous leader the cache has not seen yet is kept
+	if err := r.Create(ctx, secret); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// createUploadStorage creates the staging PVC of the upload server
+func (r *TorchrunQueueReconciler) createUploadStorage(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	existing := &corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, client.ObjectKey{Name: upload.StorageName(jobQueue.Name), Namespace: jobQueue.Namespace}, existing)
+	if err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	size := jobQueue.Spec.UploadServer.StorageSize
+	if size == "" {
+		size = "10Gi"
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return fmt.Errorf("invalid upload server storage size %q: %w", size, err)
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      upload.StorageName(jobQueue.Name),
+			Namespace: jobQueue.Namespace,
+			Labels:    uploadServerLabels(jobQueue),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: quantity,
+				},
+			},
+		},
+	}
+	if jobQueue.Spec.UploadServer.StorageClass != "" {
+		pvc.Spec.StorageClassName = &jobQueue.Spec.UploadServer.StorageClass
+	}
+	if err := controllerutil.SetControllerReference(jobQueue, pvc, r.Scheme); err != nil {
+		return err
+	}
+
+	log.FromContext(ctx).Info("Creating upload server storage", "name", pvc.Name)
+	if err := r.Create(ctx, pvc); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// createOrUpdateUploadDeployment creates or updates the upload server Deployment
+func (r *TorchrunQueueReconciler) createOrUpdateUploadDeployment(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	image := jobQueue.Spec.UploadServer.Image
+	if image == "" {
+		image = "dream3dml/torchrun-controller:latest"
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      upload.ServerName(jobQueue.Name),
+			Namespace: jobQueue.Namespace,
+		},
+	}
+
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, deployment, func() error {
+		labels := uploadServerLabels(jobQueue)
+		replicas := int32(1)
+
+		deployment.Labels = labels
+		deployment.Spec.Replicas = &replicas
+		deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+		// The staging volume is ReadWriteOnce, so never run two servers at once
+		deployment.Spec.Strategy = appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+		deployment.Spec.Template = corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: labels},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:    "upload-server",
+						Image:   image,
+						Command: []string{"/upload-server"},
+						Args:    []string{"--data-dir=/data", fmt.Sprintf("--bind-address=:%d", upload.Port)},
+						Env: []corev1.EnvVar{
+							{
+								Name: "UPLOAD_SIGNING_KEY",
+								ValueFrom: &corev1.EnvVarSource{
+									SecretKeyRef: &corev1.SecretKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{Name: upload.SecretName(jobQueue.Name)},
+										Key:                  upload.SigningKeySecretKey,
+									},
+								},
+							},
+						},
+						Ports: []corev1.ContainerPort{
+							{Name: "http", ContainerPort: upload.Port},
+						},
+						ReadinessProbe: &corev1.Probe{
+							ProbeHandler: corev1.ProbeHandler{
+								HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromString("http")},
+							},
+						},
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "data", MountPath: "/data"},
+						},
+					},
+				},
+				Volumes: []corev1.Volume{
+					{
+						Name: "data",
+						VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+								ClaimName: upload.StorageName(jobQueue.Name),
+							},
+						},
+					},
+				},
+			},
+		}
+		return controllerutil.SetControllerReference(jobQueue, deployment, r.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reconcile upload server deployment: %w", err)
+	}
+	if op != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info("Reconciled upload server deployment", "name", deployment.Name, "operation", op)
+	}
+	return nil
+}
+
+// createOrUpdateUploadService creates or updates the upload server Service
+func (r *TorchrunQueueReconciler) createOrUpdateUploadService(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      upload.ServerName(jobQueue.Name),
+			Namespace: jobQueue.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, service, func() error {
+		service.Labels = uploadServerLabels(jobQueue)
+		service.Spec.Selector = uploadServerLabels(jobQueue)
+		service.Spec.Ports = []corev1.ServicePort{
+			{
+				Name:       "http",
+				Port:       80,
+				TargetPort: intstr.FromString("http"),
+			},
+		}
+		return controllerutil.SetControllerReference(jobQueue, service, r.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reconcile upload server service: %w", err)
+	}
+	return nil
+}
+
+// deleteUploadServer removes the upload server Deployment and Service of a queue.
+// The signing key and staging volume are kept so outstanding URLs survive a restart.
+func (r *TorchrunQueueReconciler) deleteUploadServer(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	objects := []client.Object{
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: upload.ServerName(jobQueue.Name), Namespace: jobQueue.Namespace}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: upload.ServerName(jobQueue.Name), Namespace: jobQueue.Namespace}},
+	}
+	for _, obj := range objects {
+		// Check the cache first so a disabled upload server does not cost a DELETE on every reconcile
+		if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		log.FromContext(ctx).Info("Deleting upload server resource", "name", obj.GetName())
+		if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
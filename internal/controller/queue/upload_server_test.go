@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/upload"
+)
+
+func TestReconcileUploadServer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	jq := &torchrunv1alpha1.TorchrunQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "default", UID: "dev-uid"},
+		Spec: torchrunv1alpha1.JobQueueSpec{
+			UploadServer: torchrunv1alpha1.UploadServerConfig{
+				Enabled:     true,
+				Image:       "dream3dml/torchrun-controller:test",
+				StorageSize: "5Gi",
+			},
+		},
+	}
+
+	deletes := 0
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(jq).WithInterceptorFuncs(interceptor.Funcs{
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			deletes++
+			return c.Delete(ctx, obj, opts...)
+		},
+	}).Build()
+	r := &TorchrunQueueReconciler{Client: c, APIReader: c, Scheme: scheme}
+	ctx := context.Background()
+	key := client.ObjectKey{Name: upload.ServerName(jq.Name), Namespace: jq.Namespace}
+
+	// Enabling the upload server creates all of its resources
+	if err := r.reconcileUploadServer(ctx, jq); err != nil {
+		t.Fatalf("reconcileUploadServer() error = %v", err)
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Name: upload.SecretName(jq.Name), Namespace: jq.Namespace}, secret); err != nil {
+		t.Fatalf("expected signing key secret: %v", err)
+	}
+	if len(secret.StringData[upload.SigningKeySecretKey])+len(secret.Data[upload.SigningKeySecretKey]) == 0 {
+		t.Errorf("expected signing key in secret")
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := c.Get(ctx, client.ObjectKey{Name: upload.StorageName(jq.Name), Namespace: jq.Namespace}, pvc); err != nil {
+		t.Fatalf("expected staging PVC: %v", err)
+	}
+	if got := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; got.String() != "5Gi" {
+		t.Errorf("expected staging PVC size 5Gi, got %s", got.String())
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := c.Get(ctx, key, deployment); err != nil {
+		t.Fatalf("expected upload server deployment: %v", err)
+	}
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != jq.Spec.UploadServer.Image {
+		t.Errorf("expected image %s, got %s", jq.Spec.UploadServer.Image, image)
+	}
+	if len(deployment.OwnerReferences) != 1 || deployment.OwnerReferences[0].UID != jq.UID {
+		t.Errorf("expected deployment to be owned by the queue, got %v", deployment.OwnerReferences)
+	}
+
+	if err := c.Get(ctx, key, &corev1.Service{}); err != nil {
+		t.Fatalf("expected upload server service: %v", err)
+	}
+
+	// Reconciling again keeps the signing key and updates the image
+	jq.Spec.UploadServer.Image = "dream3dml/torchrun-controller:v2"
+	if err := r.reconcileUploadServer(ctx, jq); err != nil {
+		t.Fatalf("reconcileUploadServer() error = %v", err)
+	}
+	rereadSecret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(secret), rereadSecret); err != nil {
+		t.Fatalf("expected signing key secret: %v", err)
+	}
+	if rereadSecret.ResourceVersion != secret.ResourceVersion {
+		t.Errorf("expected signing key secret to be left unchanged")
+	}
+	if err := c.Get(ctx, key, deployment); err != nil {
+		t.Fatalf("expected upload server deployment: %v", err)
+	}
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "dream3dml/torchrun-controller:v2" {
+		t.Errorf("expected updated image, got %s", image)
+	}
+
+	// Disabling removes the Deployment and Service but keeps the key and staging volume
+	jq.Spec.UploadServer.Enabled = false
+	if err := r.reconcileUploadServer(ctx, jq); err != nil {
+		t.Fatalf("reconcileUploadServer() error = %v", err)
+	}
+	if err := c.Get(ctx, key, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("expected upload server deployment to be deleted, got %v", err)
+	}
+	if err := c.Get(ctx, key, &corev1.Service{}); !errors.IsNotFound(err) {
+		t.Errorf("expected upload server service to be deleted, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(secret), &corev1.Secret{}); err != nil {
+		t.Errorf("expected signing key secret to be kept: %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(pvc), &corev1.PersistentVolumeClaim{}); err != nil {
+		t.Errorf("expected staging PVC to be kept: %v", err)
+	}
+	if deletes != 2 {
+		t.Errorf("expected 2 deletes, got %d", deletes)
+	}
+
+	// Once removed, a disabled upload server issues no further deletes
+	if err := r.reconcileUploadServer(ctx, jq); err != nil {
+		t.Fatalf("reconcileUploadServer() error = %v", err)
+	}
+	if deletes != 2 {
+		t.Errorf("expected no deletes for an already removed upload server, got %d", deletes-2)
+	}
+}
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// gpuResourceName is the extended resource counted as GPUs
+const gpuResourceName corev1.ResourceName = "nvidia.com/gpu"
+
+// updateUtilization sums the resource requests of the scheduled pods of the queue, counts its
+// TorchrunJobs by phase and sums their GPU time, including those of namespaces bound to the
+// queue. Usage is reported in the units of the kai-scheduler quota: CPU in millicores, memory
+// in megabytes.
+func (r *TorchrunQueueReconciler) updateUtilization(ctx context.Context, jobQueue *torchrunv1alpha1.TorchrunQueue) error {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.MatchingLabels{
+		"torchrun.ai/job-queue": jobQueue.Name,
+	}); err != nil {
+		return fmt.Errorf("failed to list pods of queue %s: %w", jobQueue.Name, err)
+	}
+
+	var cpu, gpu, memory resource.Quantity
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if getPodQueueNamespace(pod) != jobQueue.Namespace {
+			continue
+		}
+		// Pending pods hold no resources until they are bound to a node
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		requests := getPodRequests(pod)
+		cpu.Add(requests[corev1.ResourceCPU])
+		gpu.Add(requests[gpuResourceName])
+		memory.Add(requests[corev1.ResourceMemory])
+	}
+	jobQueue.Status.Usage = &torchrunv1alpha1.QueueUsageStatus{
+		CPU:    int(cpu.MilliValue()),
+		GPU:    int(gpu.Value()),
+		Memory: int(memory.Value() / 1000 / 1000),
+	}
+
+	jobs := &torchrunv1alpha1.TorchrunJobList{}
+	if err := r.List(ctx, jobs); err != nil {
+		return fmt.Errorf("failed to list jobs of queue %s: %w", jobQueue.Name, err)
+	}
+	counts := &torchrunv1alpha1.QueueJobsStatus{}
+	var gpuSeconds int64
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.Spec.Queue != jobQueue.Name || getJobQueueNamespace(job) != jobQueue.Namespace {
+			continue
+		}
+		// Recorded jobs are counted with their record, which outlives them
+		if job.Status.JobRecord == "" {
+			gpuSeconds += job.Status.GPUSeconds
+		}
+		switch job.Status.Phase {
+		case torchrunv1alpha1.PhaseRunning:
+			counts.Running++
+			if job.Status.GPUUtilization != nil && job.Status.GPUUtilization.Low {
+				counts.LowGPUUtilization = append(counts.LowGPUUtilization, job.Namespace+"/"+job.Name)
+			}
+		case torchrunv1alpha1.PhaseQueued:
+			counts.Queued++
+		case torchrunv1alpha1.PhasePending, torchrunv1alpha1.PhaseSyncing, "":
+			counts.Pending++
+		}
+	}
+	sort.Strings(counts.LowGPUUtilization)
+	jobQueue.Status.Jobs = counts
+
+	records := &torchrunv1alpha1.TorchrunJobRecordList{}
+	if err := r.List(ctx, records); err != nil {
+		return fmt.Errorf("failed to list job records of queue %s: %w", jobQueue.Name, err)
+	}
+	for i := range records.Items {
+		record := &records.Items[i]
+		if record.Spec.Queue == jobQueue.Name && getRecordQueueNamespace(record) == jobQueue.Namespace {
+			gpuSeconds += record.Spec.GPUSeconds
+		}
+	}
+	jobQueue.Status.Usage.GPUSeconds = gpuSeconds
+	return nil
+}
+
+// updateOverQuota sets the OverQuota condition while the scheduled pods of the queue request more
+// of a resource than its quota, borrowing the unused resources of other queues through the
+// overQuotaWeight of kai-scheduler. Unlimited quotas (-1) are never exceeded.
+func (r *TorchrunQueueReconciler) updateOverQuota(jobQueue *torchrunv1alpha1.TorchrunQueue) {
+	usage, resources := jobQueue.Status.Usage, jobQueue.Spec.Queue.Resources
+	for _, resource := range []struct {
+		used  int
+		quota int
+	}{
+		{usage.CPU, resources.CPU.Quota},
+		{usage.GPU, resources.GPU.Quota},
+		{usage.Memory, resources.Memory.Quota},
+	} {
+		if resource.quota >= 0 && resource.used > resource.quota {
+			r.addCondition(jobQueue, "OverQuota", "True", "BorrowingResources",
+				"Pods of the queue request more than its quota, see status.usage. Jobs running on borrowed resources are preempted first when other queues reclaim their quota.")
+			return
+		}
+	}
+	r.addCondition(jobQueue, "OverQuota", "False", "WithinQuota", "Pods of the queue request no more than its quota")
+}
+
+// getJobQueueNamespace returns the namespace of the TorchrunQueue of a job
+func getJobQueueNamespace(job *torchrunv1alpha1.TorchrunJob) string {
+	if job.Spec.QueueNamespace != "" {
+		return job.Spec.QueueNamespace
+	}
+	return job.Namespace
+}
+
+// getRecordQueueNamespace returns the namespace of the TorchrunQueue of a job record
+func getRecordQueueNamespace(record *torchrunv1alpha1.TorchrunJobRecord) string {
+	if record.Spec.QueueNamespace != "" {
+		return record.Spec.QueueNamespace
+	}
+	return record.Namespace
+}
+
+// getPodQueueNamespace returns the namespace of the TorchrunQueue of a worker pod. Pods of jobs
+// submitted through a queue binding carry it in a label.
+func getPodQueueNamespace(pod *corev1.Pod) string {
+	if namespace := pod.Labels["torchrun.ai/job-queue-namespace"]; namespace != "" {
+		return namespace
+	}
+	return pod.Namespace
+}
+
+// getPodRequests returns the effective resource requests of a pod: the containers plus the
+// sidecars, or the largest init container if that is more, plus the pod overhead
+func getPodRequests(pod *corev1.Pod) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	add := func(list corev1.ResourceList) {
+		for name, quantity := range list {
+			total := requests[name]
+			total.Add(quantity)
+			requests[name] = total
+		}
+	}
+
+	for _, container := range pod.Spec.Containers {
+		add(container.Resources.Requests)
+	}
+	for _, container := range pod.Spec.InitContainers {
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			add(container.Resources.Requests)
+		}
+	}
+	for _, container := range pod.Spec.InitContainers {
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			continue
+		}
+		for name, quantity := range container.Resources.Requests {
+			if total := requests[name]; quantity.Cmp(total) > 0 {
+				requests[name] = quantity
+			}
+		}
+	}
+	add(pod.Spec.Overhead)
+	return requests
+}
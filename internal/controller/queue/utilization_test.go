@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestUpdateUtilization(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	worker := func(name, queue, node string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"torchrun.ai/job-queue": queue}},
+			Spec: corev1.PodSpec{
+				NodeName: node,
+				Containers: []corev1.Container{{
+					Name: "trainer",
+					Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("8"),
+						corev1.ResourceMemory: resource.MustParse("64G"),
+						gpuResourceName:       resource.MustParse("4"),
+					}},
+				}},
+			},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+	job := func(name, queue, phase string) *torchrunv1alpha1.TorchrunJob {
+		return &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{Queue: queue},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{Phase: phase},
+		}
+	}
+
+	// boundWorker and boundJob belong to a namespace bound to the queue in the default namespace
+	boundWorker := func(name, namespace string) *corev1.Pod {
+		pod := worker(name, "research", "node-a", corev1.PodRunning)
+		pod.Namespace = namespace
+		pod.Labels["torchrun.ai/job-queue-namespace"] = "default"
+		return pod
+	}
+	boundJob := func(name, namespace, phase string) *torchrunv1alpha1.TorchrunJob {
+		job := job(name, "research", phase)
+		job.Namespace = namespace
+		job.Spec.QueueNamespace = "default"
+		return job
+	}
+
+	record := func(name, namespace, queueNamespace string, gpuSeconds int64) *torchrunv1alpha1.TorchrunJobRecord {
+		return &torchrunv1alpha1.TorchrunJobRecord{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       torchrunv1alpha1.TorchrunJobRecordSpec{Queue: "research", QueueNamespace: queueNamespace, GPUSeconds: gpuSeconds},
+		}
+	}
+
+	tests := []struct {
+		description string
+		objects     []client.Object
+		expectUsage torchrunv1alpha1.QueueUsageStatus
+		expectJobs  torchrunv1alpha1.QueueJobsStatus
+	}{
+		{
+			description: "empty queue uses nothing",
+		},
+		{
+			description: "scheduled pods of the queue are summed",
+			objects: []client.Object{
+				worker("train-0", "research", "node-a", corev1.PodRunning),
+				worker("train-1", "research", "node-b", corev1.PodRunning),
+			},
+			expectUsage: torchrunv1alpha1.QueueUsageStatus{CPU: 16000, GPU: 8, Memory: 128000},
+		},
+		{
+			description: "unscheduled, finished and other queue pods are left out",
+			objects: []client.Object{
+				worker("train-0", "research", "node-a", corev1.PodRunning),
+				worker("train-1", "research", "", corev1.PodPending),
+				worker("done-0", "research", "node-a", corev1.PodSucceeded),
+				worker("other-0", "other", "node-b", corev1.PodRunning),
+			},
+			expectUsage: torchrunv1alpha1.QueueUsageStatus{CPU: 8000, GPU: 4, Memory: 64000},
+		},
+		{
+			description: "jobs of the queue are counted by phase",
+			objects: []client.Object{
+				job("running", "research", torchrunv1alpha1.PhaseRunning),
+				job("queued", "research", torchrunv1alpha1.PhaseQueued),
+				job("pending", "research", torchrunv1alpha1.PhasePending),
+				job("syncing", "research", torchrunv1alpha1.PhaseSyncing),
+				job("succeeded", "research", torchrunv1alpha1.PhaseSucceeded),
+				job("other", "other", torchrunv1alpha1.PhaseRunning),
+			},
+			expectJobs: torchrunv1alpha1.QueueJobsStatus{Running: 1, Queued: 1, Pending: 2},
+		},
+		{
+			description: "pods and jobs of bound namespaces are counted, those of same-named queues elsewhere are not",
+			objects: []client.Object{
+				worker("train-0", "research", "node-a", corev1.PodRunning),
+				boundWorker("team-0", "team-vision"),
+				func() client.Object {
+					pod := worker("elsewhere-0", "research", "node-b", corev1.PodRunning)
+					pod.Namespace = "team-nlp"
+					return pod
+				}(),
+				job("running", "research", torchrunv1alpha1.PhaseRunning),
+				boundJob("team", "team-vision", torchrunv1alpha1.PhaseRunning),
+				func() client.Object {
+					job := job("elsewhere", "research", torchrunv1alpha1.PhaseRunning)
+					job.Namespace = "team-nlp"
+					return job
+				}(),
+			},
+			expectUsage: torchrunv1alpha1.QueueUsageStatus{CPU: 16000, GPU: 8, Memory: 128000},
+			expectJobs:  torchrunv1alpha1.QueueJobsStatus{Running: 2},
+		},
+		{
+			description: "GPU time of unrecorded jobs and of job records is summed",
+			objects: []client.Object{
+				func() client.Object {
+					job := job("running", "research", torchrunv1alpha1.PhaseRunning)
+					job.Status.GPUSeconds = 3600
+					return job
+				}(),
+				func() client.Object {
+					job := job("succeeded", "research", torchrunv1alpha1.PhaseSucceeded)
+					job.Status.GPUSeconds = 7200
+					job.Status.JobRecord = "succeeded-0123abcd"
+					return job
+				}(),
+				record("succeeded-0123abcd", "default", "", 7200),
+				record("deleted-4567ef01", "default", "", 1800),
+				record("team-89abcdef", "team-vision", "default", 600),
+				record("elsewhere-01234567", "team-nlp", "", 900),
+			},
+			expectUsage: torchrunv1alpha1.QueueUsageStatus{GPUSeconds: 13200},
+			expectJobs:  torchrunv1alpha1.QueueJobsStatus{Running: 1},
+		},
+		{
+			description: "running jobs with idle GPUs are listed",
+			objects: []client.Object{
+				func() client.Object {
+					job := job("idle", "research", torchrunv1alpha1.PhaseRunning)
+					job.Status.GPUUtilization = &torchrunv1alpha1.GPUUtilizationStatus{GPUs: 8, UtilizationPercent: 3, Low: true}
+					return job
+				}(),
+				func() client.Object {
+					job := job("busy", "research", torchrunv1alpha1.PhaseRunning)
+					job.Status.GPUUtilization = &torchrunv1alpha1.GPUUtilizationStatus{GPUs: 8, UtilizationPercent: 95}
+					return job
+				}(),
+			},
+			expectJobs: torchrunv1alpha1.QueueJobsStatus{Running: 2, LowGPUUtilization: []string{"default/idle"}},
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"}}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(test.objects...).Build()
+		r := &TorchrunQueueReconciler{Client: c, APIReader: c, Scheme: scheme}
+
+		if err := r.updateUtilization(context.Background(), jq); err != nil {
+			t.Fatalf("%s: updateUtilization() error = %v", test.description, err)
+		}
+		if *jq.Status.Usage != test.expectUsage {
+			t.Errorf("%s: expected usage %+v, got %+v", test.description, test.expectUsage, *jq.Status.Usage)
+		}
+		if !reflect.DeepEqual(*jq.Status.Jobs, test.expectJobs) {
+			t.Errorf("%s: expected jobs %+v, got %+v", test.description, test.expectJobs, *jq.Status.Jobs)
+		}
+	}
+}
+
+func TestGetPodRequests(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	requests := func(cpu string) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}}
+	}
+
+	tests := []struct {
+		description string
+		spec        corev1.PodSpec
+		expectCPU   string
+	}{
+		{
+			description: "containers are summed",
+			spec:        corev1.PodSpec{Containers: []corev1.Container{{Resources: requests("2")}, {Resources: requests("500m")}}},
+			expectCPU:   "2500m",
+		},
+		{
+			description: "sidecars run next to the containers",
+			spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Resources: requests("1"), RestartPolicy: &always}},
+				Containers:     []corev1.Container{{Resources: requests("2")}},
+			},
+			expectCPU: "3",
+		},
+		{
+			description: "larger init container counts instead of the containers",
+			spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Resources: requests("4")}},
+				Containers:     []corev1.Container{{Resources: requests("2")}},
+			},
+			expectCPU: "4",
+		},
+		{
+			description: "pod overhead is added",
+			spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Resources: requests("2")}},
+				Overhead:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")},
+			},
+			expectCPU: "2250m",
+		},
+	}
+
+	for _, test := range tests {
+		cpu := getPodRequests(&corev1.Pod{Spec: test.spec})[corev1.ResourceCPU]
+		if cpu.Cmp(resource.MustParse(test.expectCPU)) != 0 {
+			t.Errorf("%s: expected cpu %s, got %s", test.description, test.expectCPU, cpu.String())
+		}
+	}
+}
+
+func TestUpdateOverQuota(t *testing.T) {
+	tests := []struct {
+		description  string
+		resources    torchrunv1alpha1.QueueResources
+		usage        torchrunv1alpha1.QueueUsageStatus
+		expectStatus string
+	}{
+		{
+			description:  "usage within the quota",
+			resources:    torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: 32}},
+			usage:        torchrunv1alpha1.QueueUsageStatus{GPU: 32},
+			expectStatus: "False",
+		},
+		{
+			description:  "GPUs borrowed beyond the quota",
+			resources:    torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: 32}},
+			usage:        torchrunv1alpha1.QueueUsageStatus{GPU: 40},
+			expectStatus: "True",
+		},
+		{
+			description:  "unlimited quotas are never exceeded",
+			resources:    torchrunv1alpha1.QueueResources{CPU: torchrunv1alpha1.ResourceConfig{Quota: -1}, GPU: torchrunv1alpha1.ResourceConfig{Quota: -1}, Memory: torchrunv1alpha1.ResourceConfig{Quota: -1}},
+			usage:        torchrunv1alpha1.QueueUsageStatus{CPU: 64000, GPU: 40, Memory: 512000},
+			expectStatus: "False",
+		},
+		{
+			description:  "memory borrowed beyond the quota",
+			resources:    torchrunv1alpha1.QueueResources{GPU: torchrunv1alpha1.ResourceConfig{Quota: -1}, Memory: torchrunv1alpha1.ResourceConfig{Quota: 256000}},
+			usage:        torchrunv1alpha1.QueueUsageStatus{GPU: 8, Memory: 512000},
+			expectStatus: "True",
+		},
+	}
+
+	for _, test := range tests {
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			Spec:   torchrunv1alpha1.JobQueueSpec{Queue: torchrunv1alpha1.QueueConfig{Resources: test.resources}},
+			Status: torchrunv1alpha1.JobQueueStatus{Usage: &test.usage},
+		}
+		r := &TorchrunQueueReconciler{}
+		r.updateOverQuota(jq)
+		if len(jq.Status.Conditions) != 1 || jq.Status.Conditions[0].Status != test.expectStatus {
+			t.Errorf("%s: expected OverQuota %s, got %+v", test.description, test.expectStatus, jq.Status.Conditions)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+// Validator rejects TorchrunQueues whose resources have a kind the operator config does not
+// allow, so they are refused on apply instead of failing to reconcile
+type Validator struct {
+	// Config holds the allowed kinds of queue resources
+	Config *config.Store
+}
+
+var _ admission.CustomValidator = &Validator{}
+
+// ValidateCreate checks the resources of a created queue
+func (v *Validator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(obj)
+}
+
+// ValidateUpdate checks the resources of an updated queue. Queues being deleted are not checked,
+// so removing an allowed kind from the config does not block their finalizer.
+func (v *Validator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	if queue, ok := newObj.(*torchrunv1alpha1.TorchrunQueue); ok && queue.DeletionTimestamp != nil {
+		return nil, nil
+	}
+	return nil, v.validate(newObj)
+}
+
+// ValidateDelete accepts every deletion
+func (v *Validator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *Validator) validate(obj runtime.Object) error {
+	queue, ok := obj.(*torchrunv1alpha1.TorchrunQueue)
+	if !ok {
+		return fmt.Errorf("expected a TorchrunQueue, got %T", obj)
+	}
+	return validateResources(queue, &v.Config.Get().ResourceTemplates)
+}
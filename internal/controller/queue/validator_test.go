@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+)
+
+func TestValidator(t *testing.T) {
+	cfg := config.Default()
+	cfg.ResourceTemplates.AllowedKinds = []config.ResourceKind{{Kind: "ConfigMap", Resource: "configmaps"}}
+	v := &Validator{Config: config.NewStore(cfg)}
+
+	queue := func(kind string, deleting bool) *torchrunv1alpha1.TorchrunQueue {
+		jq := &torchrunv1alpha1.TorchrunQueue{
+			ObjectMeta: metav1.ObjectMeta{Name: "research", Namespace: "default"},
+			Spec: torchrunv1alpha1.JobQueueSpec{Resources: []torchrunv1alpha1.ResourceTemplate{{
+				Name:     "settings",
+				Template: runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"` + kind + `"}`)},
+			}}},
+		}
+		if deleting {
+			jq.DeletionTimestamp = &metav1.Time{}
+		}
+		return jq
+	}
+
+	if _, err := v.ValidateCreate(context.Background(), queue("ConfigMap", false)); err != nil {
+		t.Errorf("expected an allowed kind to be accepted, got %v", err)
+	}
+	if _, err := v.ValidateCreate(context.Background(), queue("Secret", false)); err == nil {
+		t.Errorf("expected a kind that is not allowed to be rejected on create")
+	}
+	if _, err := v.ValidateUpdate(context.Background(), queue("ConfigMap", false), queue("Secret", false)); err == nil {
+		t.Errorf("expected a kind that is not allowed to be rejected on update")
+	}
+	if _, err := v.ValidateUpdate(context.Background(), queue("Secret", false), queue("Secret", true)); err != nil {
+		t.Errorf("expected a queue being deleted to be accepted, got %v", err)
+	}
+}
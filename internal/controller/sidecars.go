@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// SupportsNativeSidecars returns true if the API server supports native sidecar containers
+// (init containers with restartPolicy: Always), which are enabled by default since Kubernetes 1.29
+func SupportsNativeSidecars(cfg *rest.Config) (bool, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	version, err := discoveryClient.ServerVersion()
+	if err != nil {
+		return false, fmt.Errorf("failed to get server version: %w", err)
+	}
+
+	major, err := strconv.Atoi(strings.TrimSuffix(version.Major, "+"))
+	if err != nil {
+		return false, fmt.Errorf("invalid server major version %q", version.Major)
+	}
+	// Managed clusters report versions like "29+"
+	minor, err := strconv.Atoi(strings.TrimSuffix(version.Minor, "+"))
+	if err != nil {
+		return false, fmt.Errorf("invalid server minor version %q", version.Minor)
+	}
+
+	return major > 1 || (major == 1 && minor >= 29), nil
+}
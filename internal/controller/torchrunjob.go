@@ -1,25 +1,82 @@
 package controller
 
 import (
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/dream3d/torchrun-controller/internal/config"
 	job "github.com/dream3d/torchrun-controller/internal/controller/job"
 	queue "github.com/dream3d/torchrun-controller/internal/controller/queue"
+	"github.com/dream3d/torchrun-controller/internal/kai"
 )
 
 // NewTorchrunJobReconciler creates a new JobReconciler
-func NewTorchrunJobReconciler(client client.Client, scheme *runtime.Scheme) *job.TorchrunJobReconciler {
+func NewTorchrunJobReconciler(client client.Client, apiReader client.Reader, clientset kubernetes.Interface, scheme *runtime.Scheme, nativeSidecars bool, opts ReconcilerOptions, operatorConfig *config.Store) *job.TorchrunJobReconciler {
 	return &job.TorchrunJobReconciler{
-		Client: client,
-		Scheme: scheme,
+		Client:            client,
+		APIReader:         apiReader,
+		Clientset:         clientset,
+		Scheme:            scheme,
+		NativeSidecars:    nativeSidecars,
+		ControllerOptions: opts.controllerOptions(),
+		QueueShard:        opts.QueueShard,
+		Config:            operatorConfig,
 	}
 }
 
 // NewJobQueueReconciler creates a new QueueReconciler
-func NewJobQueueReconciler(client client.Client, scheme *runtime.Scheme) *queue.TorchrunQueueReconciler {
+func NewJobQueueReconciler(client client.Client, apiReader client.Reader, scheme *runtime.Scheme, opts ReconcilerOptions, operatorConfig *config.Store, kaiQueues *kai.Client) *queue.TorchrunQueueReconciler {
 	return &queue.TorchrunQueueReconciler{
-		Client: client,
-		Scheme: scheme,
+		Client:            client,
+		APIReader:         apiReader,
+		Scheme:            scheme,
+		ControllerOptions: opts.controllerOptions(),
+		QueueShard:        opts.QueueShard,
+		Config:            operatorConfig,
+		KaiQueues:         kaiQueues,
 	}
 }
+
+// NewWorkspaceGarbageCollector creates a new WorkspaceGarbageCollector collecting the workspaces
+// of the jobs in the queues of queueShard
+func NewWorkspaceGarbageCollector(client client.Client, queueShard labels.Selector, operatorConfig *config.Store) *job.WorkspaceGarbageCollector {
+	return &job.WorkspaceGarbageCollector{
+		Client:     client,
+		QueueShard: queueShard,
+		Config:     operatorConfig,
+	}
+}
+
+// NewRenderServer creates a new RenderServer rendering jobs at addr, which has to be a loopback
+// address. The client should read from the API server, so jobs of namespaces outside the cache
+// are rendered too.
+func NewRenderServer(addr string, client client.Client, nativeSidecars bool, operatorConfig *config.Store) (*job.RenderServer, error) {
+	if err := job.ValidateRenderAddr(addr); err != nil {
+		return nil, err
+	}
+	return &job.RenderServer{
+		Addr: addr,
+		Handler: &job.RenderHandler{
+			Client:         client,
+			NativeSidecars: nativeSidecars,
+			Config:         operatorConfig,
+		},
+	}, nil
+}
+
+// NewProgressServer creates a new ProgressServer receiving the progress reports of the workers at
+// addr
+func NewProgressServer(addr string, client client.Client) *job.ProgressServer {
+	return &job.ProgressServer{
+		Addr:    addr,
+		Handler: &job.ProgressHandler{Client: client},
+	}
+}
+
+// NewQueueValidator creates a new Validator checking the resource kinds of TorchrunQueues against
+// the operator config
+func NewQueueValidator(operatorConfig *config.Store) *queue.Validator {
+	return &queue.Validator{Config: operatorConfig}
+}
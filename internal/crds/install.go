@@ -0,0 +1,150 @@
+// Package crds installs the CRD manifests embedded in the manager binary, so clusters without
+// Helm or kustomize run CRDs that match the controller version
+package crds
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+
+	"github.com/dream3d/torchrun-controller/config/crd"
+)
+
+// FieldManager owns the CRD fields the manager applies
+const FieldManager = "torchrun-controller"
+
+// establishTimeout is how long Install waits for the API server to serve the applied CRDs
+const establishTimeout = time.Minute
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+}
+
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;create;patch
+
+// Install applies the embedded CRDs with server-side apply and waits until they are established.
+// A conversionService of the form namespace/name replaces the Service of the conversion webhook
+// in the manifests, which names the one of the kustomize install.
+func Install(ctx context.Context, cfg *rest.Config, conversionService string) error {
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create CRD client: %w", err)
+	}
+	crds, err := Load()
+	if err != nil {
+		return err
+	}
+	if conversionService != "" {
+		service, err := parseService(conversionService)
+		if err != nil {
+			return err
+		}
+		for _, crd := range crds {
+			if err := setConversionService(crd, service); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Replicas and upgrades take over the fields of earlier versions of the manager
+	for _, crd := range crds {
+		log.FromContext(ctx).Info("Applying CRD", "name", crd.GetName())
+		if err := c.Patch(ctx, crd, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+			return fmt.Errorf("failed to apply CRD %s: %w", crd.GetName(), err)
+		}
+	}
+	for _, crd := range crds {
+		if err := waitEstablished(ctx, c, crd.GetName()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load decodes the embedded CRD manifests
+func Load() ([]*unstructured.Unstructured, error) {
+	files, err := fs.Glob(crd.Bases, "bases/*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	crds := make([]*unstructured.Unstructured, 0, len(files))
+	for _, file := range files {
+		data, err := crd.Bases.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+			return nil, fmt.Errorf("invalid CRD manifest %s: %w", file, err)
+		}
+		if obj.GetKind() != "CustomResourceDefinition" || obj.GetName() == "" {
+			return nil, fmt.Errorf("%s is not a CRD manifest", file)
+		}
+		crds = append(crds, obj)
+	}
+	return crds, nil
+}
+
+// parseService parses a namespace/name Service reference
+func parseService(service string) (types.NamespacedName, error) {
+	namespace, name, ok := strings.Cut(service, "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return types.NamespacedName{}, fmt.Errorf("invalid conversion service %q, expected namespace/name", service)
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name}, nil
+}
+
+// setConversionService points the conversion webhook of a CRD at service. CRDs without a
+// conversion webhook are left unchanged.
+func setConversionService(crd *unstructured.Unstructured, service types.NamespacedName) error {
+	path := []string{"spec", "conversion", "webhook", "clientConfig", "service"}
+	if _, found, err := unstructured.NestedMap(crd.Object, path...); err != nil || !found {
+		return err
+	}
+	if err := unstructured.SetNestedField(crd.Object, service.Namespace, append(path, "namespace")...); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(crd.Object, service.Name, append(path, "name")...); err != nil {
+		return err
+	}
+	// The CA of the kustomize certificate does not sign the certificate of another Service
+	annotations := crd.GetAnnotations()
+	delete(annotations, "cert-manager.io/inject-ca-from")
+	crd.SetAnnotations(annotations)
+	return nil
+}
+
+// waitEstablished waits until the API server serves a CRD
+func waitEstablished(ctx context.Context, c client.Client, name string) error {
+	err := wait.PollUntilContextTimeout(ctx, time.Second, establishTimeout, true, func(ctx context.Context) (bool, error) {
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := c.Get(ctx, types.NamespacedName{Name: name}, crd); err != nil {
+			return false, err
+		}
+		for _, condition := range crd.Status.Conditions {
+			if condition.Type == apiextensionsv1.Established && condition.Status == apiextensionsv1.ConditionTrue {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("CRD %s is not established: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package crds
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLoad(t *testing.T) {
+	crds, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	var names []string
+	for _, crd := range crds {
+		names = append(names, crd.GetName())
+	}
+	for _, expected := range []string{
+		"torchrunjobrecords.torchrun.ai",
+		"torchrunjobs.torchrun.ai",
+		"torchrunqueuebindings.torchrun.ai",
+		"torchrunqueues.torchrun.ai",
+		"torchruntemplates.torchrun.ai",
+	} {
+		if !slices.Contains(names, expected) {
+			t.Errorf("expected embedded CRD %s, got %v", expected, names)
+		}
+	}
+}
+
+func TestSetConversionService(t *testing.T) {
+	crds, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	service, err := parseService("ml-platform/torchrun-webhook")
+	if err != nil {
+		t.Fatalf("parseService() error = %v", err)
+	}
+
+	for _, crd := range crds {
+		before := crd.DeepCopy()
+		if err := setConversionService(crd, service); err != nil {
+			t.Fatalf("%s: setConversionService() error = %v", crd.GetName(), err)
+		}
+		_, webhook, _ := unstructured.NestedMap(before.Object, "spec", "conversion", "webhook")
+		if !webhook {
+			if !reflect.DeepEqual(before.Object, crd.Object) {
+				t.Errorf("%s: expected CRD without conversion webhook to be unchanged", crd.GetName())
+			}
+			continue
+		}
+		namespace, _, _ := unstructured.NestedString(crd.Object, "spec", "conversion", "webhook", "clientConfig", "service", "namespace")
+		name, _, _ := unstructured.NestedString(crd.Object, "spec", "conversion", "webhook", "clientConfig", "service", "name")
+		if namespace != "ml-platform" || name != "torchrun-webhook" {
+			t.Errorf("%s: expected service ml-platform/torchrun-webhook, got %s/%s", crd.GetName(), namespace, name)
+		}
+		if _, ok := crd.GetAnnotations()["cert-manager.io/inject-ca-from"]; ok {
+			t.Errorf("%s: expected the CA injection of the kustomize certificate to be removed", crd.GetName())
+		}
+	}
+}
+
+func TestParseService(t *testing.T) {
+	tests := []struct {
+		service     string
+		expectError bool
+	}{
+		{service: "torchrun-system/torchrun-webhook-service"},
+		{service: "torchrun-webhook-service", expectError: true},
+		{service: "/torchrun-webhook-service", expectError: true},
+		{service: "torchrun-system/", expectError: true},
+		{service: "torchrun-system/webhook/extra", expectError: true},
+	}
+
+	for _, test := range tests {
+		if _, err := parseService(test.service); (err != nil) != test.expectError {
+			t.Errorf("%s: expected error %v, got %v", test.service, test.expectError, err)
+		}
+	}
+}
+
+func TestWaitEstablished(t *testing.T) {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "torchrunjobs.torchrun.ai"},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{Conditions: []apiextensionsv1.CustomResourceDefinitionCondition{
+			{Type: apiextensionsv1.NamesAccepted, Status: apiextensionsv1.ConditionTrue},
+			{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionTrue},
+		}},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(crd).Build()
+
+	if err := waitEstablished(context.Background(), c, crd.Name); err != nil {
+		t.Errorf("expected established CRD, got %v", err)
+	}
+	if err := waitEstablished(context.Background(), c, "missing.torchrun.ai"); err == nil {
+		t.Errorf("expected error for a missing CRD")
+	}
+}
@@ -0,0 +1,79 @@
+// Package defaultqueue resolves the TorchrunQueue of jobs that omit spec.queue: the queue of the
+// queue namespace annotated torchrun.ai/default-queue=true. The mutating webhook stamps it on
+// created jobs, so single-queue namespaces need not name their queue.
+package defaultqueue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// Resolve returns the name of the default TorchrunQueue of the namespace. It fails unless exactly
+// one queue of the namespace is annotated as the default.
+func Resolve(ctx context.Context, reader client.Reader, namespace string) (string, error) {
+	var queues torchrunv1alpha1.TorchrunQueueList
+	if err := reader.List(ctx, &queues, client.InNamespace(namespace)); err != nil {
+		return "", fmt.Errorf("failed to list TorchrunQueues of namespace %s: %w", namespace, err)
+	}
+	var defaults []string
+	for _, queue := range queues.Items {
+		if queue.Annotations[torchrunv1alpha1.DefaultQueueAnnotation] == "true" {
+			defaults = append(defaults, queue.Name)
+		}
+	}
+	switch len(defaults) {
+	case 0:
+		return "", fmt.Errorf("spec.queue is required: no TorchrunQueue in namespace %s is annotated %s=true",
+			namespace, torchrunv1alpha1.DefaultQueueAnnotation)
+	case 1:
+		return defaults[0], nil
+	}
+	sort.Strings(defaults)
+	return "", fmt.Errorf("spec.queue is required: TorchrunQueues %s in namespace %s are all annotated %s=true",
+		strings.Join(defaults, ", "), namespace, torchrunv1alpha1.DefaultQueueAnnotation)
+}
+
+// Defaulter sets the default TorchrunQueue of created jobs that omit spec.queue
+type Defaulter struct {
+	// Reader reads the TorchrunQueues of the queue namespace of the job
+	Reader client.Reader
+}
+
+var _ admission.CustomDefaulter = &Defaulter{}
+
+// Default sets spec.queue of the job to the default TorchrunQueue of its queue namespace
+func (d *Defaulter) Default(ctx context.Context, obj runtime.Object) error {
+	job, ok := obj.(*torchrunv1alpha1.TorchrunJob)
+	if !ok {
+		return fmt.Errorf("expected a TorchrunJob, got %T", obj)
+	}
+	if job.Spec.Queue != "" {
+		return nil
+	}
+	// The namespace of a created object may only be given by the request
+	namespace := job.Spec.QueueNamespace
+	if namespace == "" {
+		namespace = job.Namespace
+	}
+	if namespace == "" {
+		if req, err := admission.RequestFromContext(ctx); err == nil {
+			namespace = req.Namespace
+		}
+	}
+	queue, err := Resolve(ctx, d.Reader, namespace)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Defaulted the queue of the job", "name", job.Name, "queue", queue)
+	job.Spec.Queue = queue
+	return nil
+}
@@ -0,0 +1,93 @@
+package defaultqueue
+
+import (
+	"context"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestDefault(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	newQueue := func(name, namespace, isDefault string) *torchrunv1alpha1.TorchrunQueue {
+		queue := &torchrunv1alpha1.TorchrunQueue{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		if isDefault != "" {
+			queue.Annotations = map[string]string{torchrunv1alpha1.DefaultQueueAnnotation: isDefault}
+		}
+		return queue
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newQueue("research", "team-a", "true"),
+		newQueue("batch", "team-a", "false"),
+		newQueue("dev", "team-b", ""),
+		newQueue("research", "ml-platform", "true"),
+		newQueue("large", "ml-platform", "true"),
+	).Build()
+	defaulter := &Defaulter{Reader: c}
+
+	tests := []struct {
+		description      string
+		namespace        string
+		requestNamespace string
+		queue            string
+		queueNamespace   string
+		expectQueue      string
+		expectError      bool
+	}{
+		{
+			description: "queue of the job is kept",
+			namespace:   "team-a",
+			queue:       "batch",
+			expectQueue: "batch",
+		},
+		{
+			description: "default queue of the namespace",
+			namespace:   "team-a",
+			expectQueue: "research",
+		},
+		{
+			description:      "namespace given by the request",
+			requestNamespace: "team-a",
+			expectQueue:      "research",
+		},
+		{
+			description: "namespace without a default queue",
+			namespace:   "team-b",
+			expectError: true,
+		},
+		{
+			description:    "queue namespace with several default queues",
+			namespace:      "team-a",
+			queueNamespace: "ml-platform",
+			expectError:    true,
+		},
+	}
+
+	for _, test := range tests {
+		job := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: test.namespace},
+			Spec:       torchrunv1alpha1.TorchrunJobSpec{Queue: test.queue, QueueNamespace: test.queueNamespace},
+		}
+		ctx := admission.NewContextWithRequest(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{Namespace: test.requestNamespace},
+		})
+
+		err := defaulter.Default(ctx, job)
+		if (err != nil) != test.expectError {
+			t.Errorf("%s: expected error %v, got %v", test.description, test.expectError, err)
+		}
+		if job.Spec.Queue != test.expectQueue {
+			t.Errorf("%s: expected queue %q, got %q", test.description, test.expectQueue, job.Spec.Queue)
+		}
+	}
+}
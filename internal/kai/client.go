@@ -0,0 +1,232 @@
+package kai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrNotInstalled is returned while the Queue CRD of kai-scheduler is not installed
+var ErrNotInstalled = errors.New("the kai-scheduler Queue CRD " + QueueCRDName + " is not installed")
+
+// Client reads and writes kai-scheduler Queues in the version the cluster serves
+type Client struct {
+	client client.Client
+	reader client.Reader
+
+	mu      sync.Mutex
+	version string
+}
+
+// NewClient creates a Queue client. The version of the Queues is detected from their CRD, read
+// with reader, on first use and again once kai-scheduler was reinstalled.
+func NewClient(client client.Client, reader client.Reader) *Client {
+	return &Client{client: client, reader: reader}
+}
+
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get
+
+// Version returns the version of the Queues the client reads and writes, detecting it on first
+// use. It returns ErrNotInstalled while the Queue CRD is not installed.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != "" {
+		return c.version, nil
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := c.reader.Get(ctx, client.ObjectKey{Name: QueueCRDName}, crd); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", ErrNotInstalled
+		}
+		return "", fmt.Errorf("failed to get CRD %s: %w", QueueCRDName, err)
+	}
+	version, err := SelectVersion(crd)
+	if err != nil {
+		return "", err
+	}
+	c.version = version
+	return version, nil
+}
+
+// SelectVersion returns the served version of the Queue CRD the client uses: the first served
+// known version, else the newest served version whose schema accepts the fields of the types
+func SelectVersion(crd *apiextensionsv1.CustomResourceDefinition) (string, error) {
+	served := map[string]*apiextensionsv1.CustomResourceDefinitionVersion{}
+	var others []string
+	for i := range crd.Spec.Versions {
+		crdVersion := &crd.Spec.Versions[i]
+		if !crdVersion.Served {
+			continue
+		}
+		served[crdVersion.Name] = crdVersion
+		if !slices.Contains(KnownVersions, crdVersion.Name) {
+			others = append(others, crdVersion.Name)
+		}
+	}
+	for _, known := range KnownVersions {
+		if served[known] != nil {
+			return known, nil
+		}
+	}
+	if len(others) == 0 {
+		return "", fmt.Errorf("CRD %s serves no version", QueueCRDName)
+	}
+
+	sort.Slice(others, func(i, j int) bool {
+		return version.CompareKubeAwareVersionStrings(others[i], others[j]) > 0
+	})
+	var problems []string
+	for _, name := range others {
+		if err := checkSchema(served[name].Schema); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("CRD %s serves no version compatible with %s: %s",
+		QueueCRDName, strings.Join(KnownVersions, ", "), strings.Join(problems, "; "))
+}
+
+// checkSchema checks that the schema of a Queue version has the fields of the types. Fields
+// below an object preserving unknown fields are accepted as they are.
+func checkSchema(validation *apiextensionsv1.CustomResourceValidation) error {
+	if validation == nil || validation.OpenAPIV3Schema == nil {
+		return errors.New("no schema")
+	}
+	paths := make([]string, 0, len(schemaFields))
+	for path := range schemaFields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		fieldSchema := validation.OpenAPIV3Schema
+		for _, name := range strings.Split(path, ".") {
+			if fieldSchema.XPreserveUnknownFields != nil && *fieldSchema.XPreserveUnknownFields {
+				fieldSchema = nil
+				break
+			}
+			property, ok := fieldSchema.Properties[name]
+			if !ok {
+				return fmt.Errorf("field %s is missing", path)
+			}
+			fieldSchema = &property
+		}
+		if fieldSchema == nil {
+			continue
+		}
+		// Whole numbers are sent without a fraction, so integer fields accept them
+		if expected := schemaFields[path]; fieldSchema.Type != expected && !(expected == "number" && fieldSchema.Type == "integer") {
+			return fmt.Errorf("field %s is of type %s, expected %s", path, fieldSchema.Type, expected)
+		}
+	}
+	return nil
+}
+
+// Get returns the Queue of the given name
+func (c *Client) Get(ctx context.Context, name string) (*Queue, error) {
+	obj, err := c.newObject(ctx, QueueKind)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.client.Get(ctx, client.ObjectKey{Name: name}, obj); err != nil {
+		return nil, c.checkInstalled(err)
+	}
+	queue := &Queue{}
+	return queue, runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, queue)
+}
+
+// List returns the Queues matching opts
+func (c *Client) List(ctx context.Context, opts ...client.ListOption) ([]Queue, error) {
+	list := &unstructured.UnstructuredList{}
+	obj, err := c.newObject(ctx, QueueKind+"List")
+	if err != nil {
+		return nil, err
+	}
+	list.SetGroupVersionKind(obj.GroupVersionKind())
+	if err := c.client.List(ctx, list, opts...); err != nil {
+		return nil, c.checkInstalled(err)
+	}
+	queues := make([]Queue, len(list.Items))
+	for i := range list.Items {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(list.Items[i].Object, &queues[i]); err != nil {
+			return nil, err
+		}
+	}
+	return queues, nil
+}
+
+// Create creates the Queue and updates it with the created object
+func (c *Client) Create(ctx context.Context, queue *Queue) error {
+	return c.write(ctx, queue, func(obj *unstructured.Unstructured) error {
+		return c.client.Create(ctx, obj)
+	})
+}
+
+// Update updates the Queue and updates it with the updated object
+func (c *Client) Update(ctx context.Context, queue *Queue) error {
+	return c.write(ctx, queue, func(obj *unstructured.Unstructured) error {
+		return c.client.Update(ctx, obj)
+	})
+}
+
+// Delete deletes the Queue
+func (c *Client) Delete(ctx context.Context, queue *Queue) error {
+	return c.write(ctx, queue, func(obj *unstructured.Unstructured) error {
+		return c.client.Delete(ctx, obj)
+	})
+}
+
+// write sends the Queue in the detected version and reads the result back into it
+func (c *Client) write(ctx context.Context, queue *Queue, send func(*unstructured.Unstructured) error) error {
+	obj, err := c.newObject(ctx, QueueKind)
+	if err != nil {
+		return err
+	}
+	gvk := obj.GroupVersionKind()
+	if obj.Object, err = runtime.DefaultUnstructuredConverter.ToUnstructured(queue); err != nil {
+		return err
+	}
+	obj.SetGroupVersionKind(gvk)
+	if err := send(obj); err != nil {
+		return c.checkInstalled(err)
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, queue)
+}
+
+// newObject returns an empty object of the kind in the detected version
+func (c *Client) newObject(ctx context.Context, kind string) (*unstructured.Unstructured, error) {
+	version, err := c.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(schema.GroupVersionKind{Group: Group, Version: version, Kind: kind})
+	return obj, nil
+}
+
+// checkInstalled forgets the detected version once the API server no longer serves it, e.g.
+// after kai-scheduler was uninstalled or upgraded, so the next call detects it again
+func (c *Client) checkInstalled(err error) error {
+	if !meta.IsNoMatchError(err) {
+		return err
+	}
+	c.mu.Lock()
+	c.version = ""
+	c.mu.Unlock()
+	return fmt.Errorf("%w: %v", ErrNotInstalled, err)
+}
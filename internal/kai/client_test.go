@@ -0,0 +1,149 @@
+package kai
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// queueSchema returns the schema of a Queue version with the given type of the quota fields
+func queueSchema(quotaType string) *apiextensionsv1.CustomResourceValidation {
+	quota := apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+		"quota":           {Type: quotaType},
+		"limit":           {Type: quotaType},
+		"overQuotaWeight": {Type: quotaType},
+	}}
+	return &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"spec": {Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+				"parentQueue": {Type: "string"},
+				"resources": {Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+					"cpu": quota, "gpu": quota, "memory": quota,
+				}},
+			}},
+		},
+	}}
+}
+
+func newQueueCRD(versions ...apiextensionsv1.CustomResourceDefinitionVersion) *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: QueueCRDName},
+		Spec:       apiextensionsv1.CustomResourceDefinitionSpec{Versions: versions},
+	}
+}
+
+func TestSelectVersion(t *testing.T) {
+	preserveUnknown := true
+
+	tests := []struct {
+		description   string
+		versions      []apiextensionsv1.CustomResourceDefinitionVersion
+		expectVersion string
+		expectError   bool
+	}{
+		{
+			description:   "known version is preferred over newer ones",
+			versions:      []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v2", Served: true}, {Name: "v3", Served: true, Schema: queueSchema("number")}},
+			expectVersion: "v2",
+		},
+		{
+			description:   "newest compatible version without a known one",
+			versions:      []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v3beta1", Served: true, Schema: queueSchema("number")}, {Name: "v3", Served: true, Schema: queueSchema("integer")}},
+			expectVersion: "v3",
+		},
+		{
+			description:   "incompatible newer version is skipped",
+			versions:      []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v4", Served: true, Schema: queueSchema("string")}, {Name: "v3", Served: true, Schema: queueSchema("number")}},
+			expectVersion: "v3",
+		},
+		{
+			description: "version preserving unknown fields accepts the spec",
+			versions: []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v3", Served: true, Schema: &apiextensionsv1.CustomResourceValidation{
+				OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+					"spec": {Type: "object", XPreserveUnknownFields: &preserveUnknown},
+				}},
+			}}},
+			expectVersion: "v3",
+		},
+		{
+			description: "version without the fields of the spec",
+			versions: []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v3", Served: true, Schema: &apiextensionsv1.CustomResourceValidation{
+				OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{Type: "object"},
+			}}},
+			expectError: true,
+		},
+		{
+			description: "known version that is no longer served",
+			versions:    []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v2", Served: false}},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		version, err := SelectVersion(newQueueCRD(test.versions...))
+		if (err != nil) != test.expectError {
+			t.Errorf("%s: expected error %v, got %v", test.description, test.expectError, err)
+		}
+		if version != test.expectVersion {
+			t.Errorf("%s: expected version %q, got %q", test.description, test.expectVersion, version)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := apiextensionsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	gvk := schema.GroupVersionKind{Group: Group, Version: "v3", Kind: QueueKind}
+	scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(QueueKind+"List"), &unstructured.UnstructuredList{})
+	ctx := context.Background()
+
+	// Without the CRD the client reports kai-scheduler as not installed
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	queues := NewClient(c, c)
+	if _, err := queues.Get(ctx, "research"); !errors.Is(err, ErrNotInstalled) {
+		t.Fatalf("expected ErrNotInstalled, got %v", err)
+	}
+
+	// Once installed, Queues are written in the served version
+	if err := c.Create(ctx, newQueueCRD(apiextensionsv1.CustomResourceDefinitionVersion{Name: "v3", Served: true, Schema: queueSchema("number")})); err != nil {
+		t.Fatalf("failed to create CRD: %v", err)
+	}
+	queue := &Queue{
+		ObjectMeta: metav1.ObjectMeta{Name: "research", Labels: map[string]string{"torchrun.ai/jobqueue": "research"}},
+		Spec:       QueueSpec{ParentQueue: "default", Resources: &QueueResources{GPU: ResourceQuota{Quota: 16, Limit: -1, OverQuotaWeight: 1}}},
+	}
+	if err := queues.Create(ctx, queue); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if queue.ResourceVersion == "" {
+		t.Errorf("expected the created Queue to be read back")
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	if err := c.Get(ctx, client.ObjectKey{Name: "research"}, obj); err != nil {
+		t.Fatalf("expected Queue in version v3: %v", err)
+	}
+	if quota, _, _ := unstructured.NestedInt64(obj.Object, "spec", "resources", "gpu", "quota"); quota != 16 {
+		t.Errorf("expected GPU quota 16, got %d", quota)
+	}
+
+	listed, err := queues.List(ctx, client.MatchingLabels{"torchrun.ai/jobqueue": "research"})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(listed) != 1 || listed[0].Spec.ParentQueue != "default" || listed[0].Spec.Resources.GPU.Limit != -1 {
+		t.Errorf("expected the created Queue, got %+v", listed)
+	}
+}
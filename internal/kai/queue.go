@@ -0,0 +1,75 @@
+// Package kai reads and writes the Queues of kai-scheduler. The Queues are typed here and sent in
+// the API version the cluster serves, which the client detects from the Queue CRD, so the
+// controller supports scheduling.run.ai/v2 and the newer versions whose schema still has the
+// fields it writes.
+package kai
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Group is the API group of kai-scheduler
+	Group = "scheduling.run.ai"
+	// QueueResource is the resource of Queues
+	QueueResource = "queues"
+	// QueueKind is the kind of Queues
+	QueueKind = "Queue"
+	// QueueCRDName is the name of the CustomResourceDefinition of Queues
+	QueueCRDName = QueueResource + "." + Group
+)
+
+// KnownVersions are the Queue versions the types were written against, preferred first. Other
+// served versions are used once their schema is checked to accept the fields of the types.
+var KnownVersions = []string{"v2"}
+
+// Queue is a kai-scheduler Queue. Queues are cluster scoped.
+type Queue struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec QueueSpec `json:"spec,omitempty"`
+}
+
+// QueueSpec is the spec of a kai-scheduler Queue
+type QueueSpec struct {
+	// ParentQueue is the name of the parent Queue in the queue hierarchy
+	ParentQueue string `json:"parentQueue,omitempty"`
+
+	// Resources holds the quotas of the Queue per resource
+	Resources *QueueResources `json:"resources,omitempty"`
+}
+
+// QueueResources holds the quotas of a Queue per resource
+type QueueResources struct {
+	CPU    ResourceQuota `json:"cpu"`
+	GPU    ResourceQuota `json:"gpu"`
+	Memory ResourceQuota `json:"memory"`
+}
+
+// ResourceQuota is the quota of a Queue for one resource. -1 is unlimited.
+type ResourceQuota struct {
+	// Quota is the amount of the resource guaranteed to the Queue
+	Quota float64 `json:"quota"`
+
+	// Limit is the most of the resource the Queue may use, including over quota
+	Limit float64 `json:"limit"`
+
+	// OverQuotaWeight is the share of the Queue in the resources left over by other Queues
+	OverQuotaWeight float64 `json:"overQuotaWeight"`
+}
+
+// schemaFields are the paths of the fields of a Queue spec and their OpenAPI types, checked
+// against the schema of versions the types were not written against
+var schemaFields = map[string]string{
+	"spec.parentQueue":                      "string",
+	"spec.resources.cpu.quota":              "number",
+	"spec.resources.cpu.limit":              "number",
+	"spec.resources.cpu.overQuotaWeight":    "number",
+	"spec.resources.gpu.quota":              "number",
+	"spec.resources.gpu.limit":              "number",
+	"spec.resources.gpu.overQuotaWeight":    "number",
+	"spec.resources.memory.quota":           "number",
+	"spec.resources.memory.limit":           "number",
+	"spec.resources.memory.overQuotaWeight": "number",
+}
@@ -0,0 +1,62 @@
+package patch
+
+import (
+	"context"
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Status persists the status changes made to obj since base, the object as it was read, as a
+// JSON merge patch of the status subresource. The patch is guarded by the resourceVersion of
+// obj, so a concurrent write fails it with a conflict; the latest object is then read and the
+// same changes are merged onto it, retrying with the default backoff. Only the resourceVersion
+// of obj is updated, so changes that are not persisted yet stay on obj.
+func Status(ctx context.Context, c client.Client, obj, base client.Object) error {
+	changes, err := getStatusChanges(obj, base)
+	if err != nil || changes == nil {
+		return err
+	}
+
+	resourceVersion := obj.GetResourceVersion()
+	persisted := obj.DeepCopyObject().(client.Object)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		data, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{"resourceVersion": resourceVersion},
+			"status":   changes,
+		})
+		if err != nil {
+			return err
+		}
+		err = c.Status().Patch(ctx, persisted, client.RawPatch(types.MergePatchType, data))
+		if errors.IsConflict(err) {
+			if getErr := c.Get(ctx, client.ObjectKeyFromObject(obj), persisted); getErr != nil {
+				return getErr
+			}
+			resourceVersion = persisted.GetResourceVersion()
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	obj.SetResourceVersion(persisted.GetResourceVersion())
+	return nil
+}
+
+// getStatusChanges returns the merge patch of the status of base to the status of obj, or nil
+// if the status did not change
+func getStatusChanges(obj, base client.Object) (interface{}, error) {
+	data, err := client.MergeFrom(base).Data(obj)
+	if err != nil {
+		return nil, err
+	}
+	var patch map[string]interface{}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, err
+	}
+	return patch["status"], nil
+}
@@ -0,0 +1,112 @@
+package patch
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestStatus(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := torchrunv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+
+	tests := []struct {
+		description    string
+		mutate         func(job *torchrunv1alpha1.TorchrunJob)
+		concurrent     func(job *torchrunv1alpha1.TorchrunJob)
+		expectPhase    string
+		expectTracking string
+		expectWrite    bool
+	}{
+		{
+			description: "unchanged status is not written",
+			mutate:      func(job *torchrunv1alpha1.TorchrunJob) {},
+			expectPhase: torchrunv1alpha1.PhasePending,
+		},
+		{
+			description: "changed status is patched",
+			mutate: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Status.Phase = torchrunv1alpha1.PhaseRunning
+			},
+			expectPhase: torchrunv1alpha1.PhaseRunning,
+			expectWrite: true,
+		},
+		{
+			description: "changes are merged onto a concurrent write",
+			mutate: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Status.Phase = torchrunv1alpha1.PhaseRunning
+			},
+			concurrent: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Status.TrackingRunID = "abc123"
+			},
+			expectPhase:    torchrunv1alpha1.PhaseRunning,
+			expectTracking: "abc123",
+			expectWrite:    true,
+		},
+		{
+			description: "changes win over a concurrent write of the same field",
+			mutate: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Status.Phase = torchrunv1alpha1.PhaseRunning
+			},
+			concurrent: func(job *torchrunv1alpha1.TorchrunJob) {
+				job.Status.Phase = torchrunv1alpha1.PhaseQueued
+			},
+			expectPhase: torchrunv1alpha1.PhaseRunning,
+			expectWrite: true,
+		},
+	}
+
+	for _, test := range tests {
+		ctx := context.Background()
+		stored := &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "default"},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{Phase: torchrunv1alpha1.PhasePending},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(stored).WithStatusSubresource(stored).Build()
+
+		job := &torchrunv1alpha1.TorchrunJob{}
+		if err := c.Get(ctx, client.ObjectKeyFromObject(stored), job); err != nil {
+			t.Fatalf("%s: failed to get job: %v", test.description, err)
+		}
+		if test.concurrent != nil {
+			other := job.DeepCopy()
+			test.concurrent(other)
+			if err := c.Status().Update(ctx, other); err != nil {
+				t.Fatalf("%s: failed to write job: %v", test.description, err)
+			}
+		}
+		written := &torchrunv1alpha1.TorchrunJob{}
+		if err := c.Get(ctx, client.ObjectKeyFromObject(stored), written); err != nil {
+			t.Fatalf("%s: failed to get job: %v", test.description, err)
+		}
+
+		base := job.DeepCopy()
+		test.mutate(job)
+		if err := Status(ctx, c, job, base); err != nil {
+			t.Fatalf("%s: Status() error = %v", test.description, err)
+		}
+
+		persisted := &torchrunv1alpha1.TorchrunJob{}
+		if err := c.Get(ctx, client.ObjectKeyFromObject(stored), persisted); err != nil {
+			t.Fatalf("%s: failed to get job: %v", test.description, err)
+		}
+		if persisted.Status.Phase != test.expectPhase || persisted.Status.TrackingRunID != test.expectTracking {
+			t.Errorf("%s: expected phase %q and run %q, got %q and %q", test.description,
+				test.expectPhase, test.expectTracking, persisted.Status.Phase, persisted.Status.TrackingRunID)
+		}
+		if wrote := persisted.ResourceVersion != written.ResourceVersion; wrote != test.expectWrite {
+			t.Errorf("%s: expected write %v, got %v", test.description, test.expectWrite, wrote)
+		}
+		if test.expectWrite && job.ResourceVersion != persisted.ResourceVersion {
+			t.Errorf("%s: expected resourceVersion %s, got %s", test.description, persisted.ResourceVersion, job.ResourceVersion)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Package shard splits the TorchrunQueues between controller deployments by their labels, so
+// each deployment reconciles a subset of the queues and the jobs submitted to them
+package shard
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Parse parses the label selector of the queues a deployment owns. An empty selector owns every
+// queue and returns nil.
+func Parse(selector string) (labels.Selector, error) {
+	if selector == "" {
+		return nil, nil
+	}
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid queue shard %q: %w", selector, err)
+	}
+	return parsed, nil
+}
+
+// IsSharded returns true if selector owns a subset of the queues
+func IsSharded(selector labels.Selector) bool {
+	return selector != nil && !selector.Empty()
+}
+
+// Owns returns true if the deployment of selector reconciles the queue. A nil selector owns
+// every queue.
+func Owns(selector labels.Selector, queue client.Object) bool {
+	return !IsSharded(selector) || selector.Matches(labels.Set(queue.GetLabels()))
+}
+
+// Predicate drops the events of the queues of other shards. A queue relabeled into another
+// shard is dropped with its update event, so the shard it left stops reconciling it.
+func Predicate(selector labels.Selector) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return Owns(selector, obj)
+	})
+}
@@ -0,0 +1,44 @@
+package shard
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+func TestOwns(t *testing.T) {
+	tests := []struct {
+		description string
+		selector    string
+		labels      map[string]string
+		expected    bool
+	}{
+		{description: "unsharded controllers own every queue", expected: true},
+		{description: "queue in the shard", selector: "torchrun.ai/shard=a", labels: map[string]string{"torchrun.ai/shard": "a"}, expected: true},
+		{description: "queue of another shard", selector: "torchrun.ai/shard=a", labels: map[string]string{"torchrun.ai/shard": "b"}},
+		{description: "queue without a shard label", selector: "torchrun.ai/shard=a"},
+		{description: "set based selector", selector: "torchrun.ai/shard notin (a,b)", labels: map[string]string{"torchrun.ai/shard": "c"}, expected: true},
+	}
+
+	for _, test := range tests {
+		selector, err := Parse(test.selector)
+		if err != nil {
+			t.Fatalf("%s: Parse() error = %v", test.description, err)
+		}
+		queue := &torchrunv1alpha1.TorchrunQueue{ObjectMeta: metav1.ObjectMeta{Name: "research", Labels: test.labels}}
+		if actual := Owns(selector, queue); actual != test.expected {
+			t.Errorf("%s: expected owned %v, got %v", test.description, test.expected, actual)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse("torchrun.ai/shard in (a"); err == nil {
+		t.Errorf("expected error for an invalid selector")
+	}
+	if selector, err := Parse(""); err != nil || IsSharded(selector) {
+		t.Errorf("expected an empty selector to own every queue, got %v %v", selector, err)
+	}
+}
@@ -0,0 +1,146 @@
+package tracing
+
+import (
+	"context"
+	"reflect"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// WrapClient returns a client that traces every API call as a span of the context it is made in
+func WrapClient(c client.Client) client.Client {
+	return &tracingClient{Client: c}
+}
+
+// WrapReader returns a reader that traces every API call as a span of the context it is made in
+func WrapReader(r client.Reader) client.Reader {
+	return &tracingReader{reader: r}
+}
+
+type tracingClient struct {
+	client.Client
+}
+
+type tracingReader struct {
+	reader client.Reader
+}
+
+type tracingStatusWriter struct {
+	client.SubResourceWriter
+}
+
+// startCall starts the span of an API call on obj, named after the verb and kind, e.g.
+// "Get TorchrunJob"
+func startCall(ctx context.Context, verb string, obj runtime.Object) (context.Context, trace.Span) {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if kind == "" {
+		kind = reflect.Indirect(reflect.ValueOf(obj)).Type().Name()
+	}
+	attributes := []attribute.KeyValue{attribute.String("k8s.verb", verb), attribute.String("k8s.kind", kind)}
+	if o, ok := obj.(client.Object); ok {
+		if o.GetNamespace() != "" {
+			attributes = append(attributes, attribute.String("k8s.namespace.name", o.GetNamespace()))
+		}
+		if o.GetName() != "" {
+			attributes = append(attributes, attribute.String("k8s.name", o.GetName()))
+		}
+	}
+	return Tracer().Start(ctx, verb+" "+kind, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+}
+
+// endCall ends the span of an API call. Missing objects are expected, they are not recorded as
+// errors.
+func endCall(span trace.Span, err error) {
+	if errors.IsNotFound(err) {
+		err = nil
+	}
+	EndSpan(span, err)
+}
+
+// startGet starts the span of a Get, whose object carries no name yet
+func startGet(ctx context.Context, key types.NamespacedName, obj runtime.Object) (context.Context, trace.Span) {
+	ctx, span := startCall(ctx, "Get", obj)
+	span.SetAttributes(attribute.String("k8s.namespace.name", key.Namespace), attribute.String("k8s.name", key.Name))
+	return ctx, span
+}
+
+func (c *tracingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) (err error) {
+	ctx, span := startGet(ctx, key, obj)
+	defer func() { endCall(span, err) }()
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func (c *tracingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) (err error) {
+	ctx, span := startCall(ctx, "List", list)
+	defer func() { endCall(span, err) }()
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c *tracingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) (err error) {
+	ctx, span := startCall(ctx, "Create", obj)
+	defer func() { endCall(span, err) }()
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) (err error) {
+	ctx, span := startCall(ctx, "Delete", obj)
+	defer func() { endCall(span, err) }()
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) (err error) {
+	ctx, span := startCall(ctx, "Update", obj)
+	defer func() { endCall(span, err) }()
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) (err error) {
+	ctx, span := startCall(ctx, "Patch", obj)
+	defer func() { endCall(span, err) }()
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *tracingClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) (err error) {
+	ctx, span := startCall(ctx, "DeleteAllOf", obj)
+	defer func() { endCall(span, err) }()
+	return c.Client.DeleteAllOf(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Status() client.SubResourceWriter {
+	return &tracingStatusWriter{SubResourceWriter: c.Client.Status()}
+}
+
+func (w *tracingStatusWriter) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) (err error) {
+	ctx, span := startCall(ctx, "CreateStatus", obj)
+	defer func() { endCall(span, err) }()
+	return w.SubResourceWriter.Create(ctx, obj, subResource, opts...)
+}
+
+func (w *tracingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) (err error) {
+	ctx, span := startCall(ctx, "UpdateStatus", obj)
+	defer func() { endCall(span, err) }()
+	return w.SubResourceWriter.Update(ctx, obj, opts...)
+}
+
+func (w *tracingStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) (err error) {
+	ctx, span := startCall(ctx, "PatchStatus", obj)
+	defer func() { endCall(span, err) }()
+	return w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+}
+
+func (r *tracingReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) (err error) {
+	ctx, span := startGet(ctx, key, obj)
+	defer func() { endCall(span, err) }()
+	return r.reader.Get(ctx, key, obj, opts...)
+}
+
+func (r *tracingReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) (err error) {
+	ctx, span := startCall(ctx, "List", list)
+	defer func() { endCall(span, err) }()
+	return r.reader.List(ctx, list, opts...)
+}
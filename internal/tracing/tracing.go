@@ -0,0 +1,158 @@
+// Package tracing exports the reconciles of TorchrunJobs as OpenTelemetry traces. Every job has
+// one trace, whose IDs derive from the UID of the job, so the spans of all its reconciles, across
+// controller restarts and replicas, join the trace under its root span.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TracerName is the instrumentation scope of the spans of the controller
+const TracerName = "github.com/dream3d/torchrun-controller"
+
+// Tracer returns the tracer of the controller. It is a no-op until Setup installed an exporter.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// Setup exports the spans of the controller over OTLP/gRPC to endpoint, e.g.
+// otel-collector.observability:4317. The OTEL_EXPORTER_OTLP_* environment variables configure
+// the exporter further. The returned function flushes the pending spans on shutdown.
+func Setup(ctx context.Context, endpoint string, insecure bool) (func(context.Context) error, error) {
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName("torchrun-controller")))
+	if err != nil {
+		return nil, err
+	}
+	provider := NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// NewTracerProvider returns a tracer provider that gives the root spans of jobs the IDs JobContext
+// refers to
+func NewTracerProvider(options ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(append(options, sdktrace.WithIDGenerator(idGenerator{}))...)
+}
+
+// GetJobTraceID returns the ID of the trace of a job
+func GetJobTraceID(uid types.UID) trace.TraceID {
+	var id trace.TraceID
+	sum := sha256.Sum256([]byte("trace/" + uid))
+	copy(id[:], sum[:])
+	return id
+}
+
+// getJobSpanID returns the ID of the root span of the trace of a job
+func getJobSpanID(uid types.UID) trace.SpanID {
+	var id trace.SpanID
+	sum := sha256.Sum256([]byte("span/" + uid))
+	copy(id[:], sum[:])
+	return id
+}
+
+// JobContext returns a context whose spans are children of the root span of the trace of a job.
+// The root span itself is only exported once the job finished, see StartJob.
+func JobContext(ctx context.Context, uid types.UID) context.Context {
+	return trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    GetJobTraceID(uid),
+		SpanID:     getJobSpanID(uid),
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	}))
+}
+
+// jobRootKey marks the context of the root span of a job for the ID generator
+type jobRootKey struct{}
+
+// StartJob starts the root span of the trace of a job at the given time. It gets the IDs that
+// JobContext refers to.
+func StartJob(ctx context.Context, uid types.UID, name string, start time.Time, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx = context.WithValue(trace.ContextWithSpanContext(ctx, trace.SpanContext{}), jobRootKey{}, uid)
+	options = append(options, trace.WithNewRoot(), trace.WithTimestamp(start))
+	return Tracer().Start(ctx, name, options...)
+}
+
+// idGenerator derives the IDs of the root span of a job from its UID and generates random IDs
+// for all other spans
+type idGenerator struct{}
+
+// NewIDs returns the IDs of a root span
+func (idGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	if uid, ok := ctx.Value(jobRootKey{}).(types.UID); ok {
+		return GetJobTraceID(uid), getJobSpanID(uid)
+	}
+	var traceID trace.TraceID
+	_, _ = rand.Read(traceID[:])
+	return traceID, newSpanID()
+}
+
+// NewSpanID returns the ID of a child span
+func (idGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	return newSpanID()
+}
+
+func newSpanID() trace.SpanID {
+	var spanID trace.SpanID
+	_, _ = rand.Read(spanID[:])
+	return spanID
+}
+
+// EndSpan ends a span, recording err as its error status
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Steps traces the consecutive steps of a function as sibling spans, each ending where the next
+// one starts
+type Steps struct {
+	ctx  context.Context
+	span trace.Span
+}
+
+// NewSteps returns the steps of the span in ctx
+func NewSteps(ctx context.Context) *Steps {
+	return &Steps{ctx: ctx}
+}
+
+// Start ends the current step and starts the next one. The returned context carries its span.
+func (s *Steps) Start(name string) context.Context {
+	s.End()
+	ctx, span := Tracer().Start(s.ctx, name)
+	s.span = span
+	return ctx
+}
+
+// End ends the current step
+func (s *Steps) End() {
+	if s.span != nil {
+		s.span.End()
+		s.span = nil
+	}
+}
@@ -0,0 +1,168 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// workspacePathPattern matches /workspaces/<namespace>/<job-id>.zip, where the job ID is a label value
+// as enforced by the TorchrunJob CRD
+var workspacePathPattern = regexp.MustCompile(`^/workspaces/([a-z0-9]([-a-z0-9]*[a-z0-9])?)/([A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?)\.zip$`)
+
+// Server serves presigned workspace archive uploads and downloads from a data directory
+type Server struct {
+	signer   *Signer
+	dataDir  string
+	maxBytes int64
+	log      logr.Logger
+}
+
+// NewServer creates a new upload server
+func NewServer(signer *Signer, dataDir string, maxBytes int64, log logr.Logger) *Server {
+	return &Server{
+		signer:   signer,
+		dataDir:  dataDir,
+		maxBytes: maxBytes,
+		log:      log,
+	}
+}
+
+// ServeHTTP handles PUT (upload), GET and HEAD (download) requests on presigned workspace URLs
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/healthz" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	match := workspacePathPattern.FindStringSubmatch(r.URL.Path)
+	if match == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// HEAD requests are authorized by GET signatures
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	if err := s.signer.Verify(method, r.URL.Path, r.URL.Query(), time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	path := filepath.Join(s.dataDir, match[1], match[3]+".zip")
+
+	switch r.Method {
+	case http.MethodPut:
+		s.handleUpload(w, r, path)
+	case http.MethodGet, http.MethodHead:
+		s.handleDownload(w, r, path)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUpload writes the request body to path, replacing it atomically once fully received
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		s.log.Error(err, "Failed to create upload directory", "path", path)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		s.log.Error(err, "Failed to create temporary upload file", "path", path)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	body := http.MaxBytesReader(w, r.Body, s.maxBytes)
+	n, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.log.Error(err, "Failed to receive upload", "path", path)
+		status := http.StatusBadRequest
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, fmt.Sprintf("upload failed: %v", err), status)
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		s.log.Error(err, "Failed to store upload", "path", path)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	s.log.Info("Stored workspace archive", "path", path, "bytes", n)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleDownload serves the archive at path
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		s.log.Error(err, "Failed to open archive", "path", path)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	http.ServeContent(w, r, filepath.Base(path), info.ModTime(), f)
+}
+
+// CleanupLoop removes archives older than retention until the context is cancelled
+func (s *Server) CleanupLoop(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cutoff := time.Now().Add(-retention)
+		err := filepath.Walk(s.dataDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			if info.ModTime().Before(cutoff) {
+				s.log.Info("Removing expired workspace archive", "path", path)
+				return os.Remove(path)
+			}
+			return nil
+		})
+		if err != nil {
+			s.log.Error(err, "Failed to clean up expired archives")
+		}
+	}
+}
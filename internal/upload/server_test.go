@@ -0,0 +1,170 @@
+package upload
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestServeHTTP(t *testing.T) {
+	dataDir := t.TempDir()
+	signer := NewSigner([]byte("test-key"))
+	server := httptest.NewServer(NewServer(signer, dataDir, 16, logr.Discard()))
+	defer server.Close()
+
+	path := WorkspacePath("default", "job-1.2")
+	expires := time.Now().Add(time.Hour)
+	archive := filepath.Join(dataDir, "default", "job-1.2.zip")
+
+	do := func(method, rawURL, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, rawURL, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("failed to build request: %v", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, rawURL, err)
+		}
+		defer resp.Body.Close()
+		return resp
+	}
+
+	tests := []struct {
+		description  string
+		method       string
+		url          string
+		body         string
+		expectStatus int
+		expectStored string
+	}{
+		{
+			description:  "upload is stored",
+			method:       http.MethodPut,
+			url:          signer.Sign(http.MethodPut, server.URL, path, expires),
+			body:         "first",
+			expectStatus: http.StatusCreated,
+			expectStored: "first",
+		},
+		{
+			description:  "upload over the size limit is rejected and keeps the previous archive",
+			method:       http.MethodPut,
+			url:          signer.Sign(http.MethodPut, server.URL, path, expires),
+			body:         strings.Repeat("x", 17),
+			expectStatus: http.StatusRequestEntityTooLarge,
+			expectStored: "first",
+		},
+		{
+			description:  "upload replaces the previous archive",
+			method:       http.MethodPut,
+			url:          signer.Sign(http.MethodPut, server.URL, path, expires),
+			body:         "second",
+			expectStatus: http.StatusCreated,
+			expectStored: "second",
+		},
+		{
+			description:  "upload with a bad signature is forbidden",
+			method:       http.MethodPut,
+			url:          strings.Replace(signer.Sign(http.MethodPut, server.URL, path, expires), "signature=", "signature=0", 1),
+			body:         "third",
+			expectStatus: http.StatusForbidden,
+			expectStored: "second",
+		},
+		{
+			description:  "upload with a download signature is forbidden",
+			method:       http.MethodPut,
+			url:          signer.Sign(http.MethodGet, server.URL, path, expires),
+			body:         "third",
+			expectStatus: http.StatusForbidden,
+			expectStored: "second",
+		},
+		{
+			description:  "expired upload URL is forbidden",
+			method:       http.MethodPut,
+			url:          signer.Sign(http.MethodPut, server.URL, path, time.Now().Add(-time.Minute)),
+			body:         "third",
+			expectStatus: http.StatusForbidden,
+			expectStored: "second",
+		},
+		{
+			description:  "HEAD is authorized by a download signature",
+			method:       http.MethodHead,
+			url:          signer.Sign(http.MethodGet, server.URL, path, expires),
+			expectStatus: http.StatusOK,
+			expectStored: "second",
+		},
+		{
+			description:  "HEAD with an upload signature is forbidden",
+			method:       http.MethodHead,
+			url:          signer.Sign(http.MethodPut, server.URL, path, expires),
+			expectStatus: http.StatusForbidden,
+			expectStored: "second",
+		},
+		{
+			description:  "unknown archive is not found",
+			method:       http.MethodGet,
+			url:          signer.Sign(http.MethodGet, server.URL, WorkspacePath("default", "missing"), expires),
+			expectStatus: http.StatusNotFound,
+			expectStored: "second",
+		},
+		{
+			description:  "path outside the workspaces tree is not found",
+			method:       http.MethodGet,
+			url:          server.URL + "/workspaces/default/..zip",
+			expectStatus: http.StatusNotFound,
+			expectStored: "second",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			resp := do(tt.method, tt.url, tt.body)
+			if resp.StatusCode != tt.expectStatus {
+				t.Errorf("expected status %d, got %d", tt.expectStatus, resp.StatusCode)
+			}
+
+			stored, err := os.ReadFile(archive)
+			if err != nil {
+				t.Fatalf("failed to read stored archive: %v", err)
+			}
+			if string(stored) != tt.expectStored {
+				t.Errorf("expected stored archive %q, got %q", tt.expectStored, string(stored))
+			}
+		})
+	}
+
+	// HEAD reports the archive size without a body, GET returns the archive
+	resp := do(http.MethodHead, signer.Sign(http.MethodGet, server.URL, path, expires), "")
+	if resp.ContentLength != int64(len("second")) {
+		t.Errorf("expected HEAD content length %d, got %d", len("second"), resp.ContentLength)
+	}
+
+	getResp, err := http.Get(signer.Sign(http.MethodGet, server.URL, path, expires))
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer getResp.Body.Close()
+	body, err := io.ReadAll(getResp.Body)
+	if err != nil {
+		t.Fatalf("failed to read GET body: %v", err)
+	}
+	if string(body) != "second" {
+		t.Errorf("expected GET body %q, got %q", "second", string(body))
+	}
+
+	// Temporary files of rejected uploads are removed
+	entries, err := os.ReadDir(filepath.Dir(archive))
+	if err != nil {
+		t.Fatalf("failed to list data directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the stored archive in the data directory, got %d entries", len(entries))
+	}
+}
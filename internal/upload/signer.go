@@ -0,0 +1,101 @@
+// Package upload implements the workspace upload server and its presigned URLs
+package upload
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// SigningKeySecretKey is the key holding the signing key in the upload Secret
+	SigningKeySecretKey = "signing-key"
+
+	// Port is the container port the upload server listens on
+	Port = 8080
+)
+
+// ServerName returns the name of the upload server Deployment and Service of a queue
+func ServerName(queueName string) string {
+	return fmt.Sprintf("%s-upload-server", queueName)
+}
+
+// SecretName returns the name of the Secret holding the signing key of a queue
+func SecretName(queueName string) string {
+	return fmt.Sprintf("%s-upload-token", queueName)
+}
+
+// StorageName returns the name of the staging PVC of a queue's upload server
+func StorageName(queueName string) string {
+	return fmt.Sprintf("%s-uploads", queueName)
+}
+
+// WorkspacePath returns the URL path of a job's workspace archive
+func WorkspacePath(namespace, jobID string) string {
+	return fmt.Sprintf("/workspaces/%s/%s.zip", namespace, jobID)
+}
+
+// Signer creates and verifies presigned URLs
+type Signer struct {
+	key []byte
+}
+
+// NewSigner creates a new signer for the given key
+func NewSigner(key []byte) *Signer {
+	return &Signer{
+		key: key,
+	}
+}
+
+// Sign returns a presigned URL for method on baseURL+path that expires at the given time
+func (s *Signer) Sign(method, baseURL, path string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	query := url.Values{
+		"expires":   []string{exp},
+		"signature": []string{s.signature(method, path, exp)},
+	}
+	return fmt.Sprintf("%s%s?%s", baseURL, path, query.Encode())
+}
+
+// Verify checks the signature and expiry of a request
+func (s *Signer) Verify(method, path string, query url.Values, now time.Time) error {
+	exp := query.Get("expires")
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expires parameter")
+	}
+	if now.Unix() > expires {
+		return fmt.Errorf("URL expired")
+	}
+
+	expected := s.signature(method, path, exp)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+// Expired returns true if the presigned URL has expired at now or cannot be parsed
+func Expired(rawURL string, now time.Time) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return true
+	}
+	expires, err := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+	if err != nil {
+		return true
+	}
+	return now.Unix() > expires
+}
+
+// signature computes the hex encoded HMAC of the request
+func (s *Signer) signature(method, path, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s\n%s\n%s", method, path, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,76 @@
+package upload
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignerVerify(t *testing.T) {
+	signer := NewSigner([]byte("test-key"))
+	now := time.Unix(1700000000, 0)
+	path := WorkspacePath("default", "job-1")
+
+	signed := signer.Sign("PUT", "http://uploads.example.com", path, now.Add(time.Hour))
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("failed to parse signed URL: %v", err)
+	}
+	if u.Path != path {
+		t.Fatalf("expected path %s, got %s", path, u.Path)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		query   url.Values
+		now     time.Time
+		wantErr bool
+	}{
+		{name: "valid", method: "PUT", path: path, query: u.Query(), now: now},
+		{name: "expired", method: "PUT", path: path, query: u.Query(), now: now.Add(2 * time.Hour), wantErr: true},
+		{name: "wrong method", method: "GET", path: path, query: u.Query(), now: now, wantErr: true},
+		{name: "wrong path", method: "PUT", path: WorkspacePath("default", "job-2"), query: u.Query(), now: now, wantErr: true},
+		{name: "missing signature", method: "PUT", path: path, query: url.Values{"expires": u.Query()["expires"]}, now: now, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := signer.Verify(tt.method, tt.path, tt.query, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	other := NewSigner([]byte("other-key"))
+	if err := other.Verify("PUT", path, u.Query(), now); err == nil {
+		t.Errorf("expected verification with a different key to fail")
+	}
+}
+
+func TestExpired(t *testing.T) {
+	signer := NewSigner([]byte("test-key"))
+	now := time.Unix(1700000000, 0)
+	signed := signer.Sign("PUT", "http://uploads.example.com", WorkspacePath("default", "job-1"), now.Add(time.Hour))
+
+	tests := []struct {
+		name string
+		url  string
+		now  time.Time
+		want bool
+	}{
+		{name: "valid", url: signed, now: now, want: false},
+		{name: "expired", url: signed, now: now.Add(2 * time.Hour), want: true},
+		{name: "missing expires", url: "http://uploads.example.com/workspaces/default/job-1.zip", now: now, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Expired(tt.url, tt.now); got != tt.want {
+				t.Errorf("Expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
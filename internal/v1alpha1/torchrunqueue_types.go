@@ -1,249 +0,0 @@
-package v1alpha1
-
-import (
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-)
-
-// JobQueueSpec defines the desired state of JobQueue
-type JobQueueSpec struct {
-	// kai-scheduler queue name this JobQueue maps to
-	Queue QueueConfig `json:"queue"`
-
-	// Distributed training configuration
-	Distributed DistributedConfig `json:"distributed,omitempty"`
-
-	// Pod template configuration
-	PodTemplateConfig PodTemplateConfig `json:"podTemplate,omitempty"`
-
-	// Workspace storage configuration
-	WorkspaceStorage WorkspaceStorageConfig `json:"workspaceStorage,omitempty"`
-
-	// Service account name
-	// +kubebuilder:default="default"
-	ServiceAccountName string `json:"serviceAccountName,omitempty"`
-
-	// Resources to be created for this queue (PVCs, ConfigMaps, Secrets, etc.)
-	Resources []ResourceTemplate `json:"resources,omitempty"`
-}
-
-// QueueConfig defines the kai-scheduler queue configuration
-type QueueConfig struct {
-	// kai-scheduler queue name this JobQueue maps to
-	Name string `json:"name"`
-
-	// kai-scheduler parent queue name this JobQueue maps to
-	// +kubebuilder:default="default"
-	ParentQueue string `json:"parentQueue,omitempty"`
-
-	// Resource quotas and limits for the queue
-	Resources QueueResources `json:"resources,omitempty"`
-}
-
-// QueueResources defines resource quotas and limits
-type QueueResources struct {
-	// CPU resource configuration
-	CPU ResourceConfig `json:"cpu,omitempty"`
-
-	// GPU resource configuration
-	GPU ResourceConfig `json:"gpu,omitempty"`
-
-	// Memory resource configuration
-	Memory ResourceConfig `json:"memory,omitempty"`
-}
-
-// ResourceConfig defines quota and limit configuration for a resource
-type ResourceConfig struct {
-	// Resource quota for the queue
-	// +kubebuilder:default=-1
-	Quota int `json:"quota,omitempty"`
-
-	// Resource limit for the queue
-	// +kubebuilder:default=-1
-	Limit int `json:"limit,omitempty"`
-
-	// Over quota weight for the queue
-	// +kubebuilder:default=1
-	OverQuotaWeight int `json:"overQuotaWeight,omitempty"`
-}
-
-// DistributedConfig defines distributed training configuration
-type DistributedConfig struct {
-	// PyTorch distributed backend
-	// +kubebuilder:validation:Enum=nccl;gloo;mpi
-	// +kubebuilder:default="nccl"
-	Backend string `json:"backend,omitempty"`
-
-	// Rendezvous backend for torchrun
-	// +kubebuilder:validation:Enum=etcd-v2;c10d;static
-	// +kubebuilder:default="c10d"
-	RdzvBackend string `json:"rdzvBackend,omitempty"`
-
-	// Rendezvous endpoint (e.g., etcd service)
-	// +kubebuilder:default="etcd.etcd-system.svc.cluster.local:2379"
-	RdzvEndpoint string `json:"rdzvEndpoint,omitempty"`
-
-	// Port for distributed training
-	// +kubebuilder:validation:Minimum=1024
-	// +kubebuilder:validation:Maximum=65535
-	// +kubebuilder:default=29500
-	Port int32 `json:"port,omitempty"`
-}
-
-// PodTemplateConfig defines the pod template for jobs
-type PodTemplateConfig struct {
-	// Metadata to be added to pod
-	Metadata PodMetadata `json:"metadata,omitempty"`
-
-	// Pod spec template - must contain a container named "trainer" as the first container
-	// The trainer container is reserved for the main training workload
-	// +kubebuilder:pruning:PreserveUnknownFields
-	// +kubebuilder:validation:Type=object
-	Spec runtime.RawExtension `json:"spec,omitempty"`
-}
-
-// WorkspaceStorage defines workspace storage configuration
-type WorkspaceStorageConfig struct {
-	// Default size of the workspace storage
-	// +kubebuilder:default="1Gi"
-	Size string `json:"size,omitempty"`
-
-	// Image to use for workspace sync
-	// +kubebuilder:default="alpine/git:latest"
-	Image string `json:"image,omitempty"`
-
-	// Image pull policy for sync image
-	// +kubebuilder:default="IfNotPresent"
-	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
-
-	// Mount path for destination workspace
-	// +kubebuilder:default="/app"
-	MountPath string `json:"mountPath,omitempty"`
-
-	// Storage class for the workspace storage
-	StorageClass string `json:"storageClass,omitempty"`
-
-	// Workspace source type
-	// +kubebuilder:validation:Enum=zip;git;s3;existing
-	// +kubebuilder:default="zip"
-	Source string `json:"source,omitempty"`
-
-	// URL for git/s3 sources
-	URL string `json:"url,omitempty"`
-}
-
-// PodMetadata defines metadata for pods
-type PodMetadata struct {
-	// Labels to add to pods
-	Labels map[string]string `json:"labels,omitempty"`
-
-	// Annotations to add to pods
-	Annotations map[string]string `json:"annotations,omitempty"`
-}
-
-// ResourceTemplate defines a Kubernetes resource to be created for the queue
-type ResourceTemplate struct {
-	// Name of the resource (will be used as-is or as a prefix)
-	Name string `json:"name"`
-
-	// NameMode defines how the name should be used
-	// +kubebuilder:validation:Enum=exact;prefix
-	// +kubebuilder:default="exact"
-	NameMode string `json:"nameMode,omitempty"`
-
-	// The resource object - can be any valid Kubernetes resource
-	// +kubebuilder:pruning:PreserveUnknownFields
-	// +kubebuilder:validation:Type=object
-	Template runtime.RawExtension `json:"template"`
-
-	// Immutable indicates if the resource should not be updated after creation
-	// +kubebuilder:default=false
-	Immutable bool `json:"immutable,omitempty"`
-}
-
-// JobQueueStatus defines the observed state of JobQueue
-type JobQueueStatus struct {
-	// Phase of the JobQueue
-	// +kubebuilder:validation:Enum=Active;Updating;Terminating
-	// +kubebuilder:default="Active"
-	Phase string `json:"phase,omitempty"`
-
-	// Last time the status was updated
-	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
-
-	// Last observed generation
-	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
-
-	// Conditions
-	Conditions []JobQueueCondition `json:"conditions,omitempty"`
-
-	// ResourcesReady indicates if all queue resources are ready
-	ResourcesReady bool `json:"resourcesReady,omitempty"`
-
-	// ResourceStatus tracks the status of each resource
-	ResourceStatuses []ResourceStatus `json:"resourceStatuses,omitempty"`
-}
-
-// JobQueueCondition describes the state of a JobQueue
-type JobQueueCondition struct {
-	// Type of condition
-	Type string `json:"type"`
-
-	// Status of the condition
-	// +kubebuilder:validation:Enum=True;False;Unknown
-	Status string `json:"status"`
-
-	// Last time the condition transitioned
-	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
-
-	// The reason for the condition's last transition
-	Reason string `json:"reason,omitempty"`
-
-	// A human-readable message about the transition
-	Message string `json:"message,omitempty"`
-}
-
-// ResourceStatus tracks the status of a queue resource
-type ResourceStatus struct {
-	// Name of the resource
-	Name string `json:"name"`
-
-	// Kind of the resource
-	Kind string `json:"kind"`
-
-	// Ready indicates if the resource is ready
-	Ready bool `json:"ready"`
-
-	// Message provides additional information
-	Message string `json:"message,omitempty"`
-}
-
-// +kubebuilder:object:root=true
-// +kubebuilder:subresource:status
-// +kubebuilder:resource:shortName=trq
-// +kubebuilder:printcolumn:name="Queue",type="string",JSONPath=".spec.queue.name"
-// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
-// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
-
-// TorchrunQueue is the Schema for the torchrunqueues API
-type TorchrunQueue struct {
-	metav1.TypeMeta   `json:",inline"`
-	metav1.ObjectMeta `json:"metadata,omitempty"`
-
-	Spec   JobQueueSpec   `json:"spec,omitempty"`
-	Status JobQueueStatus `json:"status,omitempty"`
-}
-
-// +kubebuilder:object:root=true
-
-// TorchrunQueueList contains a list of JobQueue
-type TorchrunQueueList struct {
-	metav1.TypeMeta `json:",inline"`
-	metav1.ListMeta `json:"metadata,omitempty"`
-	Items           []TorchrunQueue `json:"items"`
-}
-
-func init() {
-	SchemeBuilder.Register(&TorchrunQueue{}, &TorchrunQueueList{})
-}
@@ -1,539 +0,0 @@
-//go:build !ignore_autogenerated
-
-// Code generated by controller-gen. DO NOT EDIT.
-
-package v1alpha1
-
-import (
-	"k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-)
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *AdditionalMount) DeepCopyInto(out *AdditionalMount) {
-	*out = *in
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdditionalMount.
-func (in *AdditionalMount) DeepCopy() *AdditionalMount {
-	if in == nil {
-		return nil
-	}
-	out := new(AdditionalMount)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *DistributedConfig) DeepCopyInto(out *DistributedConfig) {
-	*out = *in
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DistributedConfig.
-func (in *DistributedConfig) DeepCopy() *DistributedConfig {
-	if in == nil {
-		return nil
-	}
-	out := new(DistributedConfig)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *JobQueueCondition) DeepCopyInto(out *JobQueueCondition) {
-	*out = *in
-	if in.LastTransitionTime != nil {
-		in, out := &in.LastTransitionTime, &out.LastTransitionTime
-		*out = (*in).DeepCopy()
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobQueueCondition.
-func (in *JobQueueCondition) DeepCopy() *JobQueueCondition {
-	if in == nil {
-		return nil
-	}
-	out := new(JobQueueCondition)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *JobQueueSpec) DeepCopyInto(out *JobQueueSpec) {
-	*out = *in
-	out.Queue = in.Queue
-	out.Distributed = in.Distributed
-	in.PodTemplateConfig.DeepCopyInto(&out.PodTemplateConfig)
-	out.WorkspaceStorage = in.WorkspaceStorage
-	if in.Resources != nil {
-		in, out := &in.Resources, &out.Resources
-		*out = make([]ResourceTemplate, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobQueueSpec.
-func (in *JobQueueSpec) DeepCopy() *JobQueueSpec {
-	if in == nil {
-		return nil
-	}
-	out := new(JobQueueSpec)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *JobQueueStatus) DeepCopyInto(out *JobQueueStatus) {
-	*out = *in
-	if in.LastUpdateTime != nil {
-		in, out := &in.LastUpdateTime, &out.LastUpdateTime
-		*out = (*in).DeepCopy()
-	}
-	if in.Conditions != nil {
-		in, out := &in.Conditions, &out.Conditions
-		*out = make([]JobQueueCondition, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-	if in.ResourceStatuses != nil {
-		in, out := &in.ResourceStatuses, &out.ResourceStatuses
-		*out = make([]ResourceStatus, len(*in))
-		copy(*out, *in)
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobQueueStatus.
-func (in *JobQueueStatus) DeepCopy() *JobQueueStatus {
-	if in == nil {
-		return nil
-	}
-	out := new(JobQueueStatus)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PodMetadata) DeepCopyInto(out *PodMetadata) {
-	*out = *in
-	if in.Labels != nil {
-		in, out := &in.Labels, &out.Labels
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
-	}
-	if in.Annotations != nil {
-		in, out := &in.Annotations, &out.Annotations
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodMetadata.
-func (in *PodMetadata) DeepCopy() *PodMetadata {
-	if in == nil {
-		return nil
-	}
-	out := new(PodMetadata)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PodTemplateConfig) DeepCopyInto(out *PodTemplateConfig) {
-	*out = *in
-	in.Metadata.DeepCopyInto(&out.Metadata)
-	in.Spec.DeepCopyInto(&out.Spec)
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodTemplateConfig.
-func (in *PodTemplateConfig) DeepCopy() *PodTemplateConfig {
-	if in == nil {
-		return nil
-	}
-	out := new(PodTemplateConfig)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *QueueConfig) DeepCopyInto(out *QueueConfig) {
-	*out = *in
-	out.Resources = in.Resources
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QueueConfig.
-func (in *QueueConfig) DeepCopy() *QueueConfig {
-	if in == nil {
-		return nil
-	}
-	out := new(QueueConfig)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *QueueResources) DeepCopyInto(out *QueueResources) {
-	*out = *in
-	out.CPU = in.CPU
-	out.GPU = in.GPU
-	out.Memory = in.Memory
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QueueResources.
-func (in *QueueResources) DeepCopy() *QueueResources {
-	if in == nil {
-		return nil
-	}
-	out := new(QueueResources)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ReliabilityConfig) DeepCopyInto(out *ReliabilityConfig) {
-	*out = *in
-	if in.TTLSecondsAfterFinished != nil {
-		in, out := &in.TTLSecondsAfterFinished, &out.TTLSecondsAfterFinished
-		*out = new(int32)
-		**out = **in
-	}
-	if in.ActiveDeadlineSeconds != nil {
-		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
-		*out = new(int64)
-		**out = **in
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReliabilityConfig.
-func (in *ReliabilityConfig) DeepCopy() *ReliabilityConfig {
-	if in == nil {
-		return nil
-	}
-	out := new(ReliabilityConfig)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ResourceConfig) DeepCopyInto(out *ResourceConfig) {
-	*out = *in
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceConfig.
-func (in *ResourceConfig) DeepCopy() *ResourceConfig {
-	if in == nil {
-		return nil
-	}
-	out := new(ResourceConfig)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ResourceStatus) DeepCopyInto(out *ResourceStatus) {
-	*out = *in
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceStatus.
-func (in *ResourceStatus) DeepCopy() *ResourceStatus {
-	if in == nil {
-		return nil
-	}
-	out := new(ResourceStatus)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ResourceTemplate) DeepCopyInto(out *ResourceTemplate) {
-	*out = *in
-	in.Template.DeepCopyInto(&out.Template)
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceTemplate.
-func (in *ResourceTemplate) DeepCopy() *ResourceTemplate {
-	if in == nil {
-		return nil
-	}
-	out := new(ResourceTemplate)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TorchrunJob) DeepCopyInto(out *TorchrunJob) {
-	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
-	in.Status.DeepCopyInto(&out.Status)
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TorchrunJob.
-func (in *TorchrunJob) DeepCopy() *TorchrunJob {
-	if in == nil {
-		return nil
-	}
-	out := new(TorchrunJob)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *TorchrunJob) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TorchrunJobCondition) DeepCopyInto(out *TorchrunJobCondition) {
-	*out = *in
-	if in.LastTransitionTime != nil {
-		in, out := &in.LastTransitionTime, &out.LastTransitionTime
-		*out = (*in).DeepCopy()
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TorchrunJobCondition.
-func (in *TorchrunJobCondition) DeepCopy() *TorchrunJobCondition {
-	if in == nil {
-		return nil
-	}
-	out := new(TorchrunJobCondition)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TorchrunJobList) DeepCopyInto(out *TorchrunJobList) {
-	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]TorchrunJob, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TorchrunJobList.
-func (in *TorchrunJobList) DeepCopy() *TorchrunJobList {
-	if in == nil {
-		return nil
-	}
-	out := new(TorchrunJobList)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *TorchrunJobList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TorchrunJobSpec) DeepCopyInto(out *TorchrunJobSpec) {
-	*out = *in
-	out.WorkspaceStorage = in.WorkspaceStorage
-	in.Reliability.DeepCopyInto(&out.Reliability)
-	if in.Env != nil {
-		in, out := &in.Env, &out.Env
-		*out = make([]v1.EnvVar, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-	if in.Volumes != nil {
-		in, out := &in.Volumes, &out.Volumes
-		*out = new(VolumeOverride)
-		(*in).DeepCopyInto(*out)
-	}
-	if in.Annotations != nil {
-		in, out := &in.Annotations, &out.Annotations
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
-	}
-	if in.Labels != nil {
-		in, out := &in.Labels, &out.Labels
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TorchrunJobSpec.
-func (in *TorchrunJobSpec) DeepCopy() *TorchrunJobSpec {
-	if in == nil {
-		return nil
-	}
-	out := new(TorchrunJobSpec)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TorchrunJobStatus) DeepCopyInto(out *TorchrunJobStatus) {
-	*out = *in
-	if in.Conditions != nil {
-		in, out := &in.Conditions, &out.Conditions
-		*out = make([]TorchrunJobCondition, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-	out.Workers = in.Workers
-	if in.StartTime != nil {
-		in, out := &in.StartTime, &out.StartTime
-		*out = (*in).DeepCopy()
-	}
-	if in.CompletionTime != nil {
-		in, out := &in.CompletionTime, &out.CompletionTime
-		*out = (*in).DeepCopy()
-	}
-	if in.LastReconcileTime != nil {
-		in, out := &in.LastReconcileTime, &out.LastReconcileTime
-		*out = (*in).DeepCopy()
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TorchrunJobStatus.
-func (in *TorchrunJobStatus) DeepCopy() *TorchrunJobStatus {
-	if in == nil {
-		return nil
-	}
-	out := new(TorchrunJobStatus)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TorchrunQueue) DeepCopyInto(out *TorchrunQueue) {
-	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
-	in.Status.DeepCopyInto(&out.Status)
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TorchrunQueue.
-func (in *TorchrunQueue) DeepCopy() *TorchrunQueue {
-	if in == nil {
-		return nil
-	}
-	out := new(TorchrunQueue)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *TorchrunQueue) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TorchrunQueueList) DeepCopyInto(out *TorchrunQueueList) {
-	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]TorchrunQueue, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TorchrunQueueList.
-func (in *TorchrunQueueList) DeepCopy() *TorchrunQueueList {
-	if in == nil {
-		return nil
-	}
-	out := new(TorchrunQueueList)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *TorchrunQueueList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *VolumeOverride) DeepCopyInto(out *VolumeOverride) {
-	*out = *in
-	if in.AdditionalMounts != nil {
-		in, out := &in.AdditionalMounts, &out.AdditionalMounts
-		*out = make([]AdditionalMount, len(*in))
-		copy(*out, *in)
-	}
-	if in.AdditionalVolumes != nil {
-		in, out := &in.AdditionalVolumes, &out.AdditionalVolumes
-		*out = make([]v1.Volume, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeOverride.
-func (in *VolumeOverride) DeepCopy() *VolumeOverride {
-	if in == nil {
-		return nil
-	}
-	out := new(VolumeOverride)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *WorkerStatus) DeepCopyInto(out *WorkerStatus) {
-	*out = *in
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkerStatus.
-func (in *WorkerStatus) DeepCopy() *WorkerStatus {
-	if in == nil {
-		return nil
-	}
-	out := new(WorkerStatus)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *WorkspaceStorageConfig) DeepCopyInto(out *WorkspaceStorageConfig) {
-	*out = *in
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceStorageConfig.
-func (in *WorkspaceStorageConfig) DeepCopy() *WorkspaceStorageConfig {
-	if in == nil {
-		return nil
-	}
-	out := new(WorkspaceStorageConfig)
-	in.DeepCopyInto(out)
-	return out
-}
@@ -1,23 +1,44 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"strings"
+	"time"
+
+	// Embed the time zone database for the schedule windows, the distroless image has none
+	_ "time/tzdata"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	torchrunv1beta1 "github.com/dream3d/torchrun-controller/api/v1beta1"
+	"github.com/dream3d/torchrun-controller/internal/config"
 	"github.com/dream3d/torchrun-controller/internal/controller"
-	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/internal/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/crds"
+	"github.com/dream3d/torchrun-controller/internal/defaultqueue"
+	"github.com/dream3d/torchrun-controller/internal/kai"
+	"github.com/dream3d/torchrun-controller/internal/shard"
+	"github.com/dream3d/torchrun-controller/internal/tracing"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -28,20 +49,129 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	// The kai-scheduler Queue version is detected from its CRD
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 
 	utilruntime.Must(torchrunv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(torchrunv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var leaderElectionID string
+	var leaderElectionNamespace string
+	var leaseDuration time.Duration
+	var renewDeadline time.Duration
+	var retryPeriod time.Duration
+	var releaseOnCancel bool
+	var gracefulShutdownTimeout time.Duration
 	var probeAddr string
+	var sidecarMode string
+	var enableWebhooks bool
+	var webhookPort int
+	var webhookCertDir string
+	var watchNamespaces string
+	var queueShard string
+	var jobConcurrency int
+	var queueConcurrency int
+	var rateLimits controller.ReconcilerOptions
+	var workspaceRetention time.Duration
+	var workspaceGCInterval time.Duration
+	var requireKaiScheduler bool
+	var configMapName string
+	var configMapNamespace string
+	var installCRDs bool
+	var crdConversionService string
+	var renderAddr string
+	var progressAddr string
+	var progressURL string
+	var otlpEndpoint string
+	var otlpInsecure bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&leaderElectionID, "leader-election-id", "torchrun.ai",
+		"The name of the Lease the controller replicas elect their leader with.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "",
+		"The namespace of the leader election Lease. Empty uses the namespace the controller runs in.")
+	flag.DurationVar(&leaseDuration, "leader-election-lease-duration", 15*time.Second,
+		"How long standby replicas wait before taking over the lease of a leader that stopped renewing it.")
+	flag.DurationVar(&renewDeadline, "leader-election-renew-deadline", 10*time.Second,
+		"How long the leader retries renewing its lease before it stops leading and exits.")
+	flag.DurationVar(&retryPeriod, "leader-election-retry-period", 2*time.Second,
+		"How often the replicas try to acquire or renew the lease.")
+	flag.BoolVar(&releaseOnCancel, "leader-election-release-on-cancel", true,
+		"Release the lease when the leader shuts down, so a standby replica takes over without "+
+			"waiting for the lease to expire.")
+	flag.DurationVar(&gracefulShutdownTimeout, "graceful-shutdown-timeout", 30*time.Second,
+		"How long in-flight reconciles may run after a shutdown signal before the controller exits. "+
+			"Keep it below the terminationGracePeriodSeconds of the controller pod.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve the CRD conversion webhook, the TorchrunJob defaulting webhook and the TorchrunQueue "+
+			"validating webhook. Requires serving "+
+			"certificates in the webhook cert directory.")
+	flag.IntVar(&webhookPort, "webhook-port", 9443, "The port the webhook server listens on.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs",
+		"The directory holding the tls.crt and tls.key of the webhook server.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma-separated namespaces the controller watches and caches. Empty watches all namespaces.")
+	flag.StringVar(&queueShard, "queue-shard", "",
+		"Label selector of the TorchrunQueues this controller reconciles, together with their jobs, e.g. torchrun.ai/shard=a. "+
+			"Empty reconciles all queues. Deployments sharding the queues need distinct --leader-election-id values.")
+	flag.IntVar(&jobConcurrency, "job-max-concurrent-reconciles", 1,
+		"The number of TorchrunJobs reconciled in parallel.")
+	flag.IntVar(&queueConcurrency, "queue-max-concurrent-reconciles", 1,
+		"The number of TorchrunQueues reconciled in parallel.")
+	flag.DurationVar(&rateLimits.RateLimiterBaseDelay, "rate-limiter-base-delay", 5*time.Millisecond,
+		"The initial requeue delay of an object whose reconcile failed, doubled on every failure.")
+	flag.DurationVar(&rateLimits.RateLimiterMaxDelay, "rate-limiter-max-delay", 1000*time.Second,
+		"The maximum requeue delay of an object whose reconcile failed.")
+	flag.Float64Var(&rateLimits.RateLimiterQPS, "rate-limiter-qps", 10,
+		"The overall requeue rate of each controller, in objects per second.")
+	flag.IntVar(&rateLimits.RateLimiterBurst, "rate-limiter-burst", 100,
+		"The requeue burst allowed above --rate-limiter-qps.")
+	flag.StringVar(&sidecarMode, "sidecar-mode", "auto",
+		"How sidecar containers are stopped when the trainer exits: "+
+			"native (restartPolicy: Always init containers), wrapper (shared process namespace), "+
+			"or auto to detect native sidecar support from the server version.")
+	flag.DurationVar(&workspaceRetention, "workspace-retention", 0,
+		"How long the workspace PVCs of Succeeded and Failed jobs are kept. "+
+			"0 keeps them until the TorchrunJob is deleted.")
+	flag.DurationVar(&workspaceGCInterval, "workspace-gc-interval", 10*time.Minute,
+		"How often finished jobs are checked for expired workspaces.")
+	flag.BoolVar(&requireKaiScheduler, "require-kai-scheduler", true,
+		"Report the controller not ready while the kai-scheduler Queue CRD is not served. "+
+			"Disable on clusters whose queues all use another scheduler.")
+	flag.StringVar(&configMapName, "config-map", "",
+		"The ConfigMap holding the operator config in its "+config.ConfigKey+" key, reloaded when it changes. "+
+			"Empty uses the built-in defaults and the flags.")
+	flag.StringVar(&configMapNamespace, "config-map-namespace", os.Getenv("POD_NAMESPACE"),
+		"The namespace of the operator config ConfigMap. Defaults to the POD_NAMESPACE environment variable.")
+	flag.BoolVar(&installCRDs, "install-crds", false,
+		"Apply the CRDs embedded in the binary with server-side apply at startup and wait until they are established, "+
+			"keeping them in sync with the controller version on clusters without Helm or kustomize.")
+	flag.StringVar(&crdConversionService, "crd-conversion-service", "",
+		"The namespace/name of the Service of the conversion webhook in the CRDs applied by --install-crds. "+
+			"Empty keeps torchrun-system/torchrun-webhook-service of the kustomize install.")
+	flag.StringVar(&renderAddr, "render-bind-address", "",
+		"The address the render endpoint binds to, e.g. 127.0.0.1:8082. It renders the Job and sync pod of a "+
+			"TorchrunJob without creating them. The endpoint does not authenticate its callers, so only loopback "+
+			"addresses are accepted and it is reached through kubectl port-forward. Empty disables it.")
+	flag.StringVar(&progressAddr, "progress-bind-address", "",
+		"The address the progress endpoint binds to, e.g. :8084. The training scripts post their step, epoch "+
+			"and loss to it, which is shown in the status of their TorchrunJob. Empty disables it.")
+	flag.StringVar(&progressURL, "progress-url", "",
+		"The URL of the progress endpoint the workers are given in TORCHRUN_PROGRESS_URL, e.g. "+
+			"http://torchrun-progress.torchrun-system.svc:8084/progress. Empty leaves the variable unset.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "",
+		"The OTLP/gRPC endpoint the traces of TorchrunJobs are exported to, e.g. otel-collector:4317. "+
+			"Empty disables tracing.")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false,
+		"Export the traces to --otlp-endpoint without TLS.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -50,45 +180,277 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	// client-go only checks the timings once the election starts, after the caches synced
+	if enableLeaderElection && (renewDeadline >= leaseDuration || retryPeriod >= renewDeadline) {
+		setupLog.Info("invalid leader election timings, expected retry period < renew deadline < lease duration",
+			"leaseDuration", leaseDuration, "renewDeadline", renewDeadline, "retryPeriod", retryPeriod)
+		os.Exit(1)
+	}
+
+	shardSelector, err := shard.Parse(queueShard)
+	if err != nil {
+		setupLog.Error(err, "invalid --queue-shard")
+		os.Exit(1)
+	}
+	if shardSelector != nil {
+		setupLog.Info("reconciling the queues of shard", "queueShard", queueShard)
+	}
+	rateLimits.QueueShard = shardSelector
+
+	cfg := ctrl.GetConfigOrDie()
+
+	// The CRDs must be served before the caches of the manager start
+	if installCRDs {
+		if err := crds.Install(ctrl.LoggerInto(context.Background(), setupLog), cfg, crdConversionService); err != nil {
+			setupLog.Error(err, "unable to install CRDs")
+			os.Exit(1)
+		}
+		setupLog.Info("installed CRDs")
+	}
+
+	var nativeSidecars bool
+	switch sidecarMode {
+	case "native":
+		nativeSidecars = true
+	case "wrapper":
+		nativeSidecars = false
+	case "auto":
+		supported, err := controller.SupportsNativeSidecars(cfg)
+		if err != nil {
+			// The wrapper works on every Kubernetes version, so it is the safe choice
+			setupLog.Error(err, "unable to detect native sidecar support, falling back to wrapper mode")
+		}
+		nativeSidecars = supported
+	default:
+		setupLog.Info("invalid --sidecar-mode, expected auto, native or wrapper", "sidecarMode", sidecarMode)
+		os.Exit(1)
+	}
+	setupLog.Info("sidecar lifecycle", "nativeSidecars", nativeSidecars)
+
+	// The flags are the base of the operator config, the ConfigMap overrides them
+	baseConfig := config.Default()
+	baseConfig.WorkspaceGC.Retention.Duration = workspaceRetention
+	baseConfig.WorkspaceGC.Interval.Duration = workspaceGCInterval
+	baseConfig.ProgressURL = progressURL
+	if err := baseConfig.Validate(); err != nil {
+		setupLog.Error(err, "invalid flags")
+		os.Exit(1)
+	}
+	operatorConfig := config.NewStore(baseConfig)
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		setupLog.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+	var configWatcher *config.Watcher
+	if configMapName != "" {
+		if configMapNamespace == "" {
+			setupLog.Info("--config-map requires --config-map-namespace or the POD_NAMESPACE environment variable")
+			os.Exit(1)
+		}
+		configWatcher = &config.Watcher{
+			Clientset: clientset,
+			Store:     operatorConfig,
+			Namespace: configMapNamespace,
+			Name:      configMapName,
+		}
+		// A broken config fails the rollout instead of running with unexpected defaults
+		if err := configWatcher.LoadInitial(context.Background()); err != nil {
+			setupLog.Error(err, "unable to load operator config")
+			os.Exit(1)
+		}
+	}
+
+	// Restricting the cache to a few namespaces keeps memory bounded on large clusters
+	var cacheOptions cache.Options
+	if watchNamespaces != "" {
+		cacheOptions.DefaultNamespaces = map[string]cache.Config{}
+		for _, namespace := range strings.Split(watchNamespaces, ",") {
+			if namespace = strings.TrimSpace(namespace); namespace != "" {
+				cacheOptions.DefaultNamespaces[namespace] = cache.Config{}
+			}
+		}
+		setupLog.Info("restricting the cache to namespaces", "namespaces", watchNamespaces)
+	}
+
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
 		Scheme: scheme,
+		Cache:  cacheOptions,
+		// PersistentVolumes are cluster-scoped and only read for data locality, so they are read
+		// from the API server instead of watched cluster-wide, which takes get on them only
+		Client: client.Options{Cache: &client.CacheOptions{DisableFor: []client.Object{&corev1.PersistentVolume{}}}},
 		Metrics: metricsserver.Options{
 			BindAddress: metricsAddr,
 		},
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "torchrun.ai",
+		LeaderElectionID:       leaderElectionID,
+		// Reconcilers keep no state between reconciles, so a new leader resumes from the cluster
+		// state alone and releasing the lease early is safe
+		LeaderElectionNamespace:       leaderElectionNamespace,
+		LeaderElectionReleaseOnCancel: releaseOnCancel,
+		LeaseDuration:                 &leaseDuration,
+		RenewDeadline:                 &renewDeadline,
+		RetryPeriod:                   &retryPeriod,
+		GracefulShutdownTimeout:       &gracefulShutdownTimeout,
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    webhookPort,
+			CertDir: webhookCertDir,
+		}),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	// The traces of the jobs include the API calls of their reconciles
+	jobClient, jobReader := mgr.GetClient(), mgr.GetAPIReader()
+	if otlpEndpoint != "" {
+		shutdownTracing, err := tracing.Setup(context.Background(), otlpEndpoint, otlpInsecure)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				setupLog.Error(err, "unable to flush traces")
+			}
+		}()
+		jobClient, jobReader = tracing.WrapClient(jobClient), tracing.WrapReader(jobReader)
+		setupLog.Info("exporting traces", "endpoint", otlpEndpoint)
+	}
+
+	jobOptions := rateLimits
+	jobOptions.MaxConcurrentReconciles = jobConcurrency
+	queueOptions := rateLimits
+	queueOptions.MaxConcurrentReconciles = queueConcurrency
+
 	if err = controller.NewTorchrunJobReconciler(
-		mgr.GetClient(),
+		jobClient,
+		jobReader,
+		clientset,
 		mgr.GetScheme(),
+		nativeSidecars,
+		jobOptions,
+		operatorConfig,
 	).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "TorchrunJob")
 		os.Exit(1)
 	}
 
+	// Queues of kai-scheduler fail to reconcile until its CRD is installed in a supported version
+	kaiQueues := kai.NewClient(mgr.GetClient(), mgr.GetAPIReader())
+	if version, err := kaiQueues.Version(context.Background()); err != nil {
+		setupLog.Info("kai-scheduler Queues are not available", "reason", err.Error())
+	} else {
+		setupLog.Info("detected kai-scheduler Queues", "version", kai.Group+"/"+version)
+	}
+
 	if err = controller.NewJobQueueReconciler(
 		mgr.GetClient(),
+		mgr.GetAPIReader(),
 		mgr.GetScheme(),
+		queueOptions,
+		operatorConfig,
+		kaiQueues,
 	).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "JobQueue")
 		os.Exit(1)
 	}
+	// The collector runs even without a retention, so the operator config can enable it
+	if err = mgr.Add(controller.NewWorkspaceGarbageCollector(
+		mgr.GetClient(),
+		shardSelector,
+		operatorConfig,
+	)); err != nil {
+		setupLog.Error(err, "unable to add workspace garbage collector")
+		os.Exit(1)
+	}
+	if configWatcher != nil {
+		if err = mgr.Add(configWatcher); err != nil {
+			setupLog.Error(err, "unable to add operator config watcher")
+			os.Exit(1)
+		}
+	}
+	if enableWebhooks {
+		// Default queues are read from the API server, the cache may not cover the job's namespace
+		if err = ctrl.NewWebhookManagedBy(mgr).For(&torchrunv1alpha1.TorchrunJob{}).
+			WithDefaulter(&defaultqueue.Defaulter{Reader: mgr.GetAPIReader()}).Complete(); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "TorchrunJob")
+			os.Exit(1)
+		}
+		if err = ctrl.NewWebhookManagedBy(mgr).For(&torchrunv1alpha1.TorchrunQueue{}).
+			WithValidator(controller.NewQueueValidator(operatorConfig)).Complete(); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "TorchrunQueue")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
-	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up health check")
+	if renderAddr != "" {
+		// Jobs are rendered from the API server, the cache may not cover their namespace
+		renderClient, err := client.New(cfg, client.Options{Scheme: scheme})
+		if err != nil {
+			setupLog.Error(err, "unable to create render client")
+			os.Exit(1)
+		}
+		renderServer, err := controller.NewRenderServer(renderAddr, renderClient, nativeSidecars, operatorConfig)
+		if err != nil {
+			setupLog.Error(err, "invalid --render-bind-address")
+			os.Exit(1)
+		}
+		if err := mgr.Add(renderServer); err != nil {
+			setupLog.Error(err, "unable to add render server")
+			os.Exit(1)
+		}
+	}
+
+	if progressAddr != "" {
+		if err := controller.NewProgressServer(progressAddr, mgr.GetClient()).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to add progress server")
+			os.Exit(1)
+		}
+	}
+
+	if err := mgr.Add(controller.NewLeaderStatus(mgr.Elected())); err != nil {
+		setupLog.Error(err, "unable to add leader status")
 		os.Exit(1)
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up ready check")
+
+	// Probes pass on standby replicas too, so a rollout never waits for the leader lease.
+	// Liveness only checks the API server; missing CRDs are fixed by an install, not a restart.
+	probeConfig := rest.CopyConfig(cfg)
+	probeConfig.Timeout = 5 * time.Second
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(probeConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to create discovery client")
 		os.Exit(1)
 	}
+	healthChecks := controller.NewHealthChecks(discoveryClient)
+	for name, check := range map[string]healthz.Checker{
+		"ping": healthz.Ping,
+		"api":  healthChecks.APIServer,
+	} {
+		if err := mgr.AddHealthzCheck(name, check); err != nil {
+			setupLog.Error(err, "unable to set up health check", "check", name)
+			os.Exit(1)
+		}
+	}
+	readyChecks := map[string]healthz.Checker{
+		"api":  healthChecks.APIServer,
+		"crds": healthChecks.CRDs,
+	}
+	if requireKaiScheduler {
+		readyChecks["kai-scheduler"] = healthChecks.KaiScheduler
+	}
+	for name, check := range readyChecks {
+		if err := mgr.AddReadyzCheck(name, check); err != nil {
+			setupLog.Error(err, "unable to set up ready check", "check", name)
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
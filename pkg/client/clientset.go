@@ -0,0 +1,236 @@
+// Package client is a typed client of the torchrun.ai API for workflow engines and Go services
+// that submit TorchrunJobs and wait for them without shelling out to kubectl.
+//
+//	clientset, err := client.NewForConfig(config)
+//	job, err = clientset.TorchrunJobs("research").Create(ctx, job, metav1.CreateOptions{})
+//	job, err = client.WaitForCompletion(ctx, clientset.TorchrunJobs("research"), job.Name)
+package client
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// Scheme holds the torchrun.ai types served by the clientset
+var Scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(torchrunv1alpha1.AddToScheme(Scheme))
+}
+
+// Interface is the typed client of the torchrun.ai API
+type Interface interface {
+	TorchrunJobs(namespace string) TorchrunJobInterface
+	TorchrunJobRecords(namespace string) TorchrunJobRecordInterface
+	TorchrunQueues(namespace string) TorchrunQueueInterface
+}
+
+// TorchrunJobInterface reads and writes the TorchrunJobs of a namespace
+type TorchrunJobInterface interface {
+	Create(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, opts metav1.CreateOptions) (*torchrunv1alpha1.TorchrunJob, error)
+	Update(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, opts metav1.UpdateOptions) (*torchrunv1alpha1.TorchrunJob, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*torchrunv1alpha1.TorchrunJob, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*torchrunv1alpha1.TorchrunJobList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+}
+
+// TorchrunJobRecordInterface reads the TorchrunJobRecords of a namespace
+type TorchrunJobRecordInterface interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*torchrunv1alpha1.TorchrunJobRecord, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*torchrunv1alpha1.TorchrunJobRecordList, error)
+}
+
+// TorchrunQueueInterface reads the TorchrunQueues of a namespace
+type TorchrunQueueInterface interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*torchrunv1alpha1.TorchrunQueue, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*torchrunv1alpha1.TorchrunQueueList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+}
+
+// Clientset implements Interface on a controller-runtime client
+type Clientset struct {
+	client crclient.WithWatch
+}
+
+var _ Interface = &Clientset{}
+
+// NewForConfig creates a clientset talking to the API server of config
+func NewForConfig(config *rest.Config) (*Clientset, error) {
+	c, err := crclient.NewWithWatch(config, crclient.Options{Scheme: Scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create torchrun client: %w", err)
+	}
+	return New(c), nil
+}
+
+// New creates a clientset on an existing client, whose scheme must include the torchrun.ai types
+func New(c crclient.WithWatch) *Clientset {
+	return &Clientset{client: c}
+}
+
+// TorchrunJobs returns the client of the TorchrunJobs of a namespace
+func (c *Clientset) TorchrunJobs(namespace string) TorchrunJobInterface {
+	return &torchrunJobs{client: c.client, namespace: namespace}
+}
+
+// TorchrunJobRecords returns the client of the TorchrunJobRecords of a namespace
+func (c *Clientset) TorchrunJobRecords(namespace string) TorchrunJobRecordInterface {
+	return &torchrunJobRecords{client: c.client, namespace: namespace}
+}
+
+// TorchrunQueues returns the client of the TorchrunQueues of a namespace
+func (c *Clientset) TorchrunQueues(namespace string) TorchrunQueueInterface {
+	return &torchrunQueues{client: c.client, namespace: namespace}
+}
+
+type torchrunJobs struct {
+	client    crclient.WithWatch
+	namespace string
+}
+
+func (c *torchrunJobs) Create(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, opts metav1.CreateOptions) (*torchrunv1alpha1.TorchrunJob, error) {
+	result := job.DeepCopy()
+	result.Namespace = c.namespace
+	if err := c.client.Create(ctx, result, &crclient.CreateOptions{Raw: &opts}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *torchrunJobs) Update(ctx context.Context, job *torchrunv1alpha1.TorchrunJob, opts metav1.UpdateOptions) (*torchrunv1alpha1.TorchrunJob, error) {
+	result := job.DeepCopy()
+	result.Namespace = c.namespace
+	if err := c.client.Update(ctx, result, &crclient.UpdateOptions{Raw: &opts}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *torchrunJobs) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	job := &torchrunv1alpha1.TorchrunJob{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: c.namespace}}
+	return c.client.Delete(ctx, job, &crclient.DeleteOptions{Raw: &opts})
+}
+
+func (c *torchrunJobs) Get(ctx context.Context, name string, opts metav1.GetOptions) (*torchrunv1alpha1.TorchrunJob, error) {
+	job := &torchrunv1alpha1.TorchrunJob{}
+	if err := c.client.Get(ctx, crclient.ObjectKey{Name: name, Namespace: c.namespace}, job, &crclient.GetOptions{Raw: &opts}); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (c *torchrunJobs) List(ctx context.Context, opts metav1.ListOptions) (*torchrunv1alpha1.TorchrunJobList, error) {
+	listOptions, err := toListOptions(c.namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	jobs := &torchrunv1alpha1.TorchrunJobList{}
+	if err := c.client.List(ctx, jobs, listOptions); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (c *torchrunJobs) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	listOptions, err := toListOptions(c.namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Watch(ctx, &torchrunv1alpha1.TorchrunJobList{}, listOptions)
+}
+
+type torchrunJobRecords struct {
+	client    crclient.WithWatch
+	namespace string
+}
+
+func (c *torchrunJobRecords) Get(ctx context.Context, name string, opts metav1.GetOptions) (*torchrunv1alpha1.TorchrunJobRecord, error) {
+	record := &torchrunv1alpha1.TorchrunJobRecord{}
+	if err := c.client.Get(ctx, crclient.ObjectKey{Name: name, Namespace: c.namespace}, record, &crclient.GetOptions{Raw: &opts}); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (c *torchrunJobRecords) List(ctx context.Context, opts metav1.ListOptions) (*torchrunv1alpha1.TorchrunJobRecordList, error) {
+	listOptions, err := toListOptions(c.namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	records := &torchrunv1alpha1.TorchrunJobRecordList{}
+	if err := c.client.List(ctx, records, listOptions); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+type torchrunQueues struct {
+	client    crclient.WithWatch
+	namespace string
+}
+
+func (c *torchrunQueues) Get(ctx context.Context, name string, opts metav1.GetOptions) (*torchrunv1alpha1.TorchrunQueue, error) {
+	queue := &torchrunv1alpha1.TorchrunQueue{}
+	if err := c.client.Get(ctx, crclient.ObjectKey{Name: name, Namespace: c.namespace}, queue, &crclient.GetOptions{Raw: &opts}); err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+func (c *torchrunQueues) List(ctx context.Context, opts metav1.ListOptions) (*torchrunv1alpha1.TorchrunQueueList, error) {
+	listOptions, err := toListOptions(c.namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	queues := &torchrunv1alpha1.TorchrunQueueList{}
+	if err := c.client.List(ctx, queues, listOptions); err != nil {
+		return nil, err
+	}
+	return queues, nil
+}
+
+func (c *torchrunQueues) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	listOptions, err := toListOptions(c.namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Watch(ctx, &torchrunv1alpha1.TorchrunQueueList{}, listOptions)
+}
+
+// toListOptions converts API list options to controller-runtime ones. The selectors are parsed
+// so they also apply to clients filtering on the client side, like the fake client.
+func toListOptions(namespace string, opts metav1.ListOptions) (*crclient.ListOptions, error) {
+	listOptions := &crclient.ListOptions{
+		Namespace: namespace,
+		Limit:     opts.Limit,
+		Continue:  opts.Continue,
+		Raw:       &opts,
+	}
+	if opts.LabelSelector != "" {
+		selector, err := labels.Parse(opts.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector %q: %w", opts.LabelSelector, err)
+		}
+		listOptions.LabelSelector = selector
+	}
+	if opts.FieldSelector != "" {
+		selector, err := fields.ParseSelector(opts.FieldSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field selector %q: %w", opts.FieldSelector, err)
+		}
+		listOptions.FieldSelector = selector
+	}
+	return listOptions, nil
+}
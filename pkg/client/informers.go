@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// NewTorchrunJobInformer returns a shared informer of the TorchrunJobs of a namespace, or of all
+// namespaces for metav1.NamespaceAll. Pass cache.Indexers{cache.NamespaceIndex:
+// cache.MetaNamespaceIndexFunc} to list the jobs of a namespace with a lister of all namespaces.
+func NewTorchrunJobInformer(c Interface, namespace string, resync time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return c.TorchrunJobs(namespace).List(context.Background(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return c.TorchrunJobs(namespace).Watch(context.Background(), options)
+		},
+	}, &torchrunv1alpha1.TorchrunJob{}, resync, indexers)
+}
+
+// NewTorchrunQueueInformer returns a shared informer of the TorchrunQueues of a namespace, or of
+// all namespaces for metav1.NamespaceAll
+func NewTorchrunQueueInformer(c Interface, namespace string, resync time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return c.TorchrunQueues(namespace).List(context.Background(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return c.TorchrunQueues(namespace).Watch(context.Background(), options)
+		},
+	}, &torchrunv1alpha1.TorchrunQueue{}, resync, indexers)
+}
+
+// TorchrunJobLister reads TorchrunJobs from the store of an informer
+type TorchrunJobLister struct {
+	indexer cache.Indexer
+}
+
+// NewTorchrunJobLister creates a lister of the store of a TorchrunJob informer
+func NewTorchrunJobLister(indexer cache.Indexer) *TorchrunJobLister {
+	return &TorchrunJobLister{indexer: indexer}
+}
+
+// List returns the jobs of a namespace, or of all namespaces for metav1.NamespaceAll, matching
+// the selector
+func (l *TorchrunJobLister) List(namespace string, selector labels.Selector) ([]*torchrunv1alpha1.TorchrunJob, error) {
+	var jobs []*torchrunv1alpha1.TorchrunJob
+	appendJob := func(obj interface{}) {
+		jobs = append(jobs, obj.(*torchrunv1alpha1.TorchrunJob))
+	}
+	if namespace == metav1.NamespaceAll {
+		return jobs, cache.ListAll(l.indexer, selector, appendJob)
+	}
+	return jobs, cache.ListAllByNamespace(l.indexer, namespace, selector, appendJob)
+}
+
+// Get returns a job of the store
+func (l *TorchrunJobLister) Get(namespace, name string) (*torchrunv1alpha1.TorchrunJob, error) {
+	obj, exists, err := l.indexer.GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(torchrunv1alpha1.GroupVersion.WithResource("torchrunjobs").GroupResource(), name)
+	}
+	return obj.(*torchrunv1alpha1.TorchrunJob), nil
+}
+
+// TorchrunQueueLister reads TorchrunQueues from the store of an informer
+type TorchrunQueueLister struct {
+	indexer cache.Indexer
+}
+
+// NewTorchrunQueueLister creates a lister of the store of a TorchrunQueue informer
+func NewTorchrunQueueLister(indexer cache.Indexer) *TorchrunQueueLister {
+	return &TorchrunQueueLister{indexer: indexer}
+}
+
+// List returns the queues of a namespace, or of all namespaces for metav1.NamespaceAll,
+// matching the selector
+func (l *TorchrunQueueLister) List(namespace string, selector labels.Selector) ([]*torchrunv1alpha1.TorchrunQueue, error) {
+	var queues []*torchrunv1alpha1.TorchrunQueue
+	appendQueue := func(obj interface{}) {
+		queues = append(queues, obj.(*torchrunv1alpha1.TorchrunQueue))
+	}
+	if namespace == metav1.NamespaceAll {
+		return queues, cache.ListAll(l.indexer, selector, appendQueue)
+	}
+	return queues, cache.ListAllByNamespace(l.indexer, namespace, selector, appendQueue)
+}
+
+// Get returns a queue of the store
+func (l *TorchrunQueueLister) Get(namespace, name string) (*torchrunv1alpha1.TorchrunQueue, error) {
+	obj, exists, err := l.indexer.GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(torchrunv1alpha1.GroupVersion.WithResource("torchrunqueues").GroupResource(), name)
+	}
+	return obj.(*torchrunv1alpha1.TorchrunQueue), nil
+}
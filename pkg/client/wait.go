@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// IsFinished returns true if the job reached a phase it never leaves
+func IsFinished(job *torchrunv1alpha1.TorchrunJob) bool {
+	switch job.Status.Phase {
+	case torchrunv1alpha1.PhaseSucceeded, torchrunv1alpha1.PhaseFailed, torchrunv1alpha1.PhaseTimedOut, torchrunv1alpha1.PhaseDeleted:
+		return true
+	}
+	return false
+}
+
+// WaitForCompletion blocks until a TorchrunJob finished and returns it. The phase of the returned
+// job tells whether it succeeded; an error means the wait failed, the job was deleted, or ctx is
+// done. The wait survives watch timeouts and API server restarts.
+func WaitForCompletion(ctx context.Context, jobs TorchrunJobInterface, name string) (*torchrunv1alpha1.TorchrunJob, error) {
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return jobs.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return jobs.Watch(ctx, options)
+		},
+	}
+
+	var finished *torchrunv1alpha1.TorchrunJob
+	// The store holds the job only, check it exists and whether it already finished
+	precondition := func(store cache.Store) (bool, error) {
+		for _, obj := range store.List() {
+			job := obj.(*torchrunv1alpha1.TorchrunJob)
+			if job.Name != name {
+				continue
+			}
+			if IsFinished(job) {
+				finished = job
+				return true, nil
+			}
+			return false, nil
+		}
+		return false, errors.NewNotFound(torchrunv1alpha1.GroupVersion.WithResource("torchrunjobs").GroupResource(), name)
+	}
+	condition := func(event watch.Event) (bool, error) {
+		job, ok := event.Object.(*torchrunv1alpha1.TorchrunJob)
+		if !ok || job.Name != name {
+			return false, nil
+		}
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("TorchrunJob %s was deleted before it finished", name)
+		}
+		if IsFinished(job) {
+			finished = job
+			return true, nil
+		}
+		return false, nil
+	}
+
+	if _, err := watchtools.UntilWithSync(ctx, listWatch, &torchrunv1alpha1.TorchrunJob{}, precondition, condition); err != nil {
+		return nil, fmt.Errorf("failed waiting for TorchrunJob %s: %w", name, err)
+	}
+	return finished, nil
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+)
+
+// newFakeClient builds a fake client serving the field selector of WaitForCompletion
+func newFakeClient(objects ...crclient.Object) crclient.WithWatch {
+	return fake.NewClientBuilder().WithScheme(Scheme).WithObjects(objects...).
+		WithIndex(&torchrunv1alpha1.TorchrunJob{}, "metadata.name", func(obj crclient.Object) []string {
+			return []string{obj.GetName()}
+		}).Build()
+}
+
+func TestWaitForCompletion(t *testing.T) {
+	trainingJob := func(name, phase string) *torchrunv1alpha1.TorchrunJob {
+		return &torchrunv1alpha1.TorchrunJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "research"},
+			Status:     torchrunv1alpha1.TorchrunJobStatus{Phase: phase},
+		}
+	}
+
+	tests := []struct {
+		description string
+		existing    []crclient.Object
+		finishWith  string
+		expectPhase string
+		expectError bool
+	}{
+		{
+			description: "finished job returns at once",
+			existing:    []crclient.Object{trainingJob("train", torchrunv1alpha1.PhaseFailed)},
+			expectPhase: torchrunv1alpha1.PhaseFailed,
+		},
+		{
+			description: "running job returns once it finished",
+			existing: []crclient.Object{
+				trainingJob("train", torchrunv1alpha1.PhaseRunning),
+				trainingJob("other", torchrunv1alpha1.PhaseSucceeded),
+			},
+			finishWith:  torchrunv1alpha1.PhaseSucceeded,
+			expectPhase: torchrunv1alpha1.PhaseSucceeded,
+		},
+		{
+			description: "missing job is an error",
+			existing:    []crclient.Object{trainingJob("other", torchrunv1alpha1.PhaseRunning)},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		c := newFakeClient(test.existing...)
+		jobs := New(c).TorchrunJobs("research")
+
+		if test.finishWith != "" {
+			go func(phase string) {
+				// Finish the job once the wait watches it
+				time.Sleep(100 * time.Millisecond)
+				job, err := jobs.Get(ctx, "train", metav1.GetOptions{})
+				if err != nil {
+					t.Errorf("Get() error = %v", err)
+					return
+				}
+				job.Status.Phase = torchrunv1alpha1.PhaseRunning
+				job.Status.WorkersStatus = "1/1 running"
+				if job, err = jobs.Update(ctx, job, metav1.UpdateOptions{}); err != nil {
+					t.Errorf("Update() error = %v", err)
+					return
+				}
+				job.Status.Phase = phase
+				if _, err := jobs.Update(ctx, job, metav1.UpdateOptions{}); err != nil {
+					t.Errorf("Update() error = %v", err)
+				}
+			}(test.finishWith)
+		}
+
+		job, err := WaitForCompletion(ctx, jobs, "train")
+		cancel()
+		if test.expectError {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.description)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: WaitForCompletion() error = %v", test.description, err)
+		}
+		if job.Name != "train" || job.Status.Phase != test.expectPhase {
+			t.Errorf("%s: expected job train in phase %s, got %s in %s", test.description, test.expectPhase, job.Name, job.Status.Phase)
+		}
+	}
+}
+
+func TestWaitForCompletionDeleted(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c := newFakeClient(&torchrunv1alpha1.TorchrunJob{ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "research"}})
+	jobs := New(c).TorchrunJobs("research")
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		if err := jobs.Delete(ctx, "train", metav1.DeleteOptions{}); err != nil {
+			t.Errorf("Delete() error = %v", err)
+		}
+	}()
+	if _, err := WaitForCompletion(ctx, jobs, "train"); err == nil || ctx.Err() != nil {
+		t.Errorf("expected an error for a deleted job, got %v", err)
+	}
+}
+
+func TestTorchrunJobs(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient()
+	jobs := New(c).TorchrunJobs("research")
+
+	job := &torchrunv1alpha1.TorchrunJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "train", Labels: map[string]string{"team": "vision"}},
+		Spec:       torchrunv1alpha1.TorchrunJobSpec{Queue: "research", NumNodes: 2},
+	}
+	created, err := jobs.Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if created.Namespace != "research" || created.ResourceVersion == "" || job.Namespace != "" {
+		t.Errorf("expected a created copy in namespace research, got %s/%s", created.Namespace, created.ResourceVersion)
+	}
+	if _, err := New(c).TorchrunJobs("other").Create(ctx, job, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	list, err := jobs.List(ctx, metav1.ListOptions{LabelSelector: "team=vision"})
+	if err != nil || len(list.Items) != 1 || list.Items[0].Namespace != "research" {
+		t.Errorf("expected the job of namespace research, got %v, %v", list, err)
+	}
+	if list, err := jobs.List(ctx, metav1.ListOptions{LabelSelector: "team=nlp"}); err != nil || len(list.Items) != 0 {
+		t.Errorf("expected no jobs of team nlp, got %v, %v", list, err)
+	}
+	if _, err := jobs.List(ctx, metav1.ListOptions{LabelSelector: "team in ("}); err == nil {
+		t.Errorf("expected an error for an invalid selector")
+	}
+
+	if err := jobs.Delete(ctx, "train", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := jobs.Get(ctx, "train", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the job to be deleted, got %v", err)
+	}
+}
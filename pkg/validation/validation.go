@@ -0,0 +1,26 @@
+// Package validation lints TorchrunJob manifests against the TorchrunQueue they are submitted to
+// before submission, e.g. in CI pipelines, with the checks the controller runs when it admits
+// a job. It reads nothing from the cluster.
+//
+//	if err := validation.Validate(job, queue); err != nil {
+//		return fmt.Errorf("invalid job %s: %w", job.Name, err)
+//	}
+package validation
+
+import (
+	torchrunv1alpha1 "github.com/dream3d/torchrun-controller/api/v1alpha1"
+	"github.com/dream3d/torchrun-controller/internal/config"
+	job "github.com/dream3d/torchrun-controller/internal/controller/job"
+)
+
+// Validate checks the job against the queue as the controller does when it admits the job: the
+// pod template of the queue patched by the job, the child queue, profile, priority, node and GPU
+// limits and the kai-scheduler quota. The returned error joins every problem found.
+//
+// The CRD defaults and validation rules are applied by the API server, so run a server dry run,
+// e.g. kubectl apply --dry-run=server, for them. Queue bindings and the per-user limit depend on
+// the cluster and are not checked, and a job with templateRef or cloneFrom is checked as written.
+// Queues and jobs without a schedulerName are checked as kai-scheduler ones.
+func Validate(torchrunJob *torchrunv1alpha1.TorchrunJob, queue *torchrunv1alpha1.TorchrunQueue) error {
+	return job.ValidateJob(torchrunJob, queue, config.KaiSchedulerName)
+}